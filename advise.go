@@ -0,0 +1,309 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Thresholds used by `AdviseLayout`.
+const (
+	// The fraction of empty values above which `omitempty` is suggested.
+	adviseEmptyShare = 0.5
+
+	// The fraction of the encoded size that an option must save to be
+	// suggested.
+	adviseMinSavings = 0.1
+)
+
+// LayoutAdvice describes the tag and writer option changes suggested by
+// `AdviseLayout`.
+type LayoutAdvice struct {
+	// The number of elements analyzed.
+	Samples int
+
+	// The advice for each tagged field of the element type, in field order.
+	Fields []FieldAdvice
+
+	// The writer options suggested for files of the elements, such as
+	// `WithVarints()`, with a reason for each.
+	Options []OptionAdvice
+
+	// The size of the sample when written with `Version3` and no options.
+	Size int
+}
+
+// FieldAdvice describes the tag changes suggested for a struct field.
+type FieldAdvice struct {
+	// The Go name of the field and its `rsf` tag.
+	Field string
+	Tag   string
+
+	// The suggested tag, which equals `Tag` when no changes are suggested.
+	SuggestedTag string
+
+	// Explains each suggested change.
+	Reasons []string
+}
+
+// Changed returns true if tag changes are suggested for the field.
+func (a FieldAdvice) Changed() bool {
+	return a.SuggestedTag != a.Tag
+}
+
+// OptionAdvice describes a suggested writer option.
+type OptionAdvice struct {
+	// The option, e.g., "Chain(Zstd())".
+	Option string
+	Reason string
+
+	// The size of the sample when written with the option.
+	Size int
+}
+
+// AdviseLayout analyzes a sample of elements, such as the objects written to a
+// file, and suggests tag and writer option changes that make the written data
+// smaller or faster to read. For each tagged field of `T`, it suggests:
+//
+//   - `fixed:N` for strings that are always `N` bytes, or empty with
+//     `omitempty`
+//   - `int8`, `int16`, or `int32` for signed integers that always fit
+//   - `omitempty` for fields that are usually empty
+//   - `index:F` for struct arrays whose elements have unique integer or fixed
+//     string values of the field `F`
+//
+// It also writes the sample with `WithVarints()` and with `Chain(Zstd())`
+// and suggests each option that saves at least 10% of the size. Suggestions
+// are based only on the sample, so they should be checked against the range
+// of values expected. Suggested tags require `Version3` or later.
+func AdviseLayout[T any](sample []T) (LayoutAdvice, error) {
+	v := reflect.TypeOf((*T)(nil)).Elem()
+	if v.Kind() != reflect.Struct {
+		return LayoutAdvice{}, fmt.Errorf("cannot advise layout of non-struct type %s", v)
+	}
+	advice := LayoutAdvice{Samples: len(sample)}
+	if len(sample) == 0 {
+		return advice, nil
+	}
+
+	vals := make([]reflect.Value, len(sample))
+	for i := range sample {
+		vals[i] = reflect.ValueOf(&sample[i]).Elem()
+	}
+	for i := 0; i < v.NumField(); i++ {
+		t := &tag{}
+		_, tagged, err := parseTag(v, i, t)
+		if err != nil {
+			return LayoutAdvice{}, fmt.Errorf("field %s: %w", v.Field(i).Name, err)
+		}
+		if !tagged {
+			continue
+		}
+		raw := v.Field(i).Tag.Get(tagName)
+		field := FieldAdvice{Field: v.Field(i).Name, Tag: raw, SuggestedTag: raw}
+		adviseField(&field, v.Field(i).Type, t, vals, i)
+		advice.Fields = append(advice.Fields, field)
+	}
+
+	var err error
+	advice.Size, err = sampleSize(sample)
+	if err != nil {
+		return LayoutAdvice{}, err
+	}
+	for _, option := range []struct {
+		name   string
+		reason string
+		opt    WriterOption
+	}{
+		{"WithVarints()", "integers and lengths are usually small", WithVarints()},
+		{"Chain(Zstd())", "objects compress well", Chain(Zstd())},
+	} {
+		sz, err := sampleSize(sample, option.opt)
+		if err != nil {
+			return LayoutAdvice{}, err
+		}
+		saved := 1 - float64(sz)/float64(advice.Size)
+		if saved >= adviseMinSavings {
+			reason := fmt.Sprintf("%s; saves %.0f%% (%d to %d bytes)", option.reason, saved*100, advice.Size, sz)
+			advice.Options = append(advice.Options, OptionAdvice{Option: option.name, Reason: reason, Size: sz})
+		}
+	}
+	return advice, nil
+}
+
+// adviseField records the suggested tag changes for the field at position
+// `index` of the struct values `vals`.
+func adviseField(field *FieldAdvice, v reflect.Type, t *tag, vals []reflect.Value, index int) {
+	suggest := func(part, reason string, args ...any) {
+		field.SuggestedTag += rsfDelim + part
+		field.Reasons = append(field.Reasons, fmt.Sprintf(reason, args...))
+	}
+	if t.name == "" || t.expires || t.deleted || t.chunked || v.Kind() == reflect.Pointer {
+		return
+	}
+
+	var empty int
+	for _, val := range vals {
+		if isEmptyValue(val.Field(index)) {
+			empty++
+		}
+	}
+	omitEmpty := t.omitEmpty
+	share := float64(empty) / float64(len(vals))
+	if !omitEmpty && v.Kind() != reflect.Bool && share >= adviseEmptyShare {
+		omitEmpty = true
+		suggest(rsfOmitEmpty, "%.0f%% of values are empty", share*100)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if t.fixed > 0 {
+			return
+		}
+		sz := -1
+		for _, val := range vals {
+			l := val.Field(index).Len()
+			if l == 0 && omitEmpty {
+				continue
+			}
+			if sz >= 0 && l != sz {
+				return
+			}
+			sz = l
+		}
+		if sz > 0 {
+			suggest(fmt.Sprintf("%s%s%d", rsfFixed, rsfSep, sz), "all values are %d bytes", sz)
+		}
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		if t.intWidth > 0 {
+			return
+		}
+		var lo, hi int64
+		for _, val := range vals {
+			n := val.Field(index).Int()
+			lo, hi = min(lo, n), max(hi, n)
+		}
+		for _, width := range []struct {
+			name     string
+			min, max int64
+		}{
+			{rsfInt8, math.MinInt8, math.MaxInt8},
+			{rsfInt16, math.MinInt16, math.MaxInt16},
+			{rsfInt32, math.MinInt32, math.MaxInt32},
+		} {
+			if lo >= width.min && hi <= width.max {
+				suggest(width.name, "all values are from %d to %d", lo, hi)
+				return
+			}
+		}
+	case reflect.Slice:
+		if t.index != "" || v.Elem().Kind() != reflect.Struct {
+			return
+		}
+		if key := adviseIndex(v.Elem(), vals, index); key != "" {
+			suggest(rsfIndex+rsfSep+key, "elements have unique %s values", key)
+		}
+	}
+}
+
+// adviseIndex returns the name of a field of the struct type `el` whose values
+// are unique within each array at position `index` of the struct values
+// `vals`, or an empty string if there is none. Only integer and fixed string
+// fields can be keys.
+func adviseIndex(el reflect.Type, vals []reflect.Value, index int) string {
+	for i := 0; i < el.NumField(); i++ {
+		t := &tag{}
+		_, tagged, err := parseTag(el, i, t)
+		if err != nil || !tagged || t.name == "" {
+			continue
+		}
+		switch el.Field(i).Type.Kind() {
+		case reflect.String:
+			if t.fixed == 0 {
+				continue
+			}
+		case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		default:
+			continue
+		}
+		unique := true
+		for _, val := range vals {
+			arr := val.Field(index)
+			seen := make(map[any]bool, arr.Len())
+			for j := 0; j < arr.Len() && unique; j++ {
+				key := arr.Index(j).Field(i).Interface()
+				unique = !seen[key]
+				seen[key] = true
+			}
+		}
+		if unique {
+			return t.name
+		}
+	}
+	return ""
+}
+
+// sampleSize returns the size of `sample` written with `opts`.
+func sampleSize[T any](sample []T, opts ...WriterOption) (int, error) {
+	counter := NewCountingWriter(io.Discard)
+	w := NewWriterWithVersion(counter, Version3, opts...)
+	for _, v := range sample {
+		_, err := w.WriteObject(v)
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err := w.Finalize()
+	if err != nil {
+		return 0, err
+	}
+	return counter.Pos(), nil
+}
+
+// WriteReport writes a report of the advice to `w`, followed by the fields of
+// the element type with the suggested tags.
+func (a LayoutAdvice) WriteReport(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Analyzed %d elements (%d bytes)\n", a.Samples, a.Size)
+	var changed int
+	for _, field := range a.Fields {
+		for _, reason := range field.Reasons {
+			fmt.Fprintf(buf, "  %s: %s\n", field.Field, reason)
+		}
+		if field.Changed() {
+			changed++
+		}
+	}
+	for _, option := range a.Options {
+		fmt.Fprintf(buf, "  use %s: %s\n", option.Option, option.Reason)
+	}
+	if changed == 0 && len(a.Options) == 0 {
+		buf.WriteString("  no changes suggested\n")
+	}
+	if changed > 0 {
+		buf.WriteString("\nSuggested tags:\n")
+		width := 0
+		for _, field := range a.Fields {
+			width = max(width, len(field.Field))
+		}
+		for _, field := range a.Fields {
+			if !field.Changed() {
+				continue
+			}
+			fmt.Fprintf(buf, "  %-*s `%s:%q`\n", width, field.Field, tagName, field.SuggestedTag)
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// String returns the report written by `WriteReport`.
+func (a LayoutAdvice) String() string {
+	var sb strings.Builder
+	_ = a.WriteReport(&sb)
+	return sb.String()
+}
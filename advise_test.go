@@ -0,0 +1,109 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AdviseSuite struct {
+	suite.Suite
+}
+
+func TestAdviseSuite(t *testing.T) {
+	suite.Run(t, &AdviseSuite{})
+}
+
+type adviseRelease struct {
+	ID      int64  `rsf:"id"`
+	Version string `rsf:"version"`
+}
+
+type advisePkg struct {
+	Name      string          `rsf:"name"`
+	Checksum  string          `rsf:"checksum"`
+	Notes     string          `rsf:"notes"`
+	Downloads int64           `rsf:"downloads"`
+	Stars     int64           `rsf:"stars,int32"`
+	Size      int64           `rsf:"size"`
+	Archived  bool            `rsf:"archived"`
+	Releases  []adviseRelease `rsf:"releases"`
+	Ignored   string          `rsf:"-"`
+}
+
+func advisePkgs() []advisePkg {
+	var pkgs []advisePkg
+	for i := 0; i < 20; i++ {
+		pkg := advisePkg{
+			Name:      fmt.Sprintf("pkg%d", i),
+			Checksum:  fmt.Sprintf("%08x", i),
+			Downloads: int64(i * 10000),
+			Stars:     int64(i),
+			Size:      1 << 40,
+			Releases:  []adviseRelease{{ID: 1, Version: "1.0"}, {ID: 2, Version: "1.0"}},
+		}
+		if i%4 == 0 {
+			pkg.Notes = strings.Repeat("notes ", 50)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
+
+func (s *AdviseSuite) TestAdviseLayout() {
+	advice, err := AdviseLayout(advisePkgs())
+	s.Require().Nil(err)
+	s.Assert().Equal(20, advice.Samples)
+
+	suggested := make(map[string]string)
+	for _, field := range advice.Fields {
+		suggested[field.Field] = field.SuggestedTag
+		s.Assert().Equal(field.Changed(), len(field.Reasons) > 0, field.Field)
+	}
+	s.Assert().Equal(map[string]string{
+		"Name":      "name",
+		"Checksum":  "checksum,fixed:8",
+		"Notes":     "notes,omitempty,fixed:300",
+		"Downloads": "downloads,int32",
+		"Stars":     "stars,int32",
+		"Size":      "size",
+		"Archived":  "archived",
+		"Releases":  "releases,index:id",
+	}, suggested)
+
+	var options []string
+	for _, option := range advice.Options {
+		options = append(options, option.Option)
+		s.Assert().Less(option.Size, advice.Size)
+	}
+	s.Assert().Equal([]string{"WithVarints()", "Chain(Zstd())"}, options)
+
+	report := advice.String()
+	s.Assert().Contains(report, "Analyzed 20 elements")
+	s.Assert().Contains(report, "Notes: 75% of values are empty")
+	s.Assert().Contains(report, "Downloads: all values are from 0 to 190000")
+	s.Assert().Contains(report, "use Chain(Zstd()): objects compress well")
+	s.Assert().Contains(report, "Checksum  `rsf:\"checksum,fixed:8\"`")
+	s.Assert().NotContains(report, "Name  ")
+
+	// Suggested tags can be written
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version3).WriteObject(struct {
+		Checksum string `rsf:"checksum,fixed:8"`
+		Notes    string `rsf:"notes,omitempty,fixed:300"`
+	}{Checksum: "00000001"})
+	s.Assert().Nil(err)
+}
+
+func (s *AdviseSuite) TestNoChanges() {
+	advice, err := AdviseLayout([]channelObject{})
+	s.Require().Nil(err)
+	s.Assert().Equal("Analyzed 0 elements (0 bytes)\n  no changes suggested\n", advice.String())
+
+	_, err = AdviseLayout([]string{"a"})
+	s.Assert().EqualError(err, "cannot advise layout of non-struct type string")
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"io"
+)
+
+// Aggregate computes grouped aggregates over the elements of the top-level
+// array `field` of the object `obj`, such as the number of packages with each
+// license. Elements are read one at a time, in the same form as `ReadFieldAt`,
+// so the array is never held in memory. For each element, `keyFn` returns the
+// group of the element, or false to skip the element, and `reduceFn` combines
+// the group's accumulated value, which starts as the zero value, with the
+// element. Expired and deleted elements are omitted as with `ReadFieldAt`.
+//
+//	counts, err := Aggregate(ra, obj, "packages", GroupBy[string]("license"), Count)
+//	sizes, err := Aggregate(ra, obj, "packages", GroupBy[string]("license"), Sum("size"))
+//
+// Each element is read with separate reads of `ra`, so wrap files in a
+// `CoalescingReaderAt` or read them from memory.
+func Aggregate[K comparable, A any](ra io.ReaderAt, obj ObjectRef, field string, keyFn func(el any) (K, bool), reduceFn func(acc A, el any) A) (map[K]A, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := objectReader(ra, obj)
+	pos, off, err := s.fieldOffset(obj, field)
+	if err != nil {
+		return nil, err
+	}
+	entry := obj.Index[pos]
+	if entry.FieldType != FieldTypeArray {
+		return nil, fmt.Errorf("field %s is not an array", field)
+	}
+	elEntry, err := elementEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	sz, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, err
+	}
+	end := off + int64(sz)
+	arrayLen, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return nil, err
+	}
+
+	// The elements of indexed arrays follow the array index, and each key is
+	// read from the index with its element.
+	keyOff := next
+	if entry.Indexed {
+		next += int64(arrayLen * entry.indexEntrySize())
+	}
+
+	groups := make(map[K]A)
+	for i := 0; i < arrayLen; i++ {
+		if next >= end && !entry.emptyElements() {
+			return nil, ErrArrayMismatch{Pos: off, Len: arrayLen, Size: sz, ReadLen: i, ReadSize: int(next - off)}
+		}
+		var el any
+		el, next, err = s.readElement(entry, elEntry, next)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Indexed {
+			var keys []any
+			keys, keyOff, err = s.readKeys(entry, keyOff, 1)
+			if err != nil {
+				return nil, err
+			}
+			err = setElementKey(entry, el, keys[0])
+			if err != nil {
+				return nil, fmt.Errorf("array %s element %d: %w", field, i, err)
+			}
+		}
+
+		kept, _ := obj.filter(entry, []any{el}).([]any)
+		if len(kept) == 0 {
+			continue
+		}
+		key, ok := keyFn(kept[0])
+		if ok {
+			groups[key] = reduceFn(groups[key], kept[0])
+		}
+	}
+	if next != end {
+		return nil, ErrArrayMismatch{Pos: off, Len: arrayLen, Size: sz, ReadLen: arrayLen, ReadSize: int(next - off)}
+	}
+	return groups, nil
+}
+
+// GroupBy returns a key function for `Aggregate` that groups struct array
+// elements by the value of `field`. Elements whose field is missing or not of
+// type K are skipped. Field values have the types returned by `ReadFieldAt`,
+// e.g., `int64` for integer fields.
+func GroupBy[K comparable](field string) func(el any) (K, bool) {
+	return func(el any) (K, bool) {
+		m, _ := el.(map[string]any)
+		key, ok := m[field].(K)
+		return key, ok
+	}
+}
+
+// Count is a reduce function for `Aggregate` that counts the elements in each
+// group.
+func Count(n int, _ any) int {
+	return n + 1
+}
+
+// Sum returns a reduce function for `Aggregate` that sums the numeric `field`
+// of the struct array elements in each group. Missing and non-numeric values
+// are ignored.
+func Sum(field string) func(total float64, el any) float64 {
+	return func(total float64, el any) float64 {
+		m, _ := el.(map[string]any)
+		switch val := m[field].(type) {
+		case int64:
+			return total + float64(val)
+		case uint64:
+			return total + float64(val)
+		case float64:
+			return total + val
+		}
+		return total
+	}
+}
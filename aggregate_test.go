@@ -0,0 +1,99 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AggregateSuite struct {
+	suite.Suite
+}
+
+func TestAggregateSuite(t *testing.T) {
+	suite.Run(t, &AggregateSuite{})
+}
+
+type aggregatePkg struct {
+	Name    string `rsf:"name,fixed:5"`
+	License string `rsf:"license"`
+	Size    int64  `rsf:"size"`
+}
+
+type aggregateRepo struct {
+	Indexed  []aggregatePkg `rsf:"indexed,index:name"`
+	Packages []aggregatePkg `rsf:"packages"`
+	Tags     []string       `rsf:"tags"`
+	Name     string         `rsf:"name"`
+}
+
+var aggregatePkgs = []aggregatePkg{
+	{Name: "plyr1", License: "MIT", Size: 10},
+	{Name: "dplyr", License: "GPL", Size: 20},
+	{Name: "rlang", License: "MIT", Size: 30},
+	{Name: "shiny", License: "GPL", Size: 5},
+	{Name: "knitr", License: "", Size: 1},
+}
+
+func (s *AggregateSuite) open(v any, opts ...ReaderOption) (*bytes.Reader, ObjectRef) {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(v)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra, opts...)
+	s.Require().Nil(err)
+	return ra, obj
+}
+
+func (s *AggregateSuite) TestAggregate() {
+	repo := aggregateRepo{Indexed: aggregatePkgs, Packages: aggregatePkgs, Tags: []string{"a", "b", "a"}}
+	ra, obj := s.open(repo)
+	for _, field := range []string{"indexed", "packages"} {
+		counts, err := Aggregate(ra, obj, field, GroupBy[string]("license"), Count)
+		s.Require().Nil(err)
+		s.Assert().Equal(map[string]int{"MIT": 2, "GPL": 2, "": 1}, counts)
+
+		sizes, err := Aggregate(ra, obj, field, GroupBy[string]("license"), Sum("size"))
+		s.Require().Nil(err)
+		s.Assert().Equal(map[string]float64{"MIT": 40, "GPL": 25, "": 1}, sizes)
+
+		// Elements can be skipped, and indexed keys are available.
+		names, err := Aggregate(ra, obj, field, func(el any) (string, bool) {
+			name := el.(map[string]any)["name"].(string)
+			return name[:1], name != "knitr"
+		}, Count)
+		s.Require().Nil(err)
+		s.Assert().Equal(map[string]int{"p": 1, "d": 1, "r": 1, "s": 1}, names)
+	}
+
+	// Primitive elements are aggregated directly.
+	tags, err := Aggregate(ra, obj, "tags", func(el any) (string, bool) {
+		return el.(string), true
+	}, Count)
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]int{"a": 2, "b": 1}, tags)
+
+	// Empty arrays have no groups.
+	ra, obj = s.open(aggregateRepo{})
+	counts, err := Aggregate(ra, obj, "packages", GroupBy[string]("license"), Count)
+	s.Require().Nil(err)
+	s.Assert().Empty(counts)
+}
+
+func (s *AggregateSuite) TestExpired() {
+	ra, obj := s.open(expiryBuild, WithExpiry(expiryNow))
+	counts, err := Aggregate(ra, obj, "artifacts", GroupBy[string]("name"), Count)
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]int{"bin": 1, "new": 1}, counts)
+}
+
+func (s *AggregateSuite) TestErrors() {
+	ra, obj := s.open(aggregateRepo{})
+	_, err := Aggregate(ra, obj, "name", GroupBy[string]("license"), Count)
+	s.Assert().ErrorContains(err, "field name is not an array")
+	_, err = Aggregate(ra, obj, "missing", GroupBy[string]("license"), Count)
+	s.Assert().NotNil(err)
+}
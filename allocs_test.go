@@ -0,0 +1,120 @@
+// Copyright (C) 2023 by Posit Software, PBC
+
+//go:build !rsfdebug && !race
+
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// AllocsSuite pins the maximum allocations of the hot read paths, so that
+// changes cannot silently add allocations per field or element. The limits
+// are exact; lower them when a change removes allocations. The tests are
+// skipped with the `rsfdebug` build tag and the race detector, which
+// allocate.
+type AllocsSuite struct {
+	suite.Suite
+}
+
+func TestAllocsSuite(t *testing.T) {
+	suite.Run(t, &AllocsSuite{})
+}
+
+type allocsSnap struct {
+	Date   string `rsf:"date,fixed:10"`
+	Size   int64  `rsf:"size"`
+	Yanked bool   `rsf:"yanked"`
+}
+
+type allocsPkg struct {
+	Name      string       `rsf:"name"`
+	Snapshots []allocsSnap `rsf:"snapshots,index:date"`
+}
+
+func (s *AllocsSuite) write() *bytes.Reader {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(allocsPkg{
+		Name: "ggplot2",
+		Snapshots: []allocsSnap{
+			{Date: "2024-01-01", Size: 100},
+			{Date: "2024-02-01", Size: 200, Yanked: true},
+		},
+	})
+	s.Require().Nil(err)
+	return bytes.NewReader(buf.Bytes())
+}
+
+func (s *AllocsSuite) TestReadStringField() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteStringField(0, "ggplot2", buf)
+	s.Require().Nil(err)
+	data := buf.Bytes()
+
+	rd := bytes.NewReader(data)
+	br := bufio.NewReader(rd)
+	r := NewReader()
+	allocs := testing.AllocsPerRun(100, func() {
+		rd.Reset(data)
+		br.Reset(rd)
+		_, err = r.ReadStringField(br)
+	})
+	s.Require().Nil(err)
+	s.Assert().LessOrEqual(allocs, 3.0)
+
+	sr := NewStatelessReader(bytes.NewReader(data))
+	allocs = testing.AllocsPerRun(100, func() {
+		_, _, err = sr.ReadStringField(0)
+	})
+	s.Require().Nil(err)
+	s.Assert().LessOrEqual(allocs, 4.0)
+}
+
+func (s *AllocsSuite) TestReadFieldAt() {
+	ra := s.write()
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	allocs := testing.AllocsPerRun(100, func() {
+		_, err = ReadFieldAt(ra, obj, "name")
+	})
+	s.Require().Nil(err)
+	s.Assert().LessOrEqual(allocs, 5.0)
+}
+
+func (s *AllocsSuite) TestElementRead() {
+	ra := s.write()
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	handles, err := ElementHandles(ra, obj, "snapshots")
+	s.Require().Nil(err)
+	allocs := testing.AllocsPerRun(100, func() {
+		_, err = handles[1].Read()
+	})
+	s.Require().Nil(err)
+	s.Assert().LessOrEqual(allocs, 10.0)
+}
+
+func (s *AllocsSuite) TestElementAt() {
+	ra := s.write()
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	allocs := testing.AllocsPerRun(100, func() {
+		_, err = ElementAt(ra, obj, "snapshots", "2024-02-01")
+	})
+	s.Require().Nil(err)
+	s.Assert().LessOrEqual(allocs, 20.0)
+}
+
+func (s *AllocsSuite) TestStoreGet() {
+	store, err := NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs), "name")
+	s.Require().Nil(err)
+	allocs := testing.AllocsPerRun(100, func() {
+		_, err = store.Get("dplyr")
+	})
+	s.Require().Nil(err)
+	s.Assert().LessOrEqual(allocs, 10.0)
+}
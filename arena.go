@@ -0,0 +1,167 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// DefaultArenaSlabSize is the slab size, in bytes, used by `NewArena` when
+// the requested size is not positive.
+const DefaultArenaSlabSize = 1 << 20
+
+// Arena carves the strings and slices decoded by a Reader from large slabs,
+// rather than allocating each value separately, which reduces the number of
+// objects tracked by the garbage collector for jobs that decode entire
+// snapshots. Use `WithArena` to read with an arena:
+//
+//	arena := NewArena(0)
+//	reader := NewReader(WithArena(arena))
+//	for {
+//		err = reader.ReadObject(r, &pkg)
+//		...
+//	}
+//	arena.Reset()
+//
+// With an arena, `ReadObject`, `ReadStringField`, `ReadFixedStringField`,
+// and the bulk `Read*ArrayField` methods allocate string data, decoded
+// arrays, and bulk array values from the arena's slabs.
+//
+// Values read with an arena are ordinary Go values and remain valid for as
+// long as they are referenced, including after `Reset`. Slabs are never
+// reused; a slab is freed by the garbage collector once none of the values
+// carved from it are referenced, so all of the values decoded together are
+// freed together. Conversely, retaining any single value retains its entire
+// slab, so copy values that outlive the rest of the decoded data, e.g., with
+// `strings.Clone`. Values larger than a quarter of the slab size are allocated
+// separately. An Arena is safe for concurrent use.
+type Arena struct {
+	slabSize int
+
+	// Guards the unused portion of the current slab of each type.
+	mu       sync.Mutex
+	bytes    []byte
+	anys     []any
+	strings  []string
+	int64s   []int64
+	float64s []float64
+
+	// The number of slabs allocated since the arena was created.
+	slabs int
+}
+
+// NewArena creates an arena that allocates slabs of `slabSize` bytes, or
+// `DefaultArenaSlabSize` bytes if `slabSize` is not positive.
+func NewArena(slabSize int) *Arena {
+	if slabSize <= 0 {
+		slabSize = DefaultArenaSlabSize
+	}
+	return &Arena{slabSize: slabSize}
+}
+
+// WithArena causes a Reader to allocate decoded values from `arena`. See
+// `Arena`.
+func WithArena(arena *Arena) ReaderOption {
+	return func(f *rsfReader) {
+		f.arena = arena
+	}
+}
+
+// Reset releases the arena's current slabs, so later values are carved from
+// new slabs. Values that were already read are not affected.
+func (a *Arena) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.bytes = nil
+	a.anys = nil
+	a.strings = nil
+	a.int64s = nil
+	a.float64s = nil
+}
+
+// Slabs returns the number of slabs allocated since the arena was created.
+func (a *Arena) Slabs() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.slabs
+}
+
+// carve returns a zeroed slice of `n` elements from the unused portion of
+// `slab`, allocating a new slab of `slabSize` bytes if needed. The returned
+// slice has a capacity of `n`, so appending to it never overwrites other
+// values.
+func carve[T any](a *Arena, slab *[]T, n int) []T {
+	var zero T
+	elSz := int(unsafe.Sizeof(zero))
+	if elSz == 0 || n*elSz > a.slabSize/4 {
+		return make([]T, n)
+	}
+	if len(*slab) < n {
+		*slab = make([]T, a.slabSize/elSz)
+		a.slabs++
+	}
+	vals := (*slab)[:n:n]
+	*slab = (*slab)[n:]
+	return vals
+}
+
+// makeBytes returns a byte slice of length `n`, carved from the arena if
+// `a` is not nil. The caller must fill the slice before any value refers to
+// it, since strings created with `makeString` share the slice's memory.
+func (a *Arena) makeBytes(n int) []byte {
+	if a == nil {
+		return make([]byte, n)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return carve(a, &a.bytes, n)
+}
+
+// makeString returns the contents of `bs` as a string. When `a` is not nil,
+// `bs` must have been returned by `makeBytes`, and the string shares its
+// memory rather than copying it, so `bs` must not be modified afterward.
+func (a *Arena) makeString(bs []byte) string {
+	if a == nil {
+		return string(bs)
+	}
+	if len(bs) == 0 {
+		return ""
+	}
+	return unsafe.String(&bs[0], len(bs))
+}
+
+func (a *Arena) makeAnys(n int) []any {
+	if a == nil {
+		return make([]any, n)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return carve(a, &a.anys, n)
+}
+
+func (a *Arena) makeStrings(n int) []string {
+	if a == nil {
+		return make([]string, n)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return carve(a, &a.strings, n)
+}
+
+func (a *Arena) makeInt64s(n int) []int64 {
+	if a == nil {
+		return make([]int64, n)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return carve(a, &a.int64s, n)
+}
+
+func (a *Arena) makeFloat64s(n int) []float64 {
+	if a == nil {
+		return make([]float64, n)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return carve(a, &a.float64s, n)
+}
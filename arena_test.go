@@ -0,0 +1,159 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ArenaSuite struct {
+	suite.Suite
+}
+
+func TestArenaSuite(t *testing.T) {
+	suite.Run(t, &ArenaSuite{})
+}
+
+func (s *ArenaSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range arraysData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *ArenaSuite) readAll(data []byte, opts ...ReaderOption) []arraysPkg {
+	r := NewReader(opts...)
+	br := bufio.NewReader(bytes.NewReader(data))
+	var pkgs []arraysPkg
+	for {
+		var pkg arraysPkg
+		err := r.ReadObject(br, &pkg)
+		if err == io.EOF {
+			return pkgs
+		}
+		s.Require().Nil(err)
+		pkgs = append(pkgs, pkg)
+	}
+}
+
+func (s *ArenaSuite) TestReadObject() {
+	data := s.write()
+	arena := NewArena(0)
+	s.Assert().Equal(s.readAll(data), s.readAll(data, WithArena(arena)))
+	s.Assert().Equal(2, arena.Slabs())
+
+	// Arrays of structs are carved from the arena.
+	arena = NewArena(0)
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(channelObjectNoIndex{Items: channelItems})
+	s.Require().Nil(err)
+	var obj channelObjectNoIndex
+	err = NewReader(WithArena(arena)).ReadObject(bytes.NewReader(buf.Bytes()), &obj)
+	s.Require().Nil(err)
+	s.Assert().Equal(channelItems, obj.Items)
+	s.Assert().Equal(2, arena.Slabs())
+}
+
+func (s *ArenaSuite) TestLifetime() {
+	data := s.write()
+	arena := NewArena(1024)
+	first := s.readAll(data, WithArena(arena))
+	expected := s.readAll(data)
+
+	// Values remain valid after the arena is reset and reused.
+	arena.Reset()
+	second := s.readAll(data, WithArena(arena))
+	s.Assert().Equal(expected, first)
+	s.Assert().Equal(expected, second)
+	s.Assert().Equal(4, arena.Slabs())
+
+	// Appending to a carved slice does not overwrite other values.
+	tags := append(first[0].Tags, "extra")
+	s.Assert().Equal([]string{"plots", "", "graphics", "extra"}, tags)
+	s.Assert().Equal(expected, first)
+}
+
+func (s *ArenaSuite) TestBulkArrays() {
+	arena := NewArena(256)
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader(WithArena(arena))
+	_, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	name, err := r.ReadStringField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal("ggplot2", name)
+	tags, err := r.ReadStringArrayField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(arraysData[0].Tags, tags)
+	s.Assert().Equal(len(tags), cap(tags))
+	downloads, err := r.ReadIntArrayField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(arraysData[0].Downloads, downloads)
+	scores, err := r.ReadFloatArrayField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(arraysData[0].Scores, scores)
+
+	// One slab each for bytes, strings, ints, and floats.
+	s.Assert().Equal(4, arena.Slabs())
+}
+
+func (s *ArenaSuite) TestLargeValues() {
+	long := strings.Repeat("x", 100)
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(storePkg{Name: long})
+	s.Require().Nil(err)
+
+	// Values larger than a quarter of the slab are allocated separately, so
+	// only the index field names are carved from a slab.
+	arena := NewArena(64)
+	var pkg storePkg
+	err = NewReader(WithArena(arena)).ReadObject(bytes.NewReader(buf.Bytes()), &pkg)
+	s.Require().Nil(err)
+	s.Assert().Equal(long, pkg.Name)
+	s.Assert().Equal(1, arena.Slabs())
+}
+
+func BenchmarkArena(b *testing.B) {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	items := make([]channelItem, 1000)
+	for i := range items {
+		items[i] = channelItem{Key: "abc", Name: strings.Repeat("n", i%32), Score: float64(i)}
+	}
+	_, err := w.WriteObject(channelObjectNoIndex{Items: items})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, useArena := range []bool{false, true} {
+		name := "default"
+		if useArena {
+			name = "arena"
+		}
+		b.Run(name, func(b *testing.B) {
+			var opts []ReaderOption
+			if useArena {
+				opts = append(opts, WithArena(NewArena(0)))
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var obj channelObjectNoIndex
+				err := NewReader(opts...).ReadObject(bytes.NewReader(buf.Bytes()), &obj)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
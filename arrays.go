@@ -0,0 +1,152 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+/*
+
+Arrays of primitive values (e.g., `[]string`, `[]int64`, or `[]float64`) are
+written like other arrays, with each element encoded like a field of the same
+type, and without an array index. The bulk Read* methods read these arrays with
+a single read of the array data, and decode the elements from memory.
+
+Format:
+
+  [array size]                                    // 4 bytes
+  [array length]                                  // 4 bytes
+  [element 1]
+  ...
+  [element n]
+
+*/
+
+// readArrayData reads the size and length of a primitive array, followed by
+// the array data, which is allocated from `arena`, if not nil.
+func (f *rsfReader) readArrayData(r io.Reader, arena *Arena) (int, []byte, error) {
+	start := f.pos
+	sz, err := f.ReadSizeField(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	arrayLen, err := f.ReadSizeField(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if sz < sizeFieldLen*2 {
+		return 0, nil, ErrArrayMismatch{Pos: int64(start), Len: arrayLen, Size: sz, ReadSize: sizeFieldLen * 2}
+	}
+	data := arena.makeBytes(sz - sizeFieldLen*2)
+	i, err := io.ReadFull(f.source(r), data)
+	f.pos += i
+	if err != nil {
+		return 0, nil, err
+	}
+	return arrayLen, data, nil
+}
+
+// checkArrayData returns an error if the data of a primitive array does not
+// contain `arrayLen` elements of `elSz` bytes.
+func checkArrayData(start, arrayLen, elSz int, data []byte) error {
+	if len(data) != arrayLen*elSz {
+		readLen := len(data) / elSz
+		if readLen > arrayLen {
+			readLen = arrayLen
+		}
+		return ErrArrayMismatch{Pos: int64(start), Len: arrayLen, Size: len(data) + sizeFieldLen*2, ReadLen: readLen, ReadSize: readLen*elSz + sizeFieldLen*2}
+	}
+	return nil
+}
+
+// ReadStringArrayField reads an array of variable-length strings, such as a
+// `[]string` field. Empty arrays are read as nil.
+func (f *rsfReader) ReadStringArrayField(r io.Reader) ([]string, error) {
+	f.owner.check()
+	start := f.pos
+	arrayLen, data, err := f.readArrayData(r, f.arena)
+	if err != nil || arrayLen == 0 {
+		return nil, err
+	}
+
+	// Convert the data once, so the elements share a single allocation.
+	all := f.arena.makeString(data)
+	vals := f.arena.makeStrings(arrayLen)
+	var off int
+	for i := range vals {
+		sz, n := f.enc.parseLength(data[off:])
+		if n == 0 || off+n+sz > len(all) {
+			return nil, ErrArrayMismatch{Pos: int64(start), Len: arrayLen, Size: len(data) + sizeFieldLen*2, ReadLen: i, ReadSize: off + sizeFieldLen*2}
+		}
+		end := off + n + sz
+		vals[i] = all[off+n : end]
+		off = end
+	}
+	if off != len(all) {
+		return nil, ErrArrayMismatch{Pos: int64(start), Len: arrayLen, Size: len(data) + sizeFieldLen*2, ReadLen: arrayLen, ReadSize: off + sizeFieldLen*2}
+	}
+	return vals, nil
+}
+
+// ReadIntArrayField reads an array of integers written with the default
+// integer encoding, such as a `[]int64` field. Empty arrays are read as nil.
+func (f *rsfReader) ReadIntArrayField(r io.Reader) ([]int64, error) {
+	f.owner.check()
+	start := f.pos
+	arrayLen, data, err := f.readArrayData(r, nil)
+	if err != nil || arrayLen == 0 {
+		return nil, err
+	}
+	if f.enc.varints {
+		return f.readVarintArray(start, arrayLen, data)
+	}
+	err = checkArrayData(start, arrayLen, sizeInt64, data)
+	if err != nil {
+		return nil, err
+	}
+	vals := f.arena.makeInt64s(arrayLen)
+	for i := range vals {
+		vals[i], _ = binary.Varint(data[i*sizeInt64 : (i+1)*sizeInt64])
+	}
+	return vals, nil
+}
+
+// ReadFloatArrayField reads an array of 8-byte floats, such as a `[]float64`
+// field. Empty arrays are read as nil.
+func (f *rsfReader) ReadFloatArrayField(r io.Reader) ([]float64, error) {
+	f.owner.check()
+	start := f.pos
+	arrayLen, data, err := f.readArrayData(r, nil)
+	if err != nil || arrayLen == 0 {
+		return nil, err
+	}
+	err = checkArrayData(start, arrayLen, sizeFloat64, data)
+	if err != nil {
+		return nil, err
+	}
+	vals := f.arena.makeFloat64s(arrayLen)
+	for i := range vals {
+		vals[i] = math.Float64frombits(f.byteOrder().Uint64(data[i*sizeFloat64:]))
+	}
+	return vals, nil
+}
+
+func (s *StatelessReader) ReadStringArrayField(off int64) ([]string, int64, error) {
+	f, r := s.at(off)
+	vals, err := f.ReadStringArrayField(r)
+	return vals, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadIntArrayField(off int64) ([]int64, int64, error) {
+	f, r := s.at(off)
+	vals, err := f.ReadIntArrayField(r)
+	return vals, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadFloatArrayField(off int64) ([]float64, int64, error) {
+	f, r := s.at(off)
+	vals, err := f.ReadFloatArrayField(r)
+	return vals, int64(f.pos), err
+}
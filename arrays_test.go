@@ -0,0 +1,106 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ArraysSuite struct {
+	suite.Suite
+}
+
+func TestArraysSuite(t *testing.T) {
+	suite.Run(t, &ArraysSuite{})
+}
+
+type arraysPkg struct {
+	Name      string    `rsf:"name"`
+	Tags      []string  `rsf:"tags"`
+	Downloads []int64   `rsf:"downloads"`
+	Scores    []float64 `rsf:"scores"`
+}
+
+var arraysData = []arraysPkg{
+	{
+		Name:      "ggplot2",
+		Tags:      []string{"plots", "", "graphics"},
+		Downloads: []int64{100, -1, 1 << 40},
+		Scores:    []float64{0.5, -2.25},
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *ArraysSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range arraysData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *ArraysSuite) TestReader() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	index, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(int(reflect.String), index[1].SubfieldType)
+
+	for _, expected := range arraysData {
+		_, err = r.BeginObject(br)
+		s.Require().Nil(err)
+		name, err := r.ReadStringField(br)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected.Name, name)
+		tags, err := r.ReadStringArrayField(br)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected.Tags, tags)
+		downloads, err := r.ReadIntArrayField(br)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected.Downloads, downloads)
+		scores, err := r.ReadFloatArrayField(br)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected.Scores, scores)
+		err = r.EndObject(br)
+		s.Require().Nil(err)
+	}
+}
+
+func (s *ArraysSuite) TestStatelessReader() {
+	ra := bytes.NewReader(s.write())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	sr := NewStatelessReader(ra)
+	_, off, err := sr.ReadStringField(obj.Offset + sizeFieldLen)
+	s.Require().Nil(err)
+	tags, off, err := sr.ReadStringArrayField(off)
+	s.Require().Nil(err)
+	s.Assert().Equal(arraysData[0].Tags, tags)
+	downloads, off, err := sr.ReadIntArrayField(off)
+	s.Require().Nil(err)
+	s.Assert().Equal(arraysData[0].Downloads, downloads)
+	scores, off, err := sr.ReadFloatArrayField(off)
+	s.Require().Nil(err)
+	s.Assert().Equal(arraysData[0].Scores, scores)
+	s.Assert().Equal(obj.Offset+int64(obj.Size), off)
+}
+
+func (s *ArraysSuite) TestMismatch() {
+	// Reading an array of strings as integers fails
+	ra := bytes.NewReader(s.write())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	sr := NewStatelessReader(ra)
+	_, off, err := sr.ReadStringField(obj.Offset + sizeFieldLen)
+	s.Require().Nil(err)
+	_, _, err = sr.ReadIntArrayField(off)
+	s.Assert().ErrorAs(err, &ErrArrayMismatch{})
+}
@@ -0,0 +1,177 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	rsf "github.com/rstudio/repository-snapshot-format"
+)
+
+type BenchSuite struct {
+	suite.Suite
+}
+
+func TestBenchSuite(t *testing.T) {
+	suite.Run(t, &BenchSuite{})
+}
+
+func (s *BenchSuite) TestGenerate() {
+	pkgs := Generate(Small)
+	s.Assert().Len(pkgs, Small.Packages)
+	s.Assert().Equal(pkgs, Generate(Small))
+	s.Assert().Len(pkgs[0].Description, Small.DescriptionSize)
+	s.Assert().Len(pkgs[0].Tags, Small.Tags)
+	s.Assert().Len(pkgs[0].Snapshots, Small.Snapshots)
+	s.Assert().Equal("2020-01-10", pkgs[0].Snapshots[9].Date)
+
+	buf := &bytes.Buffer{}
+	sz, err := Write(buf, pkgs)
+	s.Require().Nil(err)
+	s.Assert().Equal(buf.Len(), sz)
+	br := bufio.NewReader(buf)
+	r := rsf.NewReader()
+	for _, expected := range pkgs {
+		var actual Package
+		err = r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+}
+
+// datasets are the datasets used by each benchmark. The large dataset is
+// skipped with `-short`.
+func datasets() []struct {
+	name string
+	cfg  Config
+} {
+	sets := []struct {
+		name string
+		cfg  Config
+	}{
+		{"small", Small},
+		{"medium", Medium},
+		{"large", Large},
+	}
+	if testing.Short() {
+		sets = sets[:2]
+	}
+	return sets
+}
+
+// write returns a file containing the dataset `cfg`.
+func write(b *testing.B, cfg Config, opts ...rsf.WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	_, err := Write(buf, Generate(cfg), opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkWrite(b *testing.B) {
+	for _, set := range datasets() {
+		b.Run(set.name, func(b *testing.B) {
+			pkgs := Generate(set.cfg)
+			b.SetBytes(int64(len(write(b, set.cfg))))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := Write(io.Discard, pkgs)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	for _, set := range datasets() {
+		b.Run(set.name, func(b *testing.B) {
+			data := write(b, set.cfg)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				br := bufio.NewReader(bytes.NewReader(data))
+				r := rsf.NewReader()
+				for {
+					var pkg Package
+					err := r.ReadObject(br, &pkg)
+					if err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkScanField(b *testing.B) {
+	for _, set := range datasets() {
+		b.Run(set.name, func(b *testing.B) {
+			ra := bytes.NewReader(write(b, set.cfg))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				obj, err := rsf.OpenObject(ra)
+				for err == nil {
+					_, err = rsf.ReadFieldAt(ra, obj, "downloads")
+					if err != nil {
+						b.Fatal(err)
+					}
+					obj, err = rsf.NextObject(ra, obj)
+				}
+				if err != io.EOF {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	for _, set := range datasets() {
+		b.Run(set.name, func(b *testing.B) {
+			store, err := rsf.NewSnapshotStore(bytes.NewReader(write(b, set.cfg, rsf.WithFieldOffsets())), "name")
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = store.Get(PackageName(i % set.cfg.Packages))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLookupElement(b *testing.B) {
+	for _, set := range datasets() {
+		b.Run(set.name, func(b *testing.B) {
+			ra := bytes.NewReader(write(b, set.cfg))
+			obj, err := rsf.OpenObject(ra)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = rsf.ElementAt(ra, obj, "snapshots", SnapshotDate(i%set.cfg.Snapshots))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (C) 2023 by Posit Software, PBC
+
+// Package bench generates representative synthetic snapshot datasets and
+// provides benchmarks for the write, scan, and point-lookup paths of the RSF
+// encoder and decoder. Run the benchmarks with:
+//
+//	go test -run '^$' -bench . ./bench
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	rsf "github.com/rstudio/repository-snapshot-format"
+)
+
+// Config describes a synthetic dataset. Datasets are generated
+// deterministically from the seed, so the same config always produces the
+// same objects.
+type Config struct {
+	// The number of top-level package objects.
+	Packages int
+
+	// The number of elements of each package's snapshot array.
+	Snapshots int
+
+	// The number of tags of each package.
+	Tags int
+
+	// The size in bytes of each package description.
+	DescriptionSize int
+
+	// The number of distinct values of low-cardinality string fields, such
+	// as licenses and tags.
+	Cardinality int
+
+	Seed int64
+}
+
+// Small, Medium, and Large are representative datasets of increasing size.
+var (
+	Small  = Config{Packages: 100, Snapshots: 10, Tags: 3, DescriptionSize: 200, Cardinality: 10, Seed: 1}
+	Medium = Config{Packages: 2000, Snapshots: 50, Tags: 5, DescriptionSize: 500, Cardinality: 50, Seed: 1}
+	Large  = Config{Packages: 20000, Snapshots: 100, Tags: 8, DescriptionSize: 1000, Cardinality: 200, Seed: 1}
+)
+
+// Package is a top-level object of a synthetic dataset.
+type Package struct {
+	Name        string     `rsf:"name"`
+	Version     string     `rsf:"version"`
+	License     string     `rsf:"license"`
+	Description string     `rsf:"description"`
+	Downloads   int64      `rsf:"downloads"`
+	Score       float64    `rsf:"score"`
+	Tags        []string   `rsf:"tags"`
+	Snapshots   []Snapshot `rsf:"snapshots,index:date"`
+}
+
+// Snapshot is an element of a package's snapshot array, indexed by date.
+type Snapshot struct {
+	Date    string `rsf:"date,fixed:10"`
+	Version string `rsf:"version"`
+	Size    int64  `rsf:"size"`
+	Yanked  bool   `rsf:"yanked"`
+}
+
+// epoch is the date of the first snapshot of each package.
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Generate generates the packages of the dataset described by `cfg`, in
+// ascending name order.
+func Generate(cfg Config) []Package {
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	cardinality := cfg.Cardinality
+	if cardinality < 1 {
+		cardinality = 1
+	}
+
+	pkgs := make([]Package, cfg.Packages)
+	for i := range pkgs {
+		pkg := Package{
+			Name:        PackageName(i),
+			Version:     version(rnd),
+			License:     fmt.Sprintf("license-%d", rnd.Intn(cardinality)),
+			Description: text(rnd, cfg.DescriptionSize),
+			Downloads:   rnd.Int63n(1 << 32),
+			Score:       rnd.Float64(),
+		}
+		for j := 0; j < cfg.Tags; j++ {
+			pkg.Tags = append(pkg.Tags, fmt.Sprintf("tag-%d", rnd.Intn(cardinality)))
+		}
+		for j := 0; j < cfg.Snapshots; j++ {
+			pkg.Snapshots = append(pkg.Snapshots, Snapshot{
+				Date:    SnapshotDate(j),
+				Version: version(rnd),
+				Size:    rnd.Int63n(1 << 24),
+				Yanked:  rnd.Intn(20) == 0,
+			})
+		}
+		pkgs[i] = pkg
+	}
+	return pkgs
+}
+
+// PackageName returns the name of the package at position `i` in a dataset.
+func PackageName(i int) string {
+	return fmt.Sprintf("pkg%07d", i)
+}
+
+// SnapshotDate returns the date of the snapshot at position `i` in a
+// package's snapshot array.
+func SnapshotDate(i int) string {
+	return epoch.AddDate(0, 0, i).Format(time.DateOnly)
+}
+
+// Write writes `pkgs` to `w` with the latest version and the writer options
+// `opts`, and finalizes the file.
+func Write(w io.Writer, pkgs []Package, opts ...rsf.WriterOption) (int, error) {
+	rw := rsf.NewWriterWithVersion(w, rsf.Version3, opts...)
+	var totalSz int
+	for _, pkg := range pkgs {
+		sz, err := rw.WriteObject(pkg)
+		if err != nil {
+			return 0, err
+		}
+		totalSz += sz
+	}
+	sz, err := rw.Finalize()
+	if err != nil {
+		return 0, err
+	}
+	return totalSz + sz, nil
+}
+
+func version(rnd *rand.Rand) string {
+	return fmt.Sprintf("%d.%d.%d", rnd.Intn(10), rnd.Intn(20), rnd.Intn(100))
+}
+
+// text returns `sz` bytes of words.
+func text(rnd *rand.Rand, sz int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	var sb strings.Builder
+	sb.Grow(sz)
+	for sb.Len() < sz {
+		if sb.Len() > 0 && rnd.Intn(6) == 0 {
+			sb.WriteByte(' ')
+			continue
+		}
+		sb.WriteByte(letters[rnd.Intn(len(letters))])
+	}
+	return sb.String()
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ErrSizeBudgetExceeded is returned when writing a record would exceed the
+// maximum output size set with `WithMaxSize`. When array elements are dropped
+// to fit instead, each dropped element is reported with its array name and
+// position.
+type ErrSizeBudgetExceeded struct {
+	// The array name and element position, for dropped elements
+	Array string
+	Index int
+	// The output size that the write would have produced and the limit
+	Size int
+	Max  int
+}
+
+func (e ErrSizeBudgetExceeded) Error() string {
+	if e.Array != "" {
+		return fmt.Sprintf("array %s element %d dropped: output size %d exceeds maximum size %d", e.Array, e.Index, e.Size, e.Max)
+	}
+	return fmt.Sprintf("output size %d exceeds maximum size %d", e.Size, e.Max)
+}
+
+// budgetState tracks the elements of top-level arrays while fitting an object
+// to the size budget.
+type budgetState struct {
+	// The number of elements to keep, or -1 to keep all elements
+	keep int
+	// The number of elements kept so far
+	seen int
+	// The elements dropped so far
+	dropped []ErrSizeBudgetExceeded
+}
+
+// drop returns true if element `i` of the array `name` should be dropped.
+func (b *budgetState) drop(name string, i int) bool {
+	if b.keep >= 0 && b.seen >= b.keep {
+		b.dropped = append(b.dropped, ErrSizeBudgetExceeded{Array: name, Index: i})
+		return true
+	}
+	b.seen++
+	return false
+}
+
+// prioritize returns a copy of the array or slice `v` with elements ordered by
+// `less`. See `WithPriority`.
+func prioritize(v reflect.Value, less func(a, b any) bool) reflect.Value {
+	sorted := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len(), v.Len())
+	reflect.Copy(sorted, v)
+	sort.SliceStable(sorted.Interface(), func(i, j int) bool {
+		return less(sorted.Index(i).Interface(), sorted.Index(j).Interface())
+	})
+	return sorted
+}
+
+// trailerSize returns the size of the trailers that `Finalize` will write,
+// including an object table entry for the next object.
+func (f *rsfWriter) trailerSize() int {
+	var sz int
+	if f.flags&FlagObjectTable != 0 {
+		sz += objectTableLen(len(f.objects) + 1)
+	}
+	if f.digest == nil {
+		return sz
+	}
+	return sz + trailerFixedLen + f.digest.Size()
+}
+
+// outputSize returns the output size after writing `n` more bytes, including
+// the trailer.
+func (f *rsfWriter) outputSize(n int) int {
+	return f.counter.Pos() + n + f.trailerSize()
+}
+
+func (f *rsfWriter) overBudget(n int) bool {
+	return f.maxSize > 0 && f.outputSize(n) > f.maxSize
+}
+
+// checkBudget returns an error if writing `n` more bytes would exceed the size
+// budget.
+func (f *rsfWriter) checkBudget(n int) error {
+	if f.overBudget(n) {
+		return ErrSizeBudgetExceeded{Size: f.outputSize(n), Max: f.maxSize}
+	}
+	return nil
+}
+
+// trimObject encodes the top-level object `v` as a record that fits the size
+// budget, given that its full record size is `size`. Elements are dropped from
+// the end of the object's top-level arrays, in the order that they are
+// written, so the elements that are kept do not depend on the element sizes.
+// Use `WithPriority` to write higher-priority elements first.
+// The record size is assumed to grow with each element that is kept, so the
+// number of elements to keep is found with a binary search.
+func (f *rsfWriter) trimObject(v any, size int) (*bytes.Buffer, error) {
+	f.budget = &budgetState{keep: -1}
+	onOversize := f.onOversize
+	if onOversize != nil {
+		// Oversized elements were already reported when the object was
+		// first encoded.
+		f.onOversize = func(ErrElementTooLarge) {}
+	}
+	defer func() {
+		f.budget = nil
+		f.onOversize = onOversize
+	}()
+
+	encode := func(keep int) (*bytes.Buffer, error) {
+		f.budget.keep, f.budget.seen, f.budget.dropped = keep, 0, nil
+		buf, offsets, err := f.encodeObject(v)
+		if err != nil {
+			return nil, err
+		}
+		return f.encodeRecord(buf, offsets)
+	}
+
+	// Count the elements that may be dropped.
+	_, err := encode(-1)
+	if err != nil {
+		return nil, err
+	}
+	elements := f.budget.seen
+
+	// Find the smallest number of elements that does not fit.
+	keep := sort.Search(elements, func(keep int) bool {
+		if err != nil {
+			return true
+		}
+		var record *bytes.Buffer
+		record, err = encode(keep)
+		return err == nil && f.overBudget(record.Len())
+	})
+	if err != nil {
+		return nil, err
+	}
+	if keep == 0 {
+		return nil, ErrSizeBudgetExceeded{Size: f.outputSize(size), Max: f.maxSize}
+	}
+
+	record, err := encode(keep - 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, dropped := range f.budget.dropped {
+		dropped.Size = f.outputSize(size)
+		dropped.Max = f.maxSize
+		f.onOverBudget(dropped)
+	}
+	return record, nil
+}
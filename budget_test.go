@@ -0,0 +1,164 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BudgetSuite struct {
+	suite.Suite
+}
+
+func TestBudgetSuite(t *testing.T) {
+	suite.Run(t, &BudgetSuite{})
+}
+
+type budgetPkg struct {
+	Name    string `rsf:"name"`
+	Version string `rsf:"version"`
+}
+
+type budgetRepo struct {
+	Name     string      `rsf:"name"`
+	Packages []budgetPkg `rsf:"packages"`
+}
+
+var budgetData = budgetRepo{
+	Name: "cran",
+	Packages: []budgetPkg{
+		{Name: "ggplot2", Version: "3.4.4"},
+		{Name: "plyr", Version: "1.8.9"},
+		{Name: "dplyr", Version: "1.1.4"},
+		{Name: "tidyr", Version: "1.3.0"},
+	},
+}
+
+// budgetFile writes `objects` and returns the output.
+func budgetFile(objects ...any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithDigest())
+	for _, o := range objects {
+		_, err := w.WriteObject(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := w.Finalize()
+	return buf.Bytes(), err
+}
+
+func (s *BudgetSuite) TestWithMaxSize() {
+	full, err := budgetFile(budgetData, budgetData)
+	s.Require().Nil(err)
+
+	// The full output fits exactly, including the trailer
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithDigest(), WithMaxSize(len(full), nil))
+	_, err = w.WriteObject(budgetData)
+	s.Require().Nil(err)
+	_, err = w.WriteObject(budgetData)
+	s.Require().Nil(err)
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+	s.Assert().Equal(full, buf.Bytes())
+
+	// Writing stops before the record that does not fit
+	one, err := budgetFile(budgetData)
+	s.Require().Nil(err)
+	buf = &bytes.Buffer{}
+	w = NewWriterWithVersion(buf, Version3, WithDigest(), WithMaxSize(len(full)-1, nil))
+	_, err = w.WriteObject(budgetData)
+	s.Require().Nil(err)
+	_, err = w.WriteObject(budgetData)
+	var exceeded ErrSizeBudgetExceeded
+	s.Require().ErrorAs(err, &exceeded)
+	s.Assert().Equal(ErrSizeBudgetExceeded{Size: len(full), Max: len(full) - 1}, exceeded)
+	s.Assert().EqualError(err, fmt.Sprintf("output size %d exceeds maximum size %d", len(full), len(full)-1))
+	s.Assert().Equal(one[:len(one)-trailerFixedLen-32], buf.Bytes())
+
+	// Nothing is written if the index does not fit
+	buf = &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version3, WithMaxSize(10, nil)).WriteObject(budgetData)
+	s.Assert().ErrorAs(err, &exceeded)
+	s.Assert().Equal(0, buf.Len())
+}
+
+func (s *BudgetSuite) TestDropElements() {
+	trimmed := budgetRepo{Name: budgetData.Name, Packages: budgetData.Packages[:2]}
+	expected, err := budgetFile(trimmed)
+	s.Require().Nil(err)
+
+	// Trailing elements are dropped to fit
+	var dropped []ErrSizeBudgetExceeded
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithDigest(), WithMaxSize(len(expected)+5, func(e ErrSizeBudgetExceeded) {
+		dropped = append(dropped, e)
+	}))
+	_, err = w.WriteObject(budgetData)
+	s.Require().Nil(err)
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+	s.Assert().Equal(expected, buf.Bytes())
+	s.Require().Len(dropped, 2)
+	s.Assert().Equal("packages", dropped[0].Array)
+	s.Assert().Equal(2, dropped[0].Index)
+	s.Assert().Equal(3, dropped[1].Index)
+	s.Assert().Equal(len(expected)+5, dropped[0].Max)
+	s.Assert().Greater(dropped[0].Size, dropped[0].Max)
+
+	// Writing fails if the object does not fit without any elements
+	empty, err := budgetFile(budgetRepo{Name: budgetData.Name})
+	s.Require().Nil(err)
+	dropped = nil
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3, WithDigest(), WithMaxSize(len(empty)-1, func(e ErrSizeBudgetExceeded) {
+		dropped = append(dropped, e)
+	})).WriteObject(budgetData)
+	var exceeded ErrSizeBudgetExceeded
+	s.Assert().ErrorAs(err, &exceeded)
+	s.Assert().Empty(exceeded.Array)
+	s.Assert().Nil(dropped)
+}
+
+func (s *BudgetSuite) TestWithPriority() {
+	byName := WithPriority("packages", func(a, b any) bool {
+		return a.(budgetPkg).Name < b.(budgetPkg).Name
+	})
+
+	// Elements are written in priority order
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, byName).WriteObject(budgetData)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	pkgs, err := ReadFieldAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	var names []any
+	for _, pkg := range pkgs.([]any) {
+		names = append(names, pkg.(map[string]any)["name"])
+	}
+	s.Assert().Equal([]any{"dplyr", "ggplot2", "plyr", "tidyr"}, names)
+	s.Assert().Equal("ggplot2", budgetData.Packages[0].Name)
+
+	// The lowest-priority elements are dropped to fit the size budget
+	expected, err := budgetFile(budgetRepo{Name: budgetData.Name, Packages: []budgetPkg{
+		budgetData.Packages[2],
+		budgetData.Packages[0],
+	}})
+	s.Require().Nil(err)
+	var dropped []string
+	buf = &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithDigest(), byName, WithMaxSize(len(expected), func(e ErrSizeBudgetExceeded) {
+		dropped = append(dropped, fmt.Sprintf("%s[%d]", e.Array, e.Index))
+	}))
+	_, err = w.WriteObject(budgetData)
+	s.Require().Nil(err)
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+	s.Assert().Equal(expected, buf.Bytes())
+	s.Assert().Equal([]string{"packages[2]", "packages[3]"}, dropped)
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+/*
+Byte order
+
+By default, sizes and fixed-width values are encoded in little-endian byte
+order. Files written with `WithByteOrder(binary.BigEndian)` set
+`FlagBigEndian` in the file header and encode all fields following the header
+in big-endian byte order instead:
+
+  - Size fields, including the index size, object sizes, array sizes and
+    counts, and string and byte lengths.
+  - Unsigned integers, fixed-width integers, and floats.
+
+The following are always little-endian, so that readers can detect the byte
+order and locate the end of the file before reading any objects:
+
+  - The file header.
+  - The object table (see `WithObjectTable`) and the digest trailer (see
+    `WithDigest`).
+  - Element hashes (see `WithElementHashes`) and the checksums of the
+    `Checksum` layer.
+
+`int64` fields are encoded as varints, which do not depend on the byte order.
+*/
+
+// WithByteOrder sets the byte order of sizes and fixed-width values. The
+// default is `binary.LittleEndian`. Readers detect the byte order from the
+// file header, so files can be read without additional options. Requires
+// Version3 or later when `order` is `binary.BigEndian`.
+func WithByteOrder(order binary.ByteOrder) WriterOption {
+	return func(f *rsfWriter) {
+		if order == binary.BigEndian {
+			f.flags |= FlagBigEndian
+			f.enc.order = binary.BigEndian
+		} else {
+			f.flags &^= FlagBigEndian
+			f.enc.order = nil
+		}
+	}
+}
+
+// encoding describes how the fields following the file header are encoded.
+// The zero value is the default encoding.
+type encoding struct {
+	// The byte order of sizes and fixed-width values, or nil for
+	// little-endian. See `WithByteOrder`.
+	order binary.ByteOrder
+
+	// Whether integers and string lengths are written as compact varints.
+	// See `WithVarints`.
+	varints bool
+}
+
+// encodingFlags are the header flags that select the encoding of fields
+// following the file header.
+const encodingFlags = FlagBigEndian | FlagVarints
+
+// flagsEncoding returns the encoding of a file with the header flags `flags`.
+func flagsEncoding(flags uint32) encoding {
+	e := encoding{varints: flags&FlagVarints != 0}
+	if flags&FlagBigEndian != 0 {
+		e.order = binary.BigEndian
+	}
+	return e
+}
+
+// withEncoding selects the encoding `e`, for rewriting a file with the
+// encoding of the original.
+func withEncoding(e encoding) WriterOption {
+	return func(f *rsfWriter) {
+		WithByteOrder(e.byteOrder())(f)
+		if e.varints {
+			WithVarints()(f)
+		}
+	}
+}
+
+// byteOrder returns the byte order of sizes and fixed-width values.
+func (e encoding) byteOrder() binary.ByteOrder {
+	if e.order == nil {
+		return binary.LittleEndian
+	}
+	return e.order
+}
+
+// byteOrder returns the byte order of sizes and fixed-width values.
+func (f *rsfWriter) byteOrder() binary.ByteOrder {
+	return f.enc.byteOrder()
+}
+
+// defaultEncoding selects the default encoding until the returned function is
+// called, for the parts of the file that are always little-endian with fixed
+// sizes.
+func (f *rsfWriter) defaultEncoding() func() {
+	enc := f.enc
+	f.enc = encoding{}
+	return func() {
+		f.enc = enc
+	}
+}
+
+// byteOrder returns the byte order of sizes and fixed-width values.
+func (f *rsfReader) byteOrder() binary.ByteOrder {
+	return f.enc.byteOrder()
+}
+
+// objectReader returns a `StatelessReader` that reads fields of the object
+// `obj` using the encoding of its file.
+func objectReader(ra io.ReaderAt, obj ObjectRef) *StatelessReader {
+	s := NewStatelessReader(ra)
+	s.enc = flagsEncoding(obj.Flags)
+	return s
+}
+
+// fixedWidth returns the `width` bytes of `bs`, which holds a 64-bit value in
+// the byte order `order`, that hold the low bytes of the value.
+func fixedWidth(order binary.ByteOrder, bs []byte, width int) []byte {
+	if order == binary.BigEndian {
+		return bs[len(bs)-width:]
+	}
+	return bs[:width]
+}
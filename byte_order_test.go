@@ -0,0 +1,158 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ByteOrderSuite struct {
+	suite.Suite
+}
+
+func TestByteOrderSuite(t *testing.T) {
+	suite.Run(t, &ByteOrderSuite{})
+}
+
+type byteOrderRelease struct {
+	Version string `rsf:"version,fixed:5"`
+	Files   int    `rsf:"files,int16"`
+	Size    uint64 `rsf:"size"`
+}
+
+type byteOrderPkg struct {
+	Name      string             `rsf:"name"`
+	Stars     int32              `rsf:"stars,int32"`
+	Downloads int64              `rsf:"downloads"`
+	Score     float64            `rsf:"score"`
+	Vectors   []float32          `rsf:"vectors"`
+	Weights   []float64          `rsf:"weights"`
+	Counts    []int64            `rsf:"counts"`
+	Tags      []string           `rsf:"tags"`
+	Ranks     map[string]float32 `rsf:"ranks"`
+	Checksum  []byte             `rsf:"checksum"`
+	Updated   time.Time          `rsf:"updated"`
+	Releases  []byteOrderRelease `rsf:"releases,index:version"`
+}
+
+var byteOrderData = []byteOrderPkg{
+	{
+		Name:      "ggplot2",
+		Stars:     -70000,
+		Downloads: 1 << 40,
+		Score:     1.0 / 3,
+		Vectors:   []float32{1.5, -2.25},
+		Weights:   []float64{0.5, 1e100},
+		Counts:    []int64{-1, 1 << 33},
+		Tags:      []string{"graphics", "tidyverse"},
+		Ranks:     map[string]float32{"cran": 0.5},
+		Checksum:  []byte{0xde, 0xad, 0xbe, 0xef},
+		Updated:   time.Date(2023, 4, 5, 6, 7, 8, 9, time.UTC),
+		Releases: []byteOrderRelease{
+			{Version: "3.5.0", Files: 300, Size: 1 << 50},
+			{Version: "3.5.1", Files: -1, Size: 7},
+		},
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *ByteOrderSuite) write(opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, opts...)
+	for _, obj := range byteOrderData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+func (s *ByteOrderSuite) TestReadObject() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldHashes(), WithObjectTable(), WithDigest()},
+		{Chain(Checksum(), Zstd()), WithElementHashes()},
+	} {
+		little := s.write(append(opts, WithByteOrder(binary.LittleEndian))...)
+		s.Assert().Equal(s.write(opts...), little)
+		big := s.write(append(opts, WithByteOrder(binary.BigEndian))...)
+		s.Assert().NotEqual(little, big)
+
+		// Readers detect the byte order from the header.
+		r := NewReader()
+		br := bufio.NewReader(VerifyStream(bytes.NewReader(big)))
+		for _, expected := range byteOrderData {
+			var actual byteOrderPkg
+			err := r.ReadObject(br, &actual)
+			s.Require().Nil(err)
+			s.Assert().Equal(expected, actual)
+		}
+		s.Assert().Contains(r.Header().Features(), "big-endian")
+
+		ra := bytes.NewReader(big)
+		obj, err := OpenObject(ra)
+		s.Require().Nil(err)
+		stars, err := ReadFieldAt(ra, obj, "stars")
+		s.Require().Nil(err)
+		s.Assert().Equal(int64(-70000), stars)
+		el, err := ElementAt(ra, obj, "releases", "3.5.0")
+		s.Require().Nil(err)
+		release, err := el.Read()
+		s.Require().Nil(err)
+		s.Assert().Equal(map[string]any{"version": "3.5.0", "files": int64(300), "size": uint64(1 << 50)}, release)
+		obj, err = NextObject(ra, obj)
+		s.Require().Nil(err)
+		name, err := ReadFieldAt(ra, obj, "name")
+		s.Require().Nil(err)
+		s.Assert().Equal("rlang", name)
+	}
+}
+
+func (s *ByteOrderSuite) TestEncoding() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithByteOrder(binary.BigEndian))
+	_, err := w.WriteObject(struct {
+		Name string `rsf:"name"`
+	}{Name: "abc"})
+	s.Require().Nil(err)
+
+	// The header is little-endian, and fields following it are big-endian.
+	bs := buf.Bytes()
+	headerLen := int(binary.LittleEndian.Uint32(bs[len(IndexVersion3):]))
+	obj, err := OpenObject(bytes.NewReader(bs))
+	s.Require().Nil(err)
+	s.Assert().Equal(uint32(FlagBigEndian), obj.Flags)
+	s.Assert().Equal(int(binary.BigEndian.Uint32(bs[len(IndexVersion3)+headerLen:])), int(obj.Offset)-len(IndexVersion3)-headerLen)
+	s.Assert().Equal([]byte{0, 0, 0, 3, 'a', 'b', 'c'}, bs[len(bs)-7:])
+
+	// Big-endian files require Version3 or later.
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version2, WithByteOrder(binary.BigEndian)).WriteObject(channelObject{})
+	s.Assert().ErrorContains(err, "header flags require version 3")
+}
+
+func (s *ByteOrderSuite) TestRewrite() {
+	big := s.write(WithByteOrder(binary.BigEndian), WithDigest())
+
+	// Redacted files keep the byte order.
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(big), []Redaction{{Field: "tags", Mode: RedactBlank}})
+	s.Require().Nil(err)
+	var actual byteOrderPkg
+	err = NewReader().ReadObject(bufio.NewReader(VerifyStream(dst)), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal("ggplot2", actual.Name)
+	s.Assert().Empty(actual.Tags)
+	s.Assert().Equal(byteOrderData[0].Releases, actual.Releases)
+
+	// Change feeds are not supported.
+	_, err = ChangeFeed(bytes.NewReader(big), bytes.NewReader(big), NewWriterWithVersion(&bytes.Buffer{}, Version3))
+	s.Assert().ErrorIs(err, ErrUnsupportedFeature{Flags: FlagBigEndian})
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+/*
+
+A `[]byte` field is written as a size-prefixed blob, like a variable-length
+string, but is recorded in the index with `FieldTypeBytes` so that readers
+return the data as `[]byte` rather than as a string. Version2 and earlier
+record byte fields as `FieldTypeVarStr` instead. Byte fields tagged with
+`chunked` use the chunked encoding. Use `ReadBytesField` to read a byte
+field.
+
+Format:
+
+  [size]                                          // 4 bytes
+  [data]                                          // `size` bytes
+
+*/
+
+// isBytes returns true if `v` is a byte slice type.
+func isBytes(v reflect.Type) bool {
+	return v.Kind() == reflect.Slice && v.Elem().Kind() == reflect.Uint8
+}
+
+func (f *rsfWriter) writeIndexBytes(t *tag, buf *bytes.Buffer) (int, error) {
+	if t.fixed > 0 {
+		return 0, fmt.Errorf("byte field %s cannot be fixed", t.name)
+	}
+	if t.chunked || f.version < 3 {
+		return f.writeIndexString(t, buf)
+	}
+	return f.writeIndexFixed(t, FieldTypeBytes, buf)
+}
+
+func (f *rsfWriter) writeBytes(val []byte, t *tag, buf *bytes.Buffer) (int, error) {
+	if t.chunked {
+		return f.WriteChunkedField(0, defaultChunkSize, bytes.NewReader(val), buf)
+	}
+	return f.WriteBytesField(0, val, buf)
+}
+
+func (f *rsfWriter) WriteBytesField(pos int, val []byte, r io.Writer) (int, error) {
+	// Write size
+	sz, err := f.writeLength(len(val), r)
+	if err != nil {
+		return 0, err
+	}
+
+	// Write value
+	i, err := r.Write(val)
+	if err != nil {
+		return 0, err
+	}
+	sz += i
+
+	return pos + sz, nil
+}
+
+func (f *rsfReader) ReadBytesField(r io.Reader) ([]byte, error) {
+	f.owner.check()
+	sz, err := f.readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	bs := make([]byte, sz)
+	i, err := io.ReadFull(f.source(r), bs)
+	f.pos += i
+	if err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+func (s *StatelessReader) ReadBytesField(off int64) ([]byte, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadBytesField(r)
+	return val, int64(f.pos), err
+}
+
+func printBytes(f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	bs, err := reader.ReadBytesField(r)
+	if err != nil {
+		return fmt.Errorf("error reading bytes: %s", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s (bytes(%d)): %x\n", strings.Repeat(" ", indent*4), f.FieldName, len(bs), bs)
+	return err
+}
@@ -0,0 +1,137 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BytesSuite struct {
+	suite.Suite
+}
+
+func TestBytesSuite(t *testing.T) {
+	suite.Run(t, &BytesSuite{})
+}
+
+type bytesFile struct {
+	Name   string `rsf:"name,fixed:4"`
+	Digest []byte `rsf:"digest"`
+}
+
+type bytesPkg struct {
+	Name      string      `rsf:"name"`
+	Signature []byte      `rsf:"signature"`
+	Archive   []byte      `rsf:"archive,chunked"`
+	Files     []bytesFile `rsf:"files,index:name"`
+}
+
+var bytesData = []bytesPkg{
+	{
+		Name:      "ggplot2",
+		Signature: []byte{0x00, 0xff, 0xfe, 0x80},
+		Archive:   []byte("\x1f\x8b\x08\x00"),
+		Files: []bytesFile{
+			{Name: "DESC", Digest: []byte{0xde, 0xad, 0xbe, 0xef}},
+			{Name: "NEWS"},
+		},
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *BytesSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range bytesData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *BytesSuite) TestReadObject() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	for _, expected := range bytesData {
+		// Empty byte fields are read as nil
+		var actual bytesPkg
+		err := r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+	s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+}
+
+func (s *BytesSuite) TestIndex() {
+	index, err := IndexOf(bytesPkg{})
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "signature", FieldType: FieldTypeBytes}, index[1])
+	s.Assert().Equal(IndexEntry{FieldName: "archive", FieldType: FieldTypeChunked}, index[2])
+	s.Assert().Equal(IndexEntry{FieldName: "digest", FieldType: FieldTypeBytes}, index[3].Subfields[1])
+
+	// Older versions record byte fields as strings
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version2).WriteObject(bytesData[0])
+	s.Require().Nil(err)
+	index, err = NewReader().ReadIndex(bufio.NewReader(buf))
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "signature", FieldType: FieldTypeVarStr}, index[1])
+}
+
+func (s *BytesSuite) TestReadBytesField() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	_, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "signature")
+	s.Require().Nil(err)
+	bs, err := r.ReadBytesField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(bytesData[0].Signature, bs)
+
+	ra := bytes.NewReader(s.write())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "signature")
+	s.Require().Nil(err)
+	s.Assert().Equal(bytesData[0].Signature, val)
+}
+
+func (s *BytesSuite) TestPrint() {
+	out := &strings.Builder{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write())))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `name (string): ggplot2
+signature (bytes(4)): 00fffe80
+`)
+	s.Assert().Contains(out.String(), `digest (bytes(4)): deadbeef`)
+}
+
+func (s *BytesSuite) TestRedact() {
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(s.write()), []Redaction{
+		{Field: "signature", Mode: RedactBlank},
+	})
+	s.Require().Nil(err)
+
+	var actual bytesPkg
+	err = NewReader().ReadObject(bufio.NewReader(dst), &actual)
+	s.Require().Nil(err)
+	s.Assert().Nil(actual.Signature)
+	s.Assert().Equal(bytesData[0].Files, actual.Files)
+}
+
+func (s *BytesSuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		B []byte `rsf:"b,fixed:4"`
+	}{})
+	s.Assert().EqualError(err, "byte field b cannot be fixed")
+}
@@ -0,0 +1,670 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+/*
+
+`ChangeFeed` compares consecutive snapshots and writes a `ChangeSet` object
+that lists the changes between them, so downstream services can consume the
+changes instead of comparing full snapshots themselves.
+
+Top-level objects are matched by position, as when both snapshots are written
+from the same ordered list of objects, and both snapshots must use the same
+index. Elements of top-level indexed struct arrays are matched by key and
+reported as added, removed, or modified. Other top-level fields are reported
+as modified when their data differs, as are objects that are only in one
+snapshot.
+
+Each change includes the encoded data of the new element, field, or object,
+so that `ApplyChangeFeed` can produce the new snapshot from the old snapshot
+and the change feed. Modified elements and fields also include field diffs
+that describe the change.
+
+*/
+
+// The kinds of changes reported by `ChangeFeed`.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// ChangeSet is the object written by `ChangeFeed`.
+type ChangeSet struct {
+	Changes []Change `rsf:"changes"`
+}
+
+// Change describes an added, removed, or modified object, top-level field, or
+// array element. See `ChangeFeed`.
+type Change struct {
+	// The position of the top-level object
+	Object int64 `rsf:"object"`
+
+	// The top-level field, or an empty string for a change to an object.
+	Field string `rsf:"field"`
+
+	// The key of an indexed array element, formatted with `fmt.Sprint`, or
+	// nil for a change to an object or field.
+	Key *string `rsf:"key"`
+
+	// The position of an added or modified element in the new array.
+	Position int64 `rsf:"position"`
+
+	// One of `ChangeAdded`, `ChangeRemoved`, or `ChangeModified`.
+	Kind string `rsf:"kind"`
+
+	// The encoded data of the new object, field, or element. Empty for
+	// removals.
+	Value string `rsf:"value"`
+
+	// The fields that differ, for modified elements and fields.
+	Diffs []FieldChange `rsf:"diffs"`
+}
+
+// FieldChange describes a field that differs. Values are formatted with
+// `fmt.Sprint`, and are nil when the field is missing.
+type FieldChange struct {
+	Field string  `rsf:"field"`
+	Old   *string `rsf:"old"`
+	New   *string `rsf:"new"`
+}
+
+// ErrIndexMismatch is returned by `ChangeFeed` and `ApplyChangeFeed` when
+// snapshots use different indexes.
+var ErrIndexMismatch = errors.New("snapshots use different indexes")
+
+// ChangeFeed compares the snapshots `old` and `new` and writes a `ChangeSet`
+// object that lists the changes to `w`, which must use Version3 or later.
+// Reader options, such as `WithLayers`, are used when reading both snapshots.
+func ChangeFeed(old, new io.ReadSeeker, w Writer, opts ...ReaderOption) (int, error) {
+	raOld, raNew := readerAt(old), readerAt(new)
+	objOld, errOld := OpenObject(raOld, opts...)
+	if errOld != nil && errOld != io.EOF {
+		return 0, fmt.Errorf("error reading old snapshot: %w", errOld)
+	}
+	objNew, errNew := OpenObject(raNew, opts...)
+	if errNew != nil && errNew != io.EOF {
+		return 0, fmt.Errorf("error reading new snapshot: %w", errNew)
+	}
+	if errOld == nil && errNew == nil && !reflect.DeepEqual(objOld.Index, objNew.Index) {
+		return 0, ErrIndexMismatch
+	}
+	err := checkChangeFeedEncoding(objOld.Flags | objNew.Flags)
+	if err != nil {
+		return 0, err
+	}
+
+	set := ChangeSet{Changes: []Change{}}
+	for pos := int64(0); errOld == nil || errNew == nil; pos++ {
+		var dataOld, dataNew []byte
+		var err error
+		if errOld == nil {
+			dataOld, err = objectData(raOld, objOld)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if errNew == nil {
+			dataNew, err = objectData(raNew, objNew)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		switch {
+		case errOld != nil:
+			set.Changes = append(set.Changes, Change{Object: pos, Kind: ChangeAdded, Value: string(dataNew)})
+		case errNew != nil:
+			set.Changes = append(set.Changes, Change{Object: pos, Kind: ChangeRemoved})
+		default:
+			var changes []Change
+			changes, err = objectChanges(pos, objNew.Index, dataOld, dataNew)
+			if err != nil {
+				return 0, fmt.Errorf("object %d: %w", pos, err)
+			}
+			set.Changes = append(set.Changes, changes...)
+		}
+
+		if errOld == nil {
+			objOld, errOld = NextObject(raOld, objOld)
+			if errOld != nil && errOld != io.EOF {
+				return 0, errOld
+			}
+		}
+		if errNew == nil {
+			objNew, errNew = NextObject(raNew, objNew)
+			if errNew != nil && errNew != io.EOF {
+				return 0, errNew
+			}
+		}
+	}
+
+	return w.WriteObject(set)
+}
+
+// ApplyChangeFeed reads the `ChangeSet` object written by `ChangeFeed` from
+// `feed`, applies it to the snapshot `base`, and writes the resulting snapshot
+// to `dst`, which must be a new Writer returned by `NewWriterWithVersion` with
+// the same version as `base`. The index of `base` is written first, followed by
+// each changed or unchanged object, but the file is not finalized. Unchanged
+// elements of indexed arrays keep their relative order. Reader options, such
+// as `WithLayers`, are used when reading `base` and `feed`.
+func ApplyChangeFeed(base io.ReadSeeker, feed io.Reader, dst Writer, opts ...ReaderOption) (int, error) {
+	w, ok := dst.(*rsfWriter)
+	if !ok {
+		return 0, fmt.Errorf("cannot apply change feed to %T", dst)
+	}
+	if w.pos != 0 {
+		return 0, errors.New("cannot apply change feed to a writer that has written objects")
+	}
+	err := w.checkWritable()
+	if err != nil {
+		return 0, err
+	}
+
+	var set ChangeSet
+	err = NewReader(opts...).ReadObject(bufio.NewReader(feed), &set)
+	if err != nil {
+		return 0, fmt.Errorf("error reading change feed: %w", err)
+	}
+	changes := make(map[int64][]Change)
+	for _, change := range set.Changes {
+		changes[change.Object] = append(changes[change.Object], change)
+	}
+
+	// Read the base index, which is also used by `dst`.
+	ra := readerAt(base)
+	s := NewStatelessReader(ra)
+	f, r := s.at(0)
+	for _, opt := range opts {
+		opt(f)
+	}
+	index, err := f.ReadIndex(r)
+	if err != nil {
+		return 0, fmt.Errorf("error reading base snapshot: %w", err)
+	}
+	if w.version != f.indexVersion {
+		return 0, fmt.Errorf("writer version %d does not match base snapshot version %d", w.version, f.indexVersion)
+	}
+	err = checkChangeFeedEncoding(f.flags | w.flags)
+	if err != nil {
+		return 0, err
+	}
+	w.flags |= f.flags & indexFlags
+	totalSz, err := w.writeIndexRecord(func(buf *bytes.Buffer) (int, error) {
+		err := w.writeIndexEntries(index, w.version, buf)
+		return buf.Len(), err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	pos := int64(0)
+	obj, err := s.objectAt(int64(f.pos), ObjectRef{Index: index, Flags: f.flags, Layers: f.layers})
+	for ; err == nil; pos++ {
+		var data []byte
+		data, err = objectData(ra, obj)
+		if err != nil {
+			return 0, err
+		}
+		data, err = applyChanges(index, data, changes[pos])
+		if err != nil {
+			return 0, fmt.Errorf("object %d: %w", pos, err)
+		}
+		delete(changes, pos)
+		if data != nil {
+			var sz int
+			sz, err = w.writeObjectData(index, data)
+			if err != nil {
+				return 0, err
+			}
+			totalSz += sz
+		}
+		obj, err = NextObject(ra, obj)
+	}
+	if err != io.EOF {
+		return 0, err
+	}
+
+	// Write the objects added after the last base object.
+	for ; len(changes) > 0; pos++ {
+		objChanges, ok := changes[pos]
+		if !ok || len(objChanges) != 1 || objChanges[0].Kind != ChangeAdded || objChanges[0].Field != "" {
+			return 0, fmt.Errorf("object %d: changes do not apply to the base snapshot", pos)
+		}
+		delete(changes, pos)
+		sz, err := w.writeObjectData(index, []byte(objChanges[0].Value))
+		if err != nil {
+			return 0, err
+		}
+		totalSz += sz
+	}
+	return totalSz, nil
+}
+
+// checkChangeFeedEncoding returns an error if the header flags `flags` select
+// an encoding other than the default. `ChangeFeed` and `ApplyChangeFeed`
+// encode changes in little-endian byte order with fixed-size integers. See
+// `WithByteOrder` and `WithVarints`.
+func checkChangeFeedEncoding(flags uint32) error {
+	if flags&encodingFlags != 0 {
+		return fmt.Errorf("change feeds require files with the default encoding: %w", ErrUnsupportedFeature{Flags: flags & encodingFlags})
+	}
+	return nil
+}
+
+// indexFlags are the header flags that describe the index, which are copied
+// from the base snapshot by `ApplyChangeFeed`.
+const indexFlags = FlagElementHashes
+
+// writeObjectData writes a top-level object record containing the object data
+// `data`, adding a field offset table if needed.
+func (f *rsfWriter) writeObjectData(index Index, data []byte) (int, error) {
+	var offsets []fieldOffset
+	if f.headerFlags&FlagFieldOffsets != 0 {
+		fields, err := splitFields(index, data)
+		if err != nil {
+			return 0, err
+		}
+		offsets = make([]fieldOffset, len(fields))
+		var off int
+		for i := range fields {
+			offsets[i] = fieldOffset{name: index[i].FieldName, offset: off}
+			off += len(fields[i])
+		}
+	}
+	return f.writeRecord(bytes.NewBuffer(data), offsets)
+}
+
+// applyChanges applies the changes to the top-level object with the object
+// data `data`, and returns the new object data, or nil if the object is
+// removed.
+func applyChanges(index Index, data []byte, changes []Change) ([]byte, error) {
+	if len(changes) == 0 {
+		return data, nil
+	}
+	if len(changes) == 1 && changes[0].Field == "" {
+		switch changes[0].Kind {
+		case ChangeRemoved:
+			return nil, nil
+		case ChangeModified:
+			return []byte(changes[0].Value), nil
+		}
+	}
+
+	fields, err := splitFields(index, data)
+	if err != nil {
+		return nil, err
+	}
+	elChanges := make(map[int][]Change)
+	for _, change := range changes {
+		_, pos, err := entrySet(index, change.Field)
+		if err != nil {
+			return nil, fmt.Errorf("cannot apply change to field %s: %w", change.Field, err)
+		}
+		if change.Key != nil {
+			elChanges[pos] = append(elChanges[pos], change)
+		} else if change.Kind == ChangeModified {
+			fields[pos] = []byte(change.Value)
+		} else {
+			return nil, fmt.Errorf("cannot apply %s change to field %s", change.Kind, change.Field)
+		}
+	}
+	for pos, changes := range elChanges {
+		if !elementsIndexed(index[pos]) {
+			return nil, fmt.Errorf("field %s is not an indexed struct array", index[pos].FieldName)
+		}
+		fields[pos], err = applyElementChanges(index[pos], fields[pos], changes)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", index[pos].FieldName, err)
+		}
+	}
+	return bytes.Join(fields, nil), nil
+}
+
+// feedElement is an element of an indexed array rebuilt by
+// `applyElementChanges`.
+type feedElement struct {
+	key []byte
+	el  []byte
+}
+
+// applyElementChanges applies element changes to the data of an indexed struct
+// array, and returns the new array data. Added and modified elements are
+// placed at their positions, and the remaining elements fill the other
+// positions in their old order.
+func applyElementChanges(entry IndexEntry, data []byte, changes []Change) ([]byte, error) {
+	handles, err := elementHandles(NewStatelessReader(bytes.NewReader(data)), entry, 0)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]int, len(handles))
+	for i, h := range handles {
+		byKey[*formatValue(h.Key)] = i
+	}
+
+	// Find the elements that are unchanged.
+	changed := make([]bool, len(handles))
+	placed := make(map[int64]feedElement)
+	for _, change := range changes {
+		i, ok := byKey[*change.Key]
+		switch {
+		case change.Kind == ChangeAdded && !ok, change.Kind == ChangeModified && ok:
+		case change.Kind == ChangeRemoved && ok:
+			changed[i] = true
+			continue
+		default:
+			return nil, fmt.Errorf("cannot apply %s change to element %s", change.Kind, *change.Key)
+		}
+		if ok {
+			changed[i] = true
+		}
+		if _, ok = placed[change.Position]; ok {
+			return nil, fmt.Errorf("more than one element changed at position %d", change.Position)
+		}
+		var key []byte
+		key, err = encodeKey(entry, *change.Key)
+		if err != nil {
+			return nil, err
+		}
+		placed[change.Position] = feedElement{key: key, el: []byte(change.Value)}
+	}
+	var unchanged []feedElement
+	entrySz := int64(entry.indexEntrySize())
+	for i, h := range handles {
+		if !changed[i] {
+			keyOff := 2*sizeFieldLen + int64(i)*entrySz
+			unchanged = append(unchanged, feedElement{
+				key: data[keyOff : keyOff+int64(entry.IndexSize)],
+				el:  data[h.Offset : h.Offset+int64(h.Size)],
+			})
+		}
+	}
+
+	// Rebuild the array index and elements.
+	w := &rsfWriter{}
+	if entry.ElementHashes {
+		w.flags |= FlagElementHashes
+	}
+	count := len(unchanged) + len(placed)
+	indexBuf := &bytes.Buffer{}
+	elBuf := &bytes.Buffer{}
+	for i := 0; i < count; i++ {
+		el, ok := placed[int64(i)]
+		if !ok {
+			if len(unchanged) == 0 {
+				return nil, fmt.Errorf("no element at position %d", i)
+			}
+			el, unchanged = unchanged[0], unchanged[1:]
+		}
+		indexBuf.Write(el.key)
+		_, err = w.WriteSizeField(0, len(el.el), indexBuf)
+		if err != nil {
+			return nil, err
+		}
+		if entry.ElementHashes {
+			// Element hashes do not include provenance. See
+			// `writeElementHash`.
+			var sz int
+			sz, err = elementHashSize(entry, el.el)
+			if err != nil {
+				return nil, err
+			}
+			_, err = w.writeElementHash(el.el[:sz], indexBuf)
+			if err != nil {
+				return nil, err
+			}
+		}
+		elBuf.Write(el.el)
+	}
+
+	buf := &bytes.Buffer{}
+	_, err = w.WriteSizeField(0, sizeFieldLen*2+indexBuf.Len()+elBuf.Len(), buf)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.WriteSizeField(0, count, buf)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(indexBuf.Bytes())
+	buf.Write(elBuf.Bytes())
+	return buf.Bytes(), nil
+}
+
+// encodeKey encodes an array index key formatted by `ChangeFeed`.
+func encodeKey(entry IndexEntry, key string) ([]byte, error) {
+	w := &rsfWriter{}
+	buf := &bytes.Buffer{}
+	var err error
+	switch reflect.Kind(entry.IndexType) {
+	case reflect.String:
+		_, err = w.WriteFixedStringField(0, entry.IndexSize, key, buf)
+	default:
+		var i int64
+		i, err = strconv.ParseInt(key, 10, 64)
+		if err == nil {
+			_, err = w.writeIntKey(i, buf)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %s: %w", key, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// elementHashSize returns the size of the data of the struct array element
+// `el` that is included in its element hash, which excludes provenance.
+func elementHashSize(entry IndexEntry, el []byte) (int, error) {
+	s := NewStatelessReader(bytes.NewReader(el))
+	var off int64
+	for _, subfield := range entry.Subfields {
+		if subfield.FieldType == FieldTypeProvenance {
+			break
+		}
+		var err error
+		off, err = s.skipValue(subfield, off)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(off), nil
+}
+
+// objectChanges returns the changes between two versions of the object data
+// of a top-level object.
+func objectChanges(pos int64, index Index, old, new []byte) ([]Change, error) {
+	fieldsOld, err := splitFields(index, old)
+	if err != nil {
+		return nil, err
+	}
+	fieldsNew, err := splitFields(index, new)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for i, entry := range index {
+		if bytes.Equal(fieldsOld[i], fieldsNew[i]) {
+			continue
+		}
+		if elementsIndexed(entry) {
+			var elChanges []Change
+			elChanges, err = elementChanges(pos, entry, fieldsOld[i], fieldsNew[i])
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", entry.FieldName, err)
+			}
+			changes = append(changes, elChanges...)
+			continue
+		}
+
+		var valOld, valNew any
+		valOld, _, err = NewStatelessReader(bytes.NewReader(fieldsOld[i])).readValue(entry, 0)
+		if err != nil {
+			return nil, err
+		}
+		valNew, _, err = NewStatelessReader(bytes.NewReader(fieldsNew[i])).readValue(entry, 0)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, Change{
+			Object: pos,
+			Field:  entry.FieldName,
+			Kind:   ChangeModified,
+			Value:  string(fieldsNew[i]),
+			Diffs:  []FieldChange{{Field: entry.FieldName, Old: formatValue(valOld), New: formatValue(valNew)}},
+		})
+	}
+	return changes, nil
+}
+
+// elementChanges returns the changes between two versions of the data of an
+// indexed struct array.
+func elementChanges(pos int64, entry IndexEntry, old, new []byte) ([]Change, error) {
+	handlesOld, err := elementHandles(NewStatelessReader(bytes.NewReader(old)), entry, 0)
+	if err != nil {
+		return nil, err
+	}
+	handlesNew, err := elementHandles(NewStatelessReader(bytes.NewReader(new)), entry, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[any]ElementHandle, len(handlesOld))
+	for _, h := range handlesOld {
+		byKey[h.Key] = h
+	}
+
+	var changes []Change
+	for i, h := range handlesNew {
+		change := Change{Object: pos, Field: entry.FieldName, Key: formatValue(h.Key), Position: int64(i)}
+		elNew := new[h.Offset : h.Offset+int64(h.Size)]
+		change.Value = string(elNew)
+
+		hOld, ok := byKey[h.Key]
+		delete(byKey, h.Key)
+		if !ok {
+			change.Kind = ChangeAdded
+			changes = append(changes, change)
+			continue
+		}
+		if bytes.Equal(old[hOld.Offset:hOld.Offset+int64(hOld.Size)], elNew) {
+			continue
+		}
+
+		change.Kind = ChangeModified
+		var diffs []FieldDiff
+		diffs, err = CompareElements(hOld, h)
+		if err != nil {
+			return nil, err
+		}
+		for _, diff := range diffs {
+			change.Diffs = append(change.Diffs, FieldChange{Field: diff.Field, Old: formatValue(diff.Old), New: formatValue(diff.New)})
+		}
+		changes = append(changes, change)
+	}
+
+	// Report removed elements in their old order
+	for _, h := range handlesOld {
+		if _, ok := byKey[h.Key]; ok {
+			changes = append(changes, Change{Object: pos, Field: entry.FieldName, Key: formatValue(h.Key), Kind: ChangeRemoved})
+		}
+	}
+	return changes, nil
+}
+
+// objectData returns the field data of the object `obj`, which excludes the
+// object size field and any field offset table.
+func objectData(ra io.ReaderAt, obj ObjectRef) ([]byte, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	off := obj.Offset + sizeFieldLen
+	if obj.Flags&FlagFieldOffsets != 0 {
+		var count int
+		count, off, err = objectReader(ra, obj).ReadSizeField(off)
+		if err != nil {
+			return nil, err
+		}
+		entrySz := sizeFieldLen
+		if obj.Flags&FlagFieldHashes != 0 {
+			entrySz += sizeFieldLen
+		}
+		off += int64(count * entrySz)
+	}
+	data := make([]byte, obj.Offset+int64(obj.Size)-off)
+	_, err = ra.ReadAt(data, off)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// splitFields returns the data of each top-level field in the object data
+// `data`.
+func splitFields(index Index, data []byte) ([][]byte, error) {
+	s := NewStatelessReader(bytes.NewReader(data))
+	fields := make([][]byte, len(index))
+	var off int64
+	for i, entry := range index {
+		next, err := s.skipValue(entry, off)
+		if err != nil {
+			return nil, err
+		}
+		if next > int64(len(data)) {
+			return nil, fmt.Errorf("field %s exceeds the object size", entry.FieldName)
+		}
+		fields[i] = data[off:next]
+		off = next
+	}
+	return fields, nil
+}
+
+// formatValue formats a value reported in a change feed. Nil values are
+// returned as nil.
+func formatValue(v any) *string {
+	if v == nil {
+		return nil
+	}
+	s := fmt.Sprint(v)
+	return &s
+}
+
+// readerAt returns an io.ReaderAt that reads from `rs`.
+func readerAt(rs io.ReadSeeker) io.ReaderAt {
+	if ra, ok := rs.(io.ReaderAt); ok {
+		return ra
+	}
+	return &seekingReaderAt{rs: rs}
+}
+
+// seekingReaderAt implements io.ReaderAt by seeking. It is not safe for
+// concurrent use.
+type seekingReaderAt struct {
+	rs io.ReadSeeker
+}
+
+func (r *seekingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	_, err := r.rs.Seek(off, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ChangeFeedSuite struct {
+	suite.Suite
+}
+
+func TestChangeFeedSuite(t *testing.T) {
+	suite.Run(t, &ChangeFeedSuite{})
+}
+
+// changedComplexData returns a copy of the test data with changes to the
+// elements and fields of the first object and an added object.
+func changedComplexData() []FullPackageRecordPyPI {
+	changed := append([]FullPackageRecordPyPI{}, testComplexData...)
+	numpy := changed[0]
+	numpy.Snapshots = []FullManifestSnapshotPyPI{
+		{Snapshot: "2020-10-12", Version: "3.0.4", License: "MIT"},
+		numpy.Snapshots[0],
+		numpy.Snapshots[1],
+	}
+	numpy.Snapshots[1].Version = "3.0.3-1"
+	numpy.Snapshots[1].Summary = ""
+	numpy.Popularity = 60
+	changed[0] = numpy
+	return append(changed, FullPackageRecordPyPI{HomePage: "http://pandas.com", CanonicalName: "pandas"})
+}
+
+func (s *ChangeFeedSuite) write(data []FullPackageRecordPyPI, opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, opts...)
+	for _, obj := range data {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+// readSeeker hides the io.ReaderAt implementation of a bytes.Reader.
+type readSeeker struct {
+	io.ReadSeeker
+}
+
+func (s *ChangeFeedSuite) TestChangeFeed() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldHashes(), WithElementHashes()},
+		{Chain(Zstd(), Checksum()), WithDigest()},
+	} {
+		old := s.write(testComplexData, opts...)
+		new := s.write(changedComplexData(), opts...)
+
+		buf := &bytes.Buffer{}
+		_, err := ChangeFeed(readSeeker{bytes.NewReader(old)}, bytes.NewReader(new), NewWriterWithVersion(buf, Version3))
+		s.Require().Nil(err)
+
+		var set ChangeSet
+		err = NewReader().ReadObject(bufio.NewReader(buf), &set)
+		s.Require().Nil(err)
+		s.Require().Len(set.Changes, 5)
+
+		// Elements are added, modified, and removed.
+		added := set.Changes[0]
+		s.Assert().Equal("snapshots", added.Field)
+		s.Assert().Equal(ChangeAdded, added.Kind)
+		s.Assert().Equal(ptr("2020-10-12"), added.Key)
+		s.Assert().Equal(int64(0), added.Position)
+		s.Assert().NotEmpty(added.Value)
+
+		modified := set.Changes[1]
+		s.Assert().Equal(ChangeModified, modified.Kind)
+		s.Assert().Equal(ptr("2020-10-11"), modified.Key)
+		s.Assert().Equal(int64(1), modified.Position)
+		s.Assert().Equal([]FieldChange{
+			{Field: "version", Old: ptr("3.0.3"), New: ptr("3.0.3-1")},
+			{Field: "summary", Old: ptr("numpy summary"), New: ptr("")},
+		}, modified.Diffs)
+
+		s.Assert().Equal(Change{Field: "snapshots", Key: ptr("2020-10-09"), Kind: ChangeRemoved}, set.Changes[2])
+
+		// Other fields are modified
+		popularity := set.Changes[3]
+		s.Assert().Equal("popularity", popularity.Field)
+		s.Assert().Nil(popularity.Key)
+		s.Assert().Equal(ChangeModified, popularity.Kind)
+		s.Assert().Equal([]FieldChange{{Field: "popularity", Old: ptr("55"), New: ptr("60")}}, popularity.Diffs)
+
+		// Objects are added
+		s.Assert().Equal(int64(2), set.Changes[4].Object)
+		s.Assert().Equal("", set.Changes[4].Field)
+		s.Assert().Equal(ChangeAdded, set.Changes[4].Kind)
+	}
+}
+
+func (s *ChangeFeedSuite) TestChangeFeedRemovedObjects() {
+	old := s.write(testComplexData)
+	new := s.write(testComplexData[:1])
+
+	buf := &bytes.Buffer{}
+	_, err := ChangeFeed(bytes.NewReader(old), bytes.NewReader(new), NewWriterWithVersion(buf, Version3))
+	s.Require().Nil(err)
+	var set ChangeSet
+	err = NewReader().ReadObject(bufio.NewReader(buf), &set)
+	s.Require().Nil(err)
+	s.Assert().Equal([]Change{{Object: 1, Kind: ChangeRemoved}}, set.Changes)
+
+	// Unchanged snapshots have no changes
+	buf.Reset()
+	_, err = ChangeFeed(bytes.NewReader(old), bytes.NewReader(old), NewWriterWithVersion(buf, Version3))
+	s.Require().Nil(err)
+	set = ChangeSet{}
+	err = NewReader().ReadObject(bufio.NewReader(buf), &set)
+	s.Require().Nil(err)
+	s.Assert().Empty(set.Changes)
+}
+
+func (s *ChangeFeedSuite) TestChangeFeedIndexMismatch() {
+	old := s.write(testComplexData)
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(sensitiveData)
+	s.Require().Nil(err)
+
+	_, err = ChangeFeed(bytes.NewReader(old), bytes.NewReader(buf.Bytes()), NewWriterWithVersion(io.Discard, Version3))
+	s.Assert().ErrorIs(err, ErrIndexMismatch)
+}
+
+func (s *ChangeFeedSuite) TestApplyChangeFeed() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldOffsets(), WithElementHashes()},
+		{WithFieldHashes(), WithElementHashes()},
+		{Chain(Zstd(), Checksum()), WithDigest()},
+	} {
+		for _, data := range [][]FullPackageRecordPyPI{changedComplexData(), testComplexData[:1], testComplexData} {
+			old := s.write(testComplexData, opts...)
+			new := s.write(data, opts...)
+			feed := &bytes.Buffer{}
+			_, err := ChangeFeed(bytes.NewReader(old), bytes.NewReader(new), NewWriterWithVersion(feed, Version3))
+			s.Require().Nil(err)
+
+			// The new snapshot is reproduced exactly
+			buf := &bytes.Buffer{}
+			w := NewWriterWithVersion(buf, Version3, opts...)
+			_, err = ApplyChangeFeed(readSeeker{bytes.NewReader(old)}, feed, w)
+			s.Require().Nil(err)
+			_, err = w.Finalize()
+			s.Require().Nil(err)
+			s.Assert().Equal(new, buf.Bytes())
+		}
+	}
+}
+
+func (s *ChangeFeedSuite) TestApplyChangeFeedErrors() {
+	old := s.write(testComplexData)
+	new := s.write(changedComplexData())
+	feed := &bytes.Buffer{}
+	_, err := ChangeFeed(bytes.NewReader(old), bytes.NewReader(new), NewWriterWithVersion(feed, Version3))
+	s.Require().Nil(err)
+
+	// The feed does not apply to the new snapshot
+	_, err = ApplyChangeFeed(bytes.NewReader(new), bytes.NewReader(feed.Bytes()), NewWriterWithVersion(io.Discard, Version3))
+	s.Assert().EqualError(err, "object 0: field snapshots: cannot apply added change to element 2020-10-12")
+
+	_, err = ApplyChangeFeed(bytes.NewReader(old), bytes.NewReader(feed.Bytes()), NewWriterWithVersion(io.Discard, Version2))
+	s.Assert().EqualError(err, "writer version 2 does not match base snapshot version 3")
+
+	w := NewWriterWithVersion(io.Discard, Version3)
+	_, err = w.WriteObject(testComplexData[0])
+	s.Require().Nil(err)
+	_, err = ApplyChangeFeed(bytes.NewReader(old), bytes.NewReader(feed.Bytes()), w)
+	s.Assert().EqualError(err, "cannot apply change feed to a writer that has written objects")
+}
@@ -10,6 +10,14 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var printHeader bool
+var printQuery string
+
+func init() {
+	PrintCmd.Flags().BoolVar(&printHeader, "header", false, "Print the file header and features instead of the data.")
+	PrintCmd.Flags().StringVar(&printQuery, "query", "", "Print the rows selected by a query, e.g., \"SELECT name WHERE verified\", instead of the data.")
+}
+
 var PrintCmd = &cobra.Command{
 	Use:   "rspm",
 	Short: "Posit Package Manager",
@@ -28,7 +36,13 @@ var PrintCmd = &cobra.Command{
 				return fmt.Errorf("unable to open %s for reading: %s", f, err)
 			}
 			buf := bufio.NewReader(rsfFile)
-			err = rsf.Print(cmd.OutOrStdout(), buf)
+			if printQuery != "" {
+				err = rsf.PrintQuery(cmd.OutOrStdout(), rsfFile, printQuery)
+			} else if printHeader {
+				err = rsf.PrintHeader(cmd.OutOrStdout(), buf)
+			} else {
+				err = rsf.Print(cmd.OutOrStdout(), buf)
+			}
 			if err != nil {
 				return fmt.Errorf("error printing RSF data from %s: %s", f, err)
 			}
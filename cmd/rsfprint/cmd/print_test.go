@@ -2,9 +2,14 @@
 package cmd
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
+
+	rsf "github.com/rstudio/repository-snapshot-format"
 )
 
 type RsfPrintCommandSuite struct {
@@ -14,3 +19,52 @@ type RsfPrintCommandSuite struct {
 func TestRsfPrintCommandSuite(t *testing.T) {
 	suite.Run(t, &RsfPrintCommandSuite{})
 }
+
+func (s *RsfPrintCommandSuite) TestPrintHeader() {
+	buf := &bytes.Buffer{}
+	w := rsf.NewWriterWithVersion(buf, rsf.Version3, rsf.WithFieldOffsets())
+	_, err := w.WriteObject(struct {
+		Name string `rsf:"name"`
+	}{Name: "posit"})
+	s.Require().Nil(err)
+
+	f := filepath.Join(s.T().TempDir(), "test.rsf")
+	err = os.WriteFile(f, buf.Bytes(), 0600)
+	s.Require().Nil(err)
+
+	out := &bytes.Buffer{}
+	PrintCmd.SetOut(out)
+	PrintCmd.SetArgs([]string{"--header", f})
+	defer func() {
+		printHeader = false
+	}()
+	err = PrintCmd.Execute()
+	s.Require().Nil(err)
+	s.Assert().Equal("version: 3\nmin reader version: 3\nfeatures: field-offsets\n", out.String())
+}
+
+func (s *RsfPrintCommandSuite) TestPrintQuery() {
+	buf := &bytes.Buffer{}
+	w := rsf.NewWriterWithVersion(buf, rsf.Version3)
+	for _, pkg := range []struct {
+		Name     string `rsf:"name"`
+		Verified bool   `rsf:"verified"`
+	}{{Name: "dplyr", Verified: true}, {Name: "plyr"}} {
+		_, err := w.WriteObject(pkg)
+		s.Require().Nil(err)
+	}
+
+	f := filepath.Join(s.T().TempDir(), "test.rsf")
+	err := os.WriteFile(f, buf.Bytes(), 0600)
+	s.Require().Nil(err)
+
+	out := &bytes.Buffer{}
+	PrintCmd.SetOut(out)
+	PrintCmd.SetArgs([]string{"--query", "SELECT name WHERE verified", f})
+	defer func() {
+		printQuery = ""
+	}()
+	err = PrintCmd.Execute()
+	s.Require().Nil(err)
+	s.Assert().Equal("name\ndplyr\n", out.String())
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// CoalescingReaderAt wraps an io.ReaderAt, such as a client for remote object
+// storage, and coalesces nearby reads into single range requests. Reading the
+// fields of an object with `ReadFieldAt` or a `StatelessReader` issues many
+// small reads of adjacent or near-adjacent ranges, e.g., a size field followed
+// by the elements of an array. Each request to the wrapped reader also reads
+// up to `gap` bytes following the requested range, and subsequent reads that
+// fall within the fetched range are served without a request.
+//
+// A CoalescingReaderAt is safe for concurrent use provided that the underlying
+// io.ReaderAt is also safe for concurrent use.
+type CoalescingReaderAt struct {
+	ra  io.ReaderAt
+	gap int
+
+	// Guards the most recently fetched range and the request count.
+	mu       sync.Mutex
+	off      int64
+	buf      []byte
+	requests int
+}
+
+// NewCoalescingReaderAt creates a CoalescingReaderAt that reads from `ra`.
+// Reads that start within `gap` bytes of the end of the previous request are
+// coalesced with it.
+func NewCoalescingReaderAt(ra io.ReaderAt, gap int) *CoalescingReaderAt {
+	return &CoalescingReaderAt{ra: ra, gap: gap}
+}
+
+func (c *CoalescingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if n, ok := c.cached(p, off); ok {
+		return n, nil
+	}
+
+	buf := make([]byte, len(p)+c.gap)
+	n, err := c.ra.ReadAt(buf, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	buf = buf[:n]
+
+	c.mu.Lock()
+	c.off = off
+	c.buf = buf
+	c.requests++
+	c.mu.Unlock()
+
+	n = copy(p, buf)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// cached copies the range of `p` at `off` from the most recently fetched
+// range, and returns false if the range was not fetched.
+func (c *CoalescingReaderAt) cached(p []byte, off int64) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if off < c.off || off+int64(len(p)) > c.off+int64(len(c.buf)) {
+		return 0, false
+	}
+	return copy(p, c.buf[off-c.off:]), true
+}
+
+// Requests returns the number of reads issued to the wrapped reader.
+func (c *CoalescingReaderAt) Requests() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CoalesceSuite struct {
+	suite.Suite
+}
+
+func TestCoalesceSuite(t *testing.T) {
+	suite.Run(t, &CoalesceSuite{})
+}
+
+func (s *CoalesceSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range testComplexData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *CoalesceSuite) TestReadFieldAt() {
+	data := s.write()
+
+	// Read the field without coalescing
+	direct := &countingReaderAt{ra: bytes.NewReader(data)}
+	obj, err := OpenObject(direct)
+	s.Require().Nil(err)
+	direct.reads.Store(0)
+	expected, err := ReadFieldAt(direct, obj, "snapshots")
+	s.Require().Nil(err)
+
+	counted := &countingReaderAt{ra: bytes.NewReader(data)}
+	ra := NewCoalescingReaderAt(counted, 4096)
+	obj, err = OpenObject(ra)
+	s.Require().Nil(err)
+	counted.reads.Store(0)
+	actual, err := ReadFieldAt(ra, obj, "snapshots")
+	s.Require().Nil(err)
+	s.Assert().Equal(expected, actual)
+
+	// The array is read with at most one request, since the object may have
+	// been fetched when it was opened
+	s.Assert().LessOrEqual(counted.reads.Load(), int64(1))
+	s.Assert().Less(counted.reads.Load(), direct.reads.Load())
+}
+
+func (s *CoalesceSuite) TestReadAt() {
+	data := []byte("0123456789")
+	counted := &countingReaderAt{ra: bytes.NewReader(data)}
+	ra := NewCoalescingReaderAt(counted, 2)
+
+	p := make([]byte, 2)
+	n, err := ra.ReadAt(p, 1)
+	s.Require().Nil(err)
+	s.Assert().Equal("12", string(p[:n]))
+
+	// Reads within the gap are coalesced
+	n, err = ra.ReadAt(p, 3)
+	s.Require().Nil(err)
+	s.Assert().Equal("34", string(p[:n]))
+	s.Assert().Equal(1, ra.Requests())
+
+	// Reads outside of the fetched range issue a request
+	n, err = ra.ReadAt(p, 0)
+	s.Require().Nil(err)
+	s.Assert().Equal("01", string(p[:n]))
+	s.Assert().Equal(2, ra.Requests())
+
+	// Reads past the end of the data return io.EOF
+	p = make([]byte, 4)
+	n, err = ra.ReadAt(p, 8)
+	s.Assert().ErrorIs(err, io.EOF)
+	s.Assert().Equal("89", string(p[:n]))
+	n, err = ra.ReadAt(p[:2], 8)
+	s.Require().Nil(err)
+	s.Assert().Equal(2, n)
+	s.Assert().Equal(int64(3), counted.reads.Load())
+}
+
+type failingReaderAt struct{}
+
+func (failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("unavailable")
+}
+
+func (s *CoalesceSuite) TestErrors() {
+	_, err := NewCoalescingReaderAt(failingReaderAt{}, 10).ReadAt(make([]byte, 1), 0)
+	s.Assert().EqualError(err, "unavailable")
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A Codec encodes and decodes object payloads. Codecs registered with
+// `RegisterCodec` can be used as layers with `CodecLayer`. Codecs must be safe
+// for concurrent use.
+type Codec interface {
+	// Encode transforms an object payload.
+	Encode(p []byte) ([]byte, error)
+	// Decode reverses `Encode`.
+	Decode(p []byte) ([]byte, error)
+}
+
+// MinCodecID is the smallest ID that can be used with `RegisterCodec`. Smaller
+// IDs are reserved for built-in layers.
+const MinCodecID uint16 = 256
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[uint16]Codec{}
+)
+
+func init() {
+	// Built-in layers that do not require configuration are always
+	// available to readers.
+	codecs[LayerChecksum] = Checksum()
+	codecs[LayerZstd] = Zstd()
+}
+
+// RegisterCodec makes a codec available by ID. Writers use registered codecs
+// with `CodecLayer`, and readers resolve the layer IDs recorded in a file
+// header from the registry. Since the ID is stored in files, it must not be
+// reused for a different codec. RegisterCodec panics if the ID is reserved or
+// already registered, or if the codec is nil.
+func RegisterCodec(id uint16, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if c == nil {
+		panic("rsf: RegisterCodec codec is nil")
+	}
+	if id < MinCodecID {
+		panic(fmt.Sprintf("rsf: RegisterCodec called with reserved codec ID %d", id))
+	}
+	if _, dup := codecs[id]; dup {
+		panic(fmt.Sprintf("rsf: RegisterCodec called twice for codec %d", id))
+	}
+	codecs[id] = c
+}
+
+// ErrCodecNotRegistered is returned when a layer ID is neither registered with
+// `RegisterCodec` nor provided with `WithLayers`.
+type ErrCodecNotRegistered struct {
+	ID uint16
+}
+
+func (e ErrCodecNotRegistered) Error() string {
+	return fmt.Sprintf("codec %d not registered", e.ID)
+}
+
+func lookupCodec(id uint16) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[id]
+	if !ok {
+		return nil, ErrCodecNotRegistered{ID: id}
+	}
+	return c, nil
+}
+
+type codecLayer struct {
+	id uint16
+}
+
+// CodecLayer returns a layer that uses the codec registered with ID `id`. The
+// codec is looked up when encoding or decoding.
+func CodecLayer(id uint16) Layer {
+	return codecLayer{id: id}
+}
+
+func (c codecLayer) ID() uint16 {
+	return c.id
+}
+
+func (c codecLayer) Encode(p []byte) ([]byte, error) {
+	codec, err := lookupCodec(c.id)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(p)
+}
+
+func (c codecLayer) Decode(p []byte) ([]byte, error) {
+	codec, err := lookupCodec(c.id)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Decode(p)
+}
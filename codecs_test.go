@@ -0,0 +1,100 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CodecsSuite struct {
+	suite.Suite
+}
+
+func TestCodecsSuite(t *testing.T) {
+	suite.Run(t, &CodecsSuite{})
+}
+
+// reverseCodec reverses the bytes of each payload.
+type reverseCodec struct{}
+
+func (reverseCodec) Encode(p []byte) ([]byte, error) {
+	p = slices.Clone(p)
+	slices.Reverse(p)
+	return p, nil
+}
+
+func (reverseCodec) Decode(p []byte) ([]byte, error) {
+	return reverseCodec{}.Encode(p)
+}
+
+const testReverseCodec uint16 = 300
+
+var registerReverseCodec sync.Once
+
+func (s *CodecsSuite) SetupTest() {
+	registerReverseCodec.Do(func() {
+		RegisterCodec(testReverseCodec, reverseCodec{})
+	})
+}
+
+func (s *CodecsSuite) TestRegisteredCodec() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, Chain(CodecLayer(testReverseCodec)))
+	_, err := w.WriteObject(headerTestObject{Company: "posit", Rating: 1})
+	s.Require().Nil(err)
+
+	r := NewReader()
+	br := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal([]uint16{testReverseCodec}, r.Header().Layers)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	company, err := r.ReadStringField(br)
+	s.Assert().Nil(err)
+	s.Assert().Equal("posit", company)
+
+	// Unregistered codecs fail when writing
+	w = NewWriterWithVersion(&bytes.Buffer{}, Version3, Chain(CodecLayer(testReverseCodec+1)))
+	_, err = w.WriteObject(headerTestObject{Company: "posit", Rating: 1})
+	s.Assert().EqualError(err, "layer 301: codec 301 not registered")
+
+	// Unregistered codecs fail when reading. Change the recorded codec ID.
+	data := buf.Bytes()
+	s.Require().Equal(uint32(testReverseCodec), binary.LittleEndian.Uint32(data[19:]))
+	binary.LittleEndian.PutUint32(data[19:], 7)
+	_, err = NewReader().ReadIndex(bufio.NewReader(bytes.NewReader(data)))
+	s.Assert().Equal(ErrCodecNotRegistered{ID: 7}, err)
+	s.Assert().EqualError(err, "codec 7 not registered")
+
+	// Layers provided to the reader are used instead
+	_, err = NewReader(WithLayers(testLayer{id: 7})).ReadIndex(bufio.NewReader(bytes.NewReader(data)))
+	s.Assert().Nil(err)
+}
+
+type testLayer struct {
+	reverseCodec
+	id uint16
+}
+
+func (t testLayer) ID() uint16 {
+	return t.id
+}
+
+func (s *CodecsSuite) TestRegisterCodecPanics() {
+	s.Assert().PanicsWithValue("rsf: RegisterCodec called twice for codec 300", func() {
+		RegisterCodec(testReverseCodec, reverseCodec{})
+	})
+	s.Assert().PanicsWithValue("rsf: RegisterCodec called with reserved codec ID 1", func() {
+		RegisterCodec(LayerChecksum, reverseCodec{})
+	})
+	s.Assert().PanicsWithValue("rsf: RegisterCodec codec is nil", func() {
+		RegisterCodec(MinCodecID+100, nil)
+	})
+}
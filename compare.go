@@ -0,0 +1,203 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// ErrNoSuchElement is returned by `ElementAt` when an indexed array does not
+// include an element with the requested key.
+var ErrNoSuchElement = errors.New("element not found")
+
+// ElementHandle locates an element of a top-level indexed struct array. Use
+// `ElementAt` or `ElementHandles` to obtain handles.
+type ElementHandle struct {
+	// The element key from the array index.
+	Key any
+
+	// The element hash from the array index, if the file includes element
+	// hashes. See `WithElementHashes`.
+	Hash    uint64
+	HasHash bool
+
+	// The offset and size of the element data.
+	Offset int64
+	Size   int
+
+	// The reader and encoding of the decoded object, and the index entry
+	// of the array.
+	ra    io.ReaderAt
+	enc   encoding
+	entry IndexEntry
+}
+
+// FieldDiff describes a field that differs between two versions of an
+// element. See `CompareElements`.
+type FieldDiff struct {
+	Field string
+
+	// The field values in each version. A value is nil when the field is
+	// missing from that version.
+	Old, New any
+}
+
+func (d FieldDiff) String() string {
+	return fmt.Sprintf("field %s changed from %v to %v", d.Field, d.Old, d.New)
+}
+
+// ElementHandles returns a handle for each element of the top-level indexed
+// struct array `field` of the object `obj`, in the order written unless `obj`
+// was opened using `WithElementOrder`. Only the array index is read, so
+// expired and deleted elements are included.
+func ElementHandles(ra io.ReaderAt, obj ObjectRef, field string) ([]ElementHandle, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := objectReader(ra, obj)
+	pos, off, err := s.fieldOffset(obj, field)
+	if err != nil {
+		return nil, err
+	}
+	entry := obj.Index[pos]
+	if !elementsIndexed(entry) {
+		return nil, fmt.Errorf("field %s is not an indexed struct array", field)
+	}
+	handles, err := elementHandles(s, entry, off)
+	if err != nil {
+		return nil, err
+	}
+	return handles, sortKeyed(entry, handles, func(h ElementHandle) any { return h.Key }, obj.Order)
+}
+
+// elementsIndexed returns true if `entry` describes an indexed struct array.
+func elementsIndexed(entry IndexEntry) bool {
+	return entry.FieldType == FieldTypeArray && entry.Indexed && entry.Subfields != nil
+}
+
+// elementHandles returns a handle for each element of the indexed struct array
+// described by `entry` at `off`.
+func elementHandles(s *StatelessReader, entry IndexEntry, off int64) ([]ElementHandle, error) {
+	_, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, err
+	}
+	arrayLen, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return nil, err
+	}
+	keys, elOff, err := s.readKeys(entry, next, arrayLen)
+	if err != nil {
+		return nil, err
+	}
+
+	// The element sizes and hashes follow each key in the array index.
+	handles := make([]ElementHandle, arrayLen)
+	entrySz := int64(entry.indexEntrySize())
+	for i := range handles {
+		var sz int
+		sz, _, err = s.ReadSizeField(next + int64(i)*entrySz + int64(entry.IndexSize))
+		if err != nil {
+			return nil, err
+		}
+		handles[i] = ElementHandle{Key: keys[i], Offset: elOff, Size: sz, ra: s.ra, enc: s.enc, entry: entry}
+		if entry.ElementHashes {
+			bs := make([]byte, sizeElementHash)
+			_, err = s.ra.ReadAt(bs, next+int64(i+1)*entrySz-sizeElementHash)
+			if err != nil {
+				return nil, err
+			}
+			handles[i].Hash = binary.LittleEndian.Uint64(bs)
+			handles[i].HasHash = true
+		}
+		elOff += int64(sz)
+	}
+	return handles, nil
+}
+
+// ElementAt returns a handle for the element with the key `key` of the
+// top-level indexed struct array `field` of the object `obj`. An error wrapping
+// `ErrNoSuchElement` is returned if no element has the key.
+func ElementAt(ra io.ReaderAt, obj ObjectRef, field string, key any) (ElementHandle, error) {
+	handles, err := ElementHandles(ra, obj, field)
+	if err != nil {
+		return ElementHandle{}, err
+	}
+	for _, handle := range handles {
+		if handle.Key == key {
+			return handle, nil
+		}
+	}
+	return ElementHandle{}, fmt.Errorf("array %s key %v: %w", field, key, ErrNoSuchElement)
+}
+
+// raw returns the element data.
+func (h ElementHandle) raw() ([]byte, error) {
+	bs := make([]byte, h.Size)
+	_, err := h.ra.ReadAt(bs, h.Offset)
+	return bs, err
+}
+
+// Read reads the element in the same form as `ReadFieldAt`.
+func (h ElementHandle) Read() (map[string]any, error) {
+	s := StatelessReader{ra: h.ra, enc: h.enc}
+	val, next, err := s.readElement(h.entry, IndexEntry{}, h.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if next != h.Offset+int64(h.Size) {
+		return nil, fmt.Errorf("element %v at position %d: read %d of %d bytes", h.Key, h.Offset, next-h.Offset, h.Size)
+	}
+	el := val.(map[string]any)
+	err = setElementKey(h.entry, el, h.Key)
+	if err != nil {
+		return nil, err
+	}
+	return el, nil
+}
+
+// CompareElements reports the fields that differ between two versions of an
+// element, e.g., the elements with the same key in consecutive snapshots.
+// Fields are compared in the order of the index of `a`, followed by any fields
+// that are only in `b`. When both elements include element hashes and the
+// hashes match, the elements are not read.
+func CompareElements(a, b ElementHandle) ([]FieldDiff, error) {
+	if a.HasHash && b.HasHash && a.Hash == b.Hash {
+		return nil, nil
+	}
+	elA, err := a.Read()
+	if err != nil {
+		return nil, err
+	}
+	elB, err := b.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []FieldDiff
+	fields := make([]string, 0, len(a.entry.Subfields)+len(b.entry.Subfields))
+	seen := make(map[string]bool, cap(fields))
+	for _, entry := range [][]IndexEntry{a.entry.Subfields, b.entry.Subfields} {
+		for _, subfield := range entry {
+			if !seen[subfield.FieldName] {
+				seen[subfield.FieldName] = true
+				fields = append(fields, subfield.FieldName)
+			}
+		}
+	}
+	for _, field := range fields {
+		oldVal, newVal := elA[field], elB[field]
+		if !reflect.DeepEqual(oldVal, newVal) {
+			diffs = append(diffs, FieldDiff{Field: field, Old: oldVal, New: newVal})
+		}
+	}
+	return diffs, nil
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CompareSuite struct {
+	suite.Suite
+}
+
+func TestCompareSuite(t *testing.T) {
+	suite.Run(t, &CompareSuite{})
+}
+
+func (s *CompareSuite) write(obj FullPackageRecordPyPI, opts ...WriterOption) (io.ReaderAt, ObjectRef) {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, opts...).WriteObject(obj)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	ref, err := OpenObject(ra)
+	s.Require().Nil(err)
+	return ra, ref
+}
+
+func (s *CompareSuite) TestElementHandles() {
+	ra, obj := s.write(testComplexData[0])
+	handles, err := ElementHandles(ra, obj, "snapshots")
+	s.Require().Nil(err)
+	s.Require().Len(handles, 3)
+	s.Assert().Equal([]any{"2020-10-11", "2020-10-10", "2020-10-09"}, []any{handles[0].Key, handles[1].Key, handles[2].Key})
+	s.Assert().False(handles[0].HasHash)
+
+	el, err := handles[1].Read()
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{
+		"description": "Older description of numpy",
+		"deleted":     false,
+		"snapshot":    "2020-10-10",
+		"version":     "3.0.2",
+		"summary":     "numpy summary",
+		"license":     "MIT",
+	}, el)
+
+	handle, err := ElementAt(ra, obj, "snapshots", "2020-10-09")
+	s.Require().Nil(err)
+	s.Assert().Equal(handles[2], handle)
+
+	_, err = ElementAt(ra, obj, "snapshots", "2020-01-01")
+	s.Assert().ErrorIs(err, ErrNoSuchElement)
+	_, err = ElementHandles(ra, obj, "classifiers")
+	s.Assert().EqualError(err, "field classifiers is not an indexed struct array")
+}
+
+func (s *CompareSuite) TestCompareElements() {
+	changed := testComplexData[0]
+	changed.Snapshots = append([]FullManifestSnapshotPyPI{}, changed.Snapshots...)
+	changed.Snapshots[0].Version = "3.0.4"
+	changed.Snapshots[0].Summary = "new summary"
+
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithElementHashes()},
+		{Chain(Zstd()), WithElementHashes()},
+	} {
+		raA, objA := s.write(testComplexData[0], opts...)
+		raB, objB := s.write(changed, opts...)
+
+		a, err := ElementAt(raA, objA, "snapshots", "2020-10-11")
+		s.Require().Nil(err)
+		b, err := ElementAt(raB, objB, "snapshots", "2020-10-11")
+		s.Require().Nil(err)
+		diffs, err := CompareElements(a, b)
+		s.Require().Nil(err)
+		s.Assert().Equal([]FieldDiff{
+			{Field: "version", Old: "3.0.3", New: "3.0.4"},
+			{Field: "summary", Old: "numpy summary", New: "new summary"},
+		}, diffs)
+		s.Assert().Equal("field version changed from 3.0.3 to 3.0.4", diffs[0].String())
+
+		a, err = ElementAt(raA, objA, "snapshots", "2020-10-10")
+		s.Require().Nil(err)
+		b, err = ElementAt(raB, objB, "snapshots", "2020-10-10")
+		s.Require().Nil(err)
+		diffs, err = CompareElements(a, b)
+		s.Require().Nil(err)
+		s.Assert().Empty(diffs)
+	}
+}
+
+func (s *CompareSuite) TestCompareFields() {
+	// Fields missing from one version are reported with nil values.
+	type snapshot struct {
+		Snapshot string `rsf:"snapshot,skip,fixed:10"`
+		Version  string `rsf:"version"`
+		Yanked   bool   `rsf:"yanked"`
+	}
+	type record struct {
+		Snapshots []snapshot `rsf:"snapshots,index:snapshot"`
+	}
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(record{Snapshots: []snapshot{{Snapshot: "2020-10-11", Version: "3.0.3", Yanked: true}}})
+	s.Require().Nil(err)
+	raB := bytes.NewReader(buf.Bytes())
+	objB, err := OpenObject(raB)
+	s.Require().Nil(err)
+	raA, objA := s.write(testComplexData[0])
+
+	a, err := ElementAt(raA, objA, "snapshots", "2020-10-11")
+	s.Require().Nil(err)
+	b, err := ElementAt(raB, objB, "snapshots", "2020-10-11")
+	s.Require().Nil(err)
+	diffs, err := CompareElements(a, b)
+	s.Require().Nil(err)
+	s.Assert().Equal([]FieldDiff{
+		{Field: "description", Old: "The description of numpy"},
+		{Field: "deleted", Old: false},
+		{Field: "summary", Old: "numpy summary"},
+		{Field: "license", Old: "MIT"},
+		{Field: "yanked", New: true},
+	}, diffs)
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// IncompatibleField describes a field of a file that cannot be read into the
+// corresponding field of a struct. See `CheckCompatibility`.
+type IncompatibleField struct {
+	// The path of the field, with the names of nested fields separated by
+	// dots, e.g., "releases.version".
+	Field  string
+	Reason string
+}
+
+// ErrIncompatible is returned by `CheckCompatibility` when fields of a file
+// cannot be read into a struct.
+type ErrIncompatible struct {
+	Fields []IncompatibleField
+}
+
+func (e ErrIncompatible) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		problems[i] = field.Field + ": " + field.Reason
+	}
+	return fmt.Sprintf("%d incompatible fields: %s", len(e.Fields), strings.Join(problems, "; "))
+}
+
+// CheckCompatibility reads the index of the file `r` and checks that objects
+// in the file can be read into the struct type of `v` with `ReadObject`,
+// without reading any objects. Errors reading the index, such as
+// `ErrUnsupportedVersion` or `ErrUnsupportedFeature`, are returned as is. An
+// `ErrIncompatible` error lists each field whose type in the file cannot be
+// read into the struct field with the same name, including nested fields of
+// struct arrays, structs, and maps. As with `ReadObject`, fields that are only
+// in the file or only in the struct are compatible. Integer values that
+// overflow a narrower struct field are only detected when reading. Since
+// Version1 files do not record which arrays are indexed, the arrays of those
+// files must be indexed as declared by the `index` tags of `v`.
+//
+//	err := rsf.CheckCompatibility(Package{}, f)
+func CheckCompatibility(v any, r io.Reader, opts ...ReaderOption) error {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot check compatibility of non-struct type %v", t)
+	}
+
+	if _, ok := r.(*bufio.Reader); !ok {
+		r = bufio.NewReader(r)
+	}
+	index, err := NewReader(opts...).ReadIndex(r)
+	if err != nil {
+		return err
+	}
+
+	var problems []IncompatibleField
+	checkType(t, IndexEntry{FieldType: FieldTypeStruct, Subfields: index}, "", &problems)
+	if len(problems) > 0 {
+		return ErrIncompatible{Fields: problems}
+	}
+	return nil
+}
+
+// checkType records a problem for each part of the value described by `entry`
+// that `setValue` cannot read into a value of type `t`.
+func checkType(t reflect.Type, entry IndexEntry, path string, problems *[]IncompatibleField) {
+	incompatible := func(reason string, args ...any) {
+		*problems = append(*problems, IncompatibleField{Field: path, Reason: fmt.Sprintf(reason, args...)})
+	}
+	mismatch := func() {
+		incompatible("cannot read %s into %s", decodedType(entry), t)
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		switch entry.FieldType {
+		case FieldTypeVarStr, FieldTypeFixedStr, FieldTypeChunked, FieldTypeBytes:
+		default:
+			mismatch()
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType {
+			if entry.FieldType != FieldTypeTime {
+				mismatch()
+			}
+			return
+		}
+		if entry.FieldType != FieldTypeStruct {
+			mismatch()
+			return
+		}
+		fields, err := decodePlan(t)
+		if err != nil {
+			incompatible("%s", err)
+			return
+		}
+		for _, field := range fields {
+			for _, subfield := range entry.Subfields {
+				if subfield.FieldName == field.name {
+					checkType(t.Field(field.index).Type, subfield, joinPath(path, field.name), problems)
+					break
+				}
+			}
+		}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			mismatch()
+			return
+		}
+		switch entry.FieldType {
+		case FieldTypeStruct:
+			for _, subfield := range entry.Subfields {
+				checkType(t.Elem(), subfield, joinPath(path, subfield.FieldName), problems)
+			}
+		case FieldTypeMap:
+			checkElements(t.Elem(), entry, path, problems)
+		default:
+			mismatch()
+		}
+	case reflect.Array, reflect.Slice:
+		if isBytes(t) {
+			switch entry.FieldType {
+			case FieldTypeVarStr, FieldTypeFixedStr, FieldTypeChunked, FieldTypeBytes:
+			default:
+				mismatch()
+			}
+			return
+		}
+		if entry.FieldType != FieldTypeArray && entry.FieldType != FieldTypeSegmented {
+			mismatch()
+			return
+		}
+		checkElements(t.Elem(), entry, path, problems)
+	case reflect.String:
+		if decodedType(entry) != "string" {
+			mismatch()
+		}
+	case reflect.Bool:
+		if decodedType(entry) != "bool" {
+			mismatch()
+		}
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		if decodedType(entry) != "int64" {
+			mismatch()
+		}
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		if decodedType(entry) != "uint64" {
+			mismatch()
+		}
+	case reflect.Float32, reflect.Float64:
+		if decodedType(entry) != "float64" {
+			mismatch()
+		}
+	default:
+		mismatch()
+	}
+}
+
+// checkElements checks the elements of the array or map described by `entry`
+// against the element type `t`.
+func checkElements(t reflect.Type, entry IndexEntry, path string, problems *[]IncompatibleField) {
+	if entry.Subfields != nil || entry.emptyElements() {
+		checkType(t, IndexEntry{FieldType: FieldTypeStruct, Subfields: entry.Subfields}, path, problems)
+		return
+	}
+	elEntry, err := elementEntry(entry)
+	if err != nil {
+		*problems = append(*problems, IncompatibleField{Field: path, Reason: err.Error()})
+		return
+	}
+	checkType(t, elEntry, path, problems)
+}
+
+// decodedType describes the type of the value read for `entry`.
+func decodedType(entry IndexEntry) string {
+	switch entry.FieldType {
+	case FieldTypeVarStr, FieldTypeFixedStr, FieldTypeChunked:
+		return "string"
+	case FieldTypeBytes:
+		return "[]byte"
+	case FieldTypeBool, FieldTypeDeleted:
+		return "bool"
+	case FieldTypeInt64, FieldTypeInt, FieldTypeExpiry:
+		return "int64"
+	case FieldTypeUint64:
+		return "uint64"
+	case FieldTypeFloat, FieldTypeFloat32:
+		return "float64"
+	case FieldTypeTime:
+		return "time.Time"
+	case FieldTypeArray, FieldTypeSegmented:
+		return "array"
+	case FieldTypeStruct:
+		return "struct"
+	case FieldTypeMap:
+		return "map"
+	default:
+		return fmt.Sprintf("field type %d", entry.FieldType)
+	}
+}
+
+// joinPath returns the path of the field `name` nested in `path`.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CompatibilitySuite struct {
+	suite.Suite
+}
+
+func TestCompatibilitySuite(t *testing.T) {
+	suite.Run(t, &CompatibilitySuite{})
+}
+
+type compatRelease struct {
+	Version  string    `rsf:"version,fixed:5"`
+	Date     time.Time `rsf:"date"`
+	Yanked   bool      `rsf:"yanked"`
+	Checksum []byte    `rsf:"checksum"`
+}
+
+type compatPkg struct {
+	Name      string            `rsf:"name"`
+	Downloads int64             `rsf:"downloads,int32"`
+	Size      uint64            `rsf:"size"`
+	Rating    float32           `rsf:"rating"`
+	Releases  []compatRelease   `rsf:"releases,index:version"`
+	Labels    map[string]string `rsf:"labels"`
+	Owner     struct {
+		Name string `rsf:"name"`
+	} `rsf:"owner"`
+	Version semver  `rsf:"semver,fixed:12"`
+	Matrix  [][]int `rsf:"matrix"`
+}
+
+func (s *CompatibilitySuite) write(v any) *bytes.Reader {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(v)
+	s.Require().Nil(err)
+	return bytes.NewReader(buf.Bytes())
+}
+
+func (s *CompatibilitySuite) TestCompatible() {
+	pkg := compatPkg{Name: "ggplot2", Releases: []compatRelease{{Version: "3.5.1"}}}
+	s.Assert().Nil(CheckCompatibility(compatPkg{}, s.write(pkg)))
+	s.Assert().Nil(CheckCompatibility(&compatPkg{}, s.write(pkg)))
+
+	// Fields that are only in the file or only in the struct, pointers,
+	// narrower types, and equivalent encodings are compatible
+	type reader struct {
+		Name      *string `rsf:"name"`
+		Downloads int     `rsf:"downloads"`
+		Size      uint32  `rsf:"size"`
+		Rating    float64 `rsf:"rating"`
+		Releases  []struct {
+			Version  []byte `rsf:"version"`
+			Checksum string `rsf:"-"`
+		} `rsf:"releases"`
+		Labels  map[string]string `rsf:"labels"`
+		Owner   map[string]string `rsf:"owner"`
+		Missing string            `rsf:"missing"`
+		Version []byte            `rsf:"semver"`
+	}
+	s.Assert().Nil(CheckCompatibility(reader{}, s.write(pkg)))
+	var actual reader
+	s.Assert().Nil(NewReader().ReadObject(bufio.NewReader(s.write(pkg)), &actual))
+	s.Assert().Equal("3.5.1", string(actual.Releases[0].Version))
+}
+
+func (s *CompatibilitySuite) TestIncompatible() {
+	type reader struct {
+		Name      int64  `rsf:"name"`
+		Downloads string `rsf:"downloads"`
+		Releases  []struct {
+			Version string `rsf:"version"`
+			Date    int64  `rsf:"date"`
+			Yanked  *int   `rsf:"yanked"`
+		} `rsf:"releases"`
+		Labels map[string]int      `rsf:"labels"`
+		Owner  struct{ Name bool } `rsf:"owner"`
+		Matrix [][]string          `rsf:"matrix"`
+		Rating struct{}            `rsf:"rating"`
+	}
+	err := CheckCompatibility(reader{}, s.write(compatPkg{}))
+	var incompatible ErrIncompatible
+	s.Require().True(errors.As(err, &incompatible), err)
+	s.Assert().Equal([]IncompatibleField{
+		{Field: "name", Reason: "cannot read string into int64"},
+		{Field: "downloads", Reason: "cannot read int64 into string"},
+		{Field: "releases.date", Reason: "cannot read time.Time into int64"},
+		{Field: "releases.yanked", Reason: "cannot read bool into int"},
+		{Field: "labels", Reason: "cannot read string into int"},
+		{Field: "matrix", Reason: "cannot read int64 into string"},
+		{Field: "rating", Reason: "cannot read float64 into struct {}"},
+	}, incompatible.Fields)
+	s.Assert().Contains(err.Error(), "7 incompatible fields: name: cannot read string into int64; downloads:")
+	var actual reader
+	s.Assert().NotNil(NewReader().ReadObject(bufio.NewReader(s.write(compatPkg{})), &actual))
+
+	// Invalid structs and files are reported
+	s.Assert().EqualError(CheckCompatibility("a", s.write(compatPkg{})), "cannot check compatibility of non-struct type string")
+	s.Assert().NotNil(CheckCompatibility(compatPkg{}, bytes.NewReader([]byte{0x00, 0x08, 0x39, 0x0})))
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+
+A whole RSF stream can be compressed with `NewCompressedWriter` and read with
+`NewCompressedReader`, e.g., for files that are transferred or archived as a
+unit. Unlike `Chain(Zstd())`, which compresses each object independently, the
+compressed stream cannot be read at an offset with `OpenObject` or a
+`StatelessReader`, but it often compresses better, since redundancy across
+objects is shared.
+
+The wrappers track positions as offsets into the uncompressed stream, so the
+values returned by `Pos()` can be compared with the sizes and offsets returned
+by the Writer and Reader, just as with `CountingWriter` and `CountingReader`.
+
+	f, _ := os.Create("snapshot.rsf.zst")
+	cw, _ := rsf.NewCompressedWriter(f, rsf.StreamZstd)
+	w := rsf.NewWriter(cw)
+	// ... write objects
+	_ = cw.Close()
+
+	cr, _ := rsf.NewCompressedReader(f, rsf.StreamZstd)
+	defer cr.Close()
+	buf := bufio.NewReader(cr)
+	// ... read objects from buf
+
+*/
+
+// StreamCompression selects the compression of a stream wrapped with
+// `NewCompressedWriter` or `NewCompressedReader`.
+type StreamCompression int
+
+const (
+	// StreamGzip compresses the stream with gzip.
+	StreamGzip StreamCompression = iota + 1
+
+	// StreamZstd compresses the stream with zstd.
+	StreamZstd
+)
+
+func (c StreamCompression) String() string {
+	switch c {
+	case StreamGzip:
+		return "gzip"
+	case StreamZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("StreamCompression(%d)", int(c))
+	}
+}
+
+// CompressedWriter compresses the data written to an io.Writer and tracks the
+// number of uncompressed bytes written.
+type CompressedWriter struct {
+	counter *CountingWriter
+	enc     io.WriteCloser
+}
+
+// NewCompressedWriter returns a writer that compresses the data written to it
+// with `c` and writes the compressed data to `w`. `Close` must be called to
+// write any buffered data; it does not close `w`.
+func NewCompressedWriter(w io.Writer, c StreamCompression) (*CompressedWriter, error) {
+	var enc io.WriteCloser
+	var err error
+	switch c {
+	case StreamGzip:
+		enc = gzip.NewWriter(w)
+	case StreamZstd:
+		enc, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		err = fmt.Errorf("unknown stream compression %s", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CompressedWriter{counter: NewCountingWriter(enc), enc: enc}, nil
+}
+
+func (c *CompressedWriter) Write(p []byte) (int, error) {
+	return c.counter.Write(p)
+}
+
+// Pos returns the number of uncompressed bytes written.
+func (c *CompressedWriter) Pos() int {
+	return c.counter.Pos()
+}
+
+// Flush compresses and writes any buffered data, so that the data written so
+// far can be read.
+func (c *CompressedWriter) Flush() error {
+	switch enc := c.enc.(type) {
+	case *gzip.Writer:
+		return enc.Flush()
+	case *zstd.Encoder:
+		return enc.Flush()
+	}
+	return nil
+}
+
+// Close writes any buffered data and the end of the compressed stream.
+func (c *CompressedWriter) Close() error {
+	return c.enc.Close()
+}
+
+// CompressedReader decompresses the data read from an io.Reader and tracks the
+// number of uncompressed bytes read.
+type CompressedReader struct {
+	counter *CountingReader
+	dec     io.Reader
+}
+
+// NewCompressedReader returns a reader that decompresses data written by a
+// `CompressedWriter` with `c` from `r`. `Close` releases the decompressor; it
+// does not close `r`.
+func NewCompressedReader(r io.Reader, c StreamCompression) (*CompressedReader, error) {
+	var dec io.Reader
+	var err error
+	switch c {
+	case StreamGzip:
+		dec, err = gzip.NewReader(r)
+	case StreamZstd:
+		dec, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	default:
+		err = fmt.Errorf("unknown stream compression %s", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CompressedReader{counter: NewCountingReader(dec), dec: dec}, nil
+}
+
+func (c *CompressedReader) Read(p []byte) (int, error) {
+	return c.counter.Read(p)
+}
+
+// Pos returns the number of uncompressed bytes read. When the reader is
+// wrapped with a bufio.Reader, this includes buffered data that has not been
+// consumed yet.
+func (c *CompressedReader) Pos() int {
+	return c.counter.Pos()
+}
+
+// Discard skips the next `n` uncompressed bytes.
+func (c *CompressedReader) Discard(n int) (int, error) {
+	i, err := io.CopyN(io.Discard, c.counter, int64(n))
+	return int(i), err
+}
+
+// Close releases the decompressor.
+func (c *CompressedReader) Close() error {
+	switch dec := c.dec.(type) {
+	case *gzip.Reader:
+		return dec.Close()
+	case *zstd.Decoder:
+		dec.Close()
+	}
+	return nil
+}
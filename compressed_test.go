@@ -0,0 +1,101 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CompressedSuite struct {
+	suite.Suite
+}
+
+func TestCompressedSuite(t *testing.T) {
+	suite.Run(t, &CompressedSuite{})
+}
+
+type compressedPkg struct {
+	Name        string `rsf:"name"`
+	Description string `rsf:"description"`
+}
+
+func (s *CompressedSuite) TestRoundTrip() {
+	pkgs := []compressedPkg{
+		{Name: "ggplot2", Description: strings.Repeat("plots ", 100)},
+		{Name: "dplyr", Description: strings.Repeat("data ", 100)},
+		{Name: "tidyr", Description: strings.Repeat("tidy ", 100)},
+	}
+	for _, c := range []StreamCompression{StreamGzip, StreamZstd} {
+		buf := &bytes.Buffer{}
+		cw, err := NewCompressedWriter(buf, c)
+		s.Require().Nil(err)
+		w := NewWriterWithVersion(cw, Version3)
+		var sizes []int
+		for _, pkg := range pkgs {
+			sz, err := w.WriteObject(pkg)
+			s.Require().Nil(err)
+			sizes = append(sizes, sz)
+		}
+		// Positions are uncompressed offsets
+		total := cw.Pos()
+		s.Assert().Equal(sizes[0]+sizes[1]+sizes[2], total)
+		s.Require().Nil(cw.Close())
+		s.Assert().Less(buf.Len(), total, c.String())
+
+		// Skip the first object using its size, and read the rest
+		cr, err := NewCompressedReader(bytes.NewReader(buf.Bytes()), c)
+		s.Require().Nil(err)
+		r := NewReader()
+		br := bufio.NewReader(cr)
+		_, err = r.ReadIndex(br)
+		s.Require().Nil(err)
+		start := r.Pos()
+		sz, err := r.BeginObject(br)
+		s.Require().Nil(err)
+		s.Assert().Equal(sizes[0], start+sz)
+		s.Require().Nil(r.Discard(sz-sizeFieldLen, br))
+		var pkg compressedPkg
+		s.Require().Nil(r.ReadObject(br, &pkg))
+		s.Assert().Equal(pkgs[1], pkg)
+		s.Require().Nil(r.ReadObject(br, &pkg))
+		s.Assert().Equal(pkgs[2], pkg)
+		s.Assert().Equal(io.EOF, r.ReadObject(br, &pkg))
+		s.Assert().Equal(total, r.Pos())
+		s.Assert().Equal(total, cr.Pos())
+		s.Assert().Nil(cr.Close())
+	}
+}
+
+func (s *CompressedSuite) TestFlush() {
+	buf := &bytes.Buffer{}
+	cw, err := NewCompressedWriter(buf, StreamZstd)
+	s.Require().Nil(err)
+	_, err = cw.Write([]byte("some data"))
+	s.Require().Nil(err)
+	s.Require().Nil(cw.Flush())
+
+	// Flushed data can be read before the writer is closed
+	cr, err := NewCompressedReader(bytes.NewReader(buf.Bytes()), StreamZstd)
+	s.Require().Nil(err)
+	defer cr.Close()
+	n, err := cr.Discard(5)
+	s.Assert().Nil(err)
+	s.Assert().Equal(5, n)
+	data := make([]byte, 4)
+	_, err = io.ReadFull(cr, data)
+	s.Assert().Nil(err)
+	s.Assert().Equal("data", string(data))
+	s.Assert().Equal(9, cr.Pos())
+}
+
+func (s *CompressedSuite) TestUnknown() {
+	_, err := NewCompressedWriter(io.Discard, 0)
+	s.Assert().EqualError(err, "unknown stream compression StreamCompression(0)")
+	_, err = NewCompressedReader(strings.NewReader(""), 3)
+	s.Assert().EqualError(err, "unknown stream compression StreamCompression(3)")
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"io"
+)
+
+// CountingReader wraps an io.Reader and tracks the number of bytes read. This
+// is useful when composing RSF primitives with custom framing, since the
+// position can be compared against the offsets recorded in RSF data.
+type CountingReader struct {
+	r   io.Reader
+	pos int
+}
+
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{r: r}
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.pos += n
+	return n, err
+}
+
+// Pos returns the number of bytes read since the reader was created or reset.
+func (c *CountingReader) Pos() int {
+	return c.pos
+}
+
+// Reset switches the reader to read from `r` and sets the position to zero.
+func (c *CountingReader) Reset(r io.Reader) {
+	c.r = r
+	c.pos = 0
+}
+
+// CountingWriter wraps an io.Writer and tracks the number of bytes written.
+type CountingWriter struct {
+	w   io.Writer
+	pos int
+}
+
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	return &CountingWriter{w: w}
+}
+
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.pos += n
+	return n, err
+}
+
+// Pos returns the number of bytes written since the writer was created or
+// reset.
+func (c *CountingWriter) Pos() int {
+	return c.pos
+}
+
+// Reset switches the writer to write to `w` and sets the position to zero.
+func (c *CountingWriter) Reset(w io.Writer) {
+	c.w = w
+	c.pos = 0
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CountingSuite struct {
+	suite.Suite
+}
+
+func TestCountingSuite(t *testing.T) {
+	suite.Run(t, &CountingSuite{})
+}
+
+func (s *CountingSuite) TestCountingWriter() {
+	buf := &bytes.Buffer{}
+	cw := NewCountingWriter(buf)
+	w := NewWriterWithVersion(cw, Version2)
+
+	// Frame an RSF object with a custom 2-byte prefix.
+	_, err := cw.Write([]byte{0xff, 0xff})
+	s.Assert().Nil(err)
+	s.Assert().Equal(2, cw.Pos())
+
+	sz, err := w.WriteObject("this is a test")
+	s.Assert().Nil(err)
+	s.Assert().Equal(2+sz, cw.Pos())
+	s.Assert().Equal(buf.Len(), cw.Pos())
+
+	// Reset
+	other := &bytes.Buffer{}
+	cw.Reset(other)
+	s.Assert().Equal(0, cw.Pos())
+	_, err = cw.Write([]byte{0x1})
+	s.Assert().Nil(err)
+	s.Assert().Equal(1, cw.Pos())
+	s.Assert().Equal(1, other.Len())
+}
+
+func (s *CountingSuite) TestCountingReader() {
+	data := getData(&s.Suite).Bytes()
+	cr := NewCountingReader(bytes.NewReader(data))
+	r := NewReader()
+
+	// The counting reader and RSF reader positions agree when reading
+	// without buffering.
+	_, err := r.ReadIndex(cr)
+	s.Assert().Nil(err)
+	s.Assert().Equal(r.Pos(), cr.Pos())
+	_, err = r.ReadSizeField(cr)
+	s.Assert().Nil(err)
+	s.Assert().Equal(r.Pos(), cr.Pos())
+
+	// Read the remaining data
+	_, err = io.Copy(io.Discard, bufio.NewReader(cr))
+	s.Assert().Nil(err)
+	s.Assert().Equal(len(data), cr.Pos())
+
+	// Reset
+	cr.Reset(bytes.NewReader(data[:3]))
+	s.Assert().Equal(0, cr.Pos())
+	_, err = io.Copy(io.Discard, cr)
+	s.Assert().Nil(err)
+	s.Assert().Equal(3, cr.Pos())
+}
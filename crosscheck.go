@@ -0,0 +1,92 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Divergence describes a difference between two snapshots found by
+// `CrossCheck`.
+type Divergence struct {
+	// The key of the object that differs.
+	Key any
+
+	// The field that differs, or an empty string if the object is missing
+	// from one of the snapshots.
+	Field string
+
+	// The field values in each snapshot. When the object is missing from a
+	// snapshot, its value is nil and the other value is the key.
+	A, B any
+}
+
+func (d Divergence) String() string {
+	switch {
+	case d.Field != "":
+		return fmt.Sprintf("key %v: field %s is %v in a and %v in b", d.Key, d.Field, d.A, d.B)
+	case d.A == nil:
+		return fmt.Sprintf("key %v: missing from a", d.Key)
+	default:
+		return fmt.Sprintf("key %v: missing from b", d.Key)
+	}
+}
+
+// CrossCheck verifies that the snapshots `a` and `b`, e.g., written by
+// independent builders, agree on the top-level fields `keyFields`. Objects are
+// matched using the first key field, which must be a unique string or integer
+// field like the key field of a `SnapshotStore`, and the remaining key fields
+// are compared. The differences are returned in key order; an empty result
+// means the snapshots agree. Reader options, such as `WithLayers`, are used
+// when reading both snapshots.
+func CrossCheck(a, b io.ReaderAt, keyFields []string, opts ...ReaderOption) ([]Divergence, error) {
+	if len(keyFields) == 0 {
+		return nil, errors.New("at least one key field is required")
+	}
+	storeA, err := NewSnapshotStore(a, keyFields[0], opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot a: %w", err)
+	}
+	storeB, err := NewSnapshotStore(b, keyFields[0], opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot b: %w", err)
+	}
+	stA, stB := storeA.state, storeB.state
+	if len(stA.keys) > 0 && len(stB.keys) > 0 && reflect.TypeOf(stA.keys[0]) != reflect.TypeOf(stB.keys[0]) {
+		return nil, fmt.Errorf("key field %s has type %T in a and %T in b", keyFields[0], stA.keys[0], stB.keys[0])
+	}
+
+	// Walk the sorted keys of both snapshots.
+	var divergences []Divergence
+	var i, j int
+	for i < len(stA.keys) || j < len(stB.keys) {
+		switch {
+		case j == len(stB.keys) || (i < len(stA.keys) && keyLess(stA.keys[i], stB.keys[j])):
+			divergences = append(divergences, Divergence{Key: stA.keys[i], A: stA.keys[i]})
+			i++
+		case i == len(stA.keys) || keyLess(stB.keys[j], stA.keys[i]):
+			divergences = append(divergences, Divergence{Key: stB.keys[j], B: stB.keys[j]})
+			j++
+		default:
+			for _, field := range keyFields[1:] {
+				var valA, valB any
+				valA, err = ReadFieldAt(stA.ra, stA.objects[i], field)
+				if err != nil {
+					return nil, fmt.Errorf("error reading field %s of key %v in snapshot a: %w", field, stA.keys[i], err)
+				}
+				valB, err = ReadFieldAt(stB.ra, stB.objects[j], field)
+				if err != nil {
+					return nil, fmt.Errorf("error reading field %s of key %v in snapshot b: %w", field, stB.keys[j], err)
+				}
+				if !reflect.DeepEqual(valA, valB) {
+					divergences = append(divergences, Divergence{Key: stA.keys[i], Field: field, A: valA, B: valB})
+				}
+			}
+			i++
+			j++
+		}
+	}
+	return divergences, nil
+}
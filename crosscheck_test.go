@@ -0,0 +1,70 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CrossCheckSuite struct {
+	suite.Suite
+}
+
+func TestCrossCheckSuite(t *testing.T) {
+	suite.Run(t, &CrossCheckSuite{})
+}
+
+func (s *CrossCheckSuite) TestCrossCheck() {
+	a := writeStorePkgs(&s.Suite, storePkgs)
+
+	// Snapshots with the same objects in a different order agree
+	b := writeStorePkgs(&s.Suite, []storePkg{storePkgs[2], storePkgs[0], storePkgs[1]}, WithFieldHashes())
+	divergences, err := CrossCheck(a, b, []string{"name", "version"})
+	s.Assert().Nil(err)
+	s.Assert().Empty(divergences)
+
+	b = writeStorePkgs(&s.Suite, []storePkg{
+		{Name: "plyr", Version: 4},
+		{Name: "dplyr", Version: 1},
+		{Name: "tidyr", Version: 1},
+	})
+	divergences, err = CrossCheck(a, b, []string{"name", "version"})
+	s.Assert().Nil(err)
+	s.Assert().Equal([]Divergence{
+		{Key: "ggplot2", A: "ggplot2"},
+		{Key: "plyr", Field: "version", A: int64(3), B: int64(4)},
+		{Key: "tidyr", B: "tidyr"},
+	}, divergences)
+	s.Assert().Equal("key ggplot2: missing from b", divergences[0].String())
+	s.Assert().Equal("key plyr: field version is 3 in a and 4 in b", divergences[1].String())
+	s.Assert().Equal("key tidyr: missing from a", divergences[2].String())
+
+	// Only the key fields are compared
+	divergences, err = CrossCheck(a, b, []string{"name"})
+	s.Assert().Nil(err)
+	s.Assert().Len(divergences, 2)
+}
+
+func (s *CrossCheckSuite) TestErrors() {
+	a := writeStorePkgs(&s.Suite, storePkgs)
+	_, err := CrossCheck(a, a, nil)
+	s.Assert().EqualError(err, "at least one key field is required")
+
+	_, err = CrossCheck(a, a, []string{"name", "missing"})
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+
+	_, err = CrossCheck(a, writeStorePkgs(&s.Suite, append(storePkgs, storePkgs[0])), []string{"name"})
+	s.Assert().EqualError(err, "error reading snapshot b: duplicate key plyr")
+
+	// Key fields must have the same type
+	type intName struct {
+		Name int64 `rsf:"name"`
+	}
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version3).WriteObject(intName{Name: 1})
+	s.Require().Nil(err)
+	_, err = CrossCheck(a, bytes.NewReader(buf.Bytes()), []string{"name"})
+	s.Assert().EqualError(err, "key field name has type string in a and int64 in b")
+}
@@ -0,0 +1,10 @@
+// Copyright (C) 2023 by Posit Software, PBC
+
+//go:build !rsfdebug
+
+package rsf
+
+// ownerCheck is a no-op unless built with the `rsfdebug` build tag.
+type ownerCheck struct{}
+
+func (o *ownerCheck) check() {}
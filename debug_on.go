@@ -0,0 +1,45 @@
+// Copyright (C) 2023 by Posit Software, PBC
+
+//go:build rsfdebug
+
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// ownerCheck records the goroutine that first uses a reader. When built with
+// the `rsfdebug` build tag, using the same reader from another goroutine
+// panics, since the reader's position would otherwise be silently corrupted.
+type ownerCheck struct {
+	id atomic.Uint64
+}
+
+func (o *ownerCheck) check() {
+	id := goroutineID()
+	if o.id.CompareAndSwap(0, id) {
+		return
+	}
+	if owner := o.id.Load(); owner != id {
+		panic(fmt.Sprintf("rsf: reader owned by goroutine %d used from goroutine %d; "+
+			"use a StatelessReader for concurrent reads", owner, id))
+	}
+}
+
+// goroutineID parses the current goroutine ID from the stack trace header,
+// e.g., "goroutine 18 [running]:". This is slow and is only used for debugging.
+func goroutineID() uint64 {
+	bs := make([]byte, 64)
+	bs = bs[:runtime.Stack(bs, false)]
+	bs = bytes.TrimPrefix(bs, []byte("goroutine "))
+	bs = bs[:bytes.IndexByte(bs, ' ')]
+	id, err := strconv.ParseUint(string(bs), 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("rsf: cannot parse goroutine ID: %s", err))
+	}
+	return id
+}
@@ -0,0 +1,41 @@
+// Copyright (C) 2023 by Posit Software, PBC
+
+//go:build rsfdebug
+
+package rsf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DebugSuite struct {
+	suite.Suite
+}
+
+func TestDebugSuite(t *testing.T) {
+	suite.Run(t, &DebugSuite{})
+}
+
+func (s *DebugSuite) TestCrossGoroutineUse() {
+	buf := bytes.NewBuffer(getData(&s.Suite).Bytes())
+	r := NewReader()
+	_, err := r.ReadIndex(buf)
+	s.Assert().Nil(err)
+
+	// Using the reader from another goroutine panics.
+	recovered := make(chan any)
+	go func() {
+		defer func() {
+			recovered <- recover()
+		}()
+		_, _ = r.ReadSizeField(buf)
+	}()
+	s.Assert().Contains(<-recovered, "use a StatelessReader for concurrent reads")
+
+	// The owning goroutine can continue to use the reader.
+	_, err = r.ReadSizeField(buf)
+	s.Assert().Nil(err)
+}
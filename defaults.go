@@ -0,0 +1,77 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseDefault returns the default value declared in the `rsf` struct tag
+// options `opts` of a field of type `t`, if any. Defaults can be declared for
+// strings, bools, numbers, and times in RFC 3339 format, or pointers to them.
+// The value of a pointer field is the value it points to. Since tag options
+// are separated by commas, defaults cannot contain commas.
+func parseDefault(t reflect.Type, opts string) (reflect.Value, error) {
+	var raw string
+	var found bool
+	for _, part := range strings.Split(opts, rsfDelim) {
+		if val, ok := strings.CutPrefix(strings.TrimSpace(part), rsfDefault+rsfSep); ok {
+			raw, found = val, true
+		}
+	}
+	if !found {
+		return reflect.Value{}, nil
+	}
+
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	v := reflect.New(t).Elem()
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(raw)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		var i int64
+		i, err = strconv.ParseInt(raw, 10, t.Bits())
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		var u uint64
+		u, err = strconv.ParseUint(raw, 10, t.Bits())
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var fl float64
+		fl, err = strconv.ParseFloat(raw, t.Bits())
+		v.SetFloat(fl)
+	default:
+		if t != timeType {
+			return reflect.Value{}, fmt.Errorf("default values are not supported for %s", t)
+		}
+		var tm time.Time
+		tm, err = time.Parse(time.RFC3339, raw)
+		v.Set(reflect.ValueOf(tm))
+	}
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("invalid default value %q for %s", raw, t)
+	}
+	return v, nil
+}
+
+// setDefault sets `v` to the default value `def` returned by `parseDefault`.
+// Pointer fields are set to a new pointer to a copy of `def`.
+func setDefault(v reflect.Value, def reflect.Value) {
+	if v.Kind() != reflect.Pointer {
+		v.Set(def)
+		return
+	}
+	p := reflect.New(v.Type().Elem())
+	p.Elem().Set(def)
+	v.Set(p)
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DefaultsSuite struct {
+	suite.Suite
+}
+
+func TestDefaultsSuite(t *testing.T) {
+	suite.Run(t, &DefaultsSuite{})
+}
+
+type defaultsSnap struct {
+	Date  string `rsf:"date,fixed:10"`
+	Notes string `rsf:"notes,omitempty,default:None"`
+}
+
+type defaultsPkg struct {
+	Name      string         `rsf:"name"`
+	Tier      string         `rsf:"tier,omitempty,default:standard"`
+	Downloads int64          `rsf:"downloads,default:-1"`
+	Score     float32        `rsf:"score,default:0.5"`
+	Public    bool           `rsf:"public,default:true"`
+	Retries   uint8          `rsf:"retries,default:3"`
+	Published time.Time      `rsf:"published,default:2024-01-01T00:00:00Z"`
+	License   *string        `rsf:"license,default:MIT"`
+	Snapshots []defaultsSnap `rsf:"snapshots"`
+}
+
+func (s *DefaultsSuite) TestReadObject() {
+	type oldPkg struct {
+		Name      string         `rsf:"name"`
+		Tier      string         `rsf:"tier,omitempty"`
+		License   *string        `rsf:"license"`
+		Snapshots []defaultsSnap `rsf:"snapshots"`
+	}
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(oldPkg{
+		Name:      "ggplot2",
+		Tier:      "premium",
+		License:   ptr("GPL-2"),
+		Snapshots: []defaultsSnap{{Date: "2024-01-01", Notes: "Initial"}, {Date: "2024-02-01"}},
+	})
+	s.Require().Nil(err)
+	_, err = w.WriteObject(oldPkg{Name: "rlang"})
+	s.Require().Nil(err)
+
+	br := bufio.NewReader(buf)
+	r := NewReader()
+	var actual defaultsPkg
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	published := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Assert().Equal(defaultsPkg{
+		Name:      "ggplot2",
+		Tier:      "premium",
+		Downloads: -1,
+		Score:     0.5,
+		Public:    true,
+		Retries:   3,
+		Published: published,
+		License:   ptr("GPL-2"),
+		Snapshots: []defaultsSnap{{Date: "2024-01-01", Notes: "Initial"}, {Date: "2024-02-01", Notes: "None"}},
+	}, actual)
+
+	// Absent values are read as the default
+	actual = defaultsPkg{}
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(defaultsPkg{
+		Name:      "rlang",
+		Tier:      "standard",
+		Downloads: -1,
+		Score:     0.5,
+		Public:    true,
+		Retries:   3,
+		Published: published,
+		License:   ptr("MIT"),
+	}, actual)
+}
+
+func (s *DefaultsSuite) TestErrors() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(storePkgs[0])
+	s.Require().Nil(err)
+
+	var pkg struct {
+		Name    string `rsf:"name"`
+		Retries uint8  `rsf:"retries,default:300"`
+	}
+	err = NewReader().ReadObject(bufio.NewReader(bytes.NewReader(buf.Bytes())), &pkg)
+	s.Assert().EqualError(err, `field retries: invalid default value "300" for uint8`)
+
+	var tagsPkg struct {
+		Name string   `rsf:"name"`
+		Tags []string `rsf:"tags,default:none"`
+	}
+	err = NewReader().ReadObject(bufio.NewReader(bytes.NewReader(buf.Bytes())), &tagsPkg)
+	s.Assert().EqualError(err, "field tags: default values are not supported for []string")
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+/*
+
+When using `WithElementHashes`, each entry in the index of an indexed array
+includes an 8-byte, little-endian FNV-1a hash of the element following the
+element size. The hash covers the element fields, but not its provenance. When
+also using `WithCanonical`, the hash equals the hash returned by
+`HashElement`.
+
+Format:
+
+  [array size]
+  [array length]
+  [element 1 key]
+  [element 1 size]
+  [element 1 hash]
+  [element n key]
+  [element n size]
+  [element n hash]
+  [element 1]
+  [element n]
+
+*/
+
+// The size of an element hash in an array index.
+const sizeElementHash = 8
+
+// ElementHash records the key and hash of an indexed array element.
+type ElementHash struct {
+	Key  any
+	Hash uint64
+}
+
+// writeElementHash writes the hash of the encoded element `el`, if element
+// hashes are included.
+func (f *rsfWriter) writeElementHash(el []byte, buf *bytes.Buffer) (int, error) {
+	if f.flags&FlagElementHashes == 0 {
+		return 0, nil
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(el)
+	bs := make([]byte, sizeElementHash)
+	binary.LittleEndian.PutUint64(bs, h.Sum64())
+	return buf.Write(bs)
+}
+
+// ElementHashes returns the key and hash of each element of the indexed array
+// `field` of the object `obj`, in the order written unless `obj` was opened
+// using `WithElementOrder`. Only the array index is read, so the hashes of two
+// snapshots can be compared to detect changed elements without reading the
+// elements. The file must be written with `WithElementHashes`.
+func ElementHashes(ra io.ReaderAt, obj ObjectRef, field string) ([]ElementHash, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := objectReader(ra, obj)
+	pos, off, err := s.fieldOffset(obj, field)
+	if err != nil {
+		return nil, err
+	}
+	entry := obj.Index[pos]
+	if entry.FieldType != FieldTypeArray || !entry.Indexed {
+		return nil, fmt.Errorf("field %s is not an indexed array", field)
+	}
+	if !entry.ElementHashes {
+		return nil, fmt.Errorf("array %s does not include element hashes", field)
+	}
+
+	_, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, err
+	}
+	arrayLen, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := s.readKeys(entry, next, arrayLen)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]ElementHash, arrayLen)
+	bs := make([]byte, sizeElementHash)
+	entrySz := int64(entry.indexEntrySize())
+	for i := range hashes {
+		_, err = ra.ReadAt(bs, next+int64(i+1)*entrySz-sizeElementHash)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = ElementHash{Key: keys[i], Hash: binary.LittleEndian.Uint64(bs)}
+	}
+	return hashes, sortKeyed(entry, hashes, func(h ElementHash) any { return h.Key }, obj.Order)
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ElementHashesSuite struct {
+	suite.Suite
+}
+
+func TestElementHashesSuite(t *testing.T) {
+	suite.Run(t, &ElementHashesSuite{})
+}
+
+func (s *ElementHashesSuite) write(items []channelItem, opts ...WriterOption) (*bytes.Reader, ObjectRef) {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, opts...).WriteObject(channelObject{Items: items})
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	return ra, obj
+}
+
+func (s *ElementHashesSuite) TestElementHashes() {
+	ra, obj := s.write(channelItems, WithElementHashes(), WithCanonical())
+	s.Assert().Contains(featureNames(obj.Flags), "element-hashes")
+	hashes, err := ElementHashes(ra, obj, "items")
+	s.Require().Nil(err)
+	s.Require().Len(hashes, 3)
+	for i, item := range channelItems {
+		hash, err := HashElement(item)
+		s.Require().Nil(err)
+		s.Assert().Equal(ElementHash{Key: item.Key, Hash: hash}, hashes[i])
+	}
+
+	// Changed elements have different hashes
+	changed := append([]channelItem{}, channelItems...)
+	changed[1].Score = 5
+	ra2, obj2 := s.write(changed, WithElementHashes())
+	hashes2, err := ElementHashes(ra2, obj2, "items")
+	s.Require().Nil(err)
+	s.Assert().Equal(hashes[0], hashes2[0])
+	s.Assert().NotEqual(hashes[1], hashes2[1])
+	s.Assert().Equal(hashes[2], hashes2[2])
+
+	// Elements are read normally
+	items, err := ReadFieldAt(ra, obj, "items")
+	s.Require().Nil(err)
+	s.Assert().Len(items, 3)
+	sample, err := Sample(ra, obj, "items", 2)
+	s.Require().Nil(err)
+	s.Assert().Equal("def", sample[1].(map[string]any)["key"])
+
+	data := make([]byte, ra.Size())
+	_, err = ra.ReadAt(data, 0)
+	s.Require().Nil(err)
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(bytes.NewReader(data)))
+	s.Require().Nil(err)
+	s.Assert().Contains(pbuf.String(), "items (indexed array(3)):")
+
+	// Arrays written from channels also include hashes
+	buf := &bytes.Buffer{}
+	_, err = WriteArrayFromChannel(NewWriterWithVersion(buf, Version3, WithElementHashes(), WithCanonical()), "items", produce(channelItems), func(item channelItem) string { return item.Key })
+	s.Require().Nil(err)
+	ra = bytes.NewReader(buf.Bytes())
+	obj, err = OpenObject(ra)
+	s.Require().Nil(err)
+	channelHashes, err := ElementHashes(ra, obj, "items")
+	s.Require().Nil(err)
+	s.Assert().Equal(hashes, channelHashes)
+}
+
+func (s *ElementHashesSuite) TestErrors() {
+	ra, obj := s.write(channelItems)
+	_, err := ElementHashes(ra, obj, "items")
+	s.Assert().EqualError(err, "array items does not include element hashes")
+
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version3, WithElementHashes()).WriteObject(channelObjectNoIndex{Items: channelItems})
+	s.Require().Nil(err)
+	ra = bytes.NewReader(buf.Bytes())
+	obj, err = OpenObject(ra)
+	s.Require().Nil(err)
+	_, err = ElementHashes(ra, obj, "items")
+	s.Assert().EqualError(err, "field items is not an indexed array")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version2, WithElementHashes()).WriteObject(channelObject{Items: channelItems})
+	s.Assert().ErrorContains(err, "header flags require version 3 or later")
+}
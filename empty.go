@@ -0,0 +1,54 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+/*
+
+Empty values have minimal encodings that are read back as empty values:
+
+- Empty and nil slices are written identically, as an array with a length of
+  zero and no elements. `ReadFieldAt` returns an empty array, and
+  `ReadObject` reads both as nil slices.
+
+- Empty strings in fixed-length (`fixed:N`) fields are written as `N` zero
+  bytes, and fixed strings of only zero bytes are read as empty strings. This
+  applies to string index keys and the string fields of composite keys, too,
+  but a composite key (e.g., `index:a+b`) is read as is, since each of its
+  fields may be zero. Since `ReadObject` knows the field size, it passes the
+  zero bytes of fixed `Marshaler` fields to `UnmarshalRSF`.
+
+- Structs whose fields are all skipped (e.g., with `-` or `skip`) are written
+  without data. Arrays of these structs include only the array size and
+  length, and the index entry of the array lists no subfields. Readers return
+  an empty element for each entry in the array length.
+
+Format of an empty fixed string with `fixed:3`:
+
+  0x0, 0x0, 0x0                                   // 3 zero bytes
+
+Format of an array of 2 structs without fields:
+
+  0x8, 0x0, 0x0, 0x0,                             // array size
+  0x2, 0x0, 0x0, 0x0,                             // array length
+
+*/
+
+// fixedKey returns the string key `bs` of the indexed array described by
+// `entry`. Keys of only zero bytes are empty strings, except for composite
+// keys, which are split into fields by `splitKey`.
+func fixedKey(entry IndexEntry, bs []byte) []byte {
+	if len(entry.IndexKeys) <= 1 && emptyFixed(bs) {
+		return nil
+	}
+	return bs
+}
+
+// emptyFixed returns true if the fixed string `bs` contains only zero bytes,
+// which is how empty strings are written to fixed-length fields.
+func emptyFixed(bs []byte) bool {
+	for _, b := range bs {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
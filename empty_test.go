@@ -0,0 +1,178 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EmptySuite struct {
+	suite.Suite
+}
+
+func TestEmptySuite(t *testing.T) {
+	suite.Run(t, &EmptySuite{})
+}
+
+type emptySkipped struct {
+	ID   int64  `rsf:"id,skip"`
+	Note string `rsf:"-"`
+}
+
+type emptyRelease struct {
+	Hash string `rsf:"hash,fixed:4"`
+	Name string `rsf:"name"`
+}
+
+type emptyPkg struct {
+	Tags     []string       `rsf:"tags"`
+	Checksum string         `rsf:"checksum,fixed:8"`
+	Releases []emptyRelease `rsf:"releases,index:hash"`
+	Skipped  emptySkipped   `rsf:"skipped"`
+	Items    []emptySkipped `rsf:"items"`
+	Version  semver         `rsf:"version,fixed:12"`
+}
+
+func (s *EmptySuite) write(v any, opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, opts...).WriteObject(v)
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+func (s *EmptySuite) TestEmptySlices() {
+	// Empty and nil slices are written identically
+	s.Assert().Equal(s.write(emptyPkg{}), s.write(emptyPkg{Tags: []string{}, Releases: []emptyRelease{}}))
+
+	data := s.write(emptyPkg{})
+	ra := bytes.NewReader(data)
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	tags, err := ReadFieldAt(ra, obj, "tags")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{}, tags)
+	handles, err := ElementHandles(ra, obj, "releases")
+	s.Require().Nil(err)
+	s.Assert().Empty(handles)
+
+	var pkg emptyPkg
+	err = NewReader().ReadObject(bufio.NewReader(bytes.NewReader(data)), &pkg)
+	s.Require().Nil(err)
+	s.Assert().Equal(emptyPkg{}, pkg)
+}
+
+func (s *EmptySuite) TestEmptyFixedStrings() {
+	data := s.write(emptyPkg{Releases: []emptyRelease{{Name: "first"}, {Hash: "abcd", Name: "second"}}})
+	s.Assert().Contains(string(data), string(make([]byte, 8)))
+
+	ra := bytes.NewReader(data)
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	checksum, err := ReadFieldAt(ra, obj, "checksum")
+	s.Require().Nil(err)
+	s.Assert().Equal("", checksum)
+	handles, err := ElementHandles(ra, obj, "releases")
+	s.Require().Nil(err)
+	s.Require().Len(handles, 2)
+	s.Assert().Equal("", handles[0].Key)
+	s.Assert().Equal("abcd", handles[1].Key)
+
+	var pkg emptyPkg
+	err = NewReader().ReadObject(bufio.NewReader(bytes.NewReader(data)), &pkg)
+	s.Require().Nil(err)
+	s.Assert().Equal([]emptyRelease{{Name: "first"}, {Hash: "abcd", Name: "second"}}, pkg.Releases)
+
+	// Marshaled values of only zero bytes are not empty
+	s.Assert().Equal(semver{}, pkg.Version)
+
+	data = s.write(struct {
+		Deps []orderDep `rsf:"deps,index:name"`
+	}{Deps: []orderDep{{}, {Name: "a"}}})
+	obj, err = OpenObject(bytes.NewReader(data))
+	s.Require().Nil(err)
+	view, err := NewFixedView(data, obj, "deps")
+	s.Require().Nil(err)
+	name, err := view.Field("name")
+	s.Require().Nil(err)
+	s.Assert().Equal("", name.String(0))
+	s.Assert().Equal([]byte{0}, name.Bytes(0))
+	s.Assert().Equal("a", name.String(1))
+
+	// Other strings must match the size
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version3).WriteObject(emptyPkg{Checksum: "abc"})
+	s.Assert().EqualError(err, "size 3 does not match expected size 8")
+}
+
+func (s *EmptySuite) TestZeroCompositeKeys() {
+	type release struct {
+		Major int64  `rsf:"major,skip"`
+		Tag   string `rsf:"tag,skip,fixed:2"`
+		Name  string `rsf:"name"`
+	}
+	type pkg struct {
+		Releases []release `rsf:"releases,index:major+tag"`
+	}
+	expected := pkg{Releases: []release{{Name: "zero"}, {Major: 1, Tag: "rc", Name: "one"}}}
+	data := s.write(expected)
+
+	// Composite keys are read as is, since each of their fields may be zero
+	var actual pkg
+	err := NewReader().ReadObject(bufio.NewReader(bytes.NewReader(data)), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(expected, actual)
+
+	ra := bytes.NewReader(data)
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	releases, err := ReadFieldAt(ra, obj, "releases")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"major": int64(0), "tag": "", "name": "zero"},
+		map[string]any{"major": int64(1), "tag": "rc", "name": "one"},
+	}, releases)
+	handles, err := ElementHandles(ra, obj, "releases")
+	s.Require().Nil(err)
+	s.Require().Len(handles, 2)
+	s.Assert().Equal(string(make([]byte, 12)), handles[0].Key)
+
+	out := &bytes.Buffer{}
+	err = Print(out, bufio.NewReader(bytes.NewReader(data)))
+	s.Require().Nil(err)
+}
+
+func (s *EmptySuite) TestSkippedFields() {
+	v := emptyPkg{Skipped: emptySkipped{ID: 1, Note: "a"}, Items: []emptySkipped{{ID: 1}, {ID: 2}}}
+	for _, opts := range [][]WriterOption{nil, {WithVarints()}, {WithElementHashes()}, {Chain(Zstd())}} {
+		data := s.write(v, opts...)
+		ra := bytes.NewReader(data)
+		obj, err := OpenObject(ra)
+		s.Require().Nil(err)
+		m, err := readObjectAt(ra, obj)
+		s.Require().Nil(err)
+		s.Assert().Equal(map[string]any{}, m["skipped"])
+		s.Assert().Equal([]any{map[string]any{}, map[string]any{}}, m["items"])
+
+		var pkg emptyPkg
+		err = NewReader().ReadObject(bufio.NewReader(bytes.NewReader(data)), &pkg)
+		s.Require().Nil(err)
+		s.Assert().Equal([]emptySkipped{{}, {}}, pkg.Items)
+
+		out := &bytes.Buffer{}
+		s.Assert().Nil(Print(out, bufio.NewReader(bytes.NewReader(data))))
+	}
+
+	// Objects without fields have an empty payload
+	for _, opts := range [][]WriterOption{nil, {Chain(Zstd())}} {
+		data := s.write(emptySkipped{ID: 1}, opts...)
+		ra := bytes.NewReader(data)
+		obj, err := OpenObject(ra)
+		s.Require().Nil(err)
+		m, err := readObjectAt(ra, obj)
+		s.Require().Nil(err)
+		s.Assert().Empty(m)
+	}
+}
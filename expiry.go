@@ -0,0 +1,97 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"time"
+)
+
+/*
+
+Struct array elements can record when they expire with an integer field tagged
+with `expires`. The field contains the expiry time in Unix seconds, and zero
+never expires. For example:
+
+  type artifact struct {
+    Name    string `rsf:"name"`
+    Expires int64  `rsf:"expires,expires"`
+  }
+
+Version3 and later record expiry fields in the index using
+`FieldTypeExpiry`, so that readers can omit expired elements without knowing
+the struct. See `WithExpiry`. Use `WithDropExpired` to compact a snapshot by
+rewriting it without expired elements.
+
+*/
+
+// WithDropExpired drops array elements that expire at or before `now` when
+// writing arrays. The array length, size, and index only include the
+// remaining elements.
+func WithDropExpired(now time.Time) WriterOption {
+	return func(f *rsfWriter) {
+		f.dropExpired = now.Unix()
+	}
+}
+
+// WithExpiry causes `ReadFieldAt` to omit array elements that expire at or
+// before `now` when reading objects opened with `OpenObject`. Elements are
+// only omitted from files that record expiry fields in the index.
+func WithExpiry(now time.Time) ReaderOption {
+	return func(f *rsfReader) {
+		f.expiry = now
+	}
+}
+
+// expired returns true if an element that expires at `expiresAt` should be
+// dropped when writing.
+func (f *rsfWriter) expired(expiresAt int64) bool {
+	return f.dropExpired != 0 && isExpired(expiresAt, f.dropExpired)
+}
+
+func isExpired(expiresAt, now int64) bool {
+	return expiresAt != 0 && expiresAt <= now
+}
+
+// dropExpired removes expired elements from the array value `val` described by
+// `entry`, including elements of nested arrays.
+func dropExpired(entry IndexEntry, val any, now int64) any {
+	return filterElements(entry, val, FieldTypeExpiry, func(el map[string]any, field string) (any, bool) {
+		expiresAt, ok := el[field].(int64)
+		return el, !ok || !isExpired(expiresAt, now)
+	})
+}
+
+// filterElements applies `filter` to each element of the struct array value
+// `val` described by `entry`, including elements of nested arrays. `filter` is
+// called with the name of the element field that uses `fieldType`, and returns
+// the element to keep, if any. Arrays with no such field are not filtered.
+func filterElements(entry IndexEntry, val any, fieldType int, filter func(el map[string]any, field string) (any, bool)) any {
+	vals, ok := val.([]any)
+	if entry.FieldType != FieldTypeArray || !ok || entry.Subfields == nil {
+		return val
+	}
+
+	var field string
+	for _, subfield := range entry.Subfields {
+		if subfield.FieldType == fieldType {
+			field = subfield.FieldName
+		}
+	}
+
+	kept := vals[:0]
+	for _, v := range vals {
+		el := v.(map[string]any)
+		for _, subfield := range entry.Subfields {
+			if subfield.FieldType == FieldTypeArray {
+				el[subfield.FieldName] = filterElements(subfield, el[subfield.FieldName], fieldType, filter)
+			}
+		}
+		if field == "" {
+			kept = append(kept, el)
+			continue
+		}
+		if v, ok := filter(el, field); ok {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
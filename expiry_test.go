@@ -0,0 +1,145 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ExpirySuite struct {
+	suite.Suite
+}
+
+func TestExpirySuite(t *testing.T) {
+	suite.Run(t, &ExpirySuite{})
+}
+
+type artifact struct {
+	Name    string `rsf:"name,fixed:3"`
+	Expires int64  `rsf:"expires,expires"`
+}
+
+type build struct {
+	Artifacts []artifact `rsf:"artifacts,index:name"`
+	Logs      []artifact `rsf:"logs"`
+}
+
+var (
+	expiryNow   = time.Unix(1000, 0)
+	expiryBuild = build{
+		Artifacts: []artifact{
+			{Name: "bin", Expires: 0},
+			{Name: "old", Expires: 999},
+			{Name: "now", Expires: 1000},
+			{Name: "new", Expires: 1001},
+		},
+		Logs: []artifact{
+			{Name: "one", Expires: 500},
+			{Name: "two", Expires: 2000},
+		},
+	}
+)
+
+func (s *ExpirySuite) TestReadFieldAtWithExpiry() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(expiryBuild)
+	s.Require().Nil(err)
+
+	// Expiry fields are recorded in the index
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	s.Assert().Equal(FieldTypeExpiry, obj.Index[0].Subfields[1].FieldType)
+	s.Assert().Empty(featureNames(obj.Flags))
+
+	// Without an expiry time, all elements are read
+	artifacts, err := ReadFieldAt(ra, obj, "artifacts")
+	s.Require().Nil(err)
+	s.Assert().Len(artifacts, 4)
+
+	// Expired elements are omitted
+	obj, err = OpenObject(ra, WithExpiry(expiryNow))
+	s.Require().Nil(err)
+	artifacts, err = ReadFieldAt(ra, obj, "artifacts")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"name": "bin", "expires": int64(0)},
+		map[string]any{"name": "new", "expires": int64(1001)},
+	}, artifacts)
+	logs, err := ReadFieldAt(ra, obj, "logs")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"name": "two", "expires": int64(2000)},
+	}, logs)
+
+	// Version2 files do not record expiry fields
+	buf.Reset()
+	_, err = NewWriterWithVersion(buf, Version2).WriteObject(expiryBuild)
+	s.Require().Nil(err)
+	ra = bytes.NewReader(buf.Bytes())
+	obj, err = OpenObject(ra, WithExpiry(expiryNow))
+	s.Require().Nil(err)
+	s.Assert().Equal(FieldTypeInt64, obj.Index[0].Subfields[1].FieldType)
+	artifacts, err = ReadFieldAt(ra, obj, "artifacts")
+	s.Require().Nil(err)
+	s.Assert().Len(artifacts, 4)
+}
+
+func (s *ExpirySuite) TestDropExpired() {
+	compacted := &bytes.Buffer{}
+	w := NewWriterWithVersion(compacted, Version3, WithDropExpired(expiryNow))
+	sz, err := w.WriteObject(expiryBuild)
+	s.Require().Nil(err)
+	s.Assert().Equal(compacted.Len(), sz)
+
+	// Compacting is equivalent to writing only the unexpired elements
+	expected := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(expected, Version3).WriteObject(build{
+		Artifacts: []artifact{expiryBuild.Artifacts[0], expiryBuild.Artifacts[3]},
+		Logs:      expiryBuild.Logs[1:],
+	})
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), compacted.Bytes())
+
+	// The compacted file can be read sequentially using its index
+	r := NewReader()
+	b := bufio.NewReader(bytes.NewReader(compacted.Bytes()))
+	_, err = r.ReadIndex(b)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(b)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(b, "logs")
+	s.Require().Nil(err)
+	_, err = r.ReadSizeField(b)
+	s.Require().Nil(err)
+	count, err := r.ReadSizeField(b)
+	s.Require().Nil(err)
+	s.Assert().Equal(1, count)
+	name, err := r.ReadFixedStringField(3, b)
+	s.Require().Nil(err)
+	s.Assert().Equal("two", name)
+}
+
+func (s *ExpirySuite) TestExpiresNotInteger() {
+	type invalid struct {
+		Items []struct {
+			Expires string `rsf:"expires,expires"`
+		} `rsf:"items"`
+	}
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(invalid{})
+	s.Assert().EqualError(err, "expires field expires must be an integer")
+}
+
+func (s *ExpirySuite) TestPrint() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(build{Logs: expiryBuild.Logs[:1]})
+	s.Require().Nil(err)
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(buf))
+	s.Require().Nil(err)
+	s.Assert().Contains(pbuf.String(), "expires (expires): 500\n")
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+/*
+
+Version3 and later write `float32` values as 4-byte, little-endian IEEE 754
+values rather than widening them to 8-byte floats. In the file index, `float32`
+fields use `FieldTypeFloat32`, and arrays and maps of `float32` values record
+`kindFloat32` as the element type. Use `ReadFloat32Field` to read a `float32`
+value.
+
+Format:
+
+  [value]                                         // 4 bytes
+
+*/
+
+// The size of a `float32` value.
+const sizeFloat32 = 4
+
+// kindFloat32 is recorded as the element type of arrays and maps of 4-byte
+// `float32` values. Version2 and earlier record `reflect.Float32` for
+// arrays of 8-byte floats.
+const kindFloat32 = 1<<8 | int(reflect.Float32)
+
+// elementKind returns the element type to record in the index for arrays and
+// maps with elements of type `el`.
+func (f *rsfWriter) elementKind(el reflect.Type) int {
+	if el.Kind() == reflect.Float32 && f.version > 2 {
+		return kindFloat32
+	}
+	return int(el.Kind())
+}
+
+func (f *rsfWriter) writeIndexFloat(v reflect.Type, t *tag, buf *bytes.Buffer) (int, error) {
+	if v.Kind() == reflect.Float32 && f.version > 2 {
+		return f.writeIndexFixed(t, FieldTypeFloat32, buf)
+	}
+	return f.writeIndexFixed(t, FieldTypeFloat, buf)
+}
+
+func (f *rsfWriter) WriteFloat32Field(pos int, val float32, r io.Writer) (int, error) {
+	fl, err := f.applyFloatPolicy(float64(val))
+	if err != nil {
+		return 0, err
+	}
+	if f.canonical {
+		fl = canonicalFloat(fl)
+	}
+	// Infinite values are normalized to the largest finite float64, which
+	// overflows a float32.
+	if math.Abs(fl) == math.MaxFloat64 {
+		fl = math.Copysign(math.MaxFloat32, fl)
+	}
+
+	// Write float
+	bs := make([]byte, sizeFloat32)
+	f.byteOrder().PutUint32(bs, math.Float32bits(float32(fl)))
+	sz, err := r.Write(bs)
+	if err != nil {
+		return 0, err
+	}
+
+	return pos + sz, nil
+}
+
+func (f *rsfReader) ReadFloat32Field(r io.Reader) (float32, error) {
+	f.owner.check()
+	val, err := f.readFixedWidth(sizeFloat32, r)
+	return math.Float32frombits(uint32(val)), err
+}
+
+func (s *StatelessReader) ReadFloat32Field(off int64) (float32, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadFloat32Field(r)
+	return val, int64(f.pos), err
+}
+
+// readFloat32 reads a `float32` value as a float64, which is how floats are
+// returned by `ReadFieldAt`.
+func (s *StatelessReader) readFloat32(off int64) (float64, int64, error) {
+	val, next, err := s.ReadFloat32Field(off)
+	return float64(val), next, err
+}
+
+func printFloat32(f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	fl, err := reader.ReadFloat32Field(r)
+	if err != nil {
+		return fmt.Errorf("error reading float32: %s", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s (float32): %f\n", strings.Repeat(" ", indent*4), f.FieldName, fl)
+	return err
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type Float32Suite struct {
+	suite.Suite
+}
+
+func TestFloat32Suite(t *testing.T) {
+	suite.Run(t, &Float32Suite{})
+}
+
+type float32Pkg struct {
+	Name    string             `rsf:"name"`
+	Score   float32            `rsf:"score"`
+	Weight  float64            `rsf:"weight"`
+	Vectors []float32          `rsf:"vectors"`
+	Ranks   map[string]float32 `rsf:"ranks"`
+	Rating  *float32           `rsf:"rating"`
+}
+
+var float32Data = []float32Pkg{
+	{
+		Name:    "ggplot2",
+		Score:   0.25,
+		Weight:  1.0 / 3,
+		Vectors: []float32{1.5, -2.25, math.MaxFloat32},
+		Ranks:   map[string]float32{"cran": 0.5},
+		Rating:  ptr(float32(4.5)),
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *Float32Suite) write(version int) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, version)
+	for _, obj := range float32Data {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *Float32Suite) TestReadObject() {
+	br := bufio.NewReader(bytes.NewReader(s.write(Version3)))
+	r := NewReader()
+	for _, expected := range float32Data {
+		var actual float32Pkg
+		err := r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+	s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+}
+
+func (s *Float32Suite) TestIndex() {
+	index, err := IndexOf(float32Pkg{})
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "score", FieldType: FieldTypeFloat32}, index[1])
+	s.Assert().Equal(IndexEntry{FieldName: "weight", FieldType: FieldTypeFloat}, index[2])
+	s.Assert().Equal(kindFloat32, index[3].SubfieldType)
+	s.Assert().Equal(kindFloat32, index[4].SubfieldType)
+
+	// Arrays of float32 values are half the size
+	wide := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(wide, Version3).WriteObject(struct {
+		Vectors []float64 `rsf:"vectors"`
+	}{Vectors: make([]float64, 1000)})
+	s.Require().Nil(err)
+	narrow := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(narrow, Version3).WriteObject(struct {
+		Vectors []float32 `rsf:"vectors"`
+	}{Vectors: make([]float32, 1000)})
+	s.Require().Nil(err)
+	s.Assert().Equal(4000, wide.Len()-narrow.Len())
+}
+
+func (s *Float32Suite) TestVersion2() {
+	// Older versions write float32 values as 8-byte floats
+	type float32V2Pkg struct {
+		Score   float32   `rsf:"score"`
+		Vectors []float32 `rsf:"vectors"`
+	}
+	expected := float32V2Pkg{Score: 0.25, Vectors: []float32{1.5}}
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version2).WriteObject(expected)
+	s.Require().Nil(err)
+	br := bufio.NewReader(buf)
+	r := NewReader()
+	index, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "score", FieldType: FieldTypeFloat}, index[0])
+	s.Assert().Equal(int(reflect.Float32), index[1].SubfieldType)
+	var actual float32V2Pkg
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(expected, actual)
+}
+
+func (s *Float32Suite) TestReadFloat32Field() {
+	br := bufio.NewReader(bytes.NewReader(s.write(Version3)))
+	r := NewReader()
+	_, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "score")
+	s.Require().Nil(err)
+	fl, err := r.ReadFloat32Field(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(float32(0.25), fl)
+	weight, err := r.ReadFloatField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(1.0/3, weight)
+
+	ra := bytes.NewReader(s.write(Version3))
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "score")
+	s.Require().Nil(err)
+	s.Assert().Equal(0.25, val)
+	val, err = ReadFieldAt(ra, obj, "vectors")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{1.5, -2.25, float64(float32(math.MaxFloat32))}, val)
+}
+
+func (s *Float32Suite) TestPrint() {
+	out := &strings.Builder{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write(Version3))))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `name (string): ggplot2
+score (float32): 0.250000
+weight (float): 0.333333
+vectors (array(3)):
+    -1.500000
+    --2.250000
+`)
+}
+
+func (s *Float32Suite) TestRedact() {
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(s.write(Version3)), []Redaction{
+		{Field: "score", Mode: RedactBlank},
+	})
+	s.Require().Nil(err)
+
+	var actual float32Pkg
+	err = NewReader().ReadObject(bufio.NewReader(dst), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(float32(0), actual.Score)
+	s.Assert().Equal(float32Data[0].Vectors, actual.Vectors)
+}
+
+func (s *Float32Suite) TestFloatPolicy() {
+	w := NewWriterWithVersion(&bytes.Buffer{}, Version3, WithFloatPolicy(FloatNormalize)).(*rsfWriter)
+	buf := &bytes.Buffer{}
+	_, err := w.WriteFloat32Field(0, float32(math.Inf(-1)), buf)
+	s.Require().Nil(err)
+	s.Assert().Equal(float32(-math.MaxFloat32), math.Float32frombits(binary.LittleEndian.Uint32(buf.Bytes())))
+
+	w = NewWriterWithVersion(&bytes.Buffer{}, Version3, WithFloatPolicy(FloatReject)).(*rsfWriter)
+	_, err = w.WriteFloat32Field(0, float32(math.NaN()), &bytes.Buffer{})
+	s.Assert().ErrorAs(err, &ErrNonFiniteFloat{})
+
+	// Infinite values are written as-is by default
+	w = NewWriterWithVersion(&bytes.Buffer{}, Version3).(*rsfWriter)
+	buf = &bytes.Buffer{}
+	_, err = w.WriteFloat32Field(0, float32(math.Inf(1)), buf)
+	s.Require().Nil(err)
+	s.Assert().True(math.IsInf(float64(math.Float32frombits(binary.LittleEndian.Uint32(buf.Bytes()))), 1))
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+type followReader struct {
+	ctx      context.Context
+	r        io.Reader
+	interval time.Duration
+}
+
+// Follow returns a reader that reads from `r`, which is usually a file that
+// objects are appended to. Rather than returning `io.EOF` at the end of `r`,
+// the reader polls for new data every `interval`, similar to `tail -f`. Use it
+// with `BeginObject` to read objects as they are appended:
+//
+//	buf := bufio.NewReader(rsf.Follow(ctx, f, time.Second))
+//	_, err := reader.ReadIndex(buf)
+//	...
+//	for {
+//		_, err = reader.BeginObject(buf)
+//		...
+//	}
+//
+// `BeginObject` returns `io.EOF` once the file trailer is written (see
+// `Finalize`). Reads fail with the context's error once `ctx` is done.
+func Follow(ctx context.Context, r io.Reader, interval time.Duration) io.Reader {
+	return &followReader{
+		ctx:      ctx,
+		r:        r,
+		interval: interval,
+	}
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		if err := f.ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		n, err := f.r.Read(p)
+		if n > 0 || (err != nil && !errors.Is(err, io.EOF)) {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return n, err
+		}
+
+		// Wait for new data
+		select {
+		case <-f.ctx.Done():
+			return 0, f.ctx.Err()
+		case <-time.After(f.interval):
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type FollowSuite struct {
+	suite.Suite
+}
+
+func TestFollowSuite(t *testing.T) {
+	suite.Run(t, &FollowSuite{})
+}
+
+func (s *FollowSuite) TestFollow() {
+	path := filepath.Join(s.T().TempDir(), "follow.rsf")
+	out, err := os.Create(path)
+	s.Require().Nil(err)
+	defer out.Close()
+	w := NewWriterWithVersion(out, Version3, WithDigest())
+	_, err = w.WriteObject(headerTestObject{Company: "posit"})
+	s.Require().Nil(err)
+
+	in, err := os.Open(path)
+	s.Require().Nil(err)
+	defer in.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewReader()
+	buf := bufio.NewReader(Follow(ctx, in, time.Millisecond))
+	_, err = r.ReadIndex(buf)
+	s.Require().Nil(err)
+
+	readCompany := func() (string, error) {
+		_, err := r.BeginObject(buf)
+		if err != nil {
+			return "", err
+		}
+		company, err := r.ReadStringField(buf)
+		if err != nil {
+			return "", err
+		}
+		return company, r.EndObject(buf)
+	}
+
+	company, err := readCompany()
+	s.Assert().Nil(err)
+	s.Assert().Equal("posit", company)
+
+	// Wait for the next object to be appended
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.WriteObject(headerTestObject{Company: "rstudio"})
+		_, _ = w.Finalize()
+	}()
+	company, err = readCompany()
+	s.Assert().Nil(err)
+	s.Assert().Equal("rstudio", company)
+
+	// The trailer ends the objects
+	_, err = readCompany()
+	s.Assert().ErrorIs(err, io.EOF)
+
+	// Reads fail once the context is done
+	cancel()
+	_, err = Follow(ctx, in, time.Millisecond).Read(make([]byte, 1))
+	s.Assert().ErrorIs(err, context.Canceled)
+}
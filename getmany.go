@@ -0,0 +1,156 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+const (
+	// Objects that are separated by at most `getManyGap` bytes are read by
+	// `GetMany` with a single range read, up to `getManyBatchSize` bytes.
+	getManyGap       = 64 * 1024
+	getManyBatchSize = 4 * 1024 * 1024
+)
+
+// GetMany reads the objects with the keys `keys` from a store with a string
+// key field, and returns the objects by key in the same form as `Get`. Keys
+// without an object are omitted from the result.
+//
+// Rather than reading each object separately, the objects are sorted by
+// position in the file, objects that are near each other are read with a
+// single range read, and the batches are read and decoded concurrently. This
+// reduces the number of reads when the file is in remote storage.
+func (s *SnapshotStore) GetMany(keys []string) (map[string]map[string]any, error) {
+	st := s.acquire()
+	defer st.readers.Done()
+
+	// Find the object of each key
+	var objects []ObjectRef
+	var found []string
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		k, err := st.normalizeKey(key, s.field)
+		if err != nil {
+			return nil, err
+		}
+		i := st.search(k)
+		if i == len(st.keys) || st.keys[i] != k {
+			continue
+		}
+		objects = append(objects, st.objects[i])
+		found = append(found, key)
+	}
+	sort.Sort(objectsByOffset{objects, found})
+
+	batches := coalesceObjects(objects)
+	results := make([]map[string]any, len(objects))
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, b objectBatch) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = b.read(st.ra, objects, results)
+		}(i, b)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := make(map[string]map[string]any, len(found))
+	for i, key := range found {
+		m[key] = results[i]
+	}
+	return m, nil
+}
+
+// objectsByOffset sorts objects and their keys by position in the file.
+type objectsByOffset struct {
+	objects []ObjectRef
+	keys    []string
+}
+
+func (o objectsByOffset) Len() int           { return len(o.objects) }
+func (o objectsByOffset) Less(i, j int) bool { return o.objects[i].Offset < o.objects[j].Offset }
+func (o objectsByOffset) Swap(i, j int) {
+	o.objects[i], o.objects[j] = o.objects[j], o.objects[i]
+	o.keys[i], o.keys[j] = o.keys[j], o.keys[i]
+}
+
+// objectBatch records a range of objects, sorted by offset, that are read
+// with a single range read.
+type objectBatch struct {
+	start, end int
+}
+
+// coalesceObjects groups `objects`, which must be sorted by offset, into
+// batches of nearby objects.
+func coalesceObjects(objects []ObjectRef) []objectBatch {
+	var batches []objectBatch
+	for i := 0; i < len(objects); {
+		b := objectBatch{start: i, end: i + 1}
+		first := objects[i].Offset
+		last := objects[i].Offset + int64(objects[i].Size)
+		for b.end < len(objects) {
+			next := objects[b.end]
+			end := next.Offset + int64(next.Size)
+			if next.Offset-last > getManyGap || end-first > getManyBatchSize {
+				break
+			}
+			last = end
+			b.end++
+		}
+		batches = append(batches, b)
+		i = b.end
+	}
+	return batches
+}
+
+// read reads the batch's objects with a single range read and decodes them
+// into `results`.
+func (b objectBatch) read(ra io.ReaderAt, objects []ObjectRef, results []map[string]any) error {
+	first := objects[b.start].Offset
+	last := objects[b.end-1].Offset + int64(objects[b.end-1].Size)
+	buf := make([]byte, last-first)
+	_, err := ra.ReadAt(buf, first)
+	if err != nil {
+		return err
+	}
+
+	br := &rangeReaderAt{ra: ra, off: first, buf: buf}
+	for i := b.start; i < b.end; i++ {
+		results[i], err = readObjectAt(br, objects[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeReaderAt serves reads of the range of a file that starts at `off`
+// from `buf`, and reads outside of the range from `ra`.
+type rangeReaderAt struct {
+	ra  io.ReaderAt
+	off int64
+	buf []byte
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < r.off || off+int64(len(p)) > r.off+int64(len(r.buf)) {
+		return r.ra.ReadAt(p, off)
+	}
+	return copy(p, r.buf[off-r.off:]), nil
+}
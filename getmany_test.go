@@ -0,0 +1,88 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GetManySuite struct {
+	suite.Suite
+}
+
+func TestGetManySuite(t *testing.T) {
+	suite.Run(t, &GetManySuite{})
+}
+
+// countingReaderAt counts the calls to `ReadAt`.
+type countingReaderAt struct {
+	ra    io.ReaderAt
+	reads atomic.Int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c.reads.Add(1)
+	return c.ra.ReadAt(p, off)
+}
+
+func (s *GetManySuite) TestGetMany() {
+	var pkgs []storePkg
+	for i := 0; i < 100; i++ {
+		pkgs = append(pkgs, storePkg{Name: fmt.Sprintf("pkg%03d", i), Version: int64(i)})
+	}
+	ra := &countingReaderAt{ra: writeStorePkgs(&s.Suite, pkgs, Chain(Zstd()))}
+	store, err := NewSnapshotStore(ra, "name")
+	s.Require().Nil(err)
+
+	// Missing and duplicate keys are ignored
+	ra.reads.Store(0)
+	objs, err := store.GetMany([]string{"pkg042", "pkg007", "tidyr", "pkg099", "pkg007"})
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]map[string]any{
+		"pkg007": {"name": "pkg007", "version": int64(7)},
+		"pkg042": {"name": "pkg042", "version": int64(42)},
+		"pkg099": {"name": "pkg099", "version": int64(99)},
+	}, objs)
+
+	// The objects are near each other, so they are read with a single read
+	s.Assert().Equal(int64(1), ra.reads.Load())
+
+	objs, err = store.GetMany(nil)
+	s.Require().Nil(err)
+	s.Assert().Empty(objs)
+}
+
+func (s *GetManySuite) TestCoalesce() {
+	objects := []ObjectRef{
+		{Offset: 100, Size: 10},
+		{Offset: 110, Size: 10},
+		{Offset: 120 + getManyGap, Size: 10},
+		{Offset: 131 + 2*getManyGap, Size: 10},
+		{Offset: 141 + 2*getManyGap, Size: getManyBatchSize},
+	}
+	s.Assert().Equal([]objectBatch{
+		{start: 0, end: 3},
+		{start: 3, end: 4},
+		{start: 4, end: 5},
+	}, coalesceObjects(objects))
+	s.Assert().Nil(coalesceObjects(nil))
+}
+
+func (s *GetManySuite) TestErrors() {
+	store, err := NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs), "version")
+	s.Require().Nil(err)
+	_, err = store.GetMany([]string{"plyr"})
+	s.Assert().EqualError(err, "invalid key type string for key field version")
+
+	// Read errors are returned
+	ra := writeStorePkgs(&s.Suite, storePkgs)
+	store, err = NewSnapshotStore(ra, "name")
+	s.Require().Nil(err)
+	store.state.ra = io.NewSectionReader(ra, 0, 20)
+	_, err = store.GetMany([]string{"plyr"})
+	s.Assert().ErrorIs(err, io.EOF)
+}
@@ -3,6 +3,7 @@ module github.com/rstudio/repository-snapshot-format
 go 1.21
 
 require (
+	github.com/klauspost/compress v1.17.11
 	github.com/spf13/cobra v1.8.1
 	github.com/stretchr/testify v1.10.0
 )
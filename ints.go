@@ -0,0 +1,109 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+/*
+
+By default, signed integer fields are written as 10-byte varints, or as
+compact varints with `WithVarints`. Fields tagged with `int8`, `int16`, or
+`int32` (e.g., `rsf:"count,int32"`) are instead written as 1, 2, or 4-byte,
+little-endian two's complement integers, and an error is returned when
+writing a value that does not fit. In the file
+index, narrow integer fields use `FieldTypeInt`, followed by the width of the
+field in bytes. Use `ReadIntFieldWidth`, `ReadInt32Field`, or `ReadInt16Field`
+to read a narrow integer field. Version2 and earlier ignore the tags and write
+all integers as varints.
+
+Format of an index entry:
+
+  [field name]                                    // String field
+  [field type]                                    // 4 bytes (FieldTypeInt)
+  [width]                                         // 4 bytes (1, 2, or 4)
+
+Format of a value:
+
+  [value]                                         // `width` bytes
+
+*/
+
+// intWidths maps narrow integer tags to field widths in bytes.
+var intWidths = map[string]int{
+	rsfInt8:  1,
+	rsfInt16: 2,
+	rsfInt32: 4,
+}
+
+func (f *rsfWriter) writeIndexNarrowInt(v reflect.Type, t *tag, buf *bytes.Buffer) (int, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+	default:
+		return 0, fmt.Errorf("int%d field %s must be a signed integer", t.intWidth*8, t.name)
+	}
+	if t.expires {
+		return 0, fmt.Errorf("expires field %s cannot be a narrow integer", t.name)
+	}
+	if f.version < 3 {
+		return f.writeIndexFixed(t, FieldTypeInt64, buf)
+	}
+
+	sz, err := f.writeIndexFixed(t, FieldTypeInt, buf)
+	if err != nil {
+		return 0, err
+	}
+	widthSz, err := f.WriteSizeField(0, t.intWidth, buf)
+	return sz + widthSz, err
+}
+
+func (f *rsfWriter) writeNarrowInt(val int64, t *tag, buf *bytes.Buffer) (int, error) {
+	shift := 64 - 8*t.intWidth
+	if val<<shift>>shift != val {
+		return 0, fmt.Errorf("value %d of field %s overflows int%d", val, t.name, t.intWidth*8)
+	}
+	return f.WriteIntFieldWidth(0, t.intWidth, val, buf)
+}
+
+func (f *rsfWriter) WriteIntFieldWidth(pos, width int, val int64, r io.Writer) (int, error) {
+	switch width {
+	case 1, 2, 4, 8:
+	default:
+		return 0, fmt.Errorf("invalid integer width %d", width)
+	}
+
+	// Write the low `width` bytes of the value
+	bs := make([]byte, 8)
+	f.byteOrder().PutUint64(bs, uint64(val))
+	sz, err := r.Write(fixedWidth(f.byteOrder(), bs, width))
+	if err != nil {
+		return 0, err
+	}
+
+	return pos + sz, nil
+}
+
+func (f *rsfReader) ReadInt16Field(r io.Reader) (int16, error) {
+	val, err := f.ReadIntFieldWidth(2, r)
+	return int16(val), err
+}
+
+func (s *StatelessReader) ReadInt16Field(off int64) (int16, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadInt16Field(r)
+	return val, int64(f.pos), err
+}
+
+func printNarrowInt(f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	i, err := reader.ReadIntFieldWidth(f.FieldSize, r)
+	if err != nil {
+		return fmt.Errorf("error reading int: %s", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s (int%d): %d\n", strings.Repeat(" ", indent*4), f.FieldName, f.FieldSize*8, i)
+	return err
+}
@@ -0,0 +1,207 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type IntsSuite struct {
+	suite.Suite
+}
+
+func TestIntsSuite(t *testing.T) {
+	suite.Run(t, &IntsSuite{})
+}
+
+type intsRelease struct {
+	Version string `rsf:"version,fixed:5"`
+	Files   int    `rsf:"files,int16"`
+}
+
+type intsPkg struct {
+	Name     string        `rsf:"name"`
+	Stars    int32         `rsf:"stars,int32"`
+	Rank     int           `rsf:"rank,int16"`
+	Score    int8          `rsf:"score,int8"`
+	Size     int64         `rsf:"size"`
+	Yanked   *int          `rsf:"yanked,int8"`
+	Releases []intsRelease `rsf:"releases,index:version"`
+}
+
+var intsData = []intsPkg{
+	{
+		Name:   "ggplot2",
+		Stars:  math.MaxInt32,
+		Rank:   -300,
+		Score:  math.MinInt8,
+		Size:   math.MaxInt64,
+		Yanked: ptr(2),
+		Releases: []intsRelease{
+			{Version: "3.5.0", Files: 120},
+			{Version: "3.5.1", Files: -1},
+		},
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *IntsSuite) write(version int) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, version)
+	for _, obj := range intsData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *IntsSuite) TestReadObject() {
+	br := bufio.NewReader(bytes.NewReader(s.write(Version3)))
+	r := NewReader()
+	for _, expected := range intsData {
+		var actual intsPkg
+		err := r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+	s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+}
+
+func (s *IntsSuite) TestIndex() {
+	index, err := IndexOf(intsPkg{})
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "stars", FieldType: FieldTypeInt, FieldSize: 4}, index[1])
+	s.Assert().Equal(IndexEntry{FieldName: "rank", FieldType: FieldTypeInt, FieldSize: 2}, index[2])
+	s.Assert().Equal(IndexEntry{FieldName: "score", FieldType: FieldTypeInt, FieldSize: 1}, index[3])
+	s.Assert().Equal(IndexEntry{FieldName: "size", FieldType: FieldTypeInt64}, index[4])
+	s.Assert().Equal(IndexEntry{FieldName: "yanked", FieldType: FieldTypeInt, FieldSize: 1, Optional: true}, index[5])
+	s.Assert().Equal(IndexEntry{FieldName: "files", FieldType: FieldTypeInt, FieldSize: 2}, index[6].Subfields[1])
+
+	// Narrow integers are smaller than varints
+	wide := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(wide, Version3).WriteObject(struct {
+		Stars int32 `rsf:"stars"`
+	}{})
+	s.Require().Nil(err)
+	narrow := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(narrow, Version3).WriteObject(struct {
+		Stars int32 `rsf:"stars,int32"`
+	}{})
+	s.Require().Nil(err)
+	s.Assert().Less(narrow.Len()-sizeFieldLen, wide.Len())
+}
+
+func (s *IntsSuite) TestVersion2() {
+	// Older versions ignore the tags and write varints
+	type intsV2Pkg struct {
+		Name  string `rsf:"name"`
+		Stars int32  `rsf:"stars,int32"`
+	}
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version2).WriteObject(intsV2Pkg{Name: "ggplot2", Stars: 42})
+	s.Require().Nil(err)
+	br := bufio.NewReader(buf)
+	r := NewReader()
+	index, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "stars", FieldType: FieldTypeInt64}, index[1])
+	var actual intsV2Pkg
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(intsV2Pkg{Name: "ggplot2", Stars: 42}, actual)
+}
+
+func (s *IntsSuite) TestReadIntFields() {
+	br := bufio.NewReader(bytes.NewReader(s.write(Version3)))
+	r := NewReader()
+	_, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "stars")
+	s.Require().Nil(err)
+	stars, err := r.ReadInt32Field(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(int32(math.MaxInt32), stars)
+	rank, err := r.ReadInt16Field(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(int16(-300), rank)
+	score, err := r.ReadIntFieldWidth(1, br)
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(math.MinInt8), score)
+	size, err := r.ReadIntField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(math.MaxInt64), size)
+
+	ra := bytes.NewReader(s.write(Version3))
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "rank")
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(-300), val)
+	val, err = ReadFieldAt(ra, obj, "releases")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{"version": "3.5.1", "files": int64(-1)}, val.([]any)[1])
+}
+
+func (s *IntsSuite) TestPrint() {
+	out := &strings.Builder{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write(Version3))))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `name (string): ggplot2
+stars (int32): 2147483647
+rank (int16): -300
+score (int8): -128
+size (int): 9223372036854775807
+yanked (int8): 2
+`)
+}
+
+func (s *IntsSuite) TestRedact() {
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(s.write(Version3)), []Redaction{
+		{Field: "rank", Mode: RedactBlank},
+		{Field: "releases.files", Mode: RedactBlank},
+	})
+	s.Require().Nil(err)
+
+	var actual intsPkg
+	err = NewReader().ReadObject(bufio.NewReader(dst), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(0, actual.Rank)
+	s.Assert().Equal(0, actual.Releases[1].Files)
+	s.Assert().Equal(intsData[0].Stars, actual.Stars)
+	s.Assert().Equal(intsData[0].Score, actual.Score)
+}
+
+func (s *IntsSuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		N int `rsf:"n,int8"`
+	}{N: 128})
+	s.Assert().EqualError(err, "value 128 of field n overflows int8")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		N int64 `rsf:"n,int32"`
+	}{N: math.MinInt32 - 1})
+	s.Assert().EqualError(err, "value -2147483649 of field n overflows int32")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		N uint16 `rsf:"n,int16"`
+	}{})
+	s.Assert().EqualError(err, "int16 field n must be a signed integer")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		N []int32 `rsf:"n,int32"`
+	}{})
+	s.Assert().EqualError(err, "int32 field n must be a signed integer")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteIntFieldWidth(0, 3, 0, &bytes.Buffer{})
+	s.Assert().EqualError(err, "invalid integer width 3")
+}
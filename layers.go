@@ -0,0 +1,214 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+
+Layers transform the payload of each top-level object, which includes the
+field offset table, if any, and the object data. Layers are applied in the
+order given to `Chain` when writing and in reverse order when reading. The ID
+of each layer is recorded in the file header in the order applied so that
+readers can construct the matching decode chain.
+
+Format of a record with layers:
+
+  [object size]                                   // Size of encoded record
+  [encoded payload]
+
+When decoded, the payload is read as though it followed the object size, and
+field offsets are relative to the start of the object size field.
+
+*/
+
+// Built-in layer IDs.
+const (
+	LayerChecksum uint16 = iota + 1
+	LayerZstd
+	LayerAESGCM
+	LayerX25519
+)
+
+// A Layer encodes the payload of each top-level object. See `Chain`.
+type Layer interface {
+	Codec
+	// ID identifies the layer in the file header.
+	ID() uint16
+}
+
+// encodeLayers applies layers to a payload in order.
+func encodeLayers(layers []Layer, p []byte) ([]byte, error) {
+	var err error
+	for _, l := range layers {
+		p, err = l.Encode(p)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %w", l.ID(), err)
+		}
+	}
+	return p, nil
+}
+
+// decodeLayers reverses `encodeLayers`.
+func decodeLayers(layers []Layer, p []byte) ([]byte, error) {
+	var err error
+	for i := len(layers) - 1; i >= 0; i-- {
+		p, err = layers[i].Decode(p)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %w", layers[i].ID(), err)
+		}
+	}
+	return p, nil
+}
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+type checksumLayer struct {
+	// When true, decoding removes the checksum without verifying it. See
+	// `WithoutChecksumVerification`.
+	skip bool
+}
+
+// Checksum returns a layer that appends a CRC-32 (IEEE) checksum to each
+// payload. Decoding fails with `ErrChecksumMismatch` if the payload does not
+// match the checksum.
+func Checksum() Layer {
+	return checksumLayer{}
+}
+
+func (checksumLayer) ID() uint16 {
+	return LayerChecksum
+}
+
+func (checksumLayer) Encode(p []byte) ([]byte, error) {
+	return binary.LittleEndian.AppendUint32(p, crc32.ChecksumIEEE(p)), nil
+}
+
+func (c checksumLayer) Decode(p []byte) ([]byte, error) {
+	if len(p) < sizeFieldLen {
+		return nil, ErrChecksumMismatch
+	}
+	data := p[:len(p)-sizeFieldLen]
+	if !c.skip && crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(p[len(data):]) {
+		return nil, ErrChecksumMismatch
+	}
+	return data, nil
+}
+
+type zstdLayer struct {
+	once sync.Once
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+	err  error
+}
+
+// Zstd returns a layer that compresses each payload with zstd. Since each
+// payload is compressed independently, objects can still be located with
+// their sizes.
+func Zstd() Layer {
+	return &zstdLayer{}
+}
+
+func (z *zstdLayer) init() error {
+	z.once.Do(func() {
+		z.enc, z.err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if z.err != nil {
+			return
+		}
+		z.dec, z.err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	})
+	return z.err
+}
+
+func (z *zstdLayer) ID() uint16 {
+	return LayerZstd
+}
+
+func (z *zstdLayer) Encode(p []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.enc.EncodeAll(p, nil), nil
+}
+
+func (z *zstdLayer) Decode(p []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.dec.DecodeAll(p, nil)
+}
+
+type aesGCMLayer struct {
+	key   []byte
+	keyID string
+}
+
+// AESGCM returns a layer that encrypts each payload with AES-GCM using the
+// given 16, 24, or 32-byte key. A random nonce is generated for each payload
+// and stored before the ciphertext.
+func AESGCM(key []byte) Layer {
+	return &aesGCMLayer{key: key}
+}
+
+// AESGCMWithKeyID returns an `AESGCM` layer that also records `keyID` in the
+// file header, so that readers can look up the key with a `KeyProvider`.
+func AESGCMWithKeyID(keyID string, key []byte) Layer {
+	return &aesGCMLayer{key: key, keyID: keyID}
+}
+
+func (a *aesGCMLayer) ID() uint16 {
+	return LayerAESGCM
+}
+
+func (a *aesGCMLayer) KeyID() string {
+	return a.keyID
+}
+
+// keyedLayer is implemented by layers that record a key ID in the file header.
+// See `FlagKeyID`.
+type keyedLayer interface {
+	KeyID() string
+}
+
+func (a *aesGCMLayer) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(a.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (a *aesGCMLayer) Encode(p []byte) ([]byte, error) {
+	aead, err := a.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, p, nil), nil
+}
+
+func (a *aesGCMLayer) Decode(p []byte) ([]byte, error) {
+	aead, err := a.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(p) < aead.NonceSize() {
+		return nil, fmt.Errorf("unexpected encrypted payload size %d", len(p))
+	}
+	return aead.Open(nil, p[:aead.NonceSize()], p[aead.NonceSize():], nil)
+}
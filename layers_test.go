@@ -0,0 +1,464 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LayersSuite struct {
+	suite.Suite
+}
+
+func TestLayersSuite(t *testing.T) {
+	suite.Run(t, &LayersSuite{})
+}
+
+func (s *LayersSuite) TestLayerRoundTrip() {
+	key := bytes.Repeat([]byte{0x1}, 32)
+	payload := []byte(strings.Repeat("a snapshot payload ", 100))
+	for _, l := range []Layer{Checksum(), Zstd(), AESGCM(key)} {
+		encoded, err := l.Encode(bytes.Clone(payload))
+		s.Require().Nil(err)
+		s.Assert().NotEqual(payload, encoded)
+		decoded, err := l.Decode(encoded)
+		s.Require().Nil(err)
+		s.Assert().Equal(payload, decoded)
+	}
+
+	// Layers are applied in order and decoded in reverse order
+	layers := []Layer{Checksum(), Zstd(), AESGCM(key)}
+	encoded, err := encodeLayers(layers, bytes.Clone(payload))
+	s.Require().Nil(err)
+	s.Assert().Less(len(encoded), len(payload))
+	decoded, err := decodeLayers(layers, encoded)
+	s.Require().Nil(err)
+	s.Assert().Equal(payload, decoded)
+}
+
+func (s *LayersSuite) TestLayerErrors() {
+	encoded, err := Checksum().Encode([]byte("abc"))
+	s.Require().Nil(err)
+	encoded[0]++
+	_, err = Checksum().Decode(encoded)
+	s.Assert().ErrorIs(err, ErrChecksumMismatch)
+	_, err = Checksum().Decode([]byte{0x1})
+	s.Assert().ErrorIs(err, ErrChecksumMismatch)
+
+	encoded, err = AESGCM(bytes.Repeat([]byte{0x1}, 16)).Encode([]byte("abc"))
+	s.Require().Nil(err)
+	_, err = AESGCM(bytes.Repeat([]byte{0x2}, 16)).Decode(encoded)
+	s.Assert().NotNil(err)
+
+	_, err = AESGCM([]byte("short")).Encode([]byte("abc"))
+	s.Assert().EqualError(err, "crypto/aes: invalid key size 5")
+}
+
+func (s *LayersSuite) TestChain() {
+	obj := headerTestObject{
+		Company: "posit",
+		Tags:    []string{"a"},
+		Rating:  1.5,
+	}
+
+	plain := &bytes.Buffer{}
+	w := NewWriterWithVersion(plain, Version3)
+	_, err := w.WriteObject(obj)
+	s.Require().Nil(err)
+
+	buf := &bytes.Buffer{}
+	w = NewWriterWithVersion(buf, Version3, Chain(Checksum()))
+	sz, err := w.WriteObject(obj)
+	s.Require().Nil(err)
+	s.Assert().Equal(buf.Len(), sz)
+
+	// Header
+	s.Assert().Equal([]byte{
+		// Index version 3
+		0x0, 0x8, 0x33,
+		// Header size
+		0x18, 0x0, 0x0, 0x0,
+		// Min reader version
+		0x3, 0x0, 0x0, 0x0,
+		// Flags
+		0x48, 0x0, 0x0, 0x0,
+		// One layer
+		0x1, 0x0, 0x0, 0x0,
+		// LayerChecksum
+		0x1, 0x0, 0x0, 0x0,
+		// Float encoding
+		0x1, 0x0, 0x0, 0x0,
+	}, buf.Bytes()[:27])
+
+	// The index is not encoded
+	plainObject := plain.Bytes()[19+0x36:]
+	object := buf.Bytes()[27+0x36:]
+	s.Assert().Equal(plain.Bytes()[19:19+0x36], buf.Bytes()[27:27+0x36])
+
+	// The object payload is followed by a checksum
+	s.Assert().Equal(len(plainObject)+4, int(binary.LittleEndian.Uint32(object)))
+	s.Assert().Equal(plainObject[4:], object[4:len(object)-4])
+	s.Assert().Equal(crc32.ChecksumIEEE(plainObject[4:]), binary.LittleEndian.Uint32(object[len(object)-4:]))
+
+	// Layers require Version3
+	w = NewWriterWithVersion(&bytes.Buffer{}, Version2, Chain(Checksum()))
+	_, err = w.WriteObject(obj)
+	s.Assert().EqualError(err, "header flags require version 3 or later; writer version is 2")
+}
+
+func (s *LayersSuite) TestReadLayers() {
+	key := bytes.Repeat([]byte{0x1}, 32)
+	objs := []headerTestObject{
+		{Company: "posit", Tags: []string{"a", "b"}, Rating: 1.5},
+		{Company: "rstudio", Tags: []string{}, Rating: 2},
+	}
+
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithFieldHashes(), Chain(Checksum(), Zstd(), AESGCM(key)))
+	for _, obj := range objs {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+
+	// Layers that require configuration must be provided
+	_, err := NewReader().ReadIndex(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	s.Assert().Equal(ErrCodecNotRegistered{ID: LayerAESGCM}, err)
+
+	r := NewReader(WithLayers(AESGCM(key)))
+	br := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal([]uint16{LayerChecksum, LayerZstd, LayerAESGCM}, r.Header().Layers)
+	s.Assert().Equal([]string{"field-offsets", "field-hashes", "compression", "checksums", "layers"}, r.Header().Features())
+
+	for _, obj := range objs {
+		_, err = r.BeginObject(br)
+		s.Require().Nil(err)
+		company, err := r.ReadStringField(br)
+		s.Require().Nil(err)
+		s.Assert().Equal(obj.Company, company)
+		err = r.AdvanceTo(br, "rating")
+		s.Require().Nil(err)
+		rating, err := r.ReadFloatField(br)
+		s.Require().Nil(err)
+		s.Assert().Equal(obj.Rating, rating)
+		err = r.EndObject(br)
+		s.Require().Nil(err)
+	}
+	_, err = r.BeginObject(br)
+	s.Assert().ErrorIs(err, io.EOF)
+	s.Assert().Equal(buf.Len(), r.Pos())
+
+	// Stateless reads
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra, WithLayers(AESGCM(key)))
+	s.Require().Nil(err)
+	obj, err = NextObject(ra, obj)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "company")
+	s.Assert().Nil(err)
+	s.Assert().Equal("rstudio", val)
+
+	// Wrong key
+	r = NewReader(WithLayers(AESGCM(bytes.Repeat([]byte{0x2}, 32))))
+	br = bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Assert().EqualError(err, "error decoding object at position 89: layer 3: cipher: message authentication failed")
+}
+
+func (s *LayersSuite) TestKeyProvider() {
+	keys := map[string][]byte{
+		"":   bytes.Repeat([]byte{0x1}, 32),
+		"v2": bytes.Repeat([]byte{0x2}, 32),
+	}
+	var requested []string
+	provider := KeyProviderFunc(func(keyID string) ([]byte, error) {
+		requested = append(requested, keyID)
+		key, ok := keys[keyID]
+		if !ok {
+			return nil, errors.New("unknown key")
+		}
+		return key, nil
+	})
+	obj := headerTestObject{Company: "posit", Tags: []string{"a"}, Rating: 1.5}
+
+	// Files written with a key ID record it in the header
+	rotated := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(rotated, Version3, Chain(Zstd(), AESGCMWithKeyID("v2", keys["v2"]))).WriteObject(obj)
+	s.Require().Nil(err)
+	r := NewReader(WithKeyProvider(provider))
+	br := bufio.NewReader(bytes.NewReader(rotated.Bytes()))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal("v2", r.Header().KeyID)
+	s.Assert().Equal([]string{"compression", "layers", "key-id"}, r.Header().Features())
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	company, err := r.ReadStringField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal("posit", company)
+
+	// Older files use an empty key ID
+	legacy := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(legacy, Version3, Chain(AESGCM(keys[""]))).WriteObject(obj)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(legacy.Bytes())
+	ref, err := OpenObject(ra, WithKeyProvider(provider))
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, ref, "company")
+	s.Require().Nil(err)
+	s.Assert().Equal("posit", val)
+	s.Assert().Equal([]string{"v2", ""}, requested)
+
+	// Key provider errors are returned
+	keys = nil
+	_, err = OpenObject(bytes.NewReader(rotated.Bytes()), WithKeyProvider(provider))
+	s.Assert().EqualError(err, `error getting key "v2": unknown key`)
+}
+
+func (s *LayersSuite) TestWithEncryption() {
+	key := bytes.Repeat([]byte{0x3}, 32)
+	obj := headerTestObject{Company: "posit", Tags: []string{"license: commercial"}}
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, WithCompression(Zstd()), WithEncryption(key)).WriteObject(obj)
+	s.Require().Nil(err)
+	s.Assert().NotContains(buf.String(), "commercial")
+
+	// Objects are decrypted transparently
+	var actual headerTestObject
+	err = NewReader(WithDecryptionKey(key)).ReadObject(bufio.NewReader(bytes.NewReader(buf.Bytes())), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(obj.Tags, actual.Tags)
+	ra := bytes.NewReader(buf.Bytes())
+	ref, err := OpenObject(ra, WithDecryptionKey(key))
+	s.Require().Nil(err)
+	company, err := ReadFieldAt(ra, ref, "company")
+	s.Require().Nil(err)
+	s.Assert().Equal("posit", company)
+
+	// Wrong keys and modified data are detected
+	ref, err = OpenObject(ra, WithDecryptionKey(bytes.Repeat([]byte{0x4}, 32)))
+	s.Require().Nil(err)
+	_, err = ReadFieldAt(ra, ref, "company")
+	s.Assert().ErrorContains(err, "message authentication failed")
+	bs := bytes.Clone(buf.Bytes())
+	bs[len(bs)-1] ^= 0xff
+	err = NewReader(WithDecryptionKey(key)).ReadObject(bufio.NewReader(bytes.NewReader(bs)), &actual)
+	s.Assert().ErrorContains(err, "message authentication failed")
+
+	// Invalid keys are rejected when writing
+	_, err = NewWriterWithVersion(io.Discard, Version3, WithEncryption([]byte("short"))).WriteObject(obj)
+	s.Assert().ErrorContains(err, "invalid key size 5")
+}
+
+func (s *LayersSuite) TestWithoutChecksumVerification() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, WithChecksums()).WriteObject(headerTestObject{Company: "posit"})
+	s.Require().Nil(err)
+
+	// Corrupt the checksum of the object
+	bs := buf.Bytes()
+	bs[len(bs)-1] ^= 0xff
+	r := NewReader()
+	br := bufio.NewReader(bytes.NewReader(bs))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Assert().ErrorIs(err, ErrChecksumMismatch)
+
+	// Checksums are removed without being verified
+	r = NewReader(WithoutChecksumVerification())
+	br = bufio.NewReader(bytes.NewReader(bs))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	company, err := r.ReadStringField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal("posit", company)
+
+	ra := bytes.NewReader(bs)
+	obj, err := OpenObject(ra, WithoutChecksumVerification())
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "company")
+	s.Require().Nil(err)
+	s.Assert().Equal("posit", val)
+
+	// Provided layers take precedence
+	obj, err = OpenObject(ra, WithoutChecksumVerification(), WithLayers(Checksum()))
+	s.Require().Nil(err)
+	_, err = ReadFieldAt(ra, obj, "company")
+	s.Assert().ErrorIs(err, ErrChecksumMismatch)
+}
+
+func (s *LayersSuite) TestRekey() {
+	keys := map[string][]byte{
+		"v1": bytes.Repeat([]byte{0x1}, 32),
+		"v2": bytes.Repeat([]byte{0x2}, 32),
+	}
+	provider := KeyProviderFunc(func(keyID string) ([]byte, error) {
+		return keys[keyID], nil
+	})
+
+	src := &bytes.Buffer{}
+	w := NewWriterWithVersion(src, Version3, WithFieldOffsets(), WithDigest(), Chain(Zstd(), AESGCMWithKeyID("v1", keys["v1"]), Checksum()))
+	for _, obj := range testComplexData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+
+	dst := &bytes.Buffer{}
+	sz, err := Rekey(dst, bytes.NewReader(src.Bytes()), provider, AESGCMWithKeyID("v2", keys["v2"]))
+	s.Require().Nil(err)
+	s.Assert().Equal(dst.Len(), sz)
+	s.Assert().Equal(src.Len(), dst.Len())
+	s.Assert().NotEqual(src.Bytes(), dst.Bytes())
+
+	// The old key is no longer needed, and the digest is valid
+	delete(keys, "v1")
+	r := NewReader(WithKeyProvider(provider))
+	br := bufio.NewReader(VerifyStream(bytes.NewReader(dst.Bytes())))
+	for _, obj := range testComplexData {
+		var actual FullPackageRecordPyPI
+		err = r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(obj.CanonicalName, actual.CanonicalName)
+		s.Assert().Equal(len(obj.Snapshots), len(actual.Snapshots))
+	}
+	s.Assert().Equal("v2", r.Header().KeyID)
+	s.Assert().Equal([]string{"field-offsets", "compression", "checksums", "digest", "layers", "key-id"}, r.Header().Features())
+	_, err = io.Copy(io.Discard, br)
+	s.Assert().Nil(err)
+
+	// Unencrypted files cannot be rekeyed
+	plain := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(plain, Version3, Chain(Zstd())).WriteObject(testComplexData[0])
+	s.Require().Nil(err)
+	_, err = Rekey(&bytes.Buffer{}, plain, provider, AESGCM(keys["v2"]))
+	s.Assert().ErrorIs(err, ErrNotEncrypted)
+	_, err = Rekey(&bytes.Buffer{}, plain, provider, Zstd())
+	s.Assert().EqualError(err, "layer 2 is not an encryption layer")
+}
+
+func (s *LayersSuite) TestRekeyParent() {
+	oldKey := bytes.Repeat([]byte{0x1}, 32)
+	newKey := bytes.Repeat([]byte{0x2}, 32)
+	provider := KeyProviderFunc(func(keyID string) ([]byte, error) {
+		return oldKey, nil
+	})
+	digest := bytes.Repeat([]byte{0xab}, 32)
+
+	src := &bytes.Buffer{}
+	w := NewWriterWithVersion(src, Version3, WithParent("snapshots/2023-05-01.rsf", digest), Chain(AESGCM(oldKey)))
+	_, err := w.WriteObject(testComplexData[0])
+	s.Require().Nil(err)
+
+	dst := &bytes.Buffer{}
+	_, err = Rekey(dst, bytes.NewReader(src.Bytes()), provider, AESGCM(newKey))
+	s.Require().Nil(err)
+
+	// The parent is kept
+	opt := WithKeyProvider(KeyProviderFunc(func(keyID string) ([]byte, error) {
+		return newKey, nil
+	}))
+	parent, ok, err := Lineage(bytes.NewReader(dst.Bytes()), opt)
+	s.Require().Nil(err)
+	s.Assert().True(ok)
+	s.Assert().Equal(Parent{Location: "snapshots/2023-05-01.rsf", Digest: digest}, parent)
+
+	r := NewReader(opt)
+	var actual FullPackageRecordPyPI
+	err = r.ReadObject(bufio.NewReader(bytes.NewReader(dst.Bytes())), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(testComplexData[0].CanonicalName, actual.CanonicalName)
+}
+
+func (s *LayersSuite) TestX25519() {
+	alice, err := ecdh.X25519().GenerateKey(rand.Reader)
+	s.Require().Nil(err)
+	bob, err := ecdh.X25519().GenerateKey(rand.Reader)
+	s.Require().Nil(err)
+	eve, err := ecdh.X25519().GenerateKey(rand.Reader)
+	s.Require().Nil(err)
+
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, Chain(Zstd(), X25519(alice.PublicKey(), bob.PublicKey())))
+	for _, obj := range testComplexData {
+		_, err = w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+
+	// Each recipient decrypts the file with their own private key
+	for _, identity := range []*ecdh.PrivateKey{alice, bob} {
+		r := NewReader(WithIdentity(eve, identity))
+		br := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+		for _, obj := range testComplexData {
+			var actual FullPackageRecordPyPI
+			err = r.ReadObject(br, &actual)
+			s.Require().Nil(err)
+			s.Assert().Equal(obj.CanonicalName, actual.CanonicalName)
+		}
+		s.Assert().Equal([]uint16{LayerZstd, LayerX25519}, r.Header().Layers)
+		s.Assert().Contains(r.Header().Features(), "recipients")
+	}
+
+	// Other identities cannot decrypt the file
+	_, err = OpenObject(bytes.NewReader(buf.Bytes()), WithIdentity(eve))
+	s.Assert().ErrorIs(err, ErrNoIdentity)
+	_, err = OpenObject(bytes.NewReader(buf.Bytes()))
+	s.Assert().ErrorIs(err, ErrNoIdentity)
+
+	// At least one recipient is required
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3, Chain(X25519())).WriteObject(testComplexData[0])
+	s.Assert().EqualError(err, "no X25519 recipients")
+}
+
+func (s *LayersSuite) TestPrintLayers() {
+	plain := &bytes.Buffer{}
+	layered := &bytes.Buffer{}
+	for _, data := range []*bytes.Buffer{plain, layered} {
+		opts := []WriterOption{WithFieldOffsets()}
+		if data == layered {
+			opts = append(opts, Chain(Zstd(), Checksum()))
+		}
+		w := NewWriterWithVersion(data, Version3, opts...)
+		for _, obj := range testComplexData {
+			_, err := w.WriteObject(obj)
+			s.Require().Nil(err)
+		}
+	}
+	s.Assert().NotEqual(plain.Len(), layered.Len())
+
+	// Built-in layers are decoded without configuration
+	expected := &bytes.Buffer{}
+	err := Print(expected, bufio.NewReader(plain))
+	s.Require().Nil(err)
+	actual := &bytes.Buffer{}
+	err = Print(actual, bufio.NewReader(bytes.NewReader(layered.Bytes())))
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.String(), actual.String())
+
+	// Corrupt the last byte of the first object
+	data := layered.Bytes()
+	r := NewReader()
+	br := bufio.NewReader(bytes.NewReader(data))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	data[r.Pos()+int(binary.LittleEndian.Uint32(data[r.Pos():]))-1]++
+	err = Print(actual, bufio.NewReader(bytes.NewReader(data)))
+	s.Assert().ErrorIs(err, ErrChecksumMismatch)
+}
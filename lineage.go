@@ -0,0 +1,170 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+
+When using `WithParent`, the file header records the location (e.g., a URL or
+path) and digest of the parent snapshot, which is the snapshot that the file
+replaces. Since each snapshot records its parent, tooling can follow the chain
+of snapshots backward with `WalkLineage`, e.g., to audit changes or to find a
+snapshot to roll back to.
+
+The parent digest is the digest in the trailer of the parent, which must be
+written with `WithDigest`. Use `ReadDigest` to read it.
+
+Format of the parent in the file header:
+
+  [location]                                      // String field
+  [digest]                                        // String field
+
+*/
+
+// ErrParentMismatch is returned by `WalkLineage` when the digest of a parent
+// snapshot does not match the digest recorded by its child.
+var ErrParentMismatch = errors.New("parent digest does not match")
+
+// Parent records the location and digest of a parent snapshot. See
+// `WithParent`.
+type Parent struct {
+	Location string
+	Digest   []byte
+}
+
+// Opener opens the snapshot at `location`. See `WalkLineage`.
+type Opener func(location string) (io.ReadCloser, error)
+
+// WithParent records the location and digest of the parent snapshot in the
+// file header. See `Lineage`. Requires Version3 or later.
+func WithParent(location string, digest []byte) WriterOption {
+	return func(f *rsfWriter) {
+		f.flags |= FlagParent
+		f.parent = Parent{Location: location, Digest: digest}
+	}
+}
+
+func (f *rsfWriter) writeParent(w io.Writer) error {
+	_, err := f.WriteStringField(0, f.parent.Location, w)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteBytesField(0, f.parent.Digest, w)
+	return err
+}
+
+func (f *rsfReader) readParent(r io.Reader) error {
+	var err error
+	f.parent.Location, err = f.ReadStringField(r)
+	if err != nil {
+		return err
+	}
+	f.parent.Digest, err = f.ReadBytesField(r)
+	return err
+}
+
+// ReadDigest returns the digest in the trailer of the file `rs`, which is
+// written by `Finalize` when using `WithDigest`. The digest is not verified.
+// See `VerifyStream`.
+func ReadDigest(rs io.ReadSeeker) ([]byte, error) {
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	start := end - maxTrailerLen
+	if start < 0 {
+		start = 0
+	}
+	_, err = rs.Seek(start, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := io.ReadAll(rs)
+	if err != nil {
+		return nil, err
+	}
+	_, _, digest, err := parseTrailer(bs)
+	if err != nil {
+		return nil, err
+	}
+	return digest, nil
+}
+
+// Lineage reads the file header from `r` and returns the parent snapshot, if
+// recorded. Reader options, such as `WithLayers`, are used when reading the
+// header.
+func Lineage(r io.Reader, opts ...ReaderOption) (Parent, bool, error) {
+	f := NewReader(opts...).(*rsfReader)
+	_, err := f.ReadIndex(r)
+	if err != nil {
+		return Parent{}, false, err
+	}
+	if f.flags&FlagParent == 0 {
+		return Parent{}, false, nil
+	}
+	return f.parent, true, nil
+}
+
+// WalkLineage follows the chain of parent snapshots of the file read from `r`,
+// calling `fn` with each parent, starting with the parent of `r`. Each parent
+// is opened with `open` and read in full to verify that its digest matches the
+// digest recorded by its child, and an error wrapping `ErrParentMismatch` is
+// returned if not. The walk stops at the first snapshot without a parent, or
+// when `fn` returns an error, which is returned. Reader options are used when
+// reading each header.
+func WalkLineage(r io.Reader, open Opener, fn func(Parent) error, opts ...ReaderOption) error {
+	parent, ok, err := Lineage(r, opts...)
+	if err != nil {
+		return err
+	}
+	visited := make(map[string]bool)
+	for ok {
+		if visited[parent.Location] {
+			return fmt.Errorf("snapshot %s is its own ancestor", parent.Location)
+		}
+		visited[parent.Location] = true
+
+		var next Parent
+		next, ok, err = readParentSnapshot(parent, open, opts...)
+		if err != nil {
+			return fmt.Errorf("error reading parent %s: %w", parent.Location, err)
+		}
+		err = fn(parent)
+		if err != nil {
+			return err
+		}
+		parent = next
+	}
+	return nil
+}
+
+// readParentSnapshot opens and verifies the snapshot `parent`, and returns its
+// parent, if any.
+func readParentSnapshot(parent Parent, open Opener, opts ...ReaderOption) (Parent, bool, error) {
+	rc, err := open(parent.Location)
+	if err != nil {
+		return Parent{}, false, err
+	}
+	defer rc.Close()
+
+	vr := VerifyStream(rc).(*verifyingReader)
+	br := bufio.NewReader(vr)
+	next, ok, err := Lineage(br, opts...)
+	if err != nil {
+		return Parent{}, false, err
+	}
+	_, err = io.Copy(io.Discard, br)
+	if err != nil {
+		return Parent{}, false, err
+	}
+	if !bytes.Equal(vr.digest, parent.Digest) {
+		return Parent{}, false, fmt.Errorf("%w: digest is %x; expected %x", ErrParentMismatch, vr.digest, parent.Digest)
+	}
+	return next, ok, nil
+}
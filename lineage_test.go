@@ -0,0 +1,140 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LineageSuite struct {
+	suite.Suite
+}
+
+func TestLineageSuite(t *testing.T) {
+	suite.Run(t, &LineageSuite{})
+}
+
+// writeLineage writes a chain of snapshots, each of which records the
+// previous snapshot as its parent, and returns the snapshots by location.
+func (s *LineageSuite) writeLineage(locations ...string) map[string][]byte {
+	files := make(map[string][]byte)
+	var parent string
+	for i, location := range locations {
+		opts := []WriterOption{WithDigest()}
+		if parent != "" {
+			digest, err := ReadDigest(bytes.NewReader(files[parent]))
+			s.Require().Nil(err)
+			opts = append(opts, WithParent(parent, digest))
+		}
+		buf := &bytes.Buffer{}
+		w := NewWriterWithVersion(buf, Version3, opts...)
+		_, err := w.WriteObject(testComplexData[i%len(testComplexData)])
+		s.Require().Nil(err)
+		_, err = w.Finalize()
+		s.Require().Nil(err)
+		files[location] = buf.Bytes()
+		parent = location
+	}
+	return files
+}
+
+func opener(files map[string][]byte) Opener {
+	return func(location string) (io.ReadCloser, error) {
+		data, ok := files[location]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+func (s *LineageSuite) TestLineage() {
+	files := s.writeLineage("2024-01-01", "2024-01-02")
+
+	parent, ok, err := Lineage(bytes.NewReader(files["2024-01-02"]))
+	s.Require().Nil(err)
+	s.Assert().True(ok)
+	s.Assert().Equal("2024-01-01", parent.Location)
+	digest, err := ReadDigest(bytes.NewReader(files["2024-01-01"]))
+	s.Require().Nil(err)
+	s.Assert().Equal(digest, parent.Digest)
+
+	_, ok, err = Lineage(bytes.NewReader(files["2024-01-01"]))
+	s.Require().Nil(err)
+	s.Assert().False(ok)
+
+	// The parent is recorded in the header
+	r := NewReader()
+	var obj FullPackageRecordPyPI
+	err = r.ReadObject(bufio.NewReader(bytes.NewReader(files["2024-01-02"])), &obj)
+	s.Require().Nil(err)
+	s.Assert().Equal(parent, r.Header().Parent)
+	s.Assert().Contains(r.Header().Features(), "parent")
+}
+
+func (s *LineageSuite) TestWalkLineage() {
+	files := s.writeLineage("2024-01-01", "2024-01-02", "2024-01-03")
+
+	var locations []string
+	err := WalkLineage(bytes.NewReader(files["2024-01-03"]), opener(files), func(p Parent) error {
+		locations = append(locations, p.Location)
+		return nil
+	})
+	s.Require().Nil(err)
+	s.Assert().Equal([]string{"2024-01-02", "2024-01-01"}, locations)
+
+	// Errors returned by `fn` stop the walk
+	stop := errors.New("stop")
+	locations = nil
+	err = WalkLineage(bytes.NewReader(files["2024-01-03"]), opener(files), func(p Parent) error {
+		locations = append(locations, p.Location)
+		return stop
+	})
+	s.Assert().ErrorIs(err, stop)
+	s.Assert().Equal([]string{"2024-01-02"}, locations)
+}
+
+func (s *LineageSuite) TestWalkLineageErrors() {
+	files := s.writeLineage("2024-01-01", "2024-01-02", "2024-01-03")
+	noop := func(Parent) error { return nil }
+
+	// A parent is replaced
+	replaced := s.writeLineage("2024-01-01", "2024-01-02-a")
+	files["2024-01-01"] = replaced["2024-01-02-a"]
+	err := WalkLineage(bytes.NewReader(files["2024-01-03"]), opener(files), noop)
+	s.Assert().ErrorIs(err, ErrParentMismatch)
+
+	// A parent is corrupted
+	corrupted := append([]byte{}, files["2024-01-02"]...)
+	corrupted[len(corrupted)/2]++
+	files["2024-01-02"] = corrupted
+	err = WalkLineage(bytes.NewReader(files["2024-01-03"]), opener(files), noop)
+	s.Assert().Error(err)
+
+	// A parent is missing
+	delete(files, "2024-01-02")
+	err = WalkLineage(bytes.NewReader(files["2024-01-03"]), opener(files), noop)
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+	s.Assert().ErrorContains(err, "error reading parent 2024-01-02")
+
+	_, err = ReadDigest(bytes.NewReader(s.writeLineage("2024-01-01")["2024-01-01"][:20]))
+	s.Assert().ErrorIs(err, ErrNoTrailer)
+}
+
+func (s *LineageSuite) TestPrintHeader() {
+	files := s.writeLineage("2024-01-01", "2024-01-02")
+	digest, err := ReadDigest(bytes.NewReader(files["2024-01-01"]))
+	s.Require().Nil(err)
+
+	buf := &bytes.Buffer{}
+	err = PrintHeader(buf, bufio.NewReader(bytes.NewReader(files["2024-01-02"])))
+	s.Require().Nil(err)
+	s.Assert().Equal(fmt.Sprintf("version: 3\nmin reader version: 3\nfeatures: digest, parent\nparent: 2024-01-01 (%x)\n", digest), buf.String())
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+
+A map field with string keys (e.g., `map[string]string` or `map[string]dep`)
+is written as a count followed by key/value pairs, in ascending key order so
+that the output is reproducible. Values may be strings, bools, integers,
+floats, or structs, and are written like array elements. The map is prefixed
+with its size so that readers can skip it. Use `ReadMapHeader` to read the
+size and count with a Reader, followed by each key with `ReadStringField` and
+each value.
+
+In the file index, maps use `FieldTypeMap` and are described like arrays that
+are not indexed. Requires Version3 or later.
+
+Format:
+
+  [map size]                                      // Includes the size field
+  [pair count]
+  [key 1 size]
+  [key 1]
+  [value 1]
+  [key n size]
+  [key n]
+  [value n]
+
+*/
+
+// checkMap returns an error if maps of the type `v` cannot be written using
+// the tag `t`.
+func (f *rsfWriter) checkMap(v reflect.Type, t *tag) error {
+	if f.version < 3 {
+		return fmt.Errorf("map %s requires version 3 or later", t.name)
+	}
+	if v.Key().Kind() != reflect.String {
+		return fmt.Errorf("map %s must have string keys", t.name)
+	}
+	if v.Elem() == timeType || isMarshaler(v.Elem()) {
+		return fmt.Errorf("map %s has unsupported value type %s", t.name, v.Elem())
+	}
+	switch v.Elem().Kind() {
+	case reflect.String, reflect.Bool, reflect.Struct,
+		reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8,
+		reflect.Float32, reflect.Float64:
+		return nil
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return f.useUnsigned(t)
+	default:
+		return fmt.Errorf("map %s has unsupported value type %s", t.name, v.Elem())
+	}
+}
+
+func (f *rsfWriter) writeIndexMap(v reflect.Type, t *tag, buf *bytes.Buffer) (int, error) {
+	err := f.checkMap(v, t)
+	if err != nil {
+		return 0, err
+	}
+
+	totalSz, err := f.writeIndexFixed(t, FieldTypeMap, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	// Record the value type and, for struct values, the struct fields.
+	el := v.Elem()
+	var subfields int
+	subfieldsBuf := &bytes.Buffer{}
+	if el.Kind() == reflect.Struct {
+		_, subfields, err = f.writeIndexStruct(el, t, subfieldsBuf)
+		if err != nil {
+			return 0, err
+		}
+	}
+	sz, err := f.WriteSizeField(0, f.elementKind(el), buf)
+	if err != nil {
+		return 0, err
+	}
+	totalSz += sz
+	sz, err = f.WriteSizeField(0, subfields, buf)
+	if err != nil {
+		return 0, err
+	}
+	totalSz += sz
+
+	szCopy, err := io.Copy(buf, subfieldsBuf)
+	if err != nil {
+		return 0, err
+	}
+	return totalSz + int(szCopy), nil
+}
+
+func (f *rsfWriter) writeMap(v reflect.Value, t *tag, buf *bytes.Buffer) (int, error) {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	// Values are written like primitive array elements, so they are not
+	// affected by tag options of the map, such as `fixed`.
+	elT := &tag{name: t.name}
+	pairsBuf := &bytes.Buffer{}
+	for _, key := range keys {
+		_, err := f.WriteStringField(0, key.String(), pairsBuf)
+		if err != nil {
+			return 0, err
+		}
+		_, err = f.writeObject(v.MapIndex(key), elT, pairsBuf)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	sz := sizeFieldLen*2 + pairsBuf.Len()
+	_, err := f.WriteSizeField(0, sz, buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.WriteSizeField(0, len(keys), buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(buf, pairsBuf)
+	if err != nil {
+		return 0, err
+	}
+	return sz, nil
+}
+
+// ReadMapHeader reads the size and pair count of a map field, and returns the
+// pair count. Each key and value follows. See `FieldTypeMap`.
+func (f *rsfReader) ReadMapHeader(r io.Reader) (int, error) {
+	_, err := f.ReadSizeField(r)
+	if err != nil {
+		return 0, err
+	}
+	return f.ReadSizeField(r)
+}
+
+// readMap reads a map as a map of keys to values.
+func (s *StatelessReader) readMap(entry IndexEntry, off int64) (any, int64, error) {
+	sz, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return nil, 0, err
+	}
+	elEntry, err := elementEntry(entry)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	vals := make(map[string]any, count)
+	for i := 0; i < count; i++ {
+		var key string
+		key, next, err = s.ReadStringField(next)
+		if err != nil {
+			return nil, 0, err
+		}
+		vals[key], next, err = s.readElement(entry, elEntry, next)
+		if err != nil {
+			return nil, 0, fmt.Errorf("map %s key %s: %w", entry.FieldName, key, err)
+		}
+	}
+	if end := off + int64(sz); next != end {
+		return nil, 0, fmt.Errorf("map %s at position %d: read %d of %d bytes", entry.FieldName, off, next-off, sz)
+	}
+	return vals, next, nil
+}
+
+func printMap(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	pad := strings.Repeat(" ", indent*4)
+	count, err := reader.ReadMapHeader(r)
+	if err != nil {
+		return fmt.Errorf("error reading map header: %s", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s (map(%d)):\n", pad, f.FieldName, count)
+	if err != nil {
+		return err
+	}
+
+	elEntry, err := elementEntry(f)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		key, err := reader.ReadStringField(r)
+		if err != nil {
+			return fmt.Errorf("error reading map key: %s", err)
+		}
+		if f.Subfields == nil {
+			elEntry.FieldName = key
+			err = printField(parentKey, elEntry, w, r, reader, indent+1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, err = fmt.Fprintf(w, "%s- %s\n", pad+strings.Repeat(" ", 4), key)
+		if err != nil {
+			return err
+		}
+		for _, subfield := range f.Subfields {
+			err = printField(parentKey, subfield, w, r, reader, indent+2)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MapsSuite struct {
+	suite.Suite
+}
+
+func TestMapsSuite(t *testing.T) {
+	suite.Run(t, &MapsSuite{})
+}
+
+type mapDep struct {
+	Version string `rsf:"version"`
+	Email   string `rsf:"email"`
+}
+
+type mapPkg struct {
+	Name      string            `rsf:"name"`
+	Labels    map[string]string `rsf:"labels"`
+	Downloads map[string]int64  `rsf:"downloads"`
+	Deps      map[string]mapDep `rsf:"deps"`
+	Empty     map[string]bool   `rsf:"empty"`
+	Rating    float64           `rsf:"rating"`
+}
+
+var mapData = mapPkg{
+	Name:      "ggplot2",
+	Labels:    map[string]string{"topic": "graphics", "license": "MIT", "lang": "R"},
+	Downloads: map[string]int64{"2024": 100, "2023": 80},
+	Deps: map[string]mapDep{
+		"scales": {Version: "1.3.0", Email: "a@example.com"},
+		"rlang":  {Version: "1.1.0", Email: "b@example.com"},
+	},
+	Rating: 4.5,
+}
+
+func (s *MapsSuite) write(v any, opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, opts...).WriteObject(v)
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+func (s *MapsSuite) TestReadObject() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldHashes()},
+	} {
+		r := NewReader()
+		var actual mapPkg
+		err := r.ReadObject(bufio.NewReader(bytes.NewReader(s.write(mapData, opts...))), &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(mapData, actual)
+		s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+	}
+}
+
+func (s *MapsSuite) TestDeterministic() {
+	// Keys are written in order, so output does not depend on map iteration
+	// order.
+	expected := s.write(mapData)
+	for i := 0; i < 10; i++ {
+		s.Assert().Equal(expected, s.write(mapData))
+	}
+}
+
+func (s *MapsSuite) TestReadFieldAt() {
+	ra := bytes.NewReader(s.write(mapData))
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+
+	deps, err := ReadFieldAt(ra, obj, "deps")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{
+		"scales": map[string]any{"version": "1.3.0", "email": "a@example.com"},
+		"rlang":  map[string]any{"version": "1.1.0", "email": "b@example.com"},
+	}, deps)
+
+	empty, err := ReadFieldAt(ra, obj, "empty")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{}, empty)
+
+	rating, err := ReadFieldAt(ra, obj, "rating")
+	s.Require().Nil(err)
+	s.Assert().Equal(4.5, rating)
+}
+
+func (s *MapsSuite) TestReadMapHeader() {
+	br := bufio.NewReader(bytes.NewReader(s.write(mapData)))
+	r := NewReader()
+	_, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+
+	err = r.AdvanceTo(br, "downloads")
+	s.Require().Nil(err)
+	count, err := r.ReadMapHeader(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(2, count)
+	for _, expected := range []struct {
+		key string
+		val int64
+	}{{"2023", 80}, {"2024", 100}} {
+		key, err := r.ReadStringField(br)
+		s.Require().Nil(err)
+		val, err := r.ReadIntField(br)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected.key, key)
+		s.Assert().Equal(expected.val, val)
+	}
+
+	// Maps are skipped using their size
+	err = r.AdvanceTo(br, "rating")
+	s.Require().Nil(err)
+	rating, err := r.ReadFloatField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(4.5, rating)
+}
+
+func (s *MapsSuite) TestPrint() {
+	out := &strings.Builder{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write(mapData))))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `labels (map(3)):
+    lang (string): R
+    license (string): MIT
+    topic (string): graphics
+downloads (map(2)):
+    2023 (int): 80
+    2024 (int): 100
+deps (map(2)):
+    - rlang
+        version (string): 1.1.0
+        email (string): b@example.com
+    - scales
+        version (string): 1.3.0
+        email (string): a@example.com
+empty (map(0)):
+rating (float): 4.500000
+`)
+}
+
+func (s *MapsSuite) TestRedact() {
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(s.write(mapData)), []Redaction{
+		{Field: "deps.email", Mode: RedactBlank},
+		{Field: "labels", Mode: RedactBlank},
+	})
+	s.Require().Nil(err)
+
+	expected := mapData
+	expected.Labels = nil
+	expected.Deps = map[string]mapDep{
+		"scales": {Version: "1.3.0"},
+		"rlang":  {Version: "1.1.0"},
+	}
+	s.Assert().Equal(s.write(expected), dst.Bytes())
+}
+
+func (s *MapsSuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version2).WriteObject(mapData)
+	s.Assert().EqualError(err, "map labels requires version 3 or later")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		M map[int]string `rsf:"m"`
+	}{})
+	s.Assert().EqualError(err, "map m must have string keys")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		M map[string][]string `rsf:"m"`
+	}{})
+	s.Assert().EqualError(err, "map m has unsupported value type []string")
+}
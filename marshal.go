@@ -0,0 +1,92 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+/*
+
+Types that implement `Marshaler` control their own binary representation,
+analogous to `json.Marshaler`. `WriteObject` writes the bytes returned by
+`MarshalRSF` as a byte field (see `FieldTypeBytes`), or as a fixed-size string
+when the field is tagged with `fixed` (e.g., `rsf:"version,fixed:12"`), which
+avoids the size field. `ReadObject` passes the bytes to `UnmarshalRSF` when the
+destination field implements `Unmarshaler`. Arrays and maps of marshaled values
+are not supported.
+
+Format:
+
+  [size]                                          // 4 bytes, unless fixed
+  [data]                                          // `size` bytes
+
+*/
+
+// Marshaler is implemented by types that write their own binary
+// representation. `MarshalRSF` must have a value receiver, since the values
+// passed to `WriteObject` are not addressable.
+type Marshaler interface {
+	MarshalRSF() ([]byte, error)
+}
+
+// Unmarshaler is implemented by types that read the binary representation
+// written by their `Marshaler`. `UnmarshalRSF` must copy the data if it is
+// retained after returning.
+type Unmarshaler interface {
+	UnmarshalRSF(data []byte) error
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+// isMarshaler returns true if `v` implements `Marshaler`.
+func isMarshaler(v reflect.Type) bool {
+	return v.Implements(marshalerType)
+}
+
+func (f *rsfWriter) writeIndexMarshaler(t *tag, buf *bytes.Buffer) (int, error) {
+	if t.fixed > 0 {
+		return f.writeIndexString(t, buf)
+	}
+	return f.writeIndexBytes(t, buf)
+}
+
+func (f *rsfWriter) writeMarshaler(v reflect.Value, t *tag, buf *bytes.Buffer) (int, error) {
+	if !v.CanInterface() {
+		return 0, fmt.Errorf("marshaler field %s must be exported", t.name)
+	}
+	bs, err := v.Interface().(Marshaler).MarshalRSF()
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling field %s: %w", t.name, err)
+	}
+	if t.fixed > 0 {
+		if len(bs) != t.fixed {
+			return 0, fmt.Errorf("field %s marshaled to %d bytes; expected %d", t.name, len(bs), t.fixed)
+		}
+		return f.WriteFixedStringField(0, t.fixed, string(bs), buf)
+	}
+	return f.writeBytes(bs, t, buf)
+}
+
+// unmarshalValue passes the decoded value `val`, which is a byte or string
+// field, to `UnmarshalRSF`.
+func unmarshalValue(v reflect.Value, val any) error {
+	var bs []byte
+	switch data := val.(type) {
+	case []byte:
+		bs = data
+	case string:
+		bs = []byte(data)
+	default:
+		return fmt.Errorf("cannot read %T into %s", val, v.Type())
+	}
+	err := v.Addr().Interface().(Unmarshaler).UnmarshalRSF(bs)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling %s: %w", v.Type(), err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MarshalSuite struct {
+	suite.Suite
+}
+
+func TestMarshalSuite(t *testing.T) {
+	suite.Run(t, &MarshalSuite{})
+}
+
+// semver is encoded as three 4-byte integers.
+type semver struct {
+	Major, Minor, Patch uint32
+}
+
+func (v semver) MarshalRSF() ([]byte, error) {
+	bs := make([]byte, 12)
+	binary.LittleEndian.PutUint32(bs, v.Major)
+	binary.LittleEndian.PutUint32(bs[4:], v.Minor)
+	binary.LittleEndian.PutUint32(bs[8:], v.Patch)
+	return bs, nil
+}
+
+func (v *semver) UnmarshalRSF(data []byte) error {
+	if len(data) != 12 {
+		return fmt.Errorf("invalid version size %d", len(data))
+	}
+	v.Major = binary.LittleEndian.Uint32(data)
+	v.Minor = binary.LittleEndian.Uint32(data[4:])
+	v.Patch = binary.LittleEndian.Uint32(data[8:])
+	return nil
+}
+
+// license is encoded as a variable-length string.
+type license struct {
+	Name string
+}
+
+func (l license) MarshalRSF() ([]byte, error) {
+	if l.Name == "invalid" {
+		return nil, errors.New("invalid license")
+	}
+	return []byte(l.Name), nil
+}
+
+func (l *license) UnmarshalRSF(data []byte) error {
+	l.Name = string(data)
+	return nil
+}
+
+type marshalPkg struct {
+	Name    string   `rsf:"name"`
+	Version semver   `rsf:"version,fixed:12"`
+	License license  `rsf:"license"`
+	Minimum *semver  `rsf:"minimum,fixed:12"`
+	Tags    []string `rsf:"tags"`
+}
+
+var marshalData = []marshalPkg{
+	{
+		Name:    "ggplot2",
+		Version: semver{3, 5, 1},
+		License: license{"MIT"},
+		Minimum: &semver{Major: 3},
+		Tags:    []string{"plotting"},
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *MarshalSuite) write(version int) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, version)
+	for _, obj := range marshalData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *MarshalSuite) TestReadObject() {
+	br := bufio.NewReader(bytes.NewReader(s.write(Version3)))
+	r := NewReader()
+	for _, expected := range marshalData {
+		var actual marshalPkg
+		err := r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+}
+
+func (s *MarshalSuite) TestIndex() {
+	index, err := IndexOf(marshalPkg{})
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "version", FieldType: FieldTypeFixedStr, FieldSize: 12}, index[1])
+	s.Assert().Equal(IndexEntry{FieldName: "license", FieldType: FieldTypeBytes}, index[2])
+	s.Assert().Equal(IndexEntry{FieldName: "minimum", FieldType: FieldTypeFixedStr, FieldSize: 12, Optional: true}, index[3])
+
+	// Older versions record marshaled values as strings
+	type marshalV2Pkg struct {
+		Version semver  `rsf:"version,fixed:12"`
+		License license `rsf:"license"`
+	}
+	expected := marshalV2Pkg{Version: semver{1, 2, 3}, License: license{"GPL-3"}}
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version2).WriteObject(expected)
+	s.Require().Nil(err)
+	br := bufio.NewReader(buf)
+	r := NewReader()
+	index, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "license", FieldType: FieldTypeVarStr}, index[1])
+	var actual marshalV2Pkg
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(expected, actual)
+}
+
+func (s *MarshalSuite) TestReadFieldAt() {
+	ra := bytes.NewReader(s.write(Version3))
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "version")
+	s.Require().Nil(err)
+	var v semver
+	err = v.UnmarshalRSF([]byte(val.(string)))
+	s.Require().Nil(err)
+	s.Assert().Equal(semver{3, 5, 1}, v)
+	val, err = ReadFieldAt(ra, obj, "license")
+	s.Require().Nil(err)
+	s.Assert().Equal([]byte("MIT"), val)
+}
+
+func (s *MarshalSuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		License license `rsf:"license"`
+	}{License: license{"invalid"}})
+	s.Assert().EqualError(err, "error marshaling field license: invalid license")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		Version semver `rsf:"version,fixed:8"`
+	}{})
+	s.Assert().EqualError(err, "field version marshaled to 12 bytes; expected 8")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		Versions []semver `rsf:"versions"`
+	}{})
+	s.Assert().EqualError(err, "array versions has unsupported element type rsf.semver")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		Versions map[string]semver `rsf:"versions"`
+	}{})
+	s.Assert().EqualError(err, "map versions has unsupported value type rsf.semver")
+
+	// Unmarshaling errors are returned
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version3).WriteObject(struct {
+		Version string `rsf:"version"`
+	}{Version: "3.5.1"})
+	s.Require().Nil(err)
+	var pkg struct {
+		Version semver `rsf:"version"`
+	}
+	err = NewReader().ReadObject(bufio.NewReader(buf), &pkg)
+	s.Assert().EqualError(err, "field version: error unmarshaling rsf.semver: invalid version size 5")
+}
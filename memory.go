@@ -0,0 +1,123 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// MemorySnapshot is a Writer destination that keeps the encoded file in
+// memory, for tests and for small datasets that never touch disk. Once the
+// objects are written, the snapshot can be read with the same APIs as a file:
+// `Open` and `Each` mirror `OpenObject` and `NextObject`, `Store` creates a
+// `SnapshotStore` for lookups, and `Reader` streams the file for `ReadObject`.
+//
+//	snap := NewMemorySnapshot()
+//	w := NewWriter(snap)
+//	_, err := w.WriteObject(pkg)
+//	...
+//	store, err := snap.Store("name")
+//
+// A MemorySnapshot is not safe for concurrent writes, but is safe for
+// concurrent reads once writing is complete.
+type MemorySnapshot struct {
+	buf  []byte
+	opts []ReaderOption
+}
+
+// NewMemorySnapshot creates an empty MemorySnapshot. Reader options, such as
+// `WithLayers`, are used when reading the snapshot.
+func NewMemorySnapshot(opts ...ReaderOption) *MemorySnapshot {
+	return &MemorySnapshot{opts: opts}
+}
+
+func (m *MemorySnapshot) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+	return len(p), nil
+}
+
+// Size returns the number of bytes written to the snapshot.
+func (m *MemorySnapshot) Size() int {
+	return len(m.buf)
+}
+
+// Bytes returns the encoded file. The bytes must not be modified.
+func (m *MemorySnapshot) Bytes() []byte {
+	return m.buf
+}
+
+// Reset discards the encoded file so that the snapshot can be reused with a
+// new Writer. Readers and stores created before Reset must not be used.
+func (m *MemorySnapshot) Reset() {
+	m.buf = m.buf[:0]
+}
+
+// ReaderAt returns a reader of the encoded file, for use with `ReadFieldAt`
+// or a `StatelessReader`.
+func (m *MemorySnapshot) ReaderAt() io.ReaderAt {
+	return bytes.NewReader(m.buf)
+}
+
+// Reader returns a reader that streams the encoded file, for use with the
+// Reader returned by `NewReader`.
+func (m *MemorySnapshot) Reader() *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(m.buf))
+}
+
+// Open returns a reference to the first object in the snapshot like
+// `OpenObject`. Use `NextObject` with `ReaderAt` to read the following
+// objects.
+func (m *MemorySnapshot) Open() (ObjectRef, error) {
+	return OpenObject(m.ReaderAt(), m.opts...)
+}
+
+// Len returns the number of objects in the snapshot.
+func (m *MemorySnapshot) Len() (int, error) {
+	var n int
+	err := m.walk(func(io.ReaderAt, ObjectRef) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// Each calls `fn` with each object in the snapshot, in order, in the same
+// form as `SnapshotStore.Get`. Iteration stops when `fn` returns an error,
+// which is returned.
+func (m *MemorySnapshot) Each(fn func(obj map[string]any) error) error {
+	return m.walk(func(ra io.ReaderAt, ref ObjectRef) error {
+		obj, err := readObjectAt(ra, ref)
+		if err != nil {
+			return err
+		}
+		return fn(obj)
+	})
+}
+
+// walk calls `fn` with a reference to each object in the snapshot.
+func (m *MemorySnapshot) walk(fn func(io.ReaderAt, ObjectRef) error) error {
+	if len(m.buf) == 0 {
+		return nil
+	}
+	ra := m.ReaderAt()
+	ref, err := OpenObject(ra, m.opts...)
+	for err == nil {
+		err = fn(ra, ref)
+		if err != nil {
+			return err
+		}
+		ref, err = NextObject(ra, ref)
+	}
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// Store creates a `SnapshotStore` that looks up the objects in the snapshot by
+// the value of the top-level field `field`. The store reads the bytes written
+// so far, so objects written after the store is created are not included.
+func (m *MemorySnapshot) Store(field string) (*SnapshotStore, error) {
+	return NewSnapshotStore(m.ReaderAt(), field, m.opts...)
+}
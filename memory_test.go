@@ -0,0 +1,102 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MemorySuite struct {
+	suite.Suite
+}
+
+func TestMemorySuite(t *testing.T) {
+	suite.Run(t, &MemorySuite{})
+}
+
+func (s *MemorySuite) write(snap *MemorySnapshot, opts ...WriterOption) {
+	w := NewWriterWithVersion(snap, Version3, opts...)
+	for _, pkg := range storePkgs {
+		_, err := w.WriteObject(pkg)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+}
+
+func (s *MemorySuite) TestSnapshot() {
+	snap := NewMemorySnapshot()
+	s.write(snap, WithDigest())
+
+	// The snapshot matches a file written with the same objects
+	s.Assert().Equal(writeStorePkgs(&s.Suite, storePkgs, WithDigest()).Size(), int64(snap.Size()))
+	n, err := snap.Len()
+	s.Require().Nil(err)
+	s.Assert().Equal(3, n)
+
+	var names []any
+	err = snap.Each(func(obj map[string]any) error {
+		names = append(names, obj["name"])
+		return nil
+	})
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{"plyr", "dplyr", "ggplot2"}, names)
+
+	obj, err := snap.Open()
+	s.Require().Nil(err)
+	obj, err = NextObject(snap.ReaderAt(), obj)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(snap.ReaderAt(), obj, "version")
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(1), val)
+
+	var pkg storePkg
+	err = NewReader().ReadObject(snap.Reader(), &pkg)
+	s.Require().Nil(err)
+	s.Assert().Equal(storePkgs[0], pkg)
+
+	_, err = io.Copy(io.Discard, VerifyStream(bytes.NewReader(snap.Bytes())))
+	s.Assert().Nil(err)
+}
+
+func (s *MemorySuite) TestStore() {
+	key := bytes.Repeat([]byte{1}, 32)
+	snap := NewMemorySnapshot(WithLayers(AESGCM(key)))
+	s.write(snap, Chain(AESGCM(key)))
+
+	store, err := snap.Store("name")
+	s.Require().Nil(err)
+	pkg, err := store.Get("dplyr")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{"name": "dplyr", "version": int64(1)}, pkg)
+	pkgs, err := store.GetMany([]string{"plyr", "ggplot2"})
+	s.Require().Nil(err)
+	s.Assert().Len(pkgs, 2)
+}
+
+func (s *MemorySuite) TestEmptyAndReset() {
+	snap := NewMemorySnapshot()
+	n, err := snap.Len()
+	s.Require().Nil(err)
+	s.Assert().Equal(0, n)
+
+	s.write(snap)
+	s.Assert().NotZero(snap.Size())
+	snap.Reset()
+	s.Assert().Zero(snap.Size())
+
+	// Iteration stops at the first error
+	s.write(snap)
+	stop := errors.New("stop")
+	var calls int
+	err = snap.Each(func(map[string]any) error {
+		calls++
+		return stop
+	})
+	s.Assert().ErrorIs(err, stop)
+	s.Assert().Equal(1, calls)
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+
+An array of arrays (e.g., `[][]snap` or `[][]string`) is written like other
+arrays, with each element written as a complete array, including its own size
+and length fields. Arrays of arrays can be nested to any depth, and can contain
+struct arrays, which can themselves contain arrays.
+
+In the file index, the element type of an array of arrays is `reflect.Slice`,
+and the array has a single subfield: an unnamed entry that describes the
+element arrays. Readers record this entry as the `Element` of the array's
+index entry rather than as a subfield. Arrays of arrays cannot be indexed or
+segmented. Requires Version3 or later. Older versions write the elements
+without describing them, so they cannot be decoded. See `ErrArrayOfArrays`.
+
+Format:
+
+  [array size]                                    // 4 bytes
+  [array length]                                  // 4 bytes
+  [element array 1]
+  ...
+  [element array n]
+
+*/
+
+// isNestedArray returns true if the array element type `el` is itself written
+// as an array. Byte slices are written as bytes. See `FieldTypeBytes`.
+func isNestedArray(el reflect.Type) bool {
+	return (el.Kind() == reflect.Array || el.Kind() == reflect.Slice) && !isBytes(el)
+}
+
+// checkNestedArray returns an error if the array of arrays with the tag `t`
+// cannot be written.
+func checkNestedArray(t *tag) error {
+	if t.index != "" {
+		return fmt.Errorf("array %s of arrays cannot be indexed", t.name)
+	}
+	if t.segment != "" {
+		return fmt.Errorf("array %s of arrays cannot be segmented", t.name)
+	}
+	return nil
+}
+
+// nestedElement returns the entry that describes the elements of an array of
+// arrays, which is read as the only subfield of the array, and the remaining
+// subfields.
+func (f *rsfReader) nestedElement(fieldType, elementType int, subfields Index) (*IndexEntry, Index) {
+	if f.indexVersion < 3 || fieldType != FieldTypeArray || len(subfields) != 1 {
+		return nil, subfields
+	}
+	switch reflect.Kind(elementType) {
+	case reflect.Array, reflect.Slice:
+		return &subfields[0], nil
+	}
+	return nil, subfields
+}
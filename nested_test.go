@@ -0,0 +1,140 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type NestedSuite struct {
+	suite.Suite
+}
+
+func TestNestedSuite(t *testing.T) {
+	suite.Run(t, &NestedSuite{})
+}
+
+type nestedVersion struct {
+	Version string   `rsf:"version,fixed:5"`
+	Files   []string `rsf:"files"`
+}
+
+type nestedPackage struct {
+	Name     string          `rsf:"name"`
+	Versions []nestedVersion `rsf:"versions,index:version"`
+}
+
+type nestedRepo struct {
+	Name     string            `rsf:"name"`
+	Packages []nestedPackage   `rsf:"packages"`
+	Groups   [][]nestedPackage `rsf:"groups"`
+	Matrix   [][]int64         `rsf:"matrix"`
+	Deep     [][][]string      `rsf:"deep"`
+}
+
+var nestedData = []nestedRepo{
+	{
+		Name: "cran",
+		Packages: []nestedPackage{
+			{Name: "ggplot2", Versions: []nestedVersion{{Version: "3.5.1", Files: []string{"a.tar.gz", "b.zip"}}, {Version: "3.5.0"}}},
+			{Name: "rlang"},
+		},
+		Groups: [][]nestedPackage{
+			{{Name: "dplyr", Versions: []nestedVersion{{Version: "1.1.4", Files: []string{"c.tar.gz"}}}}},
+			nil,
+			{{Name: "tidyr"}, {Name: "purrr"}},
+		},
+		Matrix: [][]int64{{1, 2, 3}, {-4}},
+		Deep:   [][][]string{{{"a"}, {"b", "c"}}, {nil}},
+	},
+	{
+		Name: "pypi",
+	},
+}
+
+func (s *NestedSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range nestedData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *NestedSuite) TestReadObject() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	for _, expected := range nestedData {
+		var actual nestedRepo
+		err := r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+	s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+}
+
+func (s *NestedSuite) TestIndex() {
+	index, err := IndexOf(nestedRepo{})
+	s.Require().Nil(err)
+	s.Assert().Nil(index[1].Element)
+	s.Assert().Nil(index[2].Subfields)
+	s.Require().NotNil(index[2].Element)
+	s.Assert().Equal(FieldTypeArray, index[2].Element.FieldType)
+	s.Assert().Equal("versions", index[2].Element.Subfields[1].FieldName)
+	s.Assert().Equal(IndexEntry{FieldType: FieldTypeArray, SubfieldType: int(reflect.Int64)}, *index[3].Element)
+	s.Assert().Equal(int(reflect.String), index[4].Element.Element.SubfieldType)
+}
+
+func (s *NestedSuite) TestReadFieldAt() {
+	ra := bytes.NewReader(s.write())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	matrix, err := ReadFieldAt(ra, obj, "matrix")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{[]any{int64(1), int64(2), int64(3)}, []any{int64(-4)}}, matrix)
+	groups, err := ReadFieldAt(ra, obj, "groups")
+	s.Require().Nil(err)
+	s.Assert().Len(groups, 3)
+	s.Assert().Equal(map[string]any{"name": "tidyr", "versions": []any{}}, groups.([]any)[2].([]any)[0])
+	deep, err := ReadFieldAt(ra, obj, "deep")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{[]any{[]any{"a"}, []any{"b", "c"}}, []any{[]any{}}}, deep)
+}
+
+func (s *NestedSuite) TestPrint() {
+	out := &strings.Builder{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write())))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `matrix (array(2)):
+    - (array(3)):
+        -1
+        -2
+        -3
+    - (array(1)):
+        --4
+`)
+}
+
+func (s *NestedSuite) TestRedact() {
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(s.write()), []Redaction{{Field: "name", Mode: RedactBlank}})
+	s.Require().Nil(err)
+	var actual nestedRepo
+	err = NewReader().ReadObject(bufio.NewReader(dst), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal("", actual.Name)
+	s.Assert().Equal(nestedData[0].Matrix, actual.Matrix)
+}
+
+func (s *NestedSuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		Groups [][]nestedPackage `rsf:"groups,index:name"`
+	}{})
+	s.Assert().EqualError(err, "array groups of arrays cannot be indexed")
+}
@@ -0,0 +1,225 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+
+When using `WithObjectTable`, `Finalize` writes a table of the offset and size
+of each top-level object following the last object, so readers can count the
+objects and jump to the Nth object without scanning the preceding objects. See
+`OpenObjectTable`.
+
+Like the digest trailer, the table begins with a zero object size, which
+readers treat as the end of the objects, and ends with its size and a magic
+value, so it can be found by reading the end of the file. When the file also
+has a digest trailer, the table precedes the digest trailer and is covered by
+the digest.
+
+Format:
+
+  [zero object size]                              // 4 bytes
+  [object count]                                  // 4 bytes
+  [object 1 offset]                               // 8 bytes
+  [object 1 size]                                 // 4 bytes
+  ...
+  [object n offset]
+  [object n size]
+  [table size]                                    // 4 bytes
+  [table magic]                                   // 4 bytes
+
+Example:
+
+  0x0, 0x0, 0x0, 0x0,                             // Zero object size
+  0x1, 0x0, 0x0, 0x0,                             // 1 object
+  0x2a, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,        // Object at offset 42
+  0x10, 0x0, 0x0, 0x0,                            // 16 bytes object size
+  0x1c, 0x0, 0x0, 0x0,                            // 28 bytes full table size
+  0x72, 0x73, 0x66, 0x4f,                         // "rsfO"
+
+*/
+
+// ObjectTableMagic identifies the end of an object table.
+var ObjectTableMagic = []byte{0x72, 0x73, 0x66, 0x4f}
+
+// ErrNoObjectTable is returned by `OpenObjectTable` when a file does not have
+// an object table.
+var ErrNoObjectTable = errors.New("object table not found")
+
+// The size of an object table entry, and of the table fields other than the
+// entries.
+const (
+	objectTableEntryLen = sizeInt64 + sizeFieldLen
+	objectTableFixedLen = sizeFieldLen * 4
+)
+
+// objectTableEntry records the position and full size of a top-level object.
+type objectTableEntry struct {
+	offset int64
+	size   int
+}
+
+// objectTableLen returns the size of an object table with `n` entries.
+func objectTableLen(n int) int {
+	return objectTableFixedLen + n*objectTableEntryLen
+}
+
+// WithObjectTable causes `Finalize` to write a table of the offset and size of
+// each top-level object, so that readers can use `OpenObjectTable` to
+// enumerate the objects of a file with several logical sections and jump to
+// the Nth object. Requires Version3 or later.
+func WithObjectTable() WriterOption {
+	return func(f *rsfWriter) {
+		f.flags |= FlagObjectTable
+	}
+}
+
+// writeObjectTable writes the object table, if needed. See `WithObjectTable`.
+func (f *rsfWriter) writeObjectTable() (int, error) {
+	if f.headerFlags&FlagObjectTable == 0 {
+		return 0, nil
+	}
+
+	buf := &bytes.Buffer{}
+	_, err := f.WriteSizeField(0, 0, buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.WriteSizeField(0, len(f.objects), buf)
+	if err != nil {
+		return 0, err
+	}
+	bs := make([]byte, sizeInt64)
+	for _, obj := range f.objects {
+		binary.LittleEndian.PutUint64(bs, uint64(obj.offset))
+		_, err = buf.Write(bs)
+		if err != nil {
+			return 0, err
+		}
+		_, err = f.WriteSizeField(0, obj.size, buf)
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = f.WriteSizeField(0, objectTableLen(len(f.objects)), buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = buf.Write(ObjectTableMagic)
+	if err != nil {
+		return 0, err
+	}
+
+	sz, err := io.Copy(f.writer, buf)
+	if err != nil {
+		return 0, err
+	}
+	return int(sz), nil
+}
+
+// ObjectTable lists the top-level objects of a file written with
+// `WithObjectTable`. See `OpenObjectTable`.
+type ObjectTable struct {
+	// A reference to the first object, which provides the index and header
+	// flags of the other objects.
+	first   ObjectRef
+	entries []objectTableEntry
+}
+
+// OpenObjectTable reads the index at the top of the RSF file `ra`, which is
+// `size` bytes long, and the object table at the end of the file.
+// `ErrNoObjectTable` is returned if the file was not written with
+// `WithObjectTable`. Reader options are used as with `OpenObject`.
+//
+//	table, err := OpenObjectTable(f, info.Size())
+//	obj, err := table.Object(2)
+//	val, err := ReadFieldAt(f, obj, "packages")
+func OpenObjectTable(ra io.ReaderAt, size int64, opts ...ReaderOption) (*ObjectTable, error) {
+	first, err := OpenObject(ra, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if first.Flags&FlagObjectTable == 0 {
+		return nil, ErrNoObjectTable
+	}
+
+	// Skip the file trailer, if any.
+	end := size
+	if first.Flags&(FlagDigest|FlagTrailer) != 0 {
+		sz, err := readTableFooter(ra, end, TrailerMagic, ErrNoTrailer)
+		if err != nil {
+			return nil, err
+		}
+		end -= int64(sz)
+	}
+
+	sz, err := readTableFooter(ra, end, ObjectTableMagic, ErrNoObjectTable)
+	if err != nil {
+		return nil, err
+	}
+	if sz < objectTableFixedLen || int64(sz) > end {
+		return nil, fmt.Errorf("invalid object table size %d", sz)
+	}
+	start := end - int64(sz)
+	bs := make([]byte, sz)
+	_, err = ra.ReadAt(bs, start)
+	if err != nil {
+		return nil, err
+	}
+	count := int(binary.LittleEndian.Uint32(bs[sizeFieldLen:]))
+	if binary.LittleEndian.Uint32(bs) != 0 || objectTableLen(count) != sz {
+		return nil, fmt.Errorf("invalid object table at position %d", start)
+	}
+
+	entries := make([]objectTableEntry, count)
+	off := sizeFieldLen * 2
+	for i := range entries {
+		entries[i].offset = int64(binary.LittleEndian.Uint64(bs[off:]))
+		entries[i].size = int(binary.LittleEndian.Uint32(bs[off+sizeInt64:]))
+		off += objectTableEntryLen
+		if entries[i].offset < first.Offset || entries[i].size < sizeFieldLen || entries[i].offset+int64(entries[i].size) > start {
+			return nil, fmt.Errorf("invalid object table entry %d", i)
+		}
+	}
+	return &ObjectTable{first: first, entries: entries}, nil
+}
+
+// readTableFooter reads the size at the end of a table that ends at `end` and
+// checks that it is followed by `magic`, or returns `errNotFound`.
+func readTableFooter(ra io.ReaderAt, end int64, magic []byte, errNotFound error) (int, error) {
+	if end < sizeFieldLen*2 {
+		return 0, errNotFound
+	}
+	bs := make([]byte, sizeFieldLen*2)
+	_, err := ra.ReadAt(bs, end-sizeFieldLen*2)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(bs[sizeFieldLen:], magic) {
+		return 0, errNotFound
+	}
+	return int(binary.LittleEndian.Uint32(bs)), nil
+}
+
+// Len returns the number of top-level objects.
+func (t *ObjectTable) Len() int {
+	return len(t.entries)
+}
+
+// Object returns a reference to the object at position `n`, starting from
+// zero, which can be read with `ReadFieldAt` or `NextObject`.
+func (t *ObjectTable) Object(n int) (ObjectRef, error) {
+	if n < 0 || n >= len(t.entries) {
+		return ObjectRef{}, fmt.Errorf("object %d out of range; file has %d objects", n, len(t.entries))
+	}
+	obj := t.first
+	obj.Offset = t.entries[n].offset
+	obj.Size = t.entries[n].size
+	return obj, nil
+}
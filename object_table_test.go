@@ -0,0 +1,132 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ObjectTableSuite struct {
+	suite.Suite
+}
+
+func TestObjectTableSuite(t *testing.T) {
+	suite.Run(t, &ObjectTableSuite{})
+}
+
+func (s *ObjectTableSuite) TestObjectTable() {
+	for _, opts := range [][]WriterOption{{WithObjectTable()}, {WithObjectTable(), WithDigest(), WithFieldOffsets()}} {
+		ra := writeStorePkgs(&s.Suite, storePkgs, opts...)
+		table, err := OpenObjectTable(ra, ra.Size())
+		s.Require().Nil(err)
+		s.Require().Equal(len(storePkgs), table.Len())
+
+		// The table matches the objects found by scanning the file.
+		scanned, err := OpenObject(ra)
+		s.Require().Nil(err)
+		for i, pkg := range storePkgs {
+			obj, err := table.Object(i)
+			s.Require().Nil(err)
+			s.Assert().Equal(scanned, obj)
+			name, err := ReadFieldAt(ra, obj, "name")
+			s.Require().Nil(err)
+			s.Assert().Equal(pkg.Name, name)
+			scanned, err = NextObject(ra, scanned)
+			if i < len(storePkgs)-1 {
+				s.Require().Nil(err)
+			} else {
+				s.Assert().Equal(io.EOF, err)
+			}
+		}
+
+		_, err = table.Object(len(storePkgs))
+		s.Assert().ErrorContains(err, "object 3 out of range; file has 3 objects")
+		_, err = table.Object(-1)
+		s.Assert().NotNil(err)
+	}
+
+	// The digest covers the object table.
+	ra := writeStorePkgs(&s.Suite, storePkgs, WithObjectTable(), WithDigest())
+	_, err := io.Copy(io.Discard, VerifyStream(io.NewSectionReader(ra, 0, ra.Size())))
+	s.Assert().Nil(err)
+}
+
+func (s *ObjectTableSuite) TestReader() {
+	// Readers stop at the object table.
+	ra := writeStorePkgs(&s.Suite, storePkgs, WithObjectTable())
+	r := NewReader()
+	src := io.NewSectionReader(ra, 0, ra.Size())
+	var pkgs []storePkg
+	for {
+		var pkg storePkg
+		err := r.ReadObject(src, &pkg)
+		if err == io.EOF {
+			break
+		}
+		s.Require().Nil(err)
+		pkgs = append(pkgs, pkg)
+	}
+	s.Assert().Equal(storePkgs, pkgs)
+
+	store, err := NewSnapshotStore(ra, "name")
+	s.Require().Nil(err)
+	s.Assert().Equal(3, store.Len())
+}
+
+func (s *ObjectTableSuite) TestRewrite() {
+	data := &bytes.Buffer{}
+	w := NewWriterWithVersion(data, Version3, WithObjectTable())
+	for _, pkg := range storePkgs {
+		_, err := w.WriteObject(pkg)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+
+	// Redacted files keep the object table.
+	dst := &bytes.Buffer{}
+	_, err = Redact(dst, bytes.NewReader(data.Bytes()), []Redaction{{Field: "name", Mode: RedactBlank}})
+	s.Require().Nil(err)
+	table, err := OpenObjectTable(bytes.NewReader(dst.Bytes()), int64(dst.Len()))
+	s.Require().Nil(err)
+	s.Assert().Equal(3, table.Len())
+	obj, err := table.Object(2)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(bytes.NewReader(dst.Bytes()), obj, "version")
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(storePkgs[2].Version), val)
+}
+
+func (s *ObjectTableSuite) TestErrors() {
+	ra := writeStorePkgs(&s.Suite, storePkgs)
+	_, err := OpenObjectTable(ra, ra.Size())
+	s.Assert().ErrorIs(err, ErrNoObjectTable)
+
+	// A truncated file has no object table.
+	ra = writeStorePkgs(&s.Suite, storePkgs, WithObjectTable())
+	_, err = OpenObjectTable(ra, ra.Size()-1)
+	s.Assert().ErrorIs(err, ErrNoObjectTable)
+
+	// A corrupt table is rejected.
+	data := make([]byte, ra.Size())
+	_, err = ra.ReadAt(data, 0)
+	s.Require().Nil(err)
+	data[len(data)-objectTableLen(3)+sizeFieldLen*2] = 0xff
+	_, err = OpenObjectTable(bytes.NewReader(data), int64(len(data)))
+	s.Assert().ErrorContains(err, "invalid object table entry 0")
+
+	// The table counts toward the size budget.
+	budget := int(writeStorePkgs(&s.Suite, storePkgs[:1], WithObjectTable()).Size())
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithObjectTable(), WithMaxSize(budget, nil))
+	_, err = w.WriteObject(storePkgs[0])
+	s.Require().Nil(err)
+	_, err = w.WriteObject(storePkgs[1])
+	s.Assert().ErrorAs(err, &ErrSizeBudgetExceeded{})
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+	s.Assert().Equal(budget, buf.Len())
+}
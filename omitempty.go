@@ -0,0 +1,78 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+/*
+
+Fields tagged with `omitempty` (e.g., `rsf:"notes,omitempty"`) are written like
+pointer fields: a one-byte presence marker, followed by the value when it is
+not empty. Empty values are false, zero numbers, empty strings, arrays, and
+maps, and zero structs. Empty values are read as the zero value of the field.
+Pointer fields are already optional, so `omitempty` has no effect on them.
+
+In the file index, the type of an omitempty field also includes the
+`fieldTypeOptional` bit. With Version2 and earlier, `omitempty` is ignored and
+values are always written. Index key, expiry, and tombstone fields cannot be
+omitted.
+
+Format:
+
+  [present]                                       // 1 byte
+  [value]                                         // Present only
+
+*/
+
+// useOmitEmpty marks the omitempty field with the tag `t` as optional in the
+// file index.
+func (f *rsfWriter) useOmitEmpty(t, tParent *tag) error {
+	if !t.omitEmpty {
+		return nil
+	}
+	if tParent.index == t.name || tParent.keyPos(t.name) >= 0 {
+		return fmt.Errorf("index key field %s cannot be omitempty", t.name)
+	}
+	if t.expires {
+		return fmt.Errorf("expires field %s cannot be omitempty", t.name)
+	}
+	if t.deleted {
+		return fmt.Errorf("deleted field %s cannot be omitempty", t.name)
+	}
+	if f.version < 3 {
+		t.omitEmpty = false
+		return nil
+	}
+	t.optional = true
+	return nil
+}
+
+// writeOmitEmpty writes the presence marker of an omitempty field, followed by
+// the value when it is not empty.
+func (f *rsfWriter) writeOmitEmpty(v reflect.Value, t *tag, buf *bytes.Buffer) (int, error) {
+	present := !isEmptyValue(v)
+	if present && f.canonical {
+		present = !canonicalEmpty(v)
+	}
+	sz, err := f.WriteBoolField(0, present, buf)
+	if err != nil || !present {
+		return sz, err
+	}
+	valSz, err := f.writeObject(v, t, buf)
+	if err != nil {
+		return 0, err
+	}
+	return sz + valSz, nil
+}
+
+// isEmptyValue returns true if `v` is omitted by `omitempty`.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,160 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OmitEmptySuite struct {
+	suite.Suite
+}
+
+func TestOmitEmptySuite(t *testing.T) {
+	suite.Run(t, &OmitEmptySuite{})
+}
+
+type omitEmptySnap struct {
+	Date  string `rsf:"date,fixed:10"`
+	Notes string `rsf:"notes,omitempty"`
+}
+
+type omitEmptyPkg struct {
+	Name      string            `rsf:"name"`
+	Notes     string            `rsf:"notes,omitempty"`
+	Downloads int64             `rsf:"downloads,omitempty"`
+	Score     float64           `rsf:"score,omitempty"`
+	Published time.Time         `rsf:"published,omitempty"`
+	Tags      []string          `rsf:"tags,omitempty"`
+	Labels    map[string]string `rsf:"labels,omitempty"`
+	License   *string           `rsf:"license,omitempty"`
+	Snapshots []omitEmptySnap   `rsf:"snapshots,index:date"`
+}
+
+var omitEmptyData = []omitEmptyPkg{
+	{
+		Name:      "ggplot2",
+		Notes:     "Plots",
+		Downloads: 42,
+		Score:     0.5,
+		Published: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Tags:      []string{"plots"},
+		Labels:    map[string]string{"topic": "graphics"},
+		License:   ptr(""),
+		Snapshots: []omitEmptySnap{
+			{Date: "2024-01-01", Notes: "Initial"},
+			{Date: "2023-01-01"},
+		},
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *OmitEmptySuite) write(version int) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, version)
+	for _, obj := range omitEmptyData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *OmitEmptySuite) TestReadObject() {
+	br := bufio.NewReader(bytes.NewReader(s.write(Version3)))
+	r := NewReader()
+	for _, expected := range omitEmptyData {
+		var actual omitEmptyPkg
+		err := r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+	s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+}
+
+func (s *OmitEmptySuite) TestSize() {
+	type fullPkg struct {
+		Name  string   `rsf:"name"`
+		Notes string   `rsf:"notes"`
+		Tags  []string `rsf:"tags"`
+	}
+	type omitPkg struct {
+		Name  string   `rsf:"name"`
+		Notes string   `rsf:"notes,omitempty"`
+		Tags  []string `rsf:"tags,omitempty"`
+	}
+	full, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(fullPkg{Name: "rlang"})
+	s.Require().Nil(err)
+	omit, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(omitPkg{Name: "rlang"})
+	s.Require().Nil(err)
+
+	// Each empty field is written as a one-byte marker
+	s.Assert().Less(omit, full)
+}
+
+func (s *OmitEmptySuite) TestIndex() {
+	index, err := IndexOf(omitEmptyPkg{})
+	s.Require().Nil(err)
+	s.Assert().False(index[0].Optional)
+	s.Assert().Equal(IndexEntry{FieldName: "notes", FieldType: FieldTypeVarStr, Optional: true}, index[1])
+	s.Assert().True(index[5].Optional)
+	s.Assert().True(index[7].Optional)
+	s.Assert().True(index[8].Subfields[1].Optional)
+
+	// Older versions always write values
+	type omitV2Pkg struct {
+		Name  string `rsf:"name"`
+		Notes string `rsf:"notes,omitempty"`
+	}
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version2).WriteObject(omitV2Pkg{Name: "rlang"})
+	s.Require().Nil(err)
+	br := bufio.NewReader(buf)
+	r := NewReader()
+	index, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().False(index[1].Optional)
+	var actual omitV2Pkg
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(omitV2Pkg{Name: "rlang"}, actual)
+}
+
+func (s *OmitEmptySuite) TestReadFieldAt() {
+	ra := bytes.NewReader(s.write(Version3))
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "downloads")
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(42), val)
+
+	obj, err = NextObject(ra, obj)
+	s.Require().Nil(err)
+	val, err = ReadFieldAt(ra, obj, "downloads")
+	s.Require().Nil(err)
+	s.Assert().Nil(val)
+	val, err = ReadFieldAt(ra, obj, "tags")
+	s.Require().Nil(err)
+	s.Assert().Nil(val)
+}
+
+func (s *OmitEmptySuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		Snapshots []struct {
+			Date string `rsf:"date,fixed:10,omitempty"`
+		} `rsf:"snapshots,index:date"`
+	}{})
+	s.Assert().EqualError(err, "index key field date cannot be omitempty")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		Snapshots []struct {
+			Expires int64 `rsf:"expires,expires,omitempty"`
+		} `rsf:"snapshots"`
+	}{})
+	s.Assert().EqualError(err, "expires field expires cannot be omitempty")
+}
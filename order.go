@@ -0,0 +1,124 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"sort"
+)
+
+/*
+
+The elements of an array are stored in the order written. Indexed struct arrays
+can also be read in the order of their index keys, so that consumers that
+compare or merge arrays, such as diff tools, do not depend on how each
+snapshot was written. The order is selected with `WithElementOrder` and applies
+to `ReadObject` and to each API that reads arrays from an `ObjectRef`, such as
+`ReadFieldAt`, `Select`, `ElementHandles`, `ElementHashes`, and `Pager`.
+
+Keys are compared as with `KeyRange`: strings by bytes and integers by value.
+Composite keys (e.g., `index:date+name`) are compared field by field. Elements
+with equal keys keep the order written, so the order is stable across reads.
+
+*/
+
+// ElementOrder determines the order in which array elements are returned.
+type ElementOrder int
+
+const (
+	// OrderWritten returns elements in the order they were written. This
+	// is the default.
+	OrderWritten ElementOrder = iota
+
+	// OrderKey returns the elements of indexed struct arrays in ascending
+	// order of their index keys. Other arrays are returned in the order
+	// written.
+	OrderKey
+)
+
+// WithElementOrder determines the order of array elements returned by
+// `ReadObject` and when reading objects opened with `OpenObject`. By default,
+// elements are returned in the order written.
+func WithElementOrder(order ElementOrder) ReaderOption {
+	return func(f *rsfReader) {
+		f.order = order
+	}
+}
+
+// sortElements sorts the elements of the array value `val` described by
+// `entry`, including elements of nested arrays, when using `OrderKey`.
+func sortElements(entry IndexEntry, val any, order ElementOrder) any {
+	vals, ok := val.([]any)
+	if order != OrderKey || entry.FieldType != FieldTypeArray || !ok || entry.Subfields == nil {
+		return val
+	}
+	for _, v := range vals {
+		el := elementFields(v)
+		for _, subfield := range entry.Subfields {
+			if subfield.FieldType == FieldTypeArray {
+				el[subfield.FieldName] = sortElements(subfield, el[subfield.FieldName], order)
+			}
+		}
+	}
+	if !entry.Indexed || len(entry.IndexKeys) == 0 {
+		return vals
+	}
+	sort.SliceStable(vals, func(i, j int) bool {
+		a, b := elementFields(vals[i]), elementFields(vals[j])
+		for _, key := range entry.IndexKeys {
+			if keyLess(a[key.FieldName], b[key.FieldName]) {
+				return true
+			} else if keyLess(b[key.FieldName], a[key.FieldName]) {
+				return false
+			}
+		}
+		return false
+	})
+	return vals
+}
+
+// elementFields returns the fields of a struct array element, which may be
+// wrapped by `DeletedFlag`.
+func elementFields(v any) map[string]any {
+	if deleted, ok := v.(DeletedElement); ok {
+		return deleted.Element
+	}
+	return v.(map[string]any)
+}
+
+// sortKeyed sorts `els`, which are the elements of the indexed array
+// described by `entry` with the index keys returned by `key`, when using
+// `OrderKey`.
+func sortKeyed[T any](entry IndexEntry, els []T, key func(T) any, order ElementOrder) error {
+	if order != OrderKey {
+		return nil
+	}
+	type keyed struct {
+		el    T
+		parts []any
+	}
+	keyedEls := make([]keyed, len(els))
+	for i, el := range els {
+		keyedEls[i] = keyed{el: el, parts: []any{key(el)}}
+		if len(entry.IndexKeys) > 1 {
+			var err error
+			keyedEls[i].parts, err = splitKey(entry.IndexKeys, key(el))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	sort.SliceStable(keyedEls, func(i, j int) bool {
+		a, b := keyedEls[i].parts, keyedEls[j].parts
+		for k := range a {
+			if keyLess(a[k], b[k]) {
+				return true
+			} else if keyLess(b[k], a[k]) {
+				return false
+			}
+		}
+		return false
+	})
+	for i, el := range keyedEls {
+		els[i] = el.el
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OrderSuite struct {
+	suite.Suite
+}
+
+func TestOrderSuite(t *testing.T) {
+	suite.Run(t, &OrderSuite{})
+}
+
+type orderDep struct {
+	Name string `rsf:"name,fixed:1"`
+}
+
+type orderRelease struct {
+	Date    string     `rsf:"date,skip,fixed:10"`
+	Version int64      `rsf:"version,skip"`
+	Deleted bool       `rsf:"deleted,deleted"`
+	Deps    []orderDep `rsf:"deps,index:name"`
+}
+
+type orderPkg struct {
+	Name     string         `rsf:"name"`
+	Tags     []string       `rsf:"tags"`
+	Releases []orderRelease `rsf:"releases,index:date+version"`
+	Versions []orderVersion `rsf:"versions,index:id"`
+}
+
+type orderVersion struct {
+	ID   int64  `rsf:"id"`
+	Name string `rsf:"name"`
+}
+
+var orderData = orderPkg{
+	Name: "ggplot2",
+	Tags: []string{"b", "a"},
+	Releases: []orderRelease{
+		{Date: "2023-02-01", Version: 1, Deps: []orderDep{{Name: "z"}, {Name: "a"}}},
+		{Date: "2023-01-01", Version: 5},
+		{Date: "2023-01-01", Version: -2, Deleted: true},
+	},
+	Versions: []orderVersion{{ID: 10, Name: "ten"}, {ID: 2, Name: "two"}, {ID: -1, Name: "minus one"}},
+}
+
+func (s *OrderSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, WithElementHashes()).WriteObject(orderData)
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+func (s *OrderSuite) TestReadFieldAt() {
+	data := s.write()
+	ra := bytes.NewReader(data)
+
+	// Elements are returned in the order written by default
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	handles, err := ElementHandles(ra, obj, "versions")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{int64(10), int64(2), int64(-1)}, []any{handles[0].Key, handles[1].Key, handles[2].Key})
+
+	obj, err = OpenObject(ra, WithElementOrder(OrderKey), WithDeleted(DeletedFlag))
+	s.Require().Nil(err)
+	handles, err = ElementHandles(ra, obj, "versions")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{int64(-1), int64(2), int64(10)}, []any{handles[0].Key, handles[1].Key, handles[2].Key})
+	hashes, err := ElementHashes(ra, obj, "versions")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{int64(-1), int64(2), int64(10)}, []any{hashes[0].Key, hashes[1].Key, hashes[2].Key})
+
+	// Composite keys are compared field by field, and nested arrays are
+	// sorted
+	releases, err := ReadFieldAt(ra, obj, "releases")
+	s.Require().Nil(err)
+	var keys []any
+	for _, el := range releases.([]any) {
+		fields := elementFields(el)
+		keys = append(keys, fields["date"], fields["version"])
+	}
+	s.Assert().Equal([]any{"2023-01-01", int64(-2), "2023-01-01", int64(5), "2023-02-01", int64(1)}, keys)
+	s.Assert().IsType(DeletedElement{}, releases.([]any)[0])
+	s.Assert().Equal([]any{map[string]any{"name": "a"}, map[string]any{"name": "z"}}, releases.([]any)[2].(map[string]any)["deps"])
+	handles, err = ElementHandles(ra, obj, "releases")
+	s.Require().Nil(err)
+	s.Assert().Len(handles, 3)
+	parts, err := splitKey(handles[1].entry.IndexKeys, handles[1].Key)
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{"2023-01-01", int64(5)}, parts)
+
+	// Arrays that are not indexed keep the order written
+	tags, err := ReadFieldAt(ra, obj, "tags")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{"b", "a"}, tags)
+
+	selected, err := Select(ra, obj, "versions", Field("id").Gt(0))
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{map[string]any{"id": int64(2), "name": "two"}, map[string]any{"id": int64(10), "name": "ten"}}, selected)
+
+	pager, err := NewPager[orderVersion](ra, obj, "versions")
+	s.Require().Nil(err)
+	page, next, err := pager.Page("0", 1)
+	s.Require().Nil(err)
+	s.Assert().Equal([]orderVersion{{ID: 2, Name: "two"}}, page)
+	s.Assert().Equal("2", next)
+}
+
+func (s *OrderSuite) TestReadObject() {
+	var pkg orderPkg
+	r := NewReader(WithElementOrder(OrderKey))
+	err := r.ReadObject(bufio.NewReader(bytes.NewReader(s.write())), &pkg)
+	s.Require().Nil(err)
+	s.Assert().Equal([]orderVersion{orderData.Versions[2], orderData.Versions[1], orderData.Versions[0]}, pkg.Versions)
+	s.Assert().Equal([]string{"b", "a"}, pkg.Tags)
+	s.Assert().Len(pkg.Releases, 2)
+	s.Assert().Equal(int64(5), pkg.Releases[0].Version)
+	s.Assert().Equal([]orderDep{{Name: "a"}, {Name: "z"}}, pkg.Releases[1].Deps)
+}
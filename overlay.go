@@ -0,0 +1,277 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Overlay serves lookups from a base `SnapshotStore` combined with an
+// in-memory set of added, updated, and deleted objects, which are matched to
+// the base objects by the store's key field. The base file is never
+// modified. Use `Flush` to write the merged objects to a new file.
+//
+//	overlay, err := NewOverlay(store)
+//	err = overlay.Put(pkg)
+//	err = overlay.Delete("rlang")
+//	pkg, err := overlay.Get("ggplot2")
+//	...
+//	_, err = overlay.Flush(NewWriterWithVersion(f, Version3))
+//
+// Objects are encoded when they are added, so they must have the same index
+// as the base file. The base store must not be reloaded while the overlay is
+// in use. An Overlay is safe for concurrent use.
+type Overlay struct {
+	base *SnapshotStore
+
+	// The base file index version and a reference used to read the
+	// objects in `edits`.
+	version int
+	ref     ObjectRef
+
+	// Guards `edits`, which records the object record of each added or
+	// updated key, or nil for a deleted key.
+	mu    sync.RWMutex
+	edits map[any][]byte
+}
+
+// NewOverlay creates an overlay with no edits over the store `base`.
+func NewOverlay(base *SnapshotStore) (*Overlay, error) {
+	st := base.acquire()
+	defer st.readers.Done()
+
+	s := NewStatelessReader(st.ra)
+	f, r := s.at(0)
+	for _, opt := range base.opts {
+		opt(f)
+	}
+	index, err := f.ReadIndex(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading base snapshot: %w", err)
+	}
+	return &Overlay{
+		base:    base,
+		version: f.indexVersion,
+		ref:     ObjectRef{Index: index, Flags: f.flags & (indexFlags | encodingFlags), Expiry: f.expiry, Deleted: f.deleted, Order: f.order},
+		edits:   make(map[any][]byte),
+	}, nil
+}
+
+// Put adds the object `v`, or replaces the object with the same key. `v`
+// must be a struct with the same index as the base file.
+func (o *Overlay) Put(v any) error {
+	record, err := o.encode(v)
+	if err != nil {
+		return err
+	}
+	ra := bytes.NewReader(record)
+	key, err := ReadFieldAt(ra, o.object(record), o.base.field)
+	if err != nil {
+		return fmt.Errorf("error reading key field %s: %w", o.base.field, err)
+	}
+
+	st := o.base.acquire()
+	defer st.readers.Done()
+	key, err = st.normalizeKey(key, o.base.field)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.edits[key] = record
+	return nil
+}
+
+// encode encodes `v` as an object record for the base file.
+func (o *Overlay) encode(v any) ([]byte, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot add non-struct type %v", t)
+	}
+
+	w := &rsfWriter{version: o.version, flags: o.ref.Flags, enc: flagsEncoding(o.ref.Flags)}
+	indexBuf := &bytes.Buffer{}
+	_, err := w.writeIndexObject(t, &tag{}, indexBuf)
+	if err != nil {
+		return nil, err
+	}
+	f := &rsfReader{indexVersion: o.version, flags: w.flags, enc: w.enc}
+	index, err := f.readIndexEntries(indexBuf, indexBuf.Len(), 0)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(index, o.ref.Index) {
+		return nil, fmt.Errorf("index of type %v does not match the base snapshot", t)
+	}
+
+	buf, _, err := w.encodeObject(v)
+	if err != nil {
+		return nil, err
+	}
+	record, err := w.encodeRecord(buf, nil)
+	if err != nil {
+		return nil, err
+	}
+	return record.Bytes(), nil
+}
+
+// object returns a reference to the encoded object record `record`.
+func (o *Overlay) object(record []byte) ObjectRef {
+	obj := o.ref
+	obj.Size = len(record)
+	return obj
+}
+
+// Delete deletes the object with the key `key`. `ErrKeyNotFound` is returned
+// if no object has the key.
+func (o *Overlay) Delete(key any) error {
+	st := o.base.acquire()
+	defer st.readers.Done()
+	key, err := st.normalizeKey(key, o.base.field)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	record, ok := o.edits[key]
+	if ok && record == nil || !ok && !st.contains(key) {
+		return fmt.Errorf("%w: %v", ErrKeyNotFound, key)
+	}
+	o.edits[key] = nil
+	return nil
+}
+
+// Get reads the object with the key `key` in the same form as
+// `SnapshotStore.Get`. Edited objects are read from memory, and other objects
+// are read from the base file. `ErrKeyNotFound` is returned if no object has
+// the key, or the object was deleted.
+func (o *Overlay) Get(key any) (map[string]any, error) {
+	st := o.base.acquire()
+	key, err := st.normalizeKey(key, o.base.field)
+	st.readers.Done()
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.RLock()
+	record, ok := o.edits[key]
+	o.mu.RUnlock()
+	if !ok {
+		return o.base.Get(key)
+	}
+	if record == nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyNotFound, key)
+	}
+	return readObjectAt(bytes.NewReader(record), o.object(record))
+}
+
+// Len returns the number of objects in the overlay.
+func (o *Overlay) Len() int {
+	st := o.base.acquire()
+	defer st.readers.Done()
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	n := len(st.keys)
+	for key, record := range o.edits {
+		inBase := st.contains(key)
+		if record != nil && !inBase {
+			n++
+		} else if record == nil && inBase {
+			n--
+		}
+	}
+	return n
+}
+
+// Flush writes the index of the base file to `dst`, followed by the merged
+// objects in ascending key order, but the file is not finalized. `dst` must be
+// a new Writer returned by `NewWriterWithVersion` with the same version and
+// encoding (see `WithByteOrder` and `WithVarints`) as the base file. Objects
+// that were not edited are copied from the base file without decoding them. The
+// edits are kept, so the overlay can continue to be used.
+func (o *Overlay) Flush(dst Writer) (int, error) {
+	w, ok := dst.(*rsfWriter)
+	if !ok {
+		return 0, fmt.Errorf("cannot flush overlay to %T", dst)
+	}
+	if w.pos != 0 {
+		return 0, errors.New("cannot flush overlay to a writer that has written objects")
+	}
+	err := w.checkWritable()
+	if err != nil {
+		return 0, err
+	}
+	if w.version != o.version {
+		return 0, fmt.Errorf("writer version %d does not match base snapshot version %d", w.version, o.version)
+	}
+	if w.flags&encodingFlags != o.ref.Flags&encodingFlags {
+		return 0, errors.New("writer encoding does not match base snapshot encoding")
+	}
+
+	st := o.base.acquire()
+	defer st.readers.Done()
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	w.flags |= o.ref.Flags
+	totalSz, err := w.writeIndexRecord(func(buf *bytes.Buffer) (int, error) {
+		err := w.writeIndexEntries(o.ref.Index, w.version, buf)
+		return buf.Len(), err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Merge the base keys with the added keys.
+	var added []any
+	for key, record := range o.edits {
+		if record != nil && !st.contains(key) {
+			added = append(added, key)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool {
+		return keyLess(added[i], added[j])
+	})
+	var i, j int
+	for i < len(st.keys) || j < len(added) {
+		var data []byte
+		if j == len(added) || i < len(st.keys) && keyLess(st.keys[i], added[j]) {
+			record, ok := o.edits[st.keys[i]]
+			if ok && record == nil {
+				i++
+				continue
+			}
+			if ok {
+				data = record[sizeFieldLen:]
+			} else {
+				data, err = objectData(st.ra, st.objects[i])
+				if err != nil {
+					return 0, err
+				}
+			}
+			i++
+		} else {
+			data = o.edits[added[j]][sizeFieldLen:]
+			j++
+		}
+		sz, err := w.writeObjectData(o.ref.Index, data)
+		if err != nil {
+			return 0, err
+		}
+		totalSz += sz
+	}
+	return totalSz, nil
+}
+
+// contains returns true if the file has an object with the key `key`.
+func (st *storeState) contains(key any) bool {
+	i := st.search(key)
+	return i < len(st.keys) && st.keys[i] == key
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OverlaySuite struct {
+	suite.Suite
+}
+
+func TestOverlaySuite(t *testing.T) {
+	suite.Run(t, &OverlaySuite{})
+}
+
+func (s *OverlaySuite) overlay(opts ...WriterOption) *Overlay {
+	store, err := NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs, opts...), "name")
+	s.Require().Nil(err)
+	overlay, err := NewOverlay(store)
+	s.Require().Nil(err)
+	return overlay
+}
+
+func (s *OverlaySuite) TestGet() {
+	overlay := s.overlay()
+	s.Require().Nil(overlay.Put(storePkg{Name: "dplyr", Version: 5}))
+	s.Require().Nil(overlay.Put(storePkg{Name: "tidyr", Version: 4}))
+	s.Require().Nil(overlay.Delete("plyr"))
+	s.Assert().Equal(3, overlay.Len())
+
+	pkg, err := overlay.Get("dplyr")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{"name": "dplyr", "version": int64(5)}, pkg)
+	pkg, err = overlay.Get("tidyr")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{"name": "tidyr", "version": int64(4)}, pkg)
+	pkg, err = overlay.Get("ggplot2")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{"name": "ggplot2", "version": int64(2)}, pkg)
+	_, err = overlay.Get("plyr")
+	s.Assert().ErrorIs(err, ErrKeyNotFound)
+
+	// Deleted objects can be added again
+	err = overlay.Delete("plyr")
+	s.Assert().ErrorIs(err, ErrKeyNotFound)
+	s.Require().Nil(overlay.Put(storePkg{Name: "plyr", Version: 6}))
+	s.Assert().Equal(4, overlay.Len())
+	s.Require().Nil(overlay.Delete("tidyr"))
+	s.Assert().Equal(3, overlay.Len())
+}
+
+func (s *OverlaySuite) TestFlush() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldOffsets(), WithFieldHashes()},
+		{Chain(Zstd())},
+	} {
+		overlay := s.overlay(opts...)
+		s.Require().Nil(overlay.Put(storePkg{Name: "dplyr", Version: 5}))
+		s.Require().Nil(overlay.Put(storePkg{Name: "tidyr", Version: 4}))
+		s.Require().Nil(overlay.Put(storePkg{Name: "abind", Version: 7}))
+		s.Require().Nil(overlay.Delete("plyr"))
+
+		buf := &bytes.Buffer{}
+		w := NewWriterWithVersion(buf, Version3, opts...)
+		_, err := overlay.Flush(w)
+		s.Require().Nil(err)
+		_, err = w.Finalize()
+		s.Require().Nil(err)
+
+		// Objects are written in key order
+		br := bufio.NewReader(buf)
+		r := NewReader()
+		var actual []storePkg
+		for {
+			var pkg storePkg
+			err = r.ReadObject(br, &pkg)
+			if err == io.EOF {
+				break
+			}
+			s.Require().Nil(err)
+			actual = append(actual, pkg)
+		}
+		s.Assert().Equal([]storePkg{
+			{Name: "abind", Version: 7},
+			{Name: "dplyr", Version: 5},
+			{Name: "ggplot2", Version: 2},
+			{Name: "tidyr", Version: 4},
+		}, actual)
+	}
+}
+
+func (s *OverlaySuite) TestErrors() {
+	overlay := s.overlay()
+	err := overlay.Put(struct {
+		Name string `rsf:"name"`
+	}{Name: "rlang"})
+	s.Assert().EqualError(err, "index of type struct { Name string \"rsf:\\\"name\\\"\" } does not match the base snapshot")
+	err = overlay.Put("rlang")
+	s.Assert().EqualError(err, "cannot add non-struct type string")
+	err = overlay.Delete(1)
+	s.Assert().EqualError(err, "invalid key type int64 for key field name")
+
+	_, err = overlay.Flush(NewWriterWithVersion(&bytes.Buffer{}, Version2))
+	s.Assert().EqualError(err, "writer version 2 does not match base snapshot version 3")
+}
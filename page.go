@@ -0,0 +1,154 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Pager serves keyset pagination over a top-level indexed struct array, e.g.,
+// for REST endpoints backed by rsf files. Pages are located with the array
+// index, and only the elements of each page are read.
+//
+//	pager, err := NewPager[Package](ra, obj, "packages")
+//	pkgs, next, err := pager.Page(r.URL.Query().Get("after"), 100)
+//
+// Page keys are the element keys from the array index, formatted as strings,
+// so a page can be requested by passing the key returned with the previous
+// page. Since pages are located by key rather than by position, paging is
+// consistent when clients page through different snapshots of the same array.
+// A Pager is safe for concurrent use.
+type Pager[T any] struct {
+	obj     ObjectRef
+	field   string
+	handles []ElementHandle
+
+	// When the array keys are in ascending order, a page may begin after a
+	// key that is not in the array. Otherwise, `positions` locates the key.
+	sorted    bool
+	positions map[any]int
+}
+
+// NewPager reads the index of the top-level indexed struct array `field` of the
+// object `obj`. The element keys must be strings or integers; composite keys
+// are not supported. Expired and deleted elements are omitted from pages as
+// with `ReadFieldAt`.
+func NewPager[T any](ra io.ReaderAt, obj ObjectRef, field string) (*Pager[T], error) {
+	handles, err := ElementHandles(ra, obj, field)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pager[T]{obj: obj, field: field, handles: handles, sorted: true}
+	if len(handles) > 0 {
+		entry := handles[0].entry
+		if len(entry.IndexKeys) > 1 {
+			return nil, fmt.Errorf("cannot page array %s with a composite key", field)
+		}
+	}
+	for i := 1; i < len(handles) && p.sorted; i++ {
+		p.sorted = keyLess(handles[i-1].Key, handles[i].Key)
+	}
+	if !p.sorted {
+		p.positions = make(map[any]int, len(handles))
+		for i, handle := range handles {
+			p.positions[handle.Key] = i
+		}
+	}
+	return p, nil
+}
+
+// Len returns the number of elements in the array, including expired and
+// deleted elements.
+func (p *Pager[T]) Len() int {
+	return len(p.handles)
+}
+
+// Page reads up to `limit` elements that follow the element with the key
+// `afterKey`, in the order of `ElementHandles`, or the first elements if
+// `afterKey` is empty. The key of the last element is returned as the key of
+// the next page, or an empty key if no elements remain, so the last page may be
+// empty when the remaining elements are expired or deleted. When the array keys
+// are in ascending order, such as with `OrderKey`, the page begins with the
+// first key greater than `afterKey`, even if `afterKey` is not in the array.
+// Otherwise, an error wrapping `ErrNoSuchElement` is returned if no element has
+// the key.
+func (p *Pager[T]) Page(afterKey string, limit int) ([]T, string, error) {
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("invalid page limit %d", limit)
+	}
+	start, err := p.start(afterKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var page []T
+	i := start
+	for ; i < len(p.handles) && len(page) < limit; i++ {
+		handle := p.handles[i]
+		el, err := handle.Read()
+		if err != nil {
+			return nil, "", err
+		}
+		kept, _ := p.obj.filter(handle.entry, []any{el}).([]any)
+		if len(kept) == 0 {
+			continue
+		}
+		var v T
+		err = setValue(reflect.ValueOf(&v).Elem(), kept[0])
+		if err != nil {
+			return nil, "", fmt.Errorf("array %s key %v: %w", p.field, handle.Key, err)
+		}
+		page = append(page, v)
+	}
+	if i == len(p.handles) {
+		return page, "", nil
+	}
+	return page, formatPageKey(p.handles[i-1].Key), nil
+}
+
+// start returns the position of the first element after `afterKey`.
+func (p *Pager[T]) start(afterKey string) (int, error) {
+	if afterKey == "" || len(p.handles) == 0 {
+		return 0, nil
+	}
+	key, err := parsePageKey(afterKey, p.handles[0].Key)
+	if err != nil {
+		return 0, err
+	}
+	if p.sorted {
+		return sort.Search(len(p.handles), func(i int) bool {
+			return keyLess(key, p.handles[i].Key)
+		}), nil
+	}
+	i, ok := p.positions[key]
+	if !ok {
+		return 0, fmt.Errorf("array %s key %v: %w", p.field, key, ErrNoSuchElement)
+	}
+	return i + 1, nil
+}
+
+// formatPageKey formats an array key as a page key.
+func formatPageKey(key any) string {
+	switch key := key.(type) {
+	case int64:
+		return strconv.FormatInt(key, 10)
+	default:
+		return key.(string)
+	}
+}
+
+// parsePageKey parses a page key with the same type as the array key
+// `example`.
+func parsePageKey(s string, example any) (any, error) {
+	if _, ok := example.(int64); !ok {
+		return s, nil
+	}
+	key, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page key %q: %w", s, err)
+	}
+	return key, nil
+}
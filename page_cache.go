@@ -0,0 +1,293 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrNoPageCache is returned by `SnapshotStore.Pin` when the store does not
+// read its file through a `PageCache`.
+var ErrNoPageCache = errors.New("store does not read through a page cache")
+
+// PageCache wraps an io.ReaderAt, such as a client for network storage, and
+// caches the file in fixed-size pages, so that repeated reads of the same
+// ranges, such as the file index, are served from memory. Up to `capacity`
+// pages are kept, and the least recently used page is evicted first.
+//
+// Services can warm the cache at startup, so that the first requests after a
+// deploy do not wait for cold reads: `WarmIndex` pins the pages of the file
+// header and index, `Warm` loads a range without pinning it, and `Pin` keeps
+// the pages of a range, such as a hot key range of a `SnapshotStore`, in the
+// cache until they are unpinned. Pinned pages do not count towards the
+// capacity.
+//
+// A PageCache is safe for concurrent use provided that the underlying
+// io.ReaderAt is also safe for concurrent use.
+type PageCache struct {
+	ra       io.ReaderAt
+	pageSize int64
+	capacity int
+
+	// Guards the cached pages and the request count.
+	mu       sync.Mutex
+	pages    map[int64]*cachePage
+	lru      *list.List
+	requests int
+}
+
+// cachePage records the data of a cached page. Unpinned pages are also kept
+// in the LRU list, with the most recently used page at the front.
+type cachePage struct {
+	num  int64
+	data []byte
+	pins int
+	elem *list.Element
+}
+
+// NewPageCache creates a PageCache that reads from `ra` in pages of
+// `pageSize` bytes, and keeps up to `capacity` unpinned pages.
+func NewPageCache(ra io.ReaderAt, pageSize, capacity int) *PageCache {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	return &PageCache{
+		ra:       ra,
+		pageSize: int64(pageSize),
+		capacity: capacity,
+		pages:    make(map[int64]*cachePage),
+		lru:      list.New(),
+	}
+}
+
+// The page size used when `NewPageCache` is given a size of zero.
+const defaultPageSize = 64 * 1024
+
+func (c *PageCache) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("invalid offset %d", off)
+	}
+	pages, err := c.load(off, int64(len(p)), 0)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, page := range pages {
+		start := off + int64(n) - page.num*c.pageSize
+		if start >= int64(len(page.data)) {
+			break
+		}
+		n += copy(p[n:], page.data[start:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Warm loads the pages of the range of `length` bytes at `off` into the cache
+// without pinning them.
+func (c *PageCache) Warm(off, length int64) error {
+	_, err := c.load(off, length, 0)
+	return err
+}
+
+// Pin loads the pages of the range of `length` bytes at `off` into the cache
+// and keeps them until they are unpinned with `Unpin`. Pages pinned more than
+// once must be unpinned as many times.
+func (c *PageCache) Pin(off, length int64) error {
+	_, err := c.load(off, length, 1)
+	return err
+}
+
+// Unpin releases the pages of a range pinned with `Pin`, which can then be
+// evicted.
+func (c *PageCache) Unpin(off, length int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	first, last := c.pageRange(off, length)
+	for num := first; num <= last; num++ {
+		page, ok := c.pages[num]
+		if !ok || page.pins == 0 {
+			continue
+		}
+		page.pins--
+		if page.pins == 0 {
+			page.elem = c.lru.PushFront(page)
+		}
+	}
+	c.evict()
+}
+
+// WarmIndex reads the file header and index through the cache and pins their
+// pages, so that opening the file with `OpenObject` is served from memory. It
+// returns a reference to the first object in the file. Reader options, such as
+// `WithLayers`, are used when reading the index.
+func (c *PageCache) WarmIndex(opts ...ReaderOption) (ObjectRef, error) {
+	obj, err := OpenObject(c, opts...)
+	if err != nil {
+		return ObjectRef{}, err
+	}
+	err = c.Pin(0, obj.Offset)
+	if err != nil {
+		return ObjectRef{}, err
+	}
+	return obj, nil
+}
+
+// Requests returns the number of reads issued to the wrapped reader.
+func (c *PageCache) Requests() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests
+}
+
+// Pinned returns the number of pinned pages.
+func (c *PageCache) Pinned() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pages) - c.lru.Len()
+}
+
+// pageRange returns the first and last page of the range of `length` bytes at
+// `off`.
+func (c *PageCache) pageRange(off, length int64) (int64, int64) {
+	if length <= 0 {
+		length = 1
+	}
+	return off / c.pageSize, (off + length - 1) / c.pageSize
+}
+
+// load returns the pages of the range of `length` bytes at `off`, reading the
+// missing pages from the wrapped reader with a single request, and adds `pins`
+// to the pin count of each page. Pages past the end of the file are omitted.
+func (c *PageCache) load(off, length int64, pins int) ([]*cachePage, error) {
+	first, last := c.pageRange(off, length)
+	if pages, ok := c.cached(first, last, pins); ok {
+		return pages, nil
+	}
+
+	buf := make([]byte, (last-first+1)*c.pageSize)
+	n, err := c.ra.ReadAt(buf, first*c.pageSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	pages := make([]*cachePage, 0, last-first+1)
+	for num := first; num <= last && len(buf) > 0; num++ {
+		sz := c.pageSize
+		if int64(len(buf)) < sz {
+			sz = int64(len(buf))
+		}
+		page, ok := c.pages[num]
+		if !ok {
+			page = &cachePage{num: num, data: buf[:sz:sz]}
+			c.pages[num] = page
+			page.elem = c.lru.PushFront(page)
+		}
+		c.use(page, pins)
+		pages = append(pages, page)
+		buf = buf[sz:]
+	}
+	c.evict()
+	return pages, nil
+}
+
+// cached returns the pages from `first` to `last` if they are all cached, and
+// adds `pins` to the pin count of each page. The last page of the file may
+// end before `last`.
+func (c *PageCache) cached(first, last int64, pins int) ([]*cachePage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pages := make([]*cachePage, 0, last-first+1)
+	for num := first; num <= last; num++ {
+		page, ok := c.pages[num]
+		if !ok {
+			return nil, false
+		}
+		pages = append(pages, page)
+		if int64(len(page.data)) < c.pageSize {
+			// The page is the last page of the file.
+			break
+		}
+	}
+	for _, page := range pages {
+		c.use(page, pins)
+	}
+	return pages, true
+}
+
+// use marks `page` as recently used and adds `pins` to its pin count. Pinned
+// pages are removed from the LRU list.
+func (c *PageCache) use(page *cachePage, pins int) {
+	page.pins += pins
+	if page.pins > 0 {
+		if page.elem != nil {
+			c.lru.Remove(page.elem)
+			page.elem = nil
+		}
+		return
+	}
+	c.lru.MoveToFront(page.elem)
+}
+
+// evict removes the least recently used unpinned pages until at most
+// `capacity` unpinned pages remain.
+func (c *PageCache) evict() {
+	for c.lru.Len() > c.capacity {
+		page := c.lru.Remove(c.lru.Back()).(*cachePage)
+		delete(c.pages, page.num)
+	}
+}
+
+// Pin pins the pages of the objects with keys from `from`, inclusive, to
+// `to`, exclusive, in the `PageCache` that the store reads from, so that
+// lookups of hot keys are served from memory. `ErrNoPageCache` is returned if
+// the store was not created with a PageCache. Pins apply to the current file,
+// and are dropped along with the cache when the file is replaced.
+func (s *SnapshotStore) Pin(from, to any) error {
+	return s.pinRange(from, to, func(c *PageCache, obj ObjectRef) error {
+		return c.Pin(obj.Offset, int64(obj.Size))
+	})
+}
+
+// Unpin releases the pages of a key range pinned with `Pin`.
+func (s *SnapshotStore) Unpin(from, to any) error {
+	return s.pinRange(from, to, func(c *PageCache, obj ObjectRef) error {
+		c.Unpin(obj.Offset, int64(obj.Size))
+		return nil
+	})
+}
+
+// pinRange calls `fn` with the page cache of the store and each object with a
+// key from `from`, inclusive, to `to`, exclusive.
+func (s *SnapshotStore) pinRange(from, to any, fn func(c *PageCache, obj ObjectRef) error) error {
+	st := s.acquire()
+	defer st.readers.Done()
+
+	c, ok := st.ra.(*PageCache)
+	if !ok {
+		return ErrNoPageCache
+	}
+	objects, err := st.between(from, to, s.field)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		err = fn(c, obj)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PageCacheSuite struct {
+	suite.Suite
+}
+
+func TestPageCacheSuite(t *testing.T) {
+	suite.Run(t, &PageCacheSuite{})
+}
+
+func (s *PageCacheSuite) TestReadAt() {
+	data := []byte("0123456789")
+	counted := &countingReaderAt{ra: bytes.NewReader(data)}
+	c := NewPageCache(counted, 4, 2)
+
+	// Reads spanning pages are fetched with one request
+	p := make([]byte, 5)
+	n, err := c.ReadAt(p, 2)
+	s.Require().Nil(err)
+	s.Assert().Equal("23456", string(p[:n]))
+	s.Assert().Equal(1, c.Requests())
+	s.Assert().Equal(int64(1), counted.reads.Load())
+
+	// Cached pages are served without a request
+	n, err = c.ReadAt(p[:3], 4)
+	s.Require().Nil(err)
+	s.Assert().Equal("456", string(p[:n]))
+	s.Assert().Equal(1, c.Requests())
+
+	// Reads past the end return io.EOF
+	n, err = c.ReadAt(p, 8)
+	s.Assert().Equal(io.EOF, err)
+	s.Assert().Equal("89", string(p[:n]))
+	n, err = c.ReadAt(p, 20)
+	s.Assert().Equal(io.EOF, err)
+	s.Assert().Equal(0, n)
+
+	// The least recently used page was evicted
+	s.Require().Nil(c.Warm(0, 1))
+	requests := c.Requests()
+	_, err = c.ReadAt(p[:1], 8)
+	s.Require().Nil(err)
+	s.Assert().Equal(requests, c.Requests())
+	_, err = c.ReadAt(p[:1], 4)
+	s.Require().Nil(err)
+	s.Assert().Equal(requests+1, c.Requests())
+
+	// Errors are returned
+	c = NewPageCache(failingReaderAt{}, 4, 2)
+	_, err = c.ReadAt(p, 0)
+	s.Assert().EqualError(err, "unavailable")
+}
+
+func (s *PageCacheSuite) TestPin() {
+	data := []byte("0123456789")
+	c := NewPageCache(bytes.NewReader(data), 2, 0)
+
+	// Unpinned pages are not kept with a capacity of zero
+	s.Require().Nil(c.Warm(0, 2))
+	s.Assert().Equal(0, c.Pinned())
+
+	s.Require().Nil(c.Pin(1, 4))
+	s.Require().Nil(c.Pin(2, 1))
+	s.Assert().Equal(3, c.Pinned())
+	requests := c.Requests()
+	p := make([]byte, 5)
+	_, err := c.ReadAt(p, 0)
+	s.Require().Nil(err)
+	s.Assert().Equal("01234", string(p))
+	s.Assert().Equal(requests, c.Requests())
+
+	// Pages pinned twice must be unpinned twice
+	c.Unpin(1, 4)
+	s.Assert().Equal(1, c.Pinned())
+	c.Unpin(2, 1)
+	s.Assert().Equal(0, c.Pinned())
+	_, err = c.ReadAt(p, 0)
+	s.Require().Nil(err)
+	s.Assert().Equal(requests+1, c.Requests())
+}
+
+func (s *PageCacheSuite) TestWarmIndex() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range testComplexData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	counted := &countingReaderAt{ra: bytes.NewReader(buf.Bytes())}
+	c := NewPageCache(counted, 64, 0)
+	obj, err := c.WarmIndex()
+	s.Require().Nil(err)
+	s.Assert().Positive(c.Pinned())
+
+	// Opening the file again is served from the pinned pages
+	counted.reads.Store(0)
+	reopened, err := OpenObject(c)
+	s.Require().Nil(err)
+	s.Assert().Equal(obj, reopened)
+	s.Assert().Zero(counted.reads.Load())
+
+	_, err = NewPageCache(bytes.NewReader(nil), 64, 0).WarmIndex()
+	s.Assert().Equal(io.EOF, err)
+}
+
+func (s *PageCacheSuite) TestStorePin() {
+	counted := &countingReaderAt{ra: writeStorePkgs(&s.Suite, storePkgs)}
+	c := NewPageCache(counted, 16, 0)
+	store, err := NewSnapshotStore(c, "name")
+	s.Require().Nil(err)
+	s.Require().Nil(store.Pin("dplyr", "h"))
+
+	// Lookups of pinned keys are served from memory
+	counted.reads.Store(0)
+	pkgs, err := store.Range("dplyr", "h")
+	s.Require().Nil(err)
+	s.Assert().Len(pkgs, 2)
+	s.Assert().Zero(counted.reads.Load())
+	_, err = store.Get("plyr")
+	s.Require().Nil(err)
+	s.Assert().Positive(counted.reads.Load())
+
+	s.Require().Nil(store.Unpin("dplyr", "h"))
+	s.Assert().Zero(c.Pinned())
+	s.Assert().EqualError(store.Pin(1, 2), "invalid key type int64 for key field name")
+
+	store, err = NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs), "name")
+	s.Require().Nil(err)
+	s.Assert().ErrorIs(store.Pin("a", "z"), ErrNoPageCache)
+}
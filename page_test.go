@@ -0,0 +1,115 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PageSuite struct {
+	suite.Suite
+}
+
+func TestPageSuite(t *testing.T) {
+	suite.Run(t, &PageSuite{})
+}
+
+type pageRelease struct {
+	ID   int64  `rsf:"id"`
+	Name string `rsf:"name"`
+}
+
+type pageProject struct {
+	Releases []pageRelease `rsf:"releases,index:id"`
+}
+
+func (s *PageSuite) open(v any, opts ...ReaderOption) (*bytes.Reader, ObjectRef) {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(v)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra, opts...)
+	s.Require().Nil(err)
+	return ra, obj
+}
+
+func (s *PageSuite) TestPage() {
+	ra, obj := s.open(channelObject{Items: channelItems})
+	pager, err := NewPager[channelItem](ra, obj, "items")
+	s.Require().Nil(err)
+	s.Assert().Equal(3, pager.Len())
+
+	page, next, err := pager.Page("", 2)
+	s.Require().Nil(err)
+	s.Assert().Equal(channelItems[:2], page)
+	s.Assert().Equal("def", next)
+	page, next, err = pager.Page(next, 2)
+	s.Require().Nil(err)
+	s.Assert().Equal(channelItems[2:], page)
+	s.Assert().Equal("", next)
+
+	// Since the keys are sorted, pages can begin after a key that is not in
+	// the array, e.g., one that was removed from a later snapshot.
+	page, next, err = pager.Page("bcd", 1)
+	s.Require().Nil(err)
+	s.Assert().Equal(channelItems[1:2], page)
+	s.Assert().Equal("def", next)
+	page, next, err = pager.Page("zzz", 1)
+	s.Require().Nil(err)
+	s.Assert().Empty(page)
+	s.Assert().Equal("", next)
+
+	_, _, err = pager.Page("", 0)
+	s.Assert().ErrorContains(err, "invalid page limit 0")
+}
+
+func (s *PageSuite) TestIntKeys() {
+	project := pageProject{Releases: []pageRelease{{ID: 1, Name: "one"}, {ID: 5, Name: "five"}, {ID: 10, Name: "ten"}}}
+	ra, obj := s.open(project)
+	pager, err := NewPager[pageRelease](ra, obj, "releases")
+	s.Require().Nil(err)
+
+	page, next, err := pager.Page("", 2)
+	s.Require().Nil(err)
+	s.Assert().Equal(project.Releases[:2], page)
+	s.Assert().Equal("5", next)
+	page, next, err = pager.Page("6", 2)
+	s.Require().Nil(err)
+	s.Assert().Equal(project.Releases[2:], page)
+	s.Assert().Equal("", next)
+
+	_, _, err = pager.Page("five", 2)
+	s.Assert().ErrorContains(err, `invalid page key "five"`)
+}
+
+func (s *PageSuite) TestUnsorted() {
+	// Expired elements are omitted, and the keys are not sorted.
+	ra, obj := s.open(expiryBuild, WithExpiry(expiryNow))
+	pager, err := NewPager[artifact](ra, obj, "artifacts")
+	s.Require().Nil(err)
+
+	page, next, err := pager.Page("", 2)
+	s.Require().Nil(err)
+	s.Assert().Equal([]artifact{expiryBuild.Artifacts[0], expiryBuild.Artifacts[3]}, page)
+	s.Assert().Equal("", next)
+	page, next, err = pager.Page("", 1)
+	s.Require().Nil(err)
+	s.Assert().Equal(expiryBuild.Artifacts[:1], page)
+	s.Assert().Equal("bin", next)
+	page, next, err = pager.Page(next, 1)
+	s.Require().Nil(err)
+	s.Assert().Equal(expiryBuild.Artifacts[3:], page)
+	s.Assert().Equal("", next)
+
+	_, _, err = pager.Page("abc", 2)
+	s.Assert().ErrorIs(err, ErrNoSuchElement)
+}
+
+func (s *PageSuite) TestErrors() {
+	ra, obj := s.open(channelObjectNoIndex{Items: channelItems})
+	_, err := NewPager[channelItem](ra, obj, "items")
+	s.Assert().ErrorContains(err, "not an indexed struct array")
+}
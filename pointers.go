@@ -0,0 +1,78 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+/*
+
+A pointer field (e.g., `*string` or `*snap`) is written as a one-byte presence
+marker, followed by the value when the pointer is not nil, so that nil and zero
+values can be distinguished. Pointers to structs with a tag name are written as
+sub-records. See `FieldTypeStruct`. With a Reader, use `ReadBoolField` to read
+the presence marker before reading the value.
+
+In the file index, a pointer field is described by the entry of the value it
+points to, and its type also includes the `fieldTypeOptional` bit. Requires
+Version3 or later.
+
+Format:
+
+  [present]                                       // 1 byte
+  [value]                                         // Present only
+
+*/
+
+// fieldTypeOptional is set in the index field type of a pointer field.
+const fieldTypeOptional = 1 << 9
+
+func (f *rsfWriter) writeIndexPointer(v reflect.Type, t *tag, buf *bytes.Buffer) (int, error) {
+	if f.version < 3 {
+		return 0, fmt.Errorf("pointer field %s requires version 3 or later", t.name)
+	}
+	if v.Elem().Kind() == reflect.Pointer {
+		return 0, fmt.Errorf("pointer field %s cannot point to a pointer", t.name)
+	}
+	t.optional = true
+	return f.writeIndexObject(v.Elem(), t, buf)
+}
+
+func (f *rsfWriter) writePointer(v reflect.Value, t *tag, buf *bytes.Buffer) (int, error) {
+	sz, err := f.WriteBoolField(0, !v.IsNil(), buf)
+	if err != nil || v.IsNil() {
+		return sz, err
+	}
+	valSz, err := f.writeObject(v.Elem(), t, buf)
+	if err != nil {
+		return 0, err
+	}
+	return sz + valSz, nil
+}
+
+// readPresence reads the presence marker of an optional value. See
+// `fieldTypeOptional`.
+func (s *StatelessReader) readPresence(entry IndexEntry, off int64) (bool, int64, error) {
+	if !entry.Optional {
+		return true, off, nil
+	}
+	return s.ReadBoolField(off)
+}
+
+func printPointer(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	present, err := reader.ReadBoolField(r)
+	if err != nil {
+		return fmt.Errorf("error reading presence of field %s: %s", f.FieldName, err)
+	}
+	if !present {
+		_, err = fmt.Fprintf(w, "%s%s: nil\n", strings.Repeat(" ", indent*4), f.FieldName)
+		return err
+	}
+	f.Optional = false
+	return printField(parentKey, f, w, r, reader, indent)
+}
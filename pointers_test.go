@@ -0,0 +1,185 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PointersSuite struct {
+	suite.Suite
+}
+
+func TestPointersSuite(t *testing.T) {
+	suite.Run(t, &PointersSuite{})
+}
+
+type pointerSnap struct {
+	Date    string  `rsf:"date,fixed:10"`
+	Summary *string `rsf:"summary"`
+}
+
+type pointerPkg struct {
+	Name      string        `rsf:"name"`
+	License   *string       `rsf:"license"`
+	Downloads *int64        `rsf:"downloads"`
+	Latest    *pointerSnap  `rsf:"latest"`
+	Snapshots []pointerSnap `rsf:"snapshots,index:date"`
+	Tags      *[]string     `rsf:"tags"`
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+var pointerData = []pointerPkg{
+	{
+		Name:      "ggplot2",
+		License:   ptr("MIT"),
+		Downloads: ptr(int64(0)),
+		Latest:    &pointerSnap{Date: "2024-01-01", Summary: ptr("")},
+		Snapshots: []pointerSnap{
+			{Date: "2024-01-01", Summary: ptr("Plots")},
+			{Date: "2023-01-01"},
+		},
+		Tags: &[]string{"plots"},
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *PointersSuite) write(opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, opts...)
+	for _, obj := range pointerData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *PointersSuite) TestReadObject() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldHashes()},
+	} {
+		br := bufio.NewReader(bytes.NewReader(s.write(opts...)))
+		r := NewReader()
+		for _, expected := range pointerData {
+			// Nil pointers are read as nil, and pointers to zero values are
+			// read as pointers to zero values.
+			var actual pointerPkg
+			err := r.ReadObject(br, &actual)
+			s.Require().Nil(err)
+			s.Assert().Equal(expected, actual)
+		}
+		s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+	}
+}
+
+func (s *PointersSuite) TestIndex() {
+	index, err := IndexOf(pointerPkg{})
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "license", FieldType: FieldTypeVarStr, Optional: true}, index[1])
+	s.Assert().Equal(FieldTypeStruct, index[3].FieldType)
+	s.Assert().True(index[3].Optional)
+	s.Assert().True(index[3].Subfields[1].Optional)
+	s.Assert().False(index[4].Optional)
+}
+
+func (s *PointersSuite) TestReadFieldAt() {
+	ra := bytes.NewReader(s.write())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+
+	latest, err := ReadFieldAt(ra, obj, "latest")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{"date": "2024-01-01", "summary": ""}, latest)
+	tags, err := ReadFieldAt(ra, obj, "tags")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{"plots"}, tags)
+
+	obj, err = NextObject(ra, obj)
+	s.Require().Nil(err)
+	latest, err = ReadFieldAt(ra, obj, "latest")
+	s.Require().Nil(err)
+	s.Assert().Nil(latest)
+	tags, err = ReadFieldAt(ra, obj, "tags")
+	s.Require().Nil(err)
+	s.Assert().Nil(tags)
+}
+
+func (s *PointersSuite) TestAdvanceTo() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	_, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+
+	// Nil and non-nil pointers are skipped
+	for range pointerData {
+		_, err = r.BeginObject(br)
+		s.Require().Nil(err)
+		err = r.AdvanceTo(br, "tags")
+		s.Require().Nil(err)
+		present, err := r.ReadBoolField(br)
+		s.Require().Nil(err)
+		if present {
+			err = r.EndObject(br)
+			s.Require().Nil(err)
+		}
+	}
+}
+
+func (s *PointersSuite) TestPrint() {
+	out := &strings.Builder{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write())))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `name (string): rlang
+license: nil
+downloads: nil
+latest: nil
+snapshots (array(0)):
+tags: nil
+`)
+	s.Assert().Contains(out.String(), `latest (struct):
+    date (string(10)): 2024-01-01
+    summary (string): 
+`)
+}
+
+func (s *PointersSuite) TestRedact() {
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(s.write()), []Redaction{
+		{Field: "license", Mode: RedactBlank},
+		{Field: "latest.summary", Mode: RedactBlank},
+	})
+	s.Require().Nil(err)
+
+	br := bufio.NewReader(dst)
+	r := NewReader()
+	var actual pointerPkg
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	s.Assert().Nil(actual.License)
+	s.Assert().Equal(&pointerSnap{Date: "2024-01-01"}, actual.Latest)
+
+	actual = pointerPkg{}
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(pointerData[1], actual)
+}
+
+func (s *PointersSuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version2).WriteObject(pointerPkg{})
+	s.Assert().EqualError(err, "pointer field license requires version 3 or later")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		P **string `rsf:"p"`
+	}{})
+	s.Assert().EqualError(err, "pointer field p cannot point to a pointer")
+}
@@ -0,0 +1,521 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Predicate is a filter expression over the fields of struct array elements
+// or top-level objects, built with `Field`:
+//
+//	pred := Field("verified").Eq(true).And(Field("date").Gte("2022-01-01"))
+//
+// Field values are compared to the operands after converting integers to
+// int64, unsigned integers to uint64, and floats to float64; numbers of
+// different kinds are compared as float64. Strings, bools, and `time.Time`
+// values are compared with values of the same type, and `time.Time` values
+// are also compared with RFC 3339 timestamps or dates, such as "2022-01-01".
+// A comparison is false when
+// the field is missing or absent, or its value cannot be compared to the
+// operand. See `Select` and `ScanObjects`.
+type Predicate struct {
+	op    predicateOp
+	field string
+	val   any
+	preds []Predicate
+}
+
+type predicateOp int
+
+const (
+	opEq predicateOp = iota
+	opNe
+	opLt
+	opLte
+	opGt
+	opGte
+	opAnd
+	opOr
+	opNot
+)
+
+var predicateOpNames = map[predicateOp]string{
+	opEq:  "=",
+	opNe:  "!=",
+	opLt:  "<",
+	opLte: "<=",
+	opGt:  ">",
+	opGte: ">=",
+	opAnd: "AND",
+	opOr:  "OR",
+}
+
+// FieldRef refers to a field in a `Predicate`. See `Field`.
+type FieldRef struct {
+	name string
+}
+
+// Field refers to the field `name` of an element or object.
+func Field(name string) FieldRef {
+	return FieldRef{name: name}
+}
+
+func (f FieldRef) compare(op predicateOp, val any) Predicate {
+	return Predicate{op: op, field: f.name, val: normalizeOperand(val)}
+}
+
+// Eq matches values equal to `val`.
+func (f FieldRef) Eq(val any) Predicate { return f.compare(opEq, val) }
+
+// Ne matches values that are not equal to `val`.
+func (f FieldRef) Ne(val any) Predicate { return f.compare(opNe, val) }
+
+// Lt matches values less than `val`.
+func (f FieldRef) Lt(val any) Predicate { return f.compare(opLt, val) }
+
+// Lte matches values less than or equal to `val`.
+func (f FieldRef) Lte(val any) Predicate { return f.compare(opLte, val) }
+
+// Gt matches values greater than `val`.
+func (f FieldRef) Gt(val any) Predicate { return f.compare(opGt, val) }
+
+// Gte matches values greater than or equal to `val`.
+func (f FieldRef) Gte(val any) Predicate { return f.compare(opGte, val) }
+
+// And matches when `p` and all of `preds` match.
+func (p Predicate) And(preds ...Predicate) Predicate {
+	return Predicate{op: opAnd, preds: append([]Predicate{p}, preds...)}
+}
+
+// Or matches when `p` or any of `preds` match.
+func (p Predicate) Or(preds ...Predicate) Predicate {
+	return Predicate{op: opOr, preds: append([]Predicate{p}, preds...)}
+}
+
+// Not matches when `p` does not match.
+func Not(p Predicate) Predicate {
+	return Predicate{op: opNot, preds: []Predicate{p}}
+}
+
+func (p Predicate) String() string {
+	switch p.op {
+	case opAnd, opOr:
+		parts := make([]string, len(p.preds))
+		for i, pred := range p.preds {
+			parts[i] = pred.String()
+		}
+		return "(" + strings.Join(parts, " "+predicateOpNames[p.op]+" ") + ")"
+	case opNot:
+		return "NOT " + p.preds[0].String()
+	default:
+		return fmt.Sprintf("%s %s %#v", p.field, predicateOpNames[p.op], p.val)
+	}
+}
+
+// fields returns the names of the fields used by the predicate.
+func (p Predicate) fields() []string {
+	if p.preds == nil {
+		return []string{p.field}
+	}
+	var fields []string
+	for _, pred := range p.preds {
+		fields = append(fields, pred.fields()...)
+	}
+	return fields
+}
+
+// eval evaluates the predicate, using `get` to look up field values.
+func (p Predicate) eval(get func(field string) any) bool {
+	switch p.op {
+	case opAnd:
+		for _, pred := range p.preds {
+			if !pred.eval(get) {
+				return false
+			}
+		}
+		return true
+	case opOr:
+		for _, pred := range p.preds {
+			if pred.eval(get) {
+				return true
+			}
+		}
+		return false
+	case opNot:
+		return !p.preds[0].eval(get)
+	}
+
+	c, ok := compareValues(normalizeOperand(get(p.field)), p.val)
+	if !ok {
+		return false
+	}
+	switch p.op {
+	case opEq:
+		return c == 0
+	case opNe:
+		return c != 0
+	case opLt:
+		return c < 0
+	case opLte:
+		return c <= 0
+	case opGt:
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// normalizeOperand converts numbers to int64, uint64, or float64.
+func normalizeOperand(val any) any {
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return val
+}
+
+// compareValues compares normalized values, returning false if they cannot
+// be compared.
+func compareValues(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			if a == b {
+				return 0, true
+			} else if b {
+				return -1, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		switch b := b.(type) {
+		case time.Time:
+			return a.Compare(b), true
+		case string:
+			for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+				if t, err := time.Parse(layout, b); err == nil {
+					return a.Compare(t), true
+				}
+			}
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return compareOrdered(a, b), true
+		}
+	case uint64:
+		if b, ok := b.(uint64); ok {
+			return compareOrdered(a, b), true
+		}
+	}
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	return compareOrdered(fa, fb), true
+}
+
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func toFloat(val any) (float64, bool) {
+	switch val := val.(type) {
+	case int64:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case float64:
+		return val, true
+	}
+	return 0, false
+}
+
+// pushdownTypes are the field types that can be read without decoding the
+// rest of an element. See `Select`.
+var pushdownTypes = map[int]bool{
+	FieldTypeVarStr:   true,
+	FieldTypeFixedStr: true,
+	FieldTypeBool:     true,
+	FieldTypeFloat:    true,
+	FieldTypeInt64:    true,
+	FieldTypeExpiry:   true,
+	FieldTypeDeleted:  true,
+	FieldTypeTime:     true,
+	FieldTypeUint64:   true,
+	FieldTypeInt:      true,
+	FieldTypeFloat32:  true,
+}
+
+// elementFilter evaluates a predicate against the fields of struct array
+// elements. When each field used by the predicate is a scalar subfield or an
+// index key field, the predicate is evaluated by reading only those fields,
+// and other elements are not decoded.
+type elementFilter struct {
+	pred  Predicate
+	entry IndexEntry
+
+	// When `pushdown` is set, `slots` maps each field used by the predicate
+	// to its position in `vals`, and `subfields` and `keys` map each
+	// subfield and index key field to its slot, or -1.
+	pushdown  bool
+	slots     map[string]int
+	subfields []int
+	keys      []int
+	vals      []any
+}
+
+func newElementFilter(entry IndexEntry, pred Predicate) (*elementFilter, error) {
+	if entry.Subfields == nil {
+		return nil, fmt.Errorf("field %s is not a struct array", entry.FieldName)
+	}
+	ef := &elementFilter{pred: pred, entry: entry, pushdown: true, slots: make(map[string]int)}
+	ef.subfields = make([]int, len(entry.Subfields))
+	for i := range ef.subfields {
+		ef.subfields[i] = -1
+	}
+	ef.keys = make([]int, len(entry.IndexKeys))
+	for i := range ef.keys {
+		ef.keys[i] = -1
+	}
+	for _, field := range pred.fields() {
+		if _, ok := ef.slots[field]; ok {
+			continue
+		}
+		slot := len(ef.slots)
+		ef.slots[field] = slot
+		found := false
+		for i, subfield := range entry.Subfields {
+			if subfield.FieldName == field {
+				found = true
+				ef.subfields[i] = slot
+				ef.pushdown = ef.pushdown && pushdownTypes[subfield.FieldType]
+			}
+		}
+		for i, key := range entry.IndexKeys {
+			if key.FieldName == field && !found {
+				found = true
+				ef.keys[i] = slot
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("array %s field %s: %w", entry.FieldName, field, ErrNoSuchField)
+		}
+	}
+	ef.vals = make([]any, len(ef.slots))
+	return ef, nil
+}
+
+// match evaluates the predicate against the element at `off` with the index
+// key `key`, which is nil for arrays that are not indexed. If the predicate
+// cannot be pushed down, the decoded element is returned.
+func (ef *elementFilter) match(s *StatelessReader, key any, off int64) (bool, any, error) {
+	if !ef.pushdown {
+		el, _, err := s.readElement(ef.entry, IndexEntry{}, off)
+		if err != nil {
+			return false, nil, err
+		}
+		err = setElementKey(ef.entry, el, key)
+		if err != nil {
+			return false, nil, err
+		}
+		m, _ := el.(map[string]any)
+		return ef.pred.eval(func(field string) any { return m[field] }), el, nil
+	}
+
+	for i := range ef.vals {
+		ef.vals[i] = nil
+	}
+	if len(ef.keys) > 0 && key != nil {
+		keyVals := []any{key}
+		if len(ef.keys) > 1 {
+			var err error
+			keyVals, err = splitKey(ef.entry.IndexKeys, key)
+			if err != nil {
+				return false, nil, err
+			}
+		}
+		for i, slot := range ef.keys {
+			if slot >= 0 {
+				ef.vals[slot] = keyVals[i]
+			}
+		}
+	}
+	var err error
+	for i, subfield := range ef.entry.Subfields {
+		slot := ef.subfields[i]
+		if slot >= 0 {
+			ef.vals[slot], off, err = s.readValue(subfield, off)
+		} else if i < len(ef.subfields)-1 && ef.remaining(i) {
+			off, err = s.skipValue(subfield, off)
+		} else {
+			break
+		}
+		if err != nil {
+			return false, nil, err
+		}
+	}
+	return ef.pred.eval(func(field string) any { return ef.vals[ef.slots[field]] }), nil, nil
+}
+
+// remaining returns true if a subfield following position `i` is used by the
+// predicate.
+func (ef *elementFilter) remaining(i int) bool {
+	for _, slot := range ef.subfields[i+1:] {
+		if slot >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the elements of the top-level struct array `field` of the
+// object `obj` that match `pred`, in the same form as `ReadFieldAt`. When each
+// field used by the predicate is a scalar field, such as a bool, number,
+// string, or time, or a key field of the array index, only those fields are
+// read to evaluate the predicate, and elements that do not match are skipped
+// without decoding them. Otherwise, each element is decoded before the
+// predicate is evaluated. Expired and deleted elements are omitted as with
+// `ReadFieldAt`.
+func Select(ra io.ReaderAt, obj ObjectRef, field string, pred Predicate) ([]any, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := objectReader(ra, obj)
+	pos, off, err := s.fieldOffset(obj, field)
+	if err != nil {
+		return nil, err
+	}
+	entry := obj.Index[pos]
+	if entry.FieldType != FieldTypeArray {
+		return nil, fmt.Errorf("field %s is not an array", field)
+	}
+	ef, err := newElementFilter(entry, pred)
+	if err != nil {
+		return nil, err
+	}
+
+	sz, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, err
+	}
+	end := off + int64(sz)
+	arrayLen, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return nil, err
+	}
+	var handles []ElementHandle
+	if entry.Indexed {
+		handles, err = elementHandles(s, entry, off)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	matches := make([]any, 0)
+	for i := 0; i < arrayLen; i++ {
+		var key any
+		if handles != nil {
+			key = handles[i].Key
+			next = handles[i].Offset
+		} else if next >= end && !entry.emptyElements() {
+			return nil, ErrArrayMismatch{Pos: off, Len: arrayLen, Size: sz, ReadLen: i, ReadSize: int(next - off)}
+		}
+
+		ok, el, err := ef.match(s, key, next)
+		if err != nil {
+			return nil, fmt.Errorf("array %s element %d: %w", field, i, err)
+		}
+		if ok && el == nil {
+			el, _, err = s.readElement(entry, IndexEntry{}, next)
+			if err == nil {
+				err = setElementKey(entry, el, key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("array %s element %d: %w", field, i, err)
+			}
+		}
+		if ok {
+			matches = append(matches, el)
+		}
+
+		// Find the next element of arrays that are not indexed.
+		if handles == nil {
+			next, err = s.skipElement(entry, IndexEntry{}, next)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return obj.filter(entry, matches).([]any), nil
+}
+
+// ScanObjects calls `fn` with a reference to each top-level object of the file
+// `ra`, starting with `obj`, whose top-level fields match `pred`. Only the
+// fields used by the predicate are read, using the field offsets when the file
+// includes them (see `WithFieldOffsets`), so `fn` can read the rest of the
+// matching objects as needed. Scanning stops at the first error returned by
+// `fn`.
+func ScanObjects(ra io.ReaderAt, obj ObjectRef, pred Predicate, fn func(obj ObjectRef) error) error {
+	fields := pred.fields()
+	for _, field := range fields {
+		if _, _, err := entrySet(obj.Index, field); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+
+	vals := make(map[string]any, len(fields))
+	var err error
+	for {
+		for _, field := range fields {
+			if _, ok := vals[field]; ok {
+				continue
+			}
+			vals[field], err = ReadFieldAt(ra, obj, field)
+			if err != nil {
+				return err
+			}
+		}
+		if pred.eval(func(field string) any { return vals[field] }) {
+			err = fn(obj)
+			if err != nil {
+				return err
+			}
+		}
+		clear(vals)
+
+		obj, err = NextObject(ra, obj)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PredicateSuite struct {
+	suite.Suite
+}
+
+func TestPredicateSuite(t *testing.T) {
+	suite.Run(t, &PredicateSuite{})
+}
+
+type predicateRelease struct {
+	Version  string   `rsf:"version,skip,fixed:3"`
+	Date     string   `rsf:"date,fixed:10"`
+	Verified bool     `rsf:"verified"`
+	Size     int32    `rsf:"size"`
+	Tags     []string `rsf:"tags"`
+}
+
+type predicateProject struct {
+	Indexed  []predicateRelease `rsf:"indexed,index:version"`
+	Releases []predicateRelease `rsf:"releases"`
+	Name     string             `rsf:"name"`
+	Stars    int                `rsf:"stars"`
+}
+
+var predicateReleases = []predicateRelease{
+	{Version: "1.0", Date: "2021-06-01", Verified: true, Size: 10, Tags: []string{"old"}},
+	{Version: "1.1", Date: "2022-01-01", Verified: false, Size: 20},
+	{Version: "2.0", Date: "2022-03-15", Verified: true, Size: 30, Tags: []string{"new", "big"}},
+	{Version: "2.1", Date: "2023-01-01", Verified: true, Size: 5},
+}
+
+func (s *PredicateSuite) open(vs ...any) (*bytes.Reader, ObjectRef) {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, _, err := w.WriteObjects(vs...)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	return ra, obj
+}
+
+// versions returns the versions of the selected elements.
+func versions(els []any) []string {
+	vs := make([]string, 0, len(els))
+	for _, el := range els {
+		vs = append(vs, el.(map[string]any)["version"].(string))
+	}
+	return vs
+}
+
+func (s *PredicateSuite) TestSelect() {
+	ra, obj := s.open(predicateProject{Indexed: predicateReleases, Releases: predicateReleases})
+
+	for _, tt := range []struct {
+		pred     Predicate
+		expected []string
+	}{
+		{Field("verified").Eq(true), []string{"1.0", "2.0", "2.1"}},
+		{Field("verified").Eq(true).And(Field("date").Gte("2022-01-01")), []string{"2.0", "2.1"}},
+		{Field("date").Lt("2022-01-01").Or(Field("size").Gt(25)), []string{"1.0", "2.0"}},
+		{Not(Field("verified").Eq(true)), []string{"1.1"}},
+		{Field("size").Lte(10.5), []string{"1.0", "2.1"}},
+		{Field("size").Ne(uint8(20)), []string{"1.0", "2.0", "2.1"}},
+		{Field("version").Gte("2.0"), []string{"2.0", "2.1"}},
+		{Field("version").Eq("1.1").Or(Field("size").Eq(5)), []string{"1.1", "2.1"}},
+		{Field("tags").Eq("old"), []string{}},
+		{Field("verified").Eq("true"), []string{}},
+	} {
+		els, err := Select(ra, obj, "indexed", tt.pred)
+		s.Require().Nil(err, tt.pred.String())
+		s.Assert().Equal(tt.expected, versions(els), tt.pred.String())
+
+		// Matching elements are decoded in full.
+		if len(els) > 0 {
+			all, err := ReadFieldAt(ra, obj, "indexed")
+			s.Require().Nil(err)
+			s.Assert().Subset(all, els)
+		}
+	}
+
+	// Elements of arrays that are not indexed omit skipped fields.
+	els, err := Select(ra, obj, "releases", Field("verified").Eq(true).And(Field("date").Gte("2022-01-01")))
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"date": "2022-03-15", "verified": true, "size": int64(30), "tags": []any{"new", "big"}},
+		map[string]any{"date": "2023-01-01", "verified": true, "size": int64(5), "tags": []any{}},
+	}, els)
+}
+
+func (s *PredicateSuite) TestPushdown() {
+	ra, obj := s.open(predicateProject{Indexed: predicateReleases})
+	entry := obj.Index[0]
+
+	ef, err := newElementFilter(entry, Field("verified").Eq(true).And(Field("version").Gt("1")))
+	s.Require().Nil(err)
+	s.Assert().True(ef.pushdown)
+	s.Assert().Equal([]int{-1, 0, -1, -1}, ef.subfields)
+	s.Assert().Equal([]int{1}, ef.keys)
+
+	// Elements are matched without decoding them.
+	r := NewStatelessReader(ra)
+	_, off, err := r.fieldOffset(obj, "indexed")
+	s.Require().Nil(err)
+	handles, err := elementHandles(r, entry, off)
+	s.Require().Nil(err)
+	ok, el, err := ef.match(r, handles[0].Key, handles[0].Offset)
+	s.Require().Nil(err)
+	s.Assert().True(ok)
+	s.Assert().Nil(el)
+
+	// Predicates on other fields decode each element.
+	ef, err = newElementFilter(entry, Field("tags").Eq("old"))
+	s.Require().Nil(err)
+	s.Assert().False(ef.pushdown)
+}
+
+func (s *PredicateSuite) TestExpired() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(expiryBuild)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra, WithExpiry(expiryNow))
+	s.Require().Nil(err)
+
+	els, err := Select(ra, obj, "artifacts", Field("expires").Lt(1005))
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"name": "bin", "expires": int64(0)},
+		map[string]any{"name": "new", "expires": int64(1001)},
+	}, els)
+}
+
+func (s *PredicateSuite) TestScanObjects() {
+	ra, obj := s.open(
+		predicateProject{Name: "dplyr", Stars: 100},
+		predicateProject{Name: "plyr", Stars: 5},
+		predicateProject{Name: "shiny", Stars: 50},
+	)
+
+	var names []string
+	err := ScanObjects(ra, obj, Field("stars").Gte(50), func(obj ObjectRef) error {
+		name, err := ReadFieldAt(ra, obj, "name")
+		names = append(names, name.(string))
+		return err
+	})
+	s.Require().Nil(err)
+	s.Assert().Equal([]string{"dplyr", "shiny"}, names)
+
+	err = ScanObjects(ra, obj, Field("stars").Gte(50), func(obj ObjectRef) error {
+		return ErrFinalized
+	})
+	s.Assert().ErrorIs(err, ErrFinalized)
+}
+
+func (s *PredicateSuite) TestErrors() {
+	ra, obj := s.open(predicateProject{Indexed: predicateReleases})
+	_, err := Select(ra, obj, "indexed", Field("missing").Eq(1))
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+	_, err = Select(ra, obj, "name", Field("name").Eq("x"))
+	s.Assert().ErrorContains(err, "field name is not an array")
+	err = ScanObjects(ra, obj, Field("missing").Eq(1), func(ObjectRef) error { return nil })
+	s.Assert().NotNil(err)
+}
+
+func (s *PredicateSuite) TestString() {
+	pred := Field("verified").Eq(true).And(Not(Field("date").Gte("2022-01-01")))
+	s.Assert().Equal(`(verified = true AND NOT date >= "2022-01-01")`, pred.String())
+}
@@ -25,7 +25,7 @@ func Print(w io.Writer, r *bufio.Reader) error {
 		i++
 
 		// Read full object size
-		_, err = reader.ReadSizeField(r)
+		_, err = reader.BeginObject(r)
 		if err != nil {
 			if err == io.EOF {
 				return nil
@@ -63,8 +63,34 @@ func Print(w io.Writer, r *bufio.Reader) error {
 	}
 }
 
+// PrintHeader prints the file header, including the optional features used by
+// the file.
+func PrintHeader(w io.Writer, r *bufio.Reader) error {
+	reader := NewReader()
+	_, err := reader.ReadIndex(r)
+	if err != nil {
+		return fmt.Errorf("error reading index: %s", err)
+	}
+
+	h := reader.Header()
+	features := "none"
+	if h.Flags != 0 {
+		features = strings.Join(h.Features(), ", ")
+	}
+	_, err = fmt.Fprintf(w, "version: %d\nmin reader version: %d\nfeatures: %s\n", h.Version, h.MinReaderVersion, features)
+	if err != nil || h.Flags&FlagParent == 0 {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "parent: %s (%x)\n", h.Parent.Location, h.Parent.Digest)
+	return err
+}
+
 func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
 
+	if f.Optional {
+		return printPointer(parentKey, f, w, r, reader, indent)
+	}
+
 	pad := strings.Repeat(" ", indent*4)
 	switch f.FieldType {
 	case FieldTypeBool:
@@ -76,6 +102,15 @@ func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, re
 		if err != nil {
 			return err
 		}
+	case FieldTypeDeleted:
+		b, err := reader.ReadBoolField(r)
+		if err != nil {
+			return fmt.Errorf("error reading tombstone: %s", err)
+		}
+		_, err = fmt.Fprintf(w, "%s%s (deleted): %t\n", pad, f.FieldName, b)
+		if err != nil {
+			return err
+		}
 	case FieldTypeInt64:
 		i, err := reader.ReadIntField(r)
 		if err != nil {
@@ -85,6 +120,15 @@ func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, re
 		if err != nil {
 			return err
 		}
+	case FieldTypeExpiry:
+		i, err := reader.ReadIntField(r)
+		if err != nil {
+			return fmt.Errorf("error reading expiry: %s", err)
+		}
+		_, err = fmt.Fprintf(w, "%s%s (expires): %d\n", pad, f.FieldName, i)
+		if err != nil {
+			return err
+		}
 	case FieldTypeFloat:
 		fl, err := reader.ReadFloatField(r)
 		if err != nil {
@@ -103,6 +147,21 @@ func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, re
 		if err != nil {
 			return err
 		}
+	case FieldTypeProvenance:
+		blob, err := reader.ReadStringField(r)
+		if err != nil {
+			return fmt.Errorf("error reading provenance: %s", err)
+		}
+		p, ok, err := decodeProvenance([]byte(blob))
+		if err != nil {
+			return fmt.Errorf("error reading provenance: %s", err)
+		}
+		if ok {
+			_, err = fmt.Fprintf(w, "%s(provenance): %s\n", pad, p)
+			if err != nil {
+				return err
+			}
+		}
 	case FieldTypeVarStr:
 		s, err := reader.ReadStringField(r)
 		if err != nil {
@@ -112,7 +171,57 @@ func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, re
 		if err != nil {
 			return err
 		}
+	case FieldTypeChunked:
+		bs, err := reader.ReadChunkedField(r)
+		if err != nil {
+			return fmt.Errorf("error reading chunked string field %s: %s", f.FieldName, err)
+		}
+		_, err = fmt.Fprintf(w, "%s%s (chunked string): %s\n", pad, f.FieldName, bs)
+		if err != nil {
+			return err
+		}
+	case FieldTypeSegmented:
+		err := printSegments(parentKey, f, w, r, reader, indent)
+		if err != nil {
+			return err
+		}
+	case FieldTypeMap:
+		err := printMap(parentKey, f, w, r, reader, indent)
+		if err != nil {
+			return err
+		}
+	case FieldTypeStruct:
+		err := printStruct(parentKey, f, w, r, reader, indent)
+		if err != nil {
+			return err
+		}
+	case FieldTypeTime:
+		err := printTime(f, w, r, reader, indent)
+		if err != nil {
+			return err
+		}
+	case FieldTypeBytes:
+		err := printBytes(f, w, r, reader, indent)
+		if err != nil {
+			return err
+		}
+	case FieldTypeUint64:
+		err := printUnsigned(f, w, r, reader, indent)
+		if err != nil {
+			return err
+		}
+	case FieldTypeInt:
+		err := printNarrowInt(f, w, r, reader, indent)
+		if err != nil {
+			return err
+		}
+	case FieldTypeFloat32:
+		err := printFloat32(f, w, r, reader, indent)
+		if err != nil {
+			return err
+		}
 	case FieldTypeArray:
+		start := reader.Pos()
 		sz, err := reader.ReadSizeField(r)
 		if err != nil {
 			return fmt.Errorf("error reading array size: %s", err)
@@ -136,22 +245,22 @@ func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, re
 				switch reflect.Kind(f.IndexType) {
 				case reflect.String:
 					var sIndexVal string
-					sIndexVal, err = reader.ReadFixedStringField(indexSz, r)
+					sIndexVal, err = reader.(*rsfReader).readStringKey(f, r)
 					if err != nil {
 						return fmt.Errorf("error reading index string value: %s", err)
 					}
 					indexValues = append(indexValues, sIndexVal)
 				case reflect.Int64:
 					var intIndexVal int64
-					intIndexVal, err = reader.ReadIntField(r)
+					intIndexVal, err = reader.(*rsfReader).readIntKey(r)
 					if err != nil {
 						return fmt.Errorf("error reading index int64 value: %s", err)
 					}
 					indexValues = append(indexValues, intIndexVal)
 				}
 
-				// Discard index size
-				err = reader.Discard(4, r)
+				// Discard index size and element hash
+				err = reader.Discard(f.indexEntrySize()-indexSz, r)
 				if err != nil {
 					return fmt.Errorf("error discarding index bytes: %s", err)
 				}
@@ -192,6 +301,14 @@ func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, re
 						return err
 					}
 				}
+			} else if f.Element != nil {
+				// Print each element array as a field named "-"
+				el := *f.Element
+				el.FieldName = "-"
+				err = printField(key, el, w, r, reader, indent+1)
+				if err != nil {
+					return err
+				}
 			} else {
 				_, err = fmt.Fprintf(w, "%s-", pad+strings.Repeat(" ", 4))
 
@@ -226,6 +343,26 @@ func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, re
 					if err != nil {
 						return err
 					}
+				case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+					var u uint64
+					u, err = reader.ReadUint64Field(r)
+					if err != nil {
+						return fmt.Errorf("error reading array uint field: %s", err)
+					}
+					_, err = fmt.Fprintf(w, "%d\n", u)
+					if err != nil {
+						return err
+					}
+				case reflect.Kind(kindFloat32):
+					var fl float32
+					fl, err = reader.ReadFloat32Field(r)
+					if err != nil {
+						return fmt.Errorf("error reading array float32 field: %s", err)
+					}
+					_, err = fmt.Fprintf(w, "%f\n", fl)
+					if err != nil {
+						return err
+					}
 				case reflect.Float32, reflect.Float64:
 					var fl float64
 					fl, err = reader.ReadFloatField(r)
@@ -249,6 +386,10 @@ func printField(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, re
 				}
 			}
 		}
+
+		if read := reader.Pos() - start; read != sz {
+			return ErrArrayMismatch{Pos: int64(start), Len: arrayLen, Size: sz, ReadLen: arrayLen, ReadSize: read}
+		}
 	default:
 		return fmt.Errorf("cannot print unknown field %s with type %d", f.FieldName, f.FieldType)
 	}
@@ -0,0 +1,151 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+/*
+
+Struct array elements can record their provenance, e.g., for auditing
+published snapshots, without including it in the element struct. Element types
+provide provenance by implementing `ProvenanceProvider`.
+
+Version3 and later write the provenance of each element following the other
+element fields, and record it in the index as a final subfield that uses
+`FieldTypeProvenance`. The provenance is written as a size-prefixed value, and
+an element with no provenance uses a zero size.
+
+Format:
+
+  [provenance size]
+  [source size]
+  [source]
+  [fetch time]                                    // Unix nanoseconds
+  [builder size]
+  [builder]
+
+*/
+
+// Provenance records where an array element came from.
+type Provenance struct {
+	// The URL the element was fetched from.
+	Source string
+	// When the element was fetched.
+	Fetched time.Time
+	// The ID of the builder that wrote the element.
+	Builder string
+}
+
+func (p Provenance) String() string {
+	return fmt.Sprintf("source=%s fetched=%s builder=%s", p.Source, p.Fetched.UTC().Format(time.RFC3339), p.Builder)
+}
+
+// ProvenanceProvider is implemented by struct array element types that record
+// their provenance. `Provenance` returns nil if an element has no provenance.
+type ProvenanceProvider interface {
+	Provenance() *Provenance
+}
+
+// The name of the index subfield that records element provenance, which
+// cannot conflict with a field name since it is not a valid tag name.
+const provenanceField = "rsf,provenance"
+
+var provenanceProviderType = reflect.TypeOf((*ProvenanceProvider)(nil)).Elem()
+
+// ElementProvenance returns the provenance of an array element read with
+// `ReadFieldAt`, if it has any.
+func ElementProvenance(el any) (Provenance, bool) {
+	m, ok := el.(map[string]any)
+	if !ok {
+		return Provenance{}, false
+	}
+	p, ok := m[provenanceField].(Provenance)
+	return p, ok
+}
+
+// hasProvenance returns true if elements of type `t` include provenance.
+func (f *rsfWriter) hasProvenance(t reflect.Type) bool {
+	return f.version > 2 && t.Kind() == reflect.Struct && t.Implements(provenanceProviderType)
+}
+
+// writeProvenance writes the provenance of the element `v`.
+func (f *rsfWriter) writeProvenance(v reflect.Value, buf *bytes.Buffer) (int, error) {
+	p := v.Interface().(ProvenanceProvider).Provenance()
+	if p == nil {
+		return f.WriteSizeField(0, 0, buf)
+	}
+
+	blob := &bytes.Buffer{}
+	_, err := f.WriteStringField(0, p.Source, blob)
+	if err != nil {
+		return 0, err
+	}
+	var fetched int64
+	if !p.Fetched.IsZero() {
+		fetched = p.Fetched.UnixNano()
+	}
+	_, err = f.WriteInt64Field(0, fetched, blob)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.WriteStringField(0, p.Builder, blob)
+	if err != nil {
+		return 0, err
+	}
+	return f.WriteStringField(0, blob.String(), buf)
+}
+
+// readProvenance reads element provenance. Nil is returned if the element has
+// no provenance.
+func (s *StatelessReader) readProvenance(off int64) (any, int64, error) {
+	blob, next, err := s.ReadStringField(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	p, ok, err := decodeProvenance([]byte(blob))
+	if err != nil || !ok {
+		return nil, next, err
+	}
+	return p, next, nil
+}
+
+// decodeProvenance decodes a provenance value that does not include the
+// provenance size. False is returned if the value is empty.
+func decodeProvenance(blob []byte) (Provenance, bool, error) {
+	if len(blob) == 0 {
+		return Provenance{}, false, nil
+	}
+	f := &rsfReader{}
+	r := bytes.NewReader(blob)
+	var p Provenance
+	var err error
+	p.Source, err = f.ReadStringField(r)
+	if err != nil {
+		return p, false, provenanceError(err)
+	}
+	fetched, err := f.ReadIntField(r)
+	if err != nil {
+		return p, false, provenanceError(err)
+	}
+	if fetched != 0 {
+		p.Fetched = time.Unix(0, fetched)
+	}
+	p.Builder, err = f.ReadStringField(r)
+	if err != nil {
+		return p, false, provenanceError(err)
+	}
+	return p, true, nil
+}
+
+func provenanceError(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("invalid provenance: %w", err)
+}
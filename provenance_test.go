@@ -0,0 +1,115 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ProvenanceSuite struct {
+	suite.Suite
+}
+
+func TestProvenanceSuite(t *testing.T) {
+	suite.Run(t, &ProvenanceSuite{})
+}
+
+type sourcedPkg struct {
+	Name string `rsf:"name"`
+
+	source *Provenance `rsf:"-"`
+}
+
+func (p sourcedPkg) Provenance() *Provenance {
+	return p.source
+}
+
+type sourcedRepo struct {
+	Packages []sourcedPkg `rsf:"packages"`
+	Count    int64        `rsf:"count"`
+}
+
+var (
+	fetched     = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	sourcedData = sourcedRepo{
+		Packages: []sourcedPkg{
+			{Name: "plyr", source: &Provenance{Source: "https://cran.r-project.org/plyr", Fetched: fetched, Builder: "builder-1"}},
+			{Name: "dplyr"},
+		},
+		Count: 2,
+	}
+)
+
+func (s *ProvenanceSuite) TestElementProvenance() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(sourcedData)
+	s.Require().Nil(err)
+
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	s.Assert().Empty(featureNames(obj.Flags))
+
+	pkgs, err := ReadFieldAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	s.Require().Len(pkgs, 2)
+	p, ok := ElementProvenance(pkgs.([]any)[0])
+	s.Assert().True(ok)
+	s.Assert().Equal(*sourcedData.Packages[0].source, Provenance{Source: p.Source, Fetched: p.Fetched.UTC(), Builder: p.Builder})
+	s.Assert().Equal("plyr", pkgs.([]any)[0].(map[string]any)["name"])
+
+	// Elements without provenance omit it
+	_, ok = ElementProvenance(pkgs.([]any)[1])
+	s.Assert().False(ok)
+	s.Assert().Equal(map[string]any{"name": "dplyr"}, pkgs.([]any)[1])
+
+	// Fields following the array are read normally
+	count, err := ReadFieldAt(ra, obj, "count")
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(2), count)
+
+	// Sequential readers can skip the provenance
+	r := NewReader()
+	b := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	_, err = r.ReadIndex(b)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(b)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(b, "count")
+	s.Require().Nil(err)
+	c, err := r.ReadIntField(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(2), c)
+
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	s.Require().Nil(err)
+	s.Assert().Contains(pbuf.String(), "(provenance): source=https://cran.r-project.org/plyr fetched=2023-05-01T12:00:00Z builder=builder-1\n")
+}
+
+func (s *ProvenanceSuite) TestVersion2() {
+	// Version2 files do not include provenance
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version2).WriteObject(sourcedData)
+	s.Require().Nil(err)
+	expected := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(expected, Version2).WriteObject(sourcedRepo{
+		Packages: []sourcedPkg{{Name: "plyr"}, {Name: "dplyr"}},
+		Count:    2,
+	})
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), buf.Bytes())
+}
+
+func (s *ProvenanceSuite) TestDecodeProvenance() {
+	_, ok, err := decodeProvenance(nil)
+	s.Assert().Nil(err)
+	s.Assert().False(ok)
+
+	_, _, err = decodeProvenance([]byte{1, 0, 0, 0})
+	s.Assert().EqualError(err, "invalid provenance: unexpected EOF")
+}
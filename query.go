@@ -0,0 +1,521 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// ErrInvalidQuery is returned by `ParseQuery` when a query cannot be parsed.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Query selects fields from the top-level objects of a file, or from the
+// elements of a top-level struct array, using the file index, so files can be
+// queried without the structs used to write them. Queries are parsed from a
+// small subset of SQL with `ParseQuery`:
+//
+//	SELECT name, rating WHERE verified AND date >= '2022-01-01'
+//	SELECT * FROM releases WHERE NOT (yanked OR version < '1.0') LIMIT 10
+//
+// Keywords are case-insensitive. Without FROM, each top-level object is a row.
+// With FROM, each element of the named array of each object is a row. WHERE
+// conditions compare a field to a literal with =, !=, <>, <, <=, >, or >=, and
+// are combined with AND, OR, NOT, and parentheses. A field by itself matches
+// when the field is true. Literals are single-quoted strings, numbers, TRUE,
+// and FALSE. Field names that are not plain identifiers are double-quoted.
+// See `Predicate` for how values are compared.
+type Query struct {
+	// The selected fields, or nil to select all fields.
+	Fields []string
+
+	// The top-level array whose elements are selected, if any.
+	From string
+
+	// The condition that selected rows match, if any.
+	Where *Predicate
+
+	// The maximum number of rows, or 0 for no limit.
+	Limit int
+}
+
+// QueryResult holds the rows selected by a `Query`. Each row holds the value
+// of each column, or nil if the field is absent. Values have the types
+// returned by `ReadFieldAt`.
+type QueryResult struct {
+	Columns []string
+	Rows    [][]any
+}
+
+// ParseQuery parses a query. See `Query`. Errors wrap `ErrInvalidQuery`.
+func ParseQuery(query string) (Query, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return Query{}, err
+	}
+	p := &queryParser{tokens: tokens}
+	q, err := p.parse()
+	if err != nil {
+		return Query{}, fmt.Errorf("%w: %s", ErrInvalidQuery, err)
+	}
+	return q, nil
+}
+
+// RunQuery parses and runs `query` against the file `ra`. Reader options, such
+// as `WithLayers` or `WithExpiry`, are used when opening the file.
+func RunQuery(ra io.ReaderAt, query string, opts ...ReaderOption) (QueryResult, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	return q.Run(ra, opts...)
+}
+
+// Run runs the query against the file `ra`. Reader options, such as
+// `WithLayers` or `WithExpiry`, are used when opening the file. When the query
+// selects array elements, elements are filtered as with `Select`, so only the
+// elements that match are decoded in full.
+func (q Query) Run(ra io.ReaderAt, opts ...ReaderOption) (QueryResult, error) {
+	obj, err := OpenObject(ra, opts...)
+	if err == io.EOF {
+		return QueryResult{Columns: q.Fields, Rows: [][]any{}}, nil
+	} else if err != nil {
+		return QueryResult{}, err
+	}
+
+	columns, err := q.columns(obj.Index)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	res := QueryResult{Columns: columns, Rows: [][]any{}}
+	for ; err == nil; obj, err = NextObject(ra, obj) {
+		if q.From == "" {
+			err = q.addObject(ra, obj, &res)
+		} else {
+			err = q.addElements(ra, obj, &res)
+		}
+		if err != nil {
+			return QueryResult{}, err
+		}
+		if q.Limit > 0 && len(res.Rows) >= q.Limit {
+			res.Rows = res.Rows[:q.Limit]
+			return res, nil
+		}
+	}
+	if err != io.EOF {
+		return QueryResult{}, err
+	}
+	return res, nil
+}
+
+// columns returns the selected columns, checking that each field exists.
+func (q Query) columns(index Index) ([]string, error) {
+	names := make([]string, 0, len(index))
+	if q.From == "" {
+		for _, entry := range index {
+			names = append(names, entry.FieldName)
+		}
+	} else {
+		_, pos, err := entrySet(index, q.From)
+		if err != nil {
+			return nil, fmt.Errorf("array %s: %w", q.From, err)
+		}
+		entry := index[pos]
+		if entry.FieldType != FieldTypeArray || entry.Subfields == nil {
+			return nil, fmt.Errorf("field %s is not a struct array", q.From)
+		}
+		for _, key := range entry.IndexKeys {
+			names = append(names, key.FieldName)
+		}
+		for _, subfield := range entry.Subfields {
+			if !containsString(names, subfield.FieldName) {
+				names = append(names, subfield.FieldName)
+			}
+		}
+	}
+	if q.Fields == nil {
+		return names, nil
+	}
+
+	fields := q.Fields
+	if q.Where != nil {
+		fields = append(fields[:len(fields):len(fields)], q.Where.fields()...)
+	}
+	for _, field := range fields {
+		if !containsString(names, field) {
+			return nil, fmt.Errorf("field %s: %w", field, ErrNoSuchField)
+		}
+	}
+	return q.Fields, nil
+}
+
+func containsString(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// addObject adds a row for the top-level object `obj` if it matches.
+func (q Query) addObject(ra io.ReaderAt, obj ObjectRef, res *QueryResult) error {
+	vals := make(map[string]any, len(res.Columns))
+	var err error
+	get := func(field string) any {
+		val, ok := vals[field]
+		if !ok && err == nil {
+			val, err = ReadFieldAt(ra, obj, field)
+			vals[field] = val
+		}
+		return val
+	}
+	if q.Where != nil && !q.Where.eval(get) || err != nil {
+		return err
+	}
+
+	row := make([]any, len(res.Columns))
+	for i, field := range res.Columns {
+		val, ok := vals[field]
+		if !ok {
+			val, err = ReadFieldAt(ra, obj, field)
+			if err != nil {
+				return err
+			}
+		}
+		row[i] = val
+	}
+	res.Rows = append(res.Rows, row)
+	return nil
+}
+
+// addElements adds a row for each matching element of the array `q.From` of
+// the object `obj`.
+func (q Query) addElements(ra io.ReaderAt, obj ObjectRef, res *QueryResult) error {
+	var els []any
+	var err error
+	if q.Where != nil {
+		els, err = Select(ra, obj, q.From, *q.Where)
+	} else {
+		var val any
+		val, err = ReadFieldAt(ra, obj, q.From)
+		els, _ = val.([]any)
+	}
+	if err != nil {
+		return err
+	}
+	for _, el := range els {
+		m, _ := el.(map[string]any)
+		row := make([]any, len(res.Columns))
+		for i, field := range res.Columns {
+			row[i] = m[field]
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return nil
+}
+
+// PrintQuery runs `query` against the file `ra` and prints the selected rows
+// to `w` as aligned columns, preceded by the column names. Absent values are
+// printed as empty columns.
+func PrintQuery(w io.Writer, ra io.ReaderAt, query string, opts ...ReaderOption) error {
+	res, err := RunQuery(ra, query, opts...)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, err = fmt.Fprintln(tw, strings.Join(res.Columns, "\t"))
+	if err != nil {
+		return err
+	}
+	for _, row := range res.Rows {
+		vals := make([]string, len(row))
+		for i, val := range row {
+			if val != nil {
+				vals[i] = fmt.Sprintf("%v", val)
+			}
+		}
+		_, err = fmt.Fprintln(tw, strings.Join(vals, "\t"))
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+}
+
+// tokenizeQuery splits a query into words, quoted identifiers, strings,
+// numbers, and symbols.
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	rs := []rune(query)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			// Quotes are escaped by doubling them.
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(rs); j++ {
+				if rs[j] == r {
+					if j+1 < len(rs) && rs[j+1] == r {
+						j++
+					} else {
+						break
+					}
+				}
+				sb.WriteRune(rs[j])
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("%w: unterminated quote at position %d", ErrInvalidQuery, i)
+			}
+			kind := tokenString
+			if r == '"' {
+				kind = tokenIdent
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: sb.String()})
+			i = j + 1
+		case unicode.IsDigit(r) || r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			j := i + 1
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.' || rs[j] == 'e' || rs[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, queryToken{kind: tokenNumber, text: string(rs[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, queryToken{kind: tokenWord, text: string(rs[i:j])})
+			i = j
+		default:
+			sym := string(r)
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case "<=", ">=", "!=", "<>":
+					sym = two
+				}
+			}
+			if !strings.Contains("(),*=<>", sym) && len(sym) == 1 {
+				return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidQuery, r, i)
+			}
+			tokens = append(tokens, queryToken{kind: tokenSymbol, text: sym})
+			i += len(sym)
+		}
+	}
+	return tokens, nil
+}
+
+// queryParser parses a query with recursive descent. See `Query`.
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos == len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword consumes the next token if it is the keyword `kw`.
+func (p *queryParser) keyword(kw string) bool {
+	t, ok := p.peek()
+	if ok && t.kind == tokenWord && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// symbol consumes the next token if it is the symbol `sym`.
+func (p *queryParser) symbol(sym string) bool {
+	t, ok := p.peek()
+	if ok && t.kind == tokenSymbol && t.text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+var queryKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "LIMIT": true,
+	"AND": true, "OR": true, "NOT": true, "TRUE": true, "FALSE": true,
+}
+
+func (p *queryParser) field() (string, error) {
+	t, ok := p.peek()
+	if !ok {
+		return "", errors.New("expected field name at end of query")
+	}
+	if t.kind == tokenIdent || t.kind == tokenWord && !queryKeywords[strings.ToUpper(t.text)] {
+		p.pos++
+		return t.text, nil
+	}
+	return "", fmt.Errorf("expected field name, found %q", t.text)
+}
+
+func (p *queryParser) parse() (Query, error) {
+	var q Query
+	if !p.keyword("SELECT") {
+		return q, errors.New("expected SELECT")
+	}
+	if !p.symbol("*") {
+		for {
+			field, err := p.field()
+			if err != nil {
+				return q, err
+			}
+			q.Fields = append(q.Fields, field)
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+	var err error
+	if p.keyword("FROM") {
+		q.From, err = p.field()
+		if err != nil {
+			return q, err
+		}
+	}
+	if p.keyword("WHERE") {
+		pred, err := p.or()
+		if err != nil {
+			return q, err
+		}
+		q.Where = &pred
+	}
+	if p.keyword("LIMIT") {
+		t, ok := p.peek()
+		if ok && t.kind == tokenNumber {
+			q.Limit, err = strconv.Atoi(t.text)
+		}
+		if !ok || t.kind != tokenNumber || err != nil || q.Limit <= 0 {
+			return q, errors.New("expected a positive LIMIT")
+		}
+		p.pos++
+	}
+	if t, ok := p.peek(); ok {
+		return q, fmt.Errorf("unexpected %q", t.text)
+	}
+	return q, nil
+}
+
+func (p *queryParser) or() (Predicate, error) {
+	pred, err := p.and()
+	if err != nil {
+		return pred, err
+	}
+	for p.keyword("OR") {
+		next, err := p.and()
+		if err != nil {
+			return pred, err
+		}
+		pred = pred.Or(next)
+	}
+	return pred, nil
+}
+
+func (p *queryParser) and() (Predicate, error) {
+	pred, err := p.not()
+	if err != nil {
+		return pred, err
+	}
+	for p.keyword("AND") {
+		next, err := p.not()
+		if err != nil {
+			return pred, err
+		}
+		pred = pred.And(next)
+	}
+	return pred, nil
+}
+
+func (p *queryParser) not() (Predicate, error) {
+	if p.keyword("NOT") {
+		pred, err := p.not()
+		return Not(pred), err
+	}
+	if p.symbol("(") {
+		pred, err := p.or()
+		if err != nil {
+			return pred, err
+		}
+		if !p.symbol(")") {
+			return pred, errors.New("expected )")
+		}
+		return pred, nil
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) comparison() (Predicate, error) {
+	field, err := p.field()
+	if err != nil {
+		return Predicate{}, err
+	}
+	ref := Field(field)
+	ops := map[string]func(any) Predicate{
+		"=": ref.Eq, "!=": ref.Ne, "<>": ref.Ne, "<": ref.Lt, "<=": ref.Lte, ">": ref.Gt, ">=": ref.Gte,
+	}
+	t, ok := p.peek()
+	op, isOp := ops[t.text]
+	if !ok || t.kind != tokenSymbol || !isOp {
+		return ref.Eq(true), nil
+	}
+	p.pos++
+	val, err := p.literal()
+	if err != nil {
+		return Predicate{}, err
+	}
+	return op(val), nil
+}
+
+func (p *queryParser) literal() (any, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("expected value at end of query")
+	}
+	p.pos++
+	switch {
+	case t.kind == tokenString:
+		return t.text, nil
+	case t.kind == tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t.text)
+		}
+		return f, nil
+	case t.kind == tokenWord && strings.EqualFold(t.text, "TRUE"):
+		return true, nil
+	case t.kind == tokenWord && strings.EqualFold(t.text, "FALSE"):
+		return false, nil
+	}
+	return nil, fmt.Errorf("expected value, found %q", t.text)
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type QuerySuite struct {
+	suite.Suite
+}
+
+func TestQuerySuite(t *testing.T) {
+	suite.Run(t, &QuerySuite{})
+}
+
+type queryPkg struct {
+	Name     string             `rsf:"name"`
+	Rating   float64            `rsf:"rating"`
+	Verified bool               `rsf:"verified"`
+	Date     string             `rsf:"date,fixed:10"`
+	Updated  time.Time          `rsf:"updated"`
+	Releases []predicateRelease `rsf:"releases,index:version"`
+}
+
+var queryPkgs = []any{
+	queryPkg{Name: "dplyr", Rating: 4.5, Verified: true, Date: "2022-03-01", Updated: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), Releases: predicateReleases},
+	queryPkg{Name: "plyr", Rating: 3, Verified: false, Date: "2021-01-01", Updated: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+	queryPkg{Name: "shiny", Rating: 5, Verified: true, Date: "2021-12-31", Updated: time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC), Releases: predicateReleases[:2]},
+}
+
+func (s *QuerySuite) open() *bytes.Reader {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, _, err := w.WriteObjects(queryPkgs...)
+	s.Require().Nil(err)
+	return bytes.NewReader(buf.Bytes())
+}
+
+func (s *QuerySuite) TestParseQuery() {
+	q, err := ParseQuery(`select name, "rating" FROM releases where verified and (date >= '2022-01-01' or not size <> -1.5) limit 3`)
+	s.Require().Nil(err)
+	s.Assert().Equal([]string{"name", "rating"}, q.Fields)
+	s.Assert().Equal("releases", q.From)
+	s.Assert().Equal(3, q.Limit)
+	s.Assert().Equal(`(verified = true AND (date >= "2022-01-01" OR NOT size != -1.5))`, q.Where.String())
+
+	q, err = ParseQuery("SELECT * WHERE name = 'it''s' OR stars > 10 OR flag = FALSE")
+	s.Require().Nil(err)
+	s.Assert().Nil(q.Fields)
+	s.Assert().Equal(`((name = "it's" OR stars > 10) OR flag = false)`, q.Where.String())
+
+	for _, query := range []string{
+		"",
+		"name",
+		"SELECT",
+		"SELECT name,",
+		"SELECT name WHERE",
+		"SELECT name WHERE rating >",
+		"SELECT name WHERE (verified",
+		"SELECT name WHERE name = 'abc",
+		"SELECT name LIMIT 0",
+		"SELECT name WHERE rating ! 1",
+		"SELECT name extra",
+		"SELECT from",
+	} {
+		_, err = ParseQuery(query)
+		s.Assert().ErrorIs(err, ErrInvalidQuery, query)
+	}
+}
+
+func (s *QuerySuite) TestObjects() {
+	ra := s.open()
+	res, err := RunQuery(ra, "SELECT name, rating WHERE verified AND date >= '2022-01-01'")
+	s.Require().Nil(err)
+	s.Assert().Equal(QueryResult{Columns: []string{"name", "rating"}, Rows: [][]any{{"dplyr", 4.5}}}, res)
+
+	// Times are compared with dates.
+	res, err = RunQuery(ra, "SELECT name WHERE updated < '2022-01-01' AND rating >= 3 LIMIT 1")
+	s.Require().Nil(err)
+	s.Assert().Equal([][]any{{"plyr"}}, res.Rows)
+
+	res, err = RunQuery(ra, "SELECT * WHERE NOT verified")
+	s.Require().Nil(err)
+	s.Assert().Equal([]string{"name", "rating", "verified", "date", "updated", "releases"}, res.Columns)
+	s.Require().Len(res.Rows, 1)
+	s.Assert().Equal("plyr", res.Rows[0][0])
+}
+
+func (s *QuerySuite) TestElements() {
+	ra := s.open()
+	res, err := RunQuery(ra, "SELECT version, size FROM releases WHERE verified AND date >= '2022-01-01'")
+	s.Require().Nil(err)
+	s.Assert().Equal([][]any{{"2.0", int64(30)}, {"2.1", int64(5)}}, res.Rows)
+
+	res, err = RunQuery(ra, "SELECT * FROM releases LIMIT 5")
+	s.Require().Nil(err)
+	s.Assert().Equal([]string{"version", "date", "verified", "size", "tags"}, res.Columns)
+	s.Assert().Len(res.Rows, 5)
+	s.Assert().Equal("1.0", res.Rows[4][0])
+}
+
+func (s *QuerySuite) TestErrors() {
+	ra := s.open()
+	_, err := RunQuery(ra, "SELECT missing")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+	_, err = RunQuery(ra, "SELECT name WHERE missing")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+	_, err = RunQuery(ra, "SELECT name FROM releases")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+	_, err = RunQuery(ra, "SELECT * FROM name")
+	s.Assert().ErrorContains(err, "field name is not a struct array")
+	_, err = RunQuery(ra, "SELECT * FROM missing")
+	s.Assert().NotNil(err)
+}
+
+func (s *QuerySuite) TestPrintQuery() {
+	out := &bytes.Buffer{}
+	err := PrintQuery(out, s.open(), "SELECT name, rating, tags FROM releases WHERE size > 10")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+
+	out.Reset()
+	err = PrintQuery(out, s.open(), "SELECT version, date, tags FROM releases WHERE size > 10")
+	s.Require().Nil(err)
+	s.Assert().Equal(""+
+		"version  date        tags\n"+
+		"1.1      2022-01-01  []\n"+
+		"2.0      2022-03-15  [new big]\n"+
+		"1.1      2022-01-01  []\n", out.String())
+}
@@ -3,10 +3,15 @@ package rsf
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/ecdh"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"strings"
+	"time"
 )
 
 type rsfReader struct {
@@ -17,19 +22,126 @@ type rsfReader struct {
 	index        Index
 	indexVersion int
 
+	// The index read from the file. This may differ from `index` when
+	// `SetIndex` is used to read with the index of a different struct.
+	fileIndex Index
+
+	// When true, `EndObject` skips fields that are not present in the
+	// index. See `WithIgnoreUnknownFields`.
+	ignoreUnknown bool
+
+	// When true, `ReadBoolField` reads values other than 0 or 1 as false. See
+	// `WithLenientBools`.
+	lenientBools bool
+
+	// Array elements that expire at or before this time are omitted by
+	// `ReadFieldAt`. See `WithExpiry`.
+	expiry time.Time
+
+	// Determines how `ReadFieldAt` returns deleted array elements. See
+	// `WithDeleted`.
+	deleted DeletedMode
+
+	// Determines the order of array elements returned by `ReadFieldAt`. See
+	// `WithElementOrder`.
+	order ElementOrder
+
 	// Saves the current position for advancing the reader.
 	at []string
+
+	// The minimum reader version and flags read from the file header. See
+	// `readHeader`.
+	minVersion    int
+	flags         uint32
+	floatEncoding int
+
+	// The encoding of fields following the file header. See
+	// `WithByteOrder` and `WithVarints`.
+	enc encoding
+
+	// The start position, field offsets, and field name hashes of the
+	// current object. See `BeginObject`.
+	objectStart int
+	objectEnd   int
+	offsets     []int
+	hashes      []uint32
+
+	// Layers provided with `WithLayers`, and the layers listed in the file
+	// header. See `readLayers`.
+	readerLayers []Layer
+	layerIDs     []uint16
+	layers       []Layer
+
+	// Looks up the encryption key identified by the key ID in the file
+	// header. See `WithKeyProvider`.
+	keyProvider KeyProvider
+	keyID       string
+
+	// When true, checksums appended with `Checksum` are removed without
+	// being verified. See `WithoutChecksumVerification`.
+	skipChecksums bool
+
+	// When true, `io.EOF` is returned only after the file trailer. See
+	// `WithRequireComplete`.
+	requireComplete bool
+
+	// Private keys used to decrypt the content key encrypted to each
+	// recipient in the file header. See `WithIdentity`.
+	identities []*ecdh.PrivateKey
+	stanzas    []recipientStanza
+
+	// The decoded payload and end position of the current object when using
+	// layers. See `beginPayload`.
+	payload   *bufio.Reader
+	recordEnd int
+
+	// The parent snapshot recorded in the file header. See `WithParent`.
+	parent Parent
+
+	// Allocates decoded strings and slices, if set. See `WithArena`.
+	arena *Arena
+
+	// Detects use from multiple goroutines in `rsfdebug` builds.
+	owner ownerCheck
+}
+
+// ReaderOption configures optional reader behavior.
+type ReaderOption func(*rsfReader)
+
+// WithIgnoreUnknownFields causes `EndObject` to skip fields that are present in
+// the file but not in the index set with `SetIndex`. This allows older
+// binaries to read files written with newer structs that include additional
+// fields.
+func WithIgnoreUnknownFields() ReaderOption {
+	return func(f *rsfReader) {
+		f.ignoreUnknown = true
+	}
 }
 
-func NewReader() Reader {
-	return &rsfReader{}
+// WithLenientBools causes `ReadBoolField` to read any value other than 1 as
+// false rather than failing with an `ErrInvalidBool` error.
+func WithLenientBools() ReaderOption {
+	return func(f *rsfReader) {
+		f.lenientBools = true
+	}
+}
+
+func NewReader(opts ...ReaderOption) Reader {
+	f := &rsfReader{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 func (f *rsfReader) Pos() int {
+	f.owner.check()
 	return f.pos
 }
 
 func (f *rsfReader) Seek(pos int, r io.Seeker, fieldNames ...string) error {
+	f.owner.check()
+	f.endPayload()
 	i, err := r.Seek(int64(pos), 0)
 	f.pos = int(i)
 	f.at = fieldNames
@@ -37,7 +149,8 @@ func (f *rsfReader) Seek(pos int, r io.Seeker, fieldNames ...string) error {
 }
 
 func (f *rsfReader) Discard(sz int, r *bufio.Reader, fieldNames ...string) error {
-	i, err := r.Discard(sz)
+	f.owner.check()
+	i, err := f.sourceBuf(r).Discard(sz)
 	if err != nil {
 		return err
 	} else if i != sz {
@@ -50,7 +163,20 @@ func (f *rsfReader) Discard(sz int, r *bufio.Reader, fieldNames ...string) error
 	return nil
 }
 
+func (f *rsfReader) CopyRange(offset, length int, r io.ReadSeeker, dst io.Writer) (int, error) {
+	f.owner.check()
+	err := f.Seek(offset, r)
+	if err != nil {
+		return 0, err
+	}
+	i, err := io.CopyN(dst, r, int64(length))
+	f.pos += int(i)
+	return int(i), err
+}
+
 func (f *rsfReader) ReadSizeField(r io.Reader) (int, error) {
+	f.owner.check()
+	r = f.source(r)
 	bs := make([]byte, sizeFieldLen)
 	i, err := io.ReadFull(r, bs)
 	if err != nil {
@@ -59,11 +185,24 @@ func (f *rsfReader) ReadSizeField(r io.Reader) (int, error) {
 		return 0, fmt.Errorf("unexpected read size %d; expected %d", i, sizeFieldLen)
 	}
 	f.pos += i
-	sz := binary.LittleEndian.Uint32(bs)
+	sz := f.byteOrder().Uint32(bs)
 	return int(sz), nil
 }
 
 func (f *rsfReader) ReadIntField(r io.Reader) (int64, error) {
+	f.owner.check()
+	if f.enc.varints {
+		bs, err := f.readVarint(r)
+		if err != nil {
+			return 0, err
+		}
+		val, n := binary.Varint(bs)
+		if n <= 0 {
+			return 0, ErrInvalidVarint
+		}
+		return val, nil
+	}
+	r = f.source(r)
 	bs := make([]byte, sizeInt64)
 	i, err := io.ReadFull(r, bs)
 	if err != nil {
@@ -76,7 +215,56 @@ func (f *rsfReader) ReadIntField(r io.Reader) (int64, error) {
 	return intVal, nil
 }
 
+func (f *rsfReader) ReadIntFieldWidth(width int, r io.Reader) (int64, error) {
+	f.owner.check()
+	val, err := f.readFixedWidth(width, r)
+	if err != nil {
+		return 0, err
+	}
+	// Sign-extend values narrower than 64 bits
+	shift := 64 - 8*width
+	return int64(val<<shift) >> shift, nil
+}
+
+func (f *rsfReader) ReadInt32Field(r io.Reader) (int32, error) {
+	val, err := f.ReadIntFieldWidth(4, r)
+	return int32(val), err
+}
+
+func (f *rsfReader) ReadUint32Field(r io.Reader) (uint32, error) {
+	f.owner.check()
+	val, err := f.readFixedWidth(4, r)
+	return uint32(val), err
+}
+
+func (f *rsfReader) ReadUint64Field(r io.Reader) (uint64, error) {
+	f.owner.check()
+	return f.readFixedWidth(8, r)
+}
+
+// readFixedWidth reads an unsigned integer that is `width` bytes
+// wide. The width must be 1, 2, 4, or 8.
+func (f *rsfReader) readFixedWidth(width int, r io.Reader) (uint64, error) {
+	r = f.source(r)
+	switch width {
+	case 1, 2, 4, 8:
+	default:
+		return 0, fmt.Errorf("invalid integer width %d", width)
+	}
+	bs := make([]byte, 8)
+	i, err := io.ReadFull(r, fixedWidth(f.byteOrder(), bs, width))
+	if err != nil {
+		return 0, err
+	} else if i != width {
+		return 0, fmt.Errorf("unexpected read size %d; expected %d", i, width)
+	}
+	f.pos += i
+	return f.byteOrder().Uint64(bs), nil
+}
+
 func (f *rsfReader) ReadFloatField(r io.Reader) (float64, error) {
+	f.owner.check()
+	r = f.source(r)
 	bs := make([]byte, sizeFloat64)
 	i, err := io.ReadFull(r, bs)
 	if err != nil {
@@ -85,49 +273,70 @@ func (f *rsfReader) ReadFloatField(r io.Reader) (float64, error) {
 		return 0, fmt.Errorf("unexpected read size %d; expected %d", i, sizeFloat64)
 	}
 	f.pos += i
-	return math.Float64frombits(binary.LittleEndian.Uint64(bs)), nil
+	return math.Float64frombits(f.byteOrder().Uint64(bs)), nil
 }
 
 func (f *rsfReader) ReadFixedStringField(sz int, r io.Reader) (string, error) {
-	// Read string field
-	bs := make([]byte, sz)
-	i, err := io.ReadFull(r, bs)
+	f.owner.check()
+	bs, err := f.readFixed(sz, r)
 	if err != nil {
 		return "", err
+	}
+	if emptyFixed(bs) {
+		return "", nil
+	}
+	return f.arena.makeString(bs), nil
+}
+
+// readFixed reads `sz` bytes of a fixed-length string.
+func (f *rsfReader) readFixed(sz int, r io.Reader) ([]byte, error) {
+	r = f.source(r)
+	bs := f.arena.makeBytes(sz)
+	i, err := io.ReadFull(r, bs)
+	if err != nil {
+		return nil, err
 	} else if i != sz {
-		return "", fmt.Errorf("unexpected read size %d; expected %d", i, sz)
+		return nil, fmt.Errorf("unexpected read size %d; expected %d", i, sz)
 	}
 	f.pos += i
+	return bs, nil
+}
 
-	return string(bs), nil
+// readStringKey reads a string key in the index of the indexed array
+// described by `entry`. See `fixedKey`.
+func (f *rsfReader) readStringKey(entry IndexEntry, r io.Reader) (string, error) {
+	bs, err := f.readFixed(entry.IndexSize, r)
+	if err != nil {
+		return "", err
+	}
+	return f.arena.makeString(fixedKey(entry, bs)), nil
 }
 
 func (f *rsfReader) ReadStringField(r io.Reader) (string, error) {
+	f.owner.check()
+	r = f.source(r)
 	// read size
-	bs := make([]byte, sizeFieldLen)
-	i, err := io.ReadFull(r, bs)
+	sz, err := f.readLength(r)
 	if err != nil {
 		return "", err
-	} else if i != sizeFieldLen {
-		return "", fmt.Errorf("unexpected read size %d; expected %d", i, sizeFieldLen)
 	}
-	f.pos += i
 
-	sz := binary.LittleEndian.Uint32(bs)
 	// Read string field
-	bs = make([]byte, sz)
-	i, err = io.ReadFull(r, bs)
+	bs := f.arena.makeBytes(sz)
+	i, err := io.ReadFull(r, bs)
 	if err != nil {
 		return "", err
-	} else if i != int(sz) {
+	} else if i != sz {
 		return "", fmt.Errorf("unexpected read size %d; expected %d", i, sz)
 	}
 	f.pos += i
 
-	return string(bs), nil
+	return f.arena.makeString(bs), nil
 }
 
 func (f *rsfReader) ReadBoolField(r io.Reader) (bool, error) {
+	f.owner.check()
+	r = f.source(r)
 	// Read bool field
 	bs := make([]byte, 1)
 	i, err := io.ReadFull(r, bs)
@@ -136,7 +345,200 @@ func (f *rsfReader) ReadBoolField(r io.Reader) (bool, error) {
 	} else if i != 1 {
 		return false, fmt.Errorf("unexpected read size %d; expected %d", i, 1)
 	}
+	pos := f.pos
 	f.pos += i
+	if bs[0] > 1 && !f.lenientBools {
+		return false, ErrInvalidBool{Value: bs[0], Pos: pos}
+	}
 
 	return bs[0] == 1, nil
 }
+
+// ErrInvalidBool is returned when reading a bool field with a value other than
+// 0 or 1, which usually means that the reader is misaligned with the data.
+type ErrInvalidBool struct {
+	// The value read
+	Value byte
+	// The position of the value
+	Pos int
+}
+
+func (e ErrInvalidBool) Error() string {
+	return fmt.Sprintf("invalid bool value %d at position %d", e.Value, e.Pos)
+}
+
+func (f *rsfReader) ReadChunkedField(r io.Reader) ([]byte, error) {
+	f.owner.check()
+	buf := &bytes.Buffer{}
+	_, err := f.StreamChunkedField(r, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *rsfReader) StreamChunkedField(r io.Reader, w io.Writer) (int, error) {
+	f.owner.check()
+	r = f.source(r)
+	var total int
+	for {
+		// Read chunk size. A zero-size chunk terminates the field.
+		sz, err := f.ReadSizeField(r)
+		if err != nil {
+			return 0, err
+		}
+		if sz == 0 {
+			return total, nil
+		}
+
+		// Copy chunk
+		i, err := io.CopyN(w, r, int64(sz))
+		if err != nil {
+			return 0, err
+		}
+		f.pos += int(i)
+		total += int(i)
+	}
+}
+
+func (f *rsfReader) BeginObject(r io.Reader) (int, error) {
+	f.owner.check()
+	f.endPayload()
+	start := f.pos
+	sz, err := f.ReadSizeField(r)
+	if err != nil {
+		return 0, f.trailerEOF(err)
+	}
+
+	// A zero object size begins the file trailer. See `Finalize`.
+	if sz == 0 {
+		return 0, io.EOF
+	}
+
+	f.objectStart = start
+	f.objectEnd = start + sz
+	f.offsets = nil
+	f.hashes = nil
+	f.at = nil
+	if f.flags&FlagLayers != 0 {
+		err = f.beginPayload(sz, r)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if f.flags&FlagFieldOffsets != 0 {
+		f.offsets, f.hashes, err = f.readFieldOffsets(r)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return sz, nil
+}
+
+func (f *rsfReader) SkipObject(buf *bufio.Reader) (int, error) {
+	f.owner.check()
+	f.endPayload()
+	sz, err := f.ReadSizeField(buf)
+	if err != nil {
+		return 0, f.trailerEOF(err)
+	}
+
+	// A zero object size begins the file trailer. See `Finalize`.
+	if sz == 0 {
+		return 0, io.EOF
+	}
+
+	f.offsets = nil
+	f.hashes = nil
+	f.at = nil
+	err = f.Discard(sz-sizeFieldLen, buf)
+	if err != nil {
+		return 0, err
+	}
+	return sz, nil
+}
+
+var ErrUnknownFields = errors.New("unknown fields")
+
+func (f *rsfReader) EndObject(buf *bufio.Reader) error {
+	f.owner.check()
+	remaining := f.objectEnd - f.pos
+	if remaining < 0 {
+		return fmt.Errorf("unexpected position %d; object end position is %d", f.pos, f.objectEnd)
+	}
+
+	if remaining > 0 {
+		// Find any fields in the file that are not in the index.
+		var unknown []string
+		for _, entry := range f.fileIndex {
+			if _, _, err := entrySet(f.index, entry.FieldName); err != nil {
+				unknown = append(unknown, entry.FieldName)
+			}
+		}
+		if len(unknown) > 0 && !f.ignoreUnknown {
+			return fmt.Errorf("%w %s in object at position %d", ErrUnknownFields, strings.Join(unknown, ", "), f.objectStart)
+		}
+
+		err := f.Discard(remaining, buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.endPayload()
+	f.at = nil
+	return nil
+}
+
+// readFieldOffsets reads a table of field offsets and, if included, field
+// name hashes. See `writeFieldOffsets`.
+func (f *rsfReader) readFieldOffsets(r io.Reader) ([]int, []uint32, error) {
+	count, err := f.ReadSizeField(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hashes []uint32
+	if f.flags&FlagFieldHashes != 0 {
+		hashes = make([]uint32, count)
+	}
+	offsets := make([]int, count)
+	for i := range offsets {
+		if hashes != nil {
+			var hash int
+			hash, err = f.ReadSizeField(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			hashes[i] = uint32(hash)
+		}
+		offsets[i], err = f.ReadSizeField(r)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return offsets, hashes, nil
+}
+
+// fieldOffset returns the offset of a top-level field in the current object,
+// as recorded by the field offset table. When the table includes field name
+// hashes, the field is located by name. Otherwise, the field is located by its
+// position in `index`.
+func (f *rsfReader) fieldOffset(index Index, field string) (int, bool) {
+	if f.hashes != nil {
+		hash := FieldHash(field)
+		for i := range f.hashes {
+			if f.hashes[i] == hash {
+				return f.offsets[i], true
+			}
+		}
+		return 0, false
+	}
+
+	_, pos, err := entrySet(index, field)
+	if err != nil || pos >= len(f.offsets) {
+		return 0, false
+	}
+	return f.offsets[pos], true
+}
@@ -19,7 +19,7 @@ func TestReaderMigrationSuite(t *testing.T) {
 }
 
 func (s *ReaderMigrationSuite) TestAdvanceFields() {
-	buf := bufio.NewReader(getData(s.Suite))
+	buf := bufio.NewReader(getData(&s.Suite))
 	r := NewReader()
 
 	// Read the index
@@ -157,7 +157,7 @@ func (s *ReaderMigrationSuite) TestAdvanceFields() {
 }
 
 func (s *ReaderMigrationSuite) TestAdvanceArray() {
-	buf := bufio.NewReader(getData(s.Suite))
+	buf := bufio.NewReader(getData(&s.Suite))
 	r := NewReader()
 
 	// Read the index
@@ -205,7 +205,7 @@ func (s *ReaderMigrationSuite) TestAdvanceArray() {
 	tmp, err := os.CreateTemp("", "")
 	s.Assert().Nil(err)
 	defer os.Remove(tmp.Name())
-	buf = bufio.NewReader(getData(s.Suite))
+	buf = bufio.NewReader(getData(&s.Suite))
 	_, err = io.Copy(tmp, buf)
 
 	// Seek back to the last array element.
@@ -222,7 +222,7 @@ func (s *ReaderMigrationSuite) TestAdvanceArray() {
 }
 
 func (s *ReaderMigrationSuite) TestAdvanceErrors() {
-	buf := bufio.NewReader(getData(s.Suite))
+	buf := bufio.NewReader(getData(&s.Suite))
 	r := NewReader()
 
 	// Read the index
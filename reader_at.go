@@ -0,0 +1,537 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// ObjectRef locates a top-level object in a file. Use `OpenObject` and
+// `NextObject` to obtain references.
+type ObjectRef struct {
+	// Offset is the position of the object's size field.
+	Offset int64
+	// Size is the full object size, including the size field.
+	Size int
+
+	// The file index and header flags.
+	Index Index
+	Flags uint32
+
+	// The layers used to decode the object. See `Chain`.
+	Layers []Layer
+
+	// When set, `ReadFieldAt` omits expired array elements. See
+	// `WithExpiry`.
+	Expiry time.Time
+
+	// Determines how `ReadFieldAt` returns deleted array elements. See
+	// `WithDeleted`.
+	Deleted DeletedMode
+
+	// Determines the order of array elements returned by `ReadFieldAt`. See
+	// `WithElementOrder`.
+	Order ElementOrder
+}
+
+// OpenObject reads the index at the top of an RSF file and returns a reference
+// to the first object in the file. Reader options, such as `WithLayers`, are
+// used when reading the index.
+func OpenObject(ra io.ReaderAt, opts ...ReaderOption) (ObjectRef, error) {
+	s := NewStatelessReader(ra)
+	f, r := s.at(0)
+	for _, opt := range opts {
+		opt(f)
+	}
+	index, err := f.ReadIndex(r)
+	if err != nil {
+		return ObjectRef{}, err
+	}
+	s.enc = f.enc
+	return s.objectAt(int64(f.pos), ObjectRef{Index: index, Flags: f.flags, Layers: f.layers, Expiry: f.expiry, Deleted: f.deleted, Order: f.order})
+}
+
+// NextObject returns a reference to the object following `obj`. `io.EOF` is
+// returned when no objects remain.
+func NextObject(ra io.ReaderAt, obj ObjectRef) (ObjectRef, error) {
+	return objectReader(ra, obj).objectAt(obj.Offset+int64(obj.Size), obj)
+}
+
+func (s *StatelessReader) objectAt(off int64, obj ObjectRef) (ObjectRef, error) {
+	sz, _, err := s.ReadSizeField(off)
+	if err != nil {
+		return ObjectRef{}, err
+	}
+
+	// A zero object size begins the file trailer. See `Finalize`.
+	if sz == 0 {
+		return ObjectRef{}, io.EOF
+	}
+
+	obj.Offset = off
+	obj.Size = sz
+	return obj, nil
+}
+
+// ReadFieldAt reads the value of the top-level field `field` from the object
+// `obj` without decoding the rest of the object. When the file includes field
+// offsets (see `WithFieldOffsets`), the field is read directly, and is located
+// by name when the file also includes field hashes (see `WithFieldHashes`).
+// Otherwise, the preceding fields are skipped using their size information.
+// Expired array elements are omitted when `obj` was opened using `WithExpiry`,
+// and deleted array elements are omitted unless `obj` was opened using
+// `WithDeleted`. Elements are returned in the order written unless `obj` was
+// opened using `WithElementOrder`.
+//
+// Values are returned as `string`, `bool`, `int64` (see `FieldTypeInt`),
+// `uint64` (see `FieldTypeUint64`), `float64` (see `FieldTypeFloat32`),
+// `time.Time` (see `FieldTypeTime`), or `[]byte` (see `FieldTypeBytes`). Arrays
+// are returned as `[]any`, and struct array elements, struct fields (see
+// `FieldTypeStruct`), and maps (see `FieldTypeMap`) are returned as
+// `map[string]any`. For indexed struct arrays, the key field is populated from
+// the array index, even if it is tagged with `skip`.
+func ReadFieldAt(ra io.ReaderAt, obj ObjectRef, field string) (any, error) {
+	if obj.Flags&FlagLayers != 0 {
+		var err error
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s := objectReader(ra, obj)
+	pos, off, err := s.fieldOffset(obj, field)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := s.readValue(obj.Index[pos], off)
+	if err != nil {
+		return nil, err
+	}
+	return obj.filter(obj.Index[pos], val), nil
+}
+
+// readObjectAt reads all top-level fields of the object `obj`.
+func readObjectAt(ra io.ReaderAt, obj ObjectRef) (map[string]any, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m := make(map[string]any, len(obj.Index))
+	if len(obj.Index) == 0 {
+		return m, nil
+	}
+
+	// Fields are written in index order, so read each field following the
+	// first field.
+	s := objectReader(ra, obj)
+	_, off, err := s.fieldOffset(obj, obj.Index[0].FieldName)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range obj.Index {
+		var val any
+		val, off, err = s.readValue(entry, off)
+		if err != nil {
+			return nil, err
+		}
+		m[entry.FieldName] = obj.filter(entry, val)
+	}
+	return m, nil
+}
+
+// filter applies the expiry and tombstone filters and the element order of
+// `obj` to the value `val` described by `entry`.
+func (obj ObjectRef) filter(entry IndexEntry, val any) any {
+	if segments, ok := val.(map[string]any); ok && entry.FieldType == FieldTypeSegmented {
+		for name, segment := range segments {
+			segments[name] = obj.filter(segmentEntry(entry), segment)
+		}
+		return segments
+	}
+	if fields, ok := val.(map[string]any); ok && entry.FieldType == FieldTypeStruct {
+		for _, subfield := range entry.Subfields {
+			fields[subfield.FieldName] = obj.filter(subfield, fields[subfield.FieldName])
+		}
+		return fields
+	}
+	if !obj.Expiry.IsZero() {
+		val = dropExpired(entry, val, obj.Expiry.Unix())
+	}
+	return sortElements(entry, filterDeleted(entry, val, obj.Deleted), obj.Order)
+}
+
+// fieldOffset returns the index position and file offset of a top-level field.
+func (s *StatelessReader) fieldOffset(obj ObjectRef, field string) (int, int64, error) {
+	_, pos, err := entrySet(obj.Index, field)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Skip the object size field.
+	off := obj.Offset + sizeFieldLen
+
+	if obj.Flags&FlagFieldHashes != 0 {
+		// Locate the field by name
+		var count, hash, fieldOff int
+		count, off, err = s.ReadSizeField(off)
+		if err != nil {
+			return 0, 0, err
+		}
+		for i := 0; i < count; i++ {
+			hash, off, err = s.ReadSizeField(off)
+			if err != nil {
+				return 0, 0, err
+			}
+			fieldOff, off, err = s.ReadSizeField(off)
+			if err != nil {
+				return 0, 0, err
+			}
+			if uint32(hash) == FieldHash(field) {
+				return pos, obj.Offset + int64(fieldOff), nil
+			}
+		}
+		return 0, 0, ErrNoSuchField
+	} else if obj.Flags&FlagFieldOffsets != 0 {
+		// Locate the field by position
+		var count, fieldOff int
+		count, off, err = s.ReadSizeField(off)
+		if err != nil {
+			return 0, 0, err
+		}
+		if pos >= count {
+			return 0, 0, fmt.Errorf("field %s has no offset; object has %d offsets", field, count)
+		}
+		fieldOff, _, err = s.ReadSizeField(off + int64(pos*sizeFieldLen))
+		if err != nil {
+			return 0, 0, err
+		}
+		return pos, obj.Offset + int64(fieldOff), nil
+	}
+
+	for i := 0; i < pos; i++ {
+		off, err = s.skipValue(obj.Index[i], off)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return pos, off, nil
+}
+
+// skipValue returns the offset following the value described by `entry`.
+func (s *StatelessReader) skipValue(entry IndexEntry, off int64) (int64, error) {
+	present, off, err := s.readPresence(entry, off)
+	if err != nil || !present {
+		return off, err
+	}
+	switch entry.FieldType {
+	case FieldTypeFixedStr:
+		return off + int64(entry.FieldSize), nil
+	case FieldTypeVarStr, FieldTypeProvenance, FieldTypeBytes:
+		sz, next, err := s.readLength(off)
+		return next + int64(sz), err
+	case FieldTypeArray, FieldTypeSegmented, FieldTypeStruct, FieldTypeMap:
+		sz, _, err := s.ReadSizeField(off)
+		return off + int64(sz), err
+	case FieldTypeChunked:
+		for {
+			sz, next, err := s.ReadSizeField(off)
+			if err != nil {
+				return 0, err
+			}
+			off = next + int64(sz)
+			if sz == 0 {
+				return off, nil
+			}
+		}
+	case FieldTypeBool, FieldTypeDeleted:
+		return off + 1, nil
+	case FieldTypeInt64, FieldTypeExpiry:
+		_, next, err := s.ReadIntField(off)
+		return next, err
+	case FieldTypeFloat:
+		return off + sizeFloat64, nil
+	case FieldTypeFloat32:
+		return off + sizeFloat32, nil
+	case FieldTypeUint64:
+		return off + sizeUint64, nil
+	case FieldTypeInt:
+		return off + int64(entry.FieldSize), nil
+	case FieldTypeTime:
+		if timeFormat(entry) == timeUnixNano {
+			_, next, err := s.ReadIntField(off)
+			return next, err
+		}
+		return off + int64(entry.FieldSize), nil
+	default:
+		return 0, fmt.Errorf("unexpected index field type %d", entry.FieldType)
+	}
+}
+
+// readValue decodes the value described by `entry` and returns the offset
+// following the value.
+func (s *StatelessReader) readValue(entry IndexEntry, off int64) (any, int64, error) {
+	present, off, err := s.readPresence(entry, off)
+	if err != nil || !present {
+		return nil, off, err
+	}
+	switch entry.FieldType {
+	case FieldTypeFixedStr:
+		return s.ReadFixedStringField(entry.FieldSize, off)
+	case FieldTypeVarStr:
+		return s.ReadStringField(off)
+	case FieldTypeBytes:
+		return s.ReadBytesField(off)
+	case FieldTypeChunked:
+		bs, next, err := s.ReadChunkedField(off)
+		return string(bs), next, err
+	case FieldTypeBool, FieldTypeDeleted:
+		return s.ReadBoolField(off)
+	case FieldTypeInt64, FieldTypeExpiry:
+		return s.ReadIntField(off)
+	case FieldTypeFloat:
+		return s.ReadFloatField(off)
+	case FieldTypeFloat32:
+		return s.readFloat32(off)
+	case FieldTypeUint64:
+		return s.ReadUint64Field(off)
+	case FieldTypeInt:
+		return s.ReadIntFieldWidth(entry.FieldSize, off)
+	case FieldTypeTime:
+		return s.ReadTimeField(entry.FieldSize, off)
+	case FieldTypeArray:
+		return s.readArray(entry, off)
+	case FieldTypeProvenance:
+		return s.readProvenance(off)
+	case FieldTypeSegmented:
+		return s.readSegments(entry, off)
+	case FieldTypeStruct:
+		return s.readStruct(entry, off)
+	case FieldTypeMap:
+		return s.readMap(entry, off)
+	default:
+		return nil, 0, fmt.Errorf("unexpected index field type %d", entry.FieldType)
+	}
+}
+
+// ErrArrayOfArrays is returned when reading an array of arrays written by a
+// version that does not describe the element arrays. Requires Version3 or
+// later. See `IndexEntry.Element`.
+var ErrArrayOfArrays = errors.New("cannot decode arrays of arrays")
+
+func (s *StatelessReader) readArray(entry IndexEntry, off int64) (any, int64, error) {
+	sz, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	end := off + int64(sz)
+
+	arrayLen, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Read the array index keys, if included.
+	var keys []any
+	if entry.Indexed {
+		keys, next, err = s.readKeys(entry, next, arrayLen)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	elEntry, err := elementEntry(entry)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	vals := s.arena.makeAnys(arrayLen)
+	for i := range vals {
+		if next >= end && !entry.emptyElements() {
+			return nil, 0, ErrArrayMismatch{Pos: off, Len: arrayLen, Size: sz, ReadLen: i, ReadSize: int(next - off)}
+		}
+		vals[i], next, err = s.readElement(entry, elEntry, next)
+		if err != nil {
+			return nil, 0, err
+		}
+		if keys != nil {
+			err = setElementKey(entry, vals[i], keys[i])
+			if err != nil {
+				return nil, 0, fmt.Errorf("array %s element %d: %w", entry.FieldName, i, err)
+			}
+		}
+	}
+	if next != end {
+		return nil, 0, ErrArrayMismatch{Pos: off, Len: arrayLen, Size: sz, ReadLen: arrayLen, ReadSize: int(next - off)}
+	}
+
+	return vals, end, nil
+}
+
+// ErrArrayMismatch is returned when the elements read from an array do not
+// match the array's declared length and size.
+type ErrArrayMismatch struct {
+	// The position of the array size field
+	Pos int64
+	// The declared array length and size. The size includes the size and
+	// length fields and the array index.
+	Len  int
+	Size int
+	// The number of elements and bytes read
+	ReadLen  int
+	ReadSize int
+}
+
+func (e ErrArrayMismatch) Error() string {
+	return fmt.Sprintf("array at position %d: read %d of %d elements using %d of %d bytes", e.Pos, e.ReadLen, e.Len, e.ReadSize, e.Size)
+}
+
+func (s *StatelessReader) readElement(entry, elEntry IndexEntry, off int64) (any, int64, error) {
+	if entry.Subfields == nil && !entry.emptyElements() {
+		return s.readValue(elEntry, off)
+	}
+
+	var err error
+	el := make(map[string]any, len(entry.Subfields))
+	for _, subfield := range entry.Subfields {
+		var val any
+		val, off, err = s.readValue(subfield, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Elements without provenance omit it. See `ElementProvenance`.
+		if subfield.FieldType == FieldTypeProvenance && val == nil {
+			continue
+		}
+		el[subfield.FieldName] = val
+	}
+	return el, off, nil
+}
+
+// readKeys reads the keys in the index of an indexed array. Each index entry
+// includes the key and the element size. The returned offset follows the
+// index.
+func (s *StatelessReader) readKeys(entry IndexEntry, off int64, arrayLen int) ([]any, int64, error) {
+	var err error
+	keys := make([]any, arrayLen)
+	for i := range keys {
+		switch reflect.Kind(entry.IndexType) {
+		case reflect.String:
+			keys[i], off, err = s.readStringKey(entry, off)
+		default:
+			keys[i], off, err = s.readIntKey(off)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		// Skip the element size and hash
+		off += int64(entry.indexEntrySize() - entry.IndexSize)
+	}
+	return keys, off, nil
+}
+
+// ErrKeyMismatch is returned when the key field of an indexed array element
+// does not match the element's key in the array index.
+var ErrKeyMismatch = errors.New("key field does not match index key")
+
+// setElementKey populates the key fields of a struct array element from the
+// array index. These are usually fields that are tagged with `skip` since they
+// are stored in the index. If a key field was also written with the element,
+// its value must match the key.
+func setElementKey(entry IndexEntry, el, key any) error {
+	m, ok := el.(map[string]any)
+	if !ok || len(entry.IndexKeys) == 0 {
+		return nil
+	}
+
+	vals := []any{key}
+	if len(entry.IndexKeys) > 1 {
+		var err error
+		vals, err = splitKey(entry.IndexKeys, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, indexKey := range entry.IndexKeys {
+		if val, ok := m[indexKey.FieldName]; ok {
+			if val != vals[i] {
+				return fmt.Errorf("%w: field %s is %v; key is %v", ErrKeyMismatch, indexKey.FieldName, val, vals[i])
+			}
+			continue
+		}
+		m[indexKey.FieldName] = vals[i]
+	}
+	return nil
+}
+
+// splitKey decodes the fields of a composite key, which is a fixed-size string
+// that contains each encoded key field.
+func splitKey(keys []IndexKey, key any) ([]any, error) {
+	s, ok := key.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected composite key type %T", key)
+	}
+	vals := make([]any, len(keys))
+	var pos int
+	for i, k := range keys {
+		if pos+k.KeySize > len(s) {
+			return nil, fmt.Errorf("composite key field %s exceeds key size %d", k.FieldName, len(s))
+		}
+		part := s[pos : pos+k.KeySize]
+		pos += k.KeySize
+		switch reflect.Kind(k.KeyType) {
+		case reflect.String:
+			if emptyFixed([]byte(part)) {
+				part = ""
+			}
+			vals[i] = part
+		default:
+			val, n := binary.Varint([]byte(part))
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid composite key field %s", k.FieldName)
+			}
+			vals[i] = val
+		}
+	}
+	return vals, nil
+}
+
+// elementEntry returns an index entry describing the elements of an array of
+// primitive values.
+func elementEntry(entry IndexEntry) (IndexEntry, error) {
+	if entry.Subfields != nil {
+		return IndexEntry{}, nil
+	}
+
+	if entry.SubfieldType == kindFloat32 {
+		return IndexEntry{FieldType: FieldTypeFloat32}, nil
+	}
+	switch reflect.Kind(entry.SubfieldType) {
+	case reflect.String:
+		return IndexEntry{FieldType: FieldTypeVarStr}, nil
+	case reflect.Bool:
+		return IndexEntry{FieldType: FieldTypeBool}, nil
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		return IndexEntry{FieldType: FieldTypeInt64}, nil
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return IndexEntry{FieldType: FieldTypeUint64}, nil
+	case reflect.Float32, reflect.Float64:
+		return IndexEntry{FieldType: FieldTypeFloat}, nil
+	case reflect.Struct:
+		return IndexEntry{}, nil
+	case reflect.Array, reflect.Slice:
+		if entry.Element != nil {
+			return *entry.Element, nil
+		}
+		return IndexEntry{}, ErrArrayOfArrays
+	default:
+		return IndexEntry{}, fmt.Errorf("unexpected array element type %d", entry.SubfieldType)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ReaderAtSuite struct {
+	suite.Suite
+}
+
+func TestReaderAtSuite(t *testing.T) {
+	suite.Run(t, &ReaderAtSuite{})
+}
+
+func (s *ReaderAtSuite) TestReadFieldAt() {
+	ra := bytes.NewReader(getData(&s.Suite).Bytes())
+
+	obj, err := OpenObject(ra)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(117), obj.Offset)
+	s.Assert().Equal(132, obj.Size)
+
+	rating, err := ReadFieldAt(ra, obj, "rating")
+	s.Assert().Nil(err)
+	s.Assert().Equal(92.689, rating)
+
+	company, err := ReadFieldAt(ra, obj, "company")
+	s.Assert().Nil(err)
+	s.Assert().Equal("posit", company)
+
+	age, err := ReadFieldAt(ra, obj, "age")
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(55), age)
+
+	list, err := ReadFieldAt(ra, obj, "list")
+	s.Assert().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"name": "From 2020", "verified": false},
+		map[string]any{"name": "From 2021", "verified": true},
+		map[string]any{"name": "this is from 2022", "verified": true},
+	}, list)
+
+	_, err = ReadFieldAt(ra, obj, "missing")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+
+	_, err = NextObject(ra, obj)
+	s.Assert().ErrorIs(err, io.EOF)
+}
+
+func (s *ReaderAtSuite) TestReadFieldAtWithOffsets() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithFieldOffsets())
+	for _, obj := range testComplexData {
+		_, err := w.WriteObject(obj)
+		s.Assert().Nil(err)
+	}
+	ra := bytes.NewReader(buf.Bytes())
+
+	obj, err := OpenObject(ra)
+	s.Assert().Nil(err)
+	s.Assert().Equal(FlagFieldOffsets, obj.Flags)
+
+	var names []any
+	for {
+		name, err := ReadFieldAt(ra, obj, "cname")
+		s.Assert().Nil(err)
+		names = append(names, name)
+
+		popularity, err := ReadFieldAt(ra, obj, "popularity")
+		s.Assert().Nil(err)
+		s.Assert().Equal(int64(55), popularity)
+
+		obj, err = NextObject(ra, obj)
+		if err == io.EOF {
+			break
+		}
+		s.Assert().Nil(err)
+	}
+	s.Assert().Equal([]any{"numpy", "django"}, names)
+}
+
+func (s *ReaderAtSuite) TestReadFieldAtArrays() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version2)
+	for _, obj := range testComplexData {
+		_, err := w.WriteObject(obj)
+		s.Assert().Nil(err)
+	}
+	ra := bytes.NewReader(buf.Bytes())
+
+	obj, err := OpenObject(ra)
+	s.Assert().Nil(err)
+	obj, err = NextObject(ra, obj)
+	s.Assert().Nil(err)
+
+	classifiers, err := ReadFieldAt(ra, obj, "classifiers")
+	s.Assert().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"name": "License", "type": int64(2), "values": []any{"one", "two"}},
+		map[string]any{"name": "Usage", "type": int64(1), "values": []any{}},
+	}, classifiers)
+
+	// Arrays of arrays cannot be decoded
+	buf.Reset()
+	w = NewWriterWithVersion(buf, Version2)
+	_, err = w.WriteObject(struct {
+		Arrays [][]string `rsf:"arrays"`
+	}{Arrays: [][]string{{"a"}}})
+	s.Assert().Nil(err)
+	ra = bytes.NewReader(buf.Bytes())
+	obj, err = OpenObject(ra)
+	s.Assert().Nil(err)
+	_, err = ReadFieldAt(ra, obj, "arrays")
+	s.Assert().ErrorIs(err, ErrArrayOfArrays)
+}
+
+func (s *ReaderAtSuite) TestArrayMismatch() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(headerTestObject{Company: "posit", Tags: []string{"a", "b"}})
+	s.Require().Nil(err)
+	data := buf.Bytes()
+
+	obj, err := OpenObject(bytes.NewReader(data))
+	s.Require().Nil(err)
+	// Skip the object size and "posit"
+	arrayPos := obj.Offset + 4 + 9
+	s.Require().Equal(byte(0x12), data[arrayPos])
+	s.Require().Equal(byte(0x2), data[arrayPos+4])
+
+	// Declared length exceeds the array size
+	data[arrayPos+4] = 0x3
+	_, err = ReadFieldAt(bytes.NewReader(data), obj, "tags")
+	s.Assert().Equal(ErrArrayMismatch{Pos: arrayPos, Len: 3, Size: 18, ReadLen: 2, ReadSize: 18}, err)
+	s.Assert().EqualError(err, "array at position 86: read 2 of 3 elements using 18 of 18 bytes")
+
+	// Declared length is short
+	data[arrayPos+4] = 0x1
+	_, err = ReadFieldAt(bytes.NewReader(data), obj, "tags")
+	s.Assert().Equal(ErrArrayMismatch{Pos: arrayPos, Len: 1, Size: 18, ReadLen: 1, ReadSize: 13}, err)
+
+	// The printer also checks arrays
+	err = Print(io.Discard, bufio.NewReader(bytes.NewReader(data)))
+	s.Assert().ErrorContains(err, "array at position 86: read 1 of 1 elements using 13 of 18 bytes")
+}
+
+func (s *ReaderAtSuite) TestReadFieldAtIndexKeys() {
+	type snap struct {
+		Date string `rsf:"date,skip,fixed:10"`
+		Name string `rsf:"name"`
+	}
+	type object struct {
+		List []snap `rsf:"list,index:date"`
+	}
+
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(object{
+		List: []snap{
+			{Date: "2020-10-01", Name: "From 2020"},
+			{Date: "2021-03-21", Name: "From 2021"},
+		},
+	})
+	s.Require().Nil(err)
+
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	s.Assert().Equal([]IndexKey{{FieldName: "date", KeyType: int(reflect.String), KeySize: 10}}, obj.Index[0].IndexKeys)
+	s.Assert().Empty(featureNames(obj.Flags))
+
+	// The skipped date field is populated from the index
+	list, err := ReadFieldAt(ra, obj, "list")
+	s.Assert().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"date": "2020-10-01", "name": "From 2020"},
+		map[string]any{"date": "2021-03-21", "name": "From 2021"},
+	}, list)
+
+	// Key fields that are not skipped must match the index
+	buf.Reset()
+	_, err = NewWriterWithVersion(buf, Version3).WriteObject(channelObject{Items: channelItems})
+	s.Require().Nil(err)
+	data := buf.Bytes()
+	i := bytes.Index(data, []byte("def"))
+	data[i] = 'x'
+	ra = bytes.NewReader(data)
+	obj, err = OpenObject(ra)
+	s.Require().Nil(err)
+	_, err = ReadFieldAt(ra, obj, "items")
+	s.Assert().ErrorIs(err, ErrKeyMismatch)
+	s.Assert().EqualError(err, "array items element 1: key field does not match index key: field key is def; key is xef")
+
+	// Version2 files do not record key fields
+	ra = bytes.NewReader(getData(&s.Suite).Bytes())
+	obj, err = OpenObject(ra)
+	s.Require().Nil(err)
+	list, err = ReadFieldAt(ra, obj, "list")
+	s.Assert().Nil(err)
+	s.Assert().NotContains(list.([]any)[0], "date")
+}
+
+func (s *ReaderAtSuite) TestReadFieldAtCompositeKeys() {
+	type release struct {
+		Date    string `rsf:"date,skip,fixed:10"`
+		Version int64  `rsf:"version,skip"`
+		Name    string `rsf:"name"`
+	}
+	type object struct {
+		Releases []release `rsf:"releases,index:date+version"`
+	}
+
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(object{
+		Releases: []release{
+			{Date: "2020-10-01", Version: 1, Name: "First"},
+			{Date: "2020-10-01", Version: -2, Name: "Second"},
+		},
+	})
+	s.Require().Nil(err)
+
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	s.Assert().Equal(10+sizeInt64, obj.Index[0].IndexSize)
+	s.Assert().Equal([]IndexKey{
+		{FieldName: "date", KeyType: int(reflect.String), KeySize: 10},
+		{FieldName: "version", KeyType: int(reflect.Int64), KeySize: sizeInt64},
+	}, obj.Index[0].IndexKeys)
+
+	// Both skipped key fields are populated from the index
+	releases, err := ReadFieldAt(ra, obj, "releases")
+	s.Assert().Nil(err)
+	s.Assert().Equal([]any{
+		map[string]any{"date": "2020-10-01", "version": int64(1), "name": "First"},
+		map[string]any{"date": "2020-10-01", "version": int64(-2), "name": "Second"},
+	}, releases)
+}
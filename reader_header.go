@@ -0,0 +1,190 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReaderVersion is the newest format version supported by this reader. Files
+// that require a newer reader fail with an `ErrUnsupportedVersion` error.
+const ReaderVersion = 3
+
+// ErrUnsupportedVersion is returned when reading a file that requires a newer
+// reader.
+type ErrUnsupportedVersion struct {
+	// The minimum reader version required by the file
+	Need int
+	// The version supported by this reader. See `ReaderVersion`.
+	Have int
+}
+
+func (e ErrUnsupportedVersion) Error() string {
+	return fmt.Sprintf("file requires reader version %d or later; this reader supports version %d", e.Need, e.Have)
+}
+
+// supportedFlags are the header flags supported by this reader.
+const supportedFlags = FlagFieldOffsets | FlagFieldHashes | FlagCompression | FlagChecksums | FlagDigest | FlagLayers | FlagElementHashes | FlagKeyID | FlagRecipients | FlagParent | FlagObjectTable | FlagBigEndian | FlagVarints | FlagTrailer
+
+// ErrUnsupportedFeature is returned when reading a file that uses features
+// that are not supported by this reader.
+type ErrUnsupportedFeature struct {
+	// The unsupported header flags
+	Flags uint32
+}
+
+func (e ErrUnsupportedFeature) Error() string {
+	return fmt.Sprintf("file uses unsupported features: %s", strings.Join(featureNames(e.Flags), ", "))
+}
+
+// Header describes the file header. For files written before Version3, only
+// the version is recorded, and the minimum reader version is the same as the
+// version.
+type Header struct {
+	// The index version
+	Version int
+	// The minimum reader version required to read the file
+	MinReaderVersion int
+	// Flags declaring the optional features used by the file
+	Flags uint32
+	// The IDs of the layers applied to each object, in the order applied.
+	// See `Chain`.
+	Layers []uint16
+	// The float encoding. See `FloatIEEE754`.
+	FloatEncoding int
+	// The ID of the key used to encrypt each object, if recorded. See
+	// `AESGCMWithKeyID`.
+	KeyID string
+	// The parent snapshot, if recorded. See `WithParent`.
+	Parent Parent
+}
+
+// Features returns the names of the optional features used by the file.
+func (h Header) Features() []string {
+	return featureNames(h.Flags)
+}
+
+func featureNames(flags uint32) []string {
+	names := make([]string, 0)
+	for _, f := range flagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+			flags &^= f.flag
+		}
+	}
+	for bit := 0; flags != 0; bit++ {
+		if flags&(1<<bit) != 0 {
+			names = append(names, fmt.Sprintf("unknown(%d)", bit))
+			flags &^= 1 << bit
+		}
+	}
+	return names
+}
+
+func (f *rsfReader) Header() Header {
+	f.owner.check()
+	h := Header{
+		Version:          f.indexVersion,
+		MinReaderVersion: f.minVersion,
+		Flags:            f.flags,
+		Layers:           f.layerIDs,
+		FloatEncoding:    f.floatEncoding,
+		KeyID:            f.keyID,
+		Parent:           f.parent,
+	}
+	if f.indexVersion < Version3 {
+		h.MinReaderVersion = f.indexVersion
+	}
+	if h.FloatEncoding == 0 {
+		h.FloatEncoding = FloatIEEE754
+	}
+	return h
+}
+
+// readHeader reads the file header written by Version3 and later. See
+// `writeHeader`. Any header fields following the known fields are discarded.
+func (f *rsfReader) readHeader(r io.Reader) error {
+	start := f.pos
+	sz, err := f.ReadSizeField(r)
+	if err != nil {
+		return err
+	}
+
+	minVersion, err := f.ReadSizeField(r)
+	if err != nil {
+		return err
+	}
+	if minVersion > ReaderVersion {
+		return ErrUnsupportedVersion{Need: minVersion, Have: ReaderVersion}
+	}
+	f.minVersion = minVersion
+
+	flags, err := f.ReadSizeField(r)
+	if err != nil {
+		return err
+	}
+	f.flags = uint32(flags)
+	if unsupported := f.flags &^ supportedFlags; unsupported != 0 {
+		return ErrUnsupportedFeature{Flags: unsupported}
+	}
+
+	if f.flags&FlagLayers != 0 {
+		err = f.readLayers(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	if start+sz-f.pos < sizeFieldLen {
+		return errors.New("file header is missing the float encoding")
+	}
+	f.floatEncoding, err = f.ReadSizeField(r)
+	if err != nil {
+		return err
+	}
+	if f.floatEncoding > FloatIEEE754Finite {
+		return fmt.Errorf("unsupported float encoding %d", f.floatEncoding)
+	}
+
+	if f.flags&FlagKeyID != 0 {
+		f.keyID, err = f.ReadStringField(r)
+		if err != nil {
+			return err
+		}
+	}
+	if f.flags&FlagRecipients != 0 {
+		err = f.readRecipients(r)
+		if err != nil {
+			return err
+		}
+	}
+	if f.flags&FlagParent != 0 {
+		err = f.readParent(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Layers are resolved once the key ID is known.
+	if f.flags&FlagLayers != 0 {
+		f.layers, err = f.resolveLayers(f.layerIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Discard unknown header fields
+	remaining := start + sz - f.pos
+	if remaining < 0 {
+		return fmt.Errorf("unexpected header position %d; header max pos reported is %d", f.pos, start+sz)
+	}
+	i, err := io.CopyN(io.Discard, r, int64(remaining))
+	if err != nil {
+		return err
+	}
+	f.pos += int(i)
+
+	return nil
+}
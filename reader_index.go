@@ -8,12 +8,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
 )
 
 type Index []IndexEntry
 
 const Top = ""
 
+// IndexKey describes a field of an array index key. Composite keys have
+// multiple fields, and are encoded as a fixed-size string that contains each
+// field in order. Index keys are recorded by Version3 and later.
+type IndexKey struct {
+	FieldName string
+	KeyType   int
+	KeySize   int
+}
+
 type IndexEntry struct {
 	FieldName    string
 	FieldType    int
@@ -21,15 +31,52 @@ type IndexEntry struct {
 	Indexed      bool
 	IndexSize    int
 	IndexType    int
+	IndexKeys    []IndexKey
 	SubfieldType int
 	Subfields    Index
+
+	// Sensitive is true for fields tagged with `sensitive`, which are
+	// redacted by `Redact`.
+	Sensitive bool
+
+	// Optional is true for pointer fields, which are prefixed with a
+	// presence marker. See `fieldTypeOptional`.
+	Optional bool
+
+	// ElementHashes is true when the index of an indexed array includes
+	// element hashes. See `WithElementHashes`.
+	ElementHashes bool
+
+	// Element describes the elements of an array of arrays, which are
+	// themselves arrays. Requires Version3 or later.
+	Element *IndexEntry
+}
+
+// indexEntrySize returns the size of each entry in the index of an indexed
+// array, which includes the key, the element size, and the element hash, if
+// included.
+func (e IndexEntry) indexEntrySize() int {
+	sz := e.IndexSize + sizeFieldLen
+	if e.ElementHashes {
+		sz += sizeElementHash
+	}
+	return sz
+}
+
+// emptyElements returns true for arrays of structs without fields, such as
+// structs whose fields are all skipped. Their elements are written without
+// data, so only the array length describes them.
+func (e IndexEntry) emptyElements() bool {
+	return e.Subfields == nil && reflect.Kind(e.SubfieldType) == reflect.Struct
 }
 
 func (f *rsfReader) SetIndex(newIndex Index) {
+	f.owner.check()
 	f.index = newIndex
 }
 
 func (f *rsfReader) ReadIndex(r io.Reader) (Index, error) {
+	f.owner.check()
 	var err error
 
 	// Peek at the first three bytes to see if an index version is included
@@ -44,9 +91,20 @@ func (f *rsfReader) ReadIndex(r io.Reader) (Index, error) {
 
 	// If the first three bytes equal an index version, then record the
 	// index version.
-	if bytes.Equal(header, IndexVersion2) {
+	if bytes.Equal(header, IndexVersion3) {
+		f.indexVersion = 3
+		f.pos += 3
+		err = f.readHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		f.enc = flagsEncoding(f.flags)
+	} else if bytes.Equal(header, IndexVersion2) {
 		f.indexVersion = 2
 		f.pos += 3
+	} else if bytes.Equal(header[:2], IndexVersion3[:2]) && header[2] > IndexVersion3[2] && header[2] <= '9' {
+		// A newer index version that this reader cannot read.
+		return nil, ErrUnsupportedVersion{Need: int(header[2] - '0'), Have: ReaderVersion}
 	} else {
 		f.indexVersion = 1
 	}
@@ -80,9 +138,30 @@ func (f *rsfReader) ReadIndex(r io.Reader) (Index, error) {
 	// Position when done reading index will be the current reader position +
 	// the index size, minus the size field length, since we've already read it.
 	f.index, err = f.readIndexEntries(r, f.pos+sz-sizeFieldLen, 0)
+	f.fileIndex = f.index
 	return f.index, err
 }
 
+// IndexOf returns the index that would be written for the struct `v`. This
+// is useful with `SetIndex` to read a file using the fields of a struct that
+// may differ from the struct used to write the file.
+func IndexOf(v any) (Index, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot create index for non-struct type %v", t)
+	}
+
+	w := &rsfWriter{version: Version3}
+	buf := &bytes.Buffer{}
+	_, err := w.writeIndexObject(t, &tag{}, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &rsfReader{indexVersion: Version3, flags: w.flags}
+	return f.readIndexEntries(buf, buf.Len(), 0)
+}
+
 func (f *rsfReader) readIndexEntries(r io.Reader, finalPos, limit int) (Index, error) {
 	var err error
 
@@ -114,13 +193,24 @@ func (f *rsfReader) readIndexEntries(r io.Reader, finalPos, limit int) (Index, e
 		if err != nil {
 			return nil, err
 		}
+		var sensitive bool
+		if f.indexVersion > 2 && fieldType&fieldTypeSensitive != 0 {
+			sensitive = true
+			fieldType &^= fieldTypeSensitive
+		}
+		var optional bool
+		if f.indexVersion > 2 && fieldType&fieldTypeOptional != 0 {
+			optional = true
+			fieldType &^= fieldTypeOptional
+		}
 
 		// For arrays, read the count of the number of subfields.
 		var subfieldCount int
 		var indexed bool
 		var arrayFieldType int
 		var indexSize, indexType int
-		if fieldType == FieldTypeArray {
+		var indexKeys []IndexKey
+		if fieldType == FieldTypeArray || fieldType == FieldTypeSegmented {
 
 			// Older indexes didn't include the following two fields
 			if f.indexVersion >= 2 {
@@ -139,6 +229,13 @@ func (f *rsfReader) readIndexEntries(r io.Reader, finalPos, limit int) (Index, e
 					if err != nil {
 						return nil, err
 					}
+
+					if f.indexVersion > 2 {
+						indexKeys, err = f.readIndexKeys(r)
+						if err != nil {
+							return nil, err
+						}
+					}
 				}
 
 				arrayFieldType, err = f.ReadSizeField(r)
@@ -148,15 +245,30 @@ func (f *rsfReader) readIndexEntries(r io.Reader, finalPos, limit int) (Index, e
 
 			}
 
+			subfieldCount, err = f.ReadSizeField(r)
+			if err != nil {
+				return nil, err
+			}
+		} else if fieldType == FieldTypeStruct {
+			subfieldCount, err = f.ReadSizeField(r)
+			if err != nil {
+				return nil, err
+			}
+		} else if fieldType == FieldTypeMap {
+			arrayFieldType, err = f.ReadSizeField(r)
+			if err != nil {
+				return nil, err
+			}
 			subfieldCount, err = f.ReadSizeField(r)
 			if err != nil {
 				return nil, err
 			}
 		}
 
-		// For fixed-length strings, read the string size.
+		// For fixed-length strings, times, and narrow integers, read the field
+		// size.
 		var fieldSize int
-		if fieldType == FieldTypeFixedStr {
+		if fieldType == FieldTypeFixedStr || fieldType == FieldTypeTime || fieldType == FieldTypeInt {
 			fieldSize, err = f.ReadSizeField(r)
 			if err != nil {
 				return nil, err
@@ -178,6 +290,8 @@ func (f *rsfReader) readIndexEntries(r io.Reader, finalPos, limit int) (Index, e
 			}
 		}
 
+		element, subfields := f.nestedElement(fieldType, arrayFieldType, subfields)
+
 		// Append the index entry, including any subfields.
 		entries = append(entries, IndexEntry{
 			FieldName:    fieldName,
@@ -188,37 +302,91 @@ func (f *rsfReader) readIndexEntries(r io.Reader, finalPos, limit int) (Index, e
 			Indexed:      indexed,
 			IndexSize:    indexSize,
 			IndexType:    indexType,
+			IndexKeys:    indexKeys,
+			Sensitive:    sensitive,
+			Optional:     optional,
+
+			ElementHashes: indexed && f.flags&FlagElementHashes != 0,
+			Element:       element,
 		})
 	}
 
 	return entries, nil
 }
 
+// readIndexKeys reads the fields of an array index key. See `IndexKey`.
+func (f *rsfReader) readIndexKeys(r io.Reader) ([]IndexKey, error) {
+	count, err := f.ReadSizeField(r)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	keys := make([]IndexKey, count)
+	for i := range keys {
+		keys[i].FieldName, err = f.ReadStringField(r)
+		if err != nil {
+			return nil, err
+		}
+		keys[i].KeyType, err = f.ReadSizeField(r)
+		if err != nil {
+			return nil, err
+		}
+		keys[i].KeySize, err = f.ReadSizeField(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
 func (f *rsfReader) advance(advField IndexEntry, buf *bufio.Reader) error {
 	var err error
+	if advField.Optional {
+		var present bool
+		present, err = f.ReadBoolField(buf)
+		if err != nil || !present {
+			return err
+		}
+	}
 	switch advField.FieldType {
 	case FieldTypeFixedStr:
 		err = f.Discard(advField.FieldSize, buf)
-	case FieldTypeArray:
+	case FieldTypeArray, FieldTypeSegmented, FieldTypeStruct, FieldTypeMap:
 		var sz int
 		sz, err = f.ReadSizeField(buf)
 		if err != nil {
 			return err
 		}
 		err = f.Discard(sz-sizeFieldLen, buf)
-	case FieldTypeVarStr:
+	case FieldTypeVarStr, FieldTypeProvenance, FieldTypeBytes:
 		var sz int
-		sz, err = f.ReadSizeField(buf)
+		sz, err = f.readLength(buf)
 		if err != nil {
 			return err
 		}
 		err = f.Discard(sz, buf)
-	case FieldTypeBool:
+	case FieldTypeChunked:
+		_, err = f.StreamChunkedField(buf, io.Discard)
+	case FieldTypeBool, FieldTypeDeleted:
 		err = f.Discard(1, buf)
-	case FieldTypeInt64:
-		err = f.Discard(sizeInt64, buf)
+	case FieldTypeInt64, FieldTypeExpiry:
+		err = f.discardInt(buf)
 	case FieldTypeFloat:
 		err = f.Discard(sizeFloat64, buf)
+	case FieldTypeFloat32:
+		err = f.Discard(sizeFloat32, buf)
+	case FieldTypeUint64:
+		err = f.Discard(sizeUint64, buf)
+	case FieldTypeInt:
+		err = f.Discard(advField.FieldSize, buf)
+	case FieldTypeTime:
+		if timeFormat(advField) == timeUnixNano {
+			err = f.discardInt(buf)
+		} else {
+			err = f.Discard(advField.FieldSize, buf)
+		}
 	default:
 		return fmt.Errorf("unexpected index field type %d", advField.FieldType)
 	}
@@ -229,6 +397,26 @@ func (f *rsfReader) advance(advField IndexEntry, buf *bufio.Reader) error {
 var ErrNoSuchField = errors.New("field not found")
 
 func (f *rsfReader) AdvanceTo(buf *bufio.Reader, fieldNames ...string) error {
+	f.owner.check()
+
+	// When the current object includes field offsets, jump directly to
+	// top-level fields.
+	if len(fieldNames) == 1 && f.offsets != nil {
+		_, _, err := entrySet(f.index, fieldNames...)
+		if err != nil {
+			return err
+		}
+		offset, ok := f.fieldOffset(f.index, fieldNames[0])
+		if f.hashes != nil && !ok {
+			return ErrNoSuchField
+		}
+		if ok && f.objectStart+offset >= f.pos {
+			return f.Discard(f.objectStart+offset-f.pos, buf, fieldNames...)
+		} else if ok && f.hashes != nil {
+			return fmt.Errorf("cannot advance to field %s at position %d from position %d", fieldNames[0], f.objectStart+offset, f.pos)
+		}
+	}
+
 	at := f.at
 	if len(fieldNames) < len(at) {
 		at = f.at[:len(fieldNames)]
@@ -260,6 +448,7 @@ func (f *rsfReader) AdvanceTo(buf *bufio.Reader, fieldNames ...string) error {
 }
 
 func (f *rsfReader) AdvanceToNextElement(buf *bufio.Reader, fieldNames ...string) error {
+	f.owner.check()
 	from, fromPos, err := entrySet(f.index, f.at...)
 	if err != nil {
 		return err
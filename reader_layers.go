@@ -0,0 +1,200 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WithLayers provides layers used to decode files written with `Chain`. The
+// decode chain is constructed from the layers listed in the file header, so
+// only layers that require configuration, such as `AESGCM`, need to be
+// provided. Other layers are resolved from the codecs registered with
+// `RegisterCodec`. A provided layer replaces a registered codec with the same
+// ID.
+func WithLayers(layers ...Layer) ReaderOption {
+	return func(f *rsfReader) {
+		f.readerLayers = append(f.readerLayers, layers...)
+	}
+}
+
+// WithDecryptionKey provides the key used to decrypt files written with
+// `WithEncryption` or `AESGCM`, like `WithLayers(AESGCM(key))`. Objects are
+// decrypted transparently when they are read, and an error is returned if
+// the key is wrong or the data was modified.
+func WithDecryptionKey(key []byte) ReaderOption {
+	return WithLayers(AESGCM(key))
+}
+
+// WithoutChecksumVerification causes checksums appended to each object with
+// `Checksum` or `WithChecksums` to be removed without being verified, e.g.,
+// to recover data from a damaged file or to avoid the cost of verification
+// for files known to be intact. A `Checksum` layer provided with `WithLayers`
+// still verifies checksums.
+func WithoutChecksumVerification() ReaderOption {
+	return func(f *rsfReader) {
+		f.skipChecksums = true
+	}
+}
+
+// A KeyProvider returns the encryption key with the given ID, e.g., from a key
+// management service. Files that do not record a key ID, including files
+// written with `AESGCM`, use an empty key ID.
+type KeyProvider interface {
+	Key(keyID string) ([]byte, error)
+}
+
+// KeyProviderFunc adapts a function to a `KeyProvider`.
+type KeyProviderFunc func(keyID string) ([]byte, error)
+
+func (fn KeyProviderFunc) Key(keyID string) ([]byte, error) {
+	return fn(keyID)
+}
+
+// WithKeyProvider provides keys used to decrypt files written with
+// `AESGCMWithKeyID` or `AESGCM`. The key is looked up with the key ID recorded
+// in the file header, so files encrypted with different keys can be read
+// without configuring each key. A layer provided with `WithLayers` takes
+// precedence over the key provider.
+func WithKeyProvider(p KeyProvider) ReaderOption {
+	return func(f *rsfReader) {
+		f.keyProvider = p
+	}
+}
+
+// resolveLayers returns the layers to use for decoding the given layer IDs.
+func (f *rsfReader) resolveLayers(ids []uint16) ([]Layer, error) {
+	layers := make([]Layer, 0, len(ids))
+ids:
+	for _, id := range ids {
+		for _, l := range f.readerLayers {
+			if l.ID() == id {
+				layers = append(layers, l)
+				continue ids
+			}
+		}
+		if id == LayerChecksum && f.skipChecksums {
+			layers = append(layers, checksumLayer{skip: true})
+			continue
+		}
+		if id == LayerX25519 {
+			l, err := f.identityLayer()
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, l)
+			continue
+		}
+		if id == LayerAESGCM && f.keyProvider != nil {
+			key, err := f.keyProvider.Key(f.keyID)
+			if err != nil {
+				return nil, fmt.Errorf("error getting key %q: %w", f.keyID, err)
+			}
+			layers = append(layers, AESGCM(key))
+			continue
+		}
+		_, err := lookupCodec(id)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, CodecLayer(id))
+	}
+	return layers, nil
+}
+
+// readLayers reads the layer IDs recorded in the file header. See
+// `writeHeader`.
+func (f *rsfReader) readLayers(r io.Reader) error {
+	count, err := f.ReadSizeField(r)
+	if err != nil {
+		return err
+	}
+	f.layerIDs = make([]uint16, count)
+	for i := range f.layerIDs {
+		var id int
+		id, err = f.ReadSizeField(r)
+		if err != nil {
+			return err
+		}
+		f.layerIDs[i] = uint16(id)
+	}
+	return nil
+}
+
+// beginPayload reads and decodes the payload of an object of size `sz` whose
+// size field has already been read. Until the object ends, reads are served
+// from the decoded payload, and positions are reported as though the decoded
+// payload followed the object size field.
+func (f *rsfReader) beginPayload(sz int, r io.Reader) error {
+	raw := make([]byte, sz-sizeFieldLen)
+	_, err := io.ReadFull(r, raw)
+	if err != nil {
+		return err
+	}
+	decoded, err := decodeLayers(f.layers, raw)
+	if err != nil {
+		return fmt.Errorf("error decoding object at position %d: %w", f.objectStart, err)
+	}
+
+	f.recordEnd = f.objectStart + sz
+	f.objectEnd = f.pos + len(decoded)
+	f.payload = bufio.NewReader(bytes.NewReader(decoded))
+	return nil
+}
+
+// endPayload stops reading from the decoded payload of the current object, if
+// any, and positions the reader at the end of the encoded object.
+func (f *rsfReader) endPayload() {
+	if f.payload != nil {
+		f.payload = nil
+		f.pos = f.recordEnd
+	}
+}
+
+// source returns the reader to read object data from, which is the decoded
+// payload of the current object when using layers.
+func (f *rsfReader) source(r io.Reader) io.Reader {
+	if f.payload != nil {
+		return f.payload
+	}
+	return r
+}
+
+func (f *rsfReader) sourceBuf(buf *bufio.Reader) *bufio.Reader {
+	if f.payload != nil {
+		return f.payload
+	}
+	return buf
+}
+
+// decodeObjectAt decodes the object `obj` in a file written with `Chain`. It
+// returns a reader containing only the decoded object and a reference to the
+// object within that reader.
+func decodeObjectAt(ra io.ReaderAt, obj ObjectRef) (io.ReaderAt, ObjectRef, error) {
+	raw := make([]byte, obj.Size-sizeFieldLen)
+	// Objects without fields may have an empty payload at the end of the
+	// file, so `io.EOF` is expected when nothing is left to read.
+	n, err := ra.ReadAt(raw, obj.Offset+sizeFieldLen)
+	if err != nil && (n != len(raw) || !errors.Is(err, io.EOF)) {
+		return nil, ObjectRef{}, err
+	}
+	decoded, err := decodeLayers(obj.Layers, raw)
+	if err != nil {
+		return nil, ObjectRef{}, fmt.Errorf("error decoding object at position %d: %w", obj.Offset, err)
+	}
+
+	buf := &bytes.Buffer{}
+	w := &rsfWriter{enc: flagsEncoding(obj.Flags)}
+	_, err = w.WriteSizeField(0, len(decoded)+sizeFieldLen, buf)
+	if err != nil {
+		return nil, ObjectRef{}, err
+	}
+	buf.Write(decoded)
+
+	obj.Offset = 0
+	obj.Size = buf.Len()
+	return bytes.NewReader(buf.Bytes()), obj, nil
+}
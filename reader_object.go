@@ -0,0 +1,389 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadObject reads the next top-level object into the struct pointed to by `v`,
+// using the same `rsf` struct tags as `WriteObject`. The index is read first,
+// if needed. Fields are matched by name, so fields in the file that are not in
+// the struct are skipped, and struct fields that are not in the file are left
+// unchanged. Fields that declare a default value with `default` (e.g.,
+// `rsf:"tier,default:standard"`) are set to the default when they are not in
+// the file, or when their value is absent (see `omitempty`). Key fields of
+// indexed arrays are populated from the array index, even if they are tagged
+// with `skip`. Files written before Version3 do not record the key fields, and
+// Version1 files do not record which arrays are indexed, so they are taken from
+// the `index` tags of `v`. Expired and deleted array elements are omitted as
+// with `ReadFieldAt`. The elements of a segmented array are read into a single
+// slice in segment order, and empty arrays are read as nil slices. `io.EOF` is
+// returned when no objects remain.
+//
+// The object is read into memory before it is decoded, and the reader is
+// positioned at the end of the object when ReadObject returns.
+func (f *rsfReader) ReadObject(r io.Reader, v any) error {
+	f.owner.check()
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot read object into %T; a non-nil struct pointer is required", v)
+	}
+
+	if f.fileIndex == nil && f.pos == 0 {
+		_, err := f.ReadIndex(r)
+		if err != nil {
+			return err
+		}
+	}
+	index := f.fileIndex
+	if index == nil {
+		index = f.index
+	} else if f.indexVersion < Version3 {
+		index = withStructKeys(index, rv.Elem().Type(), f.indexVersion)
+	}
+
+	_, err := f.BeginObject(r)
+	if err != nil {
+		return err
+	}
+
+	// Read the remaining object data, which follows the field offset table,
+	// if any.
+	data := make([]byte, f.objectEnd-f.pos)
+	i, err := io.ReadFull(f.source(r), data)
+	f.pos += i
+	if err != nil {
+		return err
+	}
+	f.endPayload()
+	f.at = nil
+
+	s := NewStatelessReader(bytes.NewReader(data))
+	s.arena = f.arena
+	s.enc = f.enc
+	obj := ObjectRef{Expiry: f.expiry, Deleted: f.deleted, Order: f.order}
+	fields := make(map[string]any, len(index))
+	var off int64
+	for _, entry := range index {
+		var val any
+		val, off, err = s.readValue(entry, off)
+		if err != nil {
+			return fmt.Errorf("error reading field %s: %w", entry.FieldName, err)
+		}
+		fields[entry.FieldName] = obj.filter(entry, val)
+	}
+
+	return setValue(rv.Elem(), fields)
+}
+
+// ReadObjectInto reads the next top-level object from `r` into a new value of
+// the struct type T using `reader`, which tracks the index and position
+// between objects. See `ReadObject`.
+//
+//	pkg, err := ReadObjectInto[Package](reader, buf)
+func ReadObjectInto[T any](reader Reader, r io.Reader) (T, error) {
+	var v T
+	err := reader.ReadObject(r, &v)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// structIndexes caches the index of each struct type read by `ReadObject`
+// from files written before Version3. See `withStructKeys`.
+var structIndexes sync.Map
+
+// withStructKeys returns a copy of the file index `index` that describes the
+// indexed arrays of the struct type `t`. Files written before Version3 do not
+// record the key fields of indexed arrays, and Version1 files do not record
+// which arrays are indexed, so they are taken from the `index` tags of `t`.
+// The index is returned as is if `t` does not have a valid index.
+func withStructKeys(index Index, t reflect.Type, version int) Index {
+	structIndex, ok := structIndexes.Load(t)
+	if !ok {
+		var err error
+		structIndex, err = IndexOf(reflect.Zero(t).Interface())
+		if err != nil {
+			structIndex = Index(nil)
+		}
+		structIndexes.Store(t, structIndex)
+	}
+	return mergeIndexKeys(index, structIndex.(Index), version)
+}
+
+// mergeIndexKeys copies the keys of indexed arrays in `structIndex` to the
+// entries of `index` with the same names.
+func mergeIndexKeys(index, structIndex Index, version int) Index {
+	merged := make(Index, len(index))
+	for i, entry := range index {
+		merged[i] = entry
+		for _, structEntry := range structIndex {
+			if structEntry.FieldName != entry.FieldName {
+				continue
+			}
+			if entry.FieldType == FieldTypeArray && structEntry.Indexed {
+				if version < Version2 {
+					merged[i].Indexed = true
+					merged[i].IndexType = structEntry.IndexType
+					merged[i].IndexSize = structEntry.IndexSize
+				}
+				if merged[i].Indexed && merged[i].IndexKeys == nil && merged[i].IndexSize == structEntry.IndexSize {
+					merged[i].IndexKeys = structEntry.IndexKeys
+				}
+			}
+			if entry.Subfields != nil {
+				merged[i].Subfields = mergeIndexKeys(entry.Subfields, structEntry.Subfields, version)
+			}
+			break
+		}
+	}
+	return merged
+}
+
+// planField maps an `rsf` struct tag name to a struct field.
+type planField struct {
+	name  string
+	index int
+
+	// The value of a field that is missing or absent in the file, if
+	// declared. See `rsfDefault`.
+	def reflect.Value
+
+	// The size of a fixed-length `Unmarshaler` field. Its data is read as an
+	// empty string when all bytes are zero, so the zero bytes are restored
+	// before calling `UnmarshalRSF`. See `emptyFixed`.
+	fixed int
+}
+
+// cachedPlan records the fields of a struct type, or an error if a field
+// declares an invalid default value.
+type cachedPlan struct {
+	fields []planField
+	err    error
+}
+
+// decodePlans caches the fields of each struct type read by `ReadObject`.
+var decodePlans sync.Map
+
+// decodePlan returns the struct fields of `t` that can be read, which are the
+// exported fields with an `rsf` struct tag name.
+func decodePlan(t reflect.Type) ([]planField, error) {
+	if plan, ok := decodePlans.Load(t); ok {
+		return plan.(cachedPlan).fields, plan.(cachedPlan).err
+	}
+	var plan cachedPlan
+	for i := 0; i < t.NumField(); i++ {
+		rawTag := t.Field(i).Tag.Get(tagName)
+		name, opts, _ := strings.Cut(rawTag, rsfDelim)
+		if name == "" || rawTag == rsfIgnore || !t.Field(i).IsExported() {
+			continue
+		}
+		field := planField{name: name, index: i}
+		field.def, plan.err = parseDefault(t.Field(i).Type, opts)
+		if plan.err != nil {
+			plan.err = fmt.Errorf("field %s: %w", name, plan.err)
+			break
+		}
+		if reflect.PointerTo(t.Field(i).Type).Implements(unmarshalerType) {
+			ft := &tag{}
+			if _, _, err := parseTag(t, i, ft); err == nil {
+				field.fixed = ft.fixed
+			}
+		}
+		plan.fields = append(plan.fields, field)
+	}
+	decodePlans.Store(t, plan)
+	return plan.fields, plan.err
+}
+
+// setValue sets `v` to the decoded value `val`, which is a value returned by
+// `readValue`. Struct fields are set from `map[string]any` values using their
+// `rsf` struct tag names.
+func setValue(v reflect.Value, val any) error {
+	if v.Kind() == reflect.Pointer {
+		if val == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		err := setValue(p.Elem(), val)
+		if err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if val == nil {
+		return nil
+	}
+	if deleted, ok := val.(DeletedElement); ok {
+		val = deleted.Element
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+		return unmarshalValue(v, val)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			tm, ok := val.(time.Time)
+			if !ok {
+				return fmt.Errorf("cannot read %T into %s", val, v.Type())
+			}
+			v.Set(reflect.ValueOf(tm))
+			return nil
+		}
+		m, ok := val.(map[string]any)
+		if !ok {
+			return fmt.Errorf("cannot read %T into %s", val, v.Type())
+		}
+		fields, err := decodePlan(v.Type())
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			fieldVal, ok := m[field.name]
+			if (!ok || fieldVal == nil) && field.def.IsValid() {
+				setDefault(v.Field(field.index), field.def)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if field.fixed > 0 && fieldVal == "" {
+				fieldVal = string(make([]byte, field.fixed))
+			}
+			err = setValue(v.Field(field.index), fieldVal)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.name, err)
+			}
+		}
+	case reflect.Map:
+		m, ok := val.(map[string]any)
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot read %T into %s", val, v.Type())
+		}
+		if len(m) == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(m)))
+		for key, mapVal := range m {
+			el := reflect.New(v.Type().Elem()).Elem()
+			err := setValue(el, mapVal)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", key, err)
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), el)
+		}
+	case reflect.Array, reflect.Slice:
+		if isBytes(v.Type()) {
+			// Chunked fields are read as strings
+			var bs []byte
+			switch val := val.(type) {
+			case []byte:
+				bs = val
+			case string:
+				bs = []byte(val)
+			default:
+				return fmt.Errorf("cannot read %T into %s", val, v.Type())
+			}
+			if len(bs) == 0 {
+				bs = nil
+			}
+			v.SetBytes(bs)
+			return nil
+		}
+		vals, err := arrayValues(val)
+		if err != nil {
+			return fmt.Errorf("cannot read %T into %s", val, v.Type())
+		}
+		if v.Kind() == reflect.Slice && len(vals) == 0 {
+			v.Set(reflect.Zero(v.Type()))
+		} else if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(vals), len(vals)))
+		} else if len(vals) > v.Len() {
+			return fmt.Errorf("cannot read %d elements into %s", len(vals), v.Type())
+		}
+		for i := range vals {
+			err = setValue(v.Index(i), vals[i])
+			if err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+	case reflect.String:
+		s, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("cannot read %T into %s", val, v.Type())
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := val.(bool)
+		if !ok {
+			return fmt.Errorf("cannot read %T into %s", val, v.Type())
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		i, ok := val.(int64)
+		if !ok {
+			return fmt.Errorf("cannot read %T into %s", val, v.Type())
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("value %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		u, ok := val.(uint64)
+		if !ok {
+			return fmt.Errorf("cannot read %T into %s", val, v.Type())
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("value %d overflows %s", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		fl, ok := val.(float64)
+		if !ok {
+			return fmt.Errorf("cannot read %T into %s", val, v.Type())
+		}
+		v.SetFloat(fl)
+	default:
+		return fmt.Errorf("cannot read %T into %s", val, v.Type())
+	}
+	return nil
+}
+
+// arrayValues returns the elements of a decoded array. The segments of a
+// segmented array are combined in segment order.
+func arrayValues(val any) ([]any, error) {
+	switch vals := val.(type) {
+	case []any:
+		return vals, nil
+	case map[string]any:
+		names := make([]string, 0, len(vals))
+		for name := range vals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var combined []any
+		for _, name := range names {
+			segment, ok := vals[name].([]any)
+			if !ok {
+				return nil, fmt.Errorf("unexpected segment type %T", vals[name])
+			}
+			combined = append(combined, segment...)
+		}
+		return combined, nil
+	default:
+		return nil, fmt.Errorf("unexpected array type %T", val)
+	}
+}
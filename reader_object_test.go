@@ -0,0 +1,193 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ReaderObjectSuite struct {
+	suite.Suite
+}
+
+func TestReaderObjectSuite(t *testing.T) {
+	suite.Run(t, &ReaderObjectSuite{})
+}
+
+var testClassifiers = []Classifier{
+	{Name: "License", Type: 2, Values: []string{"MIT"}},
+	{Name: "Topic", Type: 1, Values: []string{"Science", "Math"}},
+}
+
+func (s *ReaderObjectSuite) TestReadObject() {
+	// Fields tagged with `-` are not read
+	expected := make([]FullPackageRecordPyPI, len(testComplexData))
+	for i, obj := range testComplexData {
+		expected[i] = obj
+		expected[i].Snapshots = make([]FullManifestSnapshotPyPI, len(obj.Snapshots))
+		for j, snap := range obj.Snapshots {
+			snap.CanonicalName = ""
+			snap.ProjectName = ""
+			expected[i].Snapshots[j] = snap
+		}
+	}
+
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldHashes()},
+		{Chain(Zstd(), Checksum())},
+	} {
+		buf := &bytes.Buffer{}
+		w := NewWriterWithVersion(buf, Version3, append(opts, WithDigest())...)
+		for _, obj := range testComplexData {
+			_, err := w.WriteObject(obj)
+			s.Require().Nil(err)
+		}
+		_, err := w.Finalize()
+		s.Require().Nil(err)
+
+		// The index is read automatically
+		r := NewReader()
+		br := bufio.NewReader(buf)
+		var actual []FullPackageRecordPyPI
+		for {
+			var obj FullPackageRecordPyPI
+			err = r.ReadObject(br, &obj)
+			if err == io.EOF {
+				break
+			}
+			s.Require().Nil(err)
+			actual = append(actual, obj)
+		}
+		s.Assert().Equal(expected, actual)
+	}
+}
+
+func (s *ReaderObjectSuite) TestReadObjectFields() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(testComplexData[0])
+	s.Require().Nil(err)
+
+	// Only fields in the struct are read, and other struct fields are
+	// unchanged.
+	type snapshot struct {
+		Snapshot string `rsf:"snapshot,skip"`
+		Version  string `rsf:"version"`
+	}
+	type record struct {
+		Name      string     `rsf:"cname"`
+		Missing   string     `rsf:"missing"`
+		Snapshots []snapshot `rsf:"snapshots"`
+	}
+	r := NewReader()
+	br := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	obj := record{Missing: "unchanged"}
+	err = r.ReadObject(br, &obj)
+	s.Require().Nil(err)
+	expected := record{Name: "numpy", Missing: "unchanged"}
+	for _, snap := range testComplexData[0].Snapshots {
+		expected.Snapshots = append(expected.Snapshots, snapshot{Snapshot: snap.Snapshot, Version: snap.Version})
+	}
+	s.Assert().Equal(expected, obj)
+	s.Assert().Equal(buf.Len(), r.Pos())
+
+	// Mismatched types fail
+	var invalid struct {
+		Name int64 `rsf:"cname"`
+	}
+	r = NewReader()
+	err = r.ReadObject(bufio.NewReader(bytes.NewReader(buf.Bytes())), &invalid)
+	s.Assert().EqualError(err, "field cname: cannot read string into int64")
+
+	err = r.ReadObject(br, obj)
+	s.Assert().EqualError(err, "cannot read object into rsf.record; a non-nil struct pointer is required")
+}
+
+func (s *ReaderObjectSuite) TestReadObjectVersions() {
+	type release struct {
+		Version string `rsf:"version,skip,fixed:3"`
+		Date    string `rsf:"date"`
+	}
+	type pkg struct {
+		Name     string    `rsf:"name"`
+		Releases []release `rsf:"releases,index:version"`
+		Count    int64     `rsf:"count"`
+	}
+	data := []pkg{
+		{Name: "plyr", Releases: []release{{Version: "1.0", Date: "2023-01-01"}, {Version: "1.1", Date: "2023-02-01"}}, Count: 2},
+		{Name: "dplyr", Releases: []release{{Version: "2.0", Date: "2023-03-01"}}, Count: 1},
+	}
+
+	// Files written before Version3 do not record the key fields of
+	// indexed arrays, and Version1 files do not record which arrays are
+	// indexed, so they are taken from the struct tags.
+	for _, version := range []int{Version1, Version2, Version3} {
+		buf := &bytes.Buffer{}
+		w := NewWriterWithVersion(buf, version)
+		for _, obj := range data {
+			_, err := w.WriteObject(obj)
+			s.Require().Nil(err)
+		}
+
+		s.Assert().Nil(CheckCompatibility(pkg{}, bytes.NewReader(buf.Bytes())), "version %d", version)
+
+		r := NewReader()
+		br := bufio.NewReader(buf)
+		for _, expected := range data {
+			var actual pkg
+			err := r.ReadObject(br, &actual)
+			s.Require().Nil(err, "version %d", version)
+			s.Assert().Equal(expected, actual, "version %d", version)
+		}
+		err := r.ReadObject(br, &pkg{})
+		s.Assert().Equal(io.EOF, err)
+	}
+}
+
+func (s *ReaderObjectSuite) TestReadObjectSegments() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(segmentData)
+	s.Require().Nil(err)
+
+	var obj segmentRepo
+	err = NewReader().ReadObject(bufio.NewReader(buf), &obj)
+	s.Require().Nil(err)
+	s.Assert().Equal(segmentRepo{
+		Packages: []segmentPkg{
+			segmentData.Packages[1],
+			segmentData.Packages[0],
+			segmentData.Packages[2],
+		},
+		Count: 3,
+	}, obj)
+}
+
+func (s *ReaderObjectSuite) TestReadObjectInto() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range testClassifiers {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+
+	r := NewReader()
+	br := bufio.NewReader(buf)
+	for _, expected := range testClassifiers {
+		obj, err := ReadObjectInto[Classifier](r, br)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, obj)
+	}
+	obj, err := ReadObjectInto[Classifier](r, br)
+	s.Assert().ErrorIs(err, io.EOF)
+	s.Assert().Equal(Classifier{}, obj)
+
+	_, err = ReadObjectInto[string](NewReader(), bufio.NewReader(&bytes.Buffer{}))
+	s.Assert().EqualError(err, "cannot read object into *string; a non-nil struct pointer is required")
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// StatelessReader reads RSF fields at explicit offsets. Each Read* method
+// accepts the offset of the field and returns the offset immediately
+// following the field, so no position is tracked between calls.
+//
+// Since a StatelessReader holds no mutable state, it is safe for concurrent
+// use provided that the underlying io.ReaderAt is also safe for concurrent use
+// (e.g., *os.File or *bytes.Reader). Use it instead of the Reader returned by
+// NewReader when reading a file from multiple goroutines.
+type StatelessReader struct {
+	ra io.ReaderAt
+
+	// Allocates decoded strings and slices, if set. See `WithArena`.
+	arena *Arena
+
+	// The encoding of the file. See `WithByteOrder` and `WithVarints`.
+	enc encoding
+}
+
+func NewStatelessReader(ra io.ReaderAt) *StatelessReader {
+	return &StatelessReader{ra: ra}
+}
+
+// at returns a single-use reader positioned at `off`, along with a section
+// reader that reads from the same offset.
+func (s *StatelessReader) at(off int64) (*rsfReader, io.Reader) {
+	return &rsfReader{pos: int(off), arena: s.arena, enc: s.enc}, io.NewSectionReader(s.ra, off, math.MaxInt64-off)
+}
+
+func (s *StatelessReader) ReadSizeField(off int64) (int, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadSizeField(r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadFixedStringField(sz int, off int64) (string, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadFixedStringField(sz, r)
+	return val, int64(f.pos), err
+}
+
+// readStringKey reads a string key of the array index at `off`, and returns the
+// offset following the key.
+func (s *StatelessReader) readStringKey(entry IndexEntry, off int64) (string, int64, error) {
+	f, r := s.at(off)
+	val, err := f.readStringKey(entry, r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadStringField(off int64) (string, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadStringField(r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadBoolField(off int64) (bool, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadBoolField(r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadIntField(off int64) (int64, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadIntField(r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadIntFieldWidth(width int, off int64) (int64, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadIntFieldWidth(width, r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadInt32Field(off int64) (int32, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadInt32Field(r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadUint32Field(off int64) (uint32, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadUint32Field(r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadUint64Field(off int64) (uint64, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadUint64Field(r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadFloatField(off int64) (float64, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadFloatField(r)
+	return val, int64(f.pos), err
+}
+
+func (s *StatelessReader) ReadChunkedField(off int64) ([]byte, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadChunkedField(r)
+	return val, int64(f.pos), err
+}
+
+// ReadIndex reads the object index at `off`, which is usually zero. The
+// returned offset is the position of the first object.
+func (s *StatelessReader) ReadIndex(off int64) (Index, int64, error) {
+	f, r := s.at(off)
+	val, err := f.ReadIndex(r)
+	return val, int64(f.pos), err
+}
+
+// CopyRange copies `length` bytes starting at `off` to `dst` without decoding
+// them. The returned offset is the end of the range.
+func (s *StatelessReader) CopyRange(off int64, length int, dst io.Writer) (int64, error) {
+	i, err := io.Copy(dst, io.NewSectionReader(s.ra, off, int64(length)))
+	if err != nil {
+		return 0, err
+	} else if i != int64(length) {
+		return 0, fmt.Errorf("unexpected copy size %d; expected %d", i, length)
+	}
+	return off + i, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type StatelessReaderSuite struct {
+	suite.Suite
+}
+
+func TestStatelessReaderSuite(t *testing.T) {
+	suite.Run(t, &StatelessReaderSuite{})
+}
+
+func (s *StatelessReaderSuite) TestRead() {
+	r := NewStatelessReader(bytes.NewReader(getData(&s.Suite).Bytes()))
+
+	// Read the index
+	index, off, err := r.ReadIndex(0)
+	s.Assert().Nil(err)
+	s.Assert().Len(index, 5)
+	s.Assert().Equal(int64(117), off)
+
+	// Record should be 132 bytes in length
+	recordSz, off, err := r.ReadSizeField(off)
+	s.Assert().Nil(err)
+	s.Assert().Equal(132, recordSz)
+	s.Assert().Equal(int64(121), off)
+
+	// Company
+	company, off, err := r.ReadStringField(off)
+	s.Assert().Nil(err)
+	s.Assert().Equal("posit", company)
+	s.Assert().Equal(int64(130), off)
+
+	// Ready
+	ready, off, err := r.ReadBoolField(off)
+	s.Assert().Nil(err)
+	s.Assert().True(ready)
+	s.Assert().Equal(int64(131), off)
+
+	// Skip the array using its size
+	arraySz, _, err := r.ReadSizeField(off)
+	s.Assert().Nil(err)
+	s.Assert().Equal(100, arraySz)
+	off += int64(arraySz)
+
+	// Age
+	age, off, err := r.ReadIntField(off)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(55), age)
+	s.Assert().Equal(int64(241), off)
+
+	// Rating
+	rating, off, err := r.ReadFloatField(off)
+	s.Assert().Nil(err)
+	s.Assert().Equal(92.689, rating)
+	s.Assert().Equal(int64(249), off)
+
+	// The first array index entry
+	date, off, err := r.ReadFixedStringField(10, 139)
+	s.Assert().Nil(err)
+	s.Assert().Equal("2020-10-01", date)
+	s.Assert().Equal(int64(149), off)
+
+	// Reading past the end of the data fails
+	_, _, err = r.ReadSizeField(249)
+	s.Assert().NotNil(err)
+}
+
+func (s *StatelessReaderSuite) TestConcurrentRead() {
+	r := NewStatelessReader(bytes.NewReader(getData(&s.Suite).Bytes()))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			company, _, err := r.ReadStringField(121)
+			if err == nil && company != "posit" {
+				err = ErrNoSuchField
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		s.Assert().Nil(err)
+	}
+}
+
+func (s *StatelessReaderSuite) TestCopyRange() {
+	r := NewStatelessReader(bytes.NewReader(getData(&s.Suite).Bytes()))
+
+	dst := &bytes.Buffer{}
+	off, err := r.CopyRange(209, 22, dst)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(231), off)
+	s.Assert().Equal(22, dst.Len())
+
+	_, err = r.CopyRange(240, 20, dst)
+	s.Assert().ErrorContains(err, "unexpected copy size 9; expected 20")
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -26,7 +27,7 @@ func (s *ReaderSuite) TestNewReader() {
 
 // This method returns the same data used by `TestWriteObjectWithArrayIndex`
 // in `writer_test.go`.
-func getData(s suite.Suite) *bytes.Buffer {
+func getData(s *suite.Suite) *bytes.Buffer {
 	buf := &bytes.Buffer{}
 	w := NewWriterWithVersion(buf, Version2)
 
@@ -81,7 +82,7 @@ func getData(s suite.Suite) *bytes.Buffer {
 }
 
 func (s *ReaderSuite) TestRead() {
-	buf := bufio.NewReader(getData(s.Suite))
+	buf := bufio.NewReader(getData(&s.Suite))
 	r := NewReader()
 
 	// Read the index
@@ -256,7 +257,7 @@ func (s *ReaderSuite) TestRead() {
 	tmp, err := os.CreateTemp("", "")
 	s.Assert().Nil(err)
 	defer os.Remove(tmp.Name())
-	buf = bufio.NewReader(getData(s.Suite))
+	buf = bufio.NewReader(getData(&s.Suite))
 	_, err = io.Copy(tmp, buf)
 
 	// Seek back to the last array element.
@@ -274,3 +275,253 @@ func (s *ReaderSuite) TestRead() {
 	// 209+21=230
 	s.Assert().Equal(230, r.Pos())
 }
+
+func (s *ReaderSuite) TestReadChunkedField() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version2)
+	_, err := w.WriteChunkedField(0, 4, strings.NewReader("package-manager"), buf)
+	s.Assert().Nil(err)
+	_, err = w.WriteChunkedField(0, 4, strings.NewReader("streamed"), buf)
+	s.Assert().Nil(err)
+
+	r := NewReader()
+	val, err := r.ReadChunkedField(buf)
+	s.Assert().Nil(err)
+	s.Assert().Equal("package-manager", string(val))
+	// 3 chunks of size 4 (4+4)*3=24, a chunk of size 3 (4+3)=7, plus a
+	// 4-byte terminator
+	s.Assert().Equal(35, r.Pos())
+
+	streamed := &bytes.Buffer{}
+	sz, err := r.StreamChunkedField(buf, streamed)
+	s.Assert().Nil(err)
+	s.Assert().Equal(8, sz)
+	s.Assert().Equal("streamed", streamed.String())
+	s.Assert().Equal(55, r.Pos())
+
+	// Truncated data
+	buf.Reset()
+	_, err = w.WriteChunkedField(0, 4, strings.NewReader("package-manager"), buf)
+	s.Assert().Nil(err)
+	_, err = r.ReadChunkedField(bytes.NewReader(buf.Bytes()[:10]))
+	s.Assert().ErrorIs(err, io.ErrUnexpectedEOF)
+}
+
+func (s *ReaderSuite) TestReadBoolField() {
+	data := []byte{0x1, 0x0, 0x2}
+
+	r := NewReader()
+	buf := bytes.NewReader(data)
+	val, err := r.ReadBoolField(buf)
+	s.Assert().Nil(err)
+	s.Assert().True(val)
+	val, err = r.ReadBoolField(buf)
+	s.Assert().Nil(err)
+	s.Assert().False(val)
+	_, err = r.ReadBoolField(buf)
+	s.Assert().Equal(ErrInvalidBool{Value: 2, Pos: 2}, err)
+	s.Assert().EqualError(err, "invalid bool value 2 at position 2")
+	s.Assert().Equal(3, r.Pos())
+
+	// Lenient
+	r = NewReader(WithLenientBools())
+	buf = bytes.NewReader(data[2:])
+	val, err = r.ReadBoolField(buf)
+	s.Assert().Nil(err)
+	s.Assert().False(val)
+	s.Assert().Equal(1, r.Pos())
+
+	// Stateless
+	_, _, err = NewStatelessReader(bytes.NewReader(data)).ReadBoolField(2)
+	s.Assert().Equal(ErrInvalidBool{Value: 2, Pos: 2}, err)
+}
+
+func (s *ReaderSuite) TestReadFixedWidthIntFields() {
+	data := []byte{
+		// -2 as an int32
+		0xfe, 0xff, 0xff, 0xff,
+		// 4294967294 as a uint32
+		0xfe, 0xff, 0xff, 0xff,
+		// 18446744073709551614 as a uint64
+		0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		// -2 as an int16
+		0xfe, 0xff,
+		// 127 as an int8
+		0x7f,
+	}
+
+	r := NewReader()
+	buf := bytes.NewReader(data)
+	i32, err := r.ReadInt32Field(buf)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int32(-2), i32)
+	u32, err := r.ReadUint32Field(buf)
+	s.Assert().Nil(err)
+	s.Assert().Equal(uint32(4294967294), u32)
+	u64, err := r.ReadUint64Field(buf)
+	s.Assert().Nil(err)
+	s.Assert().Equal(uint64(18446744073709551614), u64)
+	i16, err := r.ReadIntFieldWidth(2, buf)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(-2), i16)
+	i8, err := r.ReadIntFieldWidth(1, buf)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(127), i8)
+	s.Assert().Equal(len(data), r.Pos())
+
+	_, err = r.ReadIntFieldWidth(3, buf)
+	s.Assert().EqualError(err, "invalid integer width 3")
+	_, err = r.ReadUint64Field(bytes.NewReader(data[:7]))
+	s.Assert().ErrorIs(err, io.ErrUnexpectedEOF)
+
+	// Stateless
+	i64, next, err := NewStatelessReader(bytes.NewReader(data)).ReadIntFieldWidth(8, 8)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(-2), i64)
+	s.Assert().Equal(int64(16), next)
+}
+
+func (s *ReaderSuite) TestSkipObject() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithFieldOffsets(), WithDigest())
+	for _, company := range []string{"posit", "rstudio", "cran"} {
+		_, err := w.WriteObject(headerTestObject{Company: company, Tags: []string{company}})
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+
+	r := NewReader()
+	b := bufio.NewReader(buf)
+	_, err = r.ReadIndex(b)
+	s.Require().Nil(err)
+
+	// Skip to the third object
+	sz, err := r.SkipObject(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal(54, sz)
+	sz, err = r.SkipObject(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal(58, sz)
+	_, err = r.BeginObject(b)
+	s.Assert().Nil(err)
+	company, err := r.ReadStringField(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal("cran", company)
+
+	// The trailer follows the last object
+	err = r.EndObject(b)
+	s.Assert().Nil(err)
+	_, err = r.SkipObject(b)
+	s.Assert().ErrorIs(err, io.EOF)
+}
+
+func (s *ReaderSuite) TestIgnoreUnknownFields() {
+	type legacy struct {
+		Company string `rsf:"company"`
+		Ready   bool   `rsf:"ready"`
+	}
+	type current struct {
+		Company  string   `rsf:"company"`
+		Ready    bool     `rsf:"ready"`
+		Location string   `rsf:"location"`
+		Tags     []string `rsf:"tags"`
+	}
+
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version2)
+	for _, obj := range []current{
+		{Company: "posit", Ready: true, Location: "Boston", Tags: []string{"a", "b"}},
+		{Company: "rstudio", Location: "Seattle"},
+	} {
+		_, err := w.WriteObject(obj)
+		s.Assert().Nil(err)
+	}
+	data := buf.Bytes()
+
+	index, err := IndexOf(legacy{})
+	s.Assert().Nil(err)
+	s.Assert().Equal(Index{
+		{FieldName: "company", FieldType: FieldTypeVarStr},
+		{FieldName: "ready", FieldType: FieldTypeBool},
+	}, index)
+
+	_, err = IndexOf("test")
+	s.Assert().ErrorContains(err, "cannot create index for non-struct type string")
+
+	read := func(r Reader) ([]legacy, error) {
+		b := bufio.NewReader(bytes.NewReader(data))
+		_, err := r.ReadIndex(b)
+		s.Assert().Nil(err)
+		r.SetIndex(index)
+
+		var results []legacy
+		for {
+			_, err = r.BeginObject(b)
+			if err == io.EOF {
+				return results, nil
+			}
+			s.Assert().Nil(err)
+
+			var obj legacy
+			err = r.AdvanceTo(b, "company")
+			s.Assert().Nil(err)
+			obj.Company, err = r.ReadStringField(b)
+			s.Assert().Nil(err)
+			err = r.AdvanceTo(b, "ready")
+			s.Assert().Nil(err)
+			obj.Ready, err = r.ReadBoolField(b)
+			s.Assert().Nil(err)
+			results = append(results, obj)
+
+			err = r.EndObject(b)
+			if err != nil {
+				return results, err
+			}
+		}
+	}
+
+	// By default, unknown fields result in an error.
+	results, err := read(NewReader())
+	s.Assert().ErrorIs(err, ErrUnknownFields)
+	s.Assert().ErrorContains(err, "unknown fields location, tags in object at position 72")
+	s.Assert().Len(results, 1)
+
+	// Skip unknown fields
+	results, err = read(NewReader(WithIgnoreUnknownFields()))
+	s.Assert().Nil(err)
+	s.Assert().Equal([]legacy{
+		{Company: "posit", Ready: true},
+		{Company: "rstudio"},
+	}, results)
+}
+
+func (s *ReaderSuite) TestCopyRange() {
+	data := bytes.NewReader(getData(&s.Suite).Bytes())
+	r := NewReader()
+
+	// Copy the last "list" array element
+	dst := &bytes.Buffer{}
+	sz, err := r.CopyRange(209, 22, data, dst)
+	s.Assert().Nil(err)
+	s.Assert().Equal(22, sz)
+	s.Assert().Equal(231, r.Pos())
+
+	// The copied element can be decoded
+	name, err := NewReader().ReadStringField(dst)
+	s.Assert().Nil(err)
+	s.Assert().Equal("this is from 2022", name)
+
+	// Continue reading from the end of the range
+	age, err := r.ReadIntField(data)
+	s.Assert().Nil(err)
+	s.Assert().Equal(int64(55), age)
+	s.Assert().Equal(241, r.Pos())
+
+	// Copying past the end of the data
+	dst.Reset()
+	sz, err = r.CopyRange(240, 20, data, dst)
+	s.Assert().ErrorIs(err, io.EOF)
+	s.Assert().Equal(9, sz)
+	s.Assert().Equal(249, r.Pos())
+}
@@ -0,0 +1,240 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+var (
+	ErrNoTrailer      = errors.New("file trailer not found")
+	ErrDigestMismatch = errors.New("file digest does not match trailer digest")
+
+	// ErrIncomplete is returned when a file whose header declares a trailer
+	// ends without one, e.g., because the writer stopped before calling
+	// `Finalize`. See `WithCompletionMarker`.
+	ErrIncomplete = errors.New("file is incomplete; trailer not found")
+)
+
+// The maximum trailer size. See `Finalize`.
+const maxTrailerLen = trailerFixedLen + sha256.Size
+
+// VerifyStream wraps `r` and computes a digest of the data as it is read. When
+// the end of the stream is reached, the digest is compared to the digest in
+// the file trailer written by `Finalize` when using `WithDigest`. The returned
+// reader does not return the trailer bytes, and returns `ErrDigestMismatch`
+// instead of `io.EOF` if the digests do not match or `ErrNoTrailer` if no
+// trailer is found. A trailer without a digest (see `WithCompletionMarker`)
+// only shows that the stream is complete.
+//
+// Since the final bytes of the stream are held back until the trailer is
+// verified, consumers receive all data except the trailer before the digest is
+// checked. Consumers should discard any results if the stream ends with an
+// error.
+func VerifyStream(r io.Reader) io.Reader {
+	return &verifyingReader{
+		r:    r,
+		hash: sha256.New(),
+		buf:  make([]byte, 32*1024),
+	}
+}
+
+type verifyingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	buf  []byte
+
+	// Bytes that have been read but not yet returned. Up to `maxTrailerLen`
+	// bytes are held back until the end of the stream.
+	tail []byte
+
+	// Set when the end of the stream is reached. `end` is the length of
+	// `tail` that precedes the trailer.
+	done bool
+	end  int
+	err  error
+
+	// The trailer digest, once verified.
+	digest []byte
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	for {
+		// Return data that cannot be part of the trailer.
+		var available int
+		if v.done {
+			available = v.end
+		} else {
+			available = len(v.tail) - maxTrailerLen
+		}
+		if available > 0 {
+			n := copy(p, v.tail[:available])
+			if v.done {
+				v.end -= n
+			} else {
+				_, _ = v.hash.Write(v.tail[:n])
+			}
+			v.tail = v.tail[n:]
+			return n, nil
+		} else if v.done {
+			return 0, v.err
+		}
+
+		n, err := v.r.Read(v.buf)
+		if n > 0 {
+			v.tail = append(v.tail, v.buf[:n]...)
+		}
+		if err == io.EOF {
+			v.done = true
+			v.end, v.err = v.verify()
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// verify is called at the end of the stream, when `tail` holds the trailer and
+// any preceding data that has not been returned. It returns the length of the
+// preceding data and the error to return at the end of the stream.
+func (v *verifyingReader) verify() (int, error) {
+	end, algorithm, digest, err := parseTrailer(v.tail)
+	if err != nil {
+		return len(v.tail), err
+	}
+
+	// Everything preceding the trailer must be hashed, including data that
+	// has already been returned.
+	_, err = v.hash.Write(v.tail[:end])
+	if err != nil {
+		return end, err
+	}
+	if algorithm == DigestNone {
+		return end, io.EOF
+	} else if algorithm != DigestSHA256 {
+		return end, fmt.Errorf("unsupported digest algorithm %d", algorithm)
+	}
+	if !bytes.Equal(v.hash.Sum(nil), digest) {
+		return end, ErrDigestMismatch
+	}
+	v.digest = digest
+	return end, io.EOF
+}
+
+// VerifyFile checks that the digest of the file `ra`, which is `size` bytes
+// long, matches the digest in the file trailer written by `Finalize` when
+// using `WithDigest`. Unlike `VerifyStream`, the file is verified before any
+// data is returned, so corrupted files can be rejected before decoding. An
+// error wrapping `ErrDigestMismatch` is returned if the digests do not match,
+// or `ErrNoTrailer` if no trailer is found. Files with a trailer without a
+// digest (see `WithCompletionMarker`) are not checked further.
+//
+//	info, err := f.Stat()
+//	err = VerifyFile(f, info.Size())
+func VerifyFile(ra io.ReaderAt, size int64) error {
+	n := min(size, maxTrailerLen)
+	if n < trailerFixedLen {
+		return ErrNoTrailer
+	}
+	bs := make([]byte, n)
+	_, err := ra.ReadAt(bs, size-n)
+	if err != nil {
+		return err
+	}
+	pos, algorithm, digest, err := parseTrailer(bs)
+	if err != nil {
+		return err
+	}
+	if algorithm == DigestNone {
+		return nil
+	} else if algorithm != DigestSHA256 {
+		return fmt.Errorf("unsupported digest algorithm %d", algorithm)
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, io.NewSectionReader(ra, 0, size-n+int64(pos)))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Sum(nil), digest) {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// CheckComplete checks that the file `ra`, which is `size` bytes long, was
+// completed by `Finalize`. Files written with `WithCompletionMarker` or
+// `WithDigest` end with a trailer, and `ErrIncomplete` is returned if it is
+// missing, e.g., because the writer stopped while appending objects. The
+// digest is verified as with `VerifyFile`, if included. `ErrNoTrailer` is
+// returned for files that do not declare a trailer, since their completeness
+// cannot be determined. Reader options are used as with `OpenObject`.
+//
+//	info, err := f.Stat()
+//	err = CheckComplete(f, info.Size())
+func CheckComplete(ra io.ReaderAt, size int64, opts ...ReaderOption) error {
+	f, r := NewStatelessReader(ra).at(0)
+	for _, opt := range opts {
+		opt(f)
+	}
+	_, err := f.ReadIndex(r)
+	if err != nil {
+		return err
+	}
+	if f.flags&(FlagDigest|FlagTrailer) == 0 {
+		return ErrNoTrailer
+	}
+	err = VerifyFile(ra, size)
+	if errors.Is(err, ErrNoTrailer) {
+		return ErrIncomplete
+	}
+	return err
+}
+
+// WithRequireComplete causes the Reader to return `ErrIncomplete` rather than
+// `io.EOF` when a file whose header declares a trailer (see
+// `WithCompletionMarker` and `WithDigest`) ends without one, so consumers can
+// tell a complete file from one whose writer stopped mid-stream. Since
+// `VerifyStream` removes the trailer, do not use this option when reading from
+// `VerifyStream`, which returns `ErrNoTrailer` instead. Use `CheckComplete` for
+// files read with `OpenObject`.
+func WithRequireComplete() ReaderOption {
+	return func(f *rsfReader) {
+		f.requireComplete = true
+	}
+}
+
+// trailerEOF returns `ErrIncomplete` in place of `io.EOF` when using
+// `WithRequireComplete`, since the trailer, rather than the end of the file,
+// follows the last object.
+func (f *rsfReader) trailerEOF(err error) error {
+	if err == io.EOF && f.requireComplete && f.flags&(FlagDigest|FlagTrailer) != 0 {
+		return ErrIncomplete
+	}
+	return err
+}
+
+// parseTrailer parses a trailer at the end of `bs`. It returns the position of
+// the trailer in `bs`, the digest algorithm, and the digest.
+func parseTrailer(bs []byte) (int, int, []byte, error) {
+	if len(bs) < trailerFixedLen || !bytes.Equal(bs[len(bs)-sizeFieldLen:], TrailerMagic) {
+		return 0, 0, nil, ErrNoTrailer
+	}
+
+	sz := int(binary.LittleEndian.Uint32(bs[len(bs)-sizeFieldLen*2:]))
+	if sz < trailerFixedLen || sz > len(bs) {
+		return 0, 0, nil, fmt.Errorf("invalid trailer size %d", sz)
+	}
+	start := len(bs) - sz
+	if binary.LittleEndian.Uint32(bs[start:]) != 0 {
+		return 0, 0, nil, fmt.Errorf("invalid trailer at position %d", start)
+	}
+
+	algorithm := int(binary.LittleEndian.Uint32(bs[len(bs)-sizeFieldLen*3:]))
+	digest := bs[start+sizeFieldLen : len(bs)-sizeFieldLen*3]
+	return start, algorithm, digest, nil
+}
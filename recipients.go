@@ -0,0 +1,264 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+/*
+
+The `X25519` layer encrypts each payload with AES-GCM using a random content
+key, which is encrypted to one or more X25519 recipients in the file header,
+similar to age. Each consumer decrypts the content key with its own private
+key. See `WithIdentity`.
+
+For each recipient, the content key is encrypted with AES-GCM using a zero
+nonce and a wrap key derived with HKDF-SHA256 from the X25519 shared secret of
+an ephemeral key and the recipient's public key. The salt is the ephemeral
+public key followed by the recipient's public key. Since each wrap key is used
+once, the zero nonce is safe.
+
+Format of the recipients in the file header:
+
+  [recipient count]
+  [recipient 1 ephemeral public key size]
+  [recipient 1 ephemeral public key]
+  [recipient 1 encrypted content key size]
+  [recipient 1 encrypted content key]
+  [recipient n ephemeral public key size]
+  [recipient n ephemeral public key]
+  [recipient n encrypted content key size]
+  [recipient n encrypted content key]
+
+*/
+
+// ErrNoIdentity is returned when none of the identities provided with
+// `WithIdentity` can decrypt the content key of a file.
+var ErrNoIdentity = errors.New("no identity matches the file recipients")
+
+// The HKDF info used to derive wrap keys.
+const recipientInfo = "rsf-x25519"
+
+// recipientStanza records the content key encrypted to one recipient.
+type recipientStanza struct {
+	ephemeral []byte
+	wrapped   []byte
+}
+
+type x25519Layer struct {
+	// Encrypts each payload with the content key
+	content    *aesGCMLayer
+	recipients []*ecdh.PublicKey
+
+	once    sync.Once
+	stanzas []recipientStanza
+	err     error
+}
+
+// X25519 returns a layer that encrypts each payload with a random content key,
+// which is encrypted to each of the given X25519 recipients in the file
+// header. Readers provide a matching private key with `WithIdentity`.
+func X25519(recipients ...*ecdh.PublicKey) Layer {
+	return &x25519Layer{recipients: recipients}
+}
+
+func (x *x25519Layer) ID() uint16 {
+	return LayerX25519
+}
+
+// init generates the content key and encrypts it to each recipient.
+func (x *x25519Layer) init() error {
+	x.once.Do(func() {
+		if len(x.recipients) == 0 {
+			x.err = errors.New("no X25519 recipients")
+			return
+		}
+		key := make([]byte, 32)
+		_, x.err = io.ReadFull(rand.Reader, key)
+		if x.err != nil {
+			return
+		}
+		x.content = &aesGCMLayer{key: key}
+		for _, recipient := range x.recipients {
+			var stanza recipientStanza
+			stanza, x.err = wrapKey(key, recipient)
+			if x.err != nil {
+				return
+			}
+			x.stanzas = append(x.stanzas, stanza)
+		}
+	})
+	return x.err
+}
+
+func (x *x25519Layer) recipientStanzas() ([]recipientStanza, error) {
+	err := x.init()
+	return x.stanzas, err
+}
+
+func (x *x25519Layer) Encode(p []byte) ([]byte, error) {
+	if err := x.init(); err != nil {
+		return nil, err
+	}
+	return x.content.Encode(p)
+}
+
+func (x *x25519Layer) Decode(p []byte) ([]byte, error) {
+	if x.content == nil {
+		if err := x.init(); err != nil {
+			return nil, err
+		}
+	}
+	return x.content.Decode(p)
+}
+
+func (x *x25519Layer) randomized() bool {
+	return true
+}
+
+// recipientLayer is implemented by layers that record recipients in the file
+// header. See `FlagRecipients`.
+type recipientLayer interface {
+	recipientStanzas() ([]recipientStanza, error)
+}
+
+// WithIdentity provides X25519 private keys used to decrypt files written with
+// the `X25519` layer. Each identity is tried in turn.
+func WithIdentity(identities ...*ecdh.PrivateKey) ReaderOption {
+	return func(f *rsfReader) {
+		f.identities = append(f.identities, identities...)
+	}
+}
+
+// identityLayer returns the layer used to decode a file written with the
+// `X25519` layer, using the first identity that can decrypt the content key.
+func (f *rsfReader) identityLayer() (Layer, error) {
+	for _, identity := range f.identities {
+		for _, stanza := range f.stanzas {
+			key, err := unwrapKey(stanza, identity)
+			if err == nil {
+				return &x25519Layer{content: &aesGCMLayer{key: key}}, nil
+			}
+		}
+	}
+	return nil, ErrNoIdentity
+}
+
+// wrapKey encrypts the content key `key` to `recipient`.
+func wrapKey(key []byte, recipient *ecdh.PublicKey) (recipientStanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return recipientStanza{}, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return recipientStanza{}, err
+	}
+	stanza := recipientStanza{ephemeral: ephemeral.PublicKey().Bytes()}
+	aead, err := wrapAEAD(shared, stanza.ephemeral, recipient.Bytes())
+	if err != nil {
+		return recipientStanza{}, err
+	}
+	stanza.wrapped = aead.Seal(nil, make([]byte, aead.NonceSize()), key, nil)
+	return stanza, nil
+}
+
+// unwrapKey decrypts the content key in `stanza` with `identity`.
+func unwrapKey(stanza recipientStanza, identity *ecdh.PrivateKey) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().NewPublicKey(stanza.ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := identity.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := wrapAEAD(shared, stanza.ephemeral, identity.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, make([]byte, aead.NonceSize()), stanza.wrapped, nil)
+}
+
+// wrapAEAD returns the AEAD used to encrypt a content key, using a wrap key
+// derived from a shared secret.
+func wrapAEAD(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	block, err := aes.NewCipher(hkdfSHA256(shared, salt, []byte(recipientInfo)))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// hkdfSHA256 derives a 32-byte key with HKDF-SHA256 (RFC 5869).
+func hkdfSHA256(secret, salt, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// writeRecipients writes the recipients of the `X25519` layer in the file
+// header.
+func (f *rsfWriter) writeRecipients(w io.Writer) error {
+	var stanzas []recipientStanza
+	for _, l := range f.layers {
+		if r, ok := l.(recipientLayer); ok {
+			var err error
+			stanzas, err = r.recipientStanzas()
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	_, err := f.WriteSizeField(0, len(stanzas), w)
+	if err != nil {
+		return err
+	}
+	for _, stanza := range stanzas {
+		_, err = f.WriteStringField(0, string(stanza.ephemeral), w)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteStringField(0, string(stanza.wrapped), w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRecipients reads the recipients written by `writeRecipients`.
+func (f *rsfReader) readRecipients(r io.Reader) error {
+	count, err := f.ReadSizeField(r)
+	if err != nil {
+		return err
+	}
+	f.stanzas = make([]recipientStanza, count)
+	for i := range f.stanzas {
+		var ephemeral, wrapped string
+		ephemeral, err = f.ReadStringField(r)
+		if err != nil {
+			return fmt.Errorf("error reading recipient: %w", err)
+		}
+		wrapped, err = f.ReadStringField(r)
+		if err != nil {
+			return fmt.Errorf("error reading recipient: %w", err)
+		}
+		f.stanzas[i] = recipientStanza{ephemeral: []byte(ephemeral), wrapped: []byte(wrapped)}
+	}
+	return nil
+}
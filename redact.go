@@ -0,0 +1,645 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+
+`Redact` copies a file while blanking or dropping fields, e.g., to publish a
+sanitized copy of an internal snapshot. Fields are named by their path, which
+joins the names of the enclosing arrays or struct fields and the field with `.`, such as
+`packages.maintainer`.
+
+The file header is copied as is. The index is rewritten without dropped
+fields, and each object is rewritten using the index, so the sizes of arrays,
+array index entries, segments, and field offset tables are updated. Element
+hashes are recomputed, and the digest trailer is rewritten when using
+`WithDigest`. Other field data is copied without being decoded.
+
+A blanked field keeps its type and is written with an empty value: an empty
+string, a fixed-size string of spaces, false, zero, an empty array, a struct
+with blank fields, or a nil pointer. Key fields of indexed arrays cannot be redacted,
+since the array index would no longer match the elements.
+
+*/
+
+// RedactMode determines how `Redact` redacts a field.
+type RedactMode int
+
+const (
+	// RedactBlank writes the field with an empty value.
+	RedactBlank RedactMode = iota + 1
+	// RedactDrop removes the field from the index and from each object.
+	RedactDrop
+)
+
+// Redaction names a field to redact by its path (e.g., `packages.maintainer`)
+// and determines how it is redacted.
+type Redaction struct {
+	Field string
+	Mode  RedactMode
+}
+
+// redactor rewrites the objects of a file. See `Redact`.
+type redactor struct {
+	w     *rsfWriter
+	rules map[string]RedactMode
+	data  []byte
+}
+
+// Redact copies the file read from `src` to `dst`, redacting the fields listed
+// in `redactions` and the fields tagged with `sensitive`. Reader options, such
+// as `WithLayers`, are used to decode objects, which are encoded again with the
+// same layers. The number of bytes written to `dst` is returned.
+func Redact(dst io.Writer, src io.Reader, redactions []Redaction, opts ...ReaderOption) (int, error) {
+	// Read the header and index, keeping a copy of the header.
+	f := NewReader(opts...).(*rsfReader)
+	raw := &bytes.Buffer{}
+	index, err := f.ReadIndex(io.TeeReader(src, raw))
+	if err != nil {
+		return 0, err
+	}
+	var headerLen int
+	switch f.indexVersion {
+	case Version3:
+		headerLen = len(IndexVersion3) + int(binary.LittleEndian.Uint32(raw.Bytes()[len(IndexVersion3):]))
+	case Version2:
+		headerLen = len(IndexVersion2)
+	}
+
+	rd := &redactor{rules: make(map[string]RedactMode, len(redactions))}
+	for _, r := range redactions {
+		if r.Mode != RedactBlank && r.Mode != RedactDrop {
+			return 0, fmt.Errorf("invalid redaction mode %d for field %s", r.Mode, r.Field)
+		}
+		rd.rules[r.Field] = r.Mode
+	}
+	rd.redactSensitive("", index)
+	newIndex, err := rd.redactIndex("", index, nil)
+	if err != nil {
+		return 0, err
+	}
+	for field := range rd.rules {
+		if !indexHasPath("", index, field) {
+			return 0, fmt.Errorf("cannot redact field %s: %w", field, ErrNoSuchField)
+		}
+	}
+
+	// Write the header and the rewritten index.
+	counter := NewCountingWriter(dst)
+	wopts := []WriterOption{withEncoding(f.enc)}
+	if f.flags&FlagDigest != 0 {
+		wopts = append(wopts, WithDigest())
+	}
+	if f.flags&FlagObjectTable != 0 {
+		wopts = append(wopts, WithObjectTable())
+	}
+	rd.w = NewWriterWithVersion(counter, f.indexVersion, wopts...).(*rsfWriter)
+	rd.w.flags = f.flags
+	rd.w.headerFlags = f.flags
+	rd.w.layers = f.layers
+	_, err = rd.w.writer.Write(raw.Bytes()[:headerLen])
+	if err != nil {
+		return 0, err
+	}
+	indexBuf := &bytes.Buffer{}
+	err = rd.w.writeIndexEntries(newIndex, f.indexVersion, indexBuf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = rd.w.WriteSizeField(0, indexBuf.Len()+sizeFieldLen, rd.w.writer)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(rd.w.writer, indexBuf)
+	if err != nil {
+		return 0, err
+	}
+
+	// Rewrite each object
+	for {
+		var sz int
+		sz, err = f.ReadSizeField(src)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		// A zero object size begins the file trailer, which is rewritten by
+		// `Finalize`.
+		if sz == 0 {
+			_, err = io.Copy(io.Discard, src)
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+
+		payload := make([]byte, sz-sizeFieldLen)
+		_, err = io.ReadFull(src, payload)
+		if err != nil {
+			return 0, err
+		}
+		if f.flags&FlagLayers != 0 {
+			payload, err = decodeLayers(f.layers, payload)
+			if err != nil {
+				return 0, fmt.Errorf("error decoding object: %w", err)
+			}
+		}
+
+		buf := &bytes.Buffer{}
+		var offsets []fieldOffset
+		offsets, err = rd.redactObject(index, payload, f.flags, buf)
+		if err != nil {
+			return 0, err
+		}
+		_, err = rd.w.writeRecord(buf, offsets)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = rd.w.Finalize()
+	if err != nil {
+		return 0, err
+	}
+	return counter.Pos(), nil
+}
+
+// indexHasPath returns true if `index` includes the field `field`.
+func indexHasPath(prefix string, index Index, field string) bool {
+	for _, entry := range index {
+		path := prefix + entry.FieldName
+		if path == field || (strings.HasPrefix(field, path+".") && indexHasPath(path+".", entry.Subfields, field)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactIndex returns a copy of `index` without dropped fields. `keys` are the
+// key fields of the enclosing array, if any.
+func (rd *redactor) redactIndex(prefix string, index Index, keys []IndexKey) (Index, error) {
+	var redacted Index
+	for _, entry := range index {
+		path := prefix + entry.FieldName
+		mode, ok := rd.rules[path]
+		if ok {
+			for _, key := range keys {
+				if key.FieldName == entry.FieldName {
+					return nil, fmt.Errorf("cannot redact key field %s", path)
+				}
+			}
+		}
+		if mode == RedactDrop {
+			continue
+		}
+		if entry.Subfields != nil {
+			subfields, err := rd.redactIndex(path+".", entry.Subfields, entry.IndexKeys)
+			if err != nil {
+				return nil, err
+			}
+			entry.Subfields = subfields
+		}
+		redacted = append(redacted, entry)
+	}
+	return redacted, nil
+}
+
+// redacts returns true if any fields with the path prefix `prefix` are
+// redacted.
+func (rd *redactor) redacts(prefix string) bool {
+	for field := range rd.rules {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactObject rewrites the object data in `payload` to `buf`, returning the
+// new field offsets when the file includes field offsets.
+func (rd *redactor) redactObject(index Index, payload []byte, flags uint32, buf *bytes.Buffer) ([]fieldOffset, error) {
+	rd.data = payload
+	s := NewStatelessReader(bytes.NewReader(payload))
+	s.enc = flagsEncoding(flags)
+
+	// Skip the field offset table, which is rebuilt.
+	var off int64
+	var offsets []fieldOffset
+	if flags&FlagFieldOffsets != 0 {
+		offsets = make([]fieldOffset, 0)
+		count, next, err := s.ReadSizeField(0)
+		if err != nil {
+			return nil, err
+		}
+		entrySz := sizeFieldLen
+		if flags&FlagFieldHashes != 0 {
+			entrySz += sizeFieldLen
+		}
+		off = next + int64(count*entrySz)
+	}
+
+	var err error
+	for _, entry := range index {
+		if rd.rules[entry.FieldName] != RedactDrop && offsets != nil {
+			offsets = append(offsets, fieldOffset{name: entry.FieldName, offset: buf.Len()})
+		}
+		off, err = rd.redactValue(entry.FieldName, entry, s, off, buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return offsets, nil
+}
+
+// redactValue rewrites the value described by `entry` at `off` to `buf`, and
+// returns the offset following the value.
+func (rd *redactor) redactValue(path string, entry IndexEntry, s *StatelessReader, off int64, buf *bytes.Buffer) (int64, error) {
+	next, err := s.skipValue(entry, off)
+	if err != nil {
+		return 0, err
+	}
+
+	switch rd.rules[path] {
+	case RedactDrop:
+		return next, nil
+	case RedactBlank:
+		return next, rd.writeBlank(entry, buf)
+	}
+
+	if !rd.redacts(path + ".") {
+		_, err = buf.Write(rd.data[off:next])
+		return next, err
+	}
+
+	// Copy the presence marker of a pointer, and then rewrite the value, if
+	// present.
+	if entry.Optional {
+		_, err = buf.Write(rd.data[off : off+1])
+		if err != nil || rd.data[off] == 0 {
+			return next, err
+		}
+		off++
+		entry.Optional = false
+	}
+	switch entry.FieldType {
+	case FieldTypeStruct:
+		err = rd.redactStruct(path, entry, s, off, buf)
+	case FieldTypeMap:
+		err = rd.redactMap(path, entry, s, off, buf)
+	case FieldTypeArray:
+		_, err = rd.redactArray(path, entry, s, off, buf)
+	case FieldTypeSegmented:
+		err = rd.redactSegments(path, entry, s, off, buf)
+	}
+	return next, err
+}
+
+// writeBlank writes an empty value of the type described by `entry`.
+func (rd *redactor) writeBlank(entry IndexEntry, buf *bytes.Buffer) error {
+	var err error
+	if entry.Optional {
+		// A nil pointer
+		_, err = rd.w.WriteBoolField(0, false, buf)
+		return err
+	}
+	switch entry.FieldType {
+	case FieldTypeFixedStr:
+		_, err = buf.WriteString(strings.Repeat(" ", entry.FieldSize))
+	case FieldTypeVarStr, FieldTypeProvenance, FieldTypeBytes:
+		_, err = rd.w.WriteStringField(0, "", buf)
+	case FieldTypeChunked:
+		_, err = rd.w.WriteSizeField(0, 0, buf)
+	case FieldTypeBool, FieldTypeDeleted:
+		_, err = rd.w.WriteBoolField(0, false, buf)
+	case FieldTypeInt64, FieldTypeExpiry:
+		_, err = rd.w.WriteInt64Field(0, 0, buf)
+	case FieldTypeFloat:
+		_, err = rd.w.WriteFloatField(0, 0, buf)
+	case FieldTypeFloat32:
+		_, err = rd.w.WriteFloat32Field(0, 0, buf)
+	case FieldTypeUint64:
+		_, err = rd.w.WriteUint64Field(0, 0, buf)
+	case FieldTypeInt:
+		_, err = rd.w.WriteIntFieldWidth(0, entry.FieldSize, 0, buf)
+	case FieldTypeTime:
+		_, err = rd.w.writeTime(time.Time{}, &tag{timeFormat: timeFormat(entry)}, buf)
+	case FieldTypeStruct:
+		fieldsBuf := &bytes.Buffer{}
+		for _, subfield := range entry.Subfields {
+			err = rd.writeBlank(subfield, fieldsBuf)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = rd.w.WriteSizeField(0, sizeFieldLen+fieldsBuf.Len(), buf)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(buf, fieldsBuf)
+	case FieldTypeArray, FieldTypeSegmented, FieldTypeMap:
+		// An empty array, segment directory, or map
+		_, err = rd.w.WriteSizeField(0, sizeFieldLen*2, buf)
+		if err != nil {
+			return err
+		}
+		_, err = rd.w.WriteSizeField(0, 0, buf)
+	default:
+		err = fmt.Errorf("unexpected index field type %d", entry.FieldType)
+	}
+	return err
+}
+
+// redactArray rewrites the struct array at `off` to `buf`, and returns the
+// offset following the array.
+func (rd *redactor) redactArray(path string, entry IndexEntry, s *StatelessReader, off int64, buf *bytes.Buffer) (int64, error) {
+	sz, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return 0, err
+	}
+	arrayLen, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return 0, err
+	}
+
+	// Read the keys from the array index
+	var keys [][]byte
+	if entry.Indexed {
+		keys = make([][]byte, arrayLen)
+		for i := range keys {
+			keys[i] = rd.data[next : next+int64(entry.IndexSize)]
+			next += int64(entry.indexEntrySize())
+		}
+	}
+
+	// Rewrite each element, and then the index
+	indexBuf := &bytes.Buffer{}
+	elBuf := &bytes.Buffer{}
+	for i := 0; i < arrayLen; i++ {
+		start := elBuf.Len()
+		elSz := -1
+		for _, subfield := range entry.Subfields {
+			// Element hashes do not include provenance. See
+			// `writeElementHash`.
+			if subfield.FieldType == FieldTypeProvenance {
+				elSz = elBuf.Len() - start
+			}
+			next, err = rd.redactValue(path+"."+subfield.FieldName, subfield, s, next, elBuf)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if elSz < 0 {
+			elSz = elBuf.Len() - start
+		}
+		if keys != nil {
+			indexBuf.Write(keys[i])
+			_, err = rd.w.WriteSizeField(0, elBuf.Len()-start, indexBuf)
+			if err != nil {
+				return 0, err
+			}
+			_, err = rd.w.writeElementHash(elBuf.Bytes()[start:start+elSz], indexBuf)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if next != off+int64(sz) {
+		return 0, ErrArrayMismatch{Pos: off, Len: arrayLen, Size: sz, ReadLen: arrayLen, ReadSize: int(next - off)}
+	}
+
+	_, err = rd.w.WriteSizeField(0, sizeFieldLen*2+indexBuf.Len()+elBuf.Len(), buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = rd.w.WriteSizeField(0, arrayLen, buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(buf, indexBuf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(buf, elBuf)
+	if err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// redactStruct rewrites the struct field at `off` to `buf`. See
+// `FieldTypeStruct`.
+func (rd *redactor) redactStruct(path string, entry IndexEntry, s *StatelessReader, off int64, buf *bytes.Buffer) error {
+	_, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return err
+	}
+	fieldsBuf := &bytes.Buffer{}
+	for _, subfield := range entry.Subfields {
+		next, err = rd.redactValue(path+"."+subfield.FieldName, subfield, s, next, fieldsBuf)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = rd.w.WriteSizeField(0, sizeFieldLen+fieldsBuf.Len(), buf)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(buf, fieldsBuf)
+	return err
+}
+
+// redactMap rewrites the map at `off` to `buf`. See `FieldTypeMap`.
+func (rd *redactor) redactMap(path string, entry IndexEntry, s *StatelessReader, off int64, buf *bytes.Buffer) error {
+	_, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return err
+	}
+	count, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return err
+	}
+	pairsBuf := &bytes.Buffer{}
+	for i := 0; i < count; i++ {
+		var keyEnd int64
+		keyEnd, err = s.skipValue(IndexEntry{FieldType: FieldTypeVarStr}, next)
+		if err != nil {
+			return err
+		}
+		pairsBuf.Write(rd.data[next:keyEnd])
+		next = keyEnd
+		for _, subfield := range entry.Subfields {
+			next, err = rd.redactValue(path+"."+subfield.FieldName, subfield, s, next, pairsBuf)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = rd.w.WriteSizeField(0, sizeFieldLen*2+pairsBuf.Len(), buf)
+	if err != nil {
+		return err
+	}
+	_, err = rd.w.WriteSizeField(0, count, buf)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(buf, pairsBuf)
+	return err
+}
+
+// redactSegments rewrites the segmented array at `off` to `buf`.
+func (rd *redactor) redactSegments(path string, entry IndexEntry, s *StatelessReader, off int64, buf *bytes.Buffer) error {
+	segments, _, err := s.readSegmentDirectory(off)
+	if err != nil {
+		return err
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].offset < segments[j].offset
+	})
+
+	dirSz := sizeFieldLen * 2
+	segmentsBuf := &bytes.Buffer{}
+	offsets := make([]int, len(segments))
+	for i, segment := range segments {
+		dirSz += sizeFieldLen + rd.w.stringSize(segment.name)
+		offsets[i] = segmentsBuf.Len()
+		_, err = rd.redactArray(path, segmentEntry(entry), s, segment.offset, segmentsBuf)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = rd.w.WriteSizeField(0, dirSz+segmentsBuf.Len(), buf)
+	if err != nil {
+		return err
+	}
+	_, err = rd.w.WriteSizeField(0, len(segments), buf)
+	if err != nil {
+		return err
+	}
+	for i, segment := range segments {
+		_, err = rd.w.WriteStringField(0, segment.name, buf)
+		if err != nil {
+			return err
+		}
+		_, err = rd.w.WriteSizeField(0, dirSz+offsets[i], buf)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(buf, segmentsBuf)
+	return err
+}
+
+// writeIndexEntries writes the index entries in `index` for a file with the
+// index version `version`. See `readIndexEntries`.
+func (f *rsfWriter) writeIndexEntries(index Index, version int, buf *bytes.Buffer) error {
+	for _, entry := range index {
+		_, err := f.WriteStringField(0, entry.FieldName, buf)
+		if err != nil {
+			return err
+		}
+		fieldType := entry.FieldType
+		if entry.Sensitive {
+			fieldType |= fieldTypeSensitive
+		}
+		if entry.Optional {
+			fieldType |= fieldTypeOptional
+		}
+		_, err = f.WriteSizeField(0, fieldType, buf)
+		if err != nil {
+			return err
+		}
+
+		switch entry.FieldType {
+		case FieldTypeArray, FieldTypeSegmented:
+			if version >= 2 {
+				_, err = f.WriteBoolField(0, entry.Indexed, buf)
+				if err != nil {
+					return err
+				}
+				if entry.Indexed {
+					_, err = f.WriteSizeField(0, entry.IndexType, buf)
+					if err != nil {
+						return err
+					}
+					_, err = f.WriteSizeField(0, entry.IndexSize, buf)
+					if err != nil {
+						return err
+					}
+					if version > 2 {
+						err = f.writeEntryKeys(entry.IndexKeys, buf)
+						if err != nil {
+							return err
+						}
+					}
+				}
+				_, err = f.WriteSizeField(0, entry.SubfieldType, buf)
+				if err != nil {
+					return err
+				}
+			}
+			subfields := entry.Subfields
+			if entry.Element != nil {
+				subfields = Index{*entry.Element}
+			}
+			_, err = f.WriteSizeField(0, len(subfields), buf)
+			if err != nil {
+				return err
+			}
+			err = f.writeIndexEntries(subfields, version, buf)
+			if err != nil {
+				return err
+			}
+		case FieldTypeMap:
+			_, err = f.WriteSizeField(0, entry.SubfieldType, buf)
+			if err != nil {
+				return err
+			}
+			_, err = f.WriteSizeField(0, len(entry.Subfields), buf)
+			if err != nil {
+				return err
+			}
+			err = f.writeIndexEntries(entry.Subfields, version, buf)
+			if err != nil {
+				return err
+			}
+		case FieldTypeStruct:
+			_, err = f.WriteSizeField(0, len(entry.Subfields), buf)
+			if err != nil {
+				return err
+			}
+			err = f.writeIndexEntries(entry.Subfields, version, buf)
+			if err != nil {
+				return err
+			}
+		case FieldTypeFixedStr, FieldTypeTime, FieldTypeInt:
+			_, err = f.WriteSizeField(0, entry.FieldSize, buf)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeEntryKeys writes the key fields of an index entry read from a file. See
+// `writeIndexKeys`.
+func (f *rsfWriter) writeEntryKeys(keys []IndexKey, buf *bytes.Buffer) error {
+	indexKeys := make([]indexKey, len(keys))
+	for i, key := range keys {
+		indexKeys[i] = indexKey{name: key.FieldName, kind: key.KeyType, size: key.KeySize}
+	}
+	_, err := f.writeIndexKeys(indexKeys, buf)
+	return err
+}
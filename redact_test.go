@@ -0,0 +1,204 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RedactSuite struct {
+	suite.Suite
+}
+
+func TestRedactSuite(t *testing.T) {
+	suite.Run(t, &RedactSuite{})
+}
+
+// redactedComplexData returns a copy of the test data with the author, classifier
+// values, and snapshot summaries removed.
+func redactedComplexData() []FullPackageRecordPyPI {
+	redacted := make([]FullPackageRecordPyPI, len(testComplexData))
+	for i, obj := range testComplexData {
+		obj.Author = ""
+		obj.Classifiers = make([]Classifier, len(obj.Classifiers))
+		for j, c := range testComplexData[i].Classifiers {
+			c.Values = []string{}
+			obj.Classifiers[j] = c
+		}
+		obj.Snapshots = make([]FullManifestSnapshotPyPI, len(obj.Snapshots))
+		for j, snap := range testComplexData[i].Snapshots {
+			snap.Summary = ""
+			obj.Snapshots[j] = snap
+		}
+		redacted[i] = obj
+	}
+	return redacted
+}
+
+func (s *RedactSuite) write(data []FullPackageRecordPyPI, opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, opts...)
+	for _, obj := range data {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+func (s *RedactSuite) TestRedactBlank() {
+	redactions := []Redaction{
+		{Field: "author", Mode: RedactBlank},
+		{Field: "classifiers.values", Mode: RedactBlank},
+		{Field: "snapshots.summary", Mode: RedactBlank},
+	}
+
+	// Blanking fields produces the same file as writing blank values.
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldHashes()},
+		{WithElementHashes()},
+		{Chain(Zstd(), Checksum()), WithDigest()},
+	} {
+		src := s.write(testComplexData, opts...)
+		dst := &bytes.Buffer{}
+		n, err := Redact(dst, bytes.NewReader(src), redactions)
+		s.Require().Nil(err)
+		s.Assert().Equal(dst.Len(), n)
+		s.Assert().Equal(s.write(redactedComplexData(), opts...), dst.Bytes())
+	}
+}
+
+func (s *RedactSuite) TestRedactDrop() {
+	redactions := []Redaction{
+		{Field: "author", Mode: RedactDrop},
+		{Field: "classifiers.values", Mode: RedactBlank},
+		{Field: "snapshots.summary", Mode: RedactDrop},
+	}
+
+	src := s.write(testComplexData, WithFieldHashes(), WithElementHashes(), WithDigest())
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(src), redactions)
+	s.Require().Nil(err)
+
+	// Dropped fields are removed from the index, and the digest is updated.
+	r := NewReader()
+	br := bufio.NewReader(VerifyStream(bytes.NewReader(dst.Bytes())))
+	index, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, _, err = entrySet(index, "author")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+	_, _, err = entrySet(index, "snapshots", "summary")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+	_, _, err = entrySet(index, "snapshots", "license")
+	s.Assert().Nil(err)
+
+	var actual []FullPackageRecordPyPI
+	for {
+		var obj FullPackageRecordPyPI
+		err = r.ReadObject(br, &obj)
+		if err == io.EOF {
+			break
+		}
+		s.Require().Nil(err)
+		actual = append(actual, obj)
+	}
+
+	expected := redactedComplexData()
+	for i := range expected {
+		for j := range expected[i].Classifiers {
+			expected[i].Classifiers[j].Values = nil
+		}
+		for j := range expected[i].Snapshots {
+			expected[i].Snapshots[j].CanonicalName = ""
+			expected[i].Snapshots[j].ProjectName = ""
+		}
+	}
+	s.Assert().Equal(expected, actual)
+
+	// Element hashes match those of the redacted data.
+	type snapshot struct {
+		Description string `rsf:"description"`
+		Deleted     bool   `rsf:"deleted"`
+		Snapshot    string `rsf:"snapshot,skip,fixed:10"`
+		Version     string `rsf:"version"`
+		License     string `rsf:"license"`
+	}
+	type record struct {
+		HomePage    string       `rsf:"homepage"`
+		Name        string       `rsf:"cname"`
+		Project     string       `rsf:"pname"`
+		Classifiers []Classifier `rsf:"classifiers"`
+		Snapshots   []snapshot   `rsf:"snapshots,index:snapshot"`
+		Popularity  int64        `rsf:"popularity"`
+	}
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithFieldHashes(), WithElementHashes(), WithDigest())
+	for _, obj := range expected {
+		rec := record{
+			HomePage:    obj.HomePage,
+			Name:        obj.CanonicalName,
+			Project:     obj.ProjectName,
+			Classifiers: obj.Classifiers,
+			Popularity:  obj.Popularity,
+		}
+		for _, snap := range obj.Snapshots {
+			rec.Snapshots = append(rec.Snapshots, snapshot{snap.Description, snap.Deleted, snap.Snapshot, snap.Version, snap.License})
+		}
+		_, err = w.WriteObject(rec)
+		s.Require().Nil(err)
+	}
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+	s.Assert().Equal(buf.Bytes(), dst.Bytes())
+}
+
+func (s *RedactSuite) TestRedactSegments() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithElementHashes())
+	_, err := w.WriteObject(segmentData)
+	s.Require().Nil(err)
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+
+	dst := &bytes.Buffer{}
+	_, err = Redact(dst, bytes.NewReader(buf.Bytes()), []Redaction{{Field: "packages.name", Mode: RedactBlank}})
+	s.Require().Nil(err)
+
+	expected := segmentData
+	expected.Packages = make([]segmentPkg, len(segmentData.Packages))
+	for i, pkg := range segmentData.Packages {
+		pkg.Name = ""
+		expected.Packages[i] = pkg
+	}
+	buf.Reset()
+	w = NewWriterWithVersion(buf, Version3, WithElementHashes())
+	_, err = w.WriteObject(expected)
+	s.Require().Nil(err)
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+	s.Assert().Equal(buf.Bytes(), dst.Bytes())
+}
+
+func (s *RedactSuite) TestRedactErrors() {
+	src := s.write(testComplexData)
+
+	_, err := Redact(io.Discard, bytes.NewReader(src), []Redaction{{Field: "snapshots.missing", Mode: RedactDrop}})
+	s.Assert().True(errors.Is(err, ErrNoSuchField))
+
+	_, err = Redact(io.Discard, bytes.NewReader(src), []Redaction{{Field: "author"}})
+	s.Assert().EqualError(err, "invalid redaction mode 0 for field author")
+
+	// Key fields of indexed arrays cannot be redacted.
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version3).WriteObject(segmentData)
+	s.Require().Nil(err)
+	_, err = Redact(io.Discard, bytes.NewReader(buf.Bytes()), []Redaction{{Field: "packages.id", Mode: RedactBlank}})
+	s.Assert().EqualError(err, "cannot redact key field packages.id")
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotEncrypted is returned by `Rekey` when a file does not include an
+// `AESGCM` layer.
+var ErrNotEncrypted = errors.New("file is not encrypted")
+
+// Rekey copies the file read from `src` to `dst`, re-encrypting each object
+// payload with the `AESGCM` layer `newKey`. The old key is looked up with
+// `oldKeys` using the key ID recorded in the file header, if any. Only the
+// layers applied after encryption, if any, are decoded, so the object data is
+// not decompressed or otherwise decoded. The key ID recorded in the header is
+// replaced with the key ID of `newKey`, which may be empty (see
+// `AESGCMWithKeyID`), and the digest trailer is recomputed when using
+// `WithDigest`. The parent recorded with `WithParent` is kept. The number of
+// bytes written to `dst` is returned.
+func Rekey(dst io.Writer, src io.Reader, oldKeys KeyProvider, newKey Layer) (int, error) {
+	if newKey.ID() != LayerAESGCM {
+		return 0, fmt.Errorf("layer %d is not an encryption layer", newKey.ID())
+	}
+
+	// Read the header, which must list an encryption layer.
+	magic := make([]byte, len(IndexVersion3))
+	_, err := io.ReadFull(src, magic)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(magic, IndexVersion3) {
+		return 0, ErrNotEncrypted
+	}
+	f := &rsfReader{keyProvider: oldKeys}
+	err = f.readHeader(src)
+	if err != nil {
+		return 0, err
+	}
+	f.enc = flagsEncoding(f.flags)
+	encrypted := -1
+	newLayers := make([]Layer, len(f.layers))
+	for i, l := range f.layers {
+		newLayers[i] = l
+		if l.ID() == LayerAESGCM {
+			newLayers[i] = newKey
+			if encrypted < 0 {
+				encrypted = i
+			}
+		}
+	}
+	if encrypted < 0 {
+		return 0, ErrNotEncrypted
+	}
+
+	// Write the same header with the new key ID.
+	counter := NewCountingWriter(dst)
+	opts := []WriterOption{Chain(newLayers...), WithMinReaderVersion(f.minVersion), withEncoding(f.enc)}
+	if f.flags&FlagDigest != 0 {
+		opts = append(opts, WithDigest())
+	}
+	if f.flags&FlagObjectTable != 0 {
+		opts = append(opts, WithObjectTable())
+	}
+	if f.flags&FlagParent != 0 {
+		opts = append(opts, WithParent(f.parent.Location, f.parent.Digest))
+	}
+	w := NewWriterWithVersion(counter, Version3, opts...).(*rsfWriter)
+	w.flags |= f.flags &^ FlagKeyID
+	if f.floatEncoding == FloatIEEE754Finite {
+		w.floatPolicy = FloatReject
+	}
+	_, err = w.writeHeader(w.writer)
+	if err != nil {
+		return 0, err
+	}
+
+	// Copy the index
+	sz, err := f.ReadSizeField(src)
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.WriteSizeField(0, sz, w.writer)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.CopyN(w.writer, src, int64(sz-sizeFieldLen))
+	if err != nil {
+		return 0, err
+	}
+
+	// Re-encrypt each object
+	for {
+		sz, err = f.ReadSizeField(src)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		// A zero object size begins the file trailer, which is rewritten by
+		// `Finalize`.
+		if sz == 0 {
+			_, err = io.Copy(io.Discard, src)
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+
+		payload := make([]byte, sz-sizeFieldLen)
+		_, err = io.ReadFull(src, payload)
+		if err != nil {
+			return 0, err
+		}
+		payload, err = decodeLayers(f.layers[encrypted:], payload)
+		if err != nil {
+			return 0, fmt.Errorf("error decoding object: %w", err)
+		}
+		payload, err = encodeLayers(newLayers[encrypted:], payload)
+		if err != nil {
+			return 0, err
+		}
+		record := &bytes.Buffer{}
+		_, err = w.WriteSizeField(0, len(payload)+sizeFieldLen, record)
+		if err != nil {
+			return 0, err
+		}
+		record.Write(payload)
+		_, err = w.writeEncodedRecord(record)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = w.Finalize()
+	if err != nil {
+		return 0, err
+	}
+	return counter.Pos(), nil
+}
@@ -0,0 +1,255 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned when a read or write exceeds the `Timeout` of its
+// `RetryPolicy`.
+var ErrTimeout = errors.New("operation timed out")
+
+// TransientError marks an error as transient, i.e., the operation may succeed
+// if it is retried. Network-backed readers and writers should wrap errors such
+// as throttling responses with `Transient`. See `IsTransient`.
+type TransientError struct {
+	Err error
+}
+
+func (e TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e TransientError) Unwrap() error {
+	return e.Err
+}
+
+// Transient marks `err` as transient.
+func Transient(err error) error {
+	return TransientError{Err: err}
+}
+
+// PermanentError marks an error as permanent, i.e., the operation must not be
+// retried, even if the error wraps a transient error. See `IsTransient`.
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks `err` as permanent.
+func Permanent(err error) error {
+	return PermanentError{Err: err}
+}
+
+// IsTransient returns true if `err` is transient. Errors are transient when
+// they wrap a `TransientError`, or an error with a `Timeout() bool` method
+// that returns true (e.g., a `net.Error` or `context.DeadlineExceeded`),
+// unless they wrap a `PermanentError`. All other errors, including `io.EOF`,
+// are permanent.
+func IsTransient(err error) bool {
+	if err == nil || errors.As(err, &PermanentError{}) {
+		return false
+	}
+	if errors.As(err, &TransientError{}) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// RetryError is returned when an operation fails with a transient error on
+// every attempt allowed by its `RetryPolicy`.
+type RetryError struct {
+	// The number of attempts
+	Attempts int
+	// The error returned by the last attempt
+	Err error
+}
+
+func (e RetryError) Error() string {
+	return fmt.Sprintf("failed after %d attempts: %s", e.Attempts, e.Err)
+}
+
+func (e RetryError) Unwrap() error {
+	return e.Err
+}
+
+// RetryPolicy determines how operations on network-backed readers and writers
+// are retried. See `NewRetryReaderAt` and `NewRetryWriter`.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of each operation,
+	// including the first. Values less than 1 allow a single attempt.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry. The delay is
+	// doubled for each subsequent retry, up to MaxBackoff, if set.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Timeout limits the duration of each attempt, if set. Attempts that
+	// time out fail with `ErrTimeout`.
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy makes up to 4 attempts of each operation, backing off
+// from 100ms to 2s, and times out attempts after 30s.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Timeout:        30 * time.Second,
+}
+
+// do calls `fn` until it succeeds, fails with a permanent error, or the
+// attempts are exhausted.
+func (p RetryPolicy) do(fn func() error) error {
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !IsTransient(err) {
+			return err
+		}
+		if attempt >= p.MaxAttempts {
+			return RetryError{Attempts: attempt, Err: err}
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// withTimeout calls `fn` and returns `ErrTimeout` if it does not return
+// within the policy timeout. `fn` continues to run in the background after a
+// timeout, so it must not modify memory owned by the caller.
+func (p RetryPolicy) withTimeout(fn func() (int, error)) (int, error) {
+	if p.Timeout <= 0 {
+		return fn()
+	}
+	type result struct {
+		n   int
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		n, err := fn()
+		ch <- result{n, err}
+	}()
+	timer := time.NewTimer(p.Timeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res.n, res.err
+	case <-timer.C:
+		return 0, ErrTimeout
+	}
+}
+
+type retryReaderAt struct {
+	ra     io.ReaderAt
+	policy RetryPolicy
+}
+
+// NewRetryReaderAt wraps a network-backed io.ReaderAt, such as a client for
+// remote object storage, and retries reads that fail with transient errors
+// according to `policy`. Reads that time out are retried, and are read into a
+// separate buffer so that the abandoned read does not modify the caller's
+// buffer. Reads that fail with a permanent error, including `io.EOF`, are not
+// retried.
+//
+// The returned reader is safe for concurrent use provided that `ra` is also
+// safe for concurrent use.
+func NewRetryReaderAt(ra io.ReaderAt, policy RetryPolicy) io.ReaderAt {
+	return &retryReaderAt{ra: ra, policy: policy}
+}
+
+func (r *retryReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	err := r.policy.do(func() error {
+		var err error
+		n, err = r.readAt(p, off)
+		if errors.Is(err, ErrTimeout) {
+			err = Transient(err)
+		}
+		return err
+	})
+	return n, err
+}
+
+func (r *retryReaderAt) readAt(p []byte, off int64) (int, error) {
+	if r.policy.Timeout <= 0 {
+		return r.ra.ReadAt(p, off)
+	}
+	buf := make([]byte, len(p))
+	n, err := r.policy.withTimeout(func() (int, error) {
+		return r.ra.ReadAt(buf, off)
+	})
+	copy(p, buf[:n])
+	return n, err
+}
+
+type retryWriter struct {
+	w      io.Writer
+	policy RetryPolicy
+
+	// Guards writes, which are not retried after a write times out.
+	mu  sync.Mutex
+	err error
+}
+
+// NewRetryWriter wraps a network-backed io.Writer and retries writes that fail
+// with transient errors according to `policy`. Since a stream cannot be
+// rewound, writes are only retried when no bytes were written. When a write
+// times out, it may still complete in the background, so the writer fails
+// permanently with `ErrTimeout`, and subsequent writes return the same error.
+func NewRetryWriter(w io.Writer, policy RetryPolicy) io.Writer {
+	return &retryWriter{w: w, policy: policy}
+}
+
+func (r *retryWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	// Writes that time out continue in the background, so they write a copy
+	// of `p`, which the caller may reuse.
+	data := p
+	if r.policy.Timeout > 0 {
+		data = append([]byte(nil), p...)
+	}
+
+	var n int
+	err := r.policy.do(func() error {
+		var err error
+		n, err = r.policy.withTimeout(func() (int, error) {
+			return r.w.Write(data)
+		})
+		if errors.Is(err, ErrTimeout) {
+			r.err = Permanent(err)
+			return r.err
+		}
+		if err != nil && n > 0 {
+			return Permanent(err)
+		}
+		return err
+	})
+	return n, err
+}
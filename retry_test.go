@@ -0,0 +1,163 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RetrySuite struct {
+	suite.Suite
+}
+
+func TestRetrySuite(t *testing.T) {
+	suite.Run(t, &RetrySuite{})
+}
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+}
+
+// flakyReaderAt fails the first `failures` reads with `err`.
+type flakyReaderAt struct {
+	ra       io.ReaderAt
+	failures int
+	err      error
+	reads    atomic.Int64
+	delay    time.Duration
+}
+
+func (f *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if f.reads.Add(1) <= int64(f.failures) {
+		time.Sleep(f.delay)
+		return 0, f.err
+	}
+	return f.ra.ReadAt(p, off)
+}
+
+func (s *RetrySuite) TestIsTransient() {
+	s.Assert().True(IsTransient(Transient(errors.New("throttled"))))
+	s.Assert().True(IsTransient(fmt.Errorf("error reading: %w", Transient(io.ErrUnexpectedEOF))))
+	s.Assert().True(IsTransient(os.ErrDeadlineExceeded))
+	s.Assert().True(IsTransient(context.DeadlineExceeded))
+	s.Assert().False(IsTransient(Permanent(Transient(errors.New("throttled")))))
+	s.Assert().False(IsTransient(io.EOF))
+	s.Assert().False(IsTransient(errors.New("not found")))
+	s.Assert().False(IsTransient(nil))
+}
+
+func (s *RetrySuite) TestReaderAt() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(testComplexData[0])
+	s.Require().Nil(err)
+
+	// Transient errors are retried
+	flaky := &flakyReaderAt{ra: bytes.NewReader(buf.Bytes()), failures: 2, err: Transient(errors.New("throttled"))}
+	ra := NewRetryReaderAt(flaky, testRetryPolicy)
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "cname")
+	s.Require().Nil(err)
+	s.Assert().Equal("numpy", val)
+
+	// Attempts are limited
+	flaky = &flakyReaderAt{ra: bytes.NewReader(buf.Bytes()), failures: 3, err: Transient(errors.New("throttled"))}
+	_, err = NewRetryReaderAt(flaky, testRetryPolicy).ReadAt(make([]byte, 4), 0)
+	s.Assert().EqualError(err, "failed after 3 attempts: throttled")
+	s.Assert().ErrorAs(err, &RetryError{})
+	s.Assert().Equal(int64(3), flaky.reads.Load())
+
+	// Permanent errors are not retried
+	flaky = &flakyReaderAt{ra: bytes.NewReader(buf.Bytes()), failures: 1, err: errors.New("not found")}
+	_, err = NewRetryReaderAt(flaky, testRetryPolicy).ReadAt(make([]byte, 4), 0)
+	s.Assert().EqualError(err, "not found")
+	s.Assert().Equal(int64(1), flaky.reads.Load())
+	p := make([]byte, 4)
+	n, err := NewRetryReaderAt(bytes.NewReader([]byte("ab")), testRetryPolicy).ReadAt(p, 0)
+	s.Assert().ErrorIs(err, io.EOF)
+	s.Assert().Equal("ab", string(p[:n]))
+}
+
+func (s *RetrySuite) TestReaderAtTimeout() {
+	policy := testRetryPolicy
+	policy.Timeout = 10 * time.Millisecond
+
+	// Slow reads time out and are retried
+	flaky := &flakyReaderAt{ra: bytes.NewReader([]byte("abcd")), failures: 1, delay: 200 * time.Millisecond}
+	p := make([]byte, 4)
+	n, err := NewRetryReaderAt(flaky, policy).ReadAt(p, 0)
+	s.Require().Nil(err)
+	s.Assert().Equal("abcd", string(p[:n]))
+
+	flaky = &flakyReaderAt{ra: bytes.NewReader([]byte("abcd")), failures: 3, delay: 200 * time.Millisecond}
+	_, err = NewRetryReaderAt(flaky, policy).ReadAt(p, 0)
+	s.Assert().ErrorIs(err, ErrTimeout)
+	s.Assert().ErrorAs(err, &RetryError{})
+}
+
+// flakyWriter fails the first `failures` writes with `err` after writing
+// `partial` bytes.
+type flakyWriter struct {
+	bytes.Buffer
+	failures int
+	partial  int
+	err      error
+	writes   atomic.Int64
+	delay    time.Duration
+}
+
+func (f *flakyWriter) Write(p []byte) (int, error) {
+	if f.writes.Add(1) <= int64(f.failures) {
+		time.Sleep(f.delay)
+		n, _ := f.Buffer.Write(p[:f.partial])
+		return n, f.err
+	}
+	return f.Buffer.Write(p)
+}
+
+func (s *RetrySuite) TestWriter() {
+	// Transient errors are retried
+	flaky := &flakyWriter{failures: 2, err: Transient(errors.New("throttled"))}
+	w := NewWriterWithVersion(NewRetryWriter(flaky, testRetryPolicy), Version3)
+	_, err := w.WriteObject(storePkgs[0])
+	s.Require().Nil(err)
+	var actual storePkg
+	err = NewReader().ReadObject(bufio.NewReader(&flaky.Buffer), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(storePkgs[0], actual)
+
+	// Partial writes are not retried
+	flaky = &flakyWriter{failures: 1, partial: 2, err: Transient(errors.New("throttled"))}
+	n, err := NewRetryWriter(flaky, testRetryPolicy).Write([]byte("abcd"))
+	s.Assert().EqualError(err, "throttled")
+	s.Assert().False(IsTransient(err))
+	s.Assert().Equal(2, n)
+	s.Assert().Equal(int64(1), flaky.writes.Load())
+}
+
+func (s *RetrySuite) TestWriterTimeout() {
+	policy := testRetryPolicy
+	policy.Timeout = 10 * time.Millisecond
+	flaky := &flakyWriter{failures: 1, delay: 200 * time.Millisecond}
+	w := NewRetryWriter(flaky, policy)
+	_, err := w.Write([]byte("abcd"))
+	s.Assert().ErrorIs(err, ErrTimeout)
+	s.Assert().False(IsTransient(err))
+
+	// The writer fails permanently
+	_, err = w.Write([]byte("abcd"))
+	s.Assert().ErrorIs(err, ErrTimeout)
+}
@@ -4,44 +4,146 @@ package rsf
 import (
 	"bufio"
 	"io"
+	"time"
 )
 
 type Writer interface {
 	// WriteObject uses reflection and `rsf` struct tag annotations to write an object.
 	WriteObject(v any) (int, error)
 
+	// WriteObjects writes a sequence of objects like `WriteObject` and returns
+	// the offset of each object relative to the start of the written data.
+	WriteObjects(vs ...any) ([]int, int, error)
+
+	// Finalize completes the file by writing the file trailer, if needed. No
+	// objects can be written after calling Finalize.
+	Finalize() (int, error)
+
 	// WriteSizeField writes a 4-byte field that indicates a size (usually the
 	// size in bytes of an object or value, or an array length).
 	WriteSizeField(pos int, val int, r io.Writer) (int, error)
 
 	// WriteFixedStringField writes a string of a fixed length. An error is returned
-	// if the string size does not match the provided `sz` parameter.
+	// if the string size does not match the provided `sz` parameter. Empty
+	// strings are written as `sz` zero bytes.
 	WriteFixedStringField(pos, sz int, val string, r io.Writer) (int, error)
 
 	// WriteStringField writes a variable length string. The string value will be
-	// prepended with a 4-byte size field that indicates the string length.
+	// prepended with a size prefix that indicates the string length, encoded
+	// according to the writer's length encoding (see `WithVarints`).
 	WriteStringField(pos int, val string, r io.Writer) (int, error)
 
+	// WriteBytesField writes a byte slice prepended with a size prefix,
+	// like `WriteStringField`.
+	WriteBytesField(pos int, val []byte, r io.Writer) (int, error)
+
 	// WriteBoolField writes a 1-byte (0 or 1) boolean value.
 	WriteBoolField(pos int, val bool, r io.Writer) (int, error)
 
-	// WriteInt64Field write a 10-byte signed int64 value.
+	// WriteInt64Field write a 10-byte signed int64 value, or a 1 to 10-byte
+	// varint when the writer uses `WithVarints`.
 	WriteInt64Field(pos int, val int64, r io.Writer) (int, error)
 
+	// WriteUint64Field writes an 8-byte unsigned uint64 value in the writer's
+	// byte order. See `WithByteOrder`.
+	WriteUint64Field(pos int, val uint64, r io.Writer) (int, error)
+
+	// WriteIntFieldWidth writes a fixed-width signed integer that is `width`
+	// bytes wide, in the writer's byte order. The width must be 1, 2, 4, or
+	// 8. Values that do not fit are truncated. See `FieldTypeInt`.
+	WriteIntFieldWidth(pos, width int, val int64, r io.Writer) (int, error)
+
 	// WriteFloatField write an 8-byte float64 value
 	WriteFloatField(pos int, val float64, r io.Writer) (int, error)
+
+	// WriteFloat32Field writes a 4-byte float32 value. See
+	// `FieldTypeFloat32`.
+	WriteFloat32Field(pos int, val float32, r io.Writer) (int, error)
+
+	// WriteChunkedField writes the contents of `val` as a sequence of
+	// size-prefixed chunks of at most `chunkSz` bytes, followed by a
+	// zero-size terminator chunk. This supports values that exceed the
+	// 4-byte size limit or that should not be buffered in memory.
+	WriteChunkedField(pos, chunkSz int, val io.Reader, r io.Writer) (int, error)
 }
 
 // Reader - The Reader interface provides Read* methods analogous to the Write*
-// methods in the Writer interface. No `ReadObject` method is provided since
-// reading is likely to be customized per use case.
+// methods in the Writer interface, and a `ReadObject` method analogous to
+// `WriteObject`. Use the Read* methods when reading needs to be customized,
+// e.g., to read only some fields.
+//
+// A Reader tracks the current position internally and is not safe for
+// concurrent use. Use a StatelessReader to read a file from multiple
+// goroutines. Building with the `rsfdebug` tag causes a Reader to panic
+// when used from more than one goroutine.
 type Reader interface {
+	// ReadObject uses reflection and `rsf` struct tag annotations to read the
+	// next top-level object into the struct pointed to by `v`.
+	ReadObject(r io.Reader, v any) error
+
 	ReadSizeField(r io.Reader) (int, error)
+	// ReadFixedStringField reads a string of `sz` bytes. Strings of only
+	// zero bytes are read as empty strings.
 	ReadFixedStringField(sz int, r io.Reader) (string, error)
 	ReadStringField(r io.Reader) (string, error)
+	ReadBytesField(r io.Reader) ([]byte, error)
 	ReadBoolField(r io.Reader) (bool, error)
 	ReadIntField(r io.Reader) (int64, error)
 	ReadFloatField(r io.Reader) (float64, error)
+	ReadFloat32Field(r io.Reader) (float32, error)
+
+	// ReadTimeField reads a `time.Time` field. `sz` is the `FieldSize` of
+	// the field's index entry. See `FieldTypeTime`.
+	ReadTimeField(sz int, r io.Reader) (time.Time, error)
+
+	// ReadMapHeader reads the size and pair count of a map field, and
+	// returns the pair count. See `FieldTypeMap`.
+	ReadMapHeader(r io.Reader) (int, error)
+
+	// ReadIntFieldWidth reads a fixed-width signed integer that is `width`
+	// bytes wide, in the byte order recorded in the file header. The width
+	// must be 1, 2, 4, or 8. Unlike `ReadIntField`, which reads varints, the
+	// fixed-width Read* methods read integers written with fixed-width
+	// integer tags.
+	ReadIntFieldWidth(width int, r io.Reader) (int64, error)
+	ReadInt32Field(r io.Reader) (int32, error)
+	ReadInt16Field(r io.Reader) (int16, error)
+	ReadUint32Field(r io.Reader) (uint32, error)
+	ReadUint64Field(r io.Reader) (uint64, error)
+
+	// ReadStringArrayField, ReadIntArrayField, and ReadFloatArrayField read
+	// an array of primitive values (e.g., a `[]string` field) with a single
+	// read of the array data. Empty arrays are read as nil.
+	ReadStringArrayField(r io.Reader) ([]string, error)
+	ReadIntArrayField(r io.Reader) ([]int64, error)
+	ReadFloatArrayField(r io.Reader) ([]float64, error)
+
+	// ReadChunkedField reads a chunked field and reassembles the chunks.
+	ReadChunkedField(r io.Reader) ([]byte, error)
+
+	// StreamChunkedField reads a chunked field and copies each chunk to `w`
+	// as it is read. The total number of bytes copied is returned.
+	StreamChunkedField(r io.Reader, w io.Writer) (int, error)
+
+	// BeginObject reads the size field at the start of a top-level object and
+	// returns the object size. `io.EOF` is returned at the start of the file
+	// trailer. If the object is prefixed with a table of field
+	// offsets, the table is also read so that `AdvanceTo` can jump directly to
+	// top-level fields. Use this instead of `ReadSizeField` when starting to
+	// read each object.
+	BeginObject(r io.Reader) (int, error)
+
+	// SkipObject discards a complete top-level object using its size,
+	// without decoding its fields, and returns the object size. `io.EOF` is
+	// returned at the start of the file trailer. Use this in place of
+	// `BeginObject` to skip objects.
+	SkipObject(buf *bufio.Reader) (int, error)
+
+	// EndObject discards any unread data in the current top-level object. By
+	// default, an error wrapping `ErrUnknownFields` is returned if the object
+	// includes fields that are not in the index set with `SetIndex`. See
+	// `WithIgnoreUnknownFields`.
+	EndObject(buf *bufio.Reader) error
 
 	// AdvanceTo advances the reader to the field indicated by `fieldNames`.
 	AdvanceTo(buf *bufio.Reader, fieldNames ...string) error
@@ -54,12 +156,20 @@ type Reader interface {
 	ReadIndex(r io.Reader) (Index, error)
 	SetIndex(i Index)
 
+	// Header returns the file header read by `ReadIndex`.
+	Header() Header
+
 	// Seek is used to seek a file position.
 	Seek(pos int, r io.Seeker, fieldNames ...string) error
 
 	// Discard discards `sz` bytes.
 	Discard(sz int, r *bufio.Reader, fieldNames ...string) error
 
+	// CopyRange copies `length` bytes starting at file position `offset` to
+	// `dst` without decoding them, and leaves the reader positioned at the end
+	// of the range. This is useful for relaying raw objects or array elements.
+	CopyRange(offset, length int, r io.ReadSeeker, dst io.Writer) (int, error)
+
 	// Pos returns the current position in the read buffer.
 	Pos() int
 }
@@ -69,6 +179,9 @@ const (
 	sizeFieldLen = 4
 	sizeFloat64  = 8
 	sizeInt64    = 10
+
+	// The default chunk size used when writing `chunked` fields.
+	defaultChunkSize = 64 * 1024
 )
 
 // Constants used by `rsf` struct tags
@@ -86,6 +199,9 @@ const (
 	rsfDelim = ","
 	// Separates a struct tag parameter that uses the name:value format.
 	rsfSep = ":"
+	// Separates the fields of a composite array index key (e.g.,
+	// `index:date+name`).
+	rsfKeySep = "+"
 
 	//
 	// Parameters:
@@ -96,8 +212,37 @@ const (
 	rsfSkip = "skip"
 	// Denotes a fixed-size field that does not require a size header.
 	rsfFixed = "fixed"
-	// Denotes that a field is used to index an array.
+	// Denotes that a field is used to index an array. Multiple fields can be
+	// combined in a composite key with `rsfKeySep`.
 	rsfIndex = "index"
+	// Denotes a string field that is written using the chunked encoding.
+	rsfChunked = "chunked"
+	// Denotes an integer field of a struct array element that records when
+	// the element expires, in Unix seconds. Zero never expires.
+	rsfExpires = "expires"
+	// Denotes a bool field of a struct array element that marks the element
+	// as deleted (a tombstone).
+	rsfDeleted = "deleted"
+	// Denotes that a struct array is grouped into separately indexed
+	// segments by the value of a string field (e.g., `segment:tenant`).
+	rsfSegment = "segment"
+	// Denotes a field that must be redacted when exporting a file. See
+	// `Redact`.
+	rsfSensitive = "sensitive"
+	// Selects the encoding of a `time.Time` field (e.g., `time:rfc3339`).
+	// See `FieldTypeTime`.
+	rsfTime = "time"
+	// Write a signed integer field with a narrow, fixed width (e.g.,
+	// `rsf:"count,int32"`). See `FieldTypeInt`.
+	rsfInt8  = "int8"
+	rsfInt16 = "int16"
+	rsfInt32 = "int32"
+	// Omit a field with an empty value, which is written as a one-byte
+	// presence marker. See `isEmptyValue`.
+	rsfOmitEmpty = "omitempty"
+	// Declares the value of a field that is missing or absent in a file when
+	// reading with `ReadObject` (e.g., `rsf:"tier,default:standard"`).
+	rsfDefault = "default"
 )
 
 // A struct used to record and pass information about `rsf` struct tags
@@ -105,7 +250,45 @@ type tag struct {
 	name      string
 	fixed     int
 	index     string
+	segment   string
 	indexSz   int
 	indexVal  any
 	indexType int
+	chunked   bool
+	expires   bool
+	deleted   bool
+
+	// Set for a named struct field that is written as a sub-record. See
+	// `FieldTypeStruct`.
+	nested bool
+
+	// Set for a field that is redacted by `Redact`. See `rsfSensitive`.
+	sensitive bool
+
+	// Set for a pointer field. See `fieldTypeOptional`.
+	optional bool
+
+	// The encoding of a `time.Time` field. See `rsfTime`.
+	timeFormat string
+
+	// The width in bytes of a narrow integer field. See `rsfInt32`.
+	intWidth int
+
+	// Set for a non-pointer field that is omitted when empty. See
+	// `rsfOmitEmpty`.
+	omitEmpty bool
+
+	// The expiry of the current array element. See `rsfExpires`.
+	expiresAt int64
+
+	// The fields of a composite array index key. See `rsfKeySep`.
+	keys []indexKey
+}
+
+// indexKey records a field of a composite array index key.
+type indexKey struct {
+	name string
+	size int
+	kind int
+	val  any
 }
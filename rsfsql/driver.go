@@ -0,0 +1,313 @@
+// Copyright (C) 2023 by Posit Software, PBC
+
+// Package rsfsql provides a read-only `database/sql` driver for snapshot
+// files, so that existing reporting code can query snapshots without structs
+// or custom integration. Importing the package registers the driver as "rsf":
+//
+//	import _ "github.com/rstudio/repository-snapshot-format/rsfsql"
+//
+//	db, err := sql.Open("rsf", "file=snap.rsf")
+//	rows, err := db.Query("SELECT version, size FROM releases WHERE size > ?", 10)
+//
+// Each indexed struct array of the top-level objects is a table, whose rows
+// are the elements of the array in every object, and whose columns are the
+// fields of the elements. A query without FROM selects the top-level objects.
+// Queries use the SQL subset described by `rsf.Query`, with `?` placeholders
+// for arguments. Statements that modify data are not supported.
+package rsfsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rsf "github.com/rstudio/repository-snapshot-format"
+)
+
+// DriverName is the name of the driver registered with `database/sql`.
+const DriverName = "rsf"
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+// ErrReadOnly is returned when executing statements, since snapshots are read
+// only.
+var ErrReadOnly = errors.New("rsf snapshots are read only")
+
+// ErrNoSuchTable is returned when a query selects from a field that is not an
+// indexed struct array.
+var ErrNoSuchTable = errors.New("table not found")
+
+// Driver opens snapshot files. The data source name is a list of
+// space-separated `key=value` settings:
+//
+//   - `file`: the path of the snapshot file. Required.
+type Driver struct{}
+
+// Open opens a connection to the snapshot file described by `dsn`.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector parses `dsn` once, for use with `sql.OpenDB`.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	c := &connector{driver: d}
+	for _, setting := range strings.Fields(dsn) {
+		key, val, ok := strings.Cut(setting, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid data source setting %q", setting)
+		}
+		switch key {
+		case "file":
+			c.file = val
+		default:
+			return nil, fmt.Errorf("unknown data source setting %q", key)
+		}
+	}
+	if c.file == "" {
+		return nil, errors.New("data source does not include a file")
+	}
+	return c, nil
+}
+
+// connector opens connections to a snapshot file.
+type connector struct {
+	driver *Driver
+	file   string
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	f, err := os.Open(c.file)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{f: f}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// conn is a connection to an open snapshot file. Queries read the file with
+// `io.ReaderAt`, so a connection holds no read position.
+type conn struct {
+	f *os.File
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return c.f.Close()
+}
+
+// Begin starts a transaction. Since snapshots are read only, transactions
+// only group queries, and committing or rolling back has no effect.
+func (c *conn) Begin() (driver.Tx, error) {
+	return tx{}, nil
+}
+
+type tx struct{}
+
+func (tx) Commit() error {
+	return nil
+}
+
+func (tx) Rollback() error {
+	return nil
+}
+
+// stmt is a prepared query. Queries are bound and parsed when run.
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1, since placeholders are counted when the query is bound.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	query, err := bind(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	q, err := rsf.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTable(s.conn.f, q)
+	if err != nil {
+		return nil, err
+	}
+	res, err := q.Run(s.conn.f)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{res: res}, nil
+}
+
+// checkTable returns an error if the query selects from a field that is not
+// an indexed struct array.
+func checkTable(ra io.ReaderAt, q rsf.Query) error {
+	if q.From == "" {
+		return nil
+	}
+	obj, err := rsf.OpenObject(ra)
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range obj.Index {
+		if entry.FieldName == q.From && entry.Indexed && entry.Subfields != nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", q.From, ErrNoSuchTable)
+}
+
+// bind replaces each `?` placeholder outside of quotes in `query` with the
+// literal of the corresponding argument.
+func bind(query string, args []driver.Value) (string, error) {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	var sb strings.Builder
+	var quote rune
+	var n int
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// Doubled quotes end and restart the quoted text.
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			if n == len(args) {
+				return "", fmt.Errorf("query has more placeholders than the %d arguments", len(args))
+			}
+			lit, err := literal(args[n])
+			if err != nil {
+				return "", fmt.Errorf("argument %d: %w", n+1, err)
+			}
+			sb.WriteString(lit)
+			n++
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	if n != len(args) {
+		return "", fmt.Errorf("query has %d placeholders but %d arguments", n, len(args))
+	}
+	return sb.String(), nil
+}
+
+// literal returns the query literal of the argument `v`. Times are compared as
+// RFC3339 strings.
+func literal(v driver.Value) (string, error) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("unsupported float %v", v)
+		}
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v)), nil
+	case string:
+		return quoteString(v), nil
+	case []byte:
+		return quoteString(string(v)), nil
+	case time.Time:
+		return quoteString(v.UTC().Format(time.RFC3339Nano)), nil
+	default:
+		return "", fmt.Errorf("unsupported argument type %T", v)
+	}
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// rows iterates over the rows of a query result.
+type rows struct {
+	res rsf.QueryResult
+	pos int
+}
+
+func (r *rows) Columns() []string {
+	return r.res.Columns
+}
+
+func (r *rows) Close() error {
+	r.pos = len(r.res.Rows)
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.res.Rows) {
+		return io.EOF
+	}
+	for i, val := range r.res.Rows[r.pos] {
+		v, err := value(val)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", r.res.Columns[i], err)
+		}
+		dest[i] = v
+	}
+	r.pos++
+	return nil
+}
+
+// value converts a value read from a snapshot to a `driver.Value`. Unsigned
+// integers that do not fit an int64 are returned as decimal strings, and
+// arrays, structs, and maps are returned as JSON.
+func value(val any) (driver.Value, error) {
+	switch v := val.(type) {
+	case nil, int64, float64, bool, string, []byte, time.Time:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return strconv.FormatUint(v, 10), nil
+		}
+		return int64(v), nil
+	default:
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(bs), nil
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsfsql
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	rsf "github.com/rstudio/repository-snapshot-format"
+)
+
+type DriverSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func TestDriverSuite(t *testing.T) {
+	suite.Run(t, &DriverSuite{})
+}
+
+type release struct {
+	Version string    `rsf:"version,fixed:3"`
+	Size    uint64    `rsf:"size"`
+	Date    time.Time `rsf:"date"`
+	Tags    []string  `rsf:"tags"`
+}
+
+type pkg struct {
+	Name     string    `rsf:"name"`
+	Rating   float32   `rsf:"rating"`
+	Releases []release `rsf:"releases,index:version"`
+	Authors  []string  `rsf:"authors"`
+}
+
+var pkgs = []any{
+	pkg{Name: "dplyr", Rating: 4.5, Releases: []release{
+		{Version: "1.0", Size: 10, Date: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), Tags: []string{"old"}},
+		{Version: "2.0", Size: 1 << 63, Date: time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC)},
+	}},
+	pkg{Name: "it's", Rating: 3, Releases: []release{
+		{Version: "0.1", Size: 5, Date: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}},
+}
+
+func (s *DriverSuite) SetupTest() {
+	path := filepath.Join(s.T().TempDir(), "snap.rsf")
+	f, err := os.Create(path)
+	s.Require().Nil(err)
+	_, _, err = rsf.NewWriterWithVersion(f, rsf.Version3).WriteObjects(pkgs...)
+	s.Require().Nil(err)
+	s.Require().Nil(f.Close())
+
+	s.db, err = sql.Open("rsf", "file="+path)
+	s.Require().Nil(err)
+}
+
+func (s *DriverSuite) TearDownTest() {
+	s.Require().Nil(s.db.Close())
+}
+
+func (s *DriverSuite) TestQueryTable() {
+	rows, err := s.db.Query("SELECT version, size, date FROM releases WHERE date >= ? AND size < ?", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), 100)
+	s.Require().Nil(err)
+	defer rows.Close()
+	cols, err := rows.Columns()
+	s.Require().Nil(err)
+	s.Assert().Equal([]string{"version", "size", "date"}, cols)
+
+	s.Require().True(rows.Next())
+	var version string
+	var size int64
+	var date time.Time
+	s.Require().Nil(rows.Scan(&version, &size, &date))
+	s.Assert().Equal("0.1", version)
+	s.Assert().Equal(int64(5), size)
+	s.Assert().Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), date)
+	s.Assert().False(rows.Next())
+	s.Assert().Nil(rows.Err())
+}
+
+func (s *DriverSuite) TestValues() {
+	// Large unsigned integers are strings, and arrays are JSON.
+	var size, tags sql.NullString
+	err := s.db.QueryRow("SELECT size, tags FROM releases WHERE version = '2.0'").Scan(&size, &tags)
+	s.Require().Nil(err)
+	s.Assert().Equal("9223372036854775808", size.String)
+	s.Assert().Equal("[]", tags.String)
+
+	err = s.db.QueryRow("SELECT tags FROM releases LIMIT 1").Scan(&tags)
+	s.Require().Nil(err)
+	s.Assert().Equal(`["old"]`, tags.String)
+
+	// Queries without FROM select objects. Quotes in arguments are escaped.
+	var rating float64
+	err = s.db.QueryRow("SELECT version FROM releases WHERE version = ?;", "it's").Scan(&size)
+	s.Assert().ErrorIs(err, sql.ErrNoRows)
+	err = s.db.QueryRow(`SELECT rating WHERE name = ? AND "name" != '?'`, "it's").Scan(&rating)
+	s.Require().Nil(err)
+	s.Assert().Equal(3.0, rating)
+}
+
+func (s *DriverSuite) TestTransaction() {
+	tx, err := s.db.Begin()
+	s.Require().Nil(err)
+	var count int
+	rows, err := tx.Query("SELECT name")
+	s.Require().Nil(err)
+	for rows.Next() {
+		count++
+	}
+	s.Assert().Equal(2, count)
+	s.Assert().Nil(tx.Commit())
+}
+
+func (s *DriverSuite) TestErrors() {
+	_, err := s.db.Exec("DELETE FROM releases")
+	s.Assert().ErrorIs(err, ErrReadOnly)
+	_, err = s.db.Query("SELECT * FROM authors")
+	s.Assert().ErrorIs(err, ErrNoSuchTable)
+	_, err = s.db.Query("SELECT * FROM releases WHERE size > ?")
+	s.Assert().ErrorContains(err, "more placeholders")
+	_, err = s.db.Query("SELECT * FROM releases", 1)
+	s.Assert().ErrorContains(err, "0 placeholders but 1 arguments")
+	_, err = s.db.Query("SELECT * FROM releases WHERE")
+	s.Assert().ErrorIs(err, rsf.ErrInvalidQuery)
+
+	for _, dsn := range []string{"", "file", "path=snap.rsf"} {
+		_, err = sql.Open("rsf", dsn)
+		s.Assert().NotNil(err, dsn)
+	}
+	db, err := sql.Open("rsf", "file="+filepath.Join(s.T().TempDir(), "missing.rsf"))
+	s.Require().Nil(err)
+	s.Assert().ErrorIs(db.Ping(), os.ErrNotExist)
+}
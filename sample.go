@@ -0,0 +1,116 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"io"
+)
+
+// Sample returns up to `n` elements spread evenly across the top-level array
+// `field` of the object `obj`. For indexed arrays, the element sizes recorded
+// in the array index are used to jump directly to each sampled element, so
+// the other elements are not read. Elements of arrays that are not indexed
+// are skipped using their size information. Elements are returned in the same
+// form as `ReadFieldAt`.
+func Sample(ra io.ReaderAt, obj ObjectRef, field string, n int) ([]any, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := objectReader(ra, obj)
+	pos, off, err := s.fieldOffset(obj, field)
+	if err != nil {
+		return nil, err
+	}
+	entry := obj.Index[pos]
+	if entry.FieldType != FieldTypeArray {
+		return nil, fmt.Errorf("field %s is not an array", field)
+	}
+
+	_, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, err
+	}
+	arrayLen, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return nil, err
+	}
+	if n > arrayLen {
+		n = arrayLen
+	}
+	if n <= 0 {
+		return []any{}, nil
+	}
+
+	elEntry, err := elementEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the offset of each element
+	offsets := make([]int64, arrayLen)
+	var keys []any
+	if entry.Indexed {
+		keys, _, err = s.readKeys(entry, next, arrayLen)
+		if err != nil {
+			return nil, err
+		}
+
+		indexEntrySz := int64(entry.indexEntrySize())
+		elOff := next + int64(arrayLen)*indexEntrySz
+		for i := range offsets {
+			offsets[i] = elOff
+			var sz int
+			sz, _, err = s.ReadSizeField(next + int64(i)*indexEntrySz + int64(entry.IndexSize))
+			if err != nil {
+				return nil, err
+			}
+			elOff += int64(sz)
+		}
+	} else {
+		last := (n - 1) * arrayLen / n
+		for i := 0; i <= last; i++ {
+			offsets[i] = next
+			next, err = s.skipElement(entry, elEntry, next)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	vals := make([]any, n)
+	for i := range vals {
+		el := i * arrayLen / n
+		vals[i], _, err = s.readElement(entry, elEntry, offsets[el])
+		if err != nil {
+			return nil, err
+		}
+		if keys != nil {
+			err = setElementKey(entry, vals[i], keys[el])
+			if err != nil {
+				return nil, fmt.Errorf("array %s element %d: %w", field, el, err)
+			}
+		}
+	}
+	return vals, nil
+}
+
+// skipElement returns the offset following an array element.
+func (s *StatelessReader) skipElement(entry, elEntry IndexEntry, off int64) (int64, error) {
+	if entry.Subfields == nil && !entry.emptyElements() {
+		return s.skipValue(elEntry, off)
+	}
+
+	var err error
+	for _, subfield := range entry.Subfields {
+		off, err = s.skipValue(subfield, off)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return off, nil
+}
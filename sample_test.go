@@ -0,0 +1,64 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SampleSuite struct {
+	suite.Suite
+}
+
+func TestSampleSuite(t *testing.T) {
+	suite.Run(t, &SampleSuite{})
+}
+
+type sampleObject struct {
+	Name  string        `rsf:"name"`
+	Items []channelItem `rsf:"items,index:key"`
+	Tags  []string      `rsf:"tags"`
+}
+
+func (s *SampleSuite) TestSample() {
+	obj := sampleObject{Name: "sample"}
+	for i := 0; i < 100; i++ {
+		obj.Items = append(obj.Items, channelItem{Key: fmt.Sprintf("%03d", i), Name: fmt.Sprintf("item %d", i), Score: float64(i)})
+		obj.Tags = append(obj.Tags, fmt.Sprintf("tag %d", i))
+	}
+
+	for _, opts := range [][]WriterOption{nil, {WithFieldHashes(), Chain(Zstd())}} {
+		buf := &bytes.Buffer{}
+		_, err := NewWriterWithVersion(buf, Version3, opts...).WriteObject(obj)
+		s.Require().Nil(err)
+		ra := bytes.NewReader(buf.Bytes())
+		ref, err := OpenObject(ra)
+		s.Require().Nil(err)
+
+		// Indexed
+		items, err := Sample(ra, ref, "items", 4)
+		s.Require().Nil(err)
+		s.Assert().Equal([]any{
+			map[string]any{"key": "000", "name": "item 0", "score": float64(0)},
+			map[string]any{"key": "025", "name": "item 25", "score": float64(25)},
+			map[string]any{"key": "050", "name": "item 50", "score": float64(50)},
+			map[string]any{"key": "075", "name": "item 75", "score": float64(75)},
+		}, items)
+
+		// Not indexed
+		tags, err := Sample(ra, ref, "tags", 3)
+		s.Require().Nil(err)
+		s.Assert().Equal([]any{"tag 0", "tag 33", "tag 66"}, tags)
+
+		// More than the array length
+		tags, err = Sample(ra, ref, "tags", 1000)
+		s.Require().Nil(err)
+		s.Assert().Len(tags, 100)
+
+		_, err = Sample(ra, ref, "name", 1)
+		s.Assert().EqualError(err, "field name is not an array")
+	}
+}
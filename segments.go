@@ -0,0 +1,296 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+
+A struct array tagged with `segment:<field>` groups its elements into segments
+by the value of a string field, e.g., to store per-tenant views of a
+repository in one file. Each segment is written like an ordinary array, so
+segments are indexed separately when the array is also tagged with `index`.
+A segment directory that lists the name and offset of each segment precedes
+the segments, so a single segment can be read without reading the others. See
+`ReadSegmentAt`. Segments are written in ascending name order, and elements
+keep their relative order within each segment.
+
+In the file index, segmented arrays use `FieldTypeSegmented` and are otherwise
+described like arrays. Requires Version3 or later.
+
+Format:
+
+  [segmented array size]
+  [segment count]
+  [segment 1 name size]
+  [segment 1 name]
+  [segment 1 offset]                              // From the array size field
+  [segment n name size]
+  [segment n name]
+  [segment n offset]
+  [segment 1 array]
+  [segment n array]
+
+*/
+
+// ErrNoSuchSegment is returned by `ReadSegmentAt` when a segmented array does
+// not include the requested segment.
+var ErrNoSuchSegment = errors.New("segment not found")
+
+// checkSegments returns an error if arrays of `el` cannot be segmented using
+// the tag `t`.
+func (f *rsfWriter) checkSegments(el reflect.Type, t *tag) error {
+	if f.version < 3 {
+		return fmt.Errorf("segmented array %s requires version 3 or later", t.name)
+	}
+	if el.Kind() != reflect.Struct {
+		return fmt.Errorf("segmented array %s must contain structs", t.name)
+	}
+	if _, ok := segmentField(el, t.segment); !ok {
+		return fmt.Errorf("segment field %s not found for array %s", t.segment, t.name)
+	}
+	return nil
+}
+
+// segmentField returns the position of the string field `name` in the struct
+// type `el`.
+func segmentField(el reflect.Type, name string) (int, bool) {
+	for i := 0; i < el.NumField(); i++ {
+		fieldName, _, _ := strings.Cut(el.Field(i).Tag.Get(tagName), rsfDelim)
+		if fieldName == name && el.Field(i).Type.Kind() == reflect.String {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (f *rsfWriter) writeSegments(v reflect.Value, t *tag, buf *bytes.Buffer) (int, error) {
+	el := v.Type().Elem()
+	err := f.checkSegments(el, t)
+	if err != nil {
+		return 0, err
+	}
+	field, _ := segmentField(el, t.segment)
+
+	// Group the elements by segment
+	segments := make(map[string]reflect.Value)
+	var names []string
+	for i := 0; i < v.Len(); i++ {
+		name := v.Index(i).Field(field).String()
+		segment, ok := segments[name]
+		if !ok {
+			segment = reflect.MakeSlice(reflect.SliceOf(el), 0, 0)
+			names = append(names, name)
+		}
+		segments[name] = reflect.Append(segment, v.Index(i))
+	}
+	sort.Strings(names)
+
+	// Write each segment as an array
+	segmentTag := *t
+	segmentTag.segment = ""
+	segmentsBuf := &bytes.Buffer{}
+	offsets := make([]int, len(names))
+	dirSz := sizeFieldLen * 2
+	for i, name := range names {
+		dirSz += sizeFieldLen + f.stringSize(name)
+		offsets[i] = segmentsBuf.Len()
+		_, err = f.writeArray(segments[name], &segmentTag, segmentsBuf)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Write the size and directory
+	pos, err := f.WriteSizeField(0, dirSz+segmentsBuf.Len(), buf)
+	if err != nil {
+		return 0, err
+	}
+	pos, err = f.WriteSizeField(pos, len(names), buf)
+	if err != nil {
+		return 0, err
+	}
+	for i, name := range names {
+		pos, err = f.WriteStringField(pos, name, buf)
+		if err != nil {
+			return 0, err
+		}
+		pos, err = f.WriteSizeField(pos, dirSz+offsets[i], buf)
+		if err != nil {
+			return 0, err
+		}
+	}
+	sz, err := io.Copy(buf, segmentsBuf)
+	if err != nil {
+		return 0, err
+	}
+	return pos + int(sz), nil
+}
+
+// segmentRef records the name and offset of a segment.
+type segmentRef struct {
+	name   string
+	offset int64
+}
+
+// readSegmentDirectory reads the directory of the segmented array at `off`.
+// It returns the segments and the offset following the array.
+func (s *StatelessReader) readSegmentDirectory(off int64) ([]segmentRef, int64, error) {
+	sz, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return nil, 0, err
+	}
+	segments := make([]segmentRef, count)
+	for i := range segments {
+		segments[i].name, next, err = s.ReadStringField(next)
+		if err != nil {
+			return nil, 0, err
+		}
+		var segmentOff int
+		segmentOff, next, err = s.ReadSizeField(next)
+		if err != nil {
+			return nil, 0, err
+		}
+		segments[i].offset = off + int64(segmentOff)
+	}
+	return segments, off + int64(sz), nil
+}
+
+// readSegments reads all segments of a segmented array. Segments are returned
+// as a map of segment names to arrays.
+func (s *StatelessReader) readSegments(entry IndexEntry, off int64) (any, int64, error) {
+	segments, end, err := s.readSegmentDirectory(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	vals := make(map[string]any, len(segments))
+	for _, segment := range segments {
+		vals[segment.name], _, err = s.readArray(segmentEntry(entry), segment.offset)
+		if err != nil {
+			return nil, 0, fmt.Errorf("segment %s: %w", segment.name, err)
+		}
+	}
+	return vals, end, nil
+}
+
+// segmentEntry returns an index entry that describes each segment of a
+// segmented array.
+func segmentEntry(entry IndexEntry) IndexEntry {
+	entry.FieldType = FieldTypeArray
+	return entry
+}
+
+// openSegments locates the segment directory of the top-level segmented array
+// `field`.
+func openSegments(ra io.ReaderAt, obj ObjectRef, field string) (*StatelessReader, IndexEntry, []segmentRef, error) {
+	s := objectReader(ra, obj)
+	pos, off, err := s.fieldOffset(obj, field)
+	if err != nil {
+		return nil, IndexEntry{}, nil, err
+	}
+	entry := obj.Index[pos]
+	if entry.FieldType != FieldTypeSegmented {
+		return nil, IndexEntry{}, nil, fmt.Errorf("field %s is not a segmented array", field)
+	}
+	segments, _, err := s.readSegmentDirectory(off)
+	return s, entry, segments, err
+}
+
+// SegmentsAt returns the names of the segments of the top-level segmented
+// array `field` of the object `obj`, in ascending order.
+func SegmentsAt(ra io.ReaderAt, obj ObjectRef, field string) ([]string, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, _, segments, err := openSegments(ra, obj, field)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(segments))
+	for i := range segments {
+		names[i] = segments[i].name
+	}
+	return names, nil
+}
+
+// ReadSegmentAt reads the segment `segment` of the top-level segmented array
+// `field` of the object `obj`, without reading the other segments. Elements are
+// returned in the same form as `ReadFieldAt`. `ErrNoSuchSegment` is returned
+// if the array does not include the segment.
+func ReadSegmentAt(ra io.ReaderAt, obj ObjectRef, field, segment string) ([]any, error) {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s, entry, segments, err := openSegments(ra, obj, field)
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].name >= segment
+	})
+	if i == len(segments) || segments[i].name != segment {
+		return nil, fmt.Errorf("%w: array %s has no segment %s", ErrNoSuchSegment, field, segment)
+	}
+	val, _, err := s.readArray(segmentEntry(entry), segments[i].offset)
+	if err != nil {
+		return nil, err
+	}
+	return obj.filter(segmentEntry(entry), val).([]any), nil
+}
+
+func printSegments(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	pad := strings.Repeat(" ", indent*4)
+	_, err := reader.ReadSizeField(r)
+	if err != nil {
+		return fmt.Errorf("error reading segmented array size: %s", err)
+	}
+	count, err := reader.ReadSizeField(r)
+	if err != nil {
+		return fmt.Errorf("error reading segment count: %s", err)
+	}
+	names := make([]string, count)
+	for i := range names {
+		names[i], err = reader.ReadStringField(r)
+		if err != nil {
+			return fmt.Errorf("error reading segment name: %s", err)
+		}
+		_, err = reader.ReadSizeField(r)
+		if err != nil {
+			return fmt.Errorf("error reading segment offset: %s", err)
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "%s%s (segmented array(%d)):\n", pad, f.FieldName, count)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		segment := segmentEntry(f)
+		segment.FieldName = name
+		err = printField(parentKey, segment, w, r, reader, indent+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SegmentsSuite struct {
+	suite.Suite
+}
+
+func TestSegmentsSuite(t *testing.T) {
+	suite.Run(t, &SegmentsSuite{})
+}
+
+type segmentPkg struct {
+	Tenant string `rsf:"tenant"`
+	ID     int64  `rsf:"id"`
+	Name   string `rsf:"name"`
+}
+
+type segmentRepo struct {
+	Packages []segmentPkg `rsf:"packages,index:id,segment:tenant"`
+	Count    int64        `rsf:"count"`
+}
+
+var segmentData = segmentRepo{
+	Packages: []segmentPkg{
+		{Tenant: "b", ID: 1, Name: "plyr"},
+		{Tenant: "a", ID: 2, Name: "ggplot2"},
+		{Tenant: "b", ID: 3, Name: "dplyr"},
+	},
+	Count: 3,
+}
+
+func (s *SegmentsSuite) TestReadSegmentAt() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(segmentData)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+
+	plyr := map[string]any{"tenant": "b", "id": int64(1), "name": "plyr"}
+	ggplot2 := map[string]any{"tenant": "a", "id": int64(2), "name": "ggplot2"}
+	dplyr := map[string]any{"tenant": "b", "id": int64(3), "name": "dplyr"}
+
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	s.Assert().Equal(FieldTypeSegmented, obj.Index[0].FieldType)
+	s.Assert().True(obj.Index[0].Indexed)
+	s.Assert().Empty(featureNames(obj.Flags))
+
+	names, err := SegmentsAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	s.Assert().Equal([]string{"a", "b"}, names)
+
+	pkgs, err := ReadSegmentAt(ra, obj, "packages", "b")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{plyr, dplyr}, pkgs)
+
+	_, err = ReadSegmentAt(ra, obj, "packages", "c")
+	s.Assert().ErrorIs(err, ErrNoSuchSegment)
+	_, err = ReadSegmentAt(ra, obj, "count", "a")
+	s.Assert().EqualError(err, "field count is not a segmented array")
+
+	// Reading the whole array returns all segments
+	segments, err := ReadFieldAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{
+		"a": []any{ggplot2},
+		"b": []any{plyr, dplyr},
+	}, segments)
+	count, err := ReadFieldAt(ra, obj, "count")
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(3), count)
+}
+
+func (s *SegmentsSuite) TestInvalid() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version2).WriteObject(segmentData)
+	s.Assert().EqualError(err, "segmented array packages requires version 3 or later")
+
+	type invalid struct {
+		Items []struct {
+			Tenant int64 `rsf:"tenant"`
+		} `rsf:"items,segment:tenant"`
+	}
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(invalid{})
+	s.Assert().EqualError(err, "segment field tenant not found for array items")
+}
+
+func (s *SegmentsSuite) TestPrint() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(segmentData)
+	s.Require().Nil(err)
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(buf))
+	s.Require().Nil(err)
+	s.Assert().Contains(pbuf.String(), "packages (segmented array(2)):\n"+
+		"    a (indexed array(1)):\n")
+	s.Assert().Contains(pbuf.String(), "    b (indexed array(2)):\n")
+	s.Assert().Contains(pbuf.String(), "count (int): 3\n")
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+)
+
+/*
+
+Fields tagged with `sensitive` (e.g., `rsf:"email,sensitive"`) are marked in
+the file index, so the fields are declared once with the type rather than
+listed by each export job. `Redact` always redacts sensitive fields, and blanks
+them unless a `Redaction` drops them. Index key fields cannot be sensitive.
+
+In the file index, the type of a sensitive field also includes the
+`fieldTypeSensitive` bit. Requires Version3 or later.
+
+*/
+
+// fieldTypeSensitive is set in the index field type of a sensitive field.
+const fieldTypeSensitive = 1 << 8
+
+// indexFieldType returns the index field type of a field with the tag `t`.
+func (f *rsfWriter) indexFieldType(t *tag, fieldType int) int {
+	if t.optional {
+		fieldType |= fieldTypeOptional
+	}
+	if !t.sensitive {
+		return fieldType
+	}
+	return fieldType | fieldTypeSensitive
+}
+
+// checkSensitive returns an error if the field with the tag `t` cannot be
+// sensitive.
+func (f *rsfWriter) checkSensitive(t, tParent *tag) error {
+	if !t.sensitive {
+		return nil
+	}
+	if f.version < 3 {
+		return fmt.Errorf("sensitive field %s requires version 3 or later", t.name)
+	}
+	if tParent.index == t.name || tParent.keyPos(t.name) >= 0 {
+		return fmt.Errorf("index key field %s cannot be sensitive", t.name)
+	}
+	return nil
+}
+
+// redactSensitive adds a rule to blank each sensitive field in `index` that
+// does not already have a rule.
+func (rd *redactor) redactSensitive(prefix string, index Index) {
+	for _, entry := range index {
+		path := prefix + entry.FieldName
+		if _, ok := rd.rules[path]; !ok && entry.Sensitive {
+			rd.rules[path] = RedactBlank
+		}
+		rd.redactSensitive(path+".", entry.Subfields)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SensitiveSuite struct {
+	suite.Suite
+}
+
+func TestSensitiveSuite(t *testing.T) {
+	suite.Run(t, &SensitiveSuite{})
+}
+
+type sensitiveMaintainer struct {
+	Name  string `rsf:"name"`
+	Email string `rsf:"email,sensitive"`
+}
+
+type sensitivePkg struct {
+	Name        string                `rsf:"name,fixed:4"`
+	Maintainers []sensitiveMaintainer `rsf:"maintainers"`
+	Notes       string                `rsf:"notes,chunked,sensitive"`
+	Downloads   int64                 `rsf:"downloads"`
+}
+
+type sensitiveRepo struct {
+	Packages []sensitivePkg `rsf:"packages,index:name"`
+	Token    string         `rsf:"token,sensitive"`
+}
+
+var sensitiveData = sensitiveRepo{
+	Packages: []sensitivePkg{
+		{
+			Name:        "plyr",
+			Maintainers: []sensitiveMaintainer{{Name: "Hadley", Email: "hadley@example.com"}},
+			Notes:       "internal",
+			Downloads:   100,
+		},
+		{
+			Name:      "rlng",
+			Downloads: 200,
+		},
+	},
+	Token: "secret",
+}
+
+func (s *SensitiveSuite) write(v any) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithElementHashes())
+	_, err := w.WriteObject(v)
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+func (s *SensitiveSuite) TestIndex() {
+	r := NewReader()
+	index, err := r.ReadIndex(bufio.NewReader(bytes.NewReader(s.write(sensitiveData))))
+	s.Require().Nil(err)
+	s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+
+	var sensitive []string
+	var walk func(prefix string, index Index)
+	walk = func(prefix string, index Index) {
+		for _, entry := range index {
+			if entry.Sensitive {
+				sensitive = append(sensitive, prefix+entry.FieldName)
+			}
+			walk(prefix+entry.FieldName+".", entry.Subfields)
+		}
+	}
+	walk("", index)
+	s.Assert().Equal([]string{"packages.maintainers.email", "packages.notes", "token"}, sensitive)
+
+	// Field types do not include the sensitive marker.
+	_, pos, err := entrySet(index, "token")
+	s.Require().Nil(err)
+	s.Assert().Equal(FieldTypeVarStr, index[pos].FieldType)
+}
+
+func (s *SensitiveSuite) TestRedact() {
+	src := s.write(sensitiveData)
+
+	// Sensitive fields are blanked without being listed.
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(src), nil)
+	s.Require().Nil(err)
+
+	expected := sensitiveRepo{
+		Packages: []sensitivePkg{
+			{
+				Name:        "plyr",
+				Maintainers: []sensitiveMaintainer{{Name: "Hadley"}},
+				Downloads:   100,
+			},
+			{
+				Name:      "rlng",
+				Downloads: 200,
+			},
+		},
+	}
+	s.Assert().Equal(s.write(expected), dst.Bytes())
+
+	// Sensitive fields can be dropped instead.
+	dst.Reset()
+	_, err = Redact(dst, bytes.NewReader(src), []Redaction{{Field: "token", Mode: RedactDrop}})
+	s.Require().Nil(err)
+	br := bufio.NewReader(dst)
+	r := NewReader()
+	index, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, _, err = entrySet(index, "token")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+	var actual sensitiveRepo
+	err = r.ReadObject(br, &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(expected, actual)
+}
+
+func (s *SensitiveSuite) TestErrors() {
+	// Index key fields cannot be sensitive
+	type pkg struct {
+		Name string `rsf:"name,fixed:4,sensitive"`
+	}
+	type repo struct {
+		Packages []pkg `rsf:"packages,index:name"`
+	}
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(repo{})
+	s.Assert().EqualError(err, "index key field name cannot be sensitive")
+
+	// Sensitive fields require Version3
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version2).WriteObject(sensitiveData)
+	s.Assert().ErrorContains(err, "requires version 3 or later")
+}
@@ -0,0 +1,290 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ErrKeyNotFound is returned by `SnapshotStore.Get` when no object has the
+// requested key.
+var ErrKeyNotFound = errors.New("key not found")
+
+// SnapshotStore serves lookups of the top-level objects in an RSF file by the
+// value of a top-level key field. The file is scanned once when the store is
+// created to load the index and the key of each object, and objects are read
+// from the file on demand. Use `Reload` to replace the file.
+//
+// A SnapshotStore is safe for concurrent use provided that the underlying
+// io.ReaderAt is also safe for concurrent use (e.g., *os.File or
+// *bytes.Reader).
+type SnapshotStore struct {
+	field string
+	opts  []ReaderOption
+
+	// Guards replacing the current file. See `Reload`.
+	mu    sync.RWMutex
+	state *storeState
+}
+
+// storeState records the keys and objects of the file used by a store.
+type storeState struct {
+	ra io.ReaderAt
+
+	// The file opened by the store, if any. This is closed once the file is
+	// replaced and all in-flight reads finish. The file info and trailer
+	// digest are used by `Watch`.
+	file   *os.File
+	info   os.FileInfo
+	digest []byte
+
+	// The keys of the objects in the file, sorted in ascending order, and
+	// the corresponding objects.
+	keys    []any
+	objects []ObjectRef
+
+	// Tracks in-flight reads.
+	readers sync.WaitGroup
+}
+
+// NewSnapshotStore creates a store that looks up the objects in `ra` by the
+// value of the top-level field `field`, which must be a string or integer
+// field. Keys must be unique. Reader options, such as `WithLayers`, are used
+// when reading the file.
+func NewSnapshotStore(ra io.ReaderAt, field string, opts ...ReaderOption) (*SnapshotStore, error) {
+	s := &SnapshotStore{field: field, opts: opts}
+	var err error
+	s.state, err = s.load(ra, false)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenSnapshotStore opens the file at `path` and creates a store for it like
+// `NewSnapshotStore`. The file is validated like `Reload`. Use `Close` to
+// close the file.
+func OpenSnapshotStore(path, field string, opts ...ReaderOption) (*SnapshotStore, error) {
+	s := &SnapshotStore{field: field, opts: opts}
+	var err error
+	s.state, err = s.open(path)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload opens the file at `path`, validates it, and replaces the store's
+// current file for subsequent lookups. Lookups that are in progress finish
+// using the previous file, which is closed once they complete if it was opened
+// by the store. The file is validated by reading the key of every object and,
+// if the file includes a digest (see `WithDigest`), by verifying the digest.
+// If the file is invalid, an error is returned and the current file continues
+// to be used.
+func (s *SnapshotStore) Reload(path string) error {
+	state, err := s.open(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.state
+	s.state = state
+	s.mu.Unlock()
+
+	return old.close()
+}
+
+// Close closes the file opened by the store, if any, once all in-flight reads
+// finish. The store cannot be used after it is closed.
+func (s *SnapshotStore) Close() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.close()
+}
+
+func (st *storeState) close() error {
+	st.readers.Wait()
+	if st.file == nil {
+		return nil
+	}
+	return st.file.Close()
+}
+
+// acquire returns the current file state. The caller must call `Done` on the
+// state's `readers` once it finishes reading.
+func (s *SnapshotStore) acquire() *storeState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.state.readers.Add(1)
+	return s.state
+}
+
+func (s *SnapshotStore) open(path string) (*storeState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.load(f, true)
+	if err == nil {
+		state.info, err = f.Stat()
+	}
+	if err == nil {
+		state.digest, err = fileDigest(f, state.info.Size())
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error loading snapshot %s: %w", path, err)
+	}
+	state.file = f
+	return state, nil
+}
+
+// load reads the key of each object in `ra`. When `verify` is true, the file
+// digest is also verified, if included.
+func (s *SnapshotStore) load(ra io.ReaderAt, verify bool) (*storeState, error) {
+	st := &storeState{ra: ra}
+
+	obj, err := OpenObject(ra, s.opts...)
+	if err == nil && verify && obj.Flags&FlagDigest != 0 {
+		_, err = io.Copy(io.Discard, VerifyStream(io.NewSectionReader(ra, 0, math.MaxInt64)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for err == nil {
+		var key any
+		key, err = ReadFieldAt(ra, obj, s.field)
+		if err != nil {
+			return nil, fmt.Errorf("error reading key field %s of object at position %d: %w", s.field, obj.Offset, err)
+		}
+		switch key.(type) {
+		case string, int64:
+		default:
+			return nil, fmt.Errorf("key field %s must be a string or integer", s.field)
+		}
+		st.keys = append(st.keys, key)
+		st.objects = append(st.objects, obj)
+		obj, err = NextObject(ra, obj)
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+
+	sort.Stable(storeKeys{st})
+	for i := 1; i < len(st.keys); i++ {
+		if st.keys[i] == st.keys[i-1] {
+			return nil, fmt.Errorf("duplicate key %v", st.keys[i])
+		}
+	}
+	return st, nil
+}
+
+// storeKeys sorts the keys and objects of a store by key.
+type storeKeys struct {
+	st *storeState
+}
+
+func (k storeKeys) Len() int           { return len(k.st.keys) }
+func (k storeKeys) Less(i, j int) bool { return keyLess(k.st.keys[i], k.st.keys[j]) }
+func (k storeKeys) Swap(i, j int) {
+	k.st.keys[i], k.st.keys[j] = k.st.keys[j], k.st.keys[i]
+	k.st.objects[i], k.st.objects[j] = k.st.objects[j], k.st.objects[i]
+}
+
+// Len returns the number of objects in the store.
+func (s *SnapshotStore) Len() int {
+	st := s.acquire()
+	defer st.readers.Done()
+	return len(st.keys)
+}
+
+// Get reads the object with the key `key`. Objects are returned as a map of
+// top-level field names to values in the same form as `ReadFieldAt`.
+// `ErrKeyNotFound` is returned if no object has the key.
+func (s *SnapshotStore) Get(key any) (map[string]any, error) {
+	st := s.acquire()
+	defer st.readers.Done()
+
+	key, err := st.normalizeKey(key, s.field)
+	if err != nil {
+		return nil, err
+	}
+	i := st.search(key)
+	if i == len(st.keys) || st.keys[i] != key {
+		return nil, fmt.Errorf("%w: %v", ErrKeyNotFound, key)
+	}
+	return readObjectAt(st.ra, st.objects[i])
+}
+
+// Range reads the objects with keys from `from`, inclusive, to `to`,
+// exclusive, in ascending key order.
+func (s *SnapshotStore) Range(from, to any) ([]map[string]any, error) {
+	st := s.acquire()
+	defer st.readers.Done()
+
+	refs, err := st.between(from, to, s.field)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]any
+	for _, ref := range refs {
+		var obj map[string]any
+		obj, err = readObjectAt(st.ra, ref)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// between returns the objects with keys from `from`, inclusive, to `to`,
+// exclusive, in ascending key order.
+func (st *storeState) between(from, to any, field string) ([]ObjectRef, error) {
+	from, err := st.normalizeKey(from, field)
+	if err != nil {
+		return nil, err
+	}
+	to, err = st.normalizeKey(to, field)
+	if err != nil {
+		return nil, err
+	}
+	i := st.search(from)
+	j := i
+	for j < len(st.keys) && keyLess(st.keys[j], to) {
+		j++
+	}
+	return st.objects[i:j], nil
+}
+
+// search returns the position of the first key that is not less than `key`.
+func (st *storeState) search(key any) int {
+	return sort.Search(len(st.keys), func(i int) bool {
+		return !keyLess(st.keys[i], key)
+	})
+}
+
+// normalizeKey converts integer keys to int64, and ensures that `key` has the
+// same type as the keys in the key field `field`.
+func (st *storeState) normalizeKey(key any, field string) (any, error) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.String:
+		key = v.String()
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		key = v.Int()
+	default:
+		return nil, fmt.Errorf("invalid key type %T", key)
+	}
+	if len(st.keys) > 0 && reflect.TypeOf(st.keys[0]) != reflect.TypeOf(key) {
+		return nil, fmt.Errorf("invalid key type %T for key field %s", key, field)
+	}
+	return key, nil
+}
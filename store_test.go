@@ -0,0 +1,216 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type StoreSuite struct {
+	suite.Suite
+}
+
+func TestStoreSuite(t *testing.T) {
+	suite.Run(t, &StoreSuite{})
+}
+
+type storePkg struct {
+	Name    string `rsf:"name"`
+	Version int64  `rsf:"version"`
+}
+
+func writeStorePkgs(s *suite.Suite, pkgs []storePkg, opts ...WriterOption) *bytes.Reader {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, opts...)
+	for _, pkg := range pkgs {
+		_, err := w.WriteObject(pkg)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+	return bytes.NewReader(buf.Bytes())
+}
+
+var storePkgs = []storePkg{
+	{Name: "plyr", Version: 3},
+	{Name: "dplyr", Version: 1},
+	{Name: "ggplot2", Version: 2},
+}
+
+func (s *StoreSuite) TestGet() {
+	store, err := NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs, WithDigest()), "name")
+	s.Require().Nil(err)
+	s.Assert().Equal(3, store.Len())
+
+	pkg, err := store.Get("ggplot2")
+	s.Assert().Nil(err)
+	s.Assert().Equal(map[string]any{"name": "ggplot2", "version": int64(2)}, pkg)
+
+	_, err = store.Get("tidyr")
+	s.Assert().ErrorIs(err, ErrKeyNotFound)
+	s.Assert().EqualError(err, "key not found: tidyr")
+
+	_, err = store.Get(1)
+	s.Assert().EqualError(err, "invalid key type int64 for key field name")
+
+	// Integer keys
+	store, err = NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs), "version")
+	s.Require().Nil(err)
+	pkg, err = store.Get(3)
+	s.Assert().Nil(err)
+	s.Assert().Equal(map[string]any{"name": "plyr", "version": int64(3)}, pkg)
+}
+
+func (s *StoreSuite) TestRange() {
+	store, err := NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs), "name")
+	s.Require().Nil(err)
+
+	pkgs, err := store.Range("b", "h")
+	s.Assert().Nil(err)
+	s.Assert().Equal([]map[string]any{
+		{"name": "dplyr", "version": int64(1)},
+		{"name": "ggplot2", "version": int64(2)},
+	}, pkgs)
+
+	pkgs, err = store.Range("ggplot2", "plyr")
+	s.Assert().Nil(err)
+	s.Assert().Equal([]map[string]any{{"name": "ggplot2", "version": int64(2)}}, pkgs)
+
+	pkgs, err = store.Range("x", "z")
+	s.Assert().Nil(err)
+	s.Assert().Empty(pkgs)
+}
+
+func (s *StoreSuite) TestLayersAndFieldHashes() {
+	key := bytes.Repeat([]byte{1}, 32)
+	ra := writeStorePkgs(&s.Suite, storePkgs, WithFieldHashes(), Chain(Zstd(), AESGCM(key)))
+	store, err := NewSnapshotStore(ra, "version", WithLayers(AESGCM(key)))
+	s.Require().Nil(err)
+	pkg, err := store.Get(1)
+	s.Assert().Nil(err)
+	s.Assert().Equal(map[string]any{"name": "dplyr", "version": int64(1)}, pkg)
+}
+
+func (s *StoreSuite) TestErrors() {
+	_, err := NewSnapshotStore(writeStorePkgs(&s.Suite, append(storePkgs, storePkgs[0])), "name")
+	s.Assert().EqualError(err, "duplicate key plyr")
+
+	_, err = NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs), "missing")
+	s.Assert().ErrorIs(err, ErrNoSuchField)
+
+}
+
+func (s *StoreSuite) TestConcurrentGet() {
+	store, err := NewSnapshotStore(writeStorePkgs(&s.Suite, storePkgs), "name")
+	s.Require().Nil(err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pkg := storePkgs[i%len(storePkgs)]
+			obj, err := store.Get(pkg.Name)
+			if err == nil && obj["version"] != pkg.Version {
+				err = ErrKeyMismatch
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		s.Assert().Nil(err)
+	}
+}
+
+func writeStoreFile(s *suite.Suite, path string, pkgs []storePkg, opts ...WriterOption) {
+	ra := writeStorePkgs(s, pkgs, opts...)
+	data := make([]byte, ra.Len())
+	_, err := ra.Read(data)
+	s.Require().Nil(err)
+	s.Require().Nil(os.WriteFile(path, data, 0644))
+}
+
+func (s *StoreSuite) TestReload() {
+	dir := s.T().TempDir()
+	first := filepath.Join(dir, "first.rsf")
+	second := filepath.Join(dir, "second.rsf")
+	writeStoreFile(&s.Suite, first, storePkgs, WithDigest())
+	writeStoreFile(&s.Suite, second, []storePkg{{Name: "tidyr", Version: 4}}, WithDigest())
+
+	store, err := OpenSnapshotStore(first, "name")
+	s.Require().Nil(err)
+	s.Assert().Equal(3, store.Len())
+
+	// Reads that are in progress finish using the previous file
+	old := store.acquire()
+	reloaded := make(chan error)
+	go func() {
+		reloaded <- store.Reload(second)
+	}()
+	s.Eventually(func() bool { return store.Len() == 1 }, time.Second, time.Millisecond)
+	pkg, err := readObjectAt(old.ra, old.objects[0])
+	s.Assert().Nil(err)
+	s.Assert().Equal("dplyr", pkg["name"])
+	select {
+	case <-reloaded:
+		s.Fail("previous file closed during read")
+	default:
+	}
+	old.readers.Done()
+	s.Assert().Nil(<-reloaded)
+
+	// The previous file is closed
+	_, err = readObjectAt(old.ra, old.objects[0])
+	s.Assert().ErrorIs(err, os.ErrClosed)
+
+	pkg, err = store.Get("tidyr")
+	s.Assert().Nil(err)
+	s.Assert().Equal(map[string]any{"name": "tidyr", "version": int64(4)}, pkg)
+	_, err = store.Get("dplyr")
+	s.Assert().ErrorIs(err, ErrKeyNotFound)
+
+	s.Assert().Nil(store.Close())
+}
+
+func (s *StoreSuite) TestReloadInvalid() {
+	dir := s.T().TempDir()
+	path := filepath.Join(dir, "snapshot.rsf")
+	writeStoreFile(&s.Suite, path, storePkgs, WithDigest())
+	store, err := OpenSnapshotStore(path, "name")
+	s.Require().Nil(err)
+	defer store.Close()
+
+	// Corrupt data fails digest verification
+	corrupt := filepath.Join(dir, "corrupt.rsf")
+	writeStoreFile(&s.Suite, corrupt, storePkgs, WithDigest())
+	data, err := os.ReadFile(corrupt)
+	s.Require().Nil(err)
+	i := bytes.Index(data, []byte("ggplot2"))
+	data[i] = 'x'
+	s.Require().Nil(os.WriteFile(corrupt, data, 0644))
+	err = store.Reload(corrupt)
+	s.Assert().ErrorIs(err, ErrDigestMismatch)
+
+	// Duplicate keys
+	duplicate := filepath.Join(dir, "duplicate.rsf")
+	writeStoreFile(&s.Suite, duplicate, append(storePkgs, storePkgs[0]))
+	err = store.Reload(duplicate)
+	s.Assert().ErrorContains(err, "duplicate key plyr")
+
+	err = store.Reload(filepath.Join(dir, "missing.rsf"))
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+
+	// The current file continues to be used
+	s.Assert().Equal(3, store.Len())
+	_, err = store.Get("ggplot2")
+	s.Assert().Nil(err)
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+/*
+
+A named struct field with an `rsf` tag name (e.g., `Meta Meta `rsf:"meta"``)
+is written as a sub-record that contains the struct fields, prefixed with its
+size so that readers can skip it without reading its fields. Embedded structs
+and struct fields without a tag name are flattened into the enclosing struct,
+as are all struct fields written by versions earlier than Version3.
+
+In the file index, sub-records use `FieldTypeStruct` and list their fields
+like struct arrays. With a Reader, use `AdvanceTo` with the path of a
+sub-record field (e.g., `"meta", "name"`) after reading the sub-record size
+to descend into it, and `AdvanceToNextElement` with the path of the
+sub-record (e.g., `"meta"`) to skip its remaining fields.
+`ReadFieldAt` returns sub-records as `map[string]any`.
+
+Format:
+
+  [sub-record size]                               // Includes the size field
+  [field 1]
+  [field n]
+
+*/
+
+// nested returns true if the struct field `i` of `v`, which has the tag name
+// `name`, is written as a sub-record.
+func nested(v reflect.Type, i int, name string) bool {
+	field := v.Field(i)
+	fieldType := field.Type
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	return fieldType.Kind() == reflect.Struct && fieldType != timeType && !field.Anonymous && name != ""
+}
+
+func (f *rsfWriter) writeIndexNested(v reflect.Type, t *tag, buf *bytes.Buffer) (int, error) {
+	totalSz, err := f.writeIndexFixed(t, FieldTypeStruct, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	subfieldsBuf := &bytes.Buffer{}
+	_, subfields, err := f.writeIndexStruct(v, t, subfieldsBuf)
+	if err != nil {
+		return 0, err
+	}
+	sz, err := f.WriteSizeField(0, subfields, buf)
+	if err != nil {
+		return 0, err
+	}
+	totalSz += sz
+
+	szCopy, err := io.Copy(buf, subfieldsBuf)
+	if err != nil {
+		return 0, err
+	}
+	return totalSz + int(szCopy), nil
+}
+
+func (f *rsfWriter) writeNested(v reflect.Value, t *tag, buf *bytes.Buffer) (int, error) {
+	fieldsBuf := &bytes.Buffer{}
+	sz, err := f.writeStruct(v, t, fieldsBuf)
+	if err != nil {
+		return 0, err
+	}
+	sz += sizeFieldLen
+	_, err = f.WriteSizeField(0, sz, buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(buf, fieldsBuf)
+	if err != nil {
+		return 0, err
+	}
+	return sz, nil
+}
+
+// readStruct reads a sub-record as a map of field names to values.
+func (s *StatelessReader) readStruct(entry IndexEntry, off int64) (any, int64, error) {
+	sz, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	vals := make(map[string]any, len(entry.Subfields))
+	for _, subfield := range entry.Subfields {
+		vals[subfield.FieldName], next, err = s.readValue(subfield, next)
+		if err != nil {
+			return nil, 0, fmt.Errorf("field %s: %w", subfield.FieldName, err)
+		}
+	}
+	if end := off + int64(sz); next != end {
+		return nil, 0, fmt.Errorf("struct %s at position %d: read %d of %d bytes", entry.FieldName, off, next-off, sz)
+	}
+	return vals, next, nil
+}
+
+func printStruct(parentKey string, f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	pad := strings.Repeat(" ", indent*4)
+	_, err := reader.ReadSizeField(r)
+	if err != nil {
+		return fmt.Errorf("error reading struct size: %s", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s (struct):\n", pad, f.FieldName)
+	if err != nil {
+		return err
+	}
+	for _, subfield := range f.Subfields {
+		err = printField(parentKey, subfield, w, r, reader, indent+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
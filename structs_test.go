@@ -0,0 +1,251 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type StructsSuite struct {
+	suite.Suite
+}
+
+func TestStructsSuite(t *testing.T) {
+	suite.Run(t, &StructsSuite{})
+}
+
+type structMaintainer struct {
+	Name  string `rsf:"name"`
+	Email string `rsf:"email"`
+}
+
+type structMeta struct {
+	Source     string           `rsf:"source,fixed:4"`
+	Maintainer structMaintainer `rsf:"maintainer"`
+	Tags       []string         `rsf:"tags"`
+}
+
+type structEmbedded struct {
+	Stars int64 `rsf:"stars"`
+}
+
+type structPkg struct {
+	Name string     `rsf:"name"`
+	Meta structMeta `rsf:"meta"`
+	structEmbedded
+	Version string `rsf:"version"`
+}
+
+var structData = structPkg{
+	Name: "ggplot2",
+	Meta: structMeta{
+		Source:     "cran",
+		Maintainer: structMaintainer{Name: "Hadley", Email: "hadley@example.com"},
+		Tags:       []string{"plots", "graphics"},
+	},
+	structEmbedded: structEmbedded{Stars: 6000},
+	Version:        "3.4.4",
+}
+
+func (s *StructsSuite) TestIndex() {
+	index, err := IndexOf(structData)
+	s.Require().Nil(err)
+
+	// Embedded structs are flattened.
+	s.Assert().Equal(Index{
+		{FieldName: "name", FieldType: FieldTypeVarStr},
+		{FieldName: "meta", FieldType: FieldTypeStruct, Subfields: Index{
+			{FieldName: "source", FieldType: FieldTypeFixedStr, FieldSize: 4},
+			{FieldName: "maintainer", FieldType: FieldTypeStruct, Subfields: Index{
+				{FieldName: "name", FieldType: FieldTypeVarStr},
+				{FieldName: "email", FieldType: FieldTypeVarStr},
+			}},
+			{FieldName: "tags", FieldType: FieldTypeArray, SubfieldType: 24},
+		}},
+		{FieldName: "stars", FieldType: FieldTypeInt64},
+		{FieldName: "version", FieldType: FieldTypeVarStr},
+	}, index)
+}
+
+func (s *StructsSuite) TestReadObject() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldHashes()},
+	} {
+		buf := &bytes.Buffer{}
+		w := NewWriterWithVersion(buf, Version3, opts...)
+		_, err := w.WriteObject(structData)
+		s.Require().Nil(err)
+
+		r := NewReader()
+		var actual structPkg
+		err = r.ReadObject(bufio.NewReader(buf), &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+
+		// The embedded struct is not read since its fields are flattened.
+		expected := structData
+		expected.structEmbedded = structEmbedded{}
+		s.Assert().Equal(expected, actual)
+	}
+}
+
+func (s *StructsSuite) TestReadFieldAt() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(structData)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+
+	meta, err := ReadFieldAt(ra, obj, "meta")
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]any{
+		"source": "cran",
+		"maintainer": map[string]any{
+			"name":  "Hadley",
+			"email": "hadley@example.com",
+		},
+		"tags": []any{"plots", "graphics"},
+	}, meta)
+
+	// Fields following a struct are located by skipping it.
+	version, err := ReadFieldAt(ra, obj, "version")
+	s.Require().Nil(err)
+	s.Assert().Equal("3.4.4", version)
+}
+
+func (s *StructsSuite) TestAdvanceTo() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(structData)
+	s.Require().Nil(err)
+	_, err = w.WriteObject(structData)
+	s.Require().Nil(err)
+
+	br := bufio.NewReader(buf)
+	r := NewReader()
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+
+	// Descend into the struct
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "meta")
+	s.Require().Nil(err)
+	_, err = r.ReadSizeField(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "meta", "maintainer")
+	s.Require().Nil(err)
+	_, err = r.ReadSizeField(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "meta", "maintainer", "email")
+	s.Require().Nil(err)
+	email, err := r.ReadStringField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal("hadley@example.com", email)
+	err = r.AdvanceToNextElement(br, "meta", "maintainer")
+	s.Require().Nil(err)
+	err = r.AdvanceToNextElement(br, "meta")
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "version")
+	s.Require().Nil(err)
+	version, err := r.ReadStringField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal("3.4.4", version)
+
+	// Skip the struct
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "stars")
+	s.Require().Nil(err)
+	stars, err := r.ReadIntField(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(6000), stars)
+}
+
+func (s *StructsSuite) TestVersion2() {
+	// Earlier versions flatten struct fields.
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version2).WriteObject(structData)
+	s.Require().Nil(err)
+
+	r := NewReader()
+	index, err := r.ReadIndex(bufio.NewReader(buf))
+	s.Require().Nil(err)
+	names := make([]string, len(index))
+	for i, entry := range index {
+		names[i] = entry.FieldName
+	}
+	s.Assert().Equal([]string{"name", "source", "name", "email", "tags", "stars", "version"}, names)
+}
+
+func (s *StructsSuite) TestPrint() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(structData)
+	s.Require().Nil(err)
+
+	out := &strings.Builder{}
+	err = Print(out, bufio.NewReader(buf))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `meta (struct):
+    source (string(4)): cran
+    maintainer (struct):
+        name (string): Hadley
+        email (string): hadley@example.com
+    tags (array(2)):
+        -plots
+        -graphics
+stars (int): 6000
+version (string): 3.4.4
+`)
+}
+
+func (s *StructsSuite) TestRedact() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, WithFieldOffsets()).WriteObject(structData)
+	s.Require().Nil(err)
+
+	dst := &bytes.Buffer{}
+	_, err = Redact(dst, bytes.NewReader(buf.Bytes()), []Redaction{
+		{Field: "meta.maintainer.email", Mode: RedactBlank},
+		{Field: "meta.tags", Mode: RedactDrop},
+	})
+	s.Require().Nil(err)
+
+	var actual structPkg
+	err = NewReader().ReadObject(bufio.NewReader(dst), &actual)
+	s.Require().Nil(err)
+	expected := structData
+	expected.structEmbedded = structEmbedded{}
+	expected.Meta.Maintainer.Email = ""
+	expected.Meta.Tags = nil
+	s.Assert().Equal(expected, actual)
+
+	// Structs are blanked field by field.
+	dst.Reset()
+	_, err = Redact(dst, bytes.NewReader(buf.Bytes()), []Redaction{{Field: "meta", Mode: RedactBlank}})
+	s.Require().Nil(err)
+	actual = structPkg{}
+	err = NewReader().ReadObject(bufio.NewReader(dst), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(structPkg{Name: "ggplot2", Meta: structMeta{Source: "    "}, Version: "3.4.4"}, actual)
+}
+
+func (s *StructsSuite) TestReadStructMismatch() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(structData)
+	s.Require().Nil(err)
+	data := buf.Bytes()
+
+	obj, err := OpenObject(bytes.NewReader(data))
+	s.Require().Nil(err)
+	// Skip the object size and "ggplot2", and shorten the struct size.
+	data[obj.Offset+4+11]--
+	_, err = ReadFieldAt(bytes.NewReader(data), obj, "meta")
+	s.Assert().ErrorContains(err, "struct meta")
+}
@@ -0,0 +1,231 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"errors"
+	"io"
+)
+
+// Summary describes the objects in a file. See `Summarize`.
+type Summary struct {
+	// The number of top-level objects
+	Objects int
+	// The total and largest size of the objects as stored in the file,
+	// including the object size fields.
+	TotalSize int64
+	MaxSize   int
+	// The total size of the objects after decoding any layers. This is the
+	// same as TotalSize for files that do not use layers. See `Chain`.
+	DecodedSize int64
+	// The total bytes used by each top-level field
+	FieldSizes map[string]int64
+	// The smallest and largest keys of each top-level indexed array
+	KeyRanges map[string]KeyRange
+	// The element counts and sizes of each top-level array
+	Arrays map[string]ArrayStats
+}
+
+// KeyRange is the range of keys of an indexed array. Keys are `string` or
+// `int64` values.
+type KeyRange struct {
+	Min any
+	Max any
+}
+
+// ArrayStats describes the elements of a top-level array in all objects.
+type ArrayStats struct {
+	// The number of elements
+	Elements int64
+	// The total and largest encoded size of the elements, including any
+	// provenance. The sizes exclude the array size and length fields and the
+	// array index.
+	TotalSize int64
+	MaxSize   int
+}
+
+// AverageSize returns the average encoded element size.
+func (a ArrayStats) AverageSize() float64 {
+	if a.Elements == 0 {
+		return 0
+	}
+	return float64(a.TotalSize) / float64(a.Elements)
+}
+
+// add records an element of size `sz`.
+func (a *ArrayStats) add(sz int) {
+	a.Elements++
+	a.TotalSize += int64(sz)
+	if sz > a.MaxSize {
+		a.MaxSize = sz
+	}
+}
+
+// AverageSize returns the average object size as stored in the file.
+func (s Summary) AverageSize() float64 {
+	if s.Objects == 0 {
+		return 0
+	}
+	return float64(s.TotalSize) / float64(s.Objects)
+}
+
+// FieldShare returns the fraction of the decoded object bytes used by a
+// top-level field.
+func (s Summary) FieldShare(field string) float64 {
+	if s.DecodedSize == 0 {
+		return 0
+	}
+	return float64(s.FieldSizes[field]) / float64(s.DecodedSize)
+}
+
+// CompressionRatio returns the ratio of the decoded object size to the stored
+// object size. The ratio is 1 for files that do not use layers.
+func (s Summary) CompressionRatio() float64 {
+	if s.TotalSize == 0 {
+		return 1
+	}
+	return float64(s.DecodedSize) / float64(s.TotalSize)
+}
+
+// Summarize reads each object in a file and returns statistics about object
+// sizes, top-level field sizes, the element counts and sizes of top-level
+// arrays, and the key ranges of top-level indexed arrays. The element sizes of
+// indexed arrays are read from the array index, and the elements of other
+// arrays are skipped to find their sizes. Reader options, such as
+// `WithLayers`, are used when opening the file.
+func Summarize(ra io.ReaderAt, opts ...ReaderOption) (Summary, error) {
+	summary := Summary{
+		FieldSizes: make(map[string]int64),
+		KeyRanges:  make(map[string]KeyRange),
+		Arrays:     make(map[string]ArrayStats),
+	}
+
+	obj, err := OpenObject(ra, opts...)
+	for ; err == nil; obj, err = NextObject(ra, obj) {
+		summary.Objects++
+		summary.TotalSize += int64(obj.Size)
+		if obj.Size > summary.MaxSize {
+			summary.MaxSize = obj.Size
+		}
+
+		err = summarizeObject(ra, obj, &summary)
+		if err != nil {
+			return Summary{}, err
+		}
+	}
+	if !errors.Is(err, io.EOF) {
+		return Summary{}, err
+	}
+
+	return summary, nil
+}
+
+func summarizeObject(ra io.ReaderAt, obj ObjectRef, summary *Summary) error {
+	var err error
+	if obj.Flags&FlagLayers != 0 {
+		ra, obj, err = decodeObjectAt(ra, obj)
+		if err != nil {
+			return err
+		}
+	}
+	summary.DecodedSize += int64(obj.Size)
+
+	s := objectReader(ra, obj)
+
+	// Skip the object size and the field offset table, if any.
+	off := obj.Offset + sizeFieldLen
+	if obj.Flags&FlagFieldOffsets != 0 {
+		var count int
+		count, off, err = s.ReadSizeField(off)
+		if err != nil {
+			return err
+		}
+		entrySz := sizeFieldLen
+		if obj.Flags&FlagFieldHashes != 0 {
+			entrySz += sizeFieldLen
+		}
+		off += int64(count * entrySz)
+	}
+
+	for _, entry := range obj.Index {
+		if entry.FieldType == FieldTypeArray {
+			err = s.summarizeArray(entry, off, summary)
+			if err != nil {
+				return err
+			}
+		}
+
+		var next int64
+		next, err = s.skipValue(entry, off)
+		if err != nil {
+			return err
+		}
+		summary.FieldSizes[entry.FieldName] += next - off
+		off = next
+	}
+	return nil
+}
+
+// summarizeArray updates the element statistics of the array at `off`, and
+// the key range of indexed arrays.
+func (s *StatelessReader) summarizeArray(entry IndexEntry, off int64, summary *Summary) error {
+	stats := summary.Arrays[entry.FieldName]
+	defer func() {
+		summary.Arrays[entry.FieldName] = stats
+	}()
+
+	if entry.Indexed {
+		handles, err := elementHandles(s, entry, off)
+		if err != nil {
+			return err
+		}
+		keys, ok := summary.KeyRanges[entry.FieldName]
+		for _, handle := range handles {
+			stats.add(handle.Size)
+			if !ok {
+				keys = KeyRange{Min: handle.Key, Max: handle.Key}
+				ok = true
+			} else if keyLess(handle.Key, keys.Min) {
+				keys.Min = handle.Key
+			} else if keyLess(keys.Max, handle.Key) {
+				keys.Max = handle.Key
+			}
+		}
+		if ok {
+			summary.KeyRanges[entry.FieldName] = keys
+		}
+		return nil
+	}
+
+	_, next, err := s.ReadSizeField(off)
+	if err != nil {
+		return err
+	}
+	arrayLen, next, err := s.ReadSizeField(next)
+	if err != nil {
+		return err
+	}
+	elEntry, err := elementEntry(entry)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < arrayLen; i++ {
+		var end int64
+		end, err = s.skipElement(entry, elEntry, next)
+		if err != nil {
+			return err
+		}
+		stats.add(int(end - next))
+		next = end
+	}
+	return nil
+}
+
+func keyLess(a, b any) bool {
+	switch a := a.(type) {
+	case string:
+		return a < b.(string)
+	case int64:
+		return a < b.(int64)
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SummarySuite struct {
+	suite.Suite
+}
+
+func TestSummarySuite(t *testing.T) {
+	suite.Run(t, &SummarySuite{})
+}
+
+type summaryObject struct {
+	Name  string        `rsf:"name"`
+	Items []channelItem `rsf:"items,index:key"`
+}
+
+func (s *SummarySuite) write(opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, opts...)
+	_, err := w.WriteObject(summaryObject{Name: strings.Repeat("a", 100), Items: channelItems})
+	s.Require().Nil(err)
+	_, err = w.WriteObject(summaryObject{Name: "b", Items: []channelItem{{Key: "aaa"}}})
+	s.Require().Nil(err)
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+func (s *SummarySuite) TestSummarize() {
+	summary, err := Summarize(bytes.NewReader(s.write(WithFieldOffsets())))
+	s.Require().Nil(err)
+
+	s.Assert().Equal(2, summary.Objects)
+	// First object: size 4, offset table 4+2*4, name 4+100, and items
+	// 8+3*(3+4)+(3+4+5+8)+(3+4+6+8)+(3+4+5+8)=90.
+	// Second object: size 4, offset table 12, name 4+1, and items
+	// 8+(3+4)+(3+4+0+8)=30.
+	s.Assert().Equal(int64(210+51), summary.TotalSize)
+	s.Assert().Equal(210, summary.MaxSize)
+	s.Assert().Equal(130.5, summary.AverageSize())
+	s.Assert().Equal(summary.TotalSize, summary.DecodedSize)
+	s.Assert().Equal(1.0, summary.CompressionRatio())
+	s.Assert().Equal(map[string]int64{"name": 104 + 5, "items": 90 + 30}, summary.FieldSizes)
+	s.Assert().InDelta(109.0/261.0, summary.FieldShare("name"), 0.0001)
+	s.Assert().Equal(map[string]KeyRange{"items": {Min: "aaa", Max: "ghi"}}, summary.KeyRanges)
+	s.Assert().Equal(map[string]ArrayStats{"items": {Elements: 4, TotalSize: 20 + 21 + 20 + 15, MaxSize: 21}}, summary.Arrays)
+	s.Assert().Equal(19.0, summary.Arrays["items"].AverageSize())
+
+	// Compressed
+	compressed, err := Summarize(bytes.NewReader(s.write(WithFieldOffsets(), Chain(Zstd()))))
+	s.Require().Nil(err)
+	s.Assert().Equal(summary.DecodedSize, compressed.DecodedSize)
+	s.Assert().Equal(summary.FieldSizes, compressed.FieldSizes)
+	s.Assert().Equal(summary.KeyRanges, compressed.KeyRanges)
+	s.Assert().Equal(summary.Arrays, compressed.Arrays)
+	s.Assert().Greater(compressed.CompressionRatio(), 1.0)
+}
+
+func (s *SummarySuite) TestSummarizeArrays() {
+	type object struct {
+		Items []channelItem `rsf:"items"`
+		Names []string      `rsf:"names"`
+		Empty []string      `rsf:"empty"`
+	}
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(object{Items: channelItems, Names: []string{"a", "bcd"}})
+	s.Require().Nil(err)
+	_, err = w.WriteObject(object{Names: []string{"efghij"}})
+	s.Require().Nil(err)
+
+	// The elements of arrays without an index are skipped to find their
+	// sizes. Each string element includes a 4-byte size.
+	summary, err := Summarize(bytes.NewReader(buf.Bytes()))
+	s.Require().Nil(err)
+	s.Assert().Equal(map[string]ArrayStats{
+		"items": {Elements: 3, TotalSize: 20 + 21 + 20, MaxSize: 21},
+		"names": {Elements: 3, TotalSize: 5 + 7 + 10, MaxSize: 10},
+		"empty": {},
+	}, summary.Arrays)
+	s.Assert().Equal(0.0, summary.Arrays["empty"].AverageSize())
+	s.Assert().Empty(summary.KeyRanges)
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+
+A `time.Time` field is written as an integer that holds the number of
+nanoseconds since the Unix epoch, or, with the `time:rfc3339` tag option, as a
+fixed-size RFC3339 string in UTC with nanosecond precision. RFC3339 strings
+sort in time order, so they are easier to compare when inspecting a file. The
+zero time is written as the minimum int64 value or as
+"0001-01-01T00:00:00.000000000Z", and times are read in UTC.
+
+In the file index, a time field uses `FieldTypeTime`, followed by the string
+size, which is zero for the integer encoding. Version2 and earlier record time
+fields as `FieldTypeInt64` or `FieldTypeFixedStr` instead. Use `ReadTimeField`
+with the `FieldSize` of the index entry to read a time field.
+
+Format:
+
+  [unix nanoseconds]                              // 10 bytes, or
+  [RFC3339 string]                                // 30 bytes
+
+Index Format:
+
+  [name]                                          // String field
+  [type]                                          // 4 bytes: FieldTypeTime
+  [size]                                          // 4 bytes: 0 or 30
+
+*/
+
+const (
+	// Time encodings selected with `rsfTime`.
+	timeUnixNano = "unixnano"
+	timeRFC3339  = "rfc3339"
+
+	// The layout and size of RFC3339 time strings.
+	timeLayout     = "2006-01-02T15:04:05.000000000Z07:00"
+	sizeTimeString = len("2006-01-02T15:04:05.000000000Z")
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (f *rsfWriter) writeIndexTime(t *tag, buf *bytes.Buffer) (int, error) {
+	var size int
+	switch t.timeFormat {
+	case "", timeUnixNano:
+	case timeRFC3339:
+		size = sizeTimeString
+	default:
+		return 0, fmt.Errorf("unknown time encoding %s for field %s", t.timeFormat, t.name)
+	}
+
+	if f.version < 3 {
+		if size == 0 {
+			return f.writeIndexFixed(t, FieldTypeInt64, buf)
+		}
+		t.fixed = size
+		return f.writeIndexString(t, buf)
+	}
+
+	sz, err := f.writeIndexFixed(t, FieldTypeTime, buf)
+	if err != nil {
+		return 0, err
+	}
+	sizeSz, err := f.WriteSizeField(0, size, buf)
+	return sz + sizeSz, err
+}
+
+func (f *rsfWriter) writeTime(val time.Time, t *tag, buf *bytes.Buffer) (int, error) {
+	if t.timeFormat == timeRFC3339 {
+		s := val.UTC().Format(timeLayout)
+		if len(s) != sizeTimeString {
+			return 0, fmt.Errorf("time %s of field %s cannot be written as RFC3339", val, t.name)
+		}
+		return f.WriteFixedStringField(0, sizeTimeString, s, buf)
+	}
+
+	nanos := int64(math.MinInt64)
+	if !val.IsZero() {
+		nanos = val.UnixNano()
+		if nanos == math.MinInt64 || !time.Unix(0, nanos).Equal(val) {
+			return 0, fmt.Errorf("time %s of field %s cannot be written as Unix nanoseconds", val, t.name)
+		}
+	}
+	return f.WriteInt64Field(0, nanos, buf)
+}
+
+// decodeTime converts a time encoded as Unix nanoseconds or as an RFC3339
+// string to a time in UTC.
+func decodeTime(nanos int64, s string) (time.Time, error) {
+	if s != "" {
+		return time.Parse(timeLayout, s)
+	}
+	if nanos == math.MinInt64 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+// ReadTimeField reads a time field. `sz` is the `FieldSize` of the index
+// entry, which is zero for times written as Unix nanoseconds. See
+// `FieldTypeTime`.
+func (f *rsfReader) ReadTimeField(sz int, r io.Reader) (time.Time, error) {
+	f.owner.check()
+	if sz == 0 {
+		nanos, err := f.ReadIntField(r)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return decodeTime(nanos, "")
+	}
+	s, err := f.ReadFixedStringField(sz, r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return decodeTime(0, s)
+}
+
+// ReadTimeField reads a time field at `off`, and returns the offset following
+// the field. See `rsfReader.ReadTimeField`.
+func (s *StatelessReader) ReadTimeField(sz int, off int64) (time.Time, int64, error) {
+	if sz == 0 {
+		nanos, next, err := s.ReadIntField(off)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		val, err := decodeTime(nanos, "")
+		return val, next, err
+	}
+	str, next, err := s.ReadFixedStringField(sz, off)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	val, err := decodeTime(0, str)
+	return val, next, err
+}
+
+// timeFormat returns the time encoding of a time field.
+func timeFormat(entry IndexEntry) string {
+	if entry.FieldSize == 0 {
+		return timeUnixNano
+	}
+	return timeRFC3339
+}
+
+func printTime(f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	val, err := reader.ReadTimeField(f.FieldSize, r)
+	if err != nil {
+		return fmt.Errorf("error reading time: %s", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s (time): %s\n", strings.Repeat(" ", indent*4), f.FieldName, val.Format(time.RFC3339Nano))
+	return err
+}
@@ -0,0 +1,222 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TimesSuite struct {
+	suite.Suite
+}
+
+func TestTimesSuite(t *testing.T) {
+	suite.Run(t, &TimesSuite{})
+}
+
+type timeSnap struct {
+	Date     string    `rsf:"date,fixed:10"`
+	Released time.Time `rsf:"released,time:rfc3339"`
+}
+
+type timePkg struct {
+	Name      string     `rsf:"name"`
+	Updated   time.Time  `rsf:"updated"`
+	Published time.Time  `rsf:"published,time:rfc3339"`
+	Yanked    *time.Time `rsf:"yanked"`
+	Snapshots []timeSnap `rsf:"snapshots,index:date"`
+}
+
+var testTime = time.Date(2024, 3, 1, 7, 30, 0, 123456789, time.FixedZone("EST", -5*60*60))
+
+var timeData = []timePkg{
+	{
+		Name:      "ggplot2",
+		Updated:   testTime,
+		Published: testTime.Add(-time.Hour),
+		Yanked:    ptr(testTime.Add(time.Hour)),
+		Snapshots: []timeSnap{
+			{Date: "2024-03-01", Released: testTime},
+		},
+	},
+	{
+		Name:    "rlang",
+		Updated: time.Unix(0, 0),
+	},
+}
+
+func (s *TimesSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range timeData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+// writeV2 writes the time fields of `timeData` with Version2, which does not
+// support pointers.
+func (s *TimesSuite) writeV2() []byte {
+	type timeV2Pkg struct {
+		Name      string    `rsf:"name"`
+		Updated   time.Time `rsf:"updated"`
+		Published time.Time `rsf:"published,time:rfc3339"`
+	}
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version2)
+	for _, obj := range timeData {
+		_, err := w.WriteObject(timeV2Pkg{Name: obj.Name, Updated: obj.Updated, Published: obj.Published})
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *TimesSuite) TestReadObject() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	for _, obj := range timeData {
+		// Times are read in UTC, and zero times are read as zero times
+		expected := obj
+		expected.Updated = obj.Updated.UTC()
+		expected.Published = obj.Published.UTC()
+		if obj.Yanked != nil {
+			expected.Yanked = ptr(obj.Yanked.UTC())
+		}
+		expected.Snapshots = nil
+		for _, snap := range obj.Snapshots {
+			expected.Snapshots = append(expected.Snapshots, timeSnap{Date: snap.Date, Released: snap.Released.UTC()})
+		}
+
+		var actual timePkg
+		err := r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+	s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+}
+
+func (s *TimesSuite) TestIndex() {
+	index, err := IndexOf(timePkg{})
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "updated", FieldType: FieldTypeTime}, index[1])
+	s.Assert().Equal(IndexEntry{FieldName: "published", FieldType: FieldTypeTime, FieldSize: 30}, index[2])
+	s.Assert().Equal(IndexEntry{FieldName: "yanked", FieldType: FieldTypeTime, Optional: true}, index[3])
+
+	// Older versions record times as integers and fixed strings
+	br := bufio.NewReader(bytes.NewReader(s.writeV2()))
+	r := NewReader()
+	index, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "updated", FieldType: FieldTypeInt64}, index[1])
+	s.Assert().Equal(IndexEntry{FieldName: "published", FieldType: FieldTypeFixedStr, FieldSize: 30}, index[2])
+}
+
+func (s *TimesSuite) TestReadTimeField() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	_, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+
+	err = r.AdvanceTo(br, "updated")
+	s.Require().Nil(err)
+	updated, err := r.ReadTimeField(0, br)
+	s.Require().Nil(err)
+	s.Assert().True(testTime.Equal(updated))
+	published, err := r.ReadTimeField(30, br)
+	s.Require().Nil(err)
+	s.Assert().Equal("2024-03-01T11:30:00.123456789Z", published.Format(time.RFC3339Nano))
+	err = r.EndObject(br)
+	s.Require().Nil(err)
+
+	// Version2 time fields can be read the same way
+	br = bufio.NewReader(bytes.NewReader(s.writeV2()))
+	r = NewReader()
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "published")
+	s.Require().Nil(err)
+	published, err = r.ReadTimeField(30, br)
+	s.Require().Nil(err)
+	s.Assert().True(testTime.Add(-time.Hour).Equal(published))
+}
+
+func (s *TimesSuite) TestReadFieldAt() {
+	ra := bytes.NewReader(s.write())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "published")
+	s.Require().Nil(err)
+	s.Assert().Equal(testTime.Add(-time.Hour).UTC(), val)
+
+	obj, err = NextObject(ra, obj)
+	s.Require().Nil(err)
+	val, err = ReadFieldAt(ra, obj, "published")
+	s.Require().Nil(err)
+	s.Assert().Equal(time.Time{}, val)
+	val, err = ReadFieldAt(ra, obj, "updated")
+	s.Require().Nil(err)
+	s.Assert().Equal(time.Unix(0, 0).UTC(), val)
+}
+
+func (s *TimesSuite) TestPrint() {
+	out := &strings.Builder{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write())))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `name (string): ggplot2
+updated (time): 2024-03-01T12:30:00.123456789Z
+published (time): 2024-03-01T11:30:00.123456789Z
+yanked (time): 2024-03-01T13:30:00.123456789Z
+`)
+	s.Assert().Contains(out.String(), `updated (time): 1970-01-01T00:00:00Z
+published (time): 0001-01-01T00:00:00Z
+yanked: nil
+`)
+}
+
+func (s *TimesSuite) TestRedact() {
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(s.write()), []Redaction{
+		{Field: "updated", Mode: RedactBlank},
+		{Field: "snapshots.released", Mode: RedactBlank},
+	})
+	s.Require().Nil(err)
+
+	var actual timePkg
+	err = NewReader().ReadObject(bufio.NewReader(dst), &actual)
+	s.Require().Nil(err)
+	s.Assert().True(actual.Updated.IsZero())
+	s.Assert().True(actual.Snapshots[0].Released.IsZero())
+	s.Assert().Equal(testTime.Add(-time.Hour).UTC(), actual.Published)
+}
+
+func (s *TimesSuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		T time.Time `rsf:"t,time:unix"`
+	}{})
+	s.Assert().EqualError(err, "unknown time encoding unix for field t")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		T time.Time `rsf:"t,time:rfc3339"`
+	}{T: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	s.Assert().EqualError(err, "time 10000-01-01 00:00:00 +0000 UTC of field t cannot be written as RFC3339")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		T time.Time `rsf:"t"`
+	}{T: time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	s.Assert().EqualError(err, "time 1000-01-01 00:00:00 +0000 UTC of field t cannot be written as Unix nanoseconds")
+
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(struct {
+		T []time.Time `rsf:"t"`
+	}{})
+	s.Assert().EqualError(err, "array t has unsupported element type time.Time")
+}
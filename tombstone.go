@@ -0,0 +1,70 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+/*
+
+Struct array elements can be soft-deleted with a bool field tagged with
+`deleted`. A deleted element remains in the file as a tombstone, e.g., so that
+audit tooling can see deletions. For example:
+
+  type pkg struct {
+    Name    string `rsf:"name"`
+    Deleted bool   `rsf:"deleted,deleted"`
+  }
+
+Version3 and later record tombstone fields in the index using
+`FieldTypeDeleted`, so that readers can omit deleted elements without knowing
+the struct. See `WithDeleted` for the functions that omit them.
+
+*/
+
+// DeletedMode determines how deleted array elements are returned.
+type DeletedMode int
+
+const (
+	// DeletedExclude omits deleted elements. This is the default.
+	DeletedExclude DeletedMode = iota
+
+	// DeletedInclude returns deleted elements like any other element.
+	DeletedInclude
+
+	// DeletedFlag returns deleted elements wrapped in a `DeletedElement`, so
+	// that they can be distinguished with a type switch.
+	DeletedFlag
+)
+
+// DeletedElement wraps a deleted array element when using `DeletedFlag`.
+type DeletedElement struct {
+	Element map[string]any
+}
+
+// WithDeleted determines how deleted array elements are returned by
+// `ReadObject`, and by `ReadFieldAt`, `ReadSegmentAt`, `Select`, `Aggregate`,
+// and `Pager` when reading objects opened with `OpenObject`. By default,
+// deleted elements are omitted from files that record tombstone fields in the
+// index. Functions that return handles from the array index, such as
+// `ElementHandles`, `ElementAt`, and `NewFixedView`, and the sequential Reader
+// methods that read array elements one at a time, return deleted elements
+// regardless of the mode, so callers must check the tombstone field.
+func WithDeleted(mode DeletedMode) ReaderOption {
+	return func(f *rsfReader) {
+		f.deleted = mode
+	}
+}
+
+// filterDeleted applies `mode` to the elements of the array value `val`
+// described by `entry`, including elements of nested arrays.
+func filterDeleted(entry IndexEntry, val any, mode DeletedMode) any {
+	if mode == DeletedInclude {
+		return val
+	}
+	return filterElements(entry, val, FieldTypeDeleted, func(el map[string]any, field string) (any, bool) {
+		if deleted, _ := el[field].(bool); !deleted {
+			return el, true
+		}
+		if mode == DeletedFlag {
+			return DeletedElement{Element: el}, true
+		}
+		return nil, false
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TombstoneSuite struct {
+	suite.Suite
+}
+
+func TestTombstoneSuite(t *testing.T) {
+	suite.Run(t, &TombstoneSuite{})
+}
+
+type tombstonePkg struct {
+	Name    string `rsf:"name"`
+	Deleted bool   `rsf:"deleted,deleted"`
+}
+
+type tombstoneRepo struct {
+	Packages []tombstonePkg `rsf:"packages"`
+}
+
+var tombstoneData = tombstoneRepo{
+	Packages: []tombstonePkg{
+		{Name: "ggplot2"},
+		{Name: "plyr", Deleted: true},
+		{Name: "dplyr"},
+	},
+}
+
+func (s *TombstoneSuite) TestWithDeleted() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(tombstoneData)
+	s.Require().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+
+	ggplot2 := map[string]any{"name": "ggplot2", "deleted": false}
+	plyr := map[string]any{"name": "plyr", "deleted": true}
+	dplyr := map[string]any{"name": "dplyr", "deleted": false}
+
+	// Deleted elements are omitted by default
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	s.Assert().Equal(FieldTypeDeleted, obj.Index[0].Subfields[1].FieldType)
+	s.Assert().Empty(featureNames(obj.Flags))
+	pkgs, err := ReadFieldAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{ggplot2, dplyr}, pkgs)
+
+	obj, err = OpenObject(ra, WithDeleted(DeletedInclude))
+	s.Require().Nil(err)
+	pkgs, err = ReadFieldAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{ggplot2, plyr, dplyr}, pkgs)
+
+	obj, err = OpenObject(ra, WithDeleted(DeletedFlag))
+	s.Require().Nil(err)
+	pkgs, err = ReadFieldAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{ggplot2, DeletedElement{Element: plyr}, dplyr}, pkgs)
+
+	// Version2 files do not record tombstone fields
+	buf.Reset()
+	_, err = NewWriterWithVersion(buf, Version2).WriteObject(tombstoneData)
+	s.Require().Nil(err)
+	ra = bytes.NewReader(buf.Bytes())
+	obj, err = OpenObject(ra)
+	s.Require().Nil(err)
+	pkgs, err = ReadFieldAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	s.Assert().Equal([]any{ggplot2, plyr, dplyr}, pkgs)
+}
+
+func (s *TombstoneSuite) TestNestedAndExpired() {
+	type release struct {
+		Packages []tombstonePkg `rsf:"packages"`
+		Expires  int64          `rsf:"expires,expires"`
+		Deleted  bool           `rsf:"deleted,deleted"`
+	}
+	type object struct {
+		Releases []release `rsf:"releases"`
+	}
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(object{
+		Releases: []release{
+			{Packages: tombstoneData.Packages},
+			{Packages: tombstoneData.Packages, Expires: 999},
+			{Packages: tombstoneData.Packages, Deleted: true},
+		},
+	})
+	s.Require().Nil(err)
+
+	// Expiry and tombstone filters apply to nested arrays
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra, WithExpiry(expiryNow))
+	s.Require().Nil(err)
+	releases, err := ReadFieldAt(ra, obj, "releases")
+	s.Require().Nil(err)
+	s.Require().Len(releases, 1)
+	s.Assert().Equal([]any{
+		map[string]any{"name": "ggplot2", "deleted": false},
+		map[string]any{"name": "dplyr", "deleted": false},
+	}, releases.([]any)[0].(map[string]any)["packages"])
+}
+
+func (s *TombstoneSuite) TestDeletedNotBool() {
+	type invalid struct {
+		Items []struct {
+			Deleted int64 `rsf:"deleted,deleted"`
+		} `rsf:"items"`
+	}
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version3).WriteObject(invalid{})
+	s.Assert().EqualError(err, "deleted field deleted must be a bool")
+}
+
+func (s *TombstoneSuite) TestPrint() {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3).WriteObject(tombstoneRepo{Packages: tombstoneData.Packages[1:2]})
+	s.Require().Nil(err)
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(buf))
+	s.Require().Nil(err)
+	s.Assert().Contains(pbuf.String(), "deleted (deleted): true\n")
+}
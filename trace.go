@@ -0,0 +1,118 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+
+A read trace records the reads issued to an io.ReaderAt, in order, so that the
+access pattern of a workload can be captured in production and replayed
+against other reader configurations, such as a `CoalescingReaderAt` with a
+different gap. See `NewRecordingReaderAt` and `Replay`.
+
+Format:
+
+  A text file with one line per read:
+
+  [offset] [length]\n                             // Decimal integers
+
+*/
+
+// TraceRead is a read recorded in a read trace.
+type TraceRead struct {
+	Offset int64
+	Length int
+}
+
+// RecordingReaderAt wraps an io.ReaderAt and records the offset and length of
+// each read to a read trace. A RecordingReaderAt is safe for concurrent use
+// provided that the underlying io.ReaderAt is also safe for concurrent use.
+// Concurrent reads are recorded in the order they are issued.
+type RecordingReaderAt struct {
+	ra io.ReaderAt
+
+	// Guards writing the trace, and records the first error writing it.
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewRecordingReaderAt creates a RecordingReaderAt that reads from `ra` and
+// writes the read trace to `w`. Reads succeed even if the trace cannot be
+// written; use `Err` to check for errors writing the trace.
+func NewRecordingReaderAt(ra io.ReaderAt, w io.Writer) *RecordingReaderAt {
+	return &RecordingReaderAt{ra: ra, w: w}
+}
+
+func (r *RecordingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.w, "%d %d\n", off, len(p))
+	}
+	r.mu.Unlock()
+	return r.ra.ReadAt(p, off)
+}
+
+// Err returns the first error that occurred while writing the read trace.
+func (r *RecordingReaderAt) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReadTrace reads a read trace written by a `RecordingReaderAt`.
+func ReadTrace(r io.Reader) ([]TraceRead, error) {
+	var reads []TraceRead
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var read TraceRead
+		_, err := fmt.Sscanf(scanner.Text(), "%d %d", &read.Offset, &read.Length)
+		if err != nil || read.Offset < 0 || read.Length < 0 {
+			return nil, fmt.Errorf("invalid read trace line %d: %q", line, scanner.Text())
+		}
+		reads = append(reads, read)
+	}
+	return reads, scanner.Err()
+}
+
+// ReplayStats summarizes the reads executed by `Replay`.
+type ReplayStats struct {
+	// The number of reads and the total bytes read
+	Reads int
+	Bytes int64
+	// The total time spent reading
+	Duration time.Duration
+}
+
+// Replay re-executes the reads in `trace`, in order, against `ra`. Reads that
+// extend past the end of `ra` are not errors, since the trace may have been
+// recorded against a different file. To compare access patterns, wrap the
+// reader that counts requests to the underlying storage, e.g.,
+// `NewCoalescingReaderAt(ra, gap)`, and compare its request count after
+// replaying the same trace with different settings.
+func Replay(ra io.ReaderAt, trace []TraceRead) (ReplayStats, error) {
+	var stats ReplayStats
+	var buf []byte
+	start := time.Now()
+	for i, read := range trace {
+		if cap(buf) < read.Length {
+			buf = make([]byte, read.Length)
+		}
+		n, err := ra.ReadAt(buf[:read.Length], read.Offset)
+		stats.Reads++
+		stats.Bytes += int64(n)
+		if err != nil && !errors.Is(err, io.EOF) {
+			stats.Duration = time.Since(start)
+			return stats, fmt.Errorf("error replaying read %d at offset %d: %w", i, read.Offset, err)
+		}
+	}
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TraceSuite struct {
+	suite.Suite
+}
+
+func TestTraceSuite(t *testing.T) {
+	suite.Run(t, &TraceSuite{})
+}
+
+func (s *TraceSuite) TestRecordAndReplay() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range testComplexData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	data := buf.Bytes()
+
+	// Record the reads of a workload
+	trace := &bytes.Buffer{}
+	counted := &countingReaderAt{ra: bytes.NewReader(data)}
+	ra := NewRecordingReaderAt(counted, trace)
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	_, err = ReadFieldAt(ra, obj, "snapshots")
+	s.Require().Nil(err)
+	s.Require().Nil(ra.Err())
+
+	reads, err := ReadTrace(bytes.NewReader(trace.Bytes()))
+	s.Require().Nil(err)
+	s.Assert().Len(reads, int(counted.reads.Load()))
+	s.Assert().Equal(TraceRead{Offset: 0, Length: reads[0].Length}, reads[0])
+
+	// Replay the trace directly and with coalescing
+	direct := &countingReaderAt{ra: bytes.NewReader(data)}
+	stats, err := Replay(direct, reads)
+	s.Require().Nil(err)
+	s.Assert().Equal(len(reads), stats.Reads)
+	s.Assert().Equal(int64(len(reads)), direct.reads.Load())
+
+	coalesced := &countingReaderAt{ra: bytes.NewReader(data)}
+	stats, err = Replay(NewCoalescingReaderAt(coalesced, 4096), reads)
+	s.Require().Nil(err)
+	s.Assert().Equal(len(reads), stats.Reads)
+	s.Assert().Less(coalesced.reads.Load(), direct.reads.Load())
+
+	// Reads past the end of the file are not errors
+	stats, err = Replay(bytes.NewReader([]byte("abc")), []TraceRead{{Offset: 1, Length: 4}, {Offset: 10, Length: 1}})
+	s.Require().Nil(err)
+	s.Assert().Equal(ReplayStats{Reads: 2, Bytes: 2, Duration: stats.Duration}, stats)
+}
+
+func (s *TraceSuite) TestErrors() {
+	_, err := ReadTrace(strings.NewReader("0 8\n8 x\n"))
+	s.Assert().EqualError(err, `invalid read trace line 2: "8 x"`)
+	_, err = ReadTrace(strings.NewReader("-1 8\n"))
+	s.Assert().EqualError(err, `invalid read trace line 1: "-1 8"`)
+
+	_, err = Replay(failingReaderAt{}, []TraceRead{{Offset: 4, Length: 4}})
+	s.Assert().EqualError(err, "error replaying read 0 at offset 4: unavailable")
+
+	// Trace write errors are recorded, but reads succeed
+	ra := NewRecordingReaderAt(bytes.NewReader([]byte("abcd")), failingWriter{})
+	n, err := ra.ReadAt(make([]byte, 2), 0)
+	s.Require().Nil(err)
+	s.Assert().Equal(2, n)
+	s.Assert().ErrorIs(ra.Err(), errWriteFailed)
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+/*
+
+Unsigned integer fields (e.g., `uint`, `uint32`, or `uint64`) are written as
+8-byte, little-endian unsigned integers, so values above the maximum int64 do
+not overflow. In the file index, unsigned fields use `FieldTypeUint64`. Use
+`ReadUint64Field` to read an unsigned field. Requires Version3 or later.
+
+Format:
+
+  [value]                                         // 8 bytes
+
+*/
+
+// The size of an unsigned integer field.
+const sizeUint64 = 8
+
+// isUnsigned returns true if `k` is an unsigned integer kind.
+func isUnsigned(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return true
+	default:
+		return false
+	}
+}
+
+// useUnsigned returns an error if the field, array, or map `t` cannot include
+// unsigned integers.
+func (f *rsfWriter) useUnsigned(t *tag) error {
+	if f.version < 3 {
+		return fmt.Errorf("unsigned field %s requires version 3 or later", t.name)
+	}
+	return nil
+}
+
+func (f *rsfWriter) writeIndexUnsigned(t *tag, buf *bytes.Buffer) (int, error) {
+	err := f.useUnsigned(t)
+	if err != nil {
+		return 0, err
+	}
+	return f.writeIndexFixed(t, FieldTypeUint64, buf)
+}
+
+func printUnsigned(f IndexEntry, w io.Writer, r *bufio.Reader, reader Reader, indent int) error {
+	u, err := reader.ReadUint64Field(r)
+	if err != nil {
+		return fmt.Errorf("error reading uint: %s", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s (uint): %d\n", strings.Repeat(" ", indent*4), f.FieldName, u)
+	return err
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type UnsignedSuite struct {
+	suite.Suite
+}
+
+func TestUnsignedSuite(t *testing.T) {
+	suite.Run(t, &UnsignedSuite{})
+}
+
+type unsignedPkg struct {
+	Name      string            `rsf:"name"`
+	Downloads uint64            `rsf:"downloads"`
+	Size      uint32            `rsf:"size"`
+	Stars     uint              `rsf:"stars"`
+	Counts    []uint32          `rsf:"counts"`
+	Mirrors   map[string]uint64 `rsf:"mirrors"`
+}
+
+var unsignedData = []unsignedPkg{
+	{
+		Name:      "ggplot2",
+		Downloads: math.MaxUint64,
+		Size:      math.MaxUint32,
+		Stars:     6300,
+		Counts:    []uint32{1, 2, 3},
+		Mirrors:   map[string]uint64{"cran": math.MaxInt64 + 1},
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *UnsignedSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	for _, obj := range unsignedData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *UnsignedSuite) TestReadObject() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	for _, expected := range unsignedData {
+		var actual unsignedPkg
+		err := r.ReadObject(br, &actual)
+		s.Require().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+	s.Assert().Equal(Version3, r.Header().MinReaderVersion)
+}
+
+func (s *UnsignedSuite) TestIndex() {
+	index, err := IndexOf(unsignedPkg{})
+	s.Require().Nil(err)
+	s.Assert().Equal(IndexEntry{FieldName: "downloads", FieldType: FieldTypeUint64}, index[1])
+	s.Assert().Equal(IndexEntry{FieldName: "size", FieldType: FieldTypeUint64}, index[2])
+	s.Assert().Equal(IndexEntry{FieldName: "stars", FieldType: FieldTypeUint64}, index[3])
+}
+
+func (s *UnsignedSuite) TestReadUint64Field() {
+	br := bufio.NewReader(bytes.NewReader(s.write()))
+	r := NewReader()
+	_, err := r.ReadIndex(br)
+	s.Require().Nil(err)
+	_, err = r.BeginObject(br)
+	s.Require().Nil(err)
+	err = r.AdvanceTo(br, "downloads")
+	s.Require().Nil(err)
+	u, err := r.ReadUint64Field(br)
+	s.Require().Nil(err)
+	s.Assert().Equal(uint64(math.MaxUint64), u)
+
+	ra := bytes.NewReader(s.write())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "size")
+	s.Require().Nil(err)
+	s.Assert().Equal(uint64(math.MaxUint32), val)
+}
+
+func (s *UnsignedSuite) TestPrint() {
+	out := &strings.Builder{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write())))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), `name (string): ggplot2
+downloads (uint): 18446744073709551615
+size (uint): 4294967295
+stars (uint): 6300
+`)
+}
+
+func (s *UnsignedSuite) TestRedact() {
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(s.write()), []Redaction{
+		{Field: "downloads", Mode: RedactBlank},
+	})
+	s.Require().Nil(err)
+
+	var actual unsignedPkg
+	err = NewReader().ReadObject(bufio.NewReader(dst), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal(uint64(0), actual.Downloads)
+	s.Assert().Equal(unsignedData[0].Size, actual.Size)
+}
+
+func (s *UnsignedSuite) TestErrors() {
+	_, err := NewWriterWithVersion(&bytes.Buffer{}, Version2).WriteObject(struct {
+		N uint `rsf:"n"`
+	}{})
+	s.Assert().EqualError(err, "unsigned field n requires version 3 or later")
+
+	// Values that overflow the destination field cannot be read
+	buf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version3).WriteObject(struct {
+		N uint64 `rsf:"n"`
+	}{N: math.MaxUint32 + 1})
+	s.Require().Nil(err)
+	var small struct {
+		N uint32 `rsf:"n"`
+	}
+	err = NewReader().ReadObject(bufio.NewReader(buf), &small)
+	s.Assert().ErrorContains(err, "value 4294967296 overflows uint32")
+}
@@ -0,0 +1,202 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/*
+Varints
+
+By default, `int64` fields are written as zig-zag varints padded to 10 bytes,
+and the lengths of strings and byte slices are written as 4-byte size fields.
+Files written with `WithVarints` set `FlagVarints` in the file header and use
+compact encodings instead, which shrinks snapshots with many small records:
+
+  - `int64` values, including expiry fields, times written as Unix
+    nanoseconds, and the elements of `[]int64` arrays, are written as
+    zig-zag varints of 1 to 10 bytes, as in protobuf `sint64` fields.
+  - The lengths of strings and byte slices, including field names in the
+    index, are written as unsigned varints of 1 to 5 bytes.
+
+Sizes that readers use to skip or locate values are not affected: object,
+array, struct, and map sizes, element counts, chunk sizes, and offsets are
+still written as 4-byte size fields. The keys of indexed arrays are still
+written in fixed-size 10-byte slots, so that array indexes can be searched
+without decoding every key. Fixed-width values, such as floats, narrow
+integers, and `uint64` fields, keep their width.
+
+Format of a varint `int64` value:
+
+  [value]                                         // 1-10 bytes (zig-zag varint)
+
+Format of a string or byte slice:
+
+  [length]                                        // 1-5 bytes (uvarint)
+  [value]                                         // `length` bytes
+
+Readers select fixed or varint decoding from the file header, so files can be
+read without additional options.
+*/
+
+// ErrInvalidVarint is returned when reading a malformed varint.
+var ErrInvalidVarint = errors.New("invalid varint")
+
+// WithVarints writes integers and the lengths of strings and byte slices as
+// compact varints. Requires Version3 or later.
+func WithVarints() WriterOption {
+	return func(f *rsfWriter) {
+		f.flags |= FlagVarints
+		f.enc.varints = true
+	}
+}
+
+// writeVarint writes `val` as a zig-zag varint, padded to 10 bytes unless the
+// encoding uses compact varints.
+func (f *rsfWriter) writeVarint(val int64, r io.Writer) (int, error) {
+	if !f.enc.varints {
+		return f.writeIntKey(val, r)
+	}
+	bs := make([]byte, 0, binary.MaxVarintLen64)
+	return r.Write(binary.AppendVarint(bs, val))
+}
+
+// writeIntKey writes `val` as a zig-zag varint padded to 10 bytes, for the
+// keys of indexed arrays, which are always fixed-size.
+func (f *rsfWriter) writeIntKey(val int64, r io.Writer) (int, error) {
+	bs := make([]byte, sizeInt64)
+	binary.PutVarint(bs, val)
+	return r.Write(bs)
+}
+
+// writeLength writes the length of a string or byte slice.
+func (f *rsfWriter) writeLength(n int, r io.Writer) (int, error) {
+	if !f.enc.varints {
+		return f.WriteSizeField(0, n, r)
+	}
+	bs := make([]byte, 0, binary.MaxVarintLen32)
+	return r.Write(binary.AppendUvarint(bs, uint64(uint32(n))))
+}
+
+// stringSize returns the encoded size of the string `s`, including its
+// length.
+func (f *rsfWriter) stringSize(s string) int {
+	if !f.enc.varints {
+		return sizeFieldLen + len(s)
+	}
+	return len(binary.AppendUvarint(nil, uint64(len(s)))) + len(s)
+}
+
+// readVarint reads the bytes of a compact varint.
+func (f *rsfReader) readVarint(r io.Reader) ([]byte, error) {
+	r = f.source(r)
+	bs := make([]byte, binary.MaxVarintLen64)
+	for i := range bs {
+		_, err := io.ReadFull(r, bs[i:i+1])
+		if err != nil {
+			return nil, err
+		}
+		f.pos++
+		if bs[i] < 0x80 {
+			return bs[:i+1], nil
+		}
+	}
+	return nil, ErrInvalidVarint
+}
+
+// readIntKey reads an integer written in a fixed-size 10-byte slot.
+func (f *rsfReader) readIntKey(r io.Reader) (int64, error) {
+	bs := make([]byte, sizeInt64)
+	i, err := io.ReadFull(f.source(r), bs)
+	f.pos += i
+	if err != nil {
+		return 0, err
+	}
+	val, n := binary.Varint(bs)
+	if n <= 0 {
+		return 0, ErrInvalidVarint
+	}
+	return val, nil
+}
+
+// readLength reads the length of a string or byte slice.
+func (f *rsfReader) readLength(r io.Reader) (int, error) {
+	if !f.enc.varints {
+		return f.ReadSizeField(r)
+	}
+	bs, err := f.readVarint(r)
+	if err != nil {
+		return 0, err
+	}
+	val, n := binary.Uvarint(bs)
+	if n <= 0 || val > maxLength {
+		return 0, ErrInvalidVarint
+	}
+	return int(val), nil
+}
+
+// maxLength is the largest length that can be written as a size field.
+const maxLength = 1<<32 - 1
+
+// parseLength parses the length of a string at the start of `data`, returning
+// the length and the size of the encoded length, or zero if `data` does not
+// begin with a valid length.
+func (e encoding) parseLength(data []byte) (int, int) {
+	if !e.varints {
+		if len(data) < sizeFieldLen {
+			return 0, 0
+		}
+		return int(e.byteOrder().Uint32(data)), sizeFieldLen
+	}
+	val, n := binary.Uvarint(data)
+	if n <= 0 || val > maxLength {
+		return 0, 0
+	}
+	return int(val), n
+}
+
+// discardInt discards an integer written with `WriteInt64Field`.
+func (f *rsfReader) discardInt(buf *bufio.Reader) error {
+	if !f.enc.varints {
+		return f.Discard(sizeInt64, buf)
+	}
+	_, err := f.readVarint(buf)
+	return err
+}
+
+// readIntKey reads an integer written in a fixed-size 10-byte slot at `off`,
+// and returns the offset following the integer.
+func (s *StatelessReader) readIntKey(off int64) (int64, int64, error) {
+	f, r := s.at(off)
+	val, err := f.readIntKey(r)
+	return val, int64(f.pos), err
+}
+
+// readLength reads the length of a string or byte slice at `off`, and returns
+// the offset following the length.
+func (s *StatelessReader) readLength(off int64) (int, int64, error) {
+	f, r := s.at(off)
+	val, err := f.readLength(r)
+	return val, int64(f.pos), err
+}
+
+// readVarintArray decodes the data of an array of `arrayLen` compact varints.
+func (f *rsfReader) readVarintArray(start, arrayLen int, data []byte) ([]int64, error) {
+	vals := f.arena.makeInt64s(arrayLen)
+	var off int
+	for i := range vals {
+		var n int
+		vals[i], n = binary.Varint(data[off:])
+		if n <= 0 {
+			return nil, ErrArrayMismatch{Pos: int64(start), Len: arrayLen, Size: len(data) + sizeFieldLen*2, ReadLen: i, ReadSize: off + sizeFieldLen*2}
+		}
+		off += n
+	}
+	if off != len(data) {
+		return nil, ErrArrayMismatch{Pos: int64(start), Len: arrayLen, Size: len(data) + sizeFieldLen*2, ReadLen: arrayLen, ReadSize: off + sizeFieldLen*2}
+	}
+	return vals, nil
+}
@@ -0,0 +1,215 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type VarintsSuite struct {
+	suite.Suite
+}
+
+func TestVarintsSuite(t *testing.T) {
+	suite.Run(t, &VarintsSuite{})
+}
+
+type varintRelease struct {
+	ID      int64  `rsf:"id"`
+	Date    string `rsf:"date,skip,fixed:10"`
+	Version int64  `rsf:"version,skip"`
+	Notes   string `rsf:"notes"`
+	Expires int64  `rsf:"expires,expires"`
+}
+
+type varintPkg struct {
+	Name      string             `rsf:"name"`
+	Downloads int64              `rsf:"downloads"`
+	Stars     int32              `rsf:"stars,int32"`
+	Counts    []int64            `rsf:"counts"`
+	Tags      []string           `rsf:"tags"`
+	Checksum  []byte             `rsf:"checksum"`
+	Updated   time.Time          `rsf:"updated"`
+	Ranks     map[string]int64   `rsf:"ranks"`
+	Releases  []varintRelease    `rsf:"releases,index:date+version"`
+	Packages  []segmentPkg       `rsf:"packages,index:id,segment:tenant"`
+	Optional  *string            `rsf:"optional"`
+	Versions  []predicateRelease `rsf:"versions,index:version"`
+}
+
+var varintData = []varintPkg{
+	{
+		Name:      "ggplot2",
+		Downloads: -1 << 40,
+		Stars:     7,
+		Counts:    []int64{0, -1, 1 << 62, 300},
+		Tags:      []string{"graphics", "", "tidyverse"},
+		Checksum:  []byte{0xde, 0xad, 0xbe, 0xef},
+		Updated:   time.Date(2023, 4, 5, 6, 7, 8, 9, time.UTC),
+		Ranks:     map[string]int64{"cran": -3, "posit": 1},
+		Releases: []varintRelease{
+			{Date: "2023-01-01", Version: 1, Notes: "first", Expires: 0},
+			{Date: "2023-02-01", Version: -200, Notes: string(bytes.Repeat([]byte("x"), 300)), Expires: 1 << 40},
+		},
+		// Segments are read in segment order.
+		Packages: []segmentPkg{segmentData.Packages[1], segmentData.Packages[0], segmentData.Packages[2]},
+		Versions: predicateReleases,
+	},
+	{
+		Name: "rlang",
+	},
+}
+
+func (s *VarintsSuite) write(opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, opts...)
+	for _, obj := range varintData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+	return buf.Bytes()
+}
+
+func (s *VarintsSuite) TestReadObject() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithFieldHashes(), WithObjectTable(), WithDigest()},
+		{Chain(Checksum(), Zstd()), WithElementHashes()},
+		{WithByteOrder(binary.BigEndian), WithFieldOffsets()},
+	} {
+		fixed := s.write(opts...)
+		compact := s.write(append(opts, WithVarints())...)
+		s.Assert().NotEqual(fixed, compact)
+
+		// Readers detect the encoding from the header.
+		r := NewReader()
+		br := bufio.NewReader(VerifyStream(bytes.NewReader(compact)))
+		for _, expected := range varintData {
+			var actual varintPkg
+			err := r.ReadObject(br, &actual)
+			s.Require().Nil(err)
+			s.Assert().Equal(expected, actual)
+		}
+		s.Assert().Contains(r.Header().Features(), "varints")
+
+		ra := bytes.NewReader(compact)
+		obj, err := OpenObject(ra)
+		s.Require().Nil(err)
+		counts, err := ReadFieldAt(ra, obj, "counts")
+		s.Require().Nil(err)
+		s.Assert().Equal([]any{int64(0), int64(-1), int64(1 << 62), int64(300)}, counts)
+		updated, err := ReadFieldAt(ra, obj, "updated")
+		s.Require().Nil(err)
+		s.Assert().Equal(varintData[0].Updated, updated)
+		el, err := ElementAt(ra, obj, "versions", "2.0")
+		s.Require().Nil(err)
+		release, err := el.Read()
+		s.Require().Nil(err)
+		s.Assert().Equal(int64(30), release["size"])
+		pkgs, err := ReadSegmentAt(ra, obj, "packages", "a")
+		s.Require().Nil(err)
+		s.Assert().Equal([]any{map[string]any{"tenant": "a", "id": int64(2), "name": "ggplot2"}}, pkgs)
+		big, err := Select(ra, obj, "versions", Field("size").Gt(10))
+		s.Require().Nil(err)
+		s.Assert().Len(big, 2)
+		obj, err = NextObject(ra, obj)
+		s.Require().Nil(err)
+		name, err := ReadFieldAt(ra, obj, "name")
+		s.Require().Nil(err)
+		s.Assert().Equal("rlang", name)
+	}
+}
+
+func (s *VarintsSuite) TestCompositeKeys() {
+	ra := bytes.NewReader(s.write(WithVarints()))
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+
+	// Keys are written in fixed-size slots.
+	s.Assert().Equal(10+sizeInt64, obj.Index[8].IndexSize)
+	releases, err := ReadFieldAt(ra, obj, "releases")
+	s.Require().Nil(err)
+	s.Assert().Equal(int64(-200), releases.([]any)[1].(map[string]any)["version"])
+	s.Assert().Equal(int64(1<<40), releases.([]any)[1].(map[string]any)["expires"])
+}
+
+func (s *VarintsSuite) TestEncoding() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithVarints())
+	_, err := w.WriteObject(struct {
+		Name  string `rsf:"name"`
+		Count int64  `rsf:"count"`
+	}{Name: "abc", Count: -2})
+	s.Require().Nil(err)
+
+	// Lengths are uvarints, and integers are zig-zag varints.
+	obj, err := OpenObject(bytes.NewReader(buf.Bytes()))
+	s.Require().Nil(err)
+	s.Assert().Equal(uint32(FlagVarints), obj.Flags)
+	s.Assert().Equal([]byte{3, 'a', 'b', 'c', 3}, buf.Bytes()[len(buf.Bytes())-5:])
+
+	// Small records are smaller than with fixed-size encoding.
+	s.Assert().Less(len(s.write(WithVarints())), len(s.write()))
+
+	// Varints require Version3 or later.
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version2, WithVarints()).WriteObject(channelObject{})
+	s.Assert().ErrorContains(err, "header flags require version 3")
+}
+
+func (s *VarintsSuite) TestPrint() {
+	out := &bytes.Buffer{}
+	err := Print(out, bufio.NewReader(bytes.NewReader(s.write(WithVarints()))))
+	s.Require().Nil(err)
+	s.Assert().Contains(out.String(), "downloads (int): -1099511627776")
+	s.Assert().Contains(out.String(), "notes (string): first")
+}
+
+func (s *VarintsSuite) TestPrintZeroIntKey() {
+	type item struct {
+		ID   int64  `rsf:"id,skip"`
+		Name string `rsf:"name"`
+	}
+	type object struct {
+		Items []item `rsf:"items,index:id"`
+	}
+	for _, version := range []int{Version2, Version3} {
+		buf := &bytes.Buffer{}
+		_, err := NewWriterWithVersion(buf, version).WriteObject(object{Items: []item{{ID: 0, Name: "zero"}, {ID: 5, Name: "five"}}})
+		s.Require().Nil(err)
+
+		// Keys are read from fixed-size slots, so a zero key is not empty.
+		out := &bytes.Buffer{}
+		err = Print(out, bufio.NewReader(buf))
+		s.Require().Nil(err, "version %d", version)
+		s.Assert().Contains(out.String(), "    - 0\n", "version %d", version)
+		s.Assert().Contains(out.String(), "    - 5\n", "version %d", version)
+	}
+}
+
+func (s *VarintsSuite) TestRewrite() {
+	compact := s.write(WithVarints(), WithDigest())
+
+	// Redacted files keep the encoding.
+	dst := &bytes.Buffer{}
+	_, err := Redact(dst, bytes.NewReader(compact), []Redaction{{Field: "tags", Mode: RedactBlank}})
+	s.Require().Nil(err)
+	var actual varintPkg
+	r := NewReader()
+	err = r.ReadObject(bufio.NewReader(VerifyStream(dst)), &actual)
+	s.Require().Nil(err)
+	s.Assert().Contains(r.Header().Features(), "varints")
+	s.Assert().Empty(actual.Tags)
+	s.Assert().Equal(varintData[0].Counts, actual.Counts)
+	s.Assert().Equal(varintData[0].Packages, actual.Packages)
+
+	// Change feeds are not supported.
+	_, err = ChangeFeed(bytes.NewReader(compact), bytes.NewReader(compact), NewWriterWithVersion(&bytes.Buffer{}, Version3))
+	s.Assert().ErrorIs(err, ErrUnsupportedFeature{Flags: FlagVarints})
+}
@@ -0,0 +1,272 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrNotFixedLayout is returned by `NewFixedView` when the elements of an
+// array include fields whose size varies, such as variable-length strings.
+var ErrNotFixedLayout = errors.New("elements do not have a fixed layout")
+
+// FixedView provides read-only random access to the elements of a top-level
+// indexed struct array whose elements contain only fixed-width fields, such as
+// numeric-heavy tables. Since every element has the same size, the position of
+// each field is computed from the element position, and the accessors of a
+// `FixedField` read values directly from the file data without decoding the
+// element.
+//
+//	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+//	view, err := NewFixedView(data, obj, "releases")
+//	downloads, err := view.Field("downloads")
+//	for i := 0; i < view.Len(); i++ {
+//		total += downloads.Int(i)
+//	}
+//
+// The view never modifies the data, so it can be used with read-only memory
+// mappings, and it is safe for concurrent use. The data must not change while
+// the view is in use.
+type FixedView struct {
+	data   []byte
+	order  binary.ByteOrder
+	field  string
+	keys   []any
+	start  int
+	elSize int
+	fields map[string]FixedField
+
+	// The written position of each element, when the elements are
+	// ordered by key. See `WithElementOrder`.
+	positions []int
+}
+
+// FixedField reads the values of a field of the elements of a `FixedView`.
+// Like `reflect.Value`, the accessors panic if called for a field of a
+// different type, or with an element position that is out of range.
+type FixedField struct {
+	// The field name and type. See `IndexEntry`.
+	Name      string
+	FieldType int
+
+	view *FixedView
+	off  int
+	size int
+
+	// True for times written as nanoseconds rather than fixed strings.
+	nanos bool
+}
+
+// NewFixedView creates a view of the top-level indexed struct array `field` of
+// the object `obj` in `data`, which holds the complete file, e.g., memory
+// mapped. The layout of the elements is read from the file index, and an error
+// wrapping `ErrNotFixedLayout` is returned if any field of the elements is not
+// fixed-width. Fixed-width fields are fixed strings, bools, integers, floats,
+// times, and expiry and deleted markers. Since signed integers and times are
+// varints with `WithVarints`, those fields are only fixed-width when the file
+// is written without it. Files written with `Chain` are not supported, since
+// the data must be decoded before it is read.
+//
+// The elements are in the order of `ElementHandles`, so they are in key order
+// when `obj` was opened using `WithElementOrder(OrderKey)`. Expired and deleted
+// elements are included in the view.
+func NewFixedView(data []byte, obj ObjectRef, field string) (*FixedView, error) {
+	if obj.Flags&FlagLayers != 0 {
+		return nil, fmt.Errorf("cannot view array %s in a file written with layers", field)
+	}
+	enc := flagsEncoding(obj.Flags)
+	handles, err := ElementHandles(bytes.NewReader(data), obj, field)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &FixedView{
+		data:   data,
+		order:  enc.byteOrder(),
+		field:  field,
+		keys:   make([]any, len(handles)),
+		fields: make(map[string]FixedField),
+	}
+	_, pos, err := entrySet(obj.Index, field)
+	if err != nil {
+		return nil, err
+	}
+	for _, subfield := range obj.Index[pos].Subfields {
+		sz, ok := fixedSize(subfield, enc)
+		if !ok {
+			return nil, fmt.Errorf("array %s field %s: %w", field, subfield.FieldName, ErrNotFixedLayout)
+		}
+		v.fields[subfield.FieldName] = FixedField{
+			Name:      subfield.FieldName,
+			FieldType: subfield.FieldType,
+			view:      v,
+			off:       v.elSize,
+			size:      sz,
+			nanos:     subfield.FieldType == FieldTypeTime && subfield.FieldSize == 0,
+		}
+		v.elSize += sz
+	}
+
+	for i, handle := range handles {
+		if handle.Size != v.elSize {
+			return nil, fmt.Errorf("array %s key %v: element size %d does not match layout size %d", field, handle.Key, handle.Size, v.elSize)
+		}
+		v.keys[i] = handle.Key
+	}
+	if len(handles) > 0 {
+		// The elements are stored in the order written, so the view
+		// starts at the first element written, which may not be the
+		// first handle when the elements are ordered by key.
+		v.start = int(handles[0].Offset)
+		for _, handle := range handles {
+			v.start = min(v.start, int(handle.Offset))
+		}
+		if obj.Order == OrderKey && v.elSize > 0 {
+			v.positions = make([]int, len(handles))
+			for i, handle := range handles {
+				v.positions[i] = (int(handle.Offset) - v.start) / v.elSize
+			}
+		}
+		if end := v.start + len(handles)*v.elSize; end > len(data) {
+			return nil, fmt.Errorf("array %s ends at position %d after the end of the data", field, end)
+		}
+	}
+	return v, nil
+}
+
+// fixedSize returns the size of the values of the field described by `entry`,
+// or false if the size varies.
+func fixedSize(entry IndexEntry, enc encoding) (int, bool) {
+	if entry.Optional {
+		return 0, false
+	}
+	switch entry.FieldType {
+	case FieldTypeFixedStr, FieldTypeInt:
+		return entry.FieldSize, true
+	case FieldTypeBool, FieldTypeDeleted:
+		return 1, true
+	case FieldTypeFloat, FieldTypeUint64:
+		return sizeFloat64, true
+	case FieldTypeFloat32:
+		return sizeFloat32, true
+	case FieldTypeInt64, FieldTypeExpiry:
+		return sizeInt64, !enc.varints
+	case FieldTypeTime:
+		if entry.FieldSize > 0 {
+			return entry.FieldSize, true
+		}
+		return sizeInt64, !enc.varints
+	default:
+		return 0, false
+	}
+}
+
+// Len returns the number of elements in the array.
+func (v *FixedView) Len() int {
+	return len(v.keys)
+}
+
+// Key returns the key of the element at position `i` from the array index.
+func (v *FixedView) Key(i int) any {
+	return v.keys[i]
+}
+
+// Field returns the accessors of the element field `name`. Index key fields
+// tagged with `skip` are not stored with the elements; use `Key` to read them.
+func (v *FixedView) Field(name string) (FixedField, error) {
+	f, ok := v.fields[name]
+	if !ok {
+		return FixedField{}, fmt.Errorf("array %s field %s not found in index", v.field, name)
+	}
+	return f, nil
+}
+
+// value returns the data of the field for the element at position `i`.
+func (f FixedField) value(i int, types ...int) []byte {
+	for _, t := range types {
+		if f.FieldType == t {
+			if i < 0 || i >= len(f.view.keys) {
+				panic(fmt.Sprintf("rsf: element position %d out of range for array of length %d", i, len(f.view.keys)))
+			}
+			if f.view.positions != nil {
+				i = f.view.positions[i]
+			}
+			start := f.view.start + i*f.view.elSize + f.off
+			return f.view.data[start : start+f.size : start+f.size]
+		}
+	}
+	panic(fmt.Sprintf("rsf: cannot read field %s of type %d", f.Name, f.FieldType))
+}
+
+// Int returns the value of a signed integer or expiry field.
+func (f FixedField) Int(i int) int64 {
+	bs := f.value(i, FieldTypeInt64, FieldTypeExpiry, FieldTypeInt)
+	if f.FieldType != FieldTypeInt {
+		val, _ := binary.Varint(bs)
+		return val
+	}
+	var val uint64
+	switch f.size {
+	case 1:
+		val = uint64(bs[0])
+	case 2:
+		val = uint64(f.view.order.Uint16(bs))
+	case 4:
+		val = uint64(f.view.order.Uint32(bs))
+	default:
+		val = f.view.order.Uint64(bs)
+	}
+	// Sign-extend values narrower than 64 bits
+	shift := 64 - 8*f.size
+	return int64(val<<shift) >> shift
+}
+
+// Uint returns the value of an unsigned integer field.
+func (f FixedField) Uint(i int) uint64 {
+	return f.view.order.Uint64(f.value(i, FieldTypeUint64))
+}
+
+// Float returns the value of a float64 or float32 field.
+func (f FixedField) Float(i int) float64 {
+	bs := f.value(i, FieldTypeFloat, FieldTypeFloat32)
+	if f.FieldType == FieldTypeFloat32 {
+		return float64(math.Float32frombits(f.view.order.Uint32(bs)))
+	}
+	return math.Float64frombits(f.view.order.Uint64(bs))
+}
+
+// Bool returns the value of a bool or deleted field.
+func (f FixedField) Bool(i int) bool {
+	return f.value(i, FieldTypeBool, FieldTypeDeleted)[0] == 1
+}
+
+// Bytes returns the value of a fixed string field. The returned slice refers
+// to the view data and must not be modified. Empty strings are returned as
+// zero bytes.
+func (f FixedField) Bytes(i int) []byte {
+	return f.value(i, FieldTypeFixedStr)
+}
+
+// String returns the value of a fixed string field.
+func (f FixedField) String(i int) string {
+	bs := f.Bytes(i)
+	if emptyFixed(bs) {
+		return ""
+	}
+	return string(bs)
+}
+
+// Time returns the value of a time field. An error is returned if the time is
+// not valid.
+func (f FixedField) Time(i int) (time.Time, error) {
+	bs := f.value(i, FieldTypeTime)
+	if f.nanos {
+		nanos, _ := binary.Varint(bs)
+		return decodeTime(nanos, "")
+	}
+	return decodeTime(0, string(bs))
+}
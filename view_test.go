@@ -0,0 +1,142 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ViewSuite struct {
+	suite.Suite
+}
+
+func TestViewSuite(t *testing.T) {
+	suite.Run(t, &ViewSuite{})
+}
+
+type viewStat struct {
+	ID        int64     `rsf:"id,skip"`
+	Version   string    `rsf:"version,fixed:3"`
+	Downloads int64     `rsf:"downloads"`
+	Stars     int32     `rsf:"stars,int32"`
+	Size      uint64    `rsf:"size"`
+	Rating    float64   `rsf:"rating"`
+	Score     float32   `rsf:"score"`
+	Current   bool      `rsf:"current"`
+	Updated   time.Time `rsf:"updated"`
+}
+
+type viewTable struct {
+	Name  string     `rsf:"name"`
+	Stats []viewStat `rsf:"stats,index:id"`
+	Tags  []viewTag  `rsf:"tags,index:id"`
+}
+
+type viewTag struct {
+	ID   int64  `rsf:"id,skip"`
+	Name string `rsf:"name"`
+}
+
+var viewData = viewTable{
+	Name: "ggplot2",
+	Stats: []viewStat{
+		{ID: 7, Version: "1.0", Downloads: -1 << 40, Stars: -3, Size: 1 << 63, Rating: 4.5, Score: 0.25, Updated: time.Date(2023, 4, 5, 6, 7, 8, 9, time.UTC)},
+		{ID: 3, Version: "2.0", Downloads: 12, Stars: 1 << 20, Size: 5, Rating: -1, Current: true},
+	},
+	Tags: []viewTag{{ID: 1, Name: "graphics"}},
+}
+
+func (s *ViewSuite) write(opts ...WriterOption) ([]byte, ObjectRef) {
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version3, opts...).WriteObject(viewData)
+	s.Require().Nil(err)
+	obj, err := OpenObject(bytes.NewReader(buf.Bytes()))
+	s.Require().Nil(err)
+	return buf.Bytes(), obj
+}
+
+func (s *ViewSuite) TestFixedView() {
+	for _, opts := range [][]WriterOption{
+		nil,
+		{WithByteOrder(binary.BigEndian), WithFieldHashes(), WithElementHashes()},
+	} {
+		data, obj := s.write(opts...)
+		view, err := NewFixedView(data, obj, "stats")
+		s.Require().Nil(err)
+		s.Require().Equal(2, view.Len())
+
+		field := func(name string) FixedField {
+			f, err := view.Field(name)
+			s.Require().Nil(err)
+			return f
+		}
+		for i, expected := range viewData.Stats {
+			s.Assert().Equal(expected.ID, view.Key(i))
+			s.Assert().Equal(expected.Version, field("version").String(i))
+			s.Assert().Equal([]byte(expected.Version), field("version").Bytes(i))
+			s.Assert().Equal(expected.Downloads, field("downloads").Int(i))
+			s.Assert().Equal(int64(expected.Stars), field("stars").Int(i))
+			s.Assert().Equal(expected.Size, field("size").Uint(i))
+			s.Assert().Equal(expected.Rating, field("rating").Float(i))
+			s.Assert().Equal(float64(expected.Score), field("score").Float(i))
+			s.Assert().Equal(expected.Current, field("current").Bool(i))
+			updated, err := field("updated").Time(i)
+			s.Require().Nil(err)
+			s.Assert().True(expected.Updated.Equal(updated))
+		}
+
+		// Accessors panic for other types and out of range elements
+		s.Assert().Panics(func() { field("rating").Int(0) })
+		s.Assert().Panics(func() { field("rating").Float(2) })
+		_, err = view.Field("id")
+		s.Assert().EqualError(err, "array stats field id not found in index")
+	}
+}
+
+func (s *ViewSuite) TestOrderKey() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(viewData)
+	s.Require().Nil(err)
+	_, err = w.WriteObject(viewTable{Name: "dplyr"})
+	s.Require().Nil(err)
+	obj, err := OpenObject(bytes.NewReader(buf.Bytes()), WithElementOrder(OrderKey))
+	s.Require().Nil(err)
+
+	// The elements are viewed in key order, like the handles.
+	view, err := NewFixedView(buf.Bytes(), obj, "stats")
+	s.Require().Nil(err)
+	s.Require().Equal(2, view.Len())
+	downloads, err := view.Field("downloads")
+	s.Require().Nil(err)
+	version, err := view.Field("version")
+	s.Require().Nil(err)
+	for i, expected := range []viewStat{viewData.Stats[1], viewData.Stats[0]} {
+		s.Assert().Equal(expected.ID, view.Key(i))
+		s.Assert().Equal(expected.Downloads, downloads.Int(i))
+		s.Assert().Equal(expected.Version, version.String(i))
+	}
+}
+
+func (s *ViewSuite) TestErrors() {
+	data, obj := s.write()
+	_, err := NewFixedView(data, obj, "tags")
+	s.Assert().ErrorIs(err, ErrNotFixedLayout)
+	_, err = NewFixedView(data, obj, "name")
+	s.Assert().EqualError(err, "field name is not an indexed struct array")
+	_, err = NewFixedView(data[:len(data)-40], obj, "stats")
+	s.Assert().NotNil(err)
+
+	// Signed integers are varints
+	data, obj = s.write(WithVarints())
+	_, err = NewFixedView(data, obj, "stats")
+	s.Assert().ErrorIs(err, ErrNotFixedLayout)
+
+	data, obj = s.write(WithChecksums())
+	_, err = NewFixedView(data, obj, "stats")
+	s.Assert().EqualError(err, "cannot view array stats in a file written with layers")
+}
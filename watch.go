@@ -0,0 +1,146 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// WatchOption configures optional `SnapshotStore.Watch` behavior.
+type WatchOption func(*watcher)
+
+// OnReload calls `fn` with the path of the file each time the store is
+// reloaded by `Watch`.
+func OnReload(fn func(path string)) WatchOption {
+	return func(w *watcher) {
+		w.onReload = fn
+	}
+}
+
+// OnReloadError calls `fn` with the error each time `Watch` fails to check or
+// reload the file.
+func OnReloadError(fn func(path string, err error)) WatchOption {
+	return func(w *watcher) {
+		w.onError = fn
+	}
+}
+
+type watcher struct {
+	onReload func(path string)
+	onError  func(path string, err error)
+
+	// The file and trailer digest that were last checked.
+	info   os.FileInfo
+	digest []byte
+}
+
+// Watch polls the file at `path` every `interval` and reloads the store with
+// `Reload` when the file is replaced, e.g., by a nightly snapshot. A file is
+// considered replaced when it is a different file (e.g., a different inode)
+// than the file last loaded or checked, or its size or modification time
+// changes, unless the digest in its trailer (see `WithDigest`) is unchanged. A
+// file that fails to reload is not retried until it changes again. Watch blocks
+// until `ctx` is done and returns the context's error, so it is usually run in
+// its own goroutine:
+//
+//	go store.Watch(ctx, path, time.Minute, rsf.OnReloadError(logError))
+func (s *SnapshotStore) Watch(ctx context.Context, path string, interval time.Duration, opts ...WatchOption) error {
+	w := &watcher{}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	// Start with the file used by the store, if it was opened from a path.
+	st := s.acquire()
+	w.info, w.digest = st.info, st.digest
+	st.readers.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			s.check(w, path)
+		}
+	}
+}
+
+// check reloads the store if the file at `path` has changed.
+func (s *SnapshotStore) check(w *watcher, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		w.fail(path, err)
+		return
+	}
+	if w.info != nil && os.SameFile(w.info, info) && w.info.Size() == info.Size() && w.info.ModTime().Equal(info.ModTime()) {
+		return
+	}
+
+	digest, err := fileDigestAt(path)
+	if err != nil {
+		w.fail(path, err)
+		return
+	}
+	w.info = info
+	if digest != nil && bytes.Equal(digest, w.digest) {
+		return
+	}
+	w.digest = digest
+
+	err = s.Reload(path)
+	if err != nil {
+		w.fail(path, err)
+		return
+	}
+	if w.onReload != nil {
+		w.onReload(path)
+	}
+}
+
+func (w *watcher) fail(path string, err error) {
+	if w.onError != nil {
+		w.onError(path, err)
+	}
+}
+
+// fileDigestAt returns the digest in the trailer of the file at `path`, or nil
+// if the file has no trailer.
+func fileDigestAt(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileDigest(f, info.Size())
+}
+
+// fileDigest returns the digest in the trailer of `ra`, which is `sz` bytes
+// long, or nil if there is no trailer.
+func fileDigest(ra io.ReaderAt, sz int64) ([]byte, error) {
+	n := sz
+	if n > maxTrailerLen {
+		n = maxTrailerLen
+	}
+	bs := make([]byte, n)
+	_, err := ra.ReadAt(bs, sz-n)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, digest, err := parseTrailer(bs)
+	if errors.Is(err, ErrNoTrailer) {
+		return nil, nil
+	}
+	return digest, err
+}
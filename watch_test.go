@@ -0,0 +1,88 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WatchSuite struct {
+	suite.Suite
+}
+
+func TestWatchSuite(t *testing.T) {
+	suite.Run(t, &WatchSuite{})
+}
+
+// replaceFile atomically replaces the file at `path` with a new file.
+func (s *WatchSuite) replaceFile(path string, pkgs []storePkg, opts ...WriterOption) {
+	tmp := path + ".tmp"
+	writeStoreFile(&s.Suite, tmp, pkgs, opts...)
+	s.Require().Nil(os.Rename(tmp, path))
+}
+
+func (s *WatchSuite) TestWatch() {
+	path := filepath.Join(s.T().TempDir(), "snapshot.rsf")
+	writeStoreFile(&s.Suite, path, storePkgs, WithDigest())
+	store, err := OpenSnapshotStore(path, "name")
+	s.Require().Nil(err)
+	defer store.Close()
+
+	reloads := make(chan string, 10)
+	errs := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- store.Watch(ctx, path, time.Millisecond,
+			OnReload(func(path string) { reloads <- path }),
+			OnReloadError(func(path string, err error) { errs <- err }),
+		)
+	}()
+
+	// A replaced file is reloaded
+	s.replaceFile(path, storePkgs[:1], WithDigest())
+	s.Assert().Equal(path, <-reloads)
+	s.Assert().Equal(1, store.Len())
+
+	// A file with the same digest is not reloaded
+	s.replaceFile(path, storePkgs[:1], WithDigest())
+
+	// An invalid file is reported, and the store continues to use the
+	// previous file
+	s.replaceFile(path, append(storePkgs, storePkgs[0]))
+	s.Assert().ErrorContains(<-errs, "duplicate key plyr")
+	s.Assert().Equal(1, store.Len())
+
+	// Files without digests are reloaded
+	s.replaceFile(path, storePkgs)
+	s.Assert().Equal(path, <-reloads)
+	s.Assert().Equal(3, store.Len())
+
+	cancel()
+	s.Assert().ErrorIs(<-done, context.Canceled)
+	s.Assert().Empty(reloads)
+	s.Assert().Empty(errs)
+}
+
+func (s *WatchSuite) TestFileDigest() {
+	dir := s.T().TempDir()
+	path := filepath.Join(dir, "digest.rsf")
+	writeStoreFile(&s.Suite, path, storePkgs, WithDigest())
+	digest, err := fileDigestAt(path)
+	s.Assert().Nil(err)
+	s.Assert().Len(digest, 32)
+
+	path = filepath.Join(dir, "none.rsf")
+	writeStoreFile(&s.Suite, path, storePkgs)
+	digest, err = fileDigestAt(path)
+	s.Assert().Nil(err)
+	s.Assert().Nil(digest)
+
+	_, err = fileDigestAt(filepath.Join(dir, "missing.rsf"))
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+}
@@ -2,10 +2,12 @@
 package rsf
 
 import (
-	"encoding/binary"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
 	"math"
+	"reflect"
 )
 
 // IndexVersion2 is the first recorded index version. It consists of:
@@ -14,35 +16,422 @@ import (
 //   - ASCII character "2".
 var IndexVersion2 = []byte{0x00, 0x08, 0x32}
 
+// IndexVersion3 adds a file header between the index version and the index.
+// See `writeHeader`.
+var IndexVersion3 = []byte{0x00, 0x08, 0x33}
+
 var (
 	Version1 = 1
 	Version2 = 2
+	Version3 = 3
 )
 
+// Header flags declare optional file-level features, such as layers or the
+// encoding of fields, so that readers can detect unsupported features before
+// reading any objects. Field types added by a format version are not flagged,
+// since readers that support the minimum reader version in the header
+// support all of its field types. Flags are only written by Version3 and
+// later.
+const (
+	// FlagFieldOffsets indicates that each top-level object is prefixed with a
+	// table of field offsets. See `WithFieldOffsets`.
+	FlagFieldOffsets uint32 = 1 << iota
+
+	// FlagFieldHashes indicates that the field offset tables also include a
+	// hash of each field name. See `WithFieldHashes`.
+	FlagFieldHashes
+
+	// FlagCompression indicates that object data is compressed. This is set
+	// automatically when the layer chain includes `Zstd`.
+	FlagCompression
+
+	// FlagChecksums indicates that objects include checksums. This is set
+	// automatically when the layer chain includes `Checksum`.
+	FlagChecksums
+
+	// FlagStringTable indicates that repeated strings are stored in a shared
+	// string table. Reserved.
+	FlagStringTable
+
+	// FlagDigest indicates that the file ends with a trailer that includes a
+	// digest of the file. See `WithDigest`.
+	FlagDigest
+
+	// FlagLayers indicates that the payload of each top-level object is
+	// encoded by the layers listed in the file header. See `Chain`.
+	FlagLayers
+
+	// FlagElementHashes indicates that each index entry of an indexed array
+	// includes a hash of the element. See `WithElementHashes`.
+	FlagElementHashes
+
+	// FlagKeyID indicates that the file header records the ID of the key
+	// used to encrypt each object. See `AESGCMWithKeyID`.
+	FlagKeyID
+
+	// FlagRecipients indicates that the file header records the content key
+	// of each object encrypted to one or more recipients. See `X25519`.
+	FlagRecipients
+
+	// FlagParent indicates that the file header records the location and
+	// digest of the parent snapshot. See `WithParent`.
+	FlagParent
+
+	// FlagObjectTable indicates that `Finalize` writes a table of the offset
+	// and size of each top-level object. See `WithObjectTable`.
+	FlagObjectTable
+
+	// FlagBigEndian indicates that fields following the file header are
+	// encoded in big-endian byte order. See `WithByteOrder`.
+	FlagBigEndian
+
+	// FlagVarints indicates that integers and the lengths of strings and
+	// byte slices are encoded as compact varints. See `WithVarints`.
+	FlagVarints
+
+	// FlagTrailer indicates that `Finalize` writes a trailer that marks the
+	// file as complete, even without a digest. See `WithCompletionMarker`.
+	FlagTrailer
+)
+
+// flagNames maps each flag to the feature name reported by `Header.Features`.
+var flagNames = []struct {
+	flag uint32
+	name string
+}{
+	{FlagFieldOffsets, "field-offsets"},
+	{FlagFieldHashes, "field-hashes"},
+	{FlagCompression, "compression"},
+	{FlagChecksums, "checksums"},
+	{FlagStringTable, "string-table"},
+	{FlagDigest, "digest"},
+	{FlagLayers, "layers"},
+	{FlagElementHashes, "element-hashes"},
+	{FlagKeyID, "key-id"},
+	{FlagRecipients, "recipients"},
+	{FlagParent, "parent"},
+	{FlagObjectTable, "object-table"},
+	{FlagBigEndian, "big-endian"},
+	{FlagVarints, "varints"},
+	{FlagTrailer, "trailer"},
+}
+
 type rsfWriter struct {
 	writer  io.Writer
 	version int
 	pos     int
+	flags   uint32
+
+	// The minimum reader version requested with `WithMinReaderVersion`.
+	minVersion int
+
+	// Hashes all written data when using `WithDigest`.
+	digest hash.Hash
+
+	// Set once `Finalize` is called.
+	finalized bool
+
+	// Set while an array started with `BeginArray` is open.
+	openArray bool
+
+	// The flags recorded in the file header, if a header was written.
+	headerFlags uint32
+
+	// Layers applied to each top-level object payload, and the ID of the
+	// encryption key, if recorded. See `Chain`.
+	layers []Layer
+	keyID  string
+
+	// When true, equal inputs are encoded as identical bytes. See
+	// `WithCanonical`.
+	canonical bool
+
+	// Determines how NaN and infinite floats are written. See
+	// `WithFloatPolicy`.
+	floatPolicy FloatPolicy
+
+	// Additional destinations for all written data. See `WithTee`.
+	tees []io.Writer
+
+	// When set, array elements that expire at or before this time, in Unix
+	// seconds, are dropped. See `WithDropExpired`.
+	dropExpired int64
+
+	// The maximum array element size, and an optional callback for
+	// oversized elements. See `WithMaxElementSize`.
+	maxElementSize int
+	onOversize     func(ErrElementTooLarge)
+
+	// The maximum output size, and an optional callback for array elements
+	// dropped to fit. See `WithMaxSize`.
+	maxSize      int
+	onOverBudget func(ErrSizeBudgetExceeded)
+
+	// Counts all written data when using `WithMaxSize` or
+	// `WithObjectTable`.
+	counter *CountingWriter
+
+	// The position and size of each top-level object. See
+	// `WithObjectTable`.
+	objects []objectTableEntry
+
+	// Tracks array elements while fitting an object to the size budget.
+	budget *budgetState
+
+	// Orders the elements of top-level arrays by name. See `WithPriority`.
+	priorities map[string]func(a, b any) bool
+
+	// The nesting depth of the array being written.
+	arrayDepth int
+
+	// The parent snapshot recorded in the file header. See `WithParent`.
+	parent Parent
+
+	// The index tag of the array written with the file index by
+	// `WriteArrayFromChannel` or `BeginArray`, which later arrays must match.
+	channelIndex *tag
+
+	// The parsed struct tags of each struct type written by
+	// `WriteObjects`.
+	tagCache map[reflect.Type][]parsedTag
+
+	// The encoding of fields following the file header. See
+	// `WithByteOrder` and `WithVarints`.
+	enc encoding
 }
 
-func NewWriter(f io.Writer) Writer {
-	return &rsfWriter{
-		writer:  f,
-		version: Version1,
+// WriterOption configures optional writer behavior.
+type WriterOption func(*rsfWriter)
+
+// WithFieldOffsets prefixes each top-level struct object with a table that
+// maps each field to its offset within the object. This allows readers to
+// jump directly to a field without decoding the preceding fields. Requires
+// Version3 or later.
+func WithFieldOffsets() WriterOption {
+	return func(f *rsfWriter) {
+		f.flags |= FlagFieldOffsets
+	}
+}
+
+// WithMinReaderVersion records a minimum reader version in the file header.
+// Readers that support an older version fail when reading the index. This is
+// useful when a file's data changes in ways that older readers would misread.
+// Requires Version3 or later.
+func WithMinReaderVersion(version int) WriterOption {
+	return func(f *rsfWriter) {
+		f.minVersion = version
+	}
+}
+
+// WithDigest computes a SHA-256 digest of all written data. The digest is
+// written in a trailer by `Finalize`, and can be verified while streaming with
+// `VerifyStream`, or before reading a file with `VerifyFile`. Requires
+// Version3 or later.
+func WithDigest() WriterOption {
+	return func(f *rsfWriter) {
+		f.flags |= FlagDigest
+		f.digest = sha256.New()
+	}
+}
+
+// WithCompletionMarker causes `Finalize` to write a file trailer without a
+// digest, which marks the file as complete. Readers can then distinguish a
+// complete file from one whose writer stopped before finishing, e.g., a file
+// that objects are appended to: `CheckComplete`, and the Reader when using
+// `WithRequireComplete`, return `ErrIncomplete` when the trailer is missing.
+// `WithDigest` also writes a trailer, so this option is only needed without a
+// digest. Requires Version3 or later.
+func WithCompletionMarker() WriterOption {
+	return func(f *rsfWriter) {
+		f.flags |= FlagTrailer
+	}
+}
+
+// WithFieldHashes includes a hash of each field name in the field offset
+// tables written by `WithFieldOffsets`, which is implied. This allows readers
+// to locate top-level fields by name rather than by position, so reordering
+// fields in a struct does not break readers. Requires Version3 or later.
+func WithFieldHashes() WriterOption {
+	return func(f *rsfWriter) {
+		f.flags |= FlagFieldOffsets | FlagFieldHashes
 	}
 }
 
-func NewWriterWithVersion(f io.Writer, version int) Writer {
-	return &rsfWriter{
+// Chain applies layers to the payload of each top-level object, in the order
+// given. The layers are recorded in the file header so that readers can
+// decode each object in reverse order. For example, to checksum, compress, and
+// then encrypt each object:
+//
+//	NewWriterWithVersion(f, Version3, Chain(Checksum(), Zstd(), AESGCM(key)))
+//
+// The key ID of an encryption layer created with `AESGCMWithKeyID`, and the
+// recipients of an `X25519` layer, are also recorded in the file header.
+// Requires Version3 or later.
+func Chain(layers ...Layer) WriterOption {
+	return func(f *rsfWriter) {
+		if len(layers) > 0 {
+			f.flags |= FlagLayers
+		}
+		for _, l := range layers {
+			switch l.ID() {
+			case LayerZstd:
+				f.flags |= FlagCompression
+			case LayerChecksum:
+				f.flags |= FlagChecksums
+			}
+			if k, ok := l.(keyedLayer); ok && k.KeyID() != "" {
+				f.flags |= FlagKeyID
+				f.keyID = k.KeyID()
+			}
+			if _, ok := l.(recipientLayer); ok {
+				f.flags |= FlagRecipients
+			}
+		}
+		f.layers = append(f.layers, layers...)
+	}
+}
+
+// WithTee writes all data to `w` in addition to the writer's destination,
+// e.g., to publish and archive a file in one pass. Every destination receives
+// identical bytes, and the sizes returned by the writer apply to each
+// destination. Writing stops with an error as soon as any destination fails
+// or accepts a short write, so destinations may be left with different
+// amounts of incomplete data after an error.
+func WithTee(w io.Writer) WriterOption {
+	return func(f *rsfWriter) {
+		f.tees = append(f.tees, w)
+	}
+}
+
+// WithMaxElementSize limits the encoded size of each array element to `n`
+// bytes. By default, writing an object fails with an `ErrElementTooLarge` error
+// if an element exceeds the limit. When `onOversize` is not nil, oversized
+// elements are instead dropped from the array and passed to `onOversize`.
+func WithMaxElementSize(n int, onOversize func(ErrElementTooLarge)) WriterOption {
+	return func(f *rsfWriter) {
+		f.maxElementSize = n
+		f.onOversize = onOversize
+	}
+}
+
+// WithMaxSize limits the total output size to `n` bytes, including the trailer
+// written by `Finalize`. Each record is checked before it is written, so by
+// default, writing fails with an `ErrSizeBudgetExceeded` error and the output
+// ends with the last record that fit. When `onOverBudget` is not nil, trailing
+// array elements are instead dropped from an object that does not fit, and
+// passed to `onOverBudget`. See `trimObject`.
+func WithMaxSize(n int, onOverBudget func(ErrSizeBudgetExceeded)) WriterOption {
+	return func(f *rsfWriter) {
+		f.maxSize = n
+		f.onOverBudget = onOverBudget
+	}
+}
+
+// WithPriority writes the elements of the top-level array `array` in priority
+// order, where `less` reports whether the element `a` has a higher priority
+// than `b` and should be written first. Elements with equal priority keep
+// their order. When elements are dropped to fit the size budget set with
+// `WithMaxSize`, the lowest-priority elements are dropped first. The element
+// positions reported to `WithMaxSize` and `WithMaxElementSize` callbacks are
+// positions in priority order. Arrays written with `WriteArrayFromChannel` are
+// not reordered.
+func WithPriority(array string, less func(a, b any) bool) WriterOption {
+	return func(f *rsfWriter) {
+		if f.priorities == nil {
+			f.priorities = make(map[string]func(a, b any) bool)
+		}
+		f.priorities[array] = less
+	}
+}
+
+// WithElementHashes includes a hash of each element in the index of each
+// indexed array, following the element size. This allows changed elements to
+// be detected by comparing array indexes without reading the elements. See
+// `ElementHashes`. Requires Version3 or later.
+func WithElementHashes() WriterOption {
+	return func(f *rsfWriter) {
+		f.flags |= FlagElementHashes
+	}
+}
+
+// WithVersion sets the format version written, such as `Version3`. The
+// default is `Version1`. Options that require a later version, such as
+// `WithFieldOffsets`, must be combined with this option or
+// `NewWriterWithVersion`.
+func WithVersion(version int) WriterOption {
+	return func(f *rsfWriter) {
+		f.version = version
+	}
+}
+
+// WithChecksums appends a CRC-32 checksum to the payload of each top-level
+// object, like `Chain(Checksum())`, so that readers detect corrupted objects
+// with `ErrChecksumMismatch` unless verification is skipped with
+// `WithoutChecksumVerification`. Since layers are applied in the order given,
+// pass it before any layers added with `Chain` to checksum the original
+// payload. Requires Version3 or later.
+func WithChecksums() WriterOption {
+	return Chain(Checksum())
+}
+
+// WithCompression compresses the payload of each top-level object
+// independently with the layer `c`, such as `Zstd()`, like `Chain(c)`. Since
+// each object is compressed separately, objects can still be located with
+// their sizes and the object table, and readers decompress each object
+// transparently. Requires Version3 or later.
+//
+//	NewWriterWithVersion(f, Version3, WithCompression(Zstd()))
+func WithCompression(c Layer) WriterOption {
+	return Chain(c)
+}
+
+// WithEncryption encrypts the payload of each top-level object with AES-GCM
+// under `key`, which must be 16, 24, or 32 bytes, like `Chain(AESGCM(key))`.
+// Each payload is stored with its random nonce and authentication tag, so
+// tampering is detected when the object is decrypted. Files are read with
+// `WithDecryptionKey` or `WithKeyProvider`. Layers are applied in the order of
+// the options, so compress before encrypting. Requires Version3 or later.
+//
+//	NewWriterWithVersion(f, Version3, WithCompression(Zstd()), WithEncryption(key))
+func WithEncryption(key []byte) WriterOption {
+	return Chain(AESGCM(key))
+}
+
+// NewWriter returns a writer to `f` configured with `opts`, e.g.,
+//
+//	NewWriter(f, WithVersion(Version3), WithChecksums(), WithDigest())
+func NewWriter(f io.Writer, opts ...WriterOption) Writer {
+	return NewWriterWithVersion(f, Version1, opts...)
+}
+
+// NewWriterWithVersion is like `NewWriter` with `WithVersion(version)` applied
+// before `opts`.
+func NewWriterWithVersion(f io.Writer, version int, opts ...WriterOption) Writer {
+	w := &rsfWriter{
 		writer:  f,
 		version: version,
 	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.tees != nil || w.digest != nil {
+		writers := append([]io.Writer{f}, w.tees...)
+		if w.digest != nil {
+			writers = append(writers, w.digest)
+		}
+		w.writer = io.MultiWriter(writers...)
+	}
+	if w.maxSize > 0 || w.flags&FlagObjectTable != 0 {
+		w.counter = NewCountingWriter(w.writer)
+		w.writer = w.counter
+	}
+	return w
 }
 
 func (f *rsfWriter) WriteSizeField(pos int, val int, r io.Writer) (int, error) {
 	// Write size
 	bs := make([]byte, sizeFieldLen)
-	binary.LittleEndian.PutUint32(bs, uint32(val))
+	f.byteOrder().PutUint32(bs, uint32(val))
 	sz, err := r.Write(bs)
 	if err != nil {
 		return 0, err
@@ -53,8 +442,18 @@ func (f *rsfWriter) WriteSizeField(pos int, val int, r io.Writer) (int, error) {
 
 func (f *rsfWriter) WriteInt64Field(pos int, val int64, r io.Writer) (int, error) {
 	// Write int
-	bs := make([]byte, sizeInt64)
-	binary.PutVarint(bs, val)
+	sz, err := f.writeVarint(val, r)
+	if err != nil {
+		return 0, err
+	}
+
+	return pos + sz, nil
+}
+
+func (f *rsfWriter) WriteUint64Field(pos int, val uint64, r io.Writer) (int, error) {
+	// Write uint
+	bs := make([]byte, sizeUint64)
+	f.byteOrder().PutUint64(bs, val)
 	sz, err := r.Write(bs)
 	if err != nil {
 		return 0, err
@@ -64,9 +463,17 @@ func (f *rsfWriter) WriteInt64Field(pos int, val int64, r io.Writer) (int, error
 }
 
 func (f *rsfWriter) WriteFloatField(pos int, val float64, r io.Writer) (int, error) {
+	val, err := f.applyFloatPolicy(val)
+	if err != nil {
+		return 0, err
+	}
+	if f.canonical {
+		val = canonicalFloat(val)
+	}
+
 	// Write float
 	bs := make([]byte, sizeFloat64)
-	binary.LittleEndian.PutUint64(bs, math.Float64bits(val))
+	f.byteOrder().PutUint64(bs, math.Float64bits(val))
 	sz, err := r.Write(bs)
 	if err != nil {
 		return 0, err
@@ -76,12 +483,16 @@ func (f *rsfWriter) WriteFloatField(pos int, val float64, r io.Writer) (int, err
 }
 
 func (f *rsfWriter) WriteFixedStringField(pos, sz int, val string, r io.Writer) (int, error) {
-	if sz != len(val) {
+	bs := []byte(val)
+	if val == "" {
+		// Empty strings are written as zero bytes. See `emptyFixed`.
+		bs = make([]byte, sz)
+	} else if sz != len(val) {
 		return 0, fmt.Errorf("size %d does not match expected size %d", len(val), sz)
 	}
 
 	// Write value
-	i, err := r.Write([]byte(val))
+	i, err := r.Write(bs)
 	if err != nil {
 		return 0, err
 	}
@@ -94,9 +505,7 @@ func (f *rsfWriter) WriteFixedStringField(pos, sz int, val string, r io.Writer)
 
 func (f *rsfWriter) WriteStringField(pos int, val string, r io.Writer) (int, error) {
 	// Write size
-	bs := make([]byte, sizeFieldLen)
-	binary.LittleEndian.PutUint32(bs, uint32(len(val)))
-	sz, err := r.Write(bs)
+	sz, err := f.writeLength(len(val), r)
 	if err != nil {
 		return 0, err
 	}
@@ -126,3 +535,38 @@ func (f *rsfWriter) WriteBoolField(pos int, val bool, r io.Writer) (int, error)
 
 	return pos + sz, nil
 }
+
+func (f *rsfWriter) WriteChunkedField(pos, chunkSz int, val io.Reader, r io.Writer) (int, error) {
+	if chunkSz <= 0 {
+		return 0, fmt.Errorf("invalid chunk size %d", chunkSz)
+	}
+
+	// Write each chunk prefixed with its size. A short final read is
+	// written as a smaller chunk. Other read errors are returned after
+	// writing the partial chunk.
+	bs := make([]byte, chunkSz)
+	for {
+		n, readErr := io.ReadFull(val, bs)
+		if n > 0 {
+			var err error
+			pos, err = f.WriteSizeField(pos, n, r)
+			if err != nil {
+				return 0, err
+			}
+			var i int
+			i, err = r.Write(bs[:n])
+			if err != nil {
+				return 0, err
+			}
+			pos += i
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		} else if readErr != nil {
+			return 0, readErr
+		}
+	}
+
+	// Write the zero-size terminator chunk
+	return f.WriteSizeField(pos, 0, r)
+}
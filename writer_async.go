@@ -0,0 +1,109 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrWriterClosed is returned when submitting objects to a closed
+// `AsyncWriter`.
+var ErrWriterClosed = errors.New("writer is closed")
+
+// AsyncWriter writes objects with `WriteObject` on a background goroutine.
+// Objects are submitted to a bounded queue, and `Submit` blocks while the queue
+// is full, so producers are slowed to the pace of the destination.
+//
+// An AsyncWriter is safe for concurrent use. Objects submitted concurrently are
+// written in an unspecified order.
+type AsyncWriter struct {
+	w     Writer
+	queue chan any
+	done  chan struct{}
+
+	// Guards closing the queue.
+	mu     sync.RWMutex
+	closed bool
+
+	// The first write error, which is returned by subsequent calls.
+	errMu sync.Mutex
+	err   error
+}
+
+// NewAsyncWriter creates an AsyncWriter that writes objects to `w` and queues
+// up to `queueSize` objects.
+func NewAsyncWriter(w Writer, queueSize int) *AsyncWriter {
+	a := &AsyncWriter{
+		w:     w,
+		queue: make(chan any, queueSize),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for v := range a.queue {
+		// Once writing fails, discard the remaining objects so that
+		// producers are not blocked.
+		if a.Err() != nil {
+			continue
+		}
+		_, err := a.w.WriteObject(v)
+		if err != nil {
+			a.setErr(err)
+		}
+	}
+}
+
+// Submit queues `v` to be written with `WriteObject`, blocking while the queue
+// is full. If a previous object failed to write, the error is returned and
+// `v` is not queued.
+func (a *AsyncWriter) Submit(v any) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrWriterClosed
+	}
+	if err := a.Err(); err != nil {
+		return err
+	}
+	a.queue <- v
+	return nil
+}
+
+// Close waits for the queued objects to be written and completes the file
+// with `Finalize`. The first error encountered while writing is returned.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return ErrWriterClosed
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	if err := a.Err(); err != nil {
+		return err
+	}
+	_, err := a.w.Finalize()
+	return err
+}
+
+// Err returns the first error encountered while writing, if any.
+func (a *AsyncWriter) Err() error {
+	a.errMu.Lock()
+	defer a.errMu.Unlock()
+	return a.err
+}
+
+func (a *AsyncWriter) setErr(err error) {
+	a.errMu.Lock()
+	defer a.errMu.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterAsyncSuite struct {
+	suite.Suite
+}
+
+func TestWriterAsyncSuite(t *testing.T) {
+	suite.Run(t, &WriterAsyncSuite{})
+}
+
+// gatedWriter blocks each write until `gate` is closed.
+type gatedWriter struct {
+	buf  bytes.Buffer
+	gate chan struct{}
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	return g.buf.Write(p)
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+var errWriteFailed = errors.New("write failed")
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func (s *WriterAsyncSuite) TestSubmit() {
+	expected := &bytes.Buffer{}
+	w := NewWriterWithVersion(expected, Version3, WithDigest())
+	for _, pkg := range storePkgs {
+		_, err := w.WriteObject(pkg)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+
+	buf := &bytes.Buffer{}
+	a := NewAsyncWriter(NewWriterWithVersion(buf, Version3, WithDigest()), 1)
+	for _, pkg := range storePkgs {
+		s.Require().Nil(a.Submit(pkg))
+	}
+	s.Assert().Nil(a.Close())
+	s.Assert().Equal(expected.Bytes(), buf.Bytes())
+
+	s.Assert().ErrorIs(a.Submit(storePkgs[0]), ErrWriterClosed)
+	s.Assert().ErrorIs(a.Close(), ErrWriterClosed)
+}
+
+func (s *WriterAsyncSuite) TestBackpressure() {
+	// The destination blocks until the gate is closed.
+	dest := &gatedWriter{gate: make(chan struct{})}
+	a := NewAsyncWriter(NewWriterWithVersion(dest, Version3), 1)
+
+	// The first object is being written, and the second is queued, so the
+	// third blocks until the destination accepts more writes.
+	s.Require().Nil(a.Submit(storePkgs[0]))
+	s.Require().Nil(a.Submit(storePkgs[1]))
+	submitted := make(chan error)
+	go func() {
+		submitted <- a.Submit(storePkgs[2])
+	}()
+	select {
+	case <-submitted:
+		s.Fail("submit did not block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(dest.gate)
+	s.Assert().Nil(<-submitted)
+	s.Assert().Nil(a.Close())
+
+	store, err := NewSnapshotStore(bytes.NewReader(dest.buf.Bytes()), "name")
+	s.Require().Nil(err)
+	s.Assert().Equal(3, store.Len())
+}
+
+func (s *WriterAsyncSuite) TestErrors() {
+	a := NewAsyncWriter(NewWriterWithVersion(failingWriter{}, Version3), 1)
+	s.Require().Nil(a.Submit(storePkgs[0]))
+	s.Assert().Eventually(func() bool { return a.Err() != nil }, time.Second, time.Millisecond)
+	s.Assert().ErrorIs(a.Submit(storePkgs[1]), errWriteFailed)
+	s.Assert().ErrorIs(a.Close(), errWriteFailed)
+}
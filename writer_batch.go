@@ -0,0 +1,72 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// parsedTag records the parsed struct tag of a struct field. See `parseTag`.
+type parsedTag struct {
+	t      tag
+	skip   bool
+	tagged bool
+	err    error
+}
+
+// WriteObjects writes each of `vs` as a top-level object, like calling
+// `WriteObject` for each value, and returns the offset of each object record
+// relative to the start of the data written by the call, along with the total
+// size written. When the index is written first, the first offset follows the
+// index. The struct tags of each type are parsed once for the whole batch
+// rather than once per value.
+//
+// If an object cannot be written, the offsets of the objects that were
+// written are returned with the error.
+func (f *rsfWriter) WriteObjects(vs ...any) ([]int, int, error) {
+	err := f.checkWritable()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f.tagCache = make(map[reflect.Type][]parsedTag)
+	defer func() {
+		f.tagCache = nil
+	}()
+
+	offsets := make([]int, 0, len(vs))
+	var totalSz int
+	for i, v := range vs {
+		indexSz, sz, err := f.writeTopLevelObject(v)
+		if err != nil {
+			return offsets, totalSz, fmt.Errorf("error writing object %d: %w", i, err)
+		}
+		offsets = append(offsets, totalSz+indexSz)
+		totalSz += indexSz + sz
+	}
+	return offsets, totalSz, nil
+}
+
+// tagInfo is like `getTagInfo`, but uses the parsed tags cached by
+// `WriteObjects`, if any.
+func (f *rsfWriter) tagInfo(v reflect.Type, index int, t, tParent *tag, fieldVal any) (bool, error) {
+	if f.tagCache == nil {
+		return getTagInfo(v, index, t, tParent, fieldVal)
+	}
+
+	tags, ok := f.tagCache[v]
+	if !ok {
+		tags = make([]parsedTag, v.NumField())
+		for i := range tags {
+			tags[i].skip, tags[i].tagged, tags[i].err = parseTag(v, i, &tags[i].t)
+		}
+		f.tagCache[v] = tags
+	}
+	parsed := tags[index]
+	if parsed.err != nil || !parsed.tagged {
+		return parsed.skip, parsed.err
+	}
+	*t = parsed.t
+	setParentTag(v, index, t, tParent, fieldVal)
+	return parsed.skip, nil
+}
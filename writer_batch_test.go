@@ -0,0 +1,123 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterBatchSuite struct {
+	suite.Suite
+}
+
+func TestWriterBatchSuite(t *testing.T) {
+	suite.Run(t, &WriterBatchSuite{})
+}
+
+type batchRelease struct {
+	Date    string `rsf:"date,skip,fixed:10"`
+	Version int64  `rsf:"version,skip"`
+	Name    string `rsf:"name"`
+	Expires int64  `rsf:"expires,expires"`
+}
+
+type batchProject struct {
+	Name     string         `rsf:"name"`
+	Releases []batchRelease `rsf:"releases,index:date+version"`
+	Items    []channelItem  `rsf:"items,index:key"`
+}
+
+var batchProjects = []any{
+	batchProject{
+		Name: "first",
+		Releases: []batchRelease{
+			{Date: "2020-10-01", Version: 1, Name: "one", Expires: 100},
+			{Date: "2020-10-01", Version: -2, Name: "two"},
+		},
+		Items: channelItems,
+	},
+	batchProject{Name: "second"},
+	batchProject{Name: "third", Items: channelItems[1:]},
+}
+
+func (s *WriterBatchSuite) TestWriteObjects() {
+	for _, opts := range [][]WriterOption{nil, {WithFieldOffsets()}, {WithElementHashes(), WithDigest()}} {
+		// The batch matches objects written one at a time.
+		expected := &bytes.Buffer{}
+		w := NewWriterWithVersion(expected, Version3, opts...)
+		for _, v := range batchProjects {
+			_, err := w.WriteObject(v)
+			s.Require().Nil(err)
+		}
+		_, err := w.Finalize()
+		s.Require().Nil(err)
+
+		actual := &bytes.Buffer{}
+		w = NewWriterWithVersion(actual, Version3, opts...)
+		offsets, sz, err := w.WriteObjects(batchProjects[:2]...)
+		s.Require().Nil(err)
+		s.Assert().Equal(actual.Len(), sz)
+		more, sz, err := w.WriteObjects(batchProjects[2:]...)
+		s.Require().Nil(err)
+		s.Assert().Equal([]int{0}, more)
+		offsets = append(offsets, more[0]+actual.Len()-sz)
+		_, err = w.Finalize()
+		s.Require().Nil(err)
+		s.Assert().Equal(expected.Bytes(), actual.Bytes())
+
+		// The offsets match the objects found by scanning the file.
+		ra := bytes.NewReader(actual.Bytes())
+		obj, err := OpenObject(ra)
+		s.Require().Nil(err)
+		for _, offset := range offsets {
+			s.Assert().Equal(int64(offset), obj.Offset)
+			obj, _ = NextObject(ra, obj)
+		}
+	}
+}
+
+func (s *WriterBatchSuite) TestErrors() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	bad := batchProject{Items: []channelItem{{Key: "toolong"}}}
+	offsets, sz, err := w.WriteObjects(batchProjects[0], bad, batchProjects[1])
+	s.Assert().ErrorContains(err, "error writing object 1")
+	s.Assert().Len(offsets, 1)
+	s.Assert().Equal(buf.Len(), sz)
+
+	_, err = w.Finalize()
+	s.Require().Nil(err)
+	_, _, err = w.WriteObjects(batchProjects[1])
+	s.Assert().ErrorIs(err, ErrFinalized)
+}
+
+func BenchmarkWriteObjects(b *testing.B) {
+	vs := make([]any, 1000)
+	for i := range vs {
+		vs[i] = batchProjects[i%len(batchProjects)]
+	}
+	b.Run("WriteObject", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w := NewWriterWithVersion(&bytes.Buffer{}, Version3)
+			for _, v := range vs {
+				_, err := w.WriteObject(v)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("WriteObjects", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w := NewWriterWithVersion(&bytes.Buffer{}, Version3)
+			_, _, err := w.WriteObjects(vs...)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"time"
+)
+
+/*
+
+In canonical mode, equal inputs are always encoded as identical bytes, so that
+a digest of a file can be used to detect changes or deduplicate files written
+by independent builds. The format is otherwise unchanged, and canonical files
+are read like any other file.
+
+Most of the format is already deterministic, with or without canonical mode:
+
+  - The index lists fields in struct declaration order, and header flags and
+    layers are written in a fixed order, so the index depends only on the
+    types written and the writer options.
+  - Arrays are written in element order, and map keys and segment names are
+    written in ascending order regardless of map iteration order.
+  - Nil and empty slices and maps are written identically, and times are
+    written in UTC, so times in different locations that denote the same
+    instant are written identically.
+  - Nothing is padded with incidental bytes: fixed-size varint slots and
+    integer keys are padded with zeros, and values shorter than a fixed-size
+    field are rejected rather than padded.
+
+Canonical mode additionally:
+
+  - Writes all NaN float values with the same bits, and writes negative zero
+    as zero.
+  - Omits `omitempty` values that are empty once normalized, such as negative
+    zero, zero times in any location, and structs whose fields are all empty,
+    so that they are written like the zero value.
+  - Rejects layers that encode equal payloads differently, such as `AESGCM`,
+    which uses a random nonce for each payload.
+
+*/
+
+// WithCanonical guarantees that equal inputs are encoded as identical bytes,
+// so that file digests can be compared across independent builds. Layers that
+// encode equal payloads differently, such as `AESGCM`, cannot be used.
+func WithCanonical() WriterOption {
+	return func(f *rsfWriter) {
+		f.canonical = true
+	}
+}
+
+// randomizedLayer is implemented by layers that encode equal payloads
+// differently.
+type randomizedLayer interface {
+	randomized() bool
+}
+
+func (a *aesGCMLayer) randomized() bool {
+	return true
+}
+
+// checkCanonical returns an error if the writer's options cannot produce
+// canonical output.
+func (f *rsfWriter) checkCanonical() error {
+	for _, l := range f.layers {
+		if r, ok := l.(randomizedLayer); ok && r.randomized() {
+			return fmt.Errorf("layer %d cannot be used with canonical encoding", l.ID())
+		}
+	}
+	return nil
+}
+
+// canonicalEmpty returns true if `v` is empty once normalized, so that
+// `omitempty` values equal to the zero value are omitted in canonical mode.
+// See `isEmptyValue`.
+func canonicalEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Struct:
+		if v.Type() == timeType && v.CanInterface() {
+			return v.Interface().(time.Time).IsZero()
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if !canonicalEmpty(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return isEmptyValue(v)
+}
+
+// canonicalFloat returns the canonical representation of a float value.
+func canonicalFloat(val float64) float64 {
+	if math.IsNaN(val) {
+		return math.NaN()
+	}
+	if val == 0 {
+		return 0
+	}
+	return val
+}
+
+// HashElement returns the 64-bit FNV-1a hash of the canonical encoding of `v`,
+// which is usually an array element, without writing it. Equal elements have
+// equal hashes, so hashes can be compared with the hashes of a previous
+// snapshot to detect changed elements. Fields tagged with `skip`, such as
+// array index keys, are not part of the encoding, and are not hashed.
+func HashElement(v any) (uint64, error) {
+	if v == nil {
+		return 0, errors.New("cannot hash nil element")
+	}
+	f := &rsfWriter{version: Version3, canonical: true}
+	buf := &bytes.Buffer{}
+	_, err := f.writeObject(reflect.ValueOf(v), &tag{}, buf)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(buf.Bytes())
+	return h.Sum64(), nil
+}
@@ -0,0 +1,190 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterCanonicalSuite struct {
+	suite.Suite
+}
+
+func TestWriterCanonicalSuite(t *testing.T) {
+	suite.Run(t, &WriterCanonicalSuite{})
+}
+
+func (s *WriterCanonicalSuite) write(objs []any, opts ...WriterOption) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, opts...)
+	for _, obj := range objs {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *WriterCanonicalSuite) TestCanonicalFloats() {
+	nan := math.Float64frombits(0x7ff8000000000123)
+	s.Require().True(math.IsNaN(nan))
+
+	a := s.write([]any{headerTestObject{Company: "posit", Rating: nan}}, WithCanonical())
+	b := s.write([]any{headerTestObject{Company: "posit", Rating: math.NaN()}}, WithCanonical())
+	s.Assert().Equal(a, b)
+
+	a = s.write([]any{headerTestObject{Company: "posit", Rating: math.Copysign(0, -1)}}, WithCanonical())
+	b = s.write([]any{headerTestObject{Company: "posit", Rating: 0}}, WithCanonical())
+	s.Assert().Equal(a, b)
+
+	// Without canonical mode, the float bits are preserved
+	a = s.write([]any{headerTestObject{Company: "posit", Rating: nan}})
+	b = s.write([]any{headerTestObject{Company: "posit", Rating: math.NaN()}})
+	s.Assert().NotEqual(a, b)
+}
+
+func (s *WriterCanonicalSuite) TestCanonicalEquivalent() {
+	type release struct {
+		Version string   `rsf:"version"`
+		Score   float64  `rsf:"score"`
+		Tags    []string `rsf:"tags"`
+	}
+	type pkg struct {
+		Name     string             `rsf:"name"`
+		Updated  time.Time          `rsf:"updated"`
+		Ranks    map[string]float64 `rsf:"ranks"`
+		Vectors  []float32          `rsf:"vectors"`
+		Tags     []string           `rsf:"tags"`
+		Rating   float64            `rsf:"rating,omitempty"`
+		Yanked   time.Time          `rsf:"yanked,omitempty"`
+		Latest   release            `rsf:"latest,omitempty"`
+		Releases []release          `rsf:"releases"`
+	}
+	negZero := math.Copysign(0, -1)
+	updated := time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC)
+	a := pkg{
+		Name:     "dplyr",
+		Updated:  updated,
+		Ranks:    map[string]float64{"a": 0, "b": 1, "c": math.NaN()},
+		Vectors:  []float32{0, float32(math.NaN())},
+		Releases: []release{{Version: "1.0"}},
+	}
+	ranks := make(map[string]float64)
+	for _, key := range []string{"c", "b", "a"} {
+		ranks[key] = a.Ranks[key]
+	}
+	ranks["a"] = negZero
+	b := pkg{
+		Name:     "dplyr",
+		Updated:  updated.In(time.FixedZone("EST", -5*3600)),
+		Ranks:    ranks,
+		Vectors:  []float32{float32(negZero), math.Float32frombits(0x7fc00123)},
+		Tags:     []string{},
+		Rating:   negZero,
+		Yanked:   time.Time{}.In(time.FixedZone("EST", -5*3600)),
+		Latest:   release{Score: negZero, Tags: []string{}},
+		Releases: []release{{Version: "1.0", Score: negZero, Tags: []string{}}},
+	}
+	s.Assert().Equal(s.write([]any{a}, WithCanonical()), s.write([]any{b}, WithCanonical()))
+
+	// Without canonical mode, empty values that differ from the zero value
+	// are written.
+	s.Assert().NotEqual(s.write([]any{a}), s.write([]any{b}))
+
+	// Values that are not empty once normalized are still written.
+	b.Latest.Version = "2.0"
+	s.Assert().NotEqual(s.write([]any{a}, WithCanonical()), s.write([]any{b}, WithCanonical()))
+}
+
+func (s *WriterCanonicalSuite) TestCanonicalDigest() {
+	opts := []WriterOption{WithCanonical(), WithFieldHashes(), WithDigest(), Chain(Checksum(), Zstd())}
+	objs := make([]any, 0)
+	for _, obj := range testComplexData {
+		objs = append(objs, obj)
+	}
+	a := s.write(objs, opts...)
+	b := s.write(objs, opts...)
+	s.Assert().Equal(sha256.Sum256(a), sha256.Sum256(b))
+}
+
+func (s *WriterCanonicalSuite) TestCanonicalLayers() {
+	w := NewWriterWithVersion(&bytes.Buffer{}, Version3, WithCanonical(), Chain(Checksum(), AESGCM(make([]byte, 32))))
+	_, err := w.WriteObject(headerTestObject{Company: "posit"})
+	s.Assert().EqualError(err, "layer 3 cannot be used with canonical encoding")
+}
+
+// TestReproducible verifies that files are reproducible by default. Nothing
+// that varies between builds, such as the current time or random values, is
+// written unless requested with a layer like `AESGCM`.
+func (s *WriterCanonicalSuite) TestReproducible() {
+	objs := make([]any, 0)
+	for _, obj := range testComplexData {
+		objs = append(objs, obj)
+	}
+
+	for _, version := range []int{Version1, Version2, Version3} {
+		a := &bytes.Buffer{}
+		b := &bytes.Buffer{}
+		for _, buf := range []*bytes.Buffer{a, b} {
+			w := NewWriterWithVersion(buf, version)
+			for _, obj := range objs {
+				_, err := w.WriteObject(obj)
+				s.Require().Nil(err)
+			}
+		}
+		s.Assert().Equal(a.Bytes(), b.Bytes(), "version %d", version)
+	}
+
+	for _, opts := range [][]WriterOption{
+		{WithFieldOffsets()},
+		{WithFieldHashes()},
+		{WithMinReaderVersion(4)},
+		{WithDigest()},
+		{Chain(Checksum())},
+		{Chain(Zstd())},
+		{Chain(Checksum(), Zstd()), WithFieldHashes(), WithDigest()},
+	} {
+		a := s.write(objs, opts...)
+		b := s.write(objs, opts...)
+		s.Assert().Equal(a, b)
+	}
+
+	// Encryption uses random nonces when explicitly requested
+	key := make([]byte, 32)
+	a := s.write(objs, Chain(AESGCM(key)))
+	b := s.write(objs, Chain(AESGCM(key)))
+	s.Assert().NotEqual(a, b)
+}
+
+func (s *WriterCanonicalSuite) TestHashElement() {
+	type pkg struct {
+		Date    string   `rsf:"date,skip,fixed:10"`
+		Name    string   `rsf:"name"`
+		Score   float64  `rsf:"score"`
+		Aliases []string `rsf:"aliases"`
+	}
+	a := pkg{Date: "2023-01-01", Name: "plyr", Score: math.NaN(), Aliases: []string{"p"}}
+	hashA, err := HashElement(a)
+	s.Require().Nil(err)
+
+	// Equal elements have equal hashes, including NaN floats and skipped
+	// fields
+	b := a
+	b.Date = "2023-02-01"
+	b.Score = math.Float64frombits(math.Float64bits(math.NaN()) | 1)
+	hashB, err := HashElement(b)
+	s.Require().Nil(err)
+	s.Assert().Equal(hashA, hashB)
+
+	b.Aliases = []string{"q"}
+	hashB, err = HashElement(b)
+	s.Require().Nil(err)
+	s.Assert().NotEqual(hashA, hashB)
+
+	_, err = HashElement(nil)
+	s.Assert().EqualError(err, "cannot hash nil element")
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+// ArrayKey constrains the keys used to index arrays written with
+// `WriteArrayFromChannel`.
+type ArrayKey interface {
+	~string | ~int64
+}
+
+// WriteArrayFromChannel writes a top-level object with a single array field,
+// `name`, whose elements are received from `ch` until it is closed. Each
+// element is encoded as it is received, so producers do not need to
+// accumulate a slice, and an unbuffered channel blocks the producer until the
+// previous element is encoded. The index is written first if this is the
+// first object.
+//
+// The encoded array is held in memory until `ch` is closed, since the array
+// size and index precede the elements and layers such as `Chain` process
+// whole records, so memory use grows with the encoded size of the array, plus
+// a copy of the elements when `keyFn` is not nil. Use `BeginArray` to stream
+// large arrays to an io.WriteSeeker instead.
+//
+// When `keyFn` is not nil, the array is indexed by the key returned for each
+// element, as though the array were tagged with `index`. Indexed array
+// elements must be structs, and string keys must all have the same length,
+// which is the length of the first key, so it must not be empty. Since the
+// index is written with the first object, the keys of later objects must have
+// the same size, and an empty first array with string keys, which is written
+// without an index since the key size is unknown, cannot be followed by
+// indexed arrays.
+//
+// Elements are processed as with `WriteObject`: provenance is written for
+// `ProvenanceProvider` elements, `WithMaxElementSize` limits the size of each
+// element, and expired elements are dropped with `WithDropExpired`.
+//
+// If an error occurs, the remaining elements are received from `ch` and
+// discarded so that producers are not blocked.
+func WriteArrayFromChannel[T any, K ArrayKey](w Writer, name string, ch <-chan T, keyFn func(T) K) (int, error) {
+	sz, err := writeArrayFromChannel(w, name, ch, keyFn)
+	if err != nil {
+		for range ch {
+		}
+	}
+	return sz, err
+}
+
+func writeArrayFromChannel[T any, K ArrayKey](w Writer, name string, ch <-chan T, keyFn func(T) K) (int, error) {
+	f, ok := w.(*rsfWriter)
+	if !ok {
+		return 0, fmt.Errorf("unsupported writer type %T", w)
+	}
+	err := f.checkWritable()
+	if err != nil {
+		return 0, err
+	}
+
+	elType := reflect.TypeOf((*T)(nil)).Elem()
+	if keyFn != nil && elType.Kind() != reflect.Struct {
+		return 0, fmt.Errorf("indexed array %s elements must be structs", name)
+	}
+
+	// Encode the elements and their index entries as they are received. The
+	// array size and length are patched once the channel is closed. Without
+	// an index, the elements are encoded directly into the record.
+	buf := &bytes.Buffer{}
+	_, err = f.WriteSizeField(0, 0, buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.WriteSizeField(0, 0, buf)
+	if err != nil {
+		return 0, err
+	}
+	elTag := &tag{name: name}
+	indexTag := &tag{name: name}
+	if keyFn != nil && reflect.TypeOf((*K)(nil)).Elem().Kind() == reflect.Int64 {
+		indexTag.indexSz = sizeInt64
+		indexTag.indexType = int(reflect.Int64)
+	}
+	elBuf := buf
+	keyBuf := &bytes.Buffer{}
+	if keyFn != nil {
+		elBuf = &bytes.Buffer{}
+	}
+	lastLen := elBuf.Len()
+	var count int
+	provenance := f.hasProvenance(elType)
+	var i int
+	for el := range ch {
+		var elSz, sz int
+		elSz, sz, err = f.writeElement(reflect.ValueOf(el), elTag, provenance, elBuf)
+		if err != nil {
+			return 0, err
+		}
+
+		var drop bool
+		drop, err = f.dropElement(elTag, i, sz)
+		i++
+		if err != nil {
+			return 0, err
+		}
+		if drop {
+			elBuf.Truncate(lastLen)
+			continue
+		}
+
+		if keyFn != nil {
+			var key any
+			switch k := reflect.ValueOf(keyFn(el)); k.Kind() {
+			case reflect.String:
+				if count == 0 {
+					if k.Len() == 0 {
+						return 0, fmt.Errorf("array %s element %d has an empty key, so the key size is unknown", name, count)
+					}
+					indexTag.indexSz = k.Len()
+					indexTag.indexType = int(reflect.String)
+				}
+				key = k.String()
+			case reflect.Int64:
+				key = k.Int()
+			}
+			_, err = f.writeElementKey(key, indexTag.indexSz, elBuf.Bytes()[lastLen:], elSz, keyBuf)
+			if err != nil {
+				return 0, fmt.Errorf("error writing key for array %s element %d: %w", name, count, err)
+			}
+		}
+		lastLen = elBuf.Len()
+		count++
+	}
+	if indexTag.indexSz > 0 {
+		indexTag.index = name
+	}
+
+	// Later arrays must match the index written with the first array. Empty
+	// arrays have no keys, so they match any index.
+	var totalSz int
+	if f.pos == 0 {
+		sz, err := f.writeIndexRecord(func(buf *bytes.Buffer) (int, error) {
+			return f.writeIndexArray(reflect.SliceOf(elType), indexTag, buf)
+		})
+		if err != nil {
+			return 0, err
+		}
+		totalSz += sz
+		f.channelIndex = indexTag
+	} else if index := f.channelIndex; index != nil && count > 0 && (indexTag.indexSz != index.indexSz || indexTag.indexType != index.indexType) {
+		if index.index == "" {
+			return 0, fmt.Errorf("array %s is indexed, but the file index was written for an array without an index", name)
+		}
+		return 0, fmt.Errorf("array %s key size %d does not match the key size %d in the file index", name, indexTag.indexSz, index.indexSz)
+	}
+
+	// Append the index and elements, and patch the array size and length.
+	if keyFn != nil {
+		_, err = buf.ReadFrom(keyBuf)
+		if err != nil {
+			return 0, err
+		}
+		_, err = buf.ReadFrom(elBuf)
+		if err != nil {
+			return 0, err
+		}
+	}
+	f.byteOrder().PutUint32(buf.Bytes(), uint32(buf.Len()))
+	f.byteOrder().PutUint32(buf.Bytes()[sizeFieldLen:], uint32(count))
+
+	var offsets []fieldOffset
+	if f.headerFlags&FlagFieldOffsets != 0 {
+		offsets = []fieldOffset{{name: name, offset: 0}}
+	}
+	sz, err := f.writeRecord(buf, offsets)
+	if err != nil {
+		return 0, err
+	}
+	totalSz += sz
+
+	return totalSz, nil
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterChannelSuite struct {
+	suite.Suite
+}
+
+func TestWriterChannelSuite(t *testing.T) {
+	suite.Run(t, &WriterChannelSuite{})
+}
+
+type channelItem struct {
+	Key   string  `rsf:"key,fixed:3"`
+	Name  string  `rsf:"name"`
+	Score float64 `rsf:"score"`
+}
+
+type channelObject struct {
+	Items []channelItem `rsf:"items,index:key"`
+}
+
+type channelObjectNoIndex struct {
+	Items []channelItem `rsf:"items"`
+}
+
+var channelItems = []channelItem{
+	{Key: "abc", Name: "first", Score: 1},
+	{Key: "def", Name: "second", Score: 2},
+	{Key: "ghi", Name: "third", Score: 3},
+}
+
+func produce[T any](items []T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for _, item := range items {
+			ch <- item
+		}
+	}()
+	return ch
+}
+
+func (s *WriterChannelSuite) TestWriteArrayFromChannel() {
+	for _, opts := range [][]WriterOption{nil, {WithFieldHashes()}, {Chain(Checksum())}} {
+		expected := &bytes.Buffer{}
+		w := NewWriterWithVersion(expected, Version3, opts...)
+		_, err := w.WriteObject(channelObject{Items: channelItems})
+		s.Require().Nil(err)
+		_, err = w.WriteObject(channelObject{Items: channelItems[1:]})
+		s.Require().Nil(err)
+
+		actual := &bytes.Buffer{}
+		w = NewWriterWithVersion(actual, Version3, opts...)
+		keyFn := func(item channelItem) string { return item.Key }
+		sz, err := WriteArrayFromChannel(w, "items", produce(channelItems), keyFn)
+		s.Require().Nil(err)
+		s.Assert().Equal(actual.Len(), sz)
+		_, err = WriteArrayFromChannel(w, "items", produce(channelItems[1:]), keyFn)
+		s.Require().Nil(err)
+
+		// Since the key is returned by a function, the index does not
+		// include key fields. Otherwise, the data is the same.
+		expectedRA := bytes.NewReader(expected.Bytes())
+		expectedObj, err := OpenObject(expectedRA)
+		s.Require().Nil(err)
+		s.Assert().Equal([]IndexKey{{FieldName: "key", KeyType: int(reflect.String), KeySize: 3}}, expectedObj.Index[0].IndexKeys)
+		actualRA := bytes.NewReader(actual.Bytes())
+		actualObj, err := OpenObject(actualRA)
+		s.Require().Nil(err)
+		s.Assert().Nil(actualObj.Index[0].IndexKeys)
+		s.Assert().Equal(expected.Len()-len("key")-3*sizeFieldLen, actual.Len())
+		for i := 0; i < 2; i++ {
+			expectedItems, err := ReadFieldAt(expectedRA, expectedObj, "items")
+			s.Require().Nil(err)
+			actualItems, err := ReadFieldAt(actualRA, actualObj, "items")
+			s.Require().Nil(err)
+			s.Assert().Equal(expectedItems, actualItems)
+			if i == 0 {
+				expectedObj, err = NextObject(expectedRA, expectedObj)
+				s.Require().Nil(err)
+				actualObj, err = NextObject(actualRA, actualObj)
+				s.Require().Nil(err)
+			}
+		}
+	}
+
+	// Writing from a channel is the same as writing a struct
+	expected := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(expected, Version2).WriteObject(channelObject{Items: channelItems})
+	s.Require().Nil(err)
+	actual := &bytes.Buffer{}
+	_, err = WriteArrayFromChannel(NewWriterWithVersion(actual, Version2), "items", produce(channelItems), func(item channelItem) string { return item.Key })
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), actual.Bytes())
+
+	// Without an index
+	expected.Reset()
+	_, err = NewWriterWithVersion(expected, Version2).WriteObject(channelObjectNoIndex{Items: channelItems})
+	s.Require().Nil(err)
+	actual.Reset()
+	_, err = WriteArrayFromChannel[channelItem, string](NewWriterWithVersion(actual, Version2), "items", produce(channelItems), nil)
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), actual.Bytes())
+}
+
+func (s *WriterChannelSuite) TestWriteArrayFromChannelInt64Keys() {
+	type item struct {
+		ID   int64  `rsf:"id"`
+		Name string `rsf:"name"`
+	}
+	type object struct {
+		Items []item `rsf:"items,index:id"`
+	}
+	items := []item{{ID: 5, Name: "five"}, {ID: 7, Name: "seven"}}
+
+	expected := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(expected, Version2).WriteObject(object{Items: items})
+	s.Require().Nil(err)
+	actual := &bytes.Buffer{}
+	_, err = WriteArrayFromChannel(NewWriterWithVersion(actual, Version2), "items", produce(items), func(i item) int64 { return i.ID })
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), actual.Bytes())
+}
+
+func (s *WriterChannelSuite) TestWriteArrayFromChannelErrors() {
+	keyFn := func(item channelItem) string { return item.Name }
+	_, err := WriteArrayFromChannel(NewWriterWithVersion(&bytes.Buffer{}, Version2), "items", produce(channelItems), keyFn)
+	s.Assert().EqualError(err, "error writing key for array items element 1: size 6 does not match expected size 5")
+
+	_, err = WriteArrayFromChannel(NewWriterWithVersion(&bytes.Buffer{}, Version2), "names", produce([]string{"a"}), func(v string) string { return v })
+	s.Assert().EqualError(err, "indexed array names elements must be structs")
+
+	// The first key determines the key size
+	keyFn = func(item channelItem) string { return item.Key }
+	_, err = WriteArrayFromChannel(NewWriterWithVersion(&bytes.Buffer{}, Version2), "items", produce([]channelItem{{Name: "first"}}), keyFn)
+	s.Assert().EqualError(err, "array items element 0 has an empty key, so the key size is unknown")
+
+	// Later objects must match the index written with the first object
+	w := NewWriterWithVersion(&bytes.Buffer{}, Version2)
+	_, err = WriteArrayFromChannel(w, "items", produce([]channelItem{}), keyFn)
+	s.Require().Nil(err)
+	_, err = WriteArrayFromChannel(w, "items", produce(channelItems), keyFn)
+	s.Assert().EqualError(err, "array items is indexed, but the file index was written for an array without an index")
+
+	keyFn = func(item channelItem) string { return item.Name }
+	w = NewWriterWithVersion(&bytes.Buffer{}, Version2)
+	_, err = WriteArrayFromChannel(w, "items", produce([]channelItem{{Name: "abc"}}), keyFn)
+	s.Require().Nil(err)
+	_, err = WriteArrayFromChannel(w, "items", produce([]channelItem{{Name: "abcde"}}), keyFn)
+	s.Assert().EqualError(err, "array items key size 5 does not match the key size 3 in the file index")
+	_, err = WriteArrayFromChannel(w, "items", produce([]channelItem{}), keyFn)
+	s.Assert().Nil(err)
+}
+
+func (s *WriterChannelSuite) TestWriteArrayFromChannelEmptyInt64Keys() {
+	type item struct {
+		ID   int64  `rsf:"id,skip"`
+		Name string `rsf:"name"`
+	}
+	keyFn := func(i item) int64 { return i.ID }
+
+	// Int64 keys have a fixed size, so an empty first array is indexed
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := WriteArrayFromChannel(w, "items", produce([]item{}), keyFn)
+	s.Require().Nil(err)
+	_, err = WriteArrayFromChannel(w, "items", produce([]item{{ID: 0, Name: "zero"}, {ID: 7, Name: "seven"}}), keyFn)
+	s.Require().Nil(err)
+
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	obj, err = NextObject(ra, obj)
+	s.Require().Nil(err)
+	handles, err := ElementHandles(ra, obj, "items")
+	s.Require().Nil(err)
+	s.Require().Len(handles, 2)
+	s.Assert().Equal(int64(0), handles[0].Key)
+	s.Assert().Equal(int64(7), handles[1].Key)
+}
+
+func (s *WriterChannelSuite) TestWriteArrayFromChannelProvenance() {
+	type object struct {
+		Packages []sourcedPkg `rsf:"packages"`
+	}
+	expected := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(expected, Version3).WriteObject(object{Packages: sourcedData.Packages})
+	s.Require().Nil(err)
+	actual := &bytes.Buffer{}
+	_, err = WriteArrayFromChannel[sourcedPkg, string](NewWriterWithVersion(actual, Version3), "packages", produce(sourcedData.Packages), nil)
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), actual.Bytes())
+
+	ra := bytes.NewReader(actual.Bytes())
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	pkgs, err := ReadFieldAt(ra, obj, "packages")
+	s.Require().Nil(err)
+	s.Require().Len(pkgs, 2)
+	p, ok := ElementProvenance(pkgs.([]any)[0])
+	s.Assert().True(ok)
+	s.Assert().Equal("https://cran.r-project.org/plyr", p.Source)
+	_, ok = ElementProvenance(pkgs.([]any)[1])
+	s.Assert().False(ok)
+}
+
+func (s *WriterChannelSuite) TestWriteArrayFromChannelMaxElementSize() {
+	keyFn := func(item channelItem) string { return item.Key }
+
+	// Oversized elements fail by default
+	_, err := WriteArrayFromChannel(NewWriterWithVersion(&bytes.Buffer{}, Version2, WithMaxElementSize(20, nil)), "items", produce(channelItems), keyFn)
+	s.Assert().Equal(ErrElementTooLarge{Array: "items", Index: 1, Size: 21, Max: 20}, err)
+
+	// Oversized elements are dropped when using a callback
+	var oversized []ErrElementTooLarge
+	actual := &bytes.Buffer{}
+	_, err = WriteArrayFromChannel(NewWriterWithVersion(actual, Version2, WithMaxElementSize(20, func(e ErrElementTooLarge) {
+		oversized = append(oversized, e)
+	})), "items", produce(channelItems), keyFn)
+	s.Require().Nil(err)
+	s.Assert().Equal([]ErrElementTooLarge{{Array: "items", Index: 1, Size: 21, Max: 20}}, oversized)
+
+	expected := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(expected, Version2).WriteObject(channelObject{Items: []channelItem{channelItems[0], channelItems[2]}})
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), actual.Bytes())
+}
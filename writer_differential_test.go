@@ -0,0 +1,129 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// The differential tests encode randomized values with both `WriteObject`,
+// which uses reflection, and an encoder that uses the Write* primitives
+// directly, and require identical bytes and decoded values. Code generated
+// encoders should be added to `differentialEncoders` so that they are held to
+// the same format as the reflection-based path.
+type WriterDifferentialSuite struct {
+	suite.Suite
+}
+
+func TestWriterDifferentialSuite(t *testing.T) {
+	suite.Run(t, &WriterDifferentialSuite{})
+}
+
+// differentialEncoder writes a single top-level object without an index.
+type differentialEncoder func(w Writer, v headerTestObject, buf *bytes.Buffer) error
+
+var differentialEncoders = map[string]differentialEncoder{
+	"primitives": writeHeaderTestObject,
+}
+
+// writeHeaderTestObject encodes a `headerTestObject` in the same way as
+// `WriteObject`.
+func writeHeaderTestObject(w Writer, v headerTestObject, buf *bytes.Buffer) error {
+	data := &bytes.Buffer{}
+	_, err := w.WriteStringField(0, v.Company, data)
+	if err != nil {
+		return err
+	}
+
+	tags := &bytes.Buffer{}
+	for _, tag := range v.Tags {
+		_, err = w.WriteStringField(0, tag, tags)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.WriteSizeField(0, tags.Len()+sizeFieldLen*2, data)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteSizeField(0, len(v.Tags), data)
+	if err != nil {
+		return err
+	}
+	_, err = data.ReadFrom(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteFloatField(0, v.Rating, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteSizeField(0, data.Len()+sizeFieldLen, buf)
+	if err != nil {
+		return err
+	}
+	_, err = buf.ReadFrom(data)
+	return err
+}
+
+func randomString(rnd *rand.Rand) string {
+	bs := make([]byte, rnd.Intn(64))
+	for i := range bs {
+		bs[i] = byte(rnd.Intn(256))
+	}
+	return string(bs)
+}
+
+func randomHeaderTestObject(rnd *rand.Rand) headerTestObject {
+	obj := headerTestObject{
+		Company: randomString(rnd),
+		Tags:    make([]string, rnd.Intn(8)),
+		Rating:  rnd.NormFloat64() * 1e6,
+	}
+	for i := range obj.Tags {
+		obj.Tags[i] = randomString(rnd)
+	}
+	return obj
+}
+
+func (s *WriterDifferentialSuite) TestDifferential() {
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 200; i++ {
+		obj := randomHeaderTestObject(rnd)
+
+		// Encode with reflection. The first object is preceded by the index,
+		// so the second object is compared.
+		expected := &bytes.Buffer{}
+		w := NewWriterWithVersion(expected, Version3)
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+		objectStart := expected.Len()
+		_, err = w.WriteObject(obj)
+		s.Require().Nil(err)
+
+		for name, encode := range differentialEncoders {
+			actual := &bytes.Buffer{}
+			err = encode(NewWriter(&bytes.Buffer{}), obj, actual)
+			s.Require().Nil(err, name)
+			s.Require().Equal(expected.Bytes()[objectStart:], actual.Bytes(), name)
+
+			// Decode both
+			data := append(bytes.Clone(expected.Bytes()[:objectStart]), actual.Bytes()...)
+			ra := bytes.NewReader(data)
+			ref, err := OpenObject(ra)
+			s.Require().Nil(err)
+			for _, field := range []string{"company", "tags", "rating"} {
+				val, err := ReadFieldAt(ra, ref, field)
+				s.Require().Nil(err)
+				want, err := ReadFieldAt(bytes.NewReader(expected.Bytes()), ref, field)
+				s.Require().Nil(err)
+				s.Require().Equal(want, val, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"fmt"
+	"math"
+)
+
+// Float encodings recorded in the file header. Files written before the float
+// encoding was recorded use FloatIEEE754.
+const (
+	// FloatIEEE754 indicates that floats are written as 8-byte,
+	// little-endian IEEE 754 values, which may include NaN and infinite
+	// values.
+	FloatIEEE754 = 1 + iota
+
+	// FloatIEEE754Finite indicates that floats are written as with
+	// FloatIEEE754, but never include NaN or infinite values. See
+	// `WithFloatPolicy`.
+	FloatIEEE754Finite
+)
+
+// A FloatPolicy determines how NaN and infinite float values are written.
+type FloatPolicy int
+
+const (
+	// FloatAllow writes NaN and infinite values as-is. This is the default.
+	FloatAllow FloatPolicy = iota
+
+	// FloatReject fails with an `ErrNonFiniteFloat` error when writing a
+	// NaN or infinite value.
+	FloatReject
+
+	// FloatNormalize writes NaN values as zero and infinite values as the
+	// largest finite value with the same sign.
+	FloatNormalize
+)
+
+// WithFloatPolicy sets how NaN and infinite float values are written. When
+// using FloatReject or FloatNormalize, the file header records the
+// FloatIEEE754Finite encoding, so readers know that the file contains only
+// finite values.
+func WithFloatPolicy(policy FloatPolicy) WriterOption {
+	return func(f *rsfWriter) {
+		f.floatPolicy = policy
+	}
+}
+
+// ErrNonFiniteFloat is returned when writing a NaN or infinite float value with
+// the FloatReject policy.
+type ErrNonFiniteFloat struct {
+	Value float64
+}
+
+func (e ErrNonFiniteFloat) Error() string {
+	return fmt.Sprintf("cannot write non-finite float value %v", e.Value)
+}
+
+// floatEncoding returns the float encoding recorded in the file header.
+func (f *rsfWriter) floatEncoding() int {
+	if f.floatPolicy == FloatAllow {
+		return FloatIEEE754
+	}
+	return FloatIEEE754Finite
+}
+
+// applyFloatPolicy returns the value to write for `val`, or an error if the
+// value cannot be written.
+func (f *rsfWriter) applyFloatPolicy(val float64) (float64, error) {
+	if !math.IsNaN(val) && !math.IsInf(val, 0) {
+		return val, nil
+	}
+	switch f.floatPolicy {
+	case FloatReject:
+		return 0, ErrNonFiniteFloat{Value: val}
+	case FloatNormalize:
+		if math.IsInf(val, 1) {
+			return math.MaxFloat64, nil
+		} else if math.IsInf(val, -1) {
+			return -math.MaxFloat64, nil
+		}
+		return 0, nil
+	default:
+		return val, nil
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterFloatsSuite struct {
+	suite.Suite
+}
+
+func TestWriterFloatsSuite(t *testing.T) {
+	suite.Run(t, &WriterFloatsSuite{})
+}
+
+func (s *WriterFloatsSuite) TestFloatPolicy() {
+	// Allowed by default
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3)
+	_, err := w.WriteObject(headerTestObject{Rating: math.NaN()})
+	s.Assert().Nil(err)
+	r := NewReader()
+	_, err = r.ReadIndex(bytes.NewReader(buf.Bytes()))
+	s.Assert().Nil(err)
+	s.Assert().Equal(FloatIEEE754, r.Header().FloatEncoding)
+
+	// Reject
+	w = NewWriterWithVersion(&bytes.Buffer{}, Version3, WithFloatPolicy(FloatReject))
+	_, err = w.WriteObject(headerTestObject{Rating: math.Inf(-1)})
+	s.Assert().Equal(ErrNonFiniteFloat{Value: math.Inf(-1)}, err)
+	s.Assert().EqualError(err, "cannot write non-finite float value -Inf")
+	_, err = w.WriteFloatField(0, math.NaN(), &bytes.Buffer{})
+	s.Assert().ErrorAs(err, &ErrNonFiniteFloat{})
+	_, err = w.WriteFloatField(0, 1.5, &bytes.Buffer{})
+	s.Assert().Nil(err)
+
+	// Normalize
+	for val, expected := range map[float64]float64{
+		math.Inf(1):  math.MaxFloat64,
+		math.Inf(-1): -math.MaxFloat64,
+		-2.5:         -2.5,
+	} {
+		fbuf := &bytes.Buffer{}
+		w = NewWriterWithVersion(fbuf, Version3, WithFloatPolicy(FloatNormalize))
+		_, err = w.WriteFloatField(0, val, fbuf)
+		s.Assert().Nil(err)
+		actual, err := NewReader().ReadFloatField(fbuf)
+		s.Assert().Nil(err)
+		s.Assert().Equal(expected, actual)
+	}
+
+	buf.Reset()
+	w = NewWriterWithVersion(buf, Version3, WithFloatPolicy(FloatNormalize))
+	_, err = w.WriteObject(headerTestObject{Rating: math.NaN()})
+	s.Assert().Nil(err)
+	ra := bytes.NewReader(buf.Bytes())
+	obj, err := OpenObject(ra)
+	s.Assert().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "rating")
+	s.Assert().Nil(err)
+	s.Assert().Equal(float64(0), val)
+
+	r = NewReader()
+	_, err = r.ReadIndex(bytes.NewReader(buf.Bytes()))
+	s.Assert().Nil(err)
+	s.Assert().Equal(FloatIEEE754Finite, r.Header().FloatEncoding)
+}
+
+func (s *WriterFloatsSuite) TestFloatEncodingHeader() {
+	header := []byte{
+		// Index version 3
+		0x0, 0x8, 0x33,
+		// Header size
+		0x10, 0x0, 0x0, 0x0,
+		// Min reader version
+		0x3, 0x0, 0x0, 0x0,
+		// Flags
+		0x0, 0x0, 0x0, 0x0,
+		// Float encoding
+		0x1, 0x0, 0x0, 0x0,
+		// Empty index
+		0x4, 0x0, 0x0, 0x0,
+	}
+
+	r := NewReader()
+	_, err := r.ReadIndex(bytes.NewReader(header))
+	s.Assert().Nil(err)
+	s.Assert().Equal(FloatIEEE754, r.Header().FloatEncoding)
+
+	// Unknown float encodings
+	header[15] = 0x3
+	_, err = NewReader().ReadIndex(bytes.NewReader(header))
+	s.Assert().EqualError(err, "unsupported float encoding 3")
+
+	// Headers without a float encoding
+	header = append(header[:15], 0x4, 0x0, 0x0, 0x0)
+	header[3] = 0xc
+	_, err = NewReader().ReadIndex(bytes.NewReader(header))
+	s.Assert().EqualError(err, "file header is missing the float encoding")
+}
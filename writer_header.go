@@ -0,0 +1,161 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+)
+
+/*
+
+Version3 and later write a file header between the index version and the
+index. The header begins with its own size so that readers can skip header
+fields they do not understand.
+
+The minimum reader version is always the first header field. Readers that
+support an older version than the minimum reader version fail with an
+`ErrUnsupportedVersion` error rather than misreading the file.
+
+Format:
+
+  [index version]
+  [header size]
+  [min reader version]
+  [flags]
+  [layer count]                                   // FlagLayers only
+  [layer 1 ID]                                    // FlagLayers only
+  [layer n ID]                                    // FlagLayers only
+  [float encoding]
+  [key ID size]                                   // FlagKeyID only
+  [key ID]                                        // FlagKeyID only
+  [recipients]                                    // FlagRecipients only
+  [parent]                                        // FlagParent only
+
+Example:
+
+  0x0, 0x8, 0x33,                                 // IndexVersion3
+
+  0x10, 0x0, 0x0, 0x0,                            // 16 bytes full header size
+  0x3, 0x0, 0x0, 0x0,                             // Min reader version 3
+  0x1, 0x0, 0x0, 0x0,                             // FlagFieldOffsets
+  0x1, 0x0, 0x0, 0x0,                             // FloatIEEE754
+
+When the header includes FlagFieldOffsets, each top-level object is prefixed
+with a table of field offsets following the object size. Offsets are relative
+to the start of the object size field. When the header also includes
+FlagFieldHashes, each offset is preceded by a hash of the field name. See
+`FieldHash`.
+
+In Version3 and later, the index entry of each indexed array includes the
+array's key fields following the index size, so that readers can populate key
+fields that are tagged with `skip`. The key fields are written as a count
+followed by the name, type, and size of each field. A composite key (e.g.,
+`index:date+version`) is written as a fixed-size string that contains each key
+field in order.
+
+When the header includes FlagLayers, the payload of each top-level object,
+which begins with the field offset table, is encoded. See `Chain`.
+
+Format:
+
+  [object size]
+  [field count]
+  [field 1 name hash]                             // FlagFieldHashes only
+  [field 1 offset]
+  [field n name hash]                             // FlagFieldHashes only
+  [field n offset]
+  [field 1 data]
+  [field n data]
+
+*/
+
+// FieldHash returns the 32-bit FNV-1a hash of a field name. This is the hash
+// stored in field offset tables when using `WithFieldHashes`.
+func FieldHash(name string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return h.Sum32()
+}
+
+// minReaderVersion returns the minimum reader version required to read the
+// file. This is the writer version unless a higher version was requested with
+// `WithMinReaderVersion`.
+func (f *rsfWriter) minReaderVersion() int {
+	if f.minVersion > f.version {
+		return f.minVersion
+	}
+	return f.version
+}
+
+func (f *rsfWriter) writeHeader(w io.Writer) (int, error) {
+	defer f.defaultEncoding()()
+
+	buf := &bytes.Buffer{}
+	_, err := buf.Write(IndexVersion3)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := &bytes.Buffer{}
+	_, err = f.WriteSizeField(0, f.minReaderVersion(), fields)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.WriteSizeField(0, int(f.flags), fields)
+	if err != nil {
+		return 0, err
+	}
+	if f.flags&FlagLayers != 0 {
+		_, err = f.WriteSizeField(0, len(f.layers), fields)
+		if err != nil {
+			return 0, err
+		}
+		for _, l := range f.layers {
+			_, err = f.WriteSizeField(0, int(l.ID()), fields)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	_, err = f.WriteSizeField(0, f.floatEncoding(), fields)
+	if err != nil {
+		return 0, err
+	}
+	if f.flags&FlagKeyID != 0 {
+		_, err = f.WriteStringField(0, f.keyID, fields)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if f.flags&FlagRecipients != 0 {
+		err = f.writeRecipients(fields)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if f.flags&FlagParent != 0 {
+		err = f.writeParent(fields)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = f.WriteSizeField(0, fields.Len()+sizeFieldLen, buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(buf, fields)
+	if err != nil {
+		return 0, err
+	}
+
+	sz, err := io.Copy(w, buf)
+	if err != nil {
+		return 0, err
+	}
+	f.headerFlags = f.flags
+
+	return int(sz), nil
+}
@@ -0,0 +1,332 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterHeaderSuite struct {
+	suite.Suite
+}
+
+func TestWriterHeaderSuite(t *testing.T) {
+	suite.Run(t, &WriterHeaderSuite{})
+}
+
+type headerTestObject struct {
+	Company string   `rsf:"company"`
+	Tags    []string `rsf:"tags"`
+	Rating  float64  `rsf:"rating"`
+}
+
+func (s *WriterHeaderSuite) TestWriteFieldOffsets() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithFieldOffsets())
+
+	sz, err := w.WriteObject(headerTestObject{
+		Company: "posit",
+		Tags:    []string{"a"},
+		Rating:  1.5,
+	})
+	s.Assert().Nil(err)
+	s.Assert().Equal(123, sz)
+	s.Assert().Equal([]byte{
+		// Index version 3
+		0x0, 0x8, 0x33,
+		//
+		// Header
+		//
+		// Header size
+		0x10, 0x0, 0x0, 0x0,
+		// Min reader version
+		0x3, 0x0, 0x0, 0x0,
+		// Flags
+		0x1, 0x0, 0x0, 0x0,
+		// Float encoding
+		0x1, 0x0, 0x0, 0x0,
+		//
+		// Index
+		//
+		// Index size
+		0x36, 0x0, 0x0, 0x0,
+		// "company"
+		0x7, 0x0, 0x0, 0x0,
+		0x63, 0x6f, 0x6d, 0x70, 0x61, 0x6e, 0x79,
+		0x1, 0x0, 0x0, 0x0,
+		// "tags"
+		0x4, 0x0, 0x0, 0x0,
+		0x74, 0x61, 0x67, 0x73,
+		0x4, 0x0, 0x0, 0x0,
+		// not indexed
+		0x0,
+		// Array is string type
+		0x18, 0x0, 0x0, 0x0,
+		// zero subfields
+		0x0, 0x0, 0x0, 0x0,
+		// "rating"
+		0x6, 0x0, 0x0, 0x0,
+		0x72, 0x61, 0x74, 0x69, 0x6e, 0x67,
+		0x6, 0x0, 0x0, 0x0,
+		//
+		// Object
+		//
+		// Object size
+		0x32, 0x0, 0x0, 0x0,
+		//
+		// Field offsets
+		//
+		// Three fields
+		0x3, 0x0, 0x0, 0x0,
+		// "company" at offset 20
+		0x14, 0x0, 0x0, 0x0,
+		// "tags" at offset 29
+		0x1d, 0x0, 0x0, 0x0,
+		// "rating" at offset 42
+		0x2a, 0x0, 0x0, 0x0,
+		//
+		// Object data
+		//
+		// "posit"
+		0x5, 0x0, 0x0, 0x0,
+		0x70, 0x6f, 0x73, 0x69, 0x74,
+		// "tags" array size
+		0xd, 0x0, 0x0, 0x0,
+		// "tags" array length
+		0x1, 0x0, 0x0, 0x0,
+		// "a"
+		0x1, 0x0, 0x0, 0x0,
+		0x61,
+		// 1.5
+		0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xf8, 0x3f,
+	}, buf.Bytes())
+
+	// Header flags require Version3
+	w = NewWriterWithVersion(&bytes.Buffer{}, Version2, WithFieldOffsets())
+	_, err = w.WriteObject(headerTestObject{})
+	s.Assert().ErrorContains(err, "header flags require version 3 or later; writer version is 2")
+}
+
+func (s *WriterHeaderSuite) TestReadFieldOffsets() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithFieldOffsets())
+	for _, obj := range []headerTestObject{
+		{Company: "posit", Tags: []string{"a", "b"}, Rating: 1.5},
+		{Company: "rstudio", Rating: 2.5},
+	} {
+		_, err := w.WriteObject(obj)
+		s.Assert().Nil(err)
+	}
+	data := buf.Bytes()
+
+	r := NewReader()
+	b := bufio.NewReader(bytes.NewReader(data))
+	_, err := r.ReadIndex(b)
+	s.Assert().Nil(err)
+
+	// Jump directly to the "rating" field in each object
+	for _, expected := range []float64{1.5, 2.5} {
+		start := r.Pos()
+		sz, err := r.BeginObject(b)
+		s.Assert().Nil(err)
+		err = r.AdvanceTo(b, "rating")
+		s.Assert().Nil(err)
+		rating, err := r.ReadFloatField(b)
+		s.Assert().Nil(err)
+		s.Assert().Equal(expected, rating)
+		s.Assert().Equal(start+sz, r.Pos())
+	}
+
+	// Fields can still be read in order
+	r = NewReader()
+	b = bufio.NewReader(bytes.NewReader(data))
+	_, err = r.ReadIndex(b)
+	s.Assert().Nil(err)
+	_, err = r.BeginObject(b)
+	s.Assert().Nil(err)
+	err = r.AdvanceTo(b, "company")
+	s.Assert().Nil(err)
+	company, err := r.ReadStringField(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal("posit", company)
+	err = r.AdvanceTo(b, "rating")
+	s.Assert().Nil(err)
+	rating, err := r.ReadFloatField(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal(1.5, rating)
+
+	// Print
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(bytes.NewReader(data)))
+	s.Require().Nil(err)
+	s.Require().Equal(`
+-----------------------------------------
+                Object[1]                
+-----------------------------------------
+company (string): posit
+tags (array(2)):
+    -a
+    -b
+rating (float): 1.500000
+
+-----------------------------------------
+                Object[2]                
+-----------------------------------------
+company (string): rstudio
+tags (array(0)):
+rating (float): 2.500000
+`, "\n"+pbuf.String())
+}
+
+func (s *WriterHeaderSuite) TestFieldHashes() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithFieldHashes())
+	_, err := w.WriteObject(headerTestObject{
+		Company: "posit",
+		Tags:    []string{"a"},
+		Rating:  1.5,
+	})
+	s.Assert().Nil(err)
+	data := buf.Bytes()
+
+	// Flags for both offsets and hashes
+	s.Assert().Equal([]byte{0x3, 0x0, 0x0, 0x0}, data[11:15])
+	// Field offset table: three entries with hashes
+	s.Assert().Equal([]byte{
+		// Object size
+		0x3e, 0x0, 0x0, 0x0,
+		// Three fields
+		0x3, 0x0, 0x0, 0x0,
+		// "company" hash and offset
+		0xbc, 0xe8, 0x62, 0xaa,
+		0x20, 0x0, 0x0, 0x0,
+		// "tags" hash and offset
+		0xa0, 0xeb, 0x16, 0xf4,
+		0x29, 0x0, 0x0, 0x0,
+		// "rating" hash and offset
+		0x50, 0x10, 0x89, 0xf2,
+		0x36, 0x0, 0x0, 0x0,
+	}, data[73:105])
+	s.Assert().Equal(uint32(0xaa62e8bc), FieldHash("company"))
+
+	// A reader using a reordered struct index can locate fields by name.
+	type reordered struct {
+		Rating  float64 `rsf:"rating"`
+		Company string  `rsf:"company"`
+	}
+	ibuf := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(ibuf, Version3).WriteObject(reordered{})
+	s.Assert().Nil(err)
+	index, err := NewReader().ReadIndex(ibuf)
+	s.Assert().Nil(err)
+
+	r := NewReader()
+	b := bufio.NewReader(bytes.NewReader(data))
+	_, err = r.ReadIndex(b)
+	s.Assert().Nil(err)
+	r.SetIndex(index)
+	_, err = r.BeginObject(b)
+	s.Assert().Nil(err)
+	err = r.AdvanceTo(b, "company")
+	s.Assert().Nil(err)
+	company, err := r.ReadStringField(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal("posit", company)
+	err = r.AdvanceTo(b, "rating")
+	s.Assert().Nil(err)
+	rating, err := r.ReadFloatField(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal(1.5, rating)
+
+	// Cannot move backwards
+	err = r.AdvanceTo(b, "company")
+	s.Assert().ErrorContains(err, "cannot advance to field company at position 105 from position 135")
+
+	// Random access by name
+	ra := bytes.NewReader(data)
+	obj, err := OpenObject(ra)
+	s.Assert().Nil(err)
+	val, err := ReadFieldAt(ra, obj, "tags")
+	s.Assert().Nil(err)
+	s.Assert().Equal([]any{"a"}, val)
+	val, err = ReadFieldAt(ra, obj, "rating")
+	s.Assert().Nil(err)
+	s.Assert().Equal(1.5, val)
+}
+
+func (s *WriterHeaderSuite) TestMinReaderVersion() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithMinReaderVersion(5))
+	_, err := w.WriteObject(headerTestObject{Company: "posit"})
+	s.Assert().Nil(err)
+	data := buf.Bytes()
+	s.Assert().Equal([]byte{0x5, 0x0, 0x0, 0x0}, data[7:11])
+
+	// The reader fails when reading the index.
+	_, err = NewReader().ReadIndex(bytes.NewReader(data))
+	var versionErr ErrUnsupportedVersion
+	s.Require().ErrorAs(err, &versionErr)
+	s.Assert().Equal(ErrUnsupportedVersion{Need: 5, Have: ReaderVersion}, versionErr)
+	s.Assert().EqualError(err, "file requires reader version 5 or later; this reader supports version 3")
+
+	_, err = OpenObject(bytes.NewReader(data))
+	s.Assert().ErrorAs(err, &versionErr)
+
+	// A lower minimum reader version has no effect.
+	buf.Reset()
+	w = NewWriterWithVersion(buf, Version3, WithMinReaderVersion(2))
+	_, err = w.WriteObject(headerTestObject{Company: "posit"})
+	s.Assert().Nil(err)
+	s.Assert().Equal([]byte{0x3, 0x0, 0x0, 0x0}, buf.Bytes()[7:11])
+	_, err = NewReader().ReadIndex(bytes.NewReader(buf.Bytes()))
+	s.Assert().Nil(err)
+
+	// A newer index version is also unsupported.
+	_, err = NewReader().ReadIndex(bytes.NewReader([]byte{0x0, 0x8, 0x34, 0xc, 0x0, 0x0, 0x0}))
+	s.Assert().ErrorAs(err, &versionErr)
+	s.Assert().Equal(ErrUnsupportedVersion{Need: 4, Have: ReaderVersion}, versionErr)
+}
+
+func (s *WriterHeaderSuite) TestHeaderFeatures() {
+	// Version2 files have no header
+	r := NewReader()
+	_, err := r.ReadIndex(getData(&s.Suite))
+	s.Assert().Nil(err)
+	s.Assert().Equal(Header{Version: 2, MinReaderVersion: 2, FloatEncoding: FloatIEEE754}, r.Header())
+	s.Assert().Empty(r.Header().Features())
+
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithFieldHashes())
+	_, err = w.WriteObject(headerTestObject{Company: "posit"})
+	s.Assert().Nil(err)
+	data := buf.Bytes()
+	r = NewReader()
+	_, err = r.ReadIndex(bytes.NewReader(data))
+	s.Assert().Nil(err)
+	s.Assert().Equal(Header{Version: 3, MinReaderVersion: 3, Flags: FlagFieldOffsets | FlagFieldHashes, FloatEncoding: FloatIEEE754}, r.Header())
+	s.Assert().Equal([]string{"field-offsets", "field-hashes"}, r.Header().Features())
+
+	pbuf := &bytes.Buffer{}
+	err = PrintHeader(pbuf, bufio.NewReader(bytes.NewReader(data)))
+	s.Assert().Nil(err)
+	s.Assert().Equal("version: 3\nmin reader version: 3\nfeatures: field-offsets, field-hashes\n", pbuf.String())
+
+	// Unsupported features are detected when reading the index.
+	buf.Reset()
+	w = NewWriterWithVersion(buf, Version3)
+	w.(*rsfWriter).flags = FlagStringTable | 1<<30
+	_, err = w.WriteObject(headerTestObject{Company: "posit"})
+	s.Assert().Nil(err)
+	_, err = NewReader().ReadIndex(bytes.NewReader(buf.Bytes()))
+	var featureErr ErrUnsupportedFeature
+	s.Require().ErrorAs(err, &featureErr)
+	s.Assert().Equal(FlagStringTable|1<<30, featureErr.Flags)
+	s.Assert().EqualError(err, "file uses unsupported features: string-table, unknown(30)")
+
+	pbuf.Reset()
+	err = PrintHeader(pbuf, bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	s.Assert().ErrorContains(err, "error reading index: file uses unsupported features")
+}
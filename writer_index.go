@@ -59,19 +59,58 @@ Example:
 */
 
 const (
-	FieldTypeVarStr   = 1
-	FieldTypeFixedStr = 2
-	FieldTypeBool     = 3
-	FieldTypeArray    = 4
-	FieldTypeFloat    = 6
-	FieldTypeInt64    = 7
+	FieldTypeVarStr     = 1
+	FieldTypeFixedStr   = 2
+	FieldTypeBool       = 3
+	FieldTypeArray      = 4
+	FieldTypeFloat      = 6
+	FieldTypeInt64      = 7
+	FieldTypeChunked    = 8
+	FieldTypeExpiry     = 9
+	FieldTypeDeleted    = 10
+	FieldTypeProvenance = 11
+	FieldTypeSegmented  = 12
+	FieldTypeStruct     = 13
+	FieldTypeMap        = 14
+	FieldTypeTime       = 15
+	FieldTypeBytes      = 16
+	FieldTypeUint64     = 17
+	FieldTypeInt        = 18
+	FieldTypeFloat32    = 19
 )
 
 func (f *rsfWriter) writeIndexObject(v reflect.Type, t *tag, buf *bytes.Buffer) (int, error) {
+	if v.Kind() == reflect.Pointer {
+		return f.writeIndexPointer(v, t, buf)
+	}
+	if isMarshaler(v) {
+		return f.writeIndexMarshaler(t, buf)
+	}
+	if v == timeType {
+		return f.writeIndexTime(t, buf)
+	}
+	if isBytes(v) {
+		return f.writeIndexBytes(t, buf)
+	}
+	if t.intWidth > 0 {
+		return f.writeIndexNarrowInt(v, t, buf)
+	}
+	if t.expires {
+		return f.writeIndexExpiry(v, t, buf)
+	}
+	if t.deleted {
+		return f.writeIndexDeleted(v, t, buf)
+	}
+
 	switch v.Kind() {
 	case reflect.Array, reflect.Slice:
 		return f.writeIndexArray(v, t, buf)
+	case reflect.Map:
+		return f.writeIndexMap(v, t, buf)
 	case reflect.Struct:
+		if t.nested && f.version > 2 {
+			return f.writeIndexNested(v, t, buf)
+		}
 		sz, _, err := f.writeIndexStruct(v, t, buf)
 		return sz, err
 	case reflect.String:
@@ -80,8 +119,10 @@ func (f *rsfWriter) writeIndexObject(v reflect.Type, t *tag, buf *bytes.Buffer)
 		return f.writeIndexFixed(t, FieldTypeBool, buf)
 	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
 		return f.writeIndexFixed(t, FieldTypeInt64, buf)
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return f.writeIndexUnsigned(t, buf)
 	case reflect.Float32, reflect.Float64:
-		return f.writeIndexFixed(t, FieldTypeFloat, buf)
+		return f.writeIndexFloat(v, t, buf)
 	default:
 		return 0, fmt.Errorf("unknown field type %#v: %#v", v.Kind(), v)
 	}
@@ -96,6 +137,14 @@ func (f *rsfWriter) writeIndexStruct(v reflect.Type, tParent *tag, buf *bytes.Bu
 		if err != nil {
 			return 0, 0, err
 		}
+		err = f.checkSensitive(t, tParent)
+		if err != nil {
+			return 0, 0, err
+		}
+		err = f.useOmitEmpty(t, tParent)
+		if err != nil {
+			return 0, 0, err
+		}
 
 		if !skip {
 			var sz int
@@ -119,14 +168,37 @@ func (f *rsfWriter) writeIndexArray(v reflect.Type, t *tag, buf *bytes.Buffer) (
 	}
 	totalSz += sz
 
-	sz, err = f.WriteSizeField(0, FieldTypeArray, buf)
+	el := v.Elem()
+	if el == timeType || isMarshaler(el) {
+		return 0, fmt.Errorf("array %s has unsupported element type %s", t.name, el)
+	}
+	if isNestedArray(el) {
+		err = checkNestedArray(t)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if isUnsigned(el.Kind()) {
+		err = f.useUnsigned(t)
+		if err != nil {
+			return 0, err
+		}
+	}
+	fieldType := FieldTypeArray
+	if t.segment != "" {
+		err = f.checkSegments(el, t)
+		if err != nil {
+			return 0, err
+		}
+		fieldType = FieldTypeSegmented
+	}
+
+	sz, err = f.WriteSizeField(0, f.indexFieldType(t, fieldType), buf)
 	if err != nil {
 		return 0, err
 	}
 	totalSz += sz
 
-	el := v.Elem()
-
 	// For an indexed struct array, find the index size
 	if f.version > 1 {
 		if el.Kind() == reflect.Struct && t.index != "" {
@@ -137,12 +209,31 @@ func (f *rsfWriter) writeIndexArray(v reflect.Type, t *tag, buf *bytes.Buffer) (
 			totalSz += sz
 
 			// Calculate the index field size. This can be done simply by getting the tag
-			// info for each subfield.
-			for i := 0; i < el.NumField(); i++ {
-				subT := &tag{}
-				_, err = getTagInfo(el, i, subT, t, "")
-				if err != nil {
-					return 0, err
+			// info for each subfield. The size is already known for arrays
+			// written with `WriteArrayFromChannel`, which have no key fields.
+			var keys []indexKey
+			if t.indexSz == 0 {
+				for i := 0; i < el.NumField(); i++ {
+					subT := &tag{}
+					_, err = getTagInfo(el, i, subT, t, "")
+					if err != nil {
+						return 0, err
+					}
+				}
+
+				if t.keys != nil {
+					// A composite key is written as a fixed-size string
+					// that contains each key field.
+					for _, key := range t.keys {
+						if key.size == 0 {
+							return 0, fmt.Errorf("could not calculate indexed field %s size for array %s", t.index, t.name)
+						}
+						t.indexSz += key.size
+					}
+					t.indexType = int(reflect.String)
+					keys = t.keys
+				} else {
+					keys = []indexKey{{name: t.index, size: t.indexSz, kind: t.indexType}}
 				}
 			}
 
@@ -164,6 +255,16 @@ func (f *rsfWriter) writeIndexArray(v reflect.Type, t *tag, buf *bytes.Buffer) (
 				return 0, err
 			}
 			totalSz += sz
+
+			// Write the key fields so that readers can populate them,
+			// since they are often skipped.
+			if f.version > 2 {
+				sz, err = f.writeIndexKeys(keys, buf)
+				if err != nil {
+					return 0, err
+				}
+				totalSz += sz
+			}
 		} else {
 			sz, err = f.WriteBoolField(0, false, buf)
 			if err != nil {
@@ -182,11 +283,28 @@ func (f *rsfWriter) writeIndexArray(v reflect.Type, t *tag, buf *bytes.Buffer) (
 		if err != nil {
 			return 0, err
 		}
+
+		// Elements with provenance include it following the other
+		// fields.
+		if f.hasProvenance(el) {
+			_, err = f.writeIndexFixed(&tag{name: provenanceField}, FieldTypeProvenance, subfieldsBuf)
+			if err != nil {
+				return 0, err
+			}
+			subfields++
+		}
+	} else if isNestedArray(el) && f.version > 2 {
+		// Describe the element arrays with an unnamed entry.
+		_, err = f.writeIndexArray(el, &tag{}, subfieldsBuf)
+		if err != nil {
+			return 0, err
+		}
+		subfields = 1
 	}
 
 	// Write the array type field
 	if f.version > 1 {
-		sz, err = f.WriteSizeField(0, int(el.Kind()), buf)
+		sz, err = f.WriteSizeField(0, f.elementKind(el), buf)
 		if err != nil {
 			return 0, err
 		}
@@ -213,7 +331,35 @@ func (f *rsfWriter) writeIndexArray(v reflect.Type, t *tag, buf *bytes.Buffer) (
 	return totalSz, err
 }
 
+// writeIndexKeys writes the name, type, and size of each field of an array
+// index key. See `IndexKey`.
+func (f *rsfWriter) writeIndexKeys(keys []indexKey, buf *bytes.Buffer) (int, error) {
+	pos, err := f.WriteSizeField(0, len(keys), buf)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		pos, err = f.WriteStringField(pos, key.name, buf)
+		if err != nil {
+			return 0, err
+		}
+		pos, err = f.WriteSizeField(pos, key.kind, buf)
+		if err != nil {
+			return 0, err
+		}
+		pos, err = f.WriteSizeField(pos, key.size, buf)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return pos, nil
+}
+
 func (f *rsfWriter) writeIndexString(t *tag, buf *bytes.Buffer) (int, error) {
+	if t.chunked {
+		return f.writeIndexFixed(t, FieldTypeChunked, buf)
+	}
+
 	if t.fixed > 0 {
 		sz, err := f.writeIndexFixed(t, FieldTypeFixedStr, buf)
 		if err != nil {
@@ -231,7 +377,7 @@ func (f *rsfWriter) writeIndexString(t *tag, buf *bytes.Buffer) (int, error) {
 	}
 	totalSz += sz
 
-	sz, err = f.WriteSizeField(0, FieldTypeVarStr, buf)
+	sz, err = f.WriteSizeField(0, f.indexFieldType(t, FieldTypeVarStr), buf)
 	if err != nil {
 		return 0, err
 	}
@@ -240,6 +386,34 @@ func (f *rsfWriter) writeIndexString(t *tag, buf *bytes.Buffer) (int, error) {
 	return totalSz, err
 }
 
+// writeIndexExpiry writes the index entry of an element expiry field. Expiry
+// fields are written as integers, and are recorded in the index with
+// `FieldTypeExpiry` by Version3 and later. See `WithDropExpired`.
+func (f *rsfWriter) writeIndexExpiry(v reflect.Type, t *tag, buf *bytes.Buffer) (int, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+	default:
+		return 0, fmt.Errorf("expires field %s must be an integer", t.name)
+	}
+	if f.version < 3 {
+		return f.writeIndexFixed(t, FieldTypeInt64, buf)
+	}
+	return f.writeIndexFixed(t, FieldTypeExpiry, buf)
+}
+
+// writeIndexDeleted writes the index entry of an element tombstone field.
+// Tombstone fields are written as bools, and are recorded in the index with
+// `FieldTypeDeleted` by Version3 and later. See `WithDeleted`.
+func (f *rsfWriter) writeIndexDeleted(v reflect.Type, t *tag, buf *bytes.Buffer) (int, error) {
+	if v.Kind() != reflect.Bool {
+		return 0, fmt.Errorf("deleted field %s must be a bool", t.name)
+	}
+	if f.version < 3 {
+		return f.writeIndexFixed(t, FieldTypeBool, buf)
+	}
+	return f.writeIndexFixed(t, FieldTypeDeleted, buf)
+}
+
 func (f *rsfWriter) writeIndexFixed(t *tag, fieldType int, buf *bytes.Buffer) (int, error) {
 	var totalSz int
 	sz, err := f.WriteStringField(0, t.name, buf)
@@ -248,7 +422,7 @@ func (f *rsfWriter) writeIndexFixed(t *tag, fieldType int, buf *bytes.Buffer) (i
 	}
 	totalSz += sz
 
-	sz, err = f.WriteSizeField(0, fieldType, buf)
+	sz, err = f.WriteSizeField(0, f.indexFieldType(t, fieldType), buf)
 	if err != nil {
 		return 0, err
 	}
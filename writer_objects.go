@@ -3,77 +3,254 @@ package rsf
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var ErrInvalidIndexFieldType = errors.New("invalid index field type")
 
+var ErrFinalized = errors.New("writer is finalized")
+
+// ErrElementTooLarge is returned when an array element exceeds the limit set
+// with `WithMaxElementSize`.
+type ErrElementTooLarge struct {
+	// The array name and element position
+	Array string
+	Index int
+	// The element size and the limit
+	Size int
+	Max  int
+}
+
+func (e ErrElementTooLarge) Error() string {
+	return fmt.Sprintf("array %s element %d size %d exceeds maximum element size %d", e.Array, e.Index, e.Size, e.Max)
+}
+
 func (f *rsfWriter) WriteObject(v any) (int, error) {
-	var indexBuf = &bytes.Buffer{}
+	err := f.checkWritable()
+	if err != nil {
+		return 0, err
+	}
+	indexSz, sz, err := f.writeTopLevelObject(v)
+	if err != nil {
+		return 0, err
+	}
+	return indexSz + sz, nil
+}
+
+// writeTopLevelObject writes the index, if needed, followed by the object
+// record of `v`, and returns the size of each.
+func (f *rsfWriter) writeTopLevelObject(v any) (int, int, error) {
 	var indexSz int
-	var totalSz int
 	var err error
-	var sz int
 	if f.pos == 0 && reflect.TypeOf(v).Kind() == reflect.Struct {
-		if f.version > 1 {
-			// Write the index version first
-			sz, err = f.writer.Write(IndexVersion2)
-			if err != nil {
-				return 0, err
-			}
-			totalSz += sz
+		indexSz, err = f.writeIndexRecord(func(buf *bytes.Buffer) (int, error) {
+			return f.writeIndexObject(reflect.TypeOf(v), &tag{}, buf)
+		})
+		if err != nil {
+			return 0, 0, err
 		}
+	}
 
-		indexSz, err = f.writeIndexObject(reflect.TypeOf(v), &tag{}, indexBuf)
+	buf, offsets, err := f.encodeObject(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	record, err := f.encodeRecord(buf, offsets)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Drop array elements to fit the size budget, if allowed. See
+	// `WithMaxSize`.
+	if f.maxSize > 0 && f.onOverBudget != nil && f.overBudget(record.Len()) {
+		record, err = f.trimObject(v, record.Len())
 		if err != nil {
-			return 0, err
+			return 0, 0, err
 		}
-		totalSz += indexSz
+	}
 
-		// Write index size
-		bs := make([]byte, sizeFieldLen)
-		indexRecordSize := indexBuf.Len() + sizeFieldLen
-		binary.LittleEndian.PutUint32(bs, uint32(indexRecordSize))
-		sz, err = f.writer.Write(bs)
+	sz, err := f.writeEncodedRecord(record)
+	if err != nil {
+		return 0, 0, err
+	}
+	return indexSz, sz, nil
+}
+
+// encodeObject encodes the data of the top-level object `v`. For structs,
+// the offset of each top-level field is also returned when the header
+// includes FlagFieldOffsets.
+func (f *rsfWriter) encodeObject(v any) (*bytes.Buffer, []fieldOffset, error) {
+	var err error
+	var buf = &bytes.Buffer{}
+	var offsets []fieldOffset
+	if f.headerFlags&FlagFieldOffsets != 0 {
+		// Record the offset of each top-level field.
+		offsets = make([]fieldOffset, 0)
+		if reflect.TypeOf(v).Kind() == reflect.Struct {
+			_, err = f.writeStructFields(reflect.ValueOf(v), &tag{}, buf, &offsets)
+		} else {
+			_, err = f.writeObject(reflect.ValueOf(v), &tag{}, buf)
+		}
+	} else {
+		_, err = f.writeObject(reflect.ValueOf(v), &tag{}, buf)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf, offsets, nil
+}
+
+// checkWritable returns an error if no more objects can be written.
+func (f *rsfWriter) checkWritable() error {
+	if f.finalized {
+		return ErrFinalized
+	}
+	if f.openArray {
+		return ErrArrayOpen
+	}
+	if f.pos == 0 && f.canonical {
+		return f.checkCanonical()
+	}
+	return nil
+}
+
+// writeIndexRecord writes the index version and file header, if needed, and
+// the index record that precedes the first object. `writeIndex` writes the
+// index entries to a buffer.
+func (f *rsfWriter) writeIndexRecord(writeIndex func(buf *bytes.Buffer) (int, error)) (int, error) {
+	// Write the index entries to a buffer, since the index size precedes
+	// them.
+	var indexBuf = &bytes.Buffer{}
+	indexSz, err := writeIndex(indexBuf)
+	if err != nil {
+		return 0, err
+	}
+
+	// Buffer the record so that the size budget can be checked before
+	// writing. See `WithMaxSize`.
+	record := &bytes.Buffer{}
+	if f.version > 2 {
+		// Write the index version and file header first
+		_, err = f.writeHeader(record)
 		if err != nil {
 			return 0, err
 		}
-		totalSz += sz
-
-		// Write index
-		_, err = io.Copy(f.writer, indexBuf)
+	} else if f.flags != 0 {
+		return 0, fmt.Errorf("header flags require version %d or later; writer version is %d", Version3, f.version)
+	} else if f.version > 1 {
+		// Write the index version first
+		_, err = record.Write(IndexVersion2)
 		if err != nil {
 			return 0, err
 		}
 	}
+	totalSz := record.Len() + indexSz
 
-	var buf = &bytes.Buffer{}
-	var objectSz int
-	objectSz, err = f.writeObject(reflect.ValueOf(v), &tag{}, buf)
+	// Write index size
+	bs := make([]byte, sizeFieldLen)
+	indexRecordSize := indexBuf.Len() + sizeFieldLen
+	f.byteOrder().PutUint32(bs, uint32(indexRecordSize))
+	sz, err := record.Write(bs)
+	if err != nil {
+		return 0, err
+	}
+	totalSz += sz
+
+	// Write index
+	_, err = io.Copy(record, indexBuf)
 	if err != nil {
 		return 0, err
 	}
-	totalSz += objectSz
 
-	// Write size of full record
-	bs := make([]byte, sizeFieldLen)
-	recordSize := buf.Len() + sizeFieldLen
-	binary.LittleEndian.PutUint32(bs, uint32(recordSize))
-	sz, err = f.writer.Write(bs)
+	err = f.checkBudget(record.Len())
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(f.writer, record)
 	if err != nil {
 		return 0, err
 	}
-	totalSz += sz
+
+	return totalSz, nil
+}
+
+// writeRecord writes a top-level object record containing the object data in
+// `buf`. When `offsets` is not nil, the record includes a field offset table.
+// The payload is encoded when using layers.
+func (f *rsfWriter) writeRecord(buf *bytes.Buffer, offsets []fieldOffset) (int, error) {
+	record, err := f.encodeRecord(buf, offsets)
+	if err != nil {
+		return 0, err
+	}
+	return f.writeEncodedRecord(record)
+}
+
+// encodeRecord encodes a top-level object record containing the object data in
+// `buf`. See `writeRecord`.
+func (f *rsfWriter) encodeRecord(buf *bytes.Buffer, offsets []fieldOffset) (*bytes.Buffer, error) {
+	var err error
+
+	// Build the field offset table, if needed.
+	var offsetsBuf = &bytes.Buffer{}
+	if offsets != nil {
+		_, err = f.writeFieldOffsets(offsets, offsetsBuf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Encode the payload, if needed.
+	if f.headerFlags&FlagLayers != 0 {
+		var payload []byte
+		payload, err = encodeLayers(f.layers, append(offsetsBuf.Bytes(), buf.Bytes()...))
+		if err != nil {
+			return nil, err
+		}
+		offsetsBuf.Reset()
+		buf = bytes.NewBuffer(payload)
+	}
+
+	// Write size of full record
+	record := &bytes.Buffer{}
+	recordSize := buf.Len() + offsetsBuf.Len() + sizeFieldLen
+	_, err = f.WriteSizeField(0, recordSize, record)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write the field offset table
+	_, err = io.Copy(record, offsetsBuf)
+	if err != nil {
+		return nil, err
+	}
 
 	// Write initial buffer. This includes the name and the number
 	// of snapshots.
-	_, err = io.Copy(f.writer, buf)
+	_, err = io.Copy(record, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// writeEncodedRecord writes a record encoded by `encodeRecord`.
+func (f *rsfWriter) writeEncodedRecord(record *bytes.Buffer) (int, error) {
+	err := f.checkBudget(record.Len())
+	if err != nil {
+		return 0, err
+	}
+
+	if f.headerFlags&FlagObjectTable != 0 {
+		f.objects = append(f.objects, objectTableEntry{offset: int64(f.counter.Pos()), size: record.Len()})
+	}
+	sz, err := io.Copy(f.writer, record)
 	if err != nil {
 		return 0, err
 	}
@@ -81,22 +258,86 @@ func (f *rsfWriter) WriteObject(v any) (int, error) {
 	// Increment once per object
 	f.pos++
 
-	return totalSz, nil
+	return int(sz), nil
+}
+
+// fieldOffset records the name and buffer offset of a top-level field.
+type fieldOffset struct {
+	name   string
+	offset int
+}
+
+// writeFieldOffsets writes a table of field offsets. See `writeHeader`. The
+// offsets in `offsets` are relative to the start of the object data, so they
+// are adjusted to be relative to the start of the record, which includes the
+// record size field and the table itself.
+func (f *rsfWriter) writeFieldOffsets(offsets []fieldOffset, buf *bytes.Buffer) (int, error) {
+	hashes := f.headerFlags&FlagFieldHashes != 0
+	entrySz := sizeFieldLen
+	if hashes {
+		entrySz += sizeFieldLen
+	}
+	tableSz := sizeFieldLen + entrySz*len(offsets)
+
+	pos, err := f.WriteSizeField(0, len(offsets), buf)
+	if err != nil {
+		return 0, err
+	}
+	for _, offset := range offsets {
+		if hashes {
+			pos, err = f.WriteSizeField(pos, int(FieldHash(offset.name)), buf)
+			if err != nil {
+				return 0, err
+			}
+		}
+		pos, err = f.WriteSizeField(pos, sizeFieldLen+tableSz+offset.offset, buf)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return pos, nil
 }
 
 func (f *rsfWriter) writeObject(v reflect.Value, t *tag, buf *bytes.Buffer) (int, error) {
+	if v.Kind() != reflect.Pointer && isMarshaler(v.Type()) {
+		return f.writeMarshaler(v, t, buf)
+	}
 	switch v.Type().Kind() {
+	case reflect.Pointer:
+		return f.writePointer(v, t, buf)
 	case reflect.Array, reflect.Slice:
+		if isBytes(v.Type()) {
+			return f.writeBytes(v.Bytes(), t, buf)
+		}
 		return f.writeArray(v, t, buf)
+	case reflect.Map:
+		return f.writeMap(v, t, buf)
 	case reflect.Struct:
+		if v.Type() == timeType {
+			if !v.CanInterface() {
+				return 0, fmt.Errorf("time field %s must be exported", t.name)
+			}
+			return f.writeTime(v.Interface().(time.Time), t, buf)
+		}
+		if t.nested && f.version > 2 {
+			return f.writeNested(v, t, buf)
+		}
 		return f.writeStruct(v, t, buf)
 	case reflect.String:
 		return f.writeString(v.String(), t, buf)
 	case reflect.Bool:
 		return f.WriteBoolField(0, v.Bool(), buf)
 	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		if t.intWidth > 0 && f.version > 2 {
+			return f.writeNarrowInt(v.Int(), t, buf)
+		}
 		return f.WriteInt64Field(0, v.Int(), buf)
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return f.WriteUint64Field(0, v.Uint(), buf)
 	case reflect.Float32, reflect.Float64:
+		if v.Kind() == reflect.Float32 && f.version > 2 {
+			return f.WriteFloat32Field(0, float32(v.Float()), buf)
+		}
 		return f.WriteFloatField(0, v.Float(), buf)
 	default:
 		return 0, fmt.Errorf("unknown field type %#v: %#v", v.Type().Kind(), v)
@@ -104,6 +345,12 @@ func (f *rsfWriter) writeObject(v reflect.Value, t *tag, buf *bytes.Buffer) (int
 }
 
 func (f *rsfWriter) writeStruct(v reflect.Value, tParent *tag, buf *bytes.Buffer) (int, error) {
+	return f.writeStructFields(v, tParent, buf, nil)
+}
+
+// writeStructFields writes the fields of a struct. When `offsets` is not nil,
+// the buffer offset of each written field is appended to it.
+func (f *rsfWriter) writeStructFields(v reflect.Value, tParent *tag, buf *bytes.Buffer, offsets *[]fieldOffset) (int, error) {
 	var totalSz int
 	for i := 0; i < v.NumField(); i++ {
 		t := &tag{}
@@ -118,14 +365,21 @@ func (f *rsfWriter) writeStruct(v reflect.Value, tParent *tag, buf *bytes.Buffer
 			fieldVal = v.Field(i).Int()
 		}
 
-		skip, err := getTagInfo(v.Type(), i, t, tParent, fieldVal)
+		skip, err := f.tagInfo(v.Type(), i, t, tParent, fieldVal)
 		if err != nil {
 			return 0, err
 		}
 
 		if !skip {
+			if offsets != nil {
+				*offsets = append(*offsets, fieldOffset{name: t.name, offset: buf.Len()})
+			}
 			var sz int
-			sz, err = f.writeObject(v.Field(i), t, buf)
+			if t.omitEmpty && f.version > 2 {
+				sz, err = f.writeOmitEmpty(v.Field(i), t, buf)
+			} else {
+				sz, err = f.writeObject(v.Field(i), t, buf)
+			}
 			if err != nil {
 				return 0, err
 			}
@@ -136,93 +390,224 @@ func (f *rsfWriter) writeStruct(v reflect.Value, tParent *tag, buf *bytes.Buffer
 }
 
 func getTagInfo(v reflect.Type, index int, t, tParent *tag, fieldVal any) (bool, error) {
+	skip, tagged, err := parseTag(v, index, t)
+	if err != nil || !tagged {
+		return skip, err
+	}
+	setParentTag(v, index, t, tParent, fieldVal)
+	return skip, nil
+}
+
+// parseTag parses the `rsf` struct tag of the field `index` of the struct type
+// `v` into `t`. `tagged` is false if the field is ignored or has no tag.
+func parseTag(v reflect.Type, index int, t *tag) (skip bool, tagged bool, err error) {
 	// Get the field tag value
 	rawTag := v.Field(index).Tag.Get(tagName)
 	if rawTag == rsfIgnore {
-		return true, nil
+		return true, false, nil
+	}
+	if rawTag == "" {
+		return false, false, nil
 	}
 
-	var skip bool
-	if rawTag != "" {
-		tagParts := strings.Split(rawTag, rsfDelim)
-		t.name = tagParts[0]
-		for j := 1; j < len(tagParts); j++ {
-			part := strings.TrimSpace(strings.ToLower(tagParts[j]))
-			if part == rsfSkip {
-				skip = true
-			}
-			if strings.HasPrefix(part, rsfIndex+rsfSep) && len(part) > 6 {
-				indexParts := strings.Split(part, rsfSep)
-				t.index = indexParts[1]
-			}
-			if strings.HasPrefix(part, rsfFixed+rsfSep) && len(part) > 6 {
-				fixedParts := strings.Split(part, rsfSep)
-				var err error
-				t.fixed, err = strconv.Atoi(fixedParts[1])
-				if err != nil {
-					return false, err
-				}
-			}
+	tagParts := strings.Split(rawTag, rsfDelim)
+	t.name = tagParts[0]
+	t.nested = nested(v, index, t.name)
+	for j := 1; j < len(tagParts); j++ {
+		part := strings.TrimSpace(strings.ToLower(tagParts[j]))
+		if part == rsfSkip {
+			skip = true
+		}
+		if part == rsfChunked {
+			t.chunked = true
+		}
+		if part == rsfExpires {
+			t.expires = true
+		}
+		if part == rsfDeleted {
+			t.deleted = true
 		}
-		if tParent.index == t.name {
-			tParent.indexVal = fieldVal
-			switch v.Field(index).Type.Kind() {
-			case reflect.String:
-				tParent.indexSz = t.fixed
-				tParent.indexType = int(reflect.String)
-			case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
-				tParent.indexSz = sizeInt64
-				tParent.indexType = int(reflect.Int64)
+		if part == rsfSensitive {
+			t.sensitive = true
+		}
+		if part == rsfOmitEmpty {
+			t.omitEmpty = v.Field(index).Type.Kind() != reflect.Pointer
+		}
+		if strings.HasPrefix(part, rsfIndex+rsfSep) && len(part) > 6 {
+			indexParts := strings.Split(part, rsfSep)
+			t.index = indexParts[1]
+		}
+		if strings.HasPrefix(part, rsfSegment+rsfSep) && len(part) > 8 {
+			segmentParts := strings.Split(part, rsfSep)
+			t.segment = segmentParts[1]
+		}
+		if width, ok := intWidths[part]; ok {
+			t.intWidth = width
+		}
+		if strings.HasPrefix(part, rsfTime+rsfSep) && len(part) > 5 {
+			timeParts := strings.Split(part, rsfSep)
+			t.timeFormat = timeParts[1]
+		}
+		if strings.HasPrefix(part, rsfFixed+rsfSep) && len(part) > 6 {
+			fixedParts := strings.Split(part, rsfSep)
+			t.fixed, err = strconv.Atoi(fixedParts[1])
+			if err != nil {
+				return false, false, err
 			}
 		}
 	}
-	return skip, nil
+	return skip, true, nil
+}
+
+// setParentTag records the expiry and array index key of the parent struct
+// `tParent` when the field `index`, whose tag is `t`, provides them.
+func setParentTag(v reflect.Type, index int, t, tParent *tag, fieldVal any) {
+	if t.expires {
+		if val, ok := fieldVal.(int64); ok {
+			tParent.expiresAt = val
+		}
+	}
+	if tParent.index == t.name {
+		tParent.indexVal = fieldVal
+		switch v.Field(index).Type.Kind() {
+		case reflect.String:
+			tParent.indexSz = t.fixed
+			tParent.indexType = int(reflect.String)
+		case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+			tParent.indexSz = sizeInt64
+			tParent.indexType = int(reflect.Int64)
+		}
+	} else if i := tParent.keyPos(t.name); i >= 0 {
+		key := indexKey{name: t.name, val: fieldVal}
+		switch v.Field(index).Type.Kind() {
+		case reflect.String:
+			key.size = t.fixed
+			key.kind = int(reflect.String)
+		case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+			key.size = sizeInt64
+			key.kind = int(reflect.Int64)
+		}
+		tParent.keys[i] = key
+	}
+}
+
+// keyPos returns the position of `name` in a composite array index key, or -1
+// if the index is not composite or does not include `name`.
+func (t *tag) keyPos(name string) int {
+	if !strings.Contains(t.index, rsfKeySep) {
+		return -1
+	}
+	names := strings.Split(t.index, rsfKeySep)
+	if t.keys == nil {
+		t.keys = make([]indexKey, len(names))
+	}
+	for i := range names {
+		if names[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// compositeKey encodes the fields of a composite array index key, which is
+// written as a fixed-size string containing each encoded field. The index size
+// is updated to match.
+func (f *rsfWriter) compositeKey(t *tag) (string, error) {
+	buf := &bytes.Buffer{}
+	var err error
+	for _, key := range t.keys {
+		switch v := key.val.(type) {
+		case string:
+			_, err = f.WriteFixedStringField(0, key.size, v, buf)
+		case int64:
+			_, err = f.writeIntKey(v, buf)
+		default:
+			err = ErrInvalidIndexFieldType
+		}
+		if err != nil {
+			return "", fmt.Errorf("error writing index key field %s: %w", key.name, err)
+		}
+	}
+	t.indexSz = buf.Len()
+	return buf.String(), nil
 }
 
 func (f *rsfWriter) writeArray(v reflect.Value, t *tag, buf *bytes.Buffer) (int, error) {
+	if t.segment != "" {
+		return f.writeSegments(v, t, buf)
+	}
+
+	// Only the elements of top-level arrays are ordered by priority or
+	// dropped to fit the size budget. See `trimObject`.
+	top := f.arrayDepth == 0
+	f.arrayDepth++
+	defer func() {
+		f.arrayDepth--
+	}()
+	budgeted := top && f.budget != nil
+	if less, ok := f.priorities[t.name]; ok && top {
+		v = prioritize(v, less)
+	}
+
 	snapBuf := &bytes.Buffer{}
 	var snapIndexBuf *bytes.Buffer
 	if t.index != "" {
 		snapIndexBuf = &bytes.Buffer{}
 	}
 
+	// Chunked values are self-delimiting, but the index cannot record
+	// chunked array elements.
+	if t.chunked && v.Type().Elem().Kind() == reflect.String {
+		return 0, fmt.Errorf("chunked encoding is not supported for array %s elements", t.name)
+	}
+
 	var totalSz int
 	var lastLen int
 	var err error
 	var sz int
+	var count int
+	provenance := f.hasProvenance(v.Type().Elem())
 	for i := 0; i < v.Len(); i++ {
-		el := v.Index(i)
-		sz, err = f.writeObject(el, t, snapBuf)
+		var elSz int
+		elSz, sz, err = f.writeElement(v.Index(i), t, provenance, snapBuf)
+		if err != nil {
+			return 0, err
+		}
+
+		var drop bool
+		drop, err = f.dropElement(t, i, sz)
 		if err != nil {
 			return 0, err
 		}
+		if drop {
+			snapBuf.Truncate(lastLen)
+			continue
+		}
+
+		if budgeted && f.budget.drop(t.name, i) {
+			snapBuf.Truncate(lastLen)
+			continue
+		}
+		count++
+
 		totalSz += sz
 		bufLen := snapBuf.Len()
 
-		if t.index != "" {
-			switch v := t.indexVal.(type) {
-			case string:
-				sz, err = f.WriteFixedStringField(0, t.indexSz, v, snapIndexBuf)
-				if err != nil {
-					return 0, err
-				}
-				totalSz += sz
-			case int64:
-				sz, err = f.WriteInt64Field(0, v, snapIndexBuf)
-				if err != nil {
-					return 0, err
-				}
-				totalSz += sz
-			default:
-				return 0, ErrInvalidIndexFieldType
+		if t.keys != nil {
+			t.indexVal, err = f.compositeKey(t)
+			if err != nil {
+				return 0, err
 			}
-			sz, err = f.WriteSizeField(0, bufLen-lastLen, snapIndexBuf)
+		}
+
+		if t.index != "" {
+			sz, err = f.writeElementKey(t.indexVal, t.indexSz, snapBuf.Bytes()[lastLen:bufLen], elSz, snapIndexBuf)
 			if err != nil {
 				return 0, err
 			}
 			totalSz += sz
-			lastLen = bufLen
 		}
+		lastLen = bufLen
 	}
 
 	// Write the size of the entire array, including the size, length, index, and elements.
@@ -233,7 +618,7 @@ func (f *rsfWriter) writeArray(v reflect.Value, t *tag, buf *bytes.Buffer) (int,
 	}
 
 	// Write the array length.
-	_, err = f.WriteSizeField(0, v.Len(), buf)
+	_, err = f.WriteSizeField(0, count, buf)
 	if err != nil {
 		return 0, err
 	}
@@ -255,10 +640,84 @@ func (f *rsfWriter) writeArray(v reflect.Value, t *tag, buf *bytes.Buffer) (int,
 	return totalSz, nil
 }
 
+// writeElement writes the array element `el` to `buf`, followed by its
+// provenance when `provenance` is true. It returns the size of the element,
+// which is hashed for the array index, and the total size written.
+func (f *rsfWriter) writeElement(el reflect.Value, t *tag, provenance bool, buf *bytes.Buffer) (int, int, error) {
+	t.expiresAt = 0
+	elSz, err := f.writeObject(el, t, buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !provenance {
+		return elSz, elSz, nil
+	}
+	provSz, err := f.writeProvenance(el, buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	return elSz, elSz + provSz, nil
+}
+
+// writeElementKey writes the index entry of the encoded array element `el`:
+// its key, `key`, its size, and the hash of the first `elSz` bytes, which
+// exclude any provenance, when element hashes are included.
+func (f *rsfWriter) writeElementKey(key any, keySz int, el []byte, elSz int, buf *bytes.Buffer) (int, error) {
+	var totalSz int
+	var sz int
+	var err error
+	switch v := key.(type) {
+	case string:
+		sz, err = f.WriteFixedStringField(0, keySz, v, buf)
+	case int64:
+		sz, err = f.writeIntKey(v, buf)
+	default:
+		return 0, ErrInvalidIndexFieldType
+	}
+	if err != nil {
+		return 0, err
+	}
+	totalSz += sz
+	sz, err = f.WriteSizeField(0, len(el), buf)
+	if err != nil {
+		return 0, err
+	}
+	totalSz += sz
+	sz, err = f.writeElementHash(el[:elSz], buf)
+	if err != nil {
+		return 0, err
+	}
+	return totalSz + sz, nil
+}
+
+// dropElement returns true if element `i` of the array described by `t`,
+// which was written with size `sz`, is dropped because it is expired (see
+// `WithDropExpired`) or too large for `WithMaxElementSize` and reported to
+// the oversize callback. `ErrElementTooLarge` is returned for elements that
+// are too large when there is no callback.
+func (f *rsfWriter) dropElement(t *tag, i, sz int) (bool, error) {
+	if f.expired(t.expiresAt) {
+		return true, nil
+	}
+	if f.maxElementSize > 0 && sz > f.maxElementSize {
+		tooLarge := ErrElementTooLarge{Array: t.name, Index: i, Size: sz, Max: f.maxElementSize}
+		if f.onOversize == nil {
+			return false, tooLarge
+		}
+		f.onOversize(tooLarge)
+		return true, nil
+	}
+	return false, nil
+}
+
 func (f *rsfWriter) writeString(s string, t *tag, buf *bytes.Buffer) (int, error) {
 	var err error
 	var sz int
-	if t.fixed > 0 {
+	if t.chunked && t.fixed > 0 {
+		return 0, fmt.Errorf("field %s cannot be both fixed and chunked", t.name)
+	} else if t.chunked {
+		sz, err = f.WriteChunkedField(0, defaultChunkSize, strings.NewReader(s), buf)
+	} else if t.fixed > 0 {
 		sz, err = f.WriteFixedStringField(0, t.fixed, s, buf)
 	} else {
 		sz, err = f.WriteStringField(0, s, buf)
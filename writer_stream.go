@@ -0,0 +1,186 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// ErrArrayOpen is returned when writing to a Writer while an array started
+// with `BeginArray` is open.
+var ErrArrayOpen = errors.New("cannot write while an array is open")
+
+// ArrayWriter writes the elements of a top-level object with a single array
+// field directly to the destination of a Writer. See `BeginArray`.
+type ArrayWriter[T any] struct {
+	f  *rsfWriter
+	ws io.WriteSeeker
+
+	// The positions of the record size and array size fields, and the size
+	// of the record preceding the array elements.
+	recordPos int64
+	arrayPos  int64
+	prefixSz  int
+
+	elTag      *tag
+	elBuf      *bytes.Buffer
+	provenance bool
+	count      int
+	elSz       int
+
+	// The size of the index record, if written, and the first error, after
+	// which the array cannot be completed.
+	indexSz int
+	err     error
+}
+
+// BeginArray starts writing a top-level object with a single array field,
+// `name`, like `WriteArrayFromChannel`. Use `WriteElement` to write each
+// element as it is produced, e.g., from a database cursor, and `EndArray` to
+// complete the object. Each element is written to the destination as it is
+// encoded, so neither the elements nor their encoded data are held in memory.
+// The index is written first if this is the first object.
+//
+// Since the array size and length precede the elements, they are written as
+// placeholders and patched by `EndArray`, so the Writer's destination must be
+// an io.WriteSeeker, such as an *os.File. Streaming arrays are not supported
+// with options that process the written data, such as `Chain`, `WithDigest`,
+// `WithTee`, `WithMaxSize`, or `WithObjectTable`.
+//
+// Streaming arrays are never indexed. The keys of an indexed array are
+// written between the array length and the elements, and their total size is
+// not known until the array is ended, so no placeholder can be reserved for
+// them. Use `WriteArrayFromChannel` with a key function to write an indexed
+// array. Since the file index is written with the first object, a streaming
+// array cannot follow an indexed array written by `WriteArrayFromChannel`,
+// and an indexed array cannot follow a streaming array.
+//
+// Since elements are written as they are received, `WithMaxElementSize` and
+// `WithDropExpired` are not applied. No other objects can be written until
+// the array is ended. If an error occurs, the file is incomplete and the
+// Writer cannot be used.
+func BeginArray[T any](w Writer, name string) (*ArrayWriter[T], error) {
+	f, ok := w.(*rsfWriter)
+	if !ok {
+		return nil, fmt.Errorf("unsupported writer type %T", w)
+	}
+	err := f.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+	ws, ok := f.writer.(io.WriteSeeker)
+	if !ok {
+		return nil, fmt.Errorf("streaming array %s requires an io.WriteSeeker destination without tees, digests, size limits, or object tables", name)
+	}
+	if f.headerFlags&FlagLayers != 0 || f.flags&FlagLayers != 0 {
+		return nil, fmt.Errorf("streaming array %s cannot be written with layers", name)
+	}
+
+	if index := f.channelIndex; index != nil && index.index != "" {
+		return nil, fmt.Errorf("streaming array %s cannot be indexed, but the file index was written for an indexed array", name)
+	}
+
+	elType := reflect.TypeOf((*T)(nil)).Elem()
+	a := &ArrayWriter[T]{f: f, ws: ws, elTag: &tag{name: name}, elBuf: &bytes.Buffer{}, provenance: f.hasProvenance(elType)}
+	if f.pos == 0 {
+		indexTag := &tag{name: name}
+		a.indexSz, err = f.writeIndexRecord(func(buf *bytes.Buffer) (int, error) {
+			return f.writeIndexArray(reflect.SliceOf(elType), indexTag, buf)
+		})
+		if err != nil {
+			return nil, err
+		}
+		f.channelIndex = indexTag
+	}
+
+	// Write the record with placeholders for the record size, array size,
+	// and array length.
+	buf := &bytes.Buffer{}
+	buf.Write(make([]byte, sizeFieldLen*2))
+	var offsets []fieldOffset
+	if f.headerFlags&FlagFieldOffsets != 0 {
+		offsets = []fieldOffset{{name: name, offset: 0}}
+	}
+	record, err := f.encodeRecord(buf, offsets)
+	if err != nil {
+		return nil, err
+	}
+	a.recordPos, err = ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	a.prefixSz = record.Len()
+	a.arrayPos = a.recordPos + int64(a.prefixSz-sizeFieldLen*2)
+	_, err = ws.Write(record.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	f.openArray = true
+	return a, nil
+}
+
+// WriteElement encodes `el`, followed by its provenance for
+// `ProvenanceProvider` elements, and writes it to the destination.
+func (a *ArrayWriter[T]) WriteElement(el T) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.elBuf.Reset()
+	_, _, err := a.f.writeElement(reflect.ValueOf(el), a.elTag, a.provenance, a.elBuf)
+	if err == nil {
+		_, err = a.ws.Write(a.elBuf.Bytes())
+	}
+	if err != nil {
+		a.err = fmt.Errorf("error writing array %s element %d: %w", a.elTag.name, a.count, err)
+		return a.err
+	}
+	a.count++
+	a.elSz += a.elBuf.Len()
+	return nil
+}
+
+// EndArray patches the record size, array size, and array length, and
+// completes the object. The total size of the object, including the index
+// record, if written, is returned.
+func (a *ArrayWriter[T]) EndArray() (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	a.err = a.patch()
+	if a.err != nil {
+		return 0, a.err
+	}
+	a.err = fmt.Errorf("array %s is already ended", a.elTag.name)
+	a.f.openArray = false
+	a.f.pos++
+	return a.indexSz + a.prefixSz + a.elSz, nil
+}
+
+// patch writes the record size, array size, and array length, and seeks to
+// the end of the object.
+func (a *ArrayWriter[T]) patch() error {
+	end := a.recordPos + int64(a.prefixSz+a.elSz)
+	fields := []struct {
+		pos int64
+		val int
+	}{
+		{a.recordPos, a.prefixSz + a.elSz},
+		{a.arrayPos, sizeFieldLen*2 + a.elSz},
+		{a.arrayPos + sizeFieldLen, a.count},
+	}
+	for _, field := range fields {
+		_, err := a.ws.Seek(field.pos, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		_, err = a.f.WriteSizeField(0, field.val, a.ws)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := a.ws.Seek(end, io.SeekStart)
+	return err
+}
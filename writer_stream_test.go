@@ -0,0 +1,161 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterStreamSuite struct {
+	suite.Suite
+}
+
+func TestWriterStreamSuite(t *testing.T) {
+	suite.Run(t, &WriterStreamSuite{})
+}
+
+func (s *WriterStreamSuite) create() *os.File {
+	f, err := os.Create(filepath.Join(s.T().TempDir(), "stream.rsf"))
+	s.Require().Nil(err)
+	s.T().Cleanup(func() { f.Close() })
+	return f
+}
+
+func (s *WriterStreamSuite) stream(w Writer, items []channelItem) int {
+	a, err := BeginArray[channelItem](w, "items")
+	s.Require().Nil(err)
+	for _, item := range items {
+		s.Require().Nil(a.WriteElement(item))
+	}
+	sz, err := a.EndArray()
+	s.Require().Nil(err)
+	return sz
+}
+
+func (s *WriterStreamSuite) TestBeginArray() {
+	for _, opts := range [][]WriterOption{nil, {WithFieldOffsets()}} {
+		expected := &bytes.Buffer{}
+		w := NewWriterWithVersion(expected, Version3, opts...)
+		_, err := w.WriteObject(channelObjectNoIndex{Items: channelItems})
+		s.Require().Nil(err)
+		_, err = w.WriteObject(channelObjectNoIndex{})
+		s.Require().Nil(err)
+		_, err = w.WriteObject(channelObjectNoIndex{Items: channelItems[1:]})
+		s.Require().Nil(err)
+
+		// The streamed file matches the file written with `WriteObject`.
+		f := s.create()
+		w = NewWriterWithVersion(f, Version3, opts...)
+		sz := s.stream(w, channelItems)
+		info, err := f.Stat()
+		s.Require().Nil(err)
+		s.Assert().Equal(int(info.Size()), sz)
+		s.stream(w, nil)
+		s.stream(w, channelItems[1:])
+		_, err = w.Finalize()
+		s.Require().Nil(err)
+		actual, err := os.ReadFile(f.Name())
+		s.Require().Nil(err)
+		s.Assert().Equal(expected.Bytes(), actual)
+
+		// The objects can be read back.
+		obj, err := OpenObject(f)
+		s.Require().Nil(err)
+		val, err := ReadFieldAt(f, obj, "items")
+		s.Require().Nil(err)
+		s.Assert().Len(val, 3)
+		r := NewReader()
+		var result channelObjectNoIndex
+		s.Require().Nil(r.ReadObject(bytes.NewReader(actual), &result))
+		s.Assert().Equal(channelItems, result.Items)
+	}
+}
+
+func (s *WriterStreamSuite) TestProvenance() {
+	type object struct {
+		Packages []sourcedPkg `rsf:"packages"`
+	}
+	expected := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(expected, Version3).WriteObject(object{Packages: sourcedData.Packages})
+	s.Require().Nil(err)
+
+	f := s.create()
+	w := NewWriterWithVersion(f, Version3)
+	a, err := BeginArray[sourcedPkg](w, "packages")
+	s.Require().Nil(err)
+	for _, pkg := range sourcedData.Packages {
+		s.Require().Nil(a.WriteElement(pkg))
+	}
+	_, err = a.EndArray()
+	s.Require().Nil(err)
+	actual, err := os.ReadFile(f.Name())
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), actual)
+
+	obj, err := OpenObject(f)
+	s.Require().Nil(err)
+	pkgs, err := ReadFieldAt(f, obj, "packages")
+	s.Require().Nil(err)
+	s.Require().Len(pkgs, 2)
+	p, ok := ElementProvenance(pkgs.([]any)[0])
+	s.Assert().True(ok)
+	s.Assert().Equal("https://cran.r-project.org/plyr", p.Source)
+}
+
+func (s *WriterStreamSuite) TestOpenArray() {
+	f := s.create()
+	w := NewWriterWithVersion(f, Version3)
+	a, err := BeginArray[channelItem](w, "items")
+	s.Require().Nil(err)
+	s.Require().Nil(a.WriteElement(channelItems[0]))
+
+	// No other objects can be written until the array is ended.
+	_, err = w.WriteObject(channelObjectNoIndex{})
+	s.Assert().ErrorIs(err, ErrArrayOpen)
+	_, err = BeginArray[channelItem](w, "items")
+	s.Assert().ErrorIs(err, ErrArrayOpen)
+	_, err = w.Finalize()
+	s.Assert().ErrorIs(err, ErrArrayOpen)
+
+	_, err = a.EndArray()
+	s.Require().Nil(err)
+	s.Assert().NotNil(a.WriteElement(channelItems[1]))
+	_, err = a.EndArray()
+	s.Assert().NotNil(err)
+	_, err = w.WriteObject(channelObjectNoIndex{Items: channelItems})
+	s.Assert().Nil(err)
+}
+
+func (s *WriterStreamSuite) TestErrors() {
+	// The destination must be seekable.
+	_, err := BeginArray[channelItem](NewWriterWithVersion(&bytes.Buffer{}, Version3), "items")
+	s.Assert().ErrorContains(err, "requires an io.WriteSeeker")
+	_, err = BeginArray[channelItem](NewWriterWithVersion(s.create(), Version3, WithDigest()), "items")
+	s.Assert().ErrorContains(err, "requires an io.WriteSeeker")
+
+	// The element error is returned again by later calls.
+	w := NewWriterWithVersion(s.create(), Version3)
+	a, err := BeginArray[channelItem](w, "items")
+	s.Require().Nil(err)
+	err = a.WriteElement(channelItem{Key: "toolong"})
+	s.Assert().ErrorContains(err, "error writing array items element 0")
+	s.Assert().Equal(err, a.WriteElement(channelItems[0]))
+	_, endErr := a.EndArray()
+	s.Assert().Equal(err, endErr)
+
+	// Streaming arrays are never indexed, so they cannot be mixed with
+	// indexed arrays in the same file.
+	w = NewWriterWithVersion(s.create(), Version3)
+	_, err = WriteArrayFromChannel(w, "items", produce(channelItems), func(item channelItem) string { return item.Key })
+	s.Require().Nil(err)
+	_, err = BeginArray[channelItem](w, "items")
+	s.Assert().EqualError(err, "streaming array items cannot be indexed, but the file index was written for an indexed array")
+	w = NewWriterWithVersion(s.create(), Version3)
+	s.stream(w, channelItems)
+	_, err = WriteArrayFromChannel(w, "items", produce(channelItems), func(item channelItem) string { return item.Key })
+	s.Assert().EqualError(err, "array items is indexed, but the file index was written for an array without an index")
+}
@@ -6,9 +6,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -25,6 +28,65 @@ func (s *WriterSuite) TestNewWriter() {
 	buf := &bytes.Buffer{}
 	w := NewWriterWithVersion(buf, Version2)
 	s.Assert().Equal(&rsfWriter{writer: buf, version: Version2}, w)
+
+	w = NewWriter(buf, WithVersion(Version3))
+	s.Assert().Equal(&rsfWriter{writer: buf, version: Version3}, w)
+	w = NewWriter(buf)
+	s.Assert().Equal(&rsfWriter{writer: buf, version: Version1}, w)
+}
+
+func (s *WriterSuite) TestWithChecksums() {
+	expected := &bytes.Buffer{}
+	w := NewWriterWithVersion(expected, Version3, Chain(Checksum(), Zstd()))
+	_, err := w.WriteObject(channelObject{Items: channelItems})
+	s.Require().Nil(err)
+
+	actual := &bytes.Buffer{}
+	w = NewWriter(actual, WithVersion(Version3), WithChecksums(), Chain(Zstd()))
+	_, err = w.WriteObject(channelObject{Items: channelItems})
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), actual.Bytes())
+
+	// Corrupted objects are detected.
+	bs := actual.Bytes()
+	bs[len(bs)-1] ^= 0xff
+	ra := bytes.NewReader(bs)
+	obj, err := OpenObject(ra)
+	s.Require().Nil(err)
+	_, err = ReadFieldAt(ra, obj, "items")
+	s.Assert().NotNil(err)
+}
+
+func (s *WriterSuite) TestWithCompression() {
+	text := strings.Repeat("a long package description ", 100)
+	write := func(opts ...WriterOption) []byte {
+		buf := &bytes.Buffer{}
+		w := NewWriterWithVersion(buf, Version3, opts...)
+		for i := 0; i < 3; i++ {
+			_, err := w.WriteObject(headerTestObject{Company: fmt.Sprintf("%d %s", i, text)})
+			s.Require().Nil(err)
+		}
+		_, err := w.Finalize()
+		s.Require().Nil(err)
+		return buf.Bytes()
+	}
+	compressed := write(WithCompression(Zstd()), WithObjectTable())
+	s.Assert().Equal(write(Chain(Zstd()), WithObjectTable()), compressed)
+	s.Assert().Less(len(compressed)*10, len(write(WithObjectTable())))
+
+	// Objects are located and decompressed transparently.
+	table, err := OpenObjectTable(bytes.NewReader(compressed), int64(len(compressed)))
+	s.Require().Nil(err)
+	obj, err := table.Object(2)
+	s.Require().Nil(err)
+	company, err := ReadFieldAt(bytes.NewReader(compressed), obj, "company")
+	s.Require().Nil(err)
+	s.Assert().Equal("2 "+text, company)
+
+	var actual headerTestObject
+	err = NewReader().ReadObject(bufio.NewReader(bytes.NewReader(compressed)), &actual)
+	s.Require().Nil(err)
+	s.Assert().Equal("0 "+text, actual.Company)
 }
 
 func (s *WriterSuite) TestDiscreteWrites() {
@@ -1305,3 +1367,235 @@ arrays (array(2)):
     - cannot print data for arrays of arrays
 `, "\n"+pbuf.String())
 }
+
+func (s *WriterSuite) TestWriteChunkedField() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version2)
+
+	_, err := w.WriteChunkedField(0, 0, strings.NewReader("package-manager"), buf)
+	s.Assert().ErrorContains(err, "invalid chunk size 0")
+
+	sz, err := w.WriteChunkedField(0, 6, strings.NewReader("package-manager"), buf)
+	s.Assert().Nil(err)
+	s.Assert().Equal(31, sz)
+	s.Assert().Equal([]byte{
+		// 6 byte chunk
+		0x6, 0x0, 0x0, 0x0,
+		// "packag"
+		0x70, 0x61, 0x63, 0x6b, 0x61, 0x67,
+		// 6 byte chunk
+		0x6, 0x0, 0x0, 0x0,
+		// "e-mana"
+		0x65, 0x2d, 0x6d, 0x61, 0x6e, 0x61,
+		// 3 byte chunk
+		0x3, 0x0, 0x0, 0x0,
+		// "ger"
+		0x67, 0x65, 0x72,
+		// terminator
+		0x0, 0x0, 0x0, 0x0,
+	}, buf.Bytes())
+
+	// An empty value is written as a terminator only.
+	buf.Reset()
+	sz, err = w.WriteChunkedField(0, 6, strings.NewReader(""), buf)
+	s.Assert().Nil(err)
+	s.Assert().Equal(4, sz)
+	s.Assert().Equal([]byte{0x0, 0x0, 0x0, 0x0}, buf.Bytes())
+
+	// Read errors are returned after writing the partial chunk.
+	buf.Reset()
+	_, err = w.WriteChunkedField(0, 6, iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("package-manager"))), buf)
+	s.Assert().ErrorIs(err, iotest.ErrTimeout)
+	s.Assert().Equal([]byte{0x1, 0x0, 0x0, 0x0, 0x70}, buf.Bytes())
+}
+
+func (s *WriterSuite) TestWriteObjectChunked() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version2)
+
+	type chunkedObject struct {
+		Name        string `rsf:"name"`
+		Description string `rsf:"description,chunked"`
+		Ready       bool   `rsf:"ready"`
+	}
+	a := chunkedObject{
+		Name:        "posit",
+		Description: strings.Repeat("a", defaultChunkSize+10),
+		Ready:       true,
+	}
+
+	sz, err := w.WriteObject(a)
+	s.Assert().Nil(err)
+	s.Assert().Equal(buf.Len(), sz)
+
+	// Advance past the chunked field without reading it.
+	b := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	r := NewReader()
+	index, err := r.ReadIndex(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal(FieldTypeChunked, index[1].FieldType)
+	_, err = r.ReadSizeField(b)
+	s.Assert().Nil(err)
+	err = r.AdvanceTo(b, "ready")
+	s.Assert().Nil(err)
+	ready, err := r.ReadBoolField(b)
+	s.Assert().Nil(err)
+	s.Assert().True(ready)
+	s.Assert().Equal(buf.Len(), r.Pos())
+
+	// Read the chunked field.
+	b = bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	r = NewReader()
+	_, err = r.ReadIndex(b)
+	s.Assert().Nil(err)
+	_, err = r.ReadSizeField(b)
+	s.Assert().Nil(err)
+	err = r.AdvanceTo(b, "description")
+	s.Assert().Nil(err)
+	description, err := r.ReadChunkedField(b)
+	s.Assert().Nil(err)
+	s.Assert().Equal(a.Description, string(description))
+
+	// Fixed and chunked cannot be combined.
+	type invalidObject struct {
+		Description string `rsf:"description,chunked,fixed:4"`
+	}
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version2).WriteObject(invalidObject{Description: "test"})
+	s.Assert().ErrorContains(err, "field description cannot be both fixed and chunked")
+
+	// Chunked array elements are not supported.
+	type invalidArray struct {
+		Aliases []string `rsf:"aliases,chunked"`
+	}
+	_, err = NewWriterWithVersion(&bytes.Buffer{}, Version2).WriteObject(invalidArray{Aliases: []string{"test"}})
+	s.Assert().ErrorContains(err, "chunked encoding is not supported for array aliases elements")
+
+	// Print
+	a.Description = "a chunked description"
+	buf.Reset()
+	w = NewWriterWithVersion(buf, Version2)
+	_, err = w.WriteObject(a)
+	s.Assert().Nil(err)
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(buf))
+	s.Require().Nil(err)
+	s.Require().Equal(`
+-----------------------------------------
+                Object[1]                
+-----------------------------------------
+name (string): posit
+description (chunked string): a chunked description
+ready (bool): true
+`, "\n"+pbuf.String())
+}
+
+// shortWriter accepts at most `limit` bytes in total.
+type shortWriter struct {
+	limit int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, nil
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func (s *WriterSuite) TestWithTee() {
+	opts := [][]WriterOption{
+		nil,
+		{WithFieldHashes(), WithDigest()},
+		{Chain(Checksum(), Zstd())},
+	}
+	for _, o := range opts {
+		// Write to a destination, two tees, and an `io.MultiWriter`
+		// including a counting writer.
+		dest := &bytes.Buffer{}
+		archive := &bytes.Buffer{}
+		network := &bytes.Buffer{}
+		counted := NewCountingWriter(&bytes.Buffer{})
+		multi := &bytes.Buffer{}
+		w := NewWriterWithVersion(dest, Version3, append(o, WithTee(archive), WithTee(io.MultiWriter(network, counted)))...)
+		mw := NewWriterWithVersion(io.MultiWriter(multi, &bytes.Buffer{}), Version3, o...)
+
+		var total, multiTotal int
+		for _, items := range [][]channelItem{channelItems, channelItems[1:]} {
+			sz, err := w.WriteObject(channelObject{Items: items})
+			s.Require().Nil(err)
+			total += sz
+			sz, err = mw.WriteObject(channelObject{Items: items})
+			s.Require().Nil(err)
+			multiTotal += sz
+		}
+		sz, err := w.Finalize()
+		s.Require().Nil(err)
+		total += sz
+		sz, err = mw.Finalize()
+		s.Require().Nil(err)
+		multiTotal += sz
+
+		// All destinations receive identical bytes, and the returned
+		// sizes match each destination.
+		s.Assert().Equal(dest.Bytes(), archive.Bytes())
+		s.Assert().Equal(dest.Bytes(), network.Bytes())
+		s.Assert().Equal(dest.Bytes(), multi.Bytes())
+		s.Assert().Equal(dest.Len(), total)
+		s.Assert().Equal(dest.Len(), multiTotal)
+		s.Assert().Equal(dest.Len(), counted.Pos())
+	}
+
+	// A short write to a tee is an error
+	w := NewWriterWithVersion(&bytes.Buffer{}, Version3, WithTee(&shortWriter{limit: 10}))
+	_, err := w.WriteObject(channelObject{Items: channelItems})
+	s.Assert().ErrorIs(err, io.ErrShortWrite)
+}
+
+func (s *WriterSuite) TestWithMaxElementSize() {
+	type pkg struct {
+		Name        string `rsf:"name,fixed:3"`
+		Description string `rsf:"description"`
+	}
+	type repo struct {
+		Packages []pkg `rsf:"packages,index:name"`
+	}
+	data := repo{
+		Packages: []pkg{
+			{Name: "abc", Description: "short"},
+			{Name: "def", Description: strings.Repeat("long", 10)},
+			{Name: "ghi", Description: "short"},
+		},
+	}
+
+	// Elements within the limit are written normally. Each element includes
+	// a 3-byte name and a 4-byte description size.
+	buf := &bytes.Buffer{}
+	_, err := NewWriterWithVersion(buf, Version2, WithMaxElementSize(47, nil)).WriteObject(data)
+	s.Assert().Nil(err)
+
+	// Oversized elements fail by default
+	buf = &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version2, WithMaxElementSize(46, nil)).WriteObject(data)
+	var tooLarge ErrElementTooLarge
+	s.Require().ErrorAs(err, &tooLarge)
+	s.Assert().Equal(ErrElementTooLarge{Array: "packages", Index: 1, Size: 47, Max: 46}, tooLarge)
+	s.Assert().EqualError(err, "array packages element 1 size 47 exceeds maximum element size 46")
+
+	// Oversized elements are dropped when using a callback
+	var oversized []ErrElementTooLarge
+	buf = &bytes.Buffer{}
+	_, err = NewWriterWithVersion(buf, Version2, WithMaxElementSize(46, func(e ErrElementTooLarge) {
+		oversized = append(oversized, e)
+	})).WriteObject(data)
+	s.Assert().Nil(err)
+	s.Assert().Equal([]ErrElementTooLarge{tooLarge}, oversized)
+
+	expected := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(expected, Version2).WriteObject(repo{
+		Packages: []pkg{data.Packages[0], data.Packages[2]},
+	})
+	s.Require().Nil(err)
+	s.Assert().Equal(expected.Bytes(), buf.Bytes())
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bytes"
+	"io"
+)
+
+/*
+
+When using `WithDigest`, `Finalize` writes a trailer following the last
+object. The trailer begins with a zero object size, which readers treat as the
+end of the objects. Since the trailer ends with its size and a magic value,
+the trailer can be found by reading the end of the file, even while streaming.
+
+The digest covers all bytes preceding the trailer.
+
+When using `WithCompletionMarker` without `WithDigest`, the trailer has no
+digest and uses `DigestNone`. Either trailer marks the file as complete, since
+it is only written by `Finalize`; a file whose header declares a trailer (see
+`FlagDigest` and `FlagTrailer`) but does not end with one is incomplete. See
+`CheckComplete`.
+
+Format:
+
+  [zero object size]
+  [digest]
+  [digest algorithm]
+  [trailer size]
+  [trailer magic]
+
+Example:
+
+  0x0, 0x0, 0x0, 0x0,                             // Zero object size
+  0xe3, 0xb0, 0xc4, ...,                          // 32-byte SHA-256 digest
+  0x1, 0x0, 0x0, 0x0,                             // DigestSHA256
+  0x30, 0x0, 0x0, 0x0,                            // 48 bytes full trailer size
+  0x72, 0x73, 0x66, 0x54,                         // "rsfT"
+
+Example without a digest:
+
+  0x0, 0x0, 0x0, 0x0,                             // Zero object size
+  0x0, 0x0, 0x0, 0x0,                             // DigestNone
+  0x10, 0x0, 0x0, 0x0,                            // 16 bytes full trailer size
+  0x72, 0x73, 0x66, 0x54,                         // "rsfT"
+
+*/
+
+// TrailerMagic identifies the end of a file trailer.
+var TrailerMagic = []byte{0x72, 0x73, 0x66, 0x54}
+
+// Digest algorithms recorded in the trailer.
+const (
+	// DigestNone is recorded by trailers that only mark the file as
+	// complete. See `WithCompletionMarker`.
+	DigestNone   = 0
+	DigestSHA256 = 1
+)
+
+// The size of the trailer fields other than the digest.
+const trailerFixedLen = sizeFieldLen * 4
+
+func (f *rsfWriter) Finalize() (int, error) {
+	if f.finalized {
+		return 0, ErrFinalized
+	}
+	if f.openArray {
+		return 0, ErrArrayOpen
+	}
+	f.finalized = true
+	defer f.defaultEncoding()()
+
+	tableSz, err := f.writeObjectTable()
+	if err != nil || (f.digest == nil && f.flags&FlagTrailer == 0) {
+		return tableSz, err
+	}
+
+	var sum []byte
+	algorithm := DigestNone
+	if f.digest != nil {
+		sum = f.digest.Sum(nil)
+		algorithm = DigestSHA256
+	}
+
+	buf := &bytes.Buffer{}
+	_, err = f.WriteSizeField(0, 0, buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = buf.Write(sum)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.WriteSizeField(0, algorithm, buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.WriteSizeField(0, trailerFixedLen+len(sum), buf)
+	if err != nil {
+		return 0, err
+	}
+	_, err = buf.Write(TrailerMagic)
+	if err != nil {
+		return 0, err
+	}
+
+	sz, err := io.Copy(f.writer, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	return tableSz + int(sz), nil
+}
@@ -0,0 +1,224 @@
+// Copyright (C) 2023 by Posit Software, PBC
+package rsf
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterTrailerSuite struct {
+	suite.Suite
+}
+
+func TestWriterTrailerSuite(t *testing.T) {
+	suite.Run(t, &WriterTrailerSuite{})
+}
+
+func (s *WriterTrailerSuite) write() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithDigest())
+	for _, obj := range testComplexData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	sz, err := w.Finalize()
+	s.Require().Nil(err)
+	s.Require().Equal(48, sz)
+	return buf.Bytes()
+}
+
+func (s *WriterTrailerSuite) TestFinalize() {
+	data := s.write()
+	body := data[:len(data)-48]
+	sum := sha256.Sum256(body)
+
+	trailer := []byte{0x0, 0x0, 0x0, 0x0}
+	trailer = append(trailer, sum[:]...)
+	trailer = append(trailer,
+		// DigestSHA256
+		0x1, 0x0, 0x0, 0x0,
+		// Trailer size
+		0x30, 0x0, 0x0, 0x0,
+		// "rsfT"
+		0x72, 0x73, 0x66, 0x54,
+	)
+	s.Assert().Equal(trailer, data[len(data)-48:])
+
+	// Objects cannot be written after finalizing
+	w := NewWriterWithVersion(&bytes.Buffer{}, Version3, WithDigest())
+	_, err := w.Finalize()
+	s.Assert().Nil(err)
+	_, err = w.WriteObject(testComplexData[0])
+	s.Assert().ErrorIs(err, ErrFinalized)
+	_, err = w.Finalize()
+	s.Assert().ErrorIs(err, ErrFinalized)
+
+	// Without a digest, nothing is written
+	buf := &bytes.Buffer{}
+	w = NewWriterWithVersion(buf, Version3)
+	sz, err := w.Finalize()
+	s.Assert().Nil(err)
+	s.Assert().Equal(0, sz)
+	s.Assert().Equal(0, buf.Len())
+
+	// Readers stop at the trailer
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(bytes.NewReader(data)))
+	s.Assert().Nil(err)
+	s.Assert().Contains(pbuf.String(), "Object[2]")
+	s.Assert().NotContains(pbuf.String(), "Object[3]")
+
+	ra := bytes.NewReader(data)
+	obj, err := OpenObject(ra)
+	s.Assert().Nil(err)
+	obj, err = NextObject(ra, obj)
+	s.Assert().Nil(err)
+	_, err = NextObject(ra, obj)
+	s.Assert().ErrorIs(err, io.EOF)
+}
+
+func (s *WriterTrailerSuite) TestVerifyStream() {
+	data := s.write()
+	body := data[:len(data)-48]
+
+	// The trailer is removed from the stream.
+	verified, err := io.ReadAll(VerifyStream(bytes.NewReader(data)))
+	s.Assert().Nil(err)
+	s.Assert().Equal(body, verified)
+
+	// Small reads
+	verified, err = io.ReadAll(VerifyStream(iotest.OneByteReader(bytes.NewReader(data))))
+	s.Assert().Nil(err)
+	s.Assert().Equal(body, verified)
+
+	// Streaming consumers can read the verified stream.
+	pbuf := &bytes.Buffer{}
+	err = Print(pbuf, bufio.NewReader(VerifyStream(bytes.NewReader(data))))
+	s.Assert().Nil(err)
+	s.Assert().Contains(pbuf.String(), "Object[2]")
+
+	// Corrupted data
+	corrupt := bytes.Clone(data)
+	corrupt[200]++
+	_, err = io.ReadAll(VerifyStream(bytes.NewReader(corrupt)))
+	s.Assert().ErrorIs(err, ErrDigestMismatch)
+
+	// Corrupted digest
+	corrupt = bytes.Clone(data)
+	corrupt[len(corrupt)-20]++
+	_, err = io.ReadAll(VerifyStream(bytes.NewReader(corrupt)))
+	s.Assert().ErrorIs(err, ErrDigestMismatch)
+
+	// No trailer
+	verified, err = io.ReadAll(VerifyStream(bytes.NewReader(body)))
+	s.Assert().ErrorIs(err, ErrNoTrailer)
+	s.Assert().Equal(body, verified)
+
+	// Truncated
+	_, err = io.ReadAll(VerifyStream(bytes.NewReader(data[:len(data)-1])))
+	s.Assert().ErrorIs(err, ErrNoTrailer)
+}
+
+func (s *WriterTrailerSuite) TestVerifyFile() {
+	data := s.write()
+	s.Assert().Nil(VerifyFile(bytes.NewReader(data), int64(len(data))))
+
+	// Corrupted data
+	corrupt := bytes.Clone(data)
+	corrupt[200]++
+	s.Assert().ErrorIs(VerifyFile(bytes.NewReader(corrupt), int64(len(corrupt))), ErrDigestMismatch)
+
+	// Corrupted digest
+	corrupt = bytes.Clone(data)
+	corrupt[len(corrupt)-20]++
+	s.Assert().ErrorIs(VerifyFile(bytes.NewReader(corrupt), int64(len(corrupt))), ErrDigestMismatch)
+
+	// No trailer
+	body := data[:len(data)-48]
+	s.Assert().ErrorIs(VerifyFile(bytes.NewReader(body), int64(len(body))), ErrNoTrailer)
+	s.Assert().ErrorIs(VerifyFile(bytes.NewReader(nil), 0), ErrNoTrailer)
+
+	// Truncated
+	s.Assert().ErrorIs(VerifyFile(bytes.NewReader(data[:len(data)-1]), int64(len(data)-1)), ErrNoTrailer)
+}
+
+func (s *WriterTrailerSuite) TestCompletionMarker() {
+	buf := &bytes.Buffer{}
+	w := NewWriterWithVersion(buf, Version3, WithCompletionMarker(), WithObjectTable())
+	for _, obj := range testComplexData {
+		_, err := w.WriteObject(obj)
+		s.Require().Nil(err)
+	}
+	_, err := w.Finalize()
+	s.Require().Nil(err)
+	data := buf.Bytes()
+	s.Assert().Equal([]byte{
+		0x0, 0x0, 0x0, 0x0,
+		// DigestNone
+		0x0, 0x0, 0x0, 0x0,
+		// Trailer size
+		0x10, 0x0, 0x0, 0x0,
+		// "rsfT"
+		0x72, 0x73, 0x66, 0x54,
+	}, data[len(data)-16:])
+	s.Assert().Nil(CheckComplete(bytes.NewReader(data), int64(len(data))))
+	s.Assert().Nil(VerifyFile(bytes.NewReader(data), int64(len(data))))
+	_, err = io.ReadAll(VerifyStream(bytes.NewReader(data)))
+	s.Assert().Nil(err)
+	table, err := OpenObjectTable(bytes.NewReader(data), int64(len(data)))
+	s.Require().Nil(err)
+	s.Assert().Equal(len(testComplexData), table.Len())
+
+	// Files whose writer stopped before finalizing are incomplete
+	body := data[:len(data)-16-objectTableLen(len(testComplexData))]
+	for _, sz := range []int{len(data) - 16, len(data) - 1, len(body), len(body) - 10} {
+		s.Assert().ErrorIs(CheckComplete(bytes.NewReader(data[:sz]), int64(sz)), ErrIncomplete)
+	}
+	digest := s.write()
+	s.Assert().Nil(CheckComplete(bytes.NewReader(digest), int64(len(digest))))
+	s.Assert().ErrorIs(CheckComplete(bytes.NewReader(digest[:len(digest)-48]), int64(len(digest)-48)), ErrIncomplete)
+	corrupt := bytes.Clone(digest)
+	corrupt[200]++
+	s.Assert().ErrorIs(CheckComplete(bytes.NewReader(corrupt), int64(len(corrupt))), ErrDigestMismatch)
+
+	// Completeness cannot be determined without a trailer
+	plain := &bytes.Buffer{}
+	_, err = NewWriterWithVersion(plain, Version3).WriteObject(testComplexData[0])
+	s.Require().Nil(err)
+	s.Assert().ErrorIs(CheckComplete(bytes.NewReader(plain.Bytes()), int64(plain.Len())), ErrNoTrailer)
+
+	// Streaming readers can require the trailer
+	readAll := func(data []byte, opts ...ReaderOption) error {
+		r := NewReader(opts...)
+		br := bufio.NewReader(bytes.NewReader(data))
+		for {
+			var obj FullPackageRecordPyPI
+			err := r.ReadObject(br, &obj)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	s.Assert().Equal(io.EOF, readAll(data, WithRequireComplete()))
+	s.Assert().Equal(io.EOF, readAll(body))
+	s.Assert().ErrorIs(readAll(body, WithRequireComplete()), ErrIncomplete)
+	s.Assert().Equal(io.EOF, readAll(plain.Bytes(), WithRequireComplete()))
+
+	r := NewReader(WithRequireComplete())
+	br := bufio.NewReader(bytes.NewReader(body))
+	_, err = r.ReadIndex(br)
+	s.Require().Nil(err)
+	s.Assert().Equal([]string{"object-table", "trailer"}, r.Header().Features())
+	for range testComplexData {
+		_, err = r.SkipObject(br)
+		s.Require().Nil(err)
+	}
+	_, err = r.SkipObject(br)
+	s.Assert().ErrorIs(err, ErrIncomplete)
+}